@@ -7,7 +7,9 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/schema v1.2.0
 	github.com/gorilla/websocket v1.5.3
+	github.com/gosnmp/gosnmp v1.37.0
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/crypto v0.25.0
 	golang.org/x/net v0.27.0
 	golang.org/x/text v0.16.0
 	gopkg.in/yaml.v3 v3.0.1
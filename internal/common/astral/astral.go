@@ -0,0 +1,107 @@
+// Package astral calculates sunrise and sunset times for a given location.
+package astral
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Official zenith for sunrise/sunset, accounts for atmospheric refraction and the radius of the sun
+const zenith = 90.833
+
+var (
+	ErrNoSunrise = errors.New("sun does not rise at this location on this date")
+	ErrNoSunset  = errors.New("sun does not set at this location on this date")
+)
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// normalise wraps value into the range [0, max)
+func normalise(value float64, max float64) float64 {
+	value = math.Mod(value, max)
+	if value < 0 {
+		value += max
+	}
+	return value
+}
+
+// sunTime implements the sunrise equation from the Almanac for Computers (1990), returning the UTC time of the event.
+func sunTime(day time.Time, latitude float64, longitude float64, rising bool) (time.Time, error) {
+	year, month, date := day.Date()
+	midnight := time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+
+	lngHour := longitude / 15
+	t := float64(day.YearDay())
+	if rising {
+		t += (6 - lngHour) / 24
+	} else {
+		t += (18 - lngHour) / 24
+	}
+
+	// Sun's mean anomaly and true longitude
+	m := 0.9856*t - 3.289
+	l := normalise(m+1.916*math.Sin(degToRad(m))+0.020*math.Sin(degToRad(2*m))+282.634, 360)
+
+	// Sun's right ascension, placed in the same quadrant as l and converted to hours
+	ra := normalise(radToDeg(math.Atan(0.91764*math.Tan(degToRad(l)))), 360)
+	ra += math.Floor(l/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	// Sun's declination
+	sinDec := 0.39782 * math.Sin(degToRad(l))
+	cosDec := math.Cos(math.Asin(sinDec))
+
+	// Sun's local hour angle
+	cosH := (math.Cos(degToRad(zenith)) - sinDec*math.Sin(degToRad(latitude))) / (cosDec * math.Cos(degToRad(latitude)))
+	if cosH > 1 {
+		return time.Time{}, ErrNoSunrise
+	} else if cosH < -1 {
+		return time.Time{}, ErrNoSunset
+	}
+
+	var h float64
+	if rising {
+		h = 360 - radToDeg(math.Acos(cosH))
+	} else {
+		h = radToDeg(math.Acos(cosH))
+	}
+	h /= 15
+
+	ut := normalise(h+ra-0.06571*t-6.622-lngHour, 24)
+	event := midnight.Add(time.Duration(ut * float64(time.Hour)))
+
+	// ut is wrapped to a 24 hour window, so move the event onto the same solar day as local noon
+	solarNoon := midnight.Add(time.Duration((12 - lngHour) * float64(time.Hour)))
+	if event.Sub(solarNoon) > 12*time.Hour {
+		event = event.Add(-24 * time.Hour)
+	} else if solarNoon.Sub(event) > 12*time.Hour {
+		event = event.Add(24 * time.Hour)
+	}
+
+	return event, nil
+}
+
+// Sunrise returns the time of sunrise on the calendar day of day at the given coordinates.
+func Sunrise(day time.Time, latitude float64, longitude float64) (time.Time, error) {
+	event, err := sunTime(day, latitude, longitude, true)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return event.In(day.Location()), nil
+}
+
+// Sunset returns the time of sunset on the calendar day of day at the given coordinates.
+func Sunset(day time.Time, latitude float64, longitude float64) (time.Time, error) {
+	event, err := sunTime(day, latitude, longitude, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return event.In(day.Location()), nil
+}
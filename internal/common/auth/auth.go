@@ -0,0 +1,34 @@
+// Package auth provides bearer token checks for privileged requests.
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+)
+
+// Token returns the bearer token presented in a request's Authorization header, or an empty string if there is none.
+func Token(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// IsAdmin reports whether a request presents one of the configured admin tokens.
+func IsAdmin(r *http.Request, tokens []config.Secret) bool {
+	token := Token(r)
+	if token == "" {
+		return false
+	}
+
+	for _, t := range tokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.Value())) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,92 @@
 package config
 
 type Config struct {
-	ApiVersion string    `yaml:"apiVersion"`
-	Devices    []Devices `yaml:"devices"`
+	ApiVersion       string            `yaml:"apiVersion"`
+	AdminTokens      []Secret          `yaml:"adminTokens"`
+	Units            string            `yaml:"units"`
+	Locale           string            `yaml:"locale"`
+	Translations     map[string]string `yaml:"translations"`
+	StrictParameters *bool             `yaml:"strictParameters"`
+	AlwaysBaseRoute  bool              `yaml:"alwaysBaseRoute"`
+	RequestTimeout   uint              `yaml:"requestTimeoutMs"`
+	Diagnostics      bool              `yaml:"diagnostics"`
+	Cache            []Cache           `yaml:"cache"`
+	PanicAlert       PanicAlert        `yaml:"panicAlert"`
+	Egress           map[string]Egress `yaml:"egress"`
+	Proxy            string            `yaml:"proxy"`
+	CABundle         string            `yaml:"caBundle"`
+	DNS              DNS               `yaml:"dns"`
+	Storage          Storage           `yaml:"storage"`
+	SetupWorkers     int               `yaml:"setupWorkers"`
+	SetupTimeout     uint              `yaml:"setupTimeoutMs"`
+	Health           Health            `yaml:"health"`
+	Defaults         Defaults          `yaml:"defaults"`
+	Devices          []Devices         `yaml:"devices"`
+}
+
+type Cache struct {
+	Path          string `yaml:"path"`
+	MaxAgeSeconds uint   `yaml:"maxAgeSeconds"`
+	CacheControl  string `yaml:"cacheControl"`
+}
+
+type Egress struct {
+	Schemes []string `yaml:"schemes"`
+	CIDRs   []string `yaml:"cidrs"`
+}
+
+type DNS struct {
+	TTLSeconds uint              `yaml:"ttlSeconds"`
+	Hosts      map[string]string `yaml:"hosts"`
+}
+
+type Storage struct {
+	Path string `yaml:"path"`
+}
+
+type PanicAlert struct {
+	URL      string `yaml:"url"`
+	Token    Secret `yaml:"token"`
+	User     string `yaml:"user"`
+	Priority int    `yaml:"priority"`
+	Timeout  uint   `yaml:"timeoutMs"`
+}
+
+type Health struct {
+	IntervalSeconds uint        `yaml:"intervalSeconds"`
+	Alert           HealthAlert `yaml:"alert"`
+}
+
+type HealthAlert struct {
+	URL                 string `yaml:"url"`
+	Token               Secret `yaml:"token"`
+	User                string `yaml:"user"`
+	Priority            int    `yaml:"priority"`
+	Timeout             uint   `yaml:"timeoutMs"`
+	OfflineAfterSeconds uint   `yaml:"offlineAfterSeconds"`
+	FlapCount           int    `yaml:"flapCount"`
+	Summary             bool   `yaml:"summary"`
+	SummaryTime         string `yaml:"summaryTime"`
 }
 
 type Devices struct {
-	Type   string         `yaml:"type"`
-	Config map[string]any `yaml:"config"`
+	Type        string         `yaml:"type"`
+	Enabled     *bool          `yaml:"enabled"`
+	Confirm     []string       `yaml:"confirm"`
+	ReturnState bool           `yaml:"returnState"`
+	Path        string         `yaml:"path"`
+	Proxy       string         `yaml:"proxy"`
+	Class       string         `yaml:"class"`
+	DependsOn   []Dependency   `yaml:"dependsOn"`
+	Config      map[string]any `yaml:"config"`
+}
+
+// Dependency is a device that must be on before another device is written to, e.g. the smart plug powering an AV receiver.
+type Dependency struct {
+	Device string `yaml:"device"`
+	// Code and value that switch the dependency on, toggle with a value of 1 unless set
+	Code  string `yaml:"code"`
+	Value string `yaml:"value"`
+	// Time the dependent device takes to boot once the dependency is switched on
+	BootMs uint `yaml:"bootMs"`
 }
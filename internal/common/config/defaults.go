@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultTimeout is the timeoutMs of devices that omit it when defaults.defaultTimeoutMs is unset
+	DefaultTimeout = 5000
+	// MaxTimeout is the largest timeoutMs accepted, anything longer is more likely a typo than a device that slow
+	MaxTimeout = 300000
+	// MaxRetries is the largest number of retries accepted
+	MaxRetries = 5
+)
+
+// Defaults apply to every device that omits the equivalent field, and to every outbound HTTP client.
+type Defaults struct {
+	Timeout   uint   `yaml:"defaultTimeoutMs"`
+	Retries   int    `yaml:"retries"`
+	UserAgent string `yaml:"userAgent"`
+}
+
+// Validate rejects values that are obviously wrong, such as a timeout of several hours, filling in DefaultTimeout when unset.
+func (d *Defaults) Validate() error {
+	if d.Timeout == 0 {
+		d.Timeout = DefaultTimeout
+	}
+	if d.Timeout > MaxTimeout {
+		return fmt.Errorf("defaultTimeoutMs must be at most %d, got %d", MaxTimeout, d.Timeout)
+	}
+	if d.Retries < 0 || d.Retries > MaxRetries {
+		return fmt.Errorf("retries must be between 0 and %d, got %d", MaxRetries, d.Retries)
+	}
+	if strings.IndexFunc(d.UserAgent, unicode.IsControl) >= 0 {
+		return fmt.Errorf("userAgent must not contain control characters")
+	}
+	return nil
+}
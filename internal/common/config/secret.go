@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// Secret is a config value, such as a password, key or token, that is redacted when formatted or marshalled to JSON so that it cannot
+// leak into logs or responses. Secrets are also filtered out of logged messages once loaded. Value returns the secret itself.
+type Secret string
+
+// Value returns the unredacted secret, for use in requests to the service it belongs to.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns the redacted secret, empty secrets stay empty so that a missing value is still apparent.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return logging.Redacted
+}
+
+// GoString redacts the secret when formatted with %#v.
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+// MarshalJSON redacts the secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalYAML decodes the secret and adds it to the values filtered out of logs.
+func (s *Secret) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	*s = Secret(value)
+	logging.AddSecret(value)
+	return nil
+}
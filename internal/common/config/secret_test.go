@@ -0,0 +1,33 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecret(t *testing.T) {
+	device := struct {
+		Name  string `yaml:"name" json:"name"`
+		Token Secret `yaml:"token" json:"token"`
+		Empty Secret `yaml:"empty" json:"empty"`
+	}{}
+	assert.NoError(t, yaml.Unmarshal([]byte("name: lamp\ntoken: s3cr3t-token\n"), &device))
+
+	// The secret is only available through Value
+	assert.Equal(t, "s3cr3t-token", device.Token.Value())
+	assert.Equal(t, "REDACTED", device.Token.String())
+	assert.Equal(t, "REDACTED", fmt.Sprint(device.Token))
+	assert.Equal(t, `"REDACTED"`, fmt.Sprintf("%#v", device.Token))
+	assert.NotContains(t, fmt.Sprintf("%v %+v %#v", device, device, device), "s3cr3t-token")
+
+	jsonDevice, err := json.Marshal(device)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"lamp","token":"REDACTED","empty":""}`, string(jsonDevice))
+
+	// Missing secrets stay empty
+	assert.Equal(t, "", device.Empty.String())
+}
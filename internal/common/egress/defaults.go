@@ -0,0 +1,88 @@
+package egress
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Time waited before retrying a request, multiplied by the attempt
+const retryDelay = 200 * time.Millisecond
+
+// defaults holds the User-Agent sent by outbound HTTP clients that do not set their own, and the number of times a request is
+// retried when a connection could not be established.
+var defaults = struct {
+	sync.RWMutex
+	userAgent string
+	retries   int
+}{}
+
+// defaultTransport is the transport wrapped in place of http.DefaultTransport, kept so that outbound settings can still be applied to it
+var defaultTransport = http.DefaultTransport.(*http.Transport)
+
+// defaultRoundTripper applies the defaults to clients that use the default transport.
+type defaultRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t *defaultRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return withDefaults(t.next, req)
+}
+
+// SetDefaults sets the User-Agent of outbound requests that do not set their own and the number of times requests are retried when
+// a connection could not be established. Only failed connections are retried, a request that reached a device is never sent twice.
+func SetDefaults(userAgent string, retries int) {
+	defaults.Lock()
+	defaults.userAgent = userAgent
+	defaults.retries = retries
+	defaults.Unlock()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := http.DefaultTransport.(*defaultRoundTripper); !ok {
+		http.DefaultTransport = &defaultRoundTripper{next: http.DefaultTransport}
+	}
+}
+
+// withDefaults sends a request through next, setting the default User-Agent and retrying failed connections.
+func withDefaults(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	defaults.RLock()
+	userAgent, retries := defaults.userAgent, defaults.retries
+	defaults.RUnlock()
+
+	if userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := next.RoundTrip(req)
+		if err == nil || attempt > retries || !unreachable(err) || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, err
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		}
+
+		if req.Body != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// unreachable reports whether a request failed because no connection could be made, so that it was never sent. Connections blocked
+// by an egress policy are not retried.
+func unreachable(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial" && !errors.Is(err, ErrBlocked)
+}
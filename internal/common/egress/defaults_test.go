@@ -0,0 +1,146 @@
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// failing returns a round tripper that fails the first failures attempts with err, recording the body of every attempt.
+func failing(failures int, err error, bodies *[]string) roundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		body := ""
+		if req.Body != nil {
+			b, _ := io.ReadAll(req.Body)
+			body = string(b)
+		}
+		*bodies = append(*bodies, body)
+		if len(*bodies) <= failures {
+			return nil, err
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	agents := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+	}))
+	defer server.Close()
+
+	SetDefaults("restate-go/test", 0)
+	SetDefaults("restate-go/test", 1)
+	t.Cleanup(func() { SetDefaults("", 0) })
+
+	// The default transport is only wrapped once, however many times the defaults are set
+	wrapped, ok := http.DefaultTransport.(*defaultRoundTripper)
+	if !assert.True(t, ok) {
+		return
+	}
+	_, ok = wrapped.next.(*defaultRoundTripper)
+	assert.False(t, ok)
+
+	client := &http.Client{}
+	resp, err := client.Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	// Clients that set their own User-Agent keep it
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("User-Agent", "custom/1.0")
+	resp, err = client.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"restate-go/test", "custom/1.0"}, agents)
+}
+
+func TestRetries(t *testing.T) {
+	SetDefaults("", 2)
+	t.Cleanup(func() { SetDefaults("", 0) })
+
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	testCases := []struct {
+		name             string
+		failures         int
+		err              error
+		body             string
+		expectedError    bool
+		expectedAttempts int
+	}{
+		{
+			name:             "retried_until_connected",
+			failures:         2,
+			err:              dialErr,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "retries_exhausted",
+			failures:         3,
+			err:              dialErr,
+			expectedError:    true,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "body_resent",
+			failures:         1,
+			err:              dialErr,
+			body:             `{"code":"toggle"}`,
+			expectedAttempts: 2,
+		},
+		{
+			name:             "request_reached_device",
+			failures:         1,
+			err:              &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")},
+			expectedError:    true,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "blocked_by_policy",
+			failures:         1,
+			err:              &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("test connection to 192.0.2.1:80: %w", ErrBlocked)},
+			expectedError:    true,
+			expectedAttempts: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bodies := []string{}
+			var req *http.Request
+			if tc.body != "" {
+				req, _ = http.NewRequest("POST", "http://192.0.2.1", strings.NewReader(tc.body))
+			} else {
+				req, _ = http.NewRequest("GET", "http://192.0.2.1", nil)
+			}
+
+			resp, err := withDefaults(failing(tc.failures, tc.err, &bodies), req)
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+
+			assert.Len(t, bodies, tc.expectedAttempts)
+			for _, body := range bodies {
+				assert.Equal(t, tc.body, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Package egress configures outbound HTTP requests, sending them through proxies and restricting the addresses that modules posting to
+// configured URLs, such as alert forwarders, may send requests to.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+)
+
+// ErrBlocked is returned for requests a module's policy does not allow.
+var ErrBlocked = errors.New("blocked by egress policy")
+
+// maxRedirects matches the limit of the default http.Client
+const maxRedirects = 10
+
+// policy is the parsed egress config of a module, empty lists allow anything.
+type policy struct {
+	schemes  []string
+	networks []*net.IPNet
+}
+
+var (
+	mutex      sync.RWMutex
+	policies   = map[string]*policy{}
+	transports = map[string]*roundTripper{}
+)
+
+// SetPolicies replaces the egress policy of each module, modules without a policy may send requests anywhere.
+func SetPolicies(c map[string]config.Egress) error {
+	parsed := map[string]*policy{}
+	for module, e := range c {
+		p := &policy{}
+		for _, scheme := range e.Schemes {
+			p.schemes = append(p.schemes, strings.ToLower(scheme))
+		}
+		for _, cidr := range e.CIDRs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid cidr \"%s\" for module \"%s\": %w", cidr, module, err)
+			}
+			p.networks = append(p.networks, network)
+		}
+		parsed[module] = p
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	policies = parsed
+	// Pooled connections were checked against the previous policies
+	for _, t := range transports {
+		t.next.CloseIdleConnections()
+	}
+	return nil
+}
+
+func getPolicy(module string) *policy {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return policies[module]
+}
+
+// allowsScheme reports whether requests may use a scheme.
+func (p *policy) allowsScheme(scheme string) bool {
+	return p == nil || len(p.schemes) == 0 || slices.Contains(p.schemes, strings.ToLower(scheme))
+}
+
+// allowsAddress reports whether connections may be made to an ip:port address.
+func (p *policy) allowsAddress(address string) bool {
+	if p == nil || len(p.networks) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	return p.allowsIP(net.ParseIP(host))
+}
+
+// allowsIP reports whether connections may be made to an IP address.
+func (p *policy) allowsIP(ip net.IP) bool {
+	if p == nil || len(p.networks) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHost reports whether requests may be sent to a host, every address it resolves to must be allowed.
+func (p *policy) allowsHost(ctx context.Context, host string) (bool, error) {
+	if p == nil || len(p.networks) == 0 {
+		return true, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.allowsIP(ip), nil
+	}
+	addrs, err := resolve(ctx, host)
+	if err != nil {
+		return false, err
+	}
+	for _, addr := range addrs {
+		if !p.allowsIP(net.ParseIP(addr)) {
+			return false, nil
+		}
+	}
+	return len(addrs) > 0, nil
+}
+
+// roundTripper rejects requests with schemes the module's policy does not allow before they are sent, as well as requests sent through a
+// proxy to hosts outside of the policy.
+type roundTripper struct {
+	module string
+	next   *http.Transport
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := getPolicy(t.module)
+	if !p.allowsScheme(req.URL.Scheme) {
+		return nil, fmt.Errorf("%s request to %s: %w", t.module, req.URL.Redacted(), ErrBlocked)
+	}
+
+	// Requests sent through a proxy are dialled to the proxy, so the host it forwards them to is checked here instead
+	proxy, err := proxyFor(req)
+	if err != nil {
+		return nil, err
+	}
+	if proxy != nil {
+		allowed, err := p.allowsHost(req.Context(), req.URL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%s request to %s through %s: %w", t.module, req.URL.Redacted(), proxy.Redacted(), ErrBlocked)
+		}
+	}
+	return withDefaults(t.next, req)
+}
+
+// transport returns the shared transport of a module, so that its clients reuse connections. Addresses are checked once resolved,
+// so that a host name cannot be pointed at an address outside of the policy after it was checked.
+func transport(module string) http.RoundTripper {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if t, ok := transports[module]; ok {
+		return t
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			if !getPolicy(module).allowsAddress(address) {
+				return fmt.Errorf("%s connection to %s: %w", module, address, ErrBlocked)
+			}
+			return nil
+		},
+	}
+	next := defaultTransport.Clone()
+	next.DialContext = resolving(dialer)
+	configure(next)
+
+	t := &roundTripper{module: module, next: next}
+	transports[module] = t
+	return t
+}
+
+// sameHost only follows redirects to the host of the original request.
+func sameHost(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+		return fmt.Errorf("redirect to %s: %w", req.URL.Hostname(), ErrBlocked)
+	}
+	return nil
+}
+
+// Client returns a client for a module that is subject to its egress policy and does not follow redirects to other hosts.
+func Client(module string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport(module),
+		CheckRedirect: sameHost,
+	}
+}
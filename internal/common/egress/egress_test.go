@@ -0,0 +1,57 @@
+package egress
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyPolicy(t *testing.T) {
+	var mutex sync.Mutex
+	forwarded := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		forwarded = append(forwarded, r.URL.String())
+		mutex.Unlock()
+		w.Write([]byte("OK"))
+	}))
+	defer proxy.Close()
+
+	// The proxy is on loopback, inside the policy, so only the hosts it forwards to decide whether a request is sent
+	assert.NoError(t, SetPolicies(map[string]config.Egress{"test": {CIDRs: []string{"127.0.0.0/8"}}}))
+	assert.NoError(t, SetDNS(0, map[string]string{"internal.lan": "192.0.2.20"}))
+	for _, host := range []string{"192.0.2.10", "internal.lan", "127.0.0.2"} {
+		assert.NoError(t, SetHostProxy(host, proxy.URL))
+	}
+	t.Cleanup(func() {
+		SetPolicies(nil)
+		SetDNS(0, nil)
+		outbound.Lock()
+		outbound.hosts = map[string]*url.URL{}
+		outbound.Unlock()
+	})
+
+	client := Client("test", time.Second)
+	for _, target := range []string{"http://192.0.2.10/api", "http://internal.lan/api"} {
+		_, err := client.Get(target)
+		assert.True(t, errors.Is(err, ErrBlocked), target)
+	}
+
+	resp, err := client.Get("http://127.0.0.2/api")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"http://127.0.0.2/api"}, forwarded)
+}
@@ -0,0 +1,125 @@
+package egress
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Direct is a device proxy that bypasses the global proxy
+const Direct = "direct"
+
+// outbound holds the proxy and trusted certificates of every outbound HTTP client. Hosts map a device's host to its own proxy,
+// a nil proxy sends requests directly.
+var outbound = struct {
+	sync.RWMutex
+	proxy *url.URL
+	hosts map[string]*url.URL
+	tls   *tls.Config
+}{
+	hosts: map[string]*url.URL{},
+}
+
+// parseProxy parses a proxy URL, returning nil for Direct.
+func parseProxy(proxy string) (*url.URL, error) {
+	if proxy == Direct {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy \"%s\"", proxy)
+	}
+	return u, nil
+}
+
+// SetOutbound sets the proxy that outbound HTTP requests are sent through and a PEM bundle of CAs to trust in addition to the
+// system's. Requests use the proxy from the environment when proxy is empty. It applies to clients using the default transport too.
+func SetOutbound(proxy string, caBundle string) error {
+	var proxyURL *url.URL
+	if proxy != "" {
+		var err error
+		if proxyURL, err = parseProxy(proxy); err != nil {
+			return err
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in \"%s\"", caBundle)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+
+	outbound.Lock()
+	outbound.proxy = proxyURL
+	outbound.tls = tlsConfig
+	outbound.Unlock()
+
+	configure(defaultTransport)
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, t := range transports {
+		configure(t.next)
+	}
+	return nil
+}
+
+// SetHostProxy sends requests for a host, with or without its port, through a proxy rather than the global one, or directly for Direct.
+func SetHostProxy(host string, proxy string) error {
+	if host == "" {
+		return errors.New("no host to proxy")
+	}
+	proxyURL, err := parseProxy(proxy)
+	if err != nil {
+		return err
+	}
+
+	outbound.Lock()
+	defer outbound.Unlock()
+	outbound.hosts[strings.ToLower(host)] = proxyURL
+	return nil
+}
+
+// proxyFor returns the proxy for a request, preferring the proxy of its host, then the global proxy and then the environment's.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	outbound.RLock()
+	for _, host := range []string{req.URL.Host, req.URL.Hostname()} {
+		if proxy, ok := outbound.hosts[strings.ToLower(host)]; ok {
+			outbound.RUnlock()
+			return proxy, nil
+		}
+	}
+	proxy := outbound.proxy
+	outbound.RUnlock()
+
+	if proxy != nil {
+		return proxy, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// configure applies the outbound settings to a transport.
+func configure(t *http.Transport) {
+	outbound.RLock()
+	defer outbound.RUnlock()
+	t.Proxy = proxyFor
+	if outbound.tls != nil {
+		t.TLSClientConfig = outbound.tls.Clone()
+	}
+	t.CloseIdleConnections()
+}
@@ -0,0 +1,114 @@
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedHost is a resolved host and when it should be resolved again.
+type cachedHost struct {
+	addrs   []string
+	expires time.Time
+}
+
+// resolver caches the addresses of hosts for ttl, hosts map names to addresses that are used without resolving them at all.
+var resolver = struct {
+	sync.Mutex
+	ttl   time.Duration
+	hosts map[string]string
+	cache map[string]cachedHost
+}{
+	hosts: map[string]string{},
+	cache: map[string]cachedHost{},
+}
+
+// SetDNS caches resolved host names for ttl, or not at all when ttl is 0, and resolves the names in hosts to their address without a lookup,
+// e.g. so that devices with slow mDNS names always resolve to their reserved address. It applies to clients using the default transport too.
+func SetDNS(ttl time.Duration, hosts map[string]string) error {
+	overrides := map[string]string{}
+	for name, address := range hosts {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid address \"%s\" for host \"%s\"", address, name)
+		}
+		overrides[strings.ToLower(name)] = address
+	}
+
+	resolver.Lock()
+	resolver.ttl = ttl
+	resolver.hosts = overrides
+	resolver.cache = map[string]cachedHost{}
+	resolver.Unlock()
+
+	// The default transport may already be wrapped by SetDefaults, so the transport underneath it is dialed through the resolver
+	defaultTransport.DialContext = resolving(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	defaultTransport.CloseIdleConnections()
+	return nil
+}
+
+// resolve returns the addresses of a host, from its override or the cache where possible. A host that cannot be resolved again keeps
+// its cached addresses, so that a flaky name server does not take devices offline.
+func resolve(ctx context.Context, host string) ([]string, error) {
+	key := strings.ToLower(host)
+
+	resolver.Lock()
+	if address, ok := resolver.hosts[key]; ok {
+		resolver.Unlock()
+		return []string{address}, nil
+	}
+	ttl := resolver.ttl
+	cached, ok := resolver.cache[key]
+	resolver.Unlock()
+
+	if ttl == 0 {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+	if ok && time.Now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		if ok {
+			return cached.addrs, nil
+		}
+		return nil, err
+	}
+
+	resolver.Lock()
+	resolver.cache[key] = cachedHost{addrs: addrs, expires: time.Now().Add(ttl)}
+	resolver.Unlock()
+	return addrs, nil
+}
+
+// resolving returns a dial function that resolves host names with resolve before dialing each of their addresses in turn.
+func resolving(dialer *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		addrs, err := resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var conn net.Conn
+		for _, addr := range addrs {
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr, port)); err == nil {
+				return conn, nil
+			}
+		}
+		if err == nil {
+			err = fmt.Errorf("no addresses for host \"%s\"", host)
+		}
+		return nil, err
+	}
+}
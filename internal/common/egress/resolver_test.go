@@ -0,0 +1,55 @@
+package egress
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDNS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// main sets the defaults first, wrapping the default transport, so overrides must still reach the transport underneath it
+	SetDefaults("restate-go/test", 0)
+	t.Cleanup(func() { SetDefaults("", 0) })
+	assert.NoError(t, SetDNS(time.Minute, map[string]string{"Printer.Local": "127.0.0.1"}))
+	t.Cleanup(func() { SetDNS(0, nil) })
+
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get("http://printer.local:" + port)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "OK", string(body))
+
+	assert.Error(t, SetDNS(0, map[string]string{"printer.local": "not-an-address"}))
+}
+
+func TestResolve(t *testing.T) {
+	assert.NoError(t, SetDNS(time.Minute, map[string]string{"nas": "192.0.2.10"}))
+	t.Cleanup(func() { SetDNS(0, nil) })
+
+	addrs, err := resolve(context.Background(), "NAS")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.10"}, addrs)
+
+	// Cached addresses stand in until they expire
+	resolver.Lock()
+	resolver.cache["flaky.invalid"] = cachedHost{addrs: []string{"192.0.2.20"}, expires: time.Now().Add(time.Minute)}
+	resolver.Unlock()
+	addrs, err = resolve(context.Background(), "flaky.invalid")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.20"}, addrs)
+}
@@ -0,0 +1,86 @@
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// Built in message catalogs, keyed by the English message
+//
+//go:embed locales/*.yaml
+var locales embed.FS
+
+var (
+	mutex   sync.RWMutex
+	tag     = language.English
+	catalog = map[string]string{}
+)
+
+// SetLocale loads the built in catalog for a locale and layers translations over it, an empty locale keeps messages in English.
+// Translations may also name zones, cameras and objects so that they are humanized in the same language.
+func SetLocale(locale string, translations map[string]string) error {
+	messages := map[string]string{}
+	t := language.English
+
+	if locale != "" && locale != "en" {
+		var err error
+		if t, err = language.Parse(locale); err != nil {
+			return fmt.Errorf("invalid locale \"%s\"", locale)
+		}
+
+		base, _ := t.Base()
+		file, err := locales.ReadFile(fmt.Sprintf("locales/%s.yaml", base))
+		if err != nil && len(translations) == 0 {
+			return fmt.Errorf("no translations for locale \"%s\"", locale)
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(file, &messages); err != nil {
+				return err
+			}
+		}
+	}
+
+	for k, v := range translations {
+		messages[k] = v
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	tag = t
+	catalog = messages
+	return nil
+}
+
+// Lookup returns the translation of a message and whether one exists.
+func Lookup(message string) (string, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	translated, ok := catalog[message]
+	return translated, ok
+}
+
+// T translates a message, returning it unchanged if there is no translation.
+// Messages of the form "Invalid Parameter: code" are translated by their prefix, leaving the parameter as is.
+func T(message string) string {
+	if translated, ok := Lookup(message); ok {
+		return translated
+	}
+	if prefix, suffix, found := strings.Cut(message, ": "); found {
+		if translated, ok := Lookup(prefix); ok {
+			return translated + ": " + suffix
+		}
+	}
+	return message
+}
+
+// Tag returns the language of the current locale.
+func Tag() language.Tag {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return tag
+}
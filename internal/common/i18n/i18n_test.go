@@ -0,0 +1,59 @@
+package i18n
+
+import (
+	"testing"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLocale(t *testing.T) {
+	t.Cleanup(func() { SetLocale("", nil) })
+
+	// Regional locales use the catalog of their language, with configured translations layered over it
+	assert.NoError(t, SetLocale("de-AT", map[string]string{"Forbidden": "Kein Zugriff", "freezer": "Gefrierschrank"}))
+	assert.Equal(t, language.MustParse("de-AT"), Tag())
+	assert.Equal(t, "Methode nicht erlaubt", T("Method Not Allowed"))
+	assert.Equal(t, "Kein Zugriff", T("Forbidden"))
+	assert.Equal(t, "Gefrierschrank", T("freezer"))
+	assert.Equal(t, "Ungültiger Parameter: code", T("Invalid Parameter: code"))
+	assert.Equal(t, "Unknown message: code", T("Unknown message: code"))
+	_, ok := Lookup("Unknown message")
+	assert.False(t, ok)
+
+	// A locale without a catalog needs translations of its own, and a failed change keeps the current locale
+	assert.EqualError(t, SetLocale("ja", nil), `no translations for locale "ja"`)
+	assert.EqualError(t, SetLocale("not a locale", nil), `invalid locale "not a locale"`)
+	assert.Equal(t, "Kein Zugriff", T("Forbidden"))
+	assert.NoError(t, SetLocale("ja", map[string]string{"OK": "了解"}))
+	assert.Equal(t, "了解", T("OK"))
+	assert.Equal(t, "Forbidden", T("Forbidden"))
+
+	assert.NoError(t, SetLocale("", nil))
+	assert.Equal(t, language.English, Tag())
+	assert.Equal(t, "Method Not Allowed", T("Method Not Allowed"))
+}
+
+func TestLocales(t *testing.T) {
+	entries, err := locales.ReadDir("locales")
+	assert.NoError(t, err)
+
+	// Every catalog translates the same messages, so that none is left in English after one is added
+	var expected map[string]string
+	for _, e := range entries {
+		file, err := locales.ReadFile("locales/" + e.Name())
+		assert.NoError(t, err)
+		messages := map[string]string{}
+		assert.NoError(t, yaml.Unmarshal(file, &messages), e.Name())
+		if expected == nil {
+			expected = messages
+			continue
+		}
+		for k := range expected {
+			assert.Contains(t, messages, k, e.Name())
+		}
+		assert.Len(t, messages, len(expected), e.Name())
+	}
+}
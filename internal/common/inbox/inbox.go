@@ -0,0 +1,134 @@
+// Package inbox keeps the recent alerts sent by devices and listeners along with whether each has been read, so that they can be
+// reviewed after a push notification was missed. Alerts are persisted with the storage package when it is enabled.
+package inbox
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+)
+
+// maxEntries is the number of alerts kept, older alerts are dropped as new ones arrive
+const maxEntries = 200
+
+const storageKey = "inbox"
+
+// Entry is a single alert.
+type Entry struct {
+	ID       uint64    `json:"id"`
+	Source   string    `json:"source"`
+	Title    string    `json:"title,omitempty"`
+	Message  string    `json:"message"`
+	Priority int       `json:"priority"`
+	Time     time.Time `json:"time"`
+	Read     bool      `json:"read"`
+}
+
+// Filter selects the alerts returned by List, unset fields match every alert.
+type Filter struct {
+	// Source of the alerts, either exactly or by its type, e.g. "sensor" matches "sensor/freezer"
+	Source      string
+	Unread      bool
+	Since       time.Time
+	MinPriority *int
+	Limit       int
+}
+
+var (
+	mutex   sync.Mutex
+	loaded  bool
+	entries []Entry
+)
+
+// load reads persisted alerts the first time they are needed, after storage has been set up. The mutex must be held.
+func load() {
+	if loaded {
+		return
+	}
+	loaded = true
+	storage.Load(storageKey, &entries)
+}
+
+// save persists the alerts. The mutex must be held.
+func save() {
+	if err := storage.Save(storageKey, entries); err != nil {
+		logging.Log(logging.Error, "Unable to save alerts: %v", err)
+	}
+}
+
+// Record adds an alert sent by a source, named by its type and name, e.g. "sensor/freezer".
+func Record(source string, title string, message string, priority int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	load()
+
+	id := uint64(1)
+	if len(entries) > 0 {
+		id = entries[len(entries)-1].ID + 1
+	}
+	entries = append(entries, Entry{
+		ID:       id,
+		Source:   source,
+		Title:    title,
+		Message:  message,
+		Priority: priority,
+		Time:     time.Now().UTC().Truncate(time.Second),
+	})
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	save()
+}
+
+// matches reports whether an entry is selected by the filter.
+func (f *Filter) matches(e *Entry) bool {
+	if f.Source != "" && e.Source != f.Source && !strings.HasPrefix(e.Source, f.Source+"/") {
+		return false
+	}
+	if f.Unread && e.Read {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return f.MinPriority == nil || e.Priority >= *f.MinPriority
+}
+
+// List returns the alerts selected by a filter, newest first, along with the number of unread alerts in total.
+func List(f Filter) ([]Entry, int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	load()
+
+	selected := []Entry{}
+	unread := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Read {
+			unread++
+		}
+		if f.matches(&entries[i]) && (f.Limit <= 0 || len(selected) < f.Limit) {
+			selected = append(selected, entries[i])
+		}
+	}
+	return selected, unread
+}
+
+// MarkRead marks the alert with an id as read or unread, or every alert when id is 0, reporting whether the alert was found.
+func MarkRead(id uint64, read bool) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	load()
+
+	found := id == 0
+	for i := range entries {
+		if id == 0 || entries[i].ID == id {
+			entries[i].Read = read
+			found = true
+		}
+	}
+	save()
+	return found
+}
@@ -0,0 +1,97 @@
+package inbox
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reset forgets the alerts held in memory, as a restart would.
+func reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	loaded = false
+	entries = nil
+}
+
+func TestInbox(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	path := filepath.Join(t.TempDir(), "state.json")
+	assert.NoError(t, storage.SetPath(path))
+	reset()
+	t.Cleanup(func() {
+		storage.SetPath("")
+		reset()
+	})
+
+	Record("sensor/freezer", "Sensor alert", "Freezer above -10", 1)
+	Record("sensor/fridge", "Sensor alert", "Fridge above 8", 0)
+	Record("frigate/driveway", "Person", "Person detected", 2)
+
+	sources := func(selected []Entry) []string {
+		s := []string{}
+		for _, e := range selected {
+			s = append(s, e.Source)
+		}
+		return s
+	}
+
+	// Alerts are listed newest first, matching a source by its type or exactly
+	selected, unread := List(Filter{})
+	assert.Equal(t, []string{"frigate/driveway", "sensor/fridge", "sensor/freezer"}, sources(selected))
+	assert.Equal(t, 3, unread)
+	assert.Equal(t, uint64(3), selected[0].ID)
+
+	selected, _ = List(Filter{Source: "sensor"})
+	assert.Equal(t, []string{"sensor/fridge", "sensor/freezer"}, sources(selected))
+	selected, _ = List(Filter{Source: "sensor/freezer"})
+	assert.Equal(t, []string{"sensor/freezer"}, sources(selected))
+	selected, _ = List(Filter{Source: "sens"})
+	assert.Empty(t, selected)
+
+	minPriority := 1
+	selected, _ = List(Filter{MinPriority: &minPriority, Limit: 1})
+	assert.Equal(t, []string{"frigate/driveway"}, sources(selected))
+	selected, _ = List(Filter{Since: time.Now().Add(time.Hour)})
+	assert.Empty(t, selected)
+
+	// Reading an alert leaves it listed but not unread
+	assert.True(t, MarkRead(2, true))
+	assert.False(t, MarkRead(42, true))
+	selected, unread = List(Filter{Unread: true})
+	assert.Equal(t, []string{"frigate/driveway", "sensor/freezer"}, sources(selected))
+	assert.Equal(t, 2, unread)
+
+	// Alerts and whether they were read survive a restart
+	reset()
+	assert.NoError(t, storage.SetPath(path))
+	selected, unread = List(Filter{})
+	assert.Len(t, selected, 3)
+	assert.Equal(t, 2, unread)
+	assert.True(t, selected[1].Read)
+
+	assert.True(t, MarkRead(0, true))
+	_, unread = List(Filter{})
+	assert.Equal(t, 0, unread)
+}
+
+func TestInboxLimit(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	reset()
+	t.Cleanup(reset)
+
+	// Only the newest alerts are kept, and ids keep counting from the newest
+	for i := 0; i < maxEntries+5; i++ {
+		Record("panic", "", "Recovered from a panic", 0)
+	}
+	selected, unread := List(Filter{})
+	assert.Len(t, selected, maxEntries)
+	assert.Equal(t, maxEntries, unread)
+	assert.Equal(t, uint64(maxEntries+5), selected[0].ID)
+	assert.Equal(t, uint64(6), selected[len(selected)-1].ID)
+}
@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,6 +24,58 @@ var (
 	currentLevel = Info
 )
 
+// Redacted replaces secrets in logged messages
+const Redacted = "REDACTED"
+
+// Secrets shorter than this are not filtered, as they would redact unrelated text
+const minSecretLength = 4
+
+// Values replaced in every logged message
+var secrets = struct {
+	sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}{
+	values:   map[string]bool{},
+	replacer: strings.NewReplacer(),
+}
+
+// AddSecret filters a value, such as a password or token, out of every message logged from now on.
+func AddSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+
+	secrets.Lock()
+	defer secrets.Unlock()
+	if secrets.values[value] {
+		return
+	}
+	secrets.values[value] = true
+
+	// Longer secrets are replaced first, so that a secret containing another is not partially replaced
+	values := make([]string, 0, len(secrets.values))
+	for v := range secrets.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i int, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	pairs := make([]string, 0, len(values)*2)
+	for _, v := range values {
+		pairs = append(pairs, v, Redacted)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// filter returns a message with every secret replaced.
+func filter(message string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	return secrets.replacer.Replace(message)
+}
+
 // SetLogLevel sets the current log level.
 func SetLogLevel(level string) {
 	currentLevel = level
@@ -41,7 +95,7 @@ func _log(level string, message string, args ...any) {
 			message = fmt.Sprintf(message, args...)
 			message = fmt.Sprintf("[%s][%s:%d][%s]\t%s", timestamp, filename, line, level, message)
 		}
-		logger.Println(message)
+		logger.Println(filter(message))
 	}
 
 }
@@ -65,6 +119,11 @@ func (r *StatusRecorder) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap returns the underlying ResponseWriter, allowing streamed responses to be flushed through the recorder.
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func RequestLogger(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		recorder := &StatusRecorder{
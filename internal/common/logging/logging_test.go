@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	AddSecret("abc")
+	AddSecret("hunter2")
+	AddSecret("hunter2-extended")
+	AddSecret("hunter2")
+
+	// Short secrets are not filtered and longer secrets are replaced before those they contain
+	assert.Equal(t, "abc REDACTED REDACTED", filter("abc hunter2 hunter2-extended"))
+
+	var buffer bytes.Buffer
+	logger.SetOutput(&buffer)
+	t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+	SetLogLevel(Info)
+
+	Log(Info, "Connecting with password %s", "hunter2")
+	assert.Contains(t, buffer.String(), "[INFO]\tConnecting with password REDACTED\n")
+	assert.NotContains(t, buffer.String(), "hunter2")
+}
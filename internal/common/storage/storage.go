@@ -0,0 +1,97 @@
+// Package storage persists small pieces of state, such as the last known status of devices, across restarts in a single JSON file.
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	mutex  sync.Mutex
+	path   string
+	values = map[string]json.RawMessage{}
+)
+
+// SetPath sets the file state is persisted to and loads any state already in it, persistence is disabled when path is empty.
+func SetPath(p string) error {
+	loaded := map[string]json.RawMessage{}
+	if p != "" {
+		b, err := os.ReadFile(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &loaded); err != nil {
+				return fmt.Errorf("invalid state in \"%s\": %w", p, err)
+			}
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	path = p
+	values = loaded
+	return nil
+}
+
+// Enabled reports whether state is persisted, allowing callers to skip preparing values that would not be saved.
+func Enabled() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return path != ""
+}
+
+// Load decodes the value stored under key into v, reporting whether one was found.
+func Load(key string, v any) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	value, ok := values[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(value, v) == nil
+}
+
+// Save stores v under key, the file is only written when the stored value changes.
+func Save(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if path == "" || bytes.Equal(values[key], value) {
+		return nil
+	}
+	values[key] = value
+	return write()
+}
+
+// write replaces the file with the current state, writing to a temporary file first so that a crash cannot leave it truncated.
+func write() error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(b); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
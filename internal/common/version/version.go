@@ -0,0 +1,52 @@
+// Package version describes the running build, values are set when building with e.g.
+// -ldflags "-X github.com/kennedn/restate-go/internal/common/version.Version=v1.2.3 -X github.com/kennedn/restate-go/internal/common/version.Commit=$(git rev-parse HEAD)".
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// Version of the build, dev when built without ldflags
+	Version = "dev"
+	// Commit the build was made from, read from the module's VCS stamp when not set
+	Commit = ""
+	// BuildDate in RFC 3339, the commit time from the VCS stamp when not set
+	BuildDate = ""
+)
+
+// SchemaVersion is the version of the config format, incremented when existing configs need changing to keep working
+const SchemaVersion = 1
+
+// Info describes the running build.
+type Info struct {
+	Version       string `json:"version"`
+	Commit        string `json:"commit,omitempty"`
+	BuildDate     string `json:"buildDate,omitempty"`
+	GoVersion     string `json:"goVersion"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// Get returns the build info, filling in the commit and build date from the VCS stamp of binaries built without ldflags.
+func Get() Info {
+	info := Info{
+		Version:       Version,
+		Commit:        Commit,
+		BuildDate:     BuildDate,
+		GoVersion:     runtime.Version(),
+		SchemaVersion: SchemaVersion,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,465 @@
+// Package activity provides Harmony style activities for AV devices, tracking the current activity and sending only the power and input
+// changes needed to switch to another.
+package activity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the activity with every device off
+const powerOff = "off"
+
+// request allows activity names as values
+type request struct {
+	Code  string `json:"code"`
+	Value string `json:"value,omitempty"`
+}
+
+// member is an AV device taking part in activities, with the actions that power it and select its inputs.
+type member struct {
+	Name         string                   `yaml:"name"`
+	On           *device.Action           `yaml:"on"`
+	Off          *device.Action           `yaml:"off"`
+	Inputs       map[string]device.Action `yaml:"inputs"`
+	InputDelayMs uint                     `yaml:"inputDelayMs"`
+}
+
+// plan is an activity, mapping the devices it uses to the input each should be on. Devices without inputs map to an empty input.
+type plan struct {
+	Name    string            `yaml:"name"`
+	Devices map[string]string `yaml:"devices"`
+}
+
+// state is the tracked activity and the input of each device that is on, persisted across restarts.
+type state struct {
+	Activity string            `json:"activity"`
+	Devices  map[string]string `json:"devices"`
+}
+
+// step is an action sent while switching activity.
+type step struct {
+	Device string `json:"device"`
+	Action string `json:"action"`
+	Input  string `json:"input,omitempty"`
+}
+
+// activity represents an activity configuration with name, the devices taking part and the activities they are used in.
+type activity struct {
+	Name       string    `yaml:"name"`
+	Timeout    uint      `yaml:"timeoutMs"`
+	Devices    []*member `yaml:"devices"`
+	Activities []*plan   `yaml:"activities"`
+	Base       base
+	state      state
+	mutex      sync.Mutex
+	sleep      func(time.Duration)
+}
+
+// base represents a list of activity controllers
+type base struct {
+	Devices []*activity
+}
+
+type Device struct{}
+
+// DryRun lists the steps starting an activity would send, the tracked activity is left as it was.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for activity controllers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts activity devices from config, skipping any whose steps are invalid, and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "activity" {
+			continue
+		}
+		activity := activity{
+			Base:  base,
+			sleep: time.Sleep,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &activity); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if activity.Name == "" || activity.Timeout == 0 || len(activity.Devices) == 0 || len(activity.Activities) == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if err := activity.validate(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", activity.Name, err)
+			continue
+		}
+
+		activity.restore()
+
+		routes = append(routes, router.Route{
+			Path:    "/" + activity.Name,
+			Handler: activity.handler,
+		})
+
+		base.Devices = append(base.Devices, &activity)
+
+		logging.Log(logging.Info, "Found device \"%s\"", activity.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/activity" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/activity",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/activity/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// validate checks that devices have power actions and that activities only use known devices and inputs.
+func (a *activity) validate() error {
+	names := []string{}
+	for _, m := range a.Devices {
+		if m.Name == "" || m.On == nil || m.Off == nil || m.On.URL == "" || m.Off.URL == "" {
+			return errors.New("devices require a name and on and off actions")
+		}
+		if slices.Contains(names, m.Name) {
+			return fmt.Errorf("device \"%s\" is configured more than once", m.Name)
+		}
+		names = append(names, m.Name)
+	}
+
+	activities := []string{}
+	for _, p := range a.Activities {
+		if p.Name == "" || p.Name == powerOff || len(p.Devices) == 0 {
+			return fmt.Errorf("activities require a name other than \"%s\" and at least one device", powerOff)
+		}
+		if slices.Contains(activities, p.Name) {
+			return fmt.Errorf("activity \"%s\" is configured more than once", p.Name)
+		}
+		activities = append(activities, p.Name)
+
+		for name, input := range p.Devices {
+			m := a.member(name)
+			if m == nil {
+				return fmt.Errorf("activity \"%s\" uses unknown device \"%s\"", p.Name, name)
+			}
+			if _, ok := m.Inputs[input]; input != "" && !ok {
+				return fmt.Errorf("activity \"%s\" uses unknown input \"%s\" of device \"%s\"", p.Name, input, name)
+			}
+		}
+	}
+	return nil
+}
+
+// member returns the device with a name, or nil if there is none.
+func (a *activity) member(name string) *member {
+	i := slices.IndexFunc(a.Devices, func(m *member) bool { return m.Name == name })
+	if i == -1 {
+		return nil
+	}
+	return a.Devices[i]
+}
+
+// plan returns the activity with a name, or nil if there is none.
+func (a *activity) plan(name string) *plan {
+	if name == powerOff {
+		return &plan{Name: powerOff, Devices: map[string]string{}}
+	}
+	i := slices.IndexFunc(a.Activities, func(p *plan) bool { return p.Name == name })
+	if i == -1 {
+		return nil
+	}
+	return a.Activities[i]
+}
+
+// restore loads the tracked state saved before a restart, ignoring devices and activities that are no longer configured.
+func (a *activity) restore() {
+	a.state = state{Activity: powerOff, Devices: map[string]string{}}
+
+	saved := state{}
+	if !storage.Load("activity/"+a.Name, &saved) {
+		return
+	}
+	if a.plan(saved.Activity) != nil {
+		a.state.Activity = saved.Activity
+	}
+	for name, input := range saved.Devices {
+		if a.member(name) != nil {
+			a.state.Devices[name] = input
+		}
+	}
+}
+
+// save persists the tracked state.
+func (a *activity) save() {
+	if err := storage.Save("activity/"+a.Name, a.state); err != nil {
+		logging.Log(logging.Error, "Unable to save state of \"%s\": %v", a.Name, err)
+	}
+}
+
+// delta returns the steps needed to switch from the tracked state to an activity, in the order of the configured devices.
+// Devices are powered on before inputs are selected, and devices no longer needed are powered off last.
+func (a *activity) delta(p *plan) []step {
+	on := []step{}
+	inputs := []step{}
+	off := []step{}
+
+	for _, m := range a.Devices {
+		current, isOn := a.state.Devices[m.Name]
+		target, needed := p.Devices[m.Name]
+
+		switch {
+		case needed && !isOn:
+			on = append(on, step{Device: m.Name, Action: "on"})
+			if target != "" {
+				inputs = append(inputs, step{Device: m.Name, Action: "input", Input: target})
+			}
+		case needed && target != "" && target != current:
+			inputs = append(inputs, step{Device: m.Name, Action: "input", Input: target})
+		case !needed && isOn:
+			off = append(off, step{Device: m.Name, Action: "off"})
+		}
+	}
+
+	return append(append(on, inputs...), off...)
+}
+
+// send sends the action of a step, updating the tracked state of its device when it succeeds outside of a dry run.
+func (a *activity) send(ctx context.Context, s step) error {
+	m := a.member(s.Device)
+
+	var action device.Action
+	switch s.Action {
+	case "on":
+		action = *m.On
+	case "off":
+		action = *m.Off
+	case "input":
+		action = m.Inputs[s.Input]
+	}
+
+	response, httpCode, err := action.PostContext(ctx, a.Timeout)
+	if err == nil && httpCode != http.StatusOK {
+		err = fmt.Errorf("received status code %d from %s", httpCode, action.URL)
+		if response != nil && response.Message != "" {
+			err = fmt.Errorf("%w: %s", err, response.Message)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("activity \"%s\" failed to turn %s \"%s\": %w", a.Name, s.Action, s.Device, err)
+	}
+	if device.DryRunning(ctx) {
+		return nil
+	}
+
+	switch s.Action {
+	case "on":
+		a.state.Devices[s.Device] = ""
+	case "off":
+		delete(a.state.Devices, s.Device)
+	case "input":
+		a.state.Devices[s.Device] = s.Input
+	}
+	return nil
+}
+
+// start switches to an activity, carrying on past devices that fail so that as much of the activity as possible is set up.
+// A dry run records the steps without waiting for inputs or tracking the new activity.
+func (a *activity) start(ctx context.Context, p *plan) ([]step, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	steps := a.delta(p)
+
+	// Devices that were just powered on may ignore inputs until they have finished starting
+	delay := time.Duration(0)
+	for _, s := range steps {
+		if s.Action == "on" {
+			delay = max(delay, time.Duration(a.member(s.Device).InputDelayMs)*time.Millisecond)
+		}
+	}
+
+	var errs []error
+	for _, s := range steps {
+		if s.Action == "input" && delay > 0 && !device.DryRunning(ctx) {
+			a.sleep(delay)
+			delay = 0
+		}
+
+		if err := a.send(ctx, s); err != nil {
+			logging.Log(logging.Error, err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	if device.DryRunning(ctx) {
+		return steps, errors.Join(errs...)
+	}
+
+	a.state.Activity = p.Name
+	a.save()
+	logging.Log(logging.Info, "Activity \"%s\" switched to \"%s\"", a.Name, p.Name)
+	return steps, errors.Join(errs...)
+}
+
+// reset sets the tracked state to an activity without sending anything, for when devices have been changed by their own remotes.
+func (a *activity) reset(p *plan) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.state = state{Activity: p.Name, Devices: map[string]string{}}
+	for name, input := range p.Devices {
+		a.state.Devices[name] = input
+	}
+	a.save()
+}
+
+// status returns the tracked activity and the input of each device that is on.
+func (a *activity) status() state {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	status := state{Activity: a.state.Activity, Devices: map[string]string{}}
+	for name, input := range a.state.Devices {
+		status.Devices[name] = input
+	}
+	return status
+}
+
+// getCodes returns a list of control codes for an activity controller.
+func getCodes() []string {
+	return []string{"status", "activities", "start", "off", "reset"}
+}
+
+// Handler is the HTTP handler for activity control.
+func (a *activity) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "status":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", a.status())
+		return
+	case "activities":
+		names := []string{}
+		for _, p := range a.Activities {
+			names = append(names, p.Name)
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", names)
+		return
+	case "off":
+		request.Value = powerOff
+	case "start", "reset":
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	p := a.plan(request.Value)
+	if p == nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+		return
+	}
+
+	if request.Code == "reset" {
+		if !device.DryRunning(r.Context()) {
+			a.reset(p)
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+		return
+	}
+
+	steps, err := a.start(r.Context(), p)
+	if err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", steps)
+}
+
+// getDeviceNames returns the names of all activity controllers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured activity controllers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,384 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read activity input")
+	}
+
+	activityConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &activityConfig); err != nil {
+		t.Fatalf("Could not read activity input")
+	}
+	return &activityConfig
+}
+
+// setupDeviceServer emulates the restate endpoints of AV devices, recording the requests sent to them. Requests to the avr fail when failAVR is set.
+func setupDeviceServer(t *testing.T, requests *[]string, failAVR *bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		request := r.URL.Path + " " + body["code"]
+		if body["value"] != "" {
+			request += "=" + body["value"]
+		}
+		*requests = append(*requests, request)
+
+		w.Header().Set("Content-Type", "application/json")
+		if *failAVR && strings.HasPrefix(r.URL.Path, "/v2/avr") {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			w.Write([]byte(`{"version":1,"message":"Gateway Timeout"}`))
+			return
+		}
+		w.Write([]byte(`{"version":1,"message":"OK"}`))
+	}))
+}
+
+// pointAt moves the actions of activity controllers from the placeholder host in testdata to a server.
+func pointAt(b *base, url string) {
+	for _, a := range b.Devices {
+		for _, m := range a.Devices {
+			m.On.URL = strings.Replace(m.On.URL, "http://restate.test", url, 1)
+			m.Off.URL = strings.Replace(m.Off.URL, "http://restate.test", url, 1)
+			for name, input := range m.Inputs {
+				input.URL = strings.Replace(input.URL, "http://restate.test", url, 1)
+				m.Inputs[name] = input
+			}
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/activityConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/activityConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/activityConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/activityConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/activityConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		data             string
+		failAVR          bool
+		expectedCode     int
+		expectedBody     string
+		expectedRequests []string
+		expectedSleeps   []time.Duration
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/activity/lounge",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","activities","start","off","reset"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/activity/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lounge","bedroom"]}`,
+		},
+		{
+			name:         "activities",
+			method:       "POST",
+			url:          "/activity/lounge?code=activities",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["watch_tv","play_game","listen_to_music"]}`,
+		},
+		{
+			name:         "initial_status",
+			method:       "POST",
+			url:          "/activity/lounge?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"activity":"off","devices":{}}}`,
+		},
+		{
+			name:             "start_from_off",
+			method:           "POST",
+			url:              "/activity/lounge",
+			data:             `{"code":"start","value":"watch_tv"}`,
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK","data":[{"device":"tv","action":"on"},{"device":"avr","action":"on"},{"device":"tv","action":"input","input":"hdmi1"},{"device":"avr","action":"input","input":"tv"}]}`,
+			expectedRequests: []string{"/v2/tvcom/lounge/power on", "/v2/avr/power on", "/v2/tvcom/lounge/input_select hdmi1", "/v2/avr/input select=tv"},
+			expectedSleeps:   []time.Duration{3 * time.Second},
+		},
+		{
+			name:             "start_current_activity",
+			method:           "POST",
+			url:              "/activity/lounge?code=start&value=watch_tv",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK","data":[]}`,
+			expectedRequests: []string{},
+			expectedSleeps:   []time.Duration{},
+		},
+		{
+			name:             "switch_activity",
+			method:           "POST",
+			url:              "/activity/lounge?code=start&value=play_game",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK","data":[{"device":"console","action":"on"},{"device":"tv","action":"input","input":"hdmi2"},{"device":"avr","action":"input","input":"game"}]}`,
+			expectedRequests: []string{"/v2/wol/console on", "/v2/tvcom/lounge/input_select hdmi2", "/v2/avr/input select=game"},
+			expectedSleeps:   []time.Duration{},
+		},
+		{
+			name:             "switch_to_fewer_devices",
+			method:           "POST",
+			url:              "/activity/lounge?code=start&value=listen_to_music",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK","data":[{"device":"avr","action":"input","input":"music"},{"device":"tv","action":"off"},{"device":"console","action":"off"}]}`,
+			expectedRequests: []string{"/v2/avr/input select=cast", "/v2/tvcom/lounge/power off", "/v2/wol/console off"},
+		},
+		{
+			name:         "status",
+			method:       "POST",
+			url:          "/activity/lounge?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"activity":"listen_to_music","devices":{"avr":"music"}}}`,
+		},
+		{
+			name:             "failing_device",
+			method:           "POST",
+			url:              "/activity/lounge?code=start&value=watch_tv",
+			failAVR:          true,
+			expectedCode:     500,
+			expectedBody:     `{"version":1,"message":"Internal Server Error"}`,
+			expectedRequests: []string{"/v2/tvcom/lounge/power on", "/v2/tvcom/lounge/input_select hdmi1", "/v2/avr/input select=tv"},
+		},
+		{
+			name:         "status_after_failing_device",
+			method:       "POST",
+			url:          "/activity/lounge?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"activity":"watch_tv","devices":{"avr":"music","tv":"hdmi1"}}}`,
+		},
+		{
+			name:             "retry_after_failing_device",
+			method:           "POST",
+			url:              "/activity/lounge?code=start&value=watch_tv",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK","data":[{"device":"avr","action":"input","input":"tv"}]}`,
+			expectedRequests: []string{"/v2/avr/input select=tv"},
+		},
+		{
+			name:             "off",
+			method:           "POST",
+			url:              "/activity/lounge?code=off",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK","data":[{"device":"tv","action":"off"},{"device":"avr","action":"off"}]}`,
+			expectedRequests: []string{"/v2/tvcom/lounge/power off", "/v2/avr/power off"},
+		},
+		{
+			name:             "reset",
+			method:           "POST",
+			url:              "/activity/lounge?code=reset&value=play_game",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{},
+		},
+		{
+			name:         "status_after_reset",
+			method:       "POST",
+			url:          "/activity/lounge?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"activity":"play_game","devices":{"avr":"game","console":"","tv":"hdmi2"}}}`,
+		},
+		{
+			name:         "unknown_activity",
+			method:       "POST",
+			url:          "/activity/lounge?code=start&value=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "start_without_value",
+			method:       "POST",
+			url:          "/activity/lounge?code=start",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/activity/lounge?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/activity/lounge",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/activity/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	requests := []string{}
+	failAVR := false
+	server := setupDeviceServer(t, &requests, &failAVR)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/activityConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	pointAt(base, server.URL)
+
+	sleeps := []time.Duration{}
+	for _, a := range base.Devices {
+		a.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = requests[:0]
+			sleeps = sleeps[:0]
+			failAVR = tc.failAVR
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedRequests != nil {
+				assert.Equal(t, tc.expectedRequests, requests)
+			}
+
+			if tc.expectedSleeps != nil {
+				assert.Equal(t, tc.expectedSleeps, sleeps)
+			}
+		})
+	}
+
+	t.Run("dry_run_start", func(t *testing.T) {
+		requests = requests[:0]
+		sleeps = sleeps[:0]
+		lounge := base.Devices[0]
+		before := lounge.status()
+		ctx, dryRun := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/activity/lounge?code=start&value=watch_tv", nil).WithContext(ctx))
+
+		// The steps are only recorded, without waiting for inputs or tracking the activity
+		assert.Equal(t, 200, recorder.Code)
+		assert.Empty(t, requests)
+		assert.Empty(t, sleeps)
+		assert.NotEmpty(t, dryRun.Calls())
+		assert.Equal(t, before, lounge.status())
+	})
+}
+
+func TestRestore(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	if err := storage.SetPath(filepath.Join(t.TempDir(), "state.json")); err != nil {
+		t.Fatalf("Could not set storage path: %v", err)
+	}
+	defer storage.SetPath("")
+
+	base, _, err := routes(loadConfig(t, "testdata/activityConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	base.Devices[0].reset(base.Devices[0].plan("play_game"))
+
+	base, _, err = routes(loadConfig(t, "testdata/activityConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	assert.Equal(t, state{Activity: "play_game", Devices: map[string]string{"tv": "hdmi2", "avr": "game", "console": ""}}, base.Devices[0].status())
+	assert.Equal(t, state{Activity: "off", Devices: map[string]string{}}, base.Devices[1].status())
+}
@@ -0,0 +1,227 @@
+// Package adblock provides control of Pi-hole and AdGuard Home DNS ad blockers, pausing blocking for a number of minutes.
+package adblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driver is implemented by each supported ad blocker.
+type driver interface {
+	setBlocking(ctx context.Context, enabled bool, minutes int64) error
+	status(ctx context.Context) (*status, error)
+}
+
+// status is the representation of an ad blocker returned by the status code.
+type status struct {
+	Blocking        bool    `json:"blocking"`
+	DisabledSeconds *int64  `json:"disabledSeconds,omitempty"`
+	Queries         int64   `json:"queries"`
+	Blocked         int64   `json:"blocked"`
+	PercentBlocked  float64 `json:"percentBlocked"`
+}
+
+// adblock represents an ad blocker configuration with name, driver and driver specific parameters.
+type adblock struct {
+	Name    string   `yaml:"name"`
+	Timeout uint     `yaml:"timeoutMs"`
+	Driver  string   `yaml:"driver"`
+	Pihole  *pihole  `yaml:"pihole"`
+	AdGuard *adguard `yaml:"adguard"`
+	Base    base
+	driver  driver
+}
+
+// base represents a list of ad blockers
+type base struct {
+	Devices []*adblock
+}
+
+type Device struct{}
+
+// DryRun previews blocking changes, status is still read from the ad blocker.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for ad blockers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Pi-hole and AdGuard Home blockers from config and returns a route for each along with the /adblock base routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "adblock" {
+			continue
+		}
+		adblock := adblock{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &adblock); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if adblock.Name == "" || adblock.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch adblock.Driver {
+		case "pihole":
+			if adblock.Pihole == nil || adblock.Pihole.URL == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			adblock.Pihole.timeout = adblock.Timeout
+			adblock.driver = adblock.Pihole
+		case "adguard":
+			if adblock.AdGuard == nil || adblock.AdGuard.URL == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			adblock.AdGuard.timeout = adblock.Timeout
+			adblock.driver = adblock.AdGuard
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'pihole' or 'adguard'")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + adblock.Name,
+			Handler: adblock.handler,
+		})
+
+		base.Devices = append(base.Devices, &adblock)
+
+		logging.Log(logging.Info, "Found device \"%s\"", adblock.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/adblock" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/adblock",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/adblock/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// getCodes returns a list of control codes for an ad blocker.
+func getCodes() []string {
+	return []string{"status", "enable", "disable"}
+}
+
+// Handler is the HTTP handler for ad blocker control.
+func (a *adblock) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = a.driver.status(r.Context())
+	case "enable":
+		err = a.driver.setBlocking(r.Context(), true, 0)
+	case "disable":
+		// Blocking is disabled until enabled again when no number of minutes is given
+		var minutes int64
+		if request.Value != "" {
+			if minutes, err = request.Value.Int64(); err != nil || minutes < 0 {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+				return
+			}
+		}
+		err = a.driver.setBlocking(r.Context(), false, minutes)
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all ad blockers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured ad blockers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
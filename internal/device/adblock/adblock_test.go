@@ -0,0 +1,352 @@
+package adblock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read adblock input")
+	}
+
+	adblockConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &adblockConfig); err != nil {
+		t.Fatalf("Could not read adblock input")
+	}
+	return &adblockConfig
+}
+
+// setupPiholeServer emulates a password protected Pi-hole v6, recording the blocking requests sent to it.
+func setupPiholeServer(t *testing.T, requests *[]string) *httptest.Server {
+	blocking := "enabled"
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method == "POST" && r.URL.Path == "/api/auth" {
+			body := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["password"] != "pihole-password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"session":{"valid":false,"sid":null}}`))
+				return
+			}
+			w.Write([]byte(`{"session":{"valid":true,"sid":"session","validity":1800}}`))
+			return
+		}
+
+		if r.Header.Get("X-FTL-SID") != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"key":"unauthorized","message":"Unauthorized"}}`))
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/dns/blocking":
+			if blocking == "enabled" {
+				w.Write([]byte(`{"blocking":"enabled","timer":null}`))
+			} else {
+				w.Write([]byte(`{"blocking":"disabled","timer":299.5}`))
+			}
+		case "POST /api/dns/blocking":
+			body := map[string]any{}
+			json.NewDecoder(r.Body).Decode(&body)
+			data, _ := json.Marshal(body)
+			*requests = append(*requests, string(data))
+			if body["blocking"] == true {
+				blocking = "enabled"
+			} else {
+				blocking = "disabled"
+			}
+			w.Write([]byte(`{"blocking":"` + blocking + `","timer":null}`))
+		case "GET /api/stats/summary":
+			w.Write([]byte(`{"queries":{"total":1000,"blocked":250,"percent_blocked":25.0}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// setupAdGuardServer emulates AdGuard Home behind basic auth, recording the protection requests sent to it.
+func setupAdGuardServer(t *testing.T, requests *[]string) *httptest.Server {
+	enabled := true
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "adguard-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /control/status":
+			json.NewEncoder(w).Encode(map[string]any{"protection_enabled": enabled, "protection_disabled_duration": map[bool]int{true: 0, false: 600000}[enabled]})
+		case "POST /control/protection":
+			body := map[string]any{}
+			json.NewDecoder(r.Body).Decode(&body)
+			data, _ := json.Marshal(body)
+			*requests = append(*requests, string(data))
+			enabled = body["enabled"] == true
+		case "GET /control/stats":
+			w.Write([]byte(`{"num_dns_queries":400,"num_blocked_filtering":100}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/adblockConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/adblockConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/adblockConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/adblockConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/adblockConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		data             string
+		expectedCode     int
+		expectedBody     string
+		expectedRequests []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/adblock/pihole",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","enable","disable"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/adblock/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["pihole","adguard"]}`,
+		},
+		{
+			name:         "pihole_status",
+			method:       "POST",
+			url:          "/adblock/pihole?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"blocking":true,"queries":1000,"blocked":250,"percentBlocked":25}}`,
+		},
+		{
+			name:             "pihole_disable",
+			method:           "POST",
+			url:              "/adblock/pihole",
+			data:             `{"code":"disable","value":5}`,
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"blocking":false,"timer":300}`},
+		},
+		{
+			name:         "pihole_status_disabled",
+			method:       "POST",
+			url:          "/adblock/pihole?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"blocking":false,"disabledSeconds":299,"queries":1000,"blocked":250,"percentBlocked":25}}`,
+		},
+		{
+			name:             "pihole_enable",
+			method:           "POST",
+			url:              "/adblock/pihole?code=enable",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"blocking":true}`},
+		},
+		{
+			name:             "pihole_disable_indefinitely",
+			method:           "POST",
+			url:              "/adblock/pihole?code=disable",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"blocking":false}`},
+		},
+		{
+			name:             "adguard_disable",
+			method:           "POST",
+			url:              "/adblock/adguard?code=disable&value=10",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"duration":600000,"enabled":false}`},
+		},
+		{
+			name:         "adguard_status_disabled",
+			method:       "POST",
+			url:          "/adblock/adguard?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"blocking":false,"disabledSeconds":600,"queries":400,"blocked":100,"percentBlocked":25}}`,
+		},
+		{
+			name:             "adguard_enable",
+			method:           "POST",
+			url:              "/adblock/adguard?code=enable",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"enabled":true}`},
+		},
+		{
+			name:         "disable_negative_value",
+			method:       "POST",
+			url:          "/adblock/adguard?code=disable&value=-1",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "disable_invalid_value",
+			method:       "POST",
+			url:          "/adblock/adguard?code=disable&value=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/adblock/pihole?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/adblock/pihole",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/adblock/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	requests := []string{}
+	piholeServer := setupPiholeServer(t, &requests)
+	defer piholeServer.Close()
+	adguardServer := setupAdGuardServer(t, &requests)
+	defer adguardServer.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/adblockConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		if d.Pihole != nil {
+			d.Pihole.URL = piholeServer.URL
+		}
+		if d.AdGuard != nil {
+			d.AdGuard.URL = adguardServer.URL
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = requests[:0]
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedRequests != nil {
+				assert.Equal(t, tc.expectedRequests, requests)
+			}
+		})
+	}
+
+	t.Run("dry_run_disable", func(t *testing.T) {
+		requests = requests[:0]
+		ctx, dryRun := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/adblock/pihole?code=disable&value=5", nil).WithContext(ctx))
+
+		assert.Equal(t, 200, recorder.Code)
+		assert.Empty(t, requests)
+		assert.Equal(t, []device.Call{{Method: "POST", URL: piholeServer.URL + "/api/dns/blocking", Payload: map[string]any{"blocking": false, "timer": float64(300)}}}, dryRun.Calls())
+	})
+}
@@ -0,0 +1,116 @@
+package adblock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// adguard drives AdGuard Home through its control API.
+type adguard struct {
+	URL      string        `yaml:"url"`
+	Username string        `yaml:"username"`
+	Password config.Secret `yaml:"password"`
+	timeout  uint
+}
+
+// adguardStatus represents the fields of interest from the /control/status endpoint.
+type adguardStatus struct {
+	ProtectionEnabled bool  `json:"protection_enabled"`
+	DisabledDuration  int64 `json:"protection_disabled_duration"`
+}
+
+// adguardStats represents the fields of interest from the /control/stats endpoint, covering the configured statistics interval.
+type adguardStats struct {
+	Queries int64 `json:"num_dns_queries"`
+	Blocked int64 `json:"num_blocked_filtering"`
+}
+
+// call sends a request to a control endpoint, decoding the response when provided.
+func (a *adguard) call(ctx context.Context, method string, endpoint string, body any, response any) error {
+	client := &http.Client{
+		Timeout: time.Duration(a.timeout) * time.Millisecond,
+	}
+
+	var reader io.Reader
+	if body != nil {
+		requestBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(a.URL, "/")+"/control/"+endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.Username != "" {
+		req.SetBasicAuth(a.Username, a.Password.Value())
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("adguard returned status code %d for %s", resp.StatusCode, endpoint)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(responseBytes, response)
+}
+
+func (a *adguard) setBlocking(ctx context.Context, enabled bool, minutes int64) error {
+	body := map[string]any{"enabled": enabled}
+	if minutes > 0 {
+		body["duration"] = minutes * 60 * 1000
+	}
+	return a.call(ctx, "POST", "protection", body, nil)
+}
+
+func (a *adguard) status(ctx context.Context) (*status, error) {
+	protection := adguardStatus{}
+	if err := a.call(ctx, "GET", "status", nil, &protection); err != nil {
+		return nil, err
+	}
+
+	stats := adguardStats{}
+	if err := a.call(ctx, "GET", "stats", nil, &stats); err != nil {
+		return nil, err
+	}
+
+	status := status{
+		Blocking: protection.ProtectionEnabled,
+		Queries:  stats.Queries,
+		Blocked:  stats.Blocked,
+	}
+	if stats.Queries > 0 {
+		status.PercentBlocked = float64(stats.Blocked) * 100 / float64(stats.Queries)
+	}
+	if !status.Blocking && protection.DisabledDuration > 0 {
+		seconds := protection.DisabledDuration / 1000
+		status.DisabledSeconds = &seconds
+	}
+	return &status, nil
+}
@@ -0,0 +1,160 @@
+package adblock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// pihole drives a Pi-hole v6 through its REST API, authenticating with the web interface or an app password.
+type pihole struct {
+	URL      string        `yaml:"url"`
+	Password config.Secret `yaml:"password"`
+	timeout  uint
+	sid      string
+	mutex    sync.Mutex
+}
+
+// piholeBlocking represents the /api/dns/blocking endpoint.
+type piholeBlocking struct {
+	Blocking string   `json:"blocking"`
+	Timer    *float64 `json:"timer"`
+}
+
+// piholeSummary represents the fields of interest from the /api/stats/summary endpoint.
+type piholeSummary struct {
+	Queries struct {
+		Total          int64   `json:"total"`
+		Blocked        int64   `json:"blocked"`
+		PercentBlocked float64 `json:"percent_blocked"`
+	} `json:"queries"`
+}
+
+// errSessionExpired is returned for requests rejected because the session has expired.
+var errSessionExpired = errors.New("pi-hole session expired")
+
+// send sends a single request to an API endpoint, decoding the response when provided.
+func (p *pihole) send(ctx context.Context, method string, endpoint string, body any, response any) error {
+	client := &http.Client{
+		Timeout: time.Duration(p.timeout) * time.Millisecond,
+	}
+
+	var reader io.Reader
+	if body != nil {
+		requestBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(p.URL, "/")+"/api/"+endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.sid != "" {
+		req.Header.Set("X-FTL-SID", p.sid)
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errSessionExpired
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pi-hole returned status code %d for %s", resp.StatusCode, endpoint)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(responseBytes, response)
+}
+
+// login starts a new session, which is needed to read status during a dry run.
+func (p *pihole) login(ctx context.Context) error {
+	p.sid = ""
+	response := struct {
+		Session struct {
+			Valid bool   `json:"valid"`
+			SID   string `json:"sid"`
+		} `json:"session"`
+	}{}
+	if err := p.send(device.Read(ctx), "POST", "auth", map[string]string{"password": p.Password.Value()}, &response); err != nil {
+		return err
+	}
+	if !response.Session.Valid {
+		return errors.New("pi-hole rejected the password")
+	}
+	p.sid = response.Session.SID
+	return nil
+}
+
+// call sends a request to an API endpoint, logging in first if the session has expired. Pi-holes without a password need no session.
+func (p *pihole) call(ctx context.Context, method string, endpoint string, body any, response any) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	err := p.send(ctx, method, endpoint, body, response)
+	if !errors.Is(err, errSessionExpired) || p.Password == "" {
+		return err
+	}
+
+	if err := p.login(ctx); err != nil {
+		return err
+	}
+	return p.send(ctx, method, endpoint, body, response)
+}
+
+func (p *pihole) setBlocking(ctx context.Context, enabled bool, minutes int64) error {
+	body := map[string]any{"blocking": enabled}
+	if minutes > 0 {
+		body["timer"] = minutes * 60
+	}
+	return p.call(ctx, "POST", "dns/blocking", body, nil)
+}
+
+func (p *pihole) status(ctx context.Context) (*status, error) {
+	blocking := piholeBlocking{}
+	if err := p.call(ctx, "GET", "dns/blocking", nil, &blocking); err != nil {
+		return nil, err
+	}
+
+	summary := piholeSummary{}
+	if err := p.call(ctx, "GET", "stats/summary", nil, &summary); err != nil {
+		return nil, err
+	}
+
+	status := status{
+		Blocking:       blocking.Blocking == "enabled",
+		Queries:        summary.Queries.Total,
+		Blocked:        summary.Queries.Blocked,
+		PercentBlocked: summary.Queries.PercentBlocked,
+	}
+	if !status.Blocking && blocking.Timer != nil {
+		seconds := int64(*blocking.Timer)
+		status.DisabledSeconds = &seconds
+	}
+	return &status, nil
+}
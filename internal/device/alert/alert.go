@@ -2,42 +2,90 @@ package alert
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"time"
 
 	config "github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+	"github.com/kennedn/restate-go/internal/common/inbox"
 	"github.com/kennedn/restate-go/internal/common/logging"
 	common "github.com/kennedn/restate-go/internal/device/alert/common"
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
+	"github.com/gorilla/mux"
 	"gopkg.in/yaml.v3"
 )
 
 type rawResponse struct {
-	Status int      `json:"status"`
-	Errors []string `json:"errors,omitempty"`
+	Status  int      `json:"status"`
+	Receipt string   `json:"receipt,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// rawReceipt is the acknowledgement state of an emergency priority alert as returned by the receipts API.
+type rawReceipt struct {
+	Status          int      `json:"status"`
+	Acknowledged    int      `json:"acknowledged"`
+	AcknowledgedAt  int64    `json:"acknowledged_at"`
+	AcknowledgedBy  string   `json:"acknowledged_by"`
+	LastDeliveredAt int64    `json:"last_delivered_at"`
+	Expired         int      `json:"expired"`
+	ExpiresAt       int64    `json:"expires_at"`
+	CalledBack      int      `json:"called_back"`
+	Errors          []string `json:"errors,omitempty"`
+}
+
+// receipt is the flattened acknowledgement state of an emergency priority alert.
+type receipt struct {
+	Acknowledged    bool   `json:"acknowledged"`
+	AcknowledgedAt  int64  `json:"acknowledgedAt,omitempty"`
+	AcknowledgedBy  string `json:"acknowledgedBy,omitempty"`
+	LastDeliveredAt int64  `json:"lastDeliveredAt,omitempty"`
+	Expired         bool   `json:"expired"`
+	ExpiresAt       int64  `json:"expiresAt,omitempty"`
+	CalledBack      bool   `json:"calledBack"`
 }
 
 type alert struct {
-	Name    string `yaml:"name"`
-	Timeout uint   `yaml:"timeoutMs"`
-	Token   string `yaml:"token"`
-	User    string `yaml:"user"`
+	Name    string        `yaml:"name"`
+	Timeout uint          `yaml:"timeoutMs"`
+	Token   config.Secret `yaml:"token"`
+	User    string        `yaml:"user"`
+	Retry   int           `yaml:"retry"`
+	Expire  int           `yaml:"expire"`
 	Base    base
 }
 
 type base struct {
-	Devices []*alert
-	URL     string
+	Devices    []*alert
+	URL        string
+	ReceiptURL string
 }
 
+// Limits imposed by Pushover on emergency priority alerts
+const (
+	emergencyPriority = "2"
+	minRetry          = 30
+	maxExpire         = 10800
+)
+
+// validReceipt matches the 30 character alphanumeric receipts returned by Pushover
+var validReceipt = regexp.MustCompile(`^[A-Za-z0-9]{30}$`)
+
 type Device struct{}
 
+// DryRun previews the notification a request would push, the alert is left out of the inbox.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 // Device interface function for generating routes
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config)
@@ -48,7 +96,8 @@ func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 func routes(config *config.Config) (*base, []router.Route, error) {
 	routes := []router.Route{}
 	base := base{
-		URL: "https://api.pushover.net/1/messages.json",
+		URL:        "https://api.pushover.net/1/messages.json",
+		ReceiptURL: "https://api.pushover.net/1/receipts/%s.json",
 	}
 
 	for _, d := range config.Devices {
@@ -65,7 +114,7 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &alert); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &alert); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -75,19 +124,32 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 			continue
 		}
 
+		// Defaults for emergency priority alerts that do not provide their own retry and expire
+		if alert.Retry == 0 {
+			alert.Retry = 60
+		}
+		if alert.Expire == 0 {
+			alert.Expire = 3600
+		}
+
 		routes = append(routes, router.Route{
 			Path:    "/" + alert.Name,
 			Handler: alert.handler,
 		})
 
+		routes = append(routes, router.Route{
+			Path:    "/" + alert.Name + "/receipts/{receipt}",
+			Handler: alert.receiptHandler,
+		})
+
 		base.Devices = append(base.Devices, &alert)
 
 		logging.Log(logging.Info, "Found device \"%s\"", alert.Name)
 	}
 
-	if len(routes) == 0 {
+	if len(base.Devices) == 0 {
 		return nil, []router.Route{}, errors.New("no routes found in config")
-	} else if len(routes) == 1 {
+	} else if len(base.Devices) == 1 {
 		return &base, routes, nil
 	}
 
@@ -108,29 +170,36 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 }
 
 // Sanitise params and post to pushover
-func (a *alert) post(request common.Request) (*rawResponse, int, error) {
-	client := &http.Client{
-		Timeout: time.Duration(a.Timeout) * time.Millisecond,
-	}
+func (a *alert) post(ctx context.Context, request common.Request) (*rawResponse, int, error) {
+	client := egress.Client("alert", time.Duration(a.Timeout)*time.Millisecond)
 
 	if request.Title == "" {
 		request.Title = "restate"
 	}
 
 	if request.Token == "" {
-		request.Token = a.Token
+		request.Token = a.Token.Value()
 	}
 
 	if request.User == "" {
 		request.User = a.User
 	}
 
+	if request.Priority.String() == emergencyPriority {
+		if request.Retry == 0 {
+			request.Retry = a.Retry
+		}
+		if request.Expire == 0 {
+			request.Expire = a.Expire
+		}
+	}
+
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	req, err := http.NewRequest("POST", a.Base.URL, bytes.NewReader(requestBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", a.Base.URL, bytes.NewReader(requestBytes))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -138,7 +207,7 @@ func (a *alert) post(request common.Request) (*rawResponse, int, error) {
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send the request and get the response
-	resp, err := client.Do(req)
+	resp, err := device.Do(client, req)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -175,16 +244,9 @@ func (a *alert) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := common.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	if request.Message == "" {
@@ -192,7 +254,27 @@ func (a *alert) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, responseCode, err := a.post(request)
+	if request.Retry != 0 && request.Retry < minRetry {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter: retry (Min: %d)", minRetry), nil)
+		return
+	}
+
+	if request.Expire < 0 || request.Expire > maxExpire {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter: expire (Min: 1, Max: %d)", maxExpire), nil)
+		return
+	}
+
+	// Alerts sent through the alert device by other devices, e.g. from schedule actions, are kept in the inbox too
+	if !device.DryRunning(r.Context()) {
+		title := request.Title
+		if title == "" {
+			title = "restate"
+		}
+		priority, _ := request.Priority.Int64()
+		inbox.Record("alert/"+a.Name, title, request.Message, int(priority))
+	}
+
+	response, responseCode, err := a.post(r.Context(), request)
 	if err != nil || responseCode == 500 {
 		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 		return
@@ -205,9 +287,78 @@ func (a *alert) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Emergency priority alerts return a receipt that can be polled for acknowledgement
+	if response.Receipt != "" {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", map[string]string{"receipt": response.Receipt})
+		return
+	}
+
 	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
 }
 
+// getReceipt retrieves the acknowledgement state of an emergency priority alert.
+func (a *alert) getReceipt(id string) (*rawReceipt, int, error) {
+	client := egress.Client("alert", time.Duration(a.Timeout)*time.Millisecond)
+
+	url := fmt.Sprintf(a.Base.ReceiptURL, id) + "?token=" + a.Token.Value()
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	rawReceipt := rawReceipt{}
+	if err := json.NewDecoder(resp.Body).Decode(&rawReceipt); err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	return &rawReceipt, resp.StatusCode, nil
+}
+
+// Handle polling the acknowledgement state of an emergency priority alert
+func (a *alert) receiptHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method != http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	id := mux.Vars(r)["receipt"]
+	if !validReceipt.MatchString(id) {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: receipt", nil)
+		return
+	}
+
+	response, responseCode, err := a.getReceipt(id)
+	if err != nil || responseCode == 500 {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	} else if responseCode != 200 {
+		var errorMessage string
+		if len(response.Errors) > 0 {
+			errorMessage = response.Errors[0]
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(responseCode, errorMessage, nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", receipt{
+		Acknowledged:    response.Acknowledged == 1,
+		AcknowledgedAt:  response.AcknowledgedAt,
+		AcknowledgedBy:  response.AcknowledgedBy,
+		LastDeliveredAt: response.LastDeliveredAt,
+		Expired:         response.Expired == 1,
+		ExpiresAt:       response.ExpiresAt,
+		CalledBack:      response.CalledBack == 1,
+	})
+}
+
 func (b *base) getDeviceNames() []string {
 	var names []string
 	for _, d := range b.Devices {
@@ -50,6 +50,17 @@ func setupHTTPServer(t *testing.T, serverConfigPath string) *httptest.Server {
 	}
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			resp := findCode("receipt", serverConfig)
+			if r.URL.Path != "/receipts/rLqVuqTRh62UzxtmqiaLzQmVcPgiCy.json" || r.URL.Query().Get("token") != "testToken" {
+				resp = findCode("bad-receipt", serverConfig)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(resp.HttpCode)
+			w.Write([]byte(resp.Json))
+			return
+		}
+
 		request := common.Request{}
 
 		rawBody, err := io.ReadAll(r.Body)
@@ -72,6 +83,8 @@ func setupHTTPServer(t *testing.T, serverConfigPath string) *httptest.Server {
 			priority, err := request.Priority.Int64()
 			if err != nil || priority < -2 || priority > 2 {
 				resp = findCode("bad-priority", serverConfig)
+			} else if priority == 2 && request.Retry >= 30 && request.Expire > 0 {
+				resp = findCode("emergency", serverConfig)
 			}
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -95,7 +108,7 @@ func TestRoutes(t *testing.T) {
 		{
 			name:          "default_config",
 			configPath:    "testdata/alertConfig/normal_config.yaml",
-			routeCount:    4,
+			routeCount:    6,
 			expectedError: nil,
 		},
 		{
@@ -119,7 +132,7 @@ func TestRoutes(t *testing.T) {
 		{
 			name:          "single_device_config",
 			configPath:    "testdata/alertConfig/single_device_config.yaml",
-			routeCount:    1,
+			routeCount:    2,
 			expectedError: nil,
 		},
 	}
@@ -169,7 +182,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK"}`,
+			expectedBody: `{"version":1,"message":"OK"}`,
 		},
 		{
 			name:         "no_error_json",
@@ -179,7 +192,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK"}`,
+			expectedBody: `{"version":1,"message":"OK"}`,
 		},
 		{
 			name:         "get_device_request",
@@ -189,7 +202,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 405,
-			expectedBody: `{"message":"Method Not Allowed"}`,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:         "get_base_request",
@@ -199,7 +212,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":["test1","test2"]}`,
+			expectedBody: `{"version":1,"message":"OK","data":["test1","test2"]}`,
 		},
 		{
 			name:         "get_base_request_single_device",
@@ -219,7 +232,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 405,
-			expectedBody: `{"message":"Method Not Allowed"}`,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:         "malformed_json_body",
@@ -229,7 +242,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"Malformed Or Empty JSON Body"}`,
+			expectedBody: `{"version":1,"message":"Malformed Or Empty JSON Body"}`,
 		},
 		{
 			name:         "malformed_query_string",
@@ -239,7 +252,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"Malformed or empty query string"}`,
+			expectedBody: `{"version":1,"message":"Malformed or empty query string"}`,
 		},
 		{
 			name:         "missing_message_variable",
@@ -249,7 +262,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"Invalid Parameter: message"}`,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: message"}`,
 		},
 		{
 			name:         "invalid_user_variable",
@@ -259,7 +272,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"user identifier is not a valid user, group, or subscribed user key, see https://pushover.net/api#identifiers"}`,
+			expectedBody: `{"version":1,"message":"user identifier is not a valid user, group, or subscribed user key, see https://pushover.net/api#identifiers"}`,
 		},
 		{
 			name:         "invalid_token_variable",
@@ -269,7 +282,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"application token is invalid, see https://pushover.net/api"}`,
+			expectedBody: `{"version":1,"message":"application token is invalid, see https://pushover.net/api"}`,
 		},
 		{
 			name:         "invalid_priority_variable",
@@ -279,7 +292,77 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"priority is invalid, see https://pushover.net/api#priority"}`,
+			expectedBody: `{"version":1,"message":"priority is invalid, see https://pushover.net/api#priority"}`,
+		},
+		{
+			name:         "emergency_priority_defaults",
+			method:       "POST",
+			url:          "/alert/test1?message=test&priority=2",
+			data:         nil,
+			serverConfig: "testdata/serverConfig/normal_responses.yaml",
+			alertConfig:  "testdata/alertConfig/normal_config.yaml",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"receipt":"rLqVuqTRh62UzxtmqiaLzQmVcPgiCy"}}`,
+		},
+		{
+			name:         "emergency_priority_json",
+			method:       "POST",
+			url:          "/alert/test1",
+			data:         []byte(`{"message":"test","priority":2,"retry":30,"expire":10800,"callback":"http://example.com/ack"}`),
+			serverConfig: "testdata/serverConfig/normal_responses.yaml",
+			alertConfig:  "testdata/alertConfig/normal_config.yaml",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"receipt":"rLqVuqTRh62UzxtmqiaLzQmVcPgiCy"}}`,
+		},
+		{
+			name:         "invalid_retry_variable",
+			method:       "POST",
+			url:          "/alert/test1?message=test&priority=2&retry=10",
+			data:         nil,
+			serverConfig: "testdata/serverConfig/normal_responses.yaml",
+			alertConfig:  "testdata/alertConfig/normal_config.yaml",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: retry (Min: 30)"}`,
+		},
+		{
+			name:         "invalid_expire_variable",
+			method:       "POST",
+			url:          "/alert/test1?message=test&priority=2&expire=20000",
+			data:         nil,
+			serverConfig: "testdata/serverConfig/normal_responses.yaml",
+			alertConfig:  "testdata/alertConfig/normal_config.yaml",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: expire (Min: 1, Max: 10800)"}`,
+		},
+		{
+			name:         "receipt",
+			method:       "GET",
+			url:          "/alert/test1/receipts/rLqVuqTRh62UzxtmqiaLzQmVcPgiCy",
+			data:         nil,
+			serverConfig: "testdata/serverConfig/normal_responses.yaml",
+			alertConfig:  "testdata/alertConfig/normal_config.yaml",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"acknowledged":true,"acknowledgedAt":1700000100,"acknowledgedBy":"testUser","lastDeliveredAt":1700000060,"expired":false,"expiresAt":1700003600,"calledBack":false}}`,
+		},
+		{
+			name:         "unknown_receipt",
+			method:       "GET",
+			url:          "/alert/test1/receipts/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			data:         nil,
+			serverConfig: "testdata/serverConfig/normal_responses.yaml",
+			alertConfig:  "testdata/alertConfig/normal_config.yaml",
+			expectedCode: 404,
+			expectedBody: `{"version":1,"message":"receipt not found; may be invalid or expired"}`,
+		},
+		{
+			name:         "invalid_receipt",
+			method:       "GET",
+			url:          "/alert/test1/receipts/invalid",
+			data:         nil,
+			serverConfig: "testdata/serverConfig/normal_responses.yaml",
+			alertConfig:  "testdata/alertConfig/normal_config.yaml",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: receipt"}`,
 		},
 		{
 			name:         "internal_server_error",
@@ -289,7 +372,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig: "testdata/serverConfig/normal_responses.yaml",
 			alertConfig:  "testdata/alertConfig/normal_config.yaml",
 			expectedCode: 500,
-			expectedBody: `{"message":"Internal Server Error"}`,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
 		},
 	}
 
@@ -319,6 +402,7 @@ func TestHandlers(t *testing.T) {
 			server := setupHTTPServer(t, tc.serverConfig)
 			for _, d := range base.Devices {
 				d.Base.URL = server.URL
+				d.Base.ReceiptURL = server.URL + "/receipts/%s.json"
 			}
 
 			defer server.Close()
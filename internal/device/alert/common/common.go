@@ -12,4 +12,7 @@ type Request struct {
 	AttachmentType   string      `json:"attachment_type,omitempty"`
 	URL              string      `json:"url,omitempty"`
 	URLTitle         string      `json:"url_title,omitempty"`
+	Retry            int         `json:"retry,omitempty"`
+	Expire           int         `json:"expire,omitempty"`
+	Callback         string      `json:"callback,omitempty"`
 }
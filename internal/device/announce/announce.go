@@ -0,0 +1,408 @@
+// Package announce provides spoken announcements, synthesizing a message with a text-to-speech engine and playing it on speakers.
+package announce
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Clips are served to speakers that fetch them for this long after an announcement
+const clipExpiry = 5 * time.Minute
+
+var validClip = regexp.MustCompile(`^[0-9a-f]{32}\.wav$`)
+
+// player is implemented by each supported type of speaker.
+type player interface {
+	play(clip *clip, url string, timeout time.Duration) error
+}
+
+// request is an announcement, code and value allow announcements to be made as actions of other devices, e.g schedules.
+type request struct {
+	Message string   `json:"message,omitempty"`
+	Targets []string `json:"targets,omitempty"`
+	Code    string   `json:"code,omitempty"`
+	Value   string   `json:"value,omitempty"`
+}
+
+// speaker represents a named speaker and how to reach it.
+type speaker struct {
+	Name   string `yaml:"name"`
+	Type   string `yaml:"type"`
+	Host   string `yaml:"host"`
+	Volume *int   `yaml:"volume"`
+	player player
+}
+
+// announce represents an announcement configuration with name, text-to-speech engine and speakers.
+type announce struct {
+	Name           string     `yaml:"name"`
+	Timeout        uint       `yaml:"timeoutMs"`
+	URL            string     `yaml:"url"`
+	TTS            *tts       `yaml:"tts"`
+	Speakers       []*speaker `yaml:"speakers"`
+	DefaultTargets []string   `yaml:"defaultTargets"`
+	Base           base
+	clips          map[string]*clip
+	mutex          sync.Mutex
+}
+
+// base represents a list of announcers and the text-to-speech endpoint used by cloud engines
+type base struct {
+	GoogleURL string
+	Devices   []*announce
+}
+
+type Device struct{}
+
+// DryRun lists the speakers an announcement would play on, without synthesizing it.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for announcers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts announcers from config, returning a route for each and one serving the clips it has synthesized to its speakers.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{
+		GoogleURL: "https://texttospeech.googleapis.com/v1/text:synthesize",
+	}
+
+	for _, d := range config.Devices {
+		if d.Type != "announce" {
+			continue
+		}
+		announce := announce{
+			Base:  base,
+			clips: map[string]*clip{},
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &announce); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if announce.Name == "" || announce.Timeout == 0 || announce.TTS == nil || len(announce.Speakers) == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if err := announce.init(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", announce.Name, err)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + announce.Name,
+			Handler: announce.handler,
+		})
+
+		routes = append(routes, router.Route{
+			Path:    "/" + announce.Name + "/audio/{clip}",
+			Handler: announce.clipHandler,
+		})
+
+		base.Devices = append(base.Devices, &announce)
+
+		logging.Log(logging.Info, "Found device \"%s\"", announce.Name)
+	}
+
+	if len(base.Devices) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(base.Devices) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/announce" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/announce",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/announce/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// init validates the text-to-speech engine and speakers, pointing the google engine at the base endpoint.
+func (a *announce) init() error {
+	if err := a.TTS.init(a.Base.GoogleURL); err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, s := range a.Speakers {
+		if s.Name == "" || s.Host == "" {
+			return errors.New("speakers require a name and host")
+		}
+		if slices.Contains(names, s.Name) {
+			return fmt.Errorf("speaker \"%s\" is configured more than once", s.Name)
+		}
+		names = append(names, s.Name)
+
+		if s.Volume != nil && (*s.Volume < 0 || *s.Volume > 100) {
+			return fmt.Errorf("volume of speaker \"%s\" must be between 0 and 100", s.Name)
+		}
+
+		switch s.Type {
+		case "sonos":
+			s.player = &sonos{host: s.Host, volume: s.Volume}
+		case "chromecast":
+			s.player = &chromecast{host: s.Host, volume: s.Volume}
+		case "snapcast":
+			s.player = &snapcast{host: s.Host}
+		default:
+			return fmt.Errorf("type of speaker \"%s\" must be either 'sonos', 'chromecast' or 'snapcast'", s.Name)
+		}
+
+		// Sonos and Chromecast speakers fetch clips from restate
+		if s.Type != "snapcast" && a.URL == "" {
+			return fmt.Errorf("url is required to play on speaker \"%s\"", s.Name)
+		}
+	}
+
+	for _, t := range a.DefaultTargets {
+		if !slices.Contains(names, t) {
+			return fmt.Errorf("default target \"%s\" is not a speaker", t)
+		}
+	}
+	return nil
+}
+
+// getCodes returns a list of control codes for an announcer.
+func getCodes() []string {
+	return []string{"announce"}
+}
+
+// targets returns the speakers named in a request, the default targets when none are named or every speaker when there are no defaults.
+func (a *announce) targets(names []string) ([]*speaker, error) {
+	requested := []string{}
+	for _, n := range names {
+		for _, t := range strings.Split(n, ",") {
+			if t = strings.TrimSpace(t); t != "" && !slices.Contains(requested, t) {
+				requested = append(requested, t)
+			}
+		}
+	}
+	if len(requested) == 0 {
+		requested = a.DefaultTargets
+	}
+
+	if len(requested) == 0 {
+		return a.Speakers, nil
+	}
+
+	speakers := []*speaker{}
+	for _, t := range requested {
+		i := slices.IndexFunc(a.Speakers, func(s *speaker) bool { return s.Name == t })
+		if i == -1 {
+			return nil, fmt.Errorf("unknown speaker \"%s\"", t)
+		}
+		speakers = append(speakers, a.Speakers[i])
+	}
+	return speakers, nil
+}
+
+// store keeps a clip to be served to speakers, dropping expired clips.
+func (a *announce) store(c *clip) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(id) + ".wav"
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for n, existing := range a.clips {
+		if time.Since(existing.created) > clipExpiry {
+			delete(a.clips, n)
+		}
+	}
+	a.clips[name] = c
+	return name, nil
+}
+
+// announce synthesizes a message and plays it on speakers in parallel. A dry run records the message each speaker would play
+// without synthesizing it.
+func (a *announce) announce(ctx context.Context, message string, speakers []*speaker) error {
+	if device.DryRunning(ctx) {
+		for _, s := range speakers {
+			device.Record(ctx, device.Call{Method: strings.ToUpper(s.Type), URL: s.Host, Payload: map[string]string{"message": message}})
+		}
+		return nil
+	}
+
+	timeout := time.Duration(a.Timeout) * time.Millisecond
+
+	clip, err := a.TTS.synthesize(message, timeout)
+	if err != nil {
+		return err
+	}
+
+	name, err := a.store(clip)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(a.URL, "/") + "/audio/" + name
+
+	errs := make([]error, len(speakers))
+	wg := sync.WaitGroup{}
+	for i, s := range speakers {
+		wg.Add(1)
+		go func(i int, s *speaker) {
+			defer wg.Done()
+			if err := s.player.play(clip, url, timeout); err != nil {
+				errs[i] = fmt.Errorf("unable to announce on \"%s\": %w", s.Name, err)
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Handler is the HTTP handler for announcements.
+func (a *announce) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	message := request.Message
+	if request.Code != "" {
+		if request.Code != "announce" || message != "" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+			return
+		}
+		message = request.Value
+	}
+
+	if strings.TrimSpace(message) == "" {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: message", nil)
+		return
+	}
+
+	speakers, err := a.targets(request.Targets)
+	if err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: targets", nil)
+		return
+	}
+
+	if err := a.announce(r.Context(), message, speakers); err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// clipHandler serves synthesized clips to the speakers playing them.
+func (a *announce) clipHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["clip"]
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httpCode, jsonResponse := device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		device.JSONResponse(w, httpCode, jsonResponse)
+		return
+	}
+
+	if !validClip.MatchString(name) {
+		httpCode, jsonResponse := device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: clip", nil)
+		device.JSONResponse(w, httpCode, jsonResponse)
+		return
+	}
+
+	a.mutex.Lock()
+	clip, ok := a.clips[name]
+	a.mutex.Unlock()
+
+	if !ok || time.Since(clip.created) > clipExpiry {
+		httpCode, jsonResponse := device.SetJSONResponse(http.StatusNotFound, "Not Found", nil)
+		device.JSONResponse(w, httpCode, jsonResponse)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Header().Set("Content-Length", fmt.Sprint(len(clip.wav)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(clip.wav)
+	}
+}
+
+// getDeviceNames returns the names of all announcers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured announcers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,399 @@
+package announce
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read announce input")
+	}
+
+	announceConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &announceConfig); err != nil {
+		t.Fatalf("Could not read announce input")
+	}
+	return &announceConfig
+}
+
+// testWAV returns a mono 16 bit WAV file containing samples.
+func testWAV(samples []byte) []byte {
+	b := []byte("RIFF")
+	b = binary.LittleEndian.AppendUint32(b, uint32(36+len(samples)))
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, 22050)
+	b = binary.LittleEndian.AppendUint32(b, 44100)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(samples)))
+	return append(b, samples...)
+}
+
+// setupGoogleServer emulates the Google Cloud Text-to-Speech API, returning the message as the samples of a WAV file.
+func setupGoogleServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "google-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body := struct {
+			Input struct {
+				Text string `json:"text"`
+			} `json:"input"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(map[string]string{"audioContent": base64.StdEncoding.EncodeToString(testWAV([]byte(body.Input.Text)))})
+	}))
+}
+
+// setupSonosServer emulates the UPnP services of a Sonos speaker, recording the actions called and the URIs set.
+func setupSonosServer(t *testing.T, mutex *sync.Mutex, actions *[]string, uris *[]string) *httptest.Server {
+	currentURI := regexp.MustCompile(`<CurrentURI>(.*)</CurrentURI>`)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		action := r.Header.Get("SOAPACTION")
+		*actions = append(*actions, r.URL.Path+" "+action[strings.Index(action, "#")+1:len(action)-1])
+		if m := currentURI.FindSubmatch(body); m != nil {
+			*uris = append(*uris, string(m[1]))
+		}
+	}))
+}
+
+// setupSnapcastSource emulates the TCP stream source of a Snapcast server, recording the samples streamed to it.
+func setupSnapcastSource(t *testing.T, mutex *sync.Mutex, samples *[]string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			conn.Close()
+			mutex.Lock()
+			*samples = append(*samples, string(data))
+			mutex.Unlock()
+		}
+	}()
+	return listener
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/announceConfig/normal_config.yaml",
+			routeCount:    6,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/announceConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/announceConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/announceConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/announceConfig/single_device_config.yaml",
+			routeCount:    2,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name            string
+		method          string
+		url             string
+		data            string
+		expectedCode    int
+		expectedBody    string
+		expectedActions []string
+		expectedSamples []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/announce/announce",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["announce"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/announce/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["announce","espeak"]}`,
+		},
+		{
+			name:            "announce_default_targets",
+			method:          "POST",
+			url:             "/announce/announce",
+			data:            `{"message":"Washing machine finished"}`,
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedActions: []string{"/MediaRenderer/RenderingControl/Control SetVolume", "/MediaRenderer/AVTransport/Control SetAVTransportURI", "/MediaRenderer/AVTransport/Control Play"},
+			expectedSamples: []string{},
+		},
+		{
+			name:            "announce_targets",
+			method:          "POST",
+			url:             "/announce/announce",
+			data:            `{"message":"Dinner is ready","targets":["garden"]}`,
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedActions: []string{},
+			expectedSamples: []string{"Dinner is ready"},
+		},
+		{
+			name:            "announce_query_targets",
+			method:          "POST",
+			url:             "/announce/announce?message=Doorbell&targets=garden,kitchen",
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedActions: []string{"/MediaRenderer/RenderingControl/Control SetVolume", "/MediaRenderer/AVTransport/Control SetAVTransportURI", "/MediaRenderer/AVTransport/Control Play"},
+			expectedSamples: []string{"Doorbell"},
+		},
+		{
+			name:            "announce_action",
+			method:          "POST",
+			url:             "/announce/announce",
+			data:            `{"code":"announce","value":"Bins go out tonight"}`,
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedActions: []string{"/MediaRenderer/RenderingControl/Control SetVolume", "/MediaRenderer/AVTransport/Control SetAVTransportURI", "/MediaRenderer/AVTransport/Control Play"},
+		},
+		{
+			name:         "missing_message",
+			method:       "POST",
+			url:          "/announce/announce",
+			data:         `{"targets":["garden"]}`,
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: message"}`,
+		},
+		{
+			name:         "unknown_target",
+			method:       "POST",
+			url:          "/announce/announce?message=Hello&targets=attic",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: targets"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/announce/announce?code=monkey&value=Hello",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "invalid_clip",
+			method:       "GET",
+			url:          "/announce/announce/audio/monkey.wav",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: clip"}`,
+		},
+		{
+			name:         "missing_clip",
+			method:       "GET",
+			url:          "/announce/announce/audio/00000000000000000000000000000000.wav",
+			expectedCode: 404,
+			expectedBody: `{"version":1,"message":"Not Found"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/announce/announce",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/announce/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	mutex := sync.Mutex{}
+	actions := []string{}
+	uris := []string{}
+	samples := []string{}
+
+	googleServer := setupGoogleServer(t)
+	defer googleServer.Close()
+	sonosServer := setupSonosServer(t, &mutex, &actions, &uris)
+	defer sonosServer.Close()
+	snapcastSource := setupSnapcastSource(t, &mutex, &samples)
+	defer snapcastSource.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/announceConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	announce := base.Devices[0]
+	announce.TTS.url = googleServer.URL
+	announce.Speakers[0].player.(*sonos).host = strings.TrimPrefix(sonosServer.URL, "http://")
+	announce.Speakers[2].player.(*snapcast).host = snapcastSource.Addr().String()
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mutex.Lock()
+			actions = actions[:0]
+			samples = samples[:0]
+			mutex.Unlock()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			// Samples are recorded once the source has read to the end of the stream, which may be after the response
+			if tc.expectedSamples != nil {
+				assert.Eventually(t, func() bool {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return len(samples) == len(tc.expectedSamples)
+				}, time.Second, 10*time.Millisecond)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if tc.expectedActions != nil {
+				assert.Equal(t, tc.expectedActions, actions)
+			}
+			if tc.expectedSamples != nil {
+				assert.Equal(t, tc.expectedSamples, samples)
+			}
+		})
+	}
+
+	t.Run("dry_run_announce", func(t *testing.T) {
+		mutex.Lock()
+		actions = actions[:0]
+		mutex.Unlock()
+		ctx, dryRun := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/announce/announce?message=Doorbell&targets=kitchen,lounge", nil).WithContext(ctx))
+
+		assert.Equal(t, 200, recorder.Code)
+		mutex.Lock()
+		assert.Empty(t, actions)
+		mutex.Unlock()
+		assert.Equal(t, []device.Call{
+			{Method: "SONOS", URL: "192.0.2.0", Payload: map[string]any{"message": "Doorbell"}},
+			{Method: "CHROMECAST", URL: "192.0.2.1", Payload: map[string]any{"message": "Doorbell"}},
+		}, dryRun.Calls())
+	})
+
+	t.Run("serve_clip", func(t *testing.T) {
+		if len(uris) == 0 {
+			t.Fatalf("No clips were played on the sonos speaker")
+		}
+		uri := uris[len(uris)-1]
+		assert.True(t, strings.HasPrefix(uri, "http://restate.lan:8080/v2/announce/announce/audio/"))
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", strings.TrimPrefix(uri, "http://restate.lan:8080/v2"), nil))
+
+		assert.Equal(t, 200, recorder.Code)
+		assert.Equal(t, "audio/wav", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, testWAV([]byte("Bins go out tonight")), recorder.Body.Bytes())
+	})
+}
+
+func TestCastMessage(t *testing.T) {
+	m := castMessage{source: "sender-0", destination: "receiver-0", namespace: namespaceReceiver, payload: `{"type":"GET_STATUS","requestId":1}`}
+
+	decoded, err := unmarshalCastMessage(m.marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, m, *decoded)
+
+	_, err = unmarshalCastMessage(bytes.Repeat([]byte{0x32, 0x10}, 2))
+	assert.Error(t, err)
+}
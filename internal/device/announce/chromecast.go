@@ -0,0 +1,258 @@
+package announce
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Port of the cast protocol on a Chromecast
+const chromecastPort = "8009"
+
+// App ID of the Default Media Receiver
+const defaultMediaReceiver = "CC1AD845"
+
+// Namespaces of the cast protocol channels used
+const (
+	namespaceConnection = "urn:x-cast:com.google.cast.tp.connection"
+	namespaceHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	namespaceReceiver   = "urn:x-cast:com.google.cast.receiver"
+	namespaceMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+// Messages larger than this are rejected, the protocol limits messages to 64KiB
+const maxCastMessage = 64 * 1024
+
+// chromecast plays clips on a Chromecast or Google/Nest speaker by loading them in the Default Media Receiver.
+type chromecast struct {
+	host   string
+	volume *int
+}
+
+// castMessage is the subset of the CastMessage protocol buffer used, all payloads are JSON strings.
+type castMessage struct {
+	source      string
+	destination string
+	namespace   string
+	payload     string
+}
+
+// marshal encodes a message as a CastMessage protocol buffer.
+func (m *castMessage) marshal() []byte {
+	field := func(b []byte, number byte, value string) []byte {
+		b = append(b, number<<3|2)
+		b = binary.AppendUvarint(b, uint64(len(value)))
+		return append(b, value...)
+	}
+
+	// protocol_version CASTV2_1_0 and payload_type STRING are both 0
+	b := []byte{1 << 3, 0}
+	b = field(b, 2, m.source)
+	b = field(b, 3, m.destination)
+	b = field(b, 4, m.namespace)
+	b = append(b, 5<<3, 0)
+	return field(b, 6, m.payload)
+}
+
+// unmarshalCastMessage decodes a CastMessage protocol buffer, skipping fields that are not used.
+func unmarshalCastMessage(b []byte) (*castMessage, error) {
+	m := castMessage{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("malformed cast message")
+		}
+		b = b[n:]
+
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("malformed cast message")
+			}
+			b = b[n:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, errors.New("malformed cast message")
+			}
+			value := string(b[n : n+int(length)])
+			b = b[n+int(length):]
+
+			switch key >> 3 {
+			case 2:
+				m.source = value
+			case 3:
+				m.destination = value
+			case 4:
+				m.namespace = value
+			case 6:
+				m.payload = value
+			}
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in cast message", key&7)
+		}
+	}
+	return &m, nil
+}
+
+// castConn is a connection to a cast device.
+type castConn struct {
+	conn net.Conn
+}
+
+// send writes a length prefixed message with a JSON payload.
+func (c *castConn) send(destination string, namespace string, payload any) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	m := castMessage{source: "sender-0", destination: destination, namespace: namespace, payload: string(payloadBytes)}
+	b := m.marshal()
+	_, err = c.conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...))
+	return err
+}
+
+// receive reads the next message, answering heartbeats from the device.
+func (c *castConn) receive() (*castMessage, error) {
+	for {
+		length := make([]byte, 4)
+		if _, err := io.ReadFull(c.conn, length); err != nil {
+			return nil, err
+		}
+		size := binary.BigEndian.Uint32(length)
+		if size > maxCastMessage {
+			return nil, errors.New("cast message too large")
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(c.conn, b); err != nil {
+			return nil, err
+		}
+
+		m, err := unmarshalCastMessage(b)
+		if err != nil {
+			return nil, err
+		}
+		if m.namespace == namespaceHeartbeat {
+			if err := c.send(m.source, namespaceHeartbeat, map[string]string{"type": "PONG"}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return m, nil
+	}
+}
+
+func (c *chromecast) play(_ *clip, url string, timeout time.Duration) error {
+	host := c.host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, chromecastPort)
+	}
+
+	// Cast devices present certificates signed by Google's device CA rather than one that can be verified here
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	cast := castConn{conn: conn}
+
+	if err := cast.send("receiver-0", namespaceConnection, map[string]string{"type": "CONNECT"}); err != nil {
+		return err
+	}
+
+	if c.volume != nil {
+		err := cast.send("receiver-0", namespaceReceiver, map[string]any{"type": "SET_VOLUME", "requestId": 1, "volume": map[string]float64{"level": float64(*c.volume) / 100}})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := cast.send("receiver-0", namespaceReceiver, map[string]any{"type": "LAUNCH", "requestId": 2, "appId": defaultMediaReceiver}); err != nil {
+		return err
+	}
+
+	// Wait for the receiver to report the running app and the transport to load media through
+	transport := ""
+	for transport == "" {
+		m, err := cast.receive()
+		if err != nil {
+			return err
+		}
+		if m.namespace != namespaceReceiver {
+			continue
+		}
+
+		status := struct {
+			Type   string `json:"type"`
+			Status struct {
+				Applications []struct {
+					AppID       string `json:"appId"`
+					TransportID string `json:"transportId"`
+				} `json:"applications"`
+			} `json:"status"`
+		}{}
+		if err := json.Unmarshal([]byte(m.payload), &status); err != nil {
+			return err
+		}
+		if status.Type == "LAUNCH_ERROR" {
+			return errors.New("unable to launch the default media receiver")
+		}
+		for _, app := range status.Status.Applications {
+			if app.AppID == defaultMediaReceiver {
+				transport = app.TransportID
+			}
+		}
+	}
+
+	if err := cast.send(transport, namespaceConnection, map[string]string{"type": "CONNECT"}); err != nil {
+		return err
+	}
+
+	load := map[string]any{
+		"type":      "LOAD",
+		"requestId": 3,
+		"autoplay":  true,
+		"media":     map[string]string{"contentId": url, "contentType": "audio/wav", "streamType": "BUFFERED"},
+	}
+	if err := cast.send(transport, namespaceMedia, load); err != nil {
+		return err
+	}
+
+	for {
+		m, err := cast.receive()
+		if err != nil {
+			return err
+		}
+		if m.namespace != namespaceMedia {
+			continue
+		}
+
+		response := struct {
+			Type      string `json:"type"`
+			RequestID int    `json:"requestId"`
+		}{}
+		if err := json.Unmarshal([]byte(m.payload), &response); err != nil {
+			return err
+		}
+		if response.RequestID != 3 {
+			continue
+		}
+
+		switch response.Type {
+		case "MEDIA_STATUS":
+			return nil
+		case "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST":
+			return fmt.Errorf("media receiver returned %s", response.Type)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package announce
+
+import (
+	"net"
+	"time"
+)
+
+// snapcast plays clips by streaming their samples to a TCP stream source of a Snapcast server, e.g.
+// tcp://0.0.0.0:4953?name=Announce&mode=server&sampleformat=22050:16:1, whose sample format must match the engine's.
+type snapcast struct {
+	host string
+}
+
+func (s *snapcast) play(clip *clip, _ string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", s.host, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The server reads samples as they are played, so writing takes as long as the clip
+	if err := conn.SetWriteDeadline(time.Now().Add(timeout + clip.duration())); err != nil {
+		return err
+	}
+
+	_, err = conn.Write(clip.pcm)
+	return err
+}
@@ -0,0 +1,77 @@
+package announce
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/egress"
+)
+
+// Port of the UPnP services on a Sonos speaker
+const sonosPort = "1400"
+
+// sonos plays clips on a Sonos speaker through its UPnP AVTransport service, replacing whatever is playing.
+type sonos struct {
+	host   string
+	volume *int
+}
+
+// soap calls an action of a UPnP service with the given arguments, which are written in order.
+func (s *sonos) soap(timeout time.Duration, service string, action string, args [][2]string) error {
+	host := s.host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, sonosPort)
+	}
+
+	body := strings.Builder{}
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+
+	urn := "urn:schemas-upnp-org:service:" + service + ":1"
+	envelope := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + urn + `">` + body.String() + `</u:` + action + `></s:Body></s:Envelope>`
+
+	req, err := http.NewRequest("POST", "http://"+host+"/MediaRenderer/"+service+"/Control", bytes.NewReader([]byte(envelope)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", `"`+urn+"#"+action+`"`)
+
+	client := egress.Client("announce", timeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status code %d", action, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *sonos) play(_ *clip, url string, timeout time.Duration) error {
+	if s.volume != nil {
+		err := s.soap(timeout, "RenderingControl", "SetVolume", [][2]string{{"InstanceID", "0"}, {"Channel", "Master"}, {"DesiredVolume", fmt.Sprint(*s.volume)}})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.soap(timeout, "AVTransport", "SetAVTransportURI", [][2]string{{"InstanceID", "0"}, {"CurrentURI", url}, {"CurrentURIMetaData", ""}})
+	if err != nil {
+		return err
+	}
+
+	return s.soap(timeout, "AVTransport", "Play", [][2]string{{"InstanceID", "0"}, {"Speed", "1"}})
+}
@@ -0,0 +1,209 @@
+package announce
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+)
+
+// tts represents a text-to-speech engine, run locally or through a cloud API.
+type tts struct {
+	Engine   string        `yaml:"engine"`
+	Command  string        `yaml:"command"`
+	Model    string        `yaml:"model"`
+	Voice    string        `yaml:"voice"`
+	Language string        `yaml:"language"`
+	Key      config.Secret `yaml:"key"`
+	url      string
+}
+
+// clip is synthesized speech as a WAV file along with its PCM format.
+type clip struct {
+	wav        []byte
+	pcm        []byte
+	sampleRate uint32
+	channels   uint16
+	bits       uint16
+	created    time.Time
+}
+
+// init validates the engine's parameters and applies defaults.
+func (t *tts) init(googleURL string) error {
+	switch t.Engine {
+	case "piper":
+		if t.Model == "" {
+			return errors.New("the piper engine requires a model")
+		}
+		if t.Command == "" {
+			t.Command = "piper"
+		}
+	case "espeak":
+		if t.Command == "" {
+			t.Command = "espeak-ng"
+		}
+	case "google":
+		if t.Key == "" {
+			return errors.New("the google engine requires a key")
+		}
+		if t.Language == "" {
+			t.Language = "en-GB"
+		}
+		t.url = googleURL
+	default:
+		return errors.New("engine must be either 'piper', 'espeak' or 'google'")
+	}
+	return nil
+}
+
+// synthesize turns a message into speech.
+func (t *tts) synthesize(message string, timeout time.Duration) (*clip, error) {
+	var wav []byte
+	var err error
+
+	switch t.Engine {
+	case "piper":
+		wav, err = t.run(message, timeout, func(output string) []string {
+			return []string{"--model", t.Model, "--output_file", output}
+		})
+	case "espeak":
+		wav, err = t.run(message, timeout, func(output string) []string {
+			args := []string{"--stdin", "-w", output}
+			if t.Voice != "" {
+				args = append(args, "-v", t.Voice)
+			}
+			return args
+		})
+	case "google":
+		wav, err = t.google(message, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseWAV(wav)
+}
+
+// run runs a local engine with the message on stdin, returning the WAV file it writes.
+func (t *tts) run(message string, timeout time.Duration, args func(output string) []string) ([]byte, error) {
+	output, err := os.CreateTemp("", "announce-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, t.Command, args(output.Name())...)
+	cmd.Stdin = strings.NewReader(message)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", t.Command, err, strings.TrimSpace(string(out)))
+	}
+
+	return os.ReadFile(output.Name())
+}
+
+// google synthesizes a message with the Google Cloud Text-to-Speech API, returning 16 bit PCM with a WAV header.
+func (t *tts) google(message string, timeout time.Duration) ([]byte, error) {
+	voice := map[string]string{"languageCode": t.Language}
+	if t.Voice != "" {
+		voice["name"] = t.Voice
+	}
+
+	requestBytes, err := json.Marshal(map[string]any{
+		"input":       map[string]string{"text": message},
+		"voice":       voice,
+		"audioConfig": map[string]string{"audioEncoding": "LINEAR16"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := egress.Client("announce", timeout)
+	resp, err := client.Post(t.url+"?key="+url.QueryEscape(t.Key.Value()), "application/json", bytes.NewReader(requestBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("text-to-speech returned status code %d", resp.StatusCode)
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := struct {
+		AudioContent string `json:"audioContent"`
+	}{}
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(response.AudioContent)
+}
+
+// parseWAV finds the format and samples of a PCM WAV file.
+func parseWAV(wav []byte) (*clip, error) {
+	if len(wav) < 12 || string(wav[0:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		return nil, errors.New("speech is not a WAV file")
+	}
+
+	c := clip{wav: wav, created: time.Now()}
+	for offset := 12; offset+8 <= len(wav); {
+		id := string(wav[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(wav[offset+4 : offset+8]))
+		body := wav[offset+8 : min(offset+8+size, len(wav))]
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 || binary.LittleEndian.Uint16(body[0:2]) != 1 {
+				return nil, errors.New("speech is not PCM encoded")
+			}
+			c.channels = binary.LittleEndian.Uint16(body[2:4])
+			c.sampleRate = binary.LittleEndian.Uint32(body[4:8])
+			c.bits = binary.LittleEndian.Uint16(body[14:16])
+		case "data":
+			// Engines writing to a pipe leave the size unset, in which case the data runs to the end of the file
+			if size == 0 || size == 0xffffffff {
+				c.pcm = wav[offset+8:]
+				offset = len(wav)
+				continue
+			}
+			c.pcm = body
+		}
+
+		// Chunks are padded to an even size
+		offset += 8 + size + size%2
+	}
+
+	if c.sampleRate == 0 || c.pcm == nil {
+		return nil, errors.New("speech is missing a format or data")
+	}
+	return &c, nil
+}
+
+// duration returns how long a clip takes to play.
+func (c *clip) duration() time.Duration {
+	bytesPerSecond := int(c.sampleRate) * int(c.channels) * int(c.bits) / 8
+	if bytesPerSecond == 0 {
+		return 0
+	}
+	return time.Duration(len(c.pcm)) * time.Second / time.Duration(bytesPerSecond)
+}
@@ -3,7 +3,6 @@ package bthome
 
 import (
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -17,7 +16,6 @@ import (
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
 	"github.com/gorilla/websocket"
 	"gopkg.in/yaml.v3"
 )
@@ -186,6 +184,11 @@ func (b *base) websocketConnectWithResponses(devices []*bthome) ([]*namedStatus,
 	return statusResponses, nil
 }
 
+// DryRun is always safe, bthome devices are only ever read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 // Routes generates routes for bthome device control based on a provided configuration.
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config)
@@ -211,7 +214,7 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &bthome); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &bthome); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -236,7 +239,7 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 
 	if len(routes) == 0 {
 		return nil, []router.Route{}, errors.New("no routes found in config")
-	} else if len(routes) == 1 {
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
 		return &base, routes, nil
 	}
 
@@ -279,16 +282,9 @@ func (m *bthome) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	if request.Code != "status" {
@@ -345,16 +341,9 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	if request.Hosts == "" {
@@ -372,6 +361,11 @@ DUPLICATE_DEVICE:
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter: hosts (Device '%s' does not exist)", h), nil)
 			return
 		}
+
+		// Devices taken out of rotation are excluded from groups
+		if !device.Enabled(m.Name) {
+			continue
+		}
 		for _, device := range devices {
 			if m == device {
 				continue DUPLICATE_DEVICE
@@ -380,6 +374,11 @@ DUPLICATE_DEVICE:
 		devices = append(devices, m)
 	}
 
+	if len(devices) == 0 {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusServiceUnavailable, "Service Unavailable", nil)
+		return
+	}
+
 	status, err := b.websocketConnectWithResponses(devices)
 	if err != nil {
 		logging.Log(logging.Error, err.Error())
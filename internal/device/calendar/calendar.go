@@ -0,0 +1,442 @@
+// Package calendar provides iCal feed polling, switching modes on and off while matching calendar events are in progress.
+package calendar
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// trigger switches a mode on while an event with a matching summary is in progress, and off once it has ended.
+type trigger struct {
+	Summary string `yaml:"summary"`
+	Mode    string `yaml:"mode"`
+	active  bool
+}
+
+// event is a single calendar entry parsed from the feed.
+type event struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+	allDay  bool
+}
+
+type triggerStatus struct {
+	Summary string `json:"summary"`
+	Active  bool   `json:"active"`
+	Next    string `json:"next,omitempty"`
+}
+
+type status struct {
+	Fetched  string           `json:"fetched,omitempty"`
+	Triggers []*triggerStatus `json:"triggers"`
+}
+
+// calendar represents a calendar configuration with name, feed URL, poll interval and the triggers to evaluate.
+type calendar struct {
+	Name     string     `yaml:"name"`
+	URL      string     `yaml:"url"`
+	Timeout  uint       `yaml:"timeoutMs"`
+	Interval uint       `yaml:"intervalSeconds"`
+	Triggers []*trigger `yaml:"triggers"`
+	Base     base
+	events   []*event
+	fetched  time.Time
+	mutex    sync.Mutex
+}
+
+// base represents a list of calendars
+type base struct {
+	Devices []*calendar
+}
+
+type Device struct{}
+
+// DryRun lists the mode switches a refresh would send, the feed is still fetched.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for calendars based on a provided configuration and starts polling each feed.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	base, routes, err := routes(config)
+	if err != nil {
+		return routes, err
+	}
+
+	for _, c := range base.Devices {
+		go c.run()
+	}
+
+	return routes, err
+}
+
+// routes extracts calendar feeds from config, each needing at least one trigger, and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+DEVICE:
+	for _, d := range config.Devices {
+		if d.Type != "calendar" {
+			continue
+		}
+		calendar := calendar{
+			Interval: 300,
+			Base:     base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &calendar); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if calendar.Name == "" || calendar.URL == "" || calendar.Timeout == 0 || calendar.Interval == 0 || len(calendar.Triggers) == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		for _, t := range calendar.Triggers {
+			if t.Summary == "" || t.Mode == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue DEVICE
+			}
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + calendar.Name,
+			Handler: calendar.handler,
+		})
+
+		base.Devices = append(base.Devices, &calendar)
+
+		logging.Log(logging.Info, "Found device \"%s\"", calendar.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/calendar" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/calendar",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/calendar/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// parseTime parses a DTSTART or DTEND property, honouring TZID and all day VALUE=DATE parameters.
+func parseTime(params string, value string) (time.Time, error) {
+	location := time.Local
+	for _, p := range strings.Split(params, ";") {
+		if name, ok := strings.CutPrefix(p, "TZID="); ok {
+			l, err := time.LoadLocation(strings.Trim(name, "\""))
+			if err != nil {
+				return time.Time{}, err
+			}
+			location = l
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	case len(value) == len("20060102"):
+		return time.ParseInLocation("20060102", value, location)
+	default:
+		return time.ParseInLocation("20060102T150405", value, location)
+	}
+}
+
+// parse reads VEVENT entries from an iCal feed. Recurrence rules are not expanded, only the first occurrence is returned.
+func parse(r io.Reader) ([]*event, error) {
+	// Unfold continuation lines, which begin with a single space or tab
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	events := []*event{}
+	var current *event
+	for _, line := range lines {
+		property, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(property, ";")
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &event{}
+		case name == "END" && value == "VEVENT" && current != nil:
+			if current.Start.IsZero() {
+				current = nil
+				continue
+			}
+			// Events without an end last for a day when all day, or are instantaneous otherwise
+			if current.End.IsZero() {
+				current.End = current.Start
+				if current.allDay {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "SUMMARY":
+			current.Summary = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(value)
+		case name == "DTSTART" || name == "DTEND":
+			t, err := parseTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s \"%s\": %w", name, value, err)
+			}
+			if name == "DTSTART" {
+				current.Start = t
+				current.allDay = len(value) == len("20060102")
+			} else {
+				current.End = t
+			}
+		}
+	}
+	return events, nil
+}
+
+// fetch downloads and parses the feed.
+func (c *calendar) fetch() ([]*event, error) {
+	client := &http.Client{
+		Timeout: time.Duration(c.Timeout) * time.Millisecond,
+	}
+
+	resp, err := client.Get(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d from %s", resp.StatusCode, c.URL)
+	}
+
+	return parse(resp.Body)
+}
+
+// matches reports whether an event summary matches a trigger, ignoring case and surrounding whitespace.
+func (t *trigger) matches(e *event) bool {
+	return strings.EqualFold(strings.TrimSpace(e.Summary), strings.TrimSpace(t.Summary))
+}
+
+// inProgress reports whether any event matching the trigger is in progress at now.
+func (t *trigger) inProgress(events []*event, now time.Time) bool {
+	for _, e := range events {
+		if t.matches(e) && !now.Before(e.Start) && now.Before(e.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply switches each trigger's mode when its in progress state has changed, failed switches are retried on the next poll.
+// Switches made during a dry run are only recorded, so they are sent again on the next poll.
+func (c *calendar) apply(ctx context.Context, now time.Time) error {
+	var errs []error
+	for _, t := range c.Triggers {
+		active := t.inProgress(c.events, now)
+		if active == t.active {
+			continue
+		}
+
+		action := device.Action{
+			URL:  t.Mode,
+			Code: "off",
+		}
+		if active {
+			action.Code = "on"
+		}
+
+		_, code, err := action.PostContext(ctx, c.Timeout)
+		if err == nil && code != http.StatusOK {
+			err = fmt.Errorf("received status code %d from %s", code, t.Mode)
+		}
+		if err != nil {
+			logging.Log(logging.Error, "Calendar \"%s\" failed to send code \"%s\" to %s: %v", c.Name, action.Code, t.Mode, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		if device.DryRunning(ctx) {
+			continue
+		}
+
+		t.active = active
+		logging.Log(logging.Info, "Calendar \"%s\" sent code \"%s\" to %s for \"%s\"", c.Name, action.Code, t.Mode, t.Summary)
+	}
+	return errors.Join(errs...)
+}
+
+// refresh fetches the feed and applies the triggers, the previous events are kept if the feed cannot be fetched.
+func (c *calendar) refresh(ctx context.Context, now time.Time) error {
+	events, err := c.fetch()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err != nil {
+		logging.Log(logging.Error, "Calendar \"%s\" failed to fetch feed: %v", c.Name, err)
+	} else {
+		c.events = events
+		c.fetched = now
+	}
+
+	return errors.Join(err, c.apply(ctx, now))
+}
+
+// run refreshes the calendar every interval, for the lifetime of the process.
+func (c *calendar) run() {
+	for {
+		c.refresh(context.Background(), time.Now())
+		time.Sleep(time.Duration(c.Interval) * time.Second)
+	}
+}
+
+// status returns the state of each trigger along with the start of its next matching event.
+func (c *calendar) status(now time.Time) *status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status := status{}
+	if !c.fetched.IsZero() {
+		status.Fetched = c.fetched.Format(time.RFC3339)
+	}
+
+	for _, t := range c.Triggers {
+		triggerStatus := triggerStatus{
+			Summary: t.Summary,
+			Active:  t.active,
+		}
+
+		var next time.Time
+		for _, e := range c.events {
+			if t.matches(e) && e.Start.After(now) && (next.IsZero() || e.Start.Before(next)) {
+				next = e.Start
+			}
+		}
+		if !next.IsZero() {
+			triggerStatus.Next = next.Format(time.RFC3339)
+		}
+
+		status.Triggers = append(status.Triggers, &triggerStatus)
+	}
+	return &status
+}
+
+// getCodes returns a list of control codes for a calendar.
+func getCodes() []string {
+	return []string{"status", "refresh"}
+}
+
+// Handler is the HTTP handler for calendar control.
+func (c *calendar) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "status":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", c.status(time.Now()))
+		return
+	case "refresh":
+		if err := c.refresh(r.Context(), time.Now()); err != nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// getDeviceNames returns the names of all calendars in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured calendars.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
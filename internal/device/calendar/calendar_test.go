@@ -0,0 +1,404 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read calendar input")
+	}
+
+	calendarConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &calendarConfig); err != nil {
+		t.Fatalf("Could not read calendar input")
+	}
+	return &calendarConfig
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/calendarConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/calendarConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/calendarConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/calendarConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/calendarConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	feed := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"SUMMARY:Away",
+		"DTSTART:20261020T080000Z",
+		"DTEND:20261027T180000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Guests\\, family",
+		"DTSTART;VALUE=DATE:20261101",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Dentist appointment with a summary long enough",
+		"  to be folded",
+		"DTSTART;TZID=Europe/London:20261105T093000",
+		"DTEND;TZID=Europe/London:20261105T100000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:No start",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("parse returned an error: %v", err)
+	}
+
+	london, _ := time.LoadLocation("Europe/London")
+	expected := []*event{
+		{Summary: "Away", Start: time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC), End: time.Date(2026, 10, 27, 18, 0, 0, 0, time.UTC)},
+		{Summary: "Guests, family", Start: time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local), End: time.Date(2026, 11, 2, 0, 0, 0, 0, time.Local), allDay: true},
+		{Summary: "Dentist appointment with a summary long enough to be folded", Start: time.Date(2026, 11, 5, 9, 30, 0, 0, london), End: time.Date(2026, 11, 5, 10, 0, 0, 0, london)},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("Wrong number of events returned, Expected: %d, Got: %d", len(expected), len(events))
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.Summary, events[i].Summary)
+		assert.True(t, e.Start.Equal(events[i].Start), "Unexpected start for \"%s\", Expected: %v, Got: %v", e.Summary, e.Start, events[i].Start)
+		assert.True(t, e.End.Equal(events[i].End), "Unexpected end for \"%s\", Expected: %v, Got: %v", e.Summary, e.End, events[i].End)
+	}
+
+	_, err = parse(strings.NewReader("BEGIN:VEVENT\r\nDTSTART:tomorrow\r\nEND:VEVENT"))
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	var mutex sync.Mutex
+	received := []string{}
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		received = append(received, r.URL.Path+" "+request.Code)
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"version":1,"message":"Internal Server Error"}`))
+			return
+		}
+		w.Write([]byte(`{"version":1,"message":"OK"}`))
+	}))
+	defer server.Close()
+
+	start := time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC)
+	c := &calendar{
+		Name:    "family",
+		Timeout: 1000,
+		Triggers: []*trigger{
+			{Summary: "away", Mode: server.URL + "/away"},
+			{Summary: "Guests", Mode: server.URL + "/guests"},
+		},
+		events: []*event{
+			{Summary: "Away ", Start: start, End: start.Add(48 * time.Hour)},
+			{Summary: "Dentist", Start: start, End: start.Add(time.Hour)},
+		},
+	}
+
+	testCases := []struct {
+		name             string
+		now              time.Time
+		failing          bool
+		dryRun           bool
+		expectError      bool
+		expectedRequests []string
+	}{
+		{
+			name:             "before_event",
+			now:              start.Add(-time.Minute),
+			expectedRequests: []string{},
+		},
+		{
+			name:             "event_started_dry_run",
+			now:              start,
+			dryRun:           true,
+			expectedRequests: []string{},
+		},
+		{
+			name:             "event_started",
+			now:              start,
+			expectedRequests: []string{"/away on"},
+		},
+		{
+			name:             "event_in_progress",
+			now:              start.Add(time.Hour),
+			expectedRequests: []string{},
+		},
+		{
+			name:             "event_ended_with_failure",
+			now:              start.Add(48 * time.Hour),
+			failing:          true,
+			expectError:      true,
+			expectedRequests: []string{"/away off"},
+		},
+		{
+			name:             "event_ended_retry",
+			now:              start.Add(49 * time.Hour),
+			expectedRequests: []string{"/away off"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = []string{}
+			failing = tc.failing
+
+			ctx, dryRun := device.WithDryRun(context.Background())
+			if !tc.dryRun {
+				ctx = context.Background()
+			}
+
+			err := c.apply(ctx, tc.now)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRequests, received)
+			if tc.dryRun {
+				assert.Equal(t, []device.Call{{Method: "POST", URL: server.URL + "/away", Payload: map[string]any{"code": "on"}}}, dryRun.Calls())
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		data             string
+		expectedCode     int
+		expectedBody     string
+		expectedRequests []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/calendar/family",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","refresh"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/calendar/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["family","work"]}`,
+		},
+		{
+			name:         "status_before_refresh",
+			method:       "POST",
+			url:          "/calendar/family",
+			data:         `{"code":"status"}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"triggers":[{"summary":"Away","active":false},{"summary":"Guests","active":false}]}}`,
+		},
+		{
+			name:             "refresh_switches_modes",
+			method:           "POST",
+			url:              "/calendar/family?code=refresh",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{"/away on"},
+		},
+		{
+			name:             "refresh_feed_failure",
+			method:           "POST",
+			url:              "/calendar/work?code=refresh",
+			expectedCode:     500,
+			expectedBody:     `{"version":1,"message":"Internal Server Error"}`,
+			expectedRequests: []string{},
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/calendar/family?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/calendar/family",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/calendar/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	now := time.Now().UTC()
+	feed := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"SUMMARY:Away",
+		"DTSTART:" + now.Add(-time.Hour).Format("20060102T150405Z"),
+		"DTEND:" + now.Add(time.Hour).Format("20060102T150405Z"),
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Guests",
+		"DTSTART:" + now.Add(24*time.Hour).Format("20060102T150405Z"),
+		"DTEND:" + now.Add(48*time.Hour).Format("20060102T150405Z"),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	var mutex sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/family.ics":
+			w.Write([]byte(feed))
+			return
+		case "/work.ics":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		received = append(received, r.URL.Path+" "+request.Code)
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version":1,"message":"OK"}`))
+	}))
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/calendarConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	rewrite := func(url string) string {
+		return server.URL + url[strings.LastIndex(url, "/"):]
+	}
+	for _, d := range base.Devices {
+		d.URL = rewrite(d.URL)
+		for _, t := range d.Triggers {
+			t.Mode = rewrite(t.Mode)
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = []string{}
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedRequests != nil {
+				assert.Equal(t, tc.expectedRequests, received)
+			}
+		})
+	}
+
+	status := base.Devices[0].status(now)
+	assert.NotEmpty(t, status.Fetched)
+	assert.True(t, status.Triggers[0].Active)
+	assert.Equal(t, now.Add(24*time.Hour).Truncate(time.Second).Format(time.RFC3339), status.Triggers[1].Next)
+}
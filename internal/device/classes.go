@@ -0,0 +1,107 @@
+package device
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Canonical codes of each device class, integrations such as bridges to Home Assistant, HomeKit or Matter translate these codes
+// rather than those of each device type
+var classCodes = map[string][]string{
+	"light":   {"status", "toggle", "luminance", "temperature", "rgb"},
+	"switch":  {"status", "toggle"},
+	"cover":   {"status", "open", "close", "stop", "position"},
+	"climate": {"status", "toggle", "mode", "target"},
+	"lock":    {"status", "lock", "unlock"},
+	"sensor":  {"status"},
+	"media":   {"status", "play", "pause", "stop", "volume"},
+}
+
+// Classes of device types whose devices all share a class, other devices have a class only if configured with one
+var typeClasses = map[string]string{
+	"cover":             "cover",
+	"garage":            "cover",
+	"lock":              "lock",
+	"bthome":            "sensor",
+	"sensor":            "sensor",
+	"radiator":          "climate",
+	"meross_thermostat": "climate",
+	"mpd":               "media",
+	"snapcast":          "media",
+}
+
+// class is the class of a single device along with the canonical codes it supports.
+type class struct {
+	Name  string   `json:"name"`
+	Class string   `json:"class"`
+	Codes []string `json:"codes"`
+}
+
+// deviceClass returns the class of a configured device, the configured class if any or that of its type. Meross bulbs are lights
+// and other Meross devices are switches.
+func deviceClass(c config.Devices) string {
+	if c.Class != "" {
+		return c.Class
+	}
+	if c.Type == "meross" {
+		if deviceType, _ := c.Config["deviceType"].(string); deviceType == "bulb" {
+			return "light"
+		}
+		return "switch"
+	}
+	return typeClasses[c.Type]
+}
+
+// validClass reports whether a configured class is one of the device classes.
+func validClass(name string) bool {
+	_, ok := classCodes[name]
+	return ok
+}
+
+// getClasses returns the class of each classified device, listing the canonical codes of its class that the device offers.
+func (d *Devices) getClasses() []class {
+	classes := []class{}
+	for name, c := range d.classes {
+		handler, ok := d.handlers[name]
+		if !ok {
+			continue
+		}
+
+		offered := (&health{Name: name, handler: handler}).getCodes()
+		codes := []string{}
+		for _, code := range classCodes[c] {
+			if slices.Contains(offered, code) {
+				codes = append(codes, code)
+			}
+		}
+		classes = append(classes, class{Name: name, Class: c, Codes: codes})
+	}
+	sort.Slice(classes, func(i int, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+	return classes
+}
+
+// classesHandler returns the canonical codes of each class and the class of each device, e.g. for bridges to map devices onto.
+func (d *Devices) classesHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method != http.MethodGet {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	httpCode, jsonResponse = common.SetJSONResponse(http.StatusOK, "OK", map[string]any{
+		"classes": classCodes,
+		"devices": d.getClasses(),
+	})
+}
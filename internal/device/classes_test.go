@@ -0,0 +1,57 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceClass(t *testing.T) {
+	testCases := []struct {
+		name     string
+		device   config.Devices
+		expected string
+	}{
+		{"meross_bulb", config.Devices{Type: "meross", Config: map[string]any{"deviceType": "bulb"}}, "light"},
+		{"meross_socket", config.Devices{Type: "meross", Config: map[string]any{"deviceType": "socket"}}, "switch"},
+		{"type_class", config.Devices{Type: "garage"}, "cover"},
+		{"configured_class", config.Devices{Type: "switchbot", Class: "cover"}, "cover"},
+		{"configured_class_preferred", config.Devices{Type: "meross", Class: "light", Config: map[string]any{"deviceType": "socket"}}, "light"},
+		{"unclassified", config.Devices{Type: "tvcom"}, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, deviceClass(tc.device))
+		})
+	}
+
+	assert.True(t, validClass("climate"))
+	assert.False(t, validClass("fan"))
+}
+
+func TestClassesHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	d := &Devices{
+		classes: map[string]string{"lamp": "light", "plug": "switch", "gone": "switch"},
+		handlers: map[string]func(http.ResponseWriter, *http.Request){
+			"lamp": (&fakeRoute{codes: []string{"status", "toggle", "luminance", "info"}}).handler,
+			"plug": (&fakeRoute{codes: []string{"status", "toggle", "reboot"}}).handler,
+		},
+	}
+
+	// Devices list the canonical codes of their class that they offer, in the order of the class, and devices without a route are left out
+	recorder := httptest.NewRecorder()
+	d.classesHandler(recorder, httptest.NewRequest(http.MethodGet, "/v2/classes", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"devices":[{"name":"lamp","class":"light","codes":["status","toggle","luminance"]},{"name":"plug","class":"switch","codes":["status","toggle"]}]`)
+	assert.Contains(t, recorder.Body.String(), `"lock":["status","lock","unlock"]`)
+
+	recorder = httptest.NewRecorder()
+	d.classesHandler(recorder, httptest.NewRequest(http.MethodPost, "/v2/classes", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,64 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+)
+
+// routeOwners tracks the config entry each route path was generated for, so that routes registered twice can be reported rather
+// than the router silently serving only the first.
+type routeOwners map[string]string
+
+// claim records the owner of a path and reports whether the path was free, a collision is logged with both owners unless they
+// are the same device name, which entries has already reported.
+func (o routeOwners) claim(path string, owner string) bool {
+	if existing, ok := o[path]; ok {
+		if existing == owner {
+			return false
+		}
+		logging.Log(logging.Error, "Ignoring route \"%s\" of %s, it collides with the same route of %s", path, owner, existing)
+		return false
+	}
+	o[path] = owner
+	return true
+}
+
+// entries indexes config entries by device name, logging every name that is used by more than one entry.
+func entries(config *config.Config) map[string][]int {
+	indexes := map[string][]int{}
+	for i, c := range config.Devices {
+		name, ok := c.Config["name"].(string)
+		if !ok {
+			continue
+		}
+		if len(indexes[name]) > 0 {
+			logging.Log(logging.Error, "Device name \"%s\" is used by both %s and %s", name, describeEntry(config, indexes[name][0]), describeEntry(config, i))
+		}
+		indexes[name] = append(indexes[name], i)
+	}
+	return indexes
+}
+
+// describeEntry describes a config entry by its position and type, e.g. devices[3] (type meross).
+func describeEntry(config *config.Config, i int) string {
+	return fmt.Sprintf("devices[%d] (type %s)", i, config.Devices[i].Type)
+}
+
+// describeOwner describes what a route was generated for, the config entry of the named device or the device type for routes such
+// as base routes that are not for a single device. Entries sharing a name are told apart by the package of the device type.
+func describeOwner(config *config.Config, indexes map[string][]int, name string, d Device) string {
+	pkg := strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", d), "*"), ".Device")
+	candidates := indexes[name]
+	for _, i := range candidates {
+		if len(candidates) == 1 || config.Devices[i].Type == pkg {
+			return fmt.Sprintf("device \"%s\" in %s", name, describeEntry(config, i))
+		}
+	}
+	if len(candidates) > 0 {
+		return fmt.Sprintf("device \"%s\" of device type %s", name, pkg)
+	}
+	return fmt.Sprintf("device type %s", pkg)
+}
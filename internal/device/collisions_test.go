@@ -0,0 +1,71 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/meross"
+	"github.com/kennedn/restate-go/internal/device/meross_thermostat"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteOwners(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	owners := routeOwners{"/v2/classes": "restate"}
+
+	// The first owner of a path keeps it, later owners are turned away whether or not they are the same
+	assert.True(t, owners.claim("/v2/meross/lamp", `device "lamp" in devices[0] (type meross)`))
+	assert.False(t, owners.claim("/v2/meross/lamp", `device "lamp" in devices[0] (type meross)`))
+	assert.False(t, owners.claim("/v2/meross/lamp", `device "lamp" in devices[2] (type meross)`))
+	assert.False(t, owners.claim("/v2/classes", "device type meross"))
+	assert.Equal(t, `device "lamp" in devices[0] (type meross)`, owners["/v2/meross/lamp"])
+	assert.Equal(t, "restate", owners["/v2/classes"])
+}
+
+func TestDescribeOwner(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	c := &config.Config{Devices: []config.Devices{
+		{Type: "meross", Config: map[string]any{"name": "lamp"}},
+		{Type: "meross_thermostat", Config: map[string]any{"name": "lamp"}},
+		{Type: "meross", Config: map[string]any{"name": "plug"}},
+		{Type: "meross", Config: map[string]any{}},
+	}}
+	indexes := entries(c)
+	assert.Equal(t, map[string][]int{"lamp": {0, 1}, "plug": {2}}, indexes)
+
+	// Entries sharing a name are told apart by device type, routes not for a single device are owned by the type
+	assert.Equal(t, `device "plug" in devices[2] (type meross)`, describeOwner(c, indexes, "plug", &meross.Device{}))
+	assert.Equal(t, `device "lamp" in devices[0] (type meross)`, describeOwner(c, indexes, "lamp", &meross.Device{}))
+	assert.Equal(t, `device "lamp" in devices[1] (type meross_thermostat)`, describeOwner(c, indexes, "lamp", &meross_thermostat.Device{}))
+	assert.Equal(t, `device "plug" of device type meross_thermostat`, describeOwner(c, map[string][]int{"plug": {0, 2}}, "plug", &meross_thermostat.Device{}))
+	assert.Equal(t, "device type meross", describeOwner(c, indexes, "meross", &meross.Device{}))
+}
+
+func TestRoutesCollisions(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	c := &config.Config{ApiVersion: "v2", Devices: []config.Devices{
+		{Type: "meross", Config: map[string]any{"name": "lamp", "deviceType": "bulb", "host": "192.0.2.1"}},
+		{Type: "meross", Config: map[string]any{"name": "lamp", "deviceType": "socket", "host": "192.0.2.2"}},
+		{Type: "meross", Config: map[string]any{"name": "classes", "deviceType": "bulb", "host": "192.0.2.3"}},
+	}}
+
+	d := &Devices{}
+	routes, err := d.Routes(c)
+	if err != nil {
+		t.Fatalf("Routes returned an error: %v", err)
+	}
+
+	// Colliding routes are registered once rather than left for the router to pick between
+	paths := map[string]int{}
+	for _, r := range routes {
+		paths[r.Path]++
+	}
+	for p, n := range paths {
+		assert.Equal(t, 1, n, p)
+	}
+	assert.Contains(t, paths, "/v2/meross/lamp")
+	assert.Contains(t, paths, "/v2/meross/classes")
+	assert.Contains(t, paths, "/v2/classes")
+}
@@ -1,21 +1,49 @@
 package common
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/i18n"
 )
 
+// EnvelopeVersion is the version of the envelope every JSON response is wrapped in, incremented when its shape changes incompatibly.
+const EnvelopeVersion = 1
+
+// Response is the envelope of every JSON response. The message is always present and data is omitted when there is none. Responses
+// covering several devices list them as data itself, or under data.devices alongside the data.errors of devices that failed.
 type Response struct {
+	Version int    `json:"version" schema:"version"`
 	Message string `json:"message" schema:"message"`
 	Data    any    `json:"data,omitempty" schema:"data,omitempty"`
 }
 
+// NewResponse returns the envelope of a response, translating its message.
+func NewResponse(message string, data any) *Response {
+	return &Response{
+		Version: EnvelopeVersion,
+		Message: i18n.T(message),
+		Data:    data,
+	}
+}
+
 type Request struct {
 	Code  string      `json:"code"`
 	Value json.Number `json:"value,omitempty"`
 	Hosts string      `json:"hosts,omitempty"`
 }
 
+// Action describes a code/value request against another restate endpoint, allowing one device to drive another
+type Action struct {
+	URL   string `yaml:"url" json:"url"`
+	Code  string `yaml:"code" json:"code"`
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
 func JSONResponse(w http.ResponseWriter, httpCode int, jsonResponse []byte) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpCode)
@@ -24,9 +52,58 @@ func JSONResponse(w http.ResponseWriter, httpCode int, jsonResponse []byte) {
 
 func SetJSONResponse(code int, message string, data any) (int, []byte) {
 	httpCode := code
-	jsonResponse, _ := json.Marshal(&Response{
-		Message: message,
-		Data:    data,
-	})
+	jsonResponse, _ := json.Marshal(NewResponse(message, data))
 	return httpCode, jsonResponse
 }
+
+// Post sends the action to its URL as a JSON request and returns the decoded response
+func (a *Action) Post(timeout uint) (*Response, int, error) {
+	return a.PostContext(context.Background(), timeout)
+}
+
+// PostContext sends the action like Post with the context of a request, so that it is recorded rather than sent during a dry run. Status
+// actions only read state and are always sent.
+func (a *Action) PostContext(ctx context.Context, timeout uint) (*Response, int, error) {
+	client := &http.Client{
+		Timeout: time.Duration(timeout) * time.Millisecond,
+	}
+
+	// Values are always sent as strings, json.Number fields will still accept them if they are numeric
+	requestBytes, err := json.Marshal(struct {
+		Code  string `json:"code"`
+		Value string `json:"value,omitempty"`
+	}{
+		Code:  a.Code,
+		Value: a.Value,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if a.Code == "status" {
+		ctx = Read(ctx)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.URL, bytes.NewReader(requestBytes))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := Do(client, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	response := Response{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	return &response, resp.StatusCode, nil
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/schema"
+)
+
+var (
+	// ErrMalformedBody is returned by DecodeRequest for JSON bodies that cannot be decoded, its text is the response message.
+	ErrMalformedBody = errors.New("Malformed Or Empty JSON Body")
+	// ErrMalformedQuery is returned by DecodeRequest and DecodeQuery for query strings that cannot be decoded, its text is the response message.
+	ErrMalformedQuery = errors.New("Malformed or empty query string")
+)
+
+// Unknown parameters are rejected unless disabled in config
+var lenient = struct {
+	sync.RWMutex
+	enabled bool
+}{}
+
+// SetStrict sets whether requests containing unknown query parameters or JSON fields are rejected.
+func SetStrict(strict bool) {
+	lenient.Lock()
+	defer lenient.Unlock()
+	lenient.enabled = !strict
+}
+
+func strict() bool {
+	lenient.RLock()
+	defer lenient.RUnlock()
+	return !lenient.enabled
+}
+
+// DecodeRequest decodes a request's JSON body into request when it has a JSON content type and its query string otherwise.
+// The returned errors are ErrMalformedBody and ErrMalformedQuery, suitable for returning to the client with a 400.
+func DecodeRequest(r *http.Request, request any) error {
+	if r.Header.Get("Content-Type") != "application/json" {
+		return DecodeQuery(r.URL.Query(), request)
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if strict() {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(request); err != nil {
+		return ErrMalformedBody
+	}
+	return nil
+}
+
+// DecodeQuery decodes query parameters into request. Repeated parameters fill slice fields, and are joined with commas for string fields
+// so that e.g. hosts=a&hosts=b is the same as hosts=a,b.
+func DecodeQuery(values url.Values, request any) error {
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(!strict())
+	if err := decoder.Decode(request, joinRepeated(values, request)); err != nil {
+		return ErrMalformedQuery
+	}
+	return nil
+}
+
+// joinRepeated returns a copy of values with the repeated values of string fields in request joined with commas.
+func joinRepeated(values url.Values, request any) url.Values {
+	t := reflect.TypeOf(request)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return values
+	}
+
+	joined := url.Values{}
+	for key, v := range values {
+		joined[key] = v
+		if len(v) < 2 {
+			continue
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("schema"), ",")
+			if name == "" {
+				name = field.Name
+			}
+			if strings.EqualFold(name, key) && field.Type.Kind() == reflect.String {
+				joined[key] = []string{strings.Join(v, ",")}
+			}
+		}
+	}
+	return joined
+}
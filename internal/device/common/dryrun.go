@@ -0,0 +1,177 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in recorded calls
+const Redacted = "REDACTED"
+
+// Keys whose values are replaced when recording calls, matched case insensitively
+var secretKeys = []string{"token", "password", "secret", "sign", "key", "user", "auth"}
+
+// Call is an upstream request recorded during a dry run.
+type Call struct {
+	// Method is the HTTP method, or the protocol of calls not made over HTTP, e.g. UDP
+	Method  string `json:"method"`
+	URL     string `json:"url"`
+	Payload any    `json:"payload,omitempty"`
+}
+
+// DryRun collects the upstream calls a request would have made.
+type DryRun struct {
+	mutex sync.Mutex
+	calls []Call
+}
+
+type dryRunKey struct{}
+type readKey struct{}
+type writeKey struct{}
+
+// WithDryRun returns a context under which requests sent with Do are recorded rather than sent.
+func WithDryRun(ctx context.Context) (context.Context, *DryRun) {
+	d := &DryRun{}
+	return context.WithValue(ctx, dryRunKey{}, d), d
+}
+
+// DryRunning reports whether a context belongs to a dry run.
+func DryRunning(ctx context.Context) bool {
+	_, ok := ctx.Value(dryRunKey{}).(*DryRun)
+	return ok
+}
+
+// Read marks requests made with a context as read only, so that they are still sent during a dry run, e.g. to read the state a toggle depends on.
+func Read(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readKey{}, true)
+}
+
+// Write marks requests made with a context as changing state, so that they are recorded during a dry run even when sent as GETs, e.g. to APIs that
+// act on query parameters.
+func Write(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writeKey{}, true)
+}
+
+// Calls returns the calls recorded so far.
+func (d *DryRun) Calls() []Call {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]Call{}, d.calls...)
+}
+
+// Do sends a request with client, unless it was created with a dry run context, in which case it is recorded and an empty 200 response is returned
+// so that handlers carry on to the calls that would follow. GET requests not marked with Write and requests marked with Read are always sent.
+func Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	d, ok := req.Context().Value(dryRunKey{}).(*DryRun)
+	if !ok || (req.Method == http.MethodGet && req.Context().Value(writeKey{}) == nil) || req.Context().Value(readKey{}) != nil {
+		return client.Do(req)
+	}
+
+	call := Call{
+		Method: req.Method,
+		URL:    redactURL(req.URL),
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(body)
+			call.Payload = redactPayload(b)
+		}
+	}
+
+	d.mutex.Lock()
+	d.calls = append(d.calls, call)
+	d.mutex.Unlock()
+
+	return &http.Response{
+		Status:     http.StatusText(http.StatusOK),
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+// Record records a call made other than with Do, e.g. over a socket, when ctx belongs to a dry run, reporting whether it did so and the
+// call should be skipped. Calls made with a context marked with Read are never recorded.
+func Record(ctx context.Context, call Call) bool {
+	d, ok := ctx.Value(dryRunKey{}).(*DryRun)
+	if !ok || ctx.Value(readKey{}) != nil {
+		return false
+	}
+	switch payload := call.Payload.(type) {
+	case nil, string:
+	case []byte:
+		call.Payload = redactPayload(payload)
+	default:
+		if b, err := json.Marshal(payload); err == nil {
+			call.Payload = redactPayload(b)
+		}
+	}
+
+	d.mutex.Lock()
+	d.calls = append(d.calls, call)
+	d.mutex.Unlock()
+	return true
+}
+
+// secret reports whether a key names a secret.
+func secret(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL returns a URL with its password and secret query parameters replaced.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	if _, ok := redacted.User.Password(); ok {
+		redacted.User = url.UserPassword(redacted.User.Username(), Redacted)
+	}
+	query := redacted.Query()
+	for k := range query {
+		if secret(k) {
+			query.Set(k, Redacted)
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// redactPayload decodes a JSON payload with secret values replaced, other payloads are returned as a string.
+func redactPayload(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	var payload any
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return string(b)
+	}
+	return redactValue(payload)
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			if secret(k) {
+				v[k] = Redacted
+				continue
+			}
+			v[k] = redactValue(value)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return v
+}
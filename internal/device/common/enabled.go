@@ -0,0 +1,29 @@
+package common
+
+import "sync"
+
+// disabled tracks devices taken out of rotation at runtime, e.g. while they are being serviced
+var disabled = struct {
+	sync.RWMutex
+	names map[string]bool
+}{
+	names: map[string]bool{},
+}
+
+// Enabled reports whether a device is in rotation, devices are enabled unless disabled in config or via the admin API.
+func Enabled(name string) bool {
+	disabled.RLock()
+	defer disabled.RUnlock()
+	return !disabled.names[name]
+}
+
+// SetEnabled puts a device into or takes it out of rotation.
+func SetEnabled(name string, enabled bool) {
+	disabled.Lock()
+	defer disabled.Unlock()
+	if enabled {
+		delete(disabled.names, name)
+	} else {
+		disabled.names[name] = true
+	}
+}
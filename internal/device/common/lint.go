@@ -0,0 +1,167 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys read from every device config by the device registry rather than by the device itself
+var sharedKeys = []string{"timeoutMs"}
+
+// Problems found in device configs while loading them, reported at startup and by -validate
+var lints = struct {
+	sync.Mutex
+	problems []string
+}{}
+
+var unknownField = regexp.MustCompile(`line (\d+): field (\S+) not found in type (\S+)`)
+
+// UnmarshalConfig decodes a device config into v as yaml.Unmarshal does, additionally recording a lint problem for each key that
+// v does not know, e.g. a misspelled timoutMs, which would otherwise be silently ignored.
+func UnmarshalConfig(yamlConfig []byte, v any) error {
+	if err := yaml.Unmarshal(yamlConfig, v); err != nil {
+		return err
+	}
+
+	raw := map[string]any{}
+	yaml.Unmarshal(yamlConfig, &raw)
+	name, _ := raw["name"].(string)
+
+	top := reflect.TypeOf(v).Elem().String()
+	for _, u := range unknownKeys(yamlConfig, v) {
+		if u.parent == top && slices.Contains(sharedKeys, u.key) {
+			continue
+		}
+		problem := fmt.Sprintf("Unknown key \"%s\" in config of device \"%s\"", u.key, name)
+		if u.suggestion != "" {
+			problem += fmt.Sprintf(", did you mean \"%s\"?", u.suggestion)
+		}
+		lints.Lock()
+		lints.problems = append(lints.problems, problem)
+		lints.Unlock()
+	}
+	return nil
+}
+
+// LintConfig returns a problem for each unknown key in a config file, with its line number. Keys within device configs are checked by
+// UnmarshalConfig as each device is loaded.
+func LintConfig(configBytes []byte) []string {
+	problems := []string{}
+	for _, u := range unknownKeys(configBytes, &config.Config{}) {
+		problem := fmt.Sprintf("Unknown key \"%s\" on line %d", u.key, u.line)
+		if u.suggestion != "" {
+			problem += fmt.Sprintf(", did you mean \"%s\"?", u.suggestion)
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// unknownKey is a key that was not decoded into any field, along with the type it was found in and the known key it is likely a
+// typo of.
+type unknownKey struct {
+	key        string
+	line       int
+	parent     string
+	suggestion string
+}
+
+// unknownKeys strictly decodes data into a new value of v's type, returning the keys that it does not know.
+func unknownKeys(data []byte, v any) []unknownKey {
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	var typeErr *yaml.TypeError
+	if err := decoder.Decode(reflect.New(reflect.TypeOf(v).Elem()).Interface()); !errors.As(err, &typeErr) {
+		return nil
+	}
+
+	known := fieldNames(reflect.TypeOf(v), map[reflect.Type]bool{})
+	keys := []unknownKey{}
+	for _, e := range typeErr.Errors {
+		match := unknownField.FindStringSubmatch(e)
+		if match == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		keys = append(keys, unknownKey{key: match[2], line: line, parent: match[3], suggestion: closest(match[2], known)})
+	}
+	return keys
+}
+
+// TakeLints returns the problems found in device configs loaded since it was last called.
+func TakeLints() []string {
+	lints.Lock()
+	defer lints.Unlock()
+	problems := lints.problems
+	lints.problems = nil
+	return problems
+}
+
+// fieldNames returns the yaml keys of every struct reachable from t, which is where a misspelled key would have been meant to go.
+func fieldNames(t reflect.Type, seen map[reflect.Type]bool) []string {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name != "-" && name != "" && field.IsExported() {
+			names = append(names, name)
+		}
+		if name != "-" && (field.IsExported() || strings.Contains(opts, "inline")) {
+			names = append(names, fieldNames(field.Type, seen)...)
+		}
+	}
+	return names
+}
+
+// closest returns the known key nearest to key when it is likely a typo, a difference in case or at most two edits.
+func closest(key string, known []string) string {
+	best, bestDistance := "", 3
+	for _, k := range known {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+		if d := distance(strings.ToLower(key), strings.ToLower(k)); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// MerossDebugNamespace reports uptime and Wi-Fi details on every Meross device type
+const MerossDebugNamespace = "Appliance.System.Debug"
+
+// Meross devices only check that the from header is present
+const merossFrom = "http://10.10.10.1/config"
+
+// merossMessage is the envelope of every request sent to a Meross device.
+type merossMessage struct {
+	Header  merossHeader `json:"header"`
+	Payload any          `json:"payload"`
+}
+
+type merossHeader struct {
+	From           string `json:"from"`
+	MessageID      string `json:"messageId"`
+	Method         string `json:"method"`
+	Namespace      string `json:"namespace"`
+	PayloadVersion int64  `json:"payloadVersion"`
+	Sign           string `json:"sign"`
+	Timestamp      int64  `json:"timestamp"`
+}
+
+// MerossMessage marshals a signed request for a namespace, wrapping payload in the envelope expected by Meross devices.
+func MerossMessage(messageId string, method string, namespace string, sign string, payload any) ([]byte, error) {
+	return json.Marshal(merossMessage{
+		Header: merossHeader{
+			From:           merossFrom,
+			MessageID:      messageId,
+			Method:         method,
+			Namespace:      namespace,
+			PayloadVersion: 1,
+			Sign:           sign,
+		},
+		Payload: payload,
+	})
+}
+
+// MerossInfo is the hardware, firmware and network information reported by a Meross device.
+type MerossInfo struct {
+	Type     string `json:"type,omitempty"`
+	Hardware string `json:"hardware,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	MAC      string `json:"mac,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Uptime   string `json:"uptime,omitempty"`
+	SSID     string `json:"ssid,omitempty"`
+	Signal   *int64 `json:"signal,omitempty"`
+}
+
+// merossError is the error payload returned by a Meross device in place of the requested namespace.
+type merossError struct {
+	Code   int64  `json:"code,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// rawMerossAll represents the system section of an Appliance.System.All response.
+type rawMerossAll struct {
+	Payload struct {
+		Error merossError `json:"error,omitempty"`
+		All   struct {
+			System struct {
+				Hardware struct {
+					Type       string `json:"type"`
+					Version    string `json:"version"`
+					MacAddress string `json:"macAddress"`
+				} `json:"hardware"`
+				Firmware struct {
+					Version string `json:"version"`
+					InnerIp string `json:"innerIp"`
+				} `json:"firmware"`
+			} `json:"system"`
+		} `json:"all"`
+	} `json:"payload"`
+}
+
+// rawMerossDebug represents an Appliance.System.Debug response.
+type rawMerossDebug struct {
+	Payload struct {
+		Error merossError `json:"error,omitempty"`
+		Debug struct {
+			System struct {
+				SysUpTime string `json:"sysUpTime"`
+			} `json:"system"`
+			Network struct {
+				SSID   string `json:"ssid"`
+				Signal *int64 `json:"signal"`
+			} `json:"network"`
+		} `json:"debug"`
+	} `json:"payload"`
+}
+
+// ParseMerossInfo builds device info from an Appliance.System.All response and an optional Appliance.System.Debug response.
+// Older firmware does not implement the debug namespace, so a missing or failed debug response only omits uptime and signal.
+func ParseMerossInfo(all []byte, debug []byte) (*MerossInfo, error) {
+	rawAll := rawMerossAll{}
+	if err := json.Unmarshal(all, &rawAll); err != nil {
+		return nil, err
+	}
+	if rawAll.Payload.Error.Code != 0 {
+		return nil, errors.New(rawAll.Payload.Error.Detail)
+	}
+
+	system := rawAll.Payload.All.System
+	info := MerossInfo{
+		Type:     system.Hardware.Type,
+		Hardware: system.Hardware.Version,
+		Firmware: system.Firmware.Version,
+		MAC:      system.Hardware.MacAddress,
+		IP:       system.Firmware.InnerIp,
+	}
+
+	rawDebug := rawMerossDebug{}
+	if len(debug) != 0 && json.Unmarshal(debug, &rawDebug) == nil && rawDebug.Payload.Error.Code == 0 {
+		info.Uptime = rawDebug.Payload.Debug.System.SysUpTime
+		info.SSID = rawDebug.Payload.Debug.Network.SSID
+		info.Signal = rawDebug.Payload.Debug.Network.Signal
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+)
+
+// Failure is a device that failed within a request covering several devices, with the status code and reason a request to the device
+// alone would have failed with, so that callers can retry just the failed devices.
+type Failure struct {
+	Name  string `json:"name"`
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+// NewFailure describes why a device failed, requests that timed out are 504 and anything else 500.
+func NewFailure(name string, err error) Failure {
+	code := http.StatusInternalServerError
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		code = http.StatusGatewayTimeout
+	}
+	failure := Failure{Name: name, Code: code, Error: http.StatusText(code)}
+	if err != nil {
+		failure.Error = err.Error()
+	}
+	return failure
+}
+
+// multiStatus is the data of a response covering several devices, the data of the devices that succeeded alongside the failures.
+type multiStatus struct {
+	Devices any       `json:"devices,omitempty"`
+	Errors  []Failure `json:"errors,omitempty"`
+}
+
+// SetMultiStatusResponse returns the response to a request covering several devices, of which succeeded did not fail. It is 200 when
+// none failed, 207 when some failed and the code shared by the failures, or 500, when all failed. Failures are listed under
+// data.errors, alongside devices under data.devices when it is not nil, e.g. the statuses read.
+func SetMultiStatusResponse(succeeded int, devices any, failures []Failure) (int, []byte) {
+	// A nil slice of devices would otherwise be listed as null
+	if v := reflect.ValueOf(devices); v.Kind() == reflect.Slice && v.Len() == 0 {
+		devices = nil
+	}
+	if len(failures) == 0 && devices == nil {
+		return SetJSONResponse(http.StatusOK, "OK", nil)
+	}
+
+	code := http.StatusOK
+	if len(failures) > 0 && succeeded > 0 {
+		code = http.StatusMultiStatus
+	} else if len(failures) > 0 {
+		code = failures[0].Code
+		for _, f := range failures {
+			if f.Code != code {
+				code = http.StatusInternalServerError
+			}
+		}
+	}
+	return SetJSONResponse(code, http.StatusText(code), &multiStatus{Devices: devices, Errors: failures})
+}
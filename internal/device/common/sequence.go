@@ -0,0 +1,46 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type sequenceKey struct{}
+
+// WithSequence returns a context under which the writes of a multi-device request are sent to one device at a time, in the order of
+// its hosts, waiting delay between devices.
+func WithSequence(ctx context.Context, delay time.Duration) context.Context {
+	return context.WithValue(ctx, sequenceKey{}, delay)
+}
+
+// Each calls send for each of n devices of a multi-device request and returns once every call has returned. Calls are made in parallel
+// unless they write to the devices of a request with a sequence, in which case each waits for the previous one and the delay. The delay
+// is skipped during a dry run and once ctx is done, so that the remaining calls fail rather than wait.
+func Each(ctx context.Context, n int, write bool, send func(i int)) {
+	delay, ok := ctx.Value(sequenceKey{}).(time.Duration)
+	if !ok || !write {
+		wg := sync.WaitGroup{}
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				send(i)
+			}(i)
+		}
+		wg.Wait()
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		if i > 0 && delay > 0 && !DryRunning(ctx) {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		send(i)
+	}
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEach(t *testing.T) {
+	var mutex sync.Mutex
+	steps := []int{}
+	running, overlapped := 0, false
+	send := func(i int) {
+		mutex.Lock()
+		running++
+		overlapped = overlapped || running > 1
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		steps = append(steps, i)
+		mutex.Unlock()
+	}
+	reset := func() {
+		steps, overlapped = []int{}, false
+	}
+
+	// Writes in a sequence are sent one at a time in order, waiting the delay between each
+	start := time.Now()
+	Each(WithSequence(context.Background(), 20*time.Millisecond), 3, true, send)
+	assert.Equal(t, []int{0, 1, 2}, steps)
+	assert.False(t, overlapped)
+	assert.GreaterOrEqual(t, time.Since(start), 2*20*time.Millisecond+3*10*time.Millisecond)
+
+	// Reads, and writes outside of a sequence, are sent at once
+	reset()
+	Each(WithSequence(context.Background(), time.Second), 3, false, send)
+	assert.ElementsMatch(t, []int{0, 1, 2}, steps)
+	assert.True(t, overlapped)
+	reset()
+	Each(context.Background(), 3, true, send)
+	assert.True(t, overlapped)
+
+	// Dry runs do not wait between devices
+	reset()
+	ctx, _ := WithDryRun(context.Background())
+	start = time.Now()
+	Each(WithSequence(ctx, time.Second), 3, true, send)
+	assert.Equal(t, []int{0, 1, 2}, steps)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestEachAborted(t *testing.T) {
+	// A request that fails part way, e.g. by running out of time, stops waiting and the remaining devices are sent to in order straight
+	// away, so that each fails with the context rather than holding up the response
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := []error{}
+	start := time.Now()
+	Each(WithSequence(ctx, 200*time.Millisecond), 4, true, func(i int) {
+		errs = append(errs, ctx.Err())
+		if i == 1 {
+			cancel()
+		}
+	})
+	assert.Less(t, time.Since(start), 2*200*time.Millisecond)
+	assert.Equal(t, []error{nil, nil, context.Canceled, context.Canceled}, errs)
+}
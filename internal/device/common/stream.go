@@ -0,0 +1,63 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// NDJSONContentType is accepted by multi-device handlers that can stream the result of each device as it completes
+const NDJSONContentType = "application/x-ndjson"
+
+// Streaming reports whether a request accepts newline delimited JSON, asking for the results of a multi-device operation to be streamed.
+func Streaming(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			if t, _, err := mime.ParseMediaType(mediaType); err == nil && t == NDJSONContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NDJSONWriter writes values to a response as newline delimited JSON, flushing each line to the client as soon as it is written.
+type NDJSONWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	encoder    *json.Encoder
+	started    bool
+}
+
+// NewNDJSONWriter returns an NDJSONWriter that writes to w, the response is started with a 200 on the first write.
+func NewNDJSONWriter(w http.ResponseWriter) *NDJSONWriter {
+	return &NDJSONWriter{
+		w:          w,
+		controller: http.NewResponseController(w),
+		encoder:    json.NewEncoder(w),
+	}
+}
+
+// Write writes v as a single line and flushes it to the client.
+func (n *NDJSONWriter) Write(v any) error {
+	if !n.started {
+		n.w.Header().Set("Content-Type", NDJSONContentType)
+		n.w.WriteHeader(http.StatusOK)
+		n.started = true
+	}
+	if err := n.encoder.Encode(v); err != nil {
+		return err
+	}
+	// Writers that cannot flush, e.g. recorders, still receive every line
+	if err := n.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// Started reports whether anything has been written, after which the response can no longer be replaced with an error.
+func (n *NDJSONWriter) Started() bool {
+	return n.started
+}
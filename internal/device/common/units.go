@@ -0,0 +1,136 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Temperature units accepted by the units option, leaving units unset keeps raw Meross tenths of a degree Celsius
+const (
+	Celsius    = "celsius"
+	Fahrenheit = "fahrenheit"
+)
+
+// ValidUnits reports whether units is unset or a supported temperature unit.
+func ValidUnits(units string) bool {
+	return units == "" || units == Celsius || units == Fahrenheit
+}
+
+// UnitSymbol returns the short form of a temperature unit, or an empty string for raw values.
+func UnitSymbol(units string) string {
+	switch units {
+	case Celsius:
+		return "C"
+	case Fahrenheit:
+		return "F"
+	}
+	return ""
+}
+
+// Temperature converts tenths of a degree Celsius into units, rounded to one decimal place.
+func Temperature(tenths int64, units string) json.Number {
+	var value float64
+	switch units {
+	case Celsius:
+		value = float64(tenths) / 10
+	case Fahrenheit:
+		value = float64(tenths)/10*9/5 + 32
+	default:
+		return json.Number(strconv.FormatInt(tenths, 10))
+	}
+	return json.Number(strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64))
+}
+
+// TemperatureDelta converts a difference in tenths of a degree Celsius into units, rounded to one decimal place.
+func TemperatureDelta(tenths int64, units string) json.Number {
+	if units != Fahrenheit {
+		return Temperature(tenths, units)
+	}
+	return json.Number(strconv.FormatFloat(math.Round(float64(tenths)*9/5)/10, 'f', -1, 64))
+}
+
+// ParseTemperature converts a temperature given in units into tenths of a degree Celsius, raw values must be whole numbers.
+func ParseTemperature(value json.Number, units string) (int64, error) {
+	if units == "" {
+		return value.Int64()
+	}
+
+	degrees, err := value.Float64()
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(degrees) || math.IsInf(degrees, 0) {
+		return 0, fmt.Errorf("invalid temperature %s", value)
+	}
+
+	if units == Fahrenheit {
+		degrees = (degrees - 32) * 5 / 9
+	}
+	return int64(math.Round(degrees * 10)), nil
+}
+
+// ParseTemperatureDelta converts a temperature difference given in units into tenths of a degree Celsius.
+func ParseTemperatureDelta(value json.Number, units string) (int64, error) {
+	if units != Fahrenheit {
+		return ParseTemperature(value, units)
+	}
+
+	degrees, err := value.Float64()
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(degrees) || math.IsInf(degrees, 0) {
+		return 0, fmt.Errorf("invalid temperature %s", value)
+	}
+	return int64(math.Round(degrees * 5 / 9 * 10)), nil
+}
+
+// Limits bounds a temperature setpoint in tenths of a degree Celsius, unset bounds are not enforced.
+type Limits struct {
+	Min *int64
+	Max *int64
+}
+
+// NewLimits parses minimum and maximum setpoints given in units, either may be empty.
+func NewLimits(min json.Number, max json.Number, units string) (*Limits, error) {
+	limits := Limits{}
+	if min != "" {
+		tenths, err := ParseTemperature(min, units)
+		if err != nil {
+			return nil, err
+		}
+		limits.Min = &tenths
+	}
+	if max != "" {
+		tenths, err := ParseTemperature(max, units)
+		if err != nil {
+			return nil, err
+		}
+		limits.Max = &tenths
+	}
+
+	if limits.Min != nil && limits.Max != nil && *limits.Min > *limits.Max {
+		return nil, fmt.Errorf("minimum %s is above maximum %s", min, max)
+	}
+	return &limits, nil
+}
+
+// Allows reports whether a setpoint in tenths of a degree Celsius is within the limits.
+func (l *Limits) Allows(tenths int64) bool {
+	return (l.Min == nil || tenths >= *l.Min) && (l.Max == nil || tenths <= *l.Max)
+}
+
+// String describes the limits in units for error messages.
+func (l *Limits) String(units string) string {
+	bounds := []string{}
+	if l.Min != nil {
+		bounds = append(bounds, "Min: "+Temperature(*l.Min, units).String())
+	}
+	if l.Max != nil {
+		bounds = append(bounds, "Max: "+Temperature(*l.Max, units).String())
+	}
+	return strings.Join(bounds, ", ")
+}
@@ -0,0 +1,52 @@
+package common
+
+// Strategies accepted by the vote option, deciding the state a group toggle without a value switches its devices to. Leaving vote
+// unset keeps the majority vote
+const (
+	// Devices are switched on unless most of them are on
+	VoteMajority = "majority"
+	// Devices are switched off if any of them is on
+	VoteAny = "any"
+	// Devices are switched to the opposite of the first device of the group
+	VoteFirst = "first"
+	// Devices are always switched on or off, without reading their state
+	VoteOn  = "on"
+	VoteOff = "off"
+)
+
+// ValidVote reports whether strategy is unset or a supported vote strategy.
+func ValidVote(strategy string) bool {
+	switch strategy {
+	case "", VoteMajority, VoteAny, VoteFirst, VoteOn, VoteOff:
+		return true
+	}
+	return false
+}
+
+// VoteNeedsState reports whether a strategy decides from the current state of the devices.
+func VoteNeedsState(strategy string) bool {
+	return strategy != VoteOn && strategy != VoteOff
+}
+
+// Vote returns whether a group toggle switches its devices on, given whether each device is currently on in the order of the hosts
+// of the request.
+func Vote(strategy string, states []bool) bool {
+	on := 0
+	for _, s := range states {
+		if s {
+			on++
+		}
+	}
+
+	switch strategy {
+	case VoteAny:
+		return on == 0
+	case VoteFirst:
+		return len(states) == 0 || !states[0]
+	case VoteOn:
+		return true
+	case VoteOff:
+		return false
+	}
+	return on <= len(states)/2
+}
@@ -0,0 +1,201 @@
+package common
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// Echo requests are identified by the process, replies to other processes on the same raw socket are ignored
+var echoID = os.Getpid() & 0xffff
+
+// EchoRequest returns an ICMP echo request identifying this process.
+func EchoRequest() ([]byte, error) {
+	message := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:  echoID,
+			Seq: 1,
+		},
+	}
+	return message.Marshal(nil)
+}
+
+// MagicPacket returns the wake-on-lan payload of a MAC address.
+func MagicPacket(mac string) ([]byte, error) {
+	macAddress, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(macAddress) != 6 {
+		return nil, errors.New("Invalid hardware address")
+	}
+
+	// 6 * 0xff (6 bytes) + 6 * macAddress (96 bytes) = 102
+	payload := make([]byte, 102)
+
+	// Set first 6 bytes to 0xFF
+	for i := 0; i < 6; i++ {
+		payload[i] = 0xFF
+	}
+
+	// Place 16 copies of macAddress (6 bytes) at offset i*6+6
+	for i := 0; i < 16; i++ {
+		copy(payload[i*6+6:i*6+12], macAddress)
+	}
+
+	return payload, nil
+}
+
+// SendPacket writes a UDP payload, such as a magic packet, to addr over a socket shared by every device.
+func SendPacket(payload []byte, addr net.Addr, timeout time.Duration) error {
+	return packets.send(payload, addr, timeout)
+}
+
+// Ping sends an echo request to addr over a socket shared by every device and waits up to timeout for a reply, returning a timeout
+// net.Error if none arrives.
+func Ping(addr *net.IPAddr, timeout time.Duration) error {
+	message, err := EchoRequest()
+	if err != nil {
+		return err
+	}
+	return pings.ping(message, addr, timeout)
+}
+
+// sender shares a single UDP socket between packets, rather than opening one per request.
+type sender struct {
+	mutex sync.Mutex
+	conn  net.PacketConn
+}
+
+// send writes a payload to addr, opening the socket if it is not open yet. The socket is reopened on the next send after a failure.
+func (s *sender) send(payload []byte, addr net.Addr, timeout time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.ListenPacket("udp4", ":0")
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := s.conn.WriteTo(payload, addr); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// pinger shares a single ICMP socket between pings, delivering each echo reply to the pings waiting on the address it came from.
+type pinger struct {
+	mutex   sync.Mutex
+	conn    net.PacketConn
+	waiting map[string][]chan struct{}
+}
+
+// open returns the shared socket, opening it and starting to read replies if it is not open yet.
+func (p *pinger) open() (net.PacketConn, error) {
+	if p.conn != nil {
+		return p.conn, nil
+	}
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	p.conn = conn
+	p.waiting = map[string][]chan struct{}{}
+	go p.read(conn)
+	return conn, nil
+}
+
+// read delivers echo replies until the socket fails, after which it is reopened by the next ping.
+func (p *pinger) read(conn net.PacketConn) {
+	buffer := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buffer)
+		if err != nil {
+			p.mutex.Lock()
+			if p.conn == conn {
+				p.conn = nil
+			}
+			p.mutex.Unlock()
+			conn.Close()
+			return
+		}
+
+		message, err := icmp.ParseMessage(1, buffer[:n])
+		if err != nil || message.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := message.Body.(*icmp.Echo); !ok || echo.ID != echoID {
+			continue
+		}
+
+		p.mutex.Lock()
+		for _, c := range p.waiting[peer.String()] {
+			close(c)
+		}
+		delete(p.waiting, peer.String())
+		p.mutex.Unlock()
+	}
+}
+
+// ping sends an echo request to addr and waits up to timeout for a reply, returning a timeout net.Error if none arrives.
+func (p *pinger) ping(message []byte, addr *net.IPAddr, timeout time.Duration) error {
+	reply := make(chan struct{})
+
+	p.mutex.Lock()
+	conn, err := p.open()
+	if err != nil {
+		p.mutex.Unlock()
+		return err
+	}
+	p.waiting[addr.String()] = append(p.waiting[addr.String()], reply)
+	p.mutex.Unlock()
+
+	if _, err := conn.WriteTo(message, addr); err != nil {
+		p.forget(addr, reply)
+		return err
+	}
+
+	select {
+	case <-reply:
+		return nil
+	case <-time.After(timeout):
+		p.forget(addr, reply)
+		return &net.OpError{Op: "read", Net: "ip4:icmp", Addr: addr, Err: os.ErrDeadlineExceeded}
+	}
+}
+
+// forget stops waiting for a reply from addr.
+func (p *pinger) forget(addr *net.IPAddr, reply chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	waiting := p.waiting[addr.String()]
+	for i, c := range waiting {
+		if c == reply {
+			p.waiting[addr.String()] = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(p.waiting[addr.String()]) == 0 {
+		delete(p.waiting, addr.String())
+	}
+}
+
+// Sockets shared by every device
+var (
+	packets = &sender{}
+	pings   = &pinger{}
+)
@@ -0,0 +1,51 @@
+package device
+
+import (
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+)
+
+// Device types radiators were configured as before being consolidated under the radiator type, meross devices were radiators when
+// their deviceType was one of radiatorDeviceTypes
+var radiatorDeviceTypes = map[string]bool{
+	"radiator": true,
+	"msh300hk": true,
+	"mts100v3": true,
+}
+
+// migrate rewrites device entries using deprecated types or config shapes to their current form before routes are built, logging a
+// deprecation warning for each so that existing configs keep working while they are updated.
+func migrate(config *config.Config) {
+	for i, c := range config.Devices {
+		name, _ := c.Config["name"].(string)
+		deviceType, _ := c.Config["deviceType"].(string)
+
+		switch {
+		case c.Type == "meross_radiator":
+			logging.Log(logging.Info, "Device \"%s\" uses deprecated type \"meross_radiator\", use \"radiator\" instead", name)
+		case c.Type == "meross" && radiatorDeviceTypes[deviceType]:
+			logging.Log(logging.Info, "Device \"%s\" uses deprecated type \"meross\" with deviceType \"%s\", use type \"radiator\" with deviceType \"radiator\" instead", name, deviceType)
+		default:
+			continue
+		}
+
+		migrated := map[string]any{}
+		for k, v := range c.Config {
+			migrated[k] = v
+		}
+		if deviceType != "" {
+			migrated["deviceType"] = "radiator"
+		}
+		// Radiators were addressed by subdeviceId, as the hub names them, before settling on id
+		if id, ok := migrated["subdeviceId"]; ok {
+			logging.Log(logging.Info, "Device \"%s\" uses deprecated parameter \"subdeviceId\", use \"id\" instead", name)
+			if _, ok := migrated["id"]; !ok {
+				migrated["id"] = id
+			}
+			delete(migrated, "subdeviceId")
+		}
+
+		config.Devices[i].Type = "radiator"
+		config.Devices[i].Config = migrated
+	}
+}
@@ -0,0 +1,69 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name     string
+		device   config.Devices
+		expected config.Devices
+	}{
+		{
+			name:     "meross_radiator",
+			device:   config.Devices{Type: "meross_radiator", Config: map[string]any{"name": "lounge", "subdeviceId": "1a2b"}},
+			expected: config.Devices{Type: "radiator", Config: map[string]any{"name": "lounge", "id": "1a2b"}},
+		},
+		{
+			name:     "meross_radiator_with_device_type",
+			device:   config.Devices{Type: "meross_radiator", Config: map[string]any{"name": "lounge", "deviceType": "mts100v3", "id": "1a2b"}},
+			expected: config.Devices{Type: "radiator", Config: map[string]any{"name": "lounge", "deviceType": "radiator", "id": "1a2b"}},
+		},
+		{
+			name:     "meross_radiator_device_type",
+			device:   config.Devices{Type: "meross", Config: map[string]any{"name": "hall", "deviceType": "radiator", "subdeviceId": "3c4d"}},
+			expected: config.Devices{Type: "radiator", Config: map[string]any{"name": "hall", "deviceType": "radiator", "id": "3c4d"}},
+		},
+		{
+			name:     "meross_hub_device_type",
+			device:   config.Devices{Type: "meross", Config: map[string]any{"name": "hall", "deviceType": "msh300hk", "subdeviceId": "3c4d"}},
+			expected: config.Devices{Type: "radiator", Config: map[string]any{"name": "hall", "deviceType": "radiator", "id": "3c4d"}},
+		},
+		{
+			name:     "id_preferred_over_subdevice_id",
+			device:   config.Devices{Type: "meross", Config: map[string]any{"name": "hall", "deviceType": "radiator", "id": "5e6f", "subdeviceId": "3c4d"}},
+			expected: config.Devices{Type: "radiator", Config: map[string]any{"name": "hall", "deviceType": "radiator", "id": "5e6f"}},
+		},
+		{
+			name:     "meross_bulb_unchanged",
+			device:   config.Devices{Type: "meross", Config: map[string]any{"name": "lamp", "deviceType": "bulb"}},
+			expected: config.Devices{Type: "meross", Config: map[string]any{"name": "lamp", "deviceType": "bulb"}},
+		},
+		{
+			name:     "radiator_unchanged",
+			device:   config.Devices{Type: "radiator", Config: map[string]any{"name": "lounge", "id": "1a2b"}},
+			expected: config.Devices{Type: "radiator", Config: map[string]any{"name": "lounge", "id": "1a2b"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := map[string]any{}
+			for k, v := range tc.device.Config {
+				original[k] = v
+			}
+			c := &config.Config{Devices: []config.Devices{tc.device}}
+			migrate(c)
+			assert.Equal(t, tc.expected, c.Devices[0])
+			// The parsed config is left as it was, in case it is shared
+			assert.Equal(t, original, tc.device.Config)
+		})
+	}
+}
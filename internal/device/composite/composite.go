@@ -0,0 +1,314 @@
+// Package composite provides logical devices whose codes are mapped onto other devices, including other composites.
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// member is a single step of a composite code, either an action against another device or a code of another composite.
+type member struct {
+	device.Action `yaml:",inline"`
+	Composite     string `yaml:"composite"`
+}
+
+// statusMember names a member whose status is included in the aggregated status.
+type statusMember struct {
+	member `yaml:",inline"`
+	Name   string `yaml:"name"`
+}
+
+// composite represents a logical device configuration with name, code mappings and status members.
+type composite struct {
+	Name    string               `yaml:"name"`
+	Timeout uint                 `yaml:"timeoutMs"`
+	Codes   map[string][]*member `yaml:"codes"`
+	Status  []*statusMember      `yaml:"status"`
+	Base    *base
+}
+
+// base represents a list of composites
+type base struct {
+	Devices []*composite
+}
+
+type Device struct{}
+
+// DryRun previews the member actions a request would post, including those of nested composites.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for composites based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts composite devices from config, resolving references between composites once all are known, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+	candidates := []*composite{}
+
+	for _, d := range config.Devices {
+		if d.Type != "composite" {
+			continue
+		}
+		composite := composite{
+			Base: &base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &composite); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if composite.Name == "" || composite.Timeout == 0 || (len(composite.Codes) == 0 && len(composite.Status) == 0) {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		candidates = append(candidates, &composite)
+	}
+
+	// References can only be checked once every composite is known
+	byName := map[string]*composite{}
+	for _, c := range candidates {
+		byName[c.Name] = c
+	}
+
+	for _, c := range candidates {
+		if err := c.resolve(byName, []string{}); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", c.Name, err)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + c.Name,
+			Handler: c.handler,
+		})
+
+		base.Devices = append(base.Devices, c)
+
+		logging.Log(logging.Info, "Found device \"%s\"", c.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/composite" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/composite",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/composite/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// resolve walks every composite reachable from c, failing on unknown references, unknown codes or cycles.
+func (c *composite) resolve(byName map[string]*composite, path []string) error {
+	for _, name := range path {
+		if name == c.Name {
+			return fmt.Errorf("cyclic reference %v", append(path, c.Name))
+		}
+	}
+	path = append(path, c.Name)
+
+	members := []*member{}
+	for _, m := range c.Codes {
+		members = append(members, m...)
+	}
+	for _, s := range c.Status {
+		members = append(members, &s.member)
+	}
+
+	for _, m := range members {
+		if m.Composite == "" {
+			if m.URL == "" || m.Code == "" {
+				return errors.New("member is missing url or code")
+			}
+			continue
+		}
+
+		target, ok := byName[m.Composite]
+		if !ok {
+			return fmt.Errorf("unknown composite \"%s\"", m.Composite)
+		}
+		if _, ok := target.Codes[m.Code]; !ok && m.Code != "status" {
+			return fmt.Errorf("composite \"%s\" has no code \"%s\"", m.Composite, m.Code)
+		}
+		if err := target.resolve(byName, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns a loaded composite by name.
+func (b *base) lookup(name string) *composite {
+	for _, d := range b.Devices {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// execute runs a member, recursing into other composites, and returns the data of the response.
+func (c *composite) execute(ctx context.Context, m *member) (any, error) {
+	if m.Composite != "" {
+		target := c.Base.lookup(m.Composite)
+		if target == nil {
+			return nil, fmt.Errorf("composite \"%s\" is not loaded", m.Composite)
+		}
+		if m.Code == "status" && len(target.Codes["status"]) == 0 {
+			return target.status(ctx)
+		}
+		return nil, target.run(ctx, m.Code)
+	}
+
+	response, code, err := m.PostContext(ctx, c.Timeout)
+	if err != nil {
+		return nil, err
+	} else if code != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d from %s", code, m.URL)
+	}
+	return response.Data, nil
+}
+
+// run executes each member of a code in order, continuing past failures so one offline device does not block the rest.
+func (c *composite) run(ctx context.Context, code string) error {
+	var errs []error
+	for _, m := range c.Codes[code] {
+		if _, err := c.execute(ctx, m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// status aggregates the status of each status member keyed by name, failed members are reported as null. Members are read even during a
+// dry run, whatever their code.
+func (c *composite) status(ctx context.Context) (map[string]any, error) {
+	ctx = device.Read(ctx)
+	status := map[string]any{}
+	for _, s := range c.Status {
+		data, err := c.execute(ctx, &s.member)
+		if err != nil {
+			logging.Log(logging.Error, "Composite \"%s\" failed to get status of \"%s\": %v", c.Name, s.Name, err)
+		}
+		status[s.Name] = data
+	}
+	return status, nil
+}
+
+// getCodes returns a sorted list of control codes for a composite.
+func (c *composite) getCodes() []string {
+	codes := []string{}
+	for code := range c.Codes {
+		codes = append(codes, code)
+	}
+	if _, ok := c.Codes["status"]; !ok && len(c.Status) > 0 {
+		codes = append(codes, "status")
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Handler is the HTTP handler for composite control.
+func (c *composite) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", c.getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	if _, ok := c.Codes[request.Code]; ok {
+		err = c.run(r.Context(), request.Code)
+	} else if request.Code == "status" && len(c.Status) > 0 {
+		data, err = c.status(r.Context())
+	} else {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all composites in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured composites.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,249 @@
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read composite input")
+	}
+
+	compositeConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &compositeConfig); err != nil {
+		t.Fatalf("Could not read composite input")
+	}
+	return &compositeConfig
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/compositeConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/compositeConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/compositeConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/compositeConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/compositeConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		data             string
+		expectedCode     int
+		expectedBody     string
+		expectedRequests []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/composite/cinema",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["off","on","status"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/composite/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["cinema","lights"]}`,
+		},
+		{
+			name:             "on_resolves_nested_composite",
+			method:           "POST",
+			url:              "/composite/cinema",
+			data:             `{"code":"on"}`,
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{"/tv power:1", "/avr power:1", "/lamp toggle:0"},
+		},
+		{
+			name:             "status_aggregates_members",
+			method:           "POST",
+			url:              "/composite/cinema?code=status",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK","data":{"lights":{"lamp":{"onoff":1}},"tv":"on"}}`,
+			expectedRequests: []string{"/tv status:", "/lamp status:"},
+		},
+		{
+			name:             "off_continues_past_failure",
+			method:           "POST",
+			url:              "/composite/cinema?code=off",
+			expectedCode:     500,
+			expectedBody:     `{"version":1,"message":"Internal Server Error"}`,
+			expectedRequests: []string{"/tv power:0", "/avr power:0"},
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/composite/cinema?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/composite/cinema",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/composite/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	var mutex sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		received = append(received, r.URL.Path+" "+request.Code+":"+request.Value.String())
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/avr" && request.Value.String() == "0":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"version":1,"message":"Internal Server Error"}`))
+		case r.URL.Path == "/tv" && request.Code == "status":
+			w.Write([]byte(`{"version":1,"message":"OK","data":"on"}`))
+		case r.URL.Path == "/lamp" && request.Code == "status":
+			w.Write([]byte(`{"version":1,"message":"OK","data":{"onoff":1}}`))
+		default:
+			w.Write([]byte(`{"version":1,"message":"OK"}`))
+		}
+	}))
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/compositeConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		members := []*member{}
+		for _, m := range d.Codes {
+			members = append(members, m...)
+		}
+		for _, s := range d.Status {
+			members = append(members, &s.member)
+		}
+		for _, m := range members {
+			if m.URL != "" {
+				m.URL = server.URL + m.URL[strings.LastIndex(m.URL, "/"):]
+			}
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = []string{}
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedRequests != nil {
+				assert.Equal(t, tc.expectedRequests, received)
+			}
+		})
+	}
+
+	t.Run("dry_run_records_nested_members", func(t *testing.T) {
+		received = []string{}
+		ctx, run := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/composite/cinema?code=on", nil).WithContext(ctx))
+		assert.Equal(t, `{"version":1,"message":"OK"}`, recorder.Body.String())
+		assert.Empty(t, received)
+		urls := []string{}
+		for _, c := range run.Calls() {
+			urls = append(urls, strings.TrimPrefix(c.URL, server.URL))
+		}
+		assert.Equal(t, []string{"/tv", "/avr", "/lamp"}, urls)
+	})
+}
@@ -0,0 +1,94 @@
+package computer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// agent controls a computer through an HTTP agent running on it.
+type agent struct {
+	URL     string        `yaml:"url"`
+	Token   config.Secret `yaml:"token"`
+	timeout uint
+}
+
+// call sends a request to an agent endpoint, encoding body as JSON and decoding the response into v when provided.
+func (a *agent) call(ctx context.Context, method string, endpoint string, body any, response any) error {
+	client := &http.Client{
+		Timeout: time.Duration(a.timeout) * time.Millisecond,
+	}
+
+	var reader io.Reader
+	if body != nil {
+		requestBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(a.URL, "/")+"/"+endpoint, reader)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token.Value())
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent returned status code %d for %s", resp.StatusCode, endpoint)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(responseBytes, response)
+}
+
+// metrics retrieves the current metrics of the computer.
+func (a *agent) metrics(ctx context.Context) (*metrics, error) {
+	metrics := metrics{}
+	if err := a.call(ctx, "GET", "status", nil, &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
+
+// power asks the agent to shutdown, reboot or suspend the computer.
+func (a *agent) power(ctx context.Context, action string) error {
+	return a.call(ctx, "POST", action, nil, nil)
+}
+
+// run asks the agent to run a command, returning its output.
+func (a *agent) run(ctx context.Context, command string) (string, error) {
+	response := output{}
+	if err := a.call(ctx, "POST", "run", map[string]string{"command": command}, &response); err != nil {
+		return "", err
+	}
+	return response.Output, nil
+}
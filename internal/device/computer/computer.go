@@ -0,0 +1,347 @@
+// Package computer provides control of PCs and servers, waking them with Wake-on-LAN, checking they are up with ping and shutting
+// them down or running whitelisted commands over SSH or through an HTTP agent.
+package computer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/auth"
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Codes that change the power state of a running computer
+var powerCodes = []string{"shutdown", "reboot", "suspend"}
+
+// driver is implemented by each way of controlling a running computer.
+type driver interface {
+	power(ctx context.Context, action string) error
+	run(ctx context.Context, command string) (string, error)
+}
+
+// metrics are reported by the agent of a running computer.
+type metrics struct {
+	CPU    *float64 `json:"cpu,omitempty"`
+	Memory *float64 `json:"memory,omitempty"`
+	Uptime *uint64  `json:"uptimeSeconds,omitempty"`
+}
+
+// status is the representation of a computer returned by the status code.
+type status struct {
+	Power string `json:"power"`
+	*metrics
+}
+
+// output is the response to the run code.
+type output struct {
+	Output string `json:"output"`
+}
+
+// request is the computer equivalent of device.Request, values are command names rather than numbers.
+type request struct {
+	Code  string `json:"code"`
+	Value string `json:"value,omitempty"`
+}
+
+// computer represents a computer configuration with name, address and the drivers used to control it.
+type computer struct {
+	Name        string            `yaml:"name"`
+	Timeout     uint              `yaml:"timeoutMs"`
+	Host        string            `yaml:"host"`
+	MacAddress  string            `yaml:"macAddress"`
+	Broadcast   string            `yaml:"broadcast"`
+	SSH         *sshClient        `yaml:"ssh"`
+	Agent       *agent            `yaml:"agent"`
+	Commands    map[string]string `yaml:"commands"`
+	Base        base
+	adminTokens []config.Secret
+	udpAddr     *net.UDPAddr
+	driver      driver
+	ping        func() error
+}
+
+// base represents a list of computers
+type base struct {
+	Devices []*computer
+}
+
+type Device struct{}
+
+// DryRun previews magic packets, power codes and commands, pings and metrics are still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for computers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts computers from config, choosing the agent over SSH where both are configured, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "computer" {
+			continue
+		}
+		computer := computer{
+			Broadcast:   "192.168.1.255",
+			Base:        base,
+			adminTokens: config.AdminTokens,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &computer); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if computer.Name == "" || computer.Host == "" || computer.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if computer.MacAddress != "" {
+			if _, err := device.MagicPacket(computer.MacAddress); err != nil {
+				logging.Log(logging.Info, "Unable to load device \"%s\": %v", computer.Name, err)
+				continue
+			}
+		}
+
+		if computer.udpAddr, err = broadcastAddr(computer.Broadcast); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", computer.Name, err)
+			continue
+		}
+
+		// The agent is preferred as it can also report metrics
+		switch {
+		case computer.Agent != nil:
+			if computer.Agent.URL == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			computer.Agent.timeout = computer.Timeout
+			computer.driver = computer.Agent
+		case computer.SSH != nil:
+			if err := computer.SSH.init(computer.Host, computer.Timeout); err != nil {
+				logging.Log(logging.Info, "Unable to load device \"%s\": %v", computer.Name, err)
+				continue
+			}
+			computer.driver = computer.SSH
+		}
+
+		if len(computer.Commands) > 0 && len(computer.adminTokens) == 0 {
+			logging.Log(logging.Info, "No adminTokens configured, run will be refused for \"%s\"", computer.Name)
+		}
+
+		computer.ping = computer.icmpPing
+
+		routes = append(routes, router.Route{
+			Path:    "/" + computer.Name,
+			Handler: computer.handler,
+		})
+
+		base.Devices = append(base.Devices, &computer)
+
+		logging.Log(logging.Info, "Found device \"%s\"", computer.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/computer" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/computer",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/computer/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// broadcastAddr parses a broadcast address with an optional port, which defaults to 9.
+func broadcastAddr(broadcast string) (*net.UDPAddr, error) {
+	host, port := broadcast, 9
+	if h, p, err := net.SplitHostPort(broadcast); err == nil {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("invalid broadcast port \"%s\"", p)
+		}
+		host = h
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid broadcast address \"%s\"", broadcast)
+	}
+	return &net.UDPAddr{IP: ip, Port: port}, nil
+}
+
+// icmpPing pings the computer's host.
+func (c *computer) icmpPing() error {
+	ipAddr, err := net.ResolveIPAddr("ip4", c.Host)
+	if err != nil {
+		return err
+	}
+	return device.Ping(ipAddr, time.Duration(c.Timeout)*time.Millisecond)
+}
+
+// wake sends a magic packet to the computer's MAC address, recording it instead during a dry run.
+func (c *computer) wake(ctx context.Context) error {
+	payload, err := device.MagicPacket(c.MacAddress)
+	if err != nil {
+		return err
+	}
+	if device.Record(ctx, device.Call{Method: "UDP", URL: "udp://" + c.udpAddr.String(), Payload: map[string]string{"magicPacket": c.MacAddress}}) {
+		return nil
+	}
+	return device.SendPacket(payload, c.udpAddr, time.Duration(c.Timeout)*time.Millisecond)
+}
+
+// status pings the computer, adding the metrics reported by its agent when it is up.
+func (c *computer) status(ctx context.Context) (*status, error) {
+	err := c.ping()
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return &status{Power: "off"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	status := status{Power: "on"}
+	if c.Agent != nil {
+		if status.metrics, err = c.Agent.metrics(ctx); err != nil {
+			logging.Log(logging.Info, "Computer \"%s\" did not report metrics: %v", c.Name, err)
+		}
+	}
+	return &status, nil
+}
+
+// getCodes returns a list of control codes for a computer, only offering the codes its configuration supports.
+func (c *computer) getCodes() []string {
+	codes := []string{"status"}
+	if c.MacAddress != "" {
+		codes = append(codes, "power")
+	}
+	if c.driver != nil {
+		codes = append(codes, powerCodes...)
+		if len(c.Commands) > 0 {
+			codes = append(codes, "run")
+		}
+	}
+	return codes
+}
+
+// Handler is the HTTP handler for computer control.
+func (c *computer) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", c.getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !slices.Contains(c.getCodes(), request.Code) {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = c.status(r.Context())
+	case "power":
+		err = c.wake(r.Context())
+	case "run":
+		if !auth.IsAdmin(r, c.adminTokens) {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+		command, ok := c.Commands[request.Value]
+		if !ok {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		var out string
+		out, err = c.driver.run(r.Context(), command)
+		data = output{Output: out}
+	default:
+		err = c.driver.power(r.Context(), request.Code)
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all computers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured computers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
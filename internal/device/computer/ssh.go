@@ -0,0 +1,138 @@
+package computer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Commands run over SSH for each power code unless overridden
+var defaultPowerCommands = map[string]string{
+	"shutdown": "sudo systemctl poweroff",
+	"reboot":   "sudo systemctl reboot",
+	"suspend":  "sudo systemctl suspend",
+}
+
+// sshClient controls a computer by running commands on it over SSH.
+type sshClient struct {
+	User       string            `yaml:"user"`
+	Port       uint16            `yaml:"port"`
+	Password   config.Secret     `yaml:"password"`
+	PrivateKey config.Secret     `yaml:"privateKey"`
+	HostKey    string            `yaml:"hostKey"`
+	Power      map[string]string `yaml:"power"`
+	address    string
+	config     *ssh.ClientConfig
+}
+
+// init validates the SSH parameters and builds the client config, the host key must be known so that credentials are only sent to
+// the computer itself.
+func (s *sshClient) init(host string, timeout uint) error {
+	if s.User == "" || s.HostKey == "" || (s.Password == "" && s.PrivateKey == "") {
+		return errors.New("ssh requires a user, hostKey and either a password or privateKey")
+	}
+
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.HostKey))
+	if err != nil {
+		return fmt.Errorf("invalid hostKey: %w", err)
+	}
+
+	methods := []ssh.AuthMethod{}
+	if s.PrivateKey != "" {
+		// The key is given inline or as the path of a file holding it
+		pem := []byte(s.PrivateKey.Value())
+		if !strings.HasPrefix(s.PrivateKey.Value(), "-----BEGIN") {
+			if pem, err = os.ReadFile(s.PrivateKey.Value()); err != nil {
+				return err
+			}
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return fmt.Errorf("invalid privateKey: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if s.Password != "" {
+		methods = append(methods, ssh.Password(s.Password.Value()))
+	}
+
+	for code := range s.Power {
+		if _, ok := defaultPowerCommands[code]; !ok {
+			return fmt.Errorf("invalid power code \"%s\"", code)
+		}
+	}
+
+	if s.Port == 0 {
+		s.Port = 22
+	}
+	s.address = net.JoinHostPort(host, strconv.Itoa(int(s.Port)))
+	s.config = &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            methods,
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         time.Duration(timeout) * time.Millisecond,
+	}
+	return nil
+}
+
+// exec runs a command in a new session, returning its combined output. The whole exchange must complete within the timeout.
+// Commands are recorded rather than run during a dry run.
+func (s *sshClient) exec(ctx context.Context, command string) (string, error) {
+	if device.Record(ctx, device.Call{Method: "SSH", URL: "ssh://" + s.address, Payload: command}) {
+		return "", nil
+	}
+
+	conn, err := net.DialTimeout("tcp", s.address, s.config.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.config.Timeout))
+
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, s.address, s.config)
+	if err != nil {
+		return "", err
+	}
+	client := ssh.NewClient(clientConn, channels, requests)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(command)
+	return string(out), err
+}
+
+// power runs the command for a power code.
+func (s *sshClient) power(ctx context.Context, action string) error {
+	command, ok := s.Power[action]
+	if !ok {
+		command = defaultPowerCommands[action]
+	}
+
+	_, err := s.exec(ctx, command)
+	// The connection is often dropped before the command exits when powering off
+	var exitMissing *ssh.ExitMissingError
+	if errors.As(err, &exitMissing) {
+		return nil
+	}
+	return err
+}
+
+// run runs a command, returning its output.
+func (s *sshClient) run(ctx context.Context, command string) (string, error) {
+	return s.exec(ctx, command)
+}
@@ -0,0 +1,201 @@
+package device
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Confirmation tokens must be presented within this long of being issued
+const confirmTimeout = 30 * time.Second
+
+// confirmRequest is the part of a device request used to decide whether it needs confirming.
+type confirmRequest struct {
+	Code   string                     `json:"code"`
+	Hosts  string                     `json:"hosts"`
+	Values map[string]json.RawMessage `json:"values"`
+	// Commands sent together, devices that accept them ignore the code
+	Commands []struct {
+		Code string `json:"code"`
+	} `json:"commands"`
+}
+
+// codes returns the code of a request along with the code of each of its commands.
+func (r *confirmRequest) codes() []string {
+	codes := []string{}
+	if r.Code != "" {
+		codes = append(codes, r.Code)
+	}
+	for _, c := range r.Commands {
+		codes = append(codes, c.Code)
+	}
+	return codes
+}
+
+// reads reports whether every code of a request is status, so that it does not write to the device.
+func (r *confirmRequest) reads() bool {
+	codes := r.codes()
+	return len(codes) > 0 && !slices.ContainsFunc(codes, func(c string) bool { return c != "status" })
+}
+
+// pendingConfirmation is a request waiting to be repeated with its token.
+type pendingConfirmation struct {
+	key     string
+	expires time.Time
+}
+
+// confirmer requires configured codes to be sent twice, the first request returns a token that the second must present, to guard against accidental presses.
+type confirmer struct {
+	codes   map[string][]string
+	pending map[string]pendingConfirmation
+	mutex   sync.Mutex
+}
+
+// newConfirmer creates a confirmer from the codes each device requires confirmation for, returning nil if there are none.
+func newConfirmer(codes map[string][]string) *confirmer {
+	if len(codes) == 0 {
+		return nil
+	}
+	return &confirmer{
+		codes:   codes,
+		pending: map[string]pendingConfirmation{},
+	}
+}
+
+// required reports whether a code sent to the named route, or to any of the hosts of a base route, needs confirming.
+func (c *confirmer) required(name string, request *confirmRequest) bool {
+	targets := []string{name}
+	if _, ok := c.codes[name]; !ok && request.Hosts != "" {
+		targets = strings.Split(strings.ReplaceAll(request.Hosts, " ", ""), ",")
+	}
+	for _, t := range targets {
+		for _, code := range request.codes() {
+			if slices.Contains(c.codes[t], code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// issue stores a confirmation for a request and returns its token.
+func (c *confirmer) issue(key string, now time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for t, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, t)
+		}
+	}
+	c.pending[token] = pendingConfirmation{key: key, expires: now.Add(confirmTimeout)}
+	return token, nil
+}
+
+// confirm consumes a token, reporting whether it was issued for the same request and has not expired.
+func (c *confirmer) confirm(token string, key string, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	p, ok := c.pending[token]
+	if !ok || p.key != key || now.After(p.expires) {
+		return false
+	}
+	delete(c.pending, token)
+	return true
+}
+
+// peek reads the code, commands and hosts of a request without consuming its body.
+func peek(r *http.Request) (*confirmRequest, error) {
+	request := confirmRequest{}
+	if r.Header.Get("Content-Type") != "application/json" {
+		request.Code = r.URL.Query().Get("code")
+		request.Hosts = r.URL.Query().Get("hosts")
+		return &request, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Malformed bodies are left for the device handler to reject
+	json.Unmarshal(body, &request)
+	// Requests with a value per device default to those devices as their hosts
+	if request.Hosts == "" && len(request.Values) > 0 {
+		hosts := []string{}
+		for h := range request.Values {
+			hosts = append(hosts, h)
+		}
+		slices.Sort(hosts)
+		request.Hosts = strings.Join(hosts, ",")
+	}
+	return &request, nil
+}
+
+// wrap returns a handler that asks for confirmation before passing configured codes on to a device handler.
+// The token is accepted from the X-Confirm-Token header or a confirm query parameter, which is removed before the request reaches the device.
+func (c *confirmer) wrap(name string, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Dry runs do not act on the device so need no confirmation
+		if r.Method != http.MethodPost || common.DryRunning(r.Context()) {
+			handler(w, r)
+			return
+		}
+
+		token := r.Header.Get("X-Confirm-Token")
+		if query := r.URL.Query(); query.Has("confirm") {
+			token = query.Get("confirm")
+			query.Del("confirm")
+			r.URL.RawQuery = query.Encode()
+		}
+
+		request, err := peek(r)
+		if err != nil || !c.required(name, request) {
+			handler(w, r)
+			return
+		}
+
+		now := time.Now()
+		key := strings.Join([]string{r.URL.Path, strings.Join(request.codes(), ","), request.Hosts}, "\x00")
+		if token != "" {
+			if !c.confirm(token, key, now) {
+				httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: confirm", nil)
+				common.JSONResponse(w, httpCode, jsonResponse)
+				return
+			}
+			handler(w, r)
+			return
+		}
+
+		token, err = c.issue(key, now)
+		if err != nil {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusAccepted, "Confirmation Required", struct {
+			Token     string `json:"token"`
+			ExpiresIn int    `json:"expiresInSeconds"`
+		}{
+			Token:     token,
+			ExpiresIn: int(confirmTimeout.Seconds()),
+		})
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}
+}
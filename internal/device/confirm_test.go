@@ -0,0 +1,92 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// confirmResponse is the data of a confirmation required response.
+type confirmResponse struct {
+	Data struct {
+		Token     string `json:"token"`
+		ExpiresIn int    `json:"expiresInSeconds"`
+	} `json:"data"`
+}
+
+func TestConfirm(t *testing.T) {
+	c := newConfirmer(map[string][]string{
+		"lamp": {"toggle", "reboot"},
+		"plug": {"toggle"},
+	})
+	assert.Nil(t, newConfirmer(map[string][]string{}))
+
+	calls := []string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.RawQuery)
+		w.WriteHeader(http.StatusOK)
+	}
+	lamp := c.wrap("lamp", handler)
+	base := c.wrap("meross", handler)
+
+	send := func(h func(http.ResponseWriter, *http.Request), url string, body string, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if body != "" {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			request.Header.Set("X-Confirm-Token", token)
+		}
+		recorder := httptest.NewRecorder()
+		h(recorder, request)
+		return recorder
+	}
+	issue := func(h func(http.ResponseWriter, *http.Request), url string, body string) string {
+		recorder := send(h, url, body, "")
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+		response := confirmResponse{}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		assert.Equal(t, 30, response.Data.ExpiresIn)
+		return response.Data.Token
+	}
+
+	// Codes that need no confirmation pass straight through
+	assert.Equal(t, http.StatusOK, send(lamp, "/lamp?code=status", "", "").Code)
+	assert.Len(t, calls, 1)
+
+	// The first request returns a token, the second presents it and the token cannot be replayed
+	token := issue(lamp, "/lamp?code=toggle", "")
+	assert.Len(t, calls, 1)
+	assert.Equal(t, http.StatusOK, send(lamp, "/lamp?code=toggle&confirm="+token, "", "").Code)
+	assert.Equal(t, "code=toggle", calls[1])
+	assert.Equal(t, http.StatusBadRequest, send(lamp, "/lamp?code=toggle", "", token).Code)
+
+	// Tokens are only accepted for the code and hosts they were issued for
+	token = issue(lamp, "/lamp?code=toggle", "")
+	assert.Equal(t, http.StatusBadRequest, send(lamp, "/lamp?code=reboot", "", token).Code)
+	token = issue(base, "/meross?code=toggle&hosts=lamp", "")
+	assert.Equal(t, http.StatusBadRequest, send(base, "/meross?code=toggle&hosts=plug", "", token).Code)
+	assert.Len(t, calls, 2)
+
+	// Commands are confirmed by their own codes, whatever the code of the request
+	assert.Equal(t, http.StatusAccepted, send(lamp, "/lamp", `{"commands":[{"code":"luminance","value":50},{"code":"toggle","value":1}]}`, "").Code)
+	assert.Equal(t, http.StatusAccepted, send(lamp, "/lamp", `{"code":"status","commands":[{"code":"toggle","value":1}]}`, "").Code)
+	token = issue(lamp, "/lamp", `{"commands":[{"code":"toggle","value":1}]}`)
+	assert.Equal(t, http.StatusBadRequest, send(lamp, "/lamp", `{"commands":[{"code":"toggle","value":1},{"code":"reboot"}]}`, token).Code)
+	token = issue(lamp, "/lamp", `{"commands":[{"code":"toggle","value":1}]}`)
+	assert.Equal(t, http.StatusOK, send(lamp, "/lamp", `{"commands":[{"code":"toggle","value":1}]}`, token).Code)
+	assert.Len(t, calls, 3)
+
+	// Tokens expire
+	now := time.Now()
+	token, err := c.issue("key", now)
+	assert.NoError(t, err)
+	assert.False(t, c.confirm(token, "key", now.Add(confirmTimeout+time.Second)))
+	token, _ = c.issue("key", now)
+	assert.True(t, c.confirm(token, "key", now.Add(confirmTimeout)))
+}
@@ -0,0 +1,233 @@
+// Package cover provides control of blinds, curtains and shutters, opening, closing and moving them to a position.
+package cover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driver is implemented by each supported motor. Positions are percentages open.
+type driver interface {
+	open(ctx context.Context) error
+	close(ctx context.Context) error
+	stop(ctx context.Context) error
+	setPosition(ctx context.Context, position int) error
+	status(ctx context.Context) (*status, error)
+}
+
+// status is the representation of a cover returned by the status code, motors that cannot report their position leave it unset.
+type status struct {
+	Position *int  `json:"position,omitempty"`
+	Moving   *bool `json:"moving,omitempty"`
+}
+
+// cover represents a cover configuration with name, driver and driver specific parameters.
+type cover struct {
+	Name    string  `yaml:"name"`
+	Timeout uint    `yaml:"timeoutMs"`
+	Driver  string  `yaml:"driver"`
+	Tahoma  *tahoma `yaml:"tahoma"`
+	Tuya    *tuya   `yaml:"tuya"`
+	Base    base
+	driver  driver
+}
+
+// base represents a list of covers
+type base struct {
+	Devices []*cover
+}
+
+type Device struct{}
+
+// DryRun previews motor commands, positions are still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for covers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Tahoma and Tuya covers from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "cover" {
+			continue
+		}
+		cover := cover{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &cover); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if cover.Name == "" || cover.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch cover.Driver {
+		case "tahoma":
+			if cover.Tahoma == nil || cover.Tahoma.URL == "" || cover.Tahoma.Token == "" || cover.Tahoma.DeviceURL == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			cover.Tahoma.timeout = cover.Timeout
+			cover.driver = cover.Tahoma
+		case "tuya":
+			if cover.Tuya == nil || cover.Tuya.Host == "" || cover.Tuya.DeviceID == "" || cover.Tuya.LocalKey == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if err := cover.Tuya.validate(); err != nil {
+				logging.Log(logging.Info, "Unable to load device \"%s\": %v", cover.Name, err)
+				continue
+			}
+			cover.Tuya.timeout = cover.Timeout
+			cover.driver = cover.Tuya
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'tahoma' or 'tuya'")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + cover.Name,
+			Handler: cover.handler,
+		})
+
+		base.Devices = append(base.Devices, &cover)
+
+		logging.Log(logging.Info, "Found device \"%s\"", cover.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/cover" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/cover",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/cover/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// getCodes returns a list of control codes for a cover.
+func getCodes() []string {
+	return []string{"status", "open", "close", "stop", "position"}
+}
+
+// Handler is the HTTP handler for cover control.
+func (c *cover) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = c.driver.status(r.Context())
+	case "open":
+		err = c.driver.open(r.Context())
+	case "close":
+		err = c.driver.close(r.Context())
+	case "stop":
+		err = c.driver.stop(r.Context())
+	case "position":
+		position, convErr := strconv.Atoi(request.Value.String())
+		if convErr != nil || position < 0 || position > 100 {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = c.driver.setPosition(r.Context(), position)
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all covers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured covers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
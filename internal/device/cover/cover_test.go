@@ -0,0 +1,419 @@
+package cover
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read cover input")
+	}
+
+	coverConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &coverConfig); err != nil {
+		t.Fatalf("Could not read cover input")
+	}
+	return &coverConfig
+}
+
+// setupTahomaServer emulates the local API of a TaHoma box with an io blind and an RTS awning, recording the commands sent to it.
+func setupTahomaServer(t *testing.T, mutex *sync.Mutex, requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tahoma-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errorCode":"RESOURCE_ACCESS_DENIED","error":"Access denied"}`))
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/enduser-mobile-web/1/enduserAPI/setup/devices/io://1234-5678-9012/12345678/states":
+			w.Write([]byte(`[{"name":"core:StatusState","type":3,"value":"available"},{"name":"core:ClosureState","type":1,"value":30},{"name":"core:MovingState","type":6,"value":false}]`))
+		case r.Method == http.MethodGet && r.URL.Path == "/enduser-mobile-web/1/enduserAPI/setup/devices/rts://1234-5678-9012/16756012/states":
+			w.Write([]byte(`[]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/enduser-mobile-web/1/enduserAPI/exec/apply":
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(body), "rts://") && strings.Contains(string(body), "setClosure") {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errorCode":"UNSUPPORTED_OPERATION","error":"No such command : setClosure"}`))
+				return
+			}
+			mutex.Lock()
+			*requests = append(*requests, string(body))
+			mutex.Unlock()
+			w.Write([]byte(`{"execId":"4e5b4a1c-ac10-3e01-1b61-bb1a4b1d0c9e"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// setupTuyaServer emulates a Tuya curtain motor that counts its position from open, pushing a status frame before each
+// acknowledgement and recording the data points set.
+func setupTuyaServer(t *testing.T, mutex *sync.Mutex, requests *[]string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	key := []byte("0123456789abcdef")
+	position := 60.0
+
+	// reply sends a frame with a return code and an optionally encrypted payload
+	reply := func(conn net.Conn, seq uint32, command uint32, payload any) {
+		body := make([]byte, 4)
+		if payload != nil {
+			payloadBytes, _ := json.Marshal(payload)
+			encrypted, _ := tuyaCrypt(key, payloadBytes, true)
+			if command != tuyaQuery {
+				body = append(body, tuyaHeader...)
+			}
+			body = append(body, encrypted...)
+		}
+		conn.Write(tuyaFrame(seq, command, body))
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					command, body, err := readTuyaFrame(conn)
+					if err != nil {
+						return
+					}
+					if command == tuyaControl {
+						body = body[len(tuyaHeader):]
+					}
+					decrypted, err := tuyaCrypt(key, body, false)
+					if err != nil {
+						return
+					}
+					request := struct {
+						DevID string         `json:"devId"`
+						DPS   map[string]any `json:"dps"`
+					}{}
+					if json.Unmarshal(decrypted, &request) != nil || request.DevID != "bf0123456789abcdefgh" {
+						return
+					}
+
+					mutex.Lock()
+					switch command {
+					case tuyaQuery:
+						reply(conn, 1, tuyaQuery, map[string]any{"devId": request.DevID, "dps": map[string]any{"1": "stop", "2": position, "3": position}})
+					case tuyaControl:
+						dps, _ := json.Marshal(request.DPS)
+						*requests = append(*requests, string(dps))
+						if p, ok := request.DPS["2"].(float64); ok {
+							position = p
+						}
+						reply(conn, 0, tuyaStatus, map[string]any{"devId": request.DevID, "dps": request.DPS})
+						reply(conn, 2, tuyaControl, nil)
+					}
+					mutex.Unlock()
+				}
+			}(conn)
+		}
+	}()
+	return listener
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/coverConfig/normal_config.yaml",
+			routeCount:    5,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/coverConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/coverConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/coverConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/coverConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		expectedCode     int
+		expectedBody     string
+		expectedRequests []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/cover/lounge_blind",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","open","close","stop","position"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/cover/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lounge_blind","garden_awning","bedroom_curtain"]}`,
+		},
+		{
+			name:         "tahoma_status",
+			method:       "POST",
+			url:          "/cover/lounge_blind?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"position":70,"moving":false}}`,
+		},
+		{
+			name:         "tahoma_rts_status",
+			method:       "POST",
+			url:          "/cover/garden_awning?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{}}`,
+		},
+		{
+			name:             "tahoma_open",
+			method:           "POST",
+			url:              "/cover/lounge_blind?code=open",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"actions":[{"commands":[{"name":"open","parameters":[]}],"deviceURL":"io://1234-5678-9012/12345678"}],"label":"restate"}`},
+		},
+		{
+			name:             "tahoma_position",
+			method:           "POST",
+			url:              "/cover/lounge_blind?code=position&value=25",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"actions":[{"commands":[{"name":"setClosure","parameters":[75]}],"deviceURL":"io://1234-5678-9012/12345678"}],"label":"restate"}`},
+		},
+		{
+			name:             "tahoma_rts_stop",
+			method:           "POST",
+			url:              "/cover/garden_awning?code=stop",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"actions":[{"commands":[{"name":"stop","parameters":[]}],"deviceURL":"rts://1234-5678-9012/16756012"}],"label":"restate"}`},
+		},
+		{
+			name:         "tahoma_rts_position",
+			method:       "POST",
+			url:          "/cover/garden_awning?code=position&value=50",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "tuya_status",
+			method:       "POST",
+			url:          "/cover/bedroom_curtain?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"position":40}}`,
+		},
+		{
+			name:             "tuya_close",
+			method:           "POST",
+			url:              "/cover/bedroom_curtain?code=close",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"1":"close"}`},
+		},
+		{
+			name:             "tuya_position",
+			method:           "POST",
+			url:              "/cover/bedroom_curtain?code=position&value=80",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`{"2":20}`},
+		},
+		{
+			name:         "tuya_status_after_position",
+			method:       "POST",
+			url:          "/cover/bedroom_curtain?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"position":80}}`,
+		},
+		{
+			name:         "position_out_of_range",
+			method:       "POST",
+			url:          "/cover/lounge_blind?code=position&value=150",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/cover/lounge_blind?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/cover/lounge_blind",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/cover/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	mutex := sync.Mutex{}
+	requests := []string{}
+	tahomaServer := setupTahomaServer(t, &mutex, &requests)
+	defer tahomaServer.Close()
+	tuyaServer := setupTuyaServer(t, &mutex, &requests)
+	defer tuyaServer.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/coverConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		if d.Tahoma != nil {
+			d.Tahoma.URL = tahomaServer.URL
+		} else {
+			d.Tuya.Host = tuyaServer.Addr().String()
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mutex.Lock()
+			requests = requests[:0]
+			mutex.Unlock()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if tc.expectedRequests != nil {
+				assert.Equal(t, tc.expectedRequests, requests)
+			}
+		})
+	}
+
+	t.Run("dry_run_commands", func(t *testing.T) {
+		mutex.Lock()
+		requests = requests[:0]
+		mutex.Unlock()
+		ctx, dryRun := device.WithDryRun(context.Background())
+		for _, url := range []string{"/cover/lounge_blind?code=open", "/cover/bedroom_curtain?code=position&value=40"} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil).WithContext(ctx))
+			assert.Equal(t, 200, recorder.Code, url)
+		}
+
+		mutex.Lock()
+		assert.Empty(t, requests)
+		mutex.Unlock()
+		calls := dryRun.Calls()
+		if assert.Len(t, calls, 2) {
+			assert.Equal(t, tahomaServer.URL+"/enduser-mobile-web/1/enduserAPI/exec/apply", calls[0].URL)
+			assert.Equal(t, device.Call{Method: "TCP", URL: "tcp://" + tuyaServer.Addr().String(), Payload: map[string]any{"dps": map[string]any{"2": float64(60)}}}, calls[1])
+		}
+	})
+
+	t.Run("tuya_wrong_key", func(t *testing.T) {
+		motor := &tuya{Host: tuyaServer.Addr().String(), DeviceID: "bf0123456789abcdefgh", LocalKey: "fedcba9876543210", timeout: 200}
+		_, err := motor.status(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestTuyaFrame(t *testing.T) {
+	frame := tuyaFrame(1, tuyaQuery, []byte{0x01, 0x02})
+	assert.Equal(t, uint32(tuyaPrefix), binary.BigEndian.Uint32(frame))
+	assert.Equal(t, uint32(tuyaSuffix), binary.BigEndian.Uint32(frame[len(frame)-4:]))
+
+	command, payload, err := readTuyaFrame(strings.NewReader(string(frame)))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(tuyaQuery), command)
+	assert.Equal(t, []byte{0x01, 0x02}, payload)
+
+	frame[17] ^= 0xff
+	_, _, err = readTuyaFrame(strings.NewReader(string(frame)))
+	assert.ErrorContains(t, err, "invalid checksum")
+}
@@ -0,0 +1,133 @@
+package cover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// tahoma drives a Somfy io or RTS motor through the local API of a TaHoma box in developer mode. io motors report their closure,
+// RTS motors only receive commands so their position is unknown.
+type tahoma struct {
+	URL       string        `yaml:"url"`
+	Token     config.Secret `yaml:"token"`
+	DeviceURL string        `yaml:"deviceUrl"`
+	timeout   uint
+}
+
+// tahomaState is a single state of a device, values vary in type between states.
+type tahomaState struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+// tahomaCommand is a command in an action, sent to a single device.
+type tahomaCommand struct {
+	Name       string `json:"name"`
+	Parameters []any  `json:"parameters"`
+}
+
+// send sends a single request to an API endpoint, decoding the response when provided.
+func (t *tahoma) send(ctx context.Context, method string, endpoint string, body any, response any) error {
+	client := &http.Client{
+		Timeout: time.Duration(t.timeout) * time.Millisecond,
+	}
+
+	var reader io.Reader
+	if body != nil {
+		requestBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(t.URL, "/")+"/enduser-mobile-web/1/enduserAPI/"+endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.Token.Value())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errorBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("tahoma returned %d: %s", resp.StatusCode, strings.TrimSpace(string(errorBytes)))
+	}
+
+	if response != nil {
+		return json.NewDecoder(resp.Body).Decode(response)
+	}
+	return nil
+}
+
+// execute applies a single command to the device.
+func (t *tahoma) execute(ctx context.Context, name string, parameters ...any) error {
+	if parameters == nil {
+		parameters = []any{}
+	}
+	return t.send(ctx, http.MethodPost, "exec/apply", map[string]any{
+		"label": "restate",
+		"actions": []map[string]any{{
+			"deviceURL": t.DeviceURL,
+			"commands":  []tahomaCommand{{Name: name, Parameters: parameters}},
+		}},
+	}, nil)
+}
+
+func (t *tahoma) open(ctx context.Context) error {
+	return t.execute(ctx, "open")
+}
+
+func (t *tahoma) close(ctx context.Context) error {
+	return t.execute(ctx, "close")
+}
+
+func (t *tahoma) stop(ctx context.Context) error {
+	return t.execute(ctx, "stop")
+}
+
+// setPosition sets the closure of the motor, the percentage closed.
+func (t *tahoma) setPosition(ctx context.Context, position int) error {
+	return t.execute(ctx, "setClosure", 100-position)
+}
+
+// status returns the position and movement of motors that report them.
+func (t *tahoma) status(ctx context.Context) (*status, error) {
+	states := []tahomaState{}
+	if err := t.send(ctx, http.MethodGet, "setup/devices/"+url.PathEscape(t.DeviceURL)+"/states", nil, &states); err != nil {
+		return nil, err
+	}
+
+	status := status{}
+	for _, s := range states {
+		switch s.Name {
+		case "core:ClosureState":
+			if closure, ok := s.Value.(float64); ok {
+				position := 100 - int(closure)
+				status.Position = &position
+			}
+		case "core:MovingState":
+			if moving, ok := s.Value.(bool); ok {
+				status.Moving = &moving
+			}
+		}
+	}
+	return &status, nil
+}
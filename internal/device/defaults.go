@@ -0,0 +1,30 @@
+package device
+
+import (
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+)
+
+// applyDefaults fills in the timeoutMs of devices that omit it, which would otherwise leave their HTTP clients without a timeout,
+// and replaces timeouts that are obviously wrong with the default.
+func applyDefaults(c *config.Config) {
+	defaultTimeoutMs := c.Defaults.Timeout
+	if defaultTimeoutMs == 0 {
+		defaultTimeoutMs = config.DefaultTimeout
+	}
+
+	for i, d := range c.Devices {
+		if d.Config == nil {
+			continue
+		}
+
+		if _, ok := d.Config["timeoutMs"]; ok {
+			if t := timeoutMs(d.Config); t > 0 && t <= config.MaxTimeout {
+				continue
+			}
+			name, _ := d.Config["name"].(string)
+			logging.Log(logging.Error, "Ignoring timeoutMs of device \"%s\", timeoutMs must be between 1 and %d, using %d", name, config.MaxTimeout, defaultTimeoutMs)
+		}
+		c.Devices[i].Config["timeoutMs"] = int(defaultTimeoutMs)
+	}
+}
@@ -0,0 +1,195 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// dependencies switches on the devices that other devices depend on, e.g. the smart plug powering an AV receiver, before those devices
+// are written to, waiting for them to boot.
+type dependencies struct {
+	needs map[string][]config.Dependency
+	// Handlers of the devices depended on, themselves wrapped so that dependencies of dependencies are met
+	handlers map[string]func(http.ResponseWriter, *http.Request)
+	// Requests meeting the same dependency wait for each other, so that a device is switched on and booted once
+	mutexes map[string]*sync.Mutex
+}
+
+// newDependencies reads the dependencies of each configured device, ignoring those on unknown devices and those that would form a
+// cycle. It returns nil if no device has any.
+func newDependencies(c *config.Config, configured []string) *dependencies {
+	ds := &dependencies{
+		needs:    map[string][]config.Dependency{},
+		handlers: map[string]func(http.ResponseWriter, *http.Request){},
+		mutexes:  map[string]*sync.Mutex{},
+	}
+	for _, d := range c.Devices {
+		name, ok := d.Config["name"].(string)
+		if !ok {
+			continue
+		}
+		for _, dep := range d.DependsOn {
+			if dep.Device == name || !slices.Contains(configured, dep.Device) {
+				logging.Log(logging.Error, "Ignoring dependency \"%s\" of device \"%s\", no such device", dep.Device, name)
+				continue
+			}
+			if ds.dependsOn(dep.Device, name) {
+				logging.Log(logging.Error, "Ignoring dependency \"%s\" of device \"%s\", it depends on \"%s\" in turn", dep.Device, name, name)
+				continue
+			}
+			if dep.Code == "" {
+				dep.Code = "toggle"
+				dep.Value = "1"
+			}
+			ds.needs[name] = append(ds.needs[name], dep)
+			if _, ok := ds.mutexes[dep.Device]; !ok {
+				ds.mutexes[dep.Device] = &sync.Mutex{}
+			}
+		}
+	}
+	if len(ds.needs) == 0 {
+		return nil
+	}
+	return ds
+}
+
+// dependsOn reports whether the named device depends on other, directly or through its dependencies.
+func (ds *dependencies) dependsOn(name string, other string) bool {
+	for _, dep := range ds.needs[name] {
+		if dep.Device == other || ds.dependsOn(dep.Device, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowance returns the extra time a write to the named device may take to meet its dependencies, the time each takes to be read,
+// switched on and booted.
+func (ds *dependencies) allowance(name string, timeouts map[string]time.Duration, fallback time.Duration) time.Duration {
+	total := time.Duration(0)
+	for _, dep := range ds.needs[name] {
+		t, ok := timeouts[dep.Device]
+		if !ok {
+			t = fallback
+		}
+		total += t + time.Duration(dep.BootMs)*time.Millisecond + ds.allowance(dep.Device, timeouts, fallback)
+	}
+	return total
+}
+
+// poweredOn reports whether the data of a status response says the device is on, going by its onoff or power field.
+func poweredOn(data any) bool {
+	status, ok := data.(map[string]any)
+	if !ok {
+		return false
+	}
+	switch v := status["onoff"].(type) {
+	case float64:
+		return v == 1
+	case string:
+		return strings.EqualFold(v, "on")
+	}
+	if v, ok := status["power"].(string); ok {
+		return strings.EqualFold(v, "on")
+	}
+	return false
+}
+
+// call sends a code and value to a device handler, returning the status code and data of its response.
+func call(ctx context.Context, name string, handler func(http.ResponseWriter, *http.Request), code string, value string) (int, any) {
+	query := url.Values{"code": {code}}
+	if value != "" {
+		query.Set("value", value)
+	}
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/"+name+"?"+query.Encode(), nil)
+
+	recorder := recorder{}
+	handler(&recorder, request)
+
+	response := common.Response{}
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil {
+		return recorder.code, nil
+	}
+	return recorder.code, response.Data
+}
+
+// ensure switches a dependency on unless its status says it already is, then waits for the dependent device to boot.
+func (ds *dependencies) ensure(ctx context.Context, dep config.Dependency) error {
+	handler, ok := ds.handlers[dep.Device]
+	if !ok {
+		return fmt.Errorf("device has no route")
+	}
+	if !common.Enabled(dep.Device) {
+		return fmt.Errorf("device is disabled")
+	}
+
+	mutex := ds.mutexes[dep.Device]
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if code, data := call(ctx, dep.Device, handler, "status", ""); code == http.StatusOK && poweredOn(data) {
+		return nil
+	}
+	if code, _ := call(ctx, dep.Device, handler, dep.Code, dep.Value); code != http.StatusOK {
+		return fmt.Errorf("received status code %d", code)
+	}
+	logging.Log(logging.Info, "Switched on \"%s\"", dep.Device)
+
+	timer := time.NewTimer(time.Duration(dep.BootMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return nil
+}
+
+// wrap returns a handler that meets the dependencies of the named device, or of the hosts of a base route, before passing writes on to
+// a device handler. Writes whose dependencies cannot be switched on are answered with 424 naming the dependency.
+func (ds *dependencies) wrap(name string, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Dry runs do not act on the device so need nothing switched on
+		if r.Method != http.MethodPost || common.DryRunning(r.Context()) {
+			handler(w, r)
+			return
+		}
+
+		request, err := peek(r)
+		if err != nil || request.reads() {
+			handler(w, r)
+			return
+		}
+
+		targets := []string{name}
+		if _, ok := ds.needs[name]; !ok && request.Hosts != "" {
+			targets = strings.Split(strings.ReplaceAll(request.Hosts, " ", ""), ",")
+		}
+		for _, t := range targets {
+			for _, dep := range ds.needs[t] {
+				if err := ds.ensure(r.Context(), dep); err != nil {
+					logging.Log(logging.Error, "Unable to switch on \"%s\", which \"%s\" depends on: %v", dep.Device, t, err)
+					httpCode, jsonResponse := common.SetJSONResponse(http.StatusFailedDependency, "Failed Dependency", struct {
+						Device string `json:"device"`
+					}{
+						Device: dep.Device,
+					})
+					common.JSONResponse(w, httpCode, jsonResponse)
+					return
+				}
+			}
+		}
+		handler(w, r)
+	}
+}
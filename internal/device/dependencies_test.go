@@ -0,0 +1,165 @@
+package device
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plug stubs the handler of a smart plug that other devices depend on.
+type plug struct {
+	mutex   sync.Mutex
+	on      bool
+	fail    bool
+	toggles int
+}
+
+func (p *plug) handler(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.fail {
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		common.JSONResponse(w, httpCode, jsonResponse)
+		return
+	}
+
+	onoff := 0
+	switch r.URL.Query().Get("code") {
+	case "status":
+		if p.on {
+			onoff = 1
+		}
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", map[string]any{"onoff": onoff})
+		common.JSONResponse(w, httpCode, jsonResponse)
+		return
+	case "toggle":
+		p.toggles++
+		p.on = r.URL.Query().Get("value") == "1"
+	}
+	httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", nil)
+	common.JSONResponse(w, httpCode, jsonResponse)
+}
+
+func TestNewDependencies(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	assert.Nil(t, newDependencies(&config.Config{Devices: []config.Devices{{Type: "meross", Config: map[string]any{"name": "plug"}}}}, []string{"plug"}))
+
+	ds := newDependencies(&config.Config{Devices: []config.Devices{
+		{Type: "tvcom", Config: map[string]any{"name": "receiver"}, DependsOn: []config.Dependency{{Device: "plug", BootMs: 2000}}},
+		{Type: "tvcom", Config: map[string]any{"name": "tv"}, DependsOn: []config.Dependency{{Device: "receiver", Code: "power", Value: "on"}, {Device: "missing"}}},
+		{Type: "meross", Config: map[string]any{"name": "plug"}, DependsOn: []config.Dependency{{Device: "tv"}}},
+	}}, []string{"receiver", "tv", "plug"})
+
+	// Dependencies default to switching on with toggle, those on unknown devices or that would form a cycle are ignored
+	assert.Equal(t, []config.Dependency{{Device: "plug", Code: "toggle", Value: "1", BootMs: 2000}}, ds.needs["receiver"])
+	assert.Equal(t, []config.Dependency{{Device: "receiver", Code: "power", Value: "on"}}, ds.needs["tv"])
+	assert.Empty(t, ds.needs["plug"])
+
+	// Writes are allowed the time taken to meet each dependency, including the dependencies of dependencies
+	timeouts := map[string]time.Duration{"receiver": time.Second}
+	assert.Equal(t, 2*time.Second+3*time.Second, ds.allowance("receiver", timeouts, 3*time.Second))
+	assert.Equal(t, time.Second+5*time.Second, ds.allowance("tv", timeouts, 3*time.Second))
+	assert.Zero(t, ds.allowance("plug", timeouts, 3*time.Second))
+}
+
+func TestDependencies(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	bootTime := 50 * time.Millisecond
+	p := &plug{}
+	ds := newDependencies(&config.Config{Devices: []config.Devices{
+		{Type: "tvcom", Config: map[string]any{"name": "receiver"}, DependsOn: []config.Dependency{{Device: "plug", BootMs: uint(bootTime.Milliseconds())}}},
+		{Type: "tvcom", Config: map[string]any{"name": "tv"}, DependsOn: []config.Dependency{{Device: "plug", BootMs: uint(bootTime.Milliseconds())}}},
+		{Type: "meross", Config: map[string]any{"name": "plug"}},
+	}}, []string{"receiver", "tv", "plug"})
+	ds.handlers["plug"] = p.handler
+
+	var mutex sync.Mutex
+	calls := []string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls = append(calls, r.URL.RawQuery)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}
+	receiver := ds.wrap("receiver", handler)
+	tv := ds.wrap("tv", handler)
+	base := ds.wrap("tvcom", handler)
+
+	send := func(h func(http.ResponseWriter, *http.Request), url string, ctx context.Context) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		h(recorder, httptest.NewRequest(http.MethodPost, url, nil).WithContext(ctx))
+		return recorder
+	}
+	reset := func() {
+		p.mutex.Lock()
+		p.on, p.toggles = false, 0
+		p.mutex.Unlock()
+	}
+
+	// Reads and dry runs need nothing switched on
+	assert.Equal(t, http.StatusOK, send(receiver, "/receiver?code=status", context.Background()).Code)
+	dryRun, _ := common.WithDryRun(context.Background())
+	assert.Equal(t, http.StatusOK, send(receiver, "/receiver?code=power&value=on", dryRun).Code)
+	assert.Zero(t, p.toggles)
+
+	// Writes switch the dependency on and wait for the device to boot, once it is on it is left alone
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, send(receiver, "/receiver?code=power&value=on", context.Background()).Code)
+	assert.GreaterOrEqual(t, time.Since(start), bootTime)
+	assert.Equal(t, 1, p.toggles)
+	assert.True(t, p.on)
+	assert.Equal(t, http.StatusOK, send(receiver, "/receiver?code=input&value=hdmi1", context.Background()).Code)
+	assert.Equal(t, 1, p.toggles)
+
+	// Base routes meet the dependencies of their hosts
+	reset()
+	assert.Equal(t, http.StatusOK, send(base, "/tvcom?code=power&value=on&hosts=tv", context.Background()).Code)
+	assert.Equal(t, 1, p.toggles)
+
+	// Concurrent writes depending on the same device switch it on once
+	reset()
+	var wg sync.WaitGroup
+	for _, h := range []func(http.ResponseWriter, *http.Request){receiver, tv, receiver, tv} {
+		wg.Add(1)
+		go func(h func(http.ResponseWriter, *http.Request)) {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, send(h, "/device?code=power&value=on", context.Background()).Code)
+		}(h)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, p.toggles)
+
+	// Dependencies that cannot be switched on fail the write without passing it on
+	reset()
+	p.fail = true
+	mutex.Lock()
+	calls = []string{}
+	mutex.Unlock()
+	recorder := send(receiver, "/receiver?code=power&value=on", context.Background())
+	assert.Equal(t, http.StatusFailedDependency, recorder.Code)
+	assert.Equal(t, `{"version":1,"message":"Failed Dependency","data":{"device":"plug"}}`, recorder.Body.String())
+	p.fail = false
+
+	common.SetEnabled("plug", false)
+	assert.Equal(t, http.StatusFailedDependency, send(receiver, "/receiver?code=power&value=on", context.Background()).Code)
+	common.SetEnabled("plug", true)
+	assert.Empty(t, calls)
+
+	// The boot wait ends with the request
+	reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, ds.ensure(ctx, ds.needs["receiver"][0]), context.Canceled)
+}
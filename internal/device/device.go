@@ -3,21 +3,58 @@ package device
 import (
 	"errors"
 	"net/http"
+	"path"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/kennedn/restate-go/internal/common/auth"
 	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
 	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/activity"
+	"github.com/kennedn/restate-go/internal/device/adblock"
 	"github.com/kennedn/restate-go/internal/device/alert"
+	"github.com/kennedn/restate-go/internal/device/announce"
 	"github.com/kennedn/restate-go/internal/device/bthome"
+	"github.com/kennedn/restate-go/internal/device/calendar"
 	"github.com/kennedn/restate-go/internal/device/common"
+	"github.com/kennedn/restate-go/internal/device/composite"
+	"github.com/kennedn/restate-go/internal/device/computer"
+	"github.com/kennedn/restate-go/internal/device/cover"
+	"github.com/kennedn/restate-go/internal/device/doorbell"
+	"github.com/kennedn/restate-go/internal/device/energy"
+	"github.com/kennedn/restate-go/internal/device/fronius"
+	"github.com/kennedn/restate-go/internal/device/garage"
+	"github.com/kennedn/restate-go/internal/device/goecharger"
 	"github.com/kennedn/restate-go/internal/device/hikvision"
+	"github.com/kennedn/restate-go/internal/device/ir"
+	"github.com/kennedn/restate-go/internal/device/irrigation"
+	"github.com/kennedn/restate-go/internal/device/kiosk"
+	"github.com/kennedn/restate-go/internal/device/lock"
 	"github.com/kennedn/restate-go/internal/device/meross"
-	"github.com/kennedn/restate-go/internal/device/meross_radiator"
 	"github.com/kennedn/restate-go/internal/device/meross_thermostat"
+	"github.com/kennedn/restate-go/internal/device/miio"
+	"github.com/kennedn/restate-go/internal/device/mode"
+	"github.com/kennedn/restate-go/internal/device/mpd"
+	"github.com/kennedn/restate-go/internal/device/network"
+	"github.com/kennedn/restate-go/internal/device/pid"
+	"github.com/kennedn/restate-go/internal/device/printer"
+	"github.com/kennedn/restate-go/internal/device/radiator"
+	"github.com/kennedn/restate-go/internal/device/safety"
+	"github.com/kennedn/restate-go/internal/device/schedule"
+	"github.com/kennedn/restate-go/internal/device/sensor"
+	"github.com/kennedn/restate-go/internal/device/snapcast"
 	"github.com/kennedn/restate-go/internal/device/snowdon"
+	"github.com/kennedn/restate-go/internal/device/switchbot"
 	"github.com/kennedn/restate-go/internal/device/tvcom"
+	"github.com/kennedn/restate-go/internal/device/valetudo"
+	"github.com/kennedn/restate-go/internal/device/vm"
 	"github.com/kennedn/restate-go/internal/device/wol"
 	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"github.com/gorilla/mux"
 )
 
 type Device interface {
@@ -25,31 +62,194 @@ type Device interface {
 }
 
 type Devices struct {
-	routes []router.Route
+	routes      []router.Route
+	names       []string
+	adminTokens []config.Secret
+	handlers    map[string]func(http.ResponseWriter, *http.Request)
+	classes     map[string]string
+	poller      *poller
 }
 
 var (
 	devices = []Device{
 		&alert.Device{},
 		&meross.Device{},
-		&meross_radiator.Device{},
+		&radiator.Device{},
 		&meross_thermostat.Device{},
 		&snowdon.Device{},
 		&tvcom.Device{},
 		&wol.Device{},
 		&hikvision.Device{},
 		&bthome.Device{},
+		&schedule.Device{},
+		&energy.Device{},
+		&goecharger.Device{},
+		&fronius.Device{},
+		&lock.Device{},
+		&doorbell.Device{},
+		&irrigation.Device{},
+		&valetudo.Device{},
+		&printer.Device{},
+		&composite.Device{},
+		&kiosk.Device{},
+		&mode.Device{},
+		&calendar.Device{},
+		&computer.Device{},
+		&vm.Device{},
+		&network.Device{},
+		&adblock.Device{},
+		&announce.Device{},
+		&snapcast.Device{},
+		&mpd.Device{},
+		&activity.Device{},
+		&ir.Device{},
+		&switchbot.Device{},
+		&miio.Device{},
+		&cover.Device{},
+		&sensor.Device{},
+		&safety.Device{},
+		&pid.Device{},
+		&garage.Device{},
 	}
+
+	// Defaults for building device routes at startup, overridden by setupWorkers and setupTimeoutMs
+	defaultSetupWorkers = 4
+	defaultSetupTimeout = 10 * time.Second
+	// Device types that take longer than this to build their routes are logged
+	slowSetup = 2 * time.Second
 )
 
+// setup is the outcome of building the routes of a single device type.
+type setup struct {
+	routes []router.Route
+	done   bool
+}
+
 func (d *Devices) Routes(config *config.Config) ([]router.Route, error) {
+	d.adminTokens = config.AdminTokens
+	migrate(config)
+	applyDefaults(config)
+	common.SetStrict(config.StrictParameters == nil || *config.StrictParameters)
+
+	configured := []string{}
+	confirmCodes := map[string][]string{}
+	verifier := verifier{}
+	timeouts := map[string]time.Duration{}
+	paths := map[string]string{}
+	d.classes = map[string]string{}
+	indexes := entries(config)
+
+	// Routes of restate itself are claimed up front so that a device named e.g. classes cannot shadow them
+	builtin := []router.Route{
+		{Path: "/" + config.ApiVersion, Handler: d.handler},
+		{Path: "/" + config.ApiVersion + "/", Handler: d.handler},
+		{Path: "/" + config.ApiVersion + "/classes", Handler: d.classesHandler},
+		{Path: "/" + config.ApiVersion + "/admin/devices/{name}/enabled", Handler: d.enabledHandler},
+		{Path: "/" + config.ApiVersion + "/admin/selftest", Handler: d.selfTestHandler},
+	}
+	owners := routeOwners{"/" + config.ApiVersion + "/health/devices": "restate"}
+	for _, r := range builtin {
+		owners[r.Path] = "restate"
+	}
+	for _, c := range config.Devices {
+		name, ok := c.Config["name"].(string)
+		if ok {
+			configured = append(configured, name)
+		}
+		if ok && c.Path != "" {
+			paths[name] = c.Path
+		}
+		if class := deviceClass(c); ok && class != "" {
+			if validClass(class) {
+				d.classes[name] = class
+			} else {
+				logging.Log(logging.Error, "Ignoring class \"%s\" of device \"%s\", class must be one of light, switch, cover, climate, lock, sensor or media", class, name)
+			}
+		}
+		if ok && c.Proxy != "" {
+			if err := egress.SetHostProxy(deviceHost(c.Config), c.Proxy); err != nil {
+				logging.Log(logging.Error, "Ignoring proxy of \"%s\": %v", name, err)
+			}
+		}
+		if t := deviceTimeout(c.Config); ok && t > 0 {
+			timeouts[name] = t
+		}
+		if ok && len(c.Confirm) > 0 {
+			confirmCodes[name] = c.Confirm
+		}
+		if ok && c.ReturnState {
+			verifier.names = append(verifier.names, name)
+		}
+		if ok && c.Enabled != nil && !*c.Enabled {
+			common.SetEnabled(name, false)
+			logging.Log(logging.Info, "Device \"%s\" is disabled", name)
+		}
+	}
+
+	confirmer := newConfirmer(confirmCodes)
+	retrier := newRetrier()
+	dependencies := newDependencies(config, configured)
+
+	requestTimeout := defaultRequestTimeout
+	if config.RequestTimeout > 0 {
+		requestTimeout = time.Duration(config.RequestTimeout) * time.Millisecond
+	}
+
+	d.handlers = map[string]func(http.ResponseWriter, *http.Request){}
+	for n, setup := range setupRoutes(config) {
+		if !setup.done {
+			continue
+		}
+		tmpRoutes := []router.Route{}
+		for _, r := range setup.routes {
+			if owners.claim("/"+config.ApiVersion+r.Path, describeOwner(config, indexes, deviceName(r.Path, configured), devices[n])) {
+				tmpRoutes = append(tmpRoutes, r)
+			}
+		}
+		supported := supportsDryRun(devices[n])
 
-	for _, device := range devices {
-		tmpRoutes, _ := device.Routes(config)
+		// Routes of a device type that are not for a single device, e.g. the base route, may target any of its devices
+		typeTimeout := time.Duration(0)
+		typeAllowance := time.Duration(0)
+		for _, r := range tmpRoutes {
+			typeTimeout = max(typeTimeout, timeouts[deviceName(r.Path, configured)])
+			if dependencies != nil {
+				typeAllowance = max(typeAllowance, dependencies.allowance(deviceName(r.Path, configured), timeouts, requestTimeout))
+			}
+		}
 
-		// Prepend API version to route paths
+		// Prepend API version to route paths, write to devices in sequence, answer requests that take too long with 504, return 503 from
+		// devices taken out of rotation, ask for confirmation of configured codes, switch on the devices written to depend on, return the
+		// resulting state of writes, retry the hosts that failed, preview dry runs and trim responses
 		for i, r := range tmpRoutes {
+			name := deviceName(r.Path, configured)
+			single := path.Base(r.Path) == name
+			routeTimeout := timeoutFor(name, timeouts, typeTimeout, requestTimeout)
 			tmpRoutes[i].Path = "/" + config.ApiVersion + r.Path
+			handler := r.Handler
+			if dependencies != nil {
+				// Writes wait for the devices they depend on to be switched on and boot
+				handler = dependencies.wrap(name, handler)
+				if single {
+					dependencies.handlers[name] = handler
+					routeTimeout += dependencies.allowance(name, timeouts, requestTimeout)
+				} else {
+					routeTimeout += typeAllowance
+				}
+			}
+			if confirmer != nil {
+				handler = confirmer.wrap(name, handler)
+			}
+			// Routes for a single device write to it alone, others may target any device of the type
+			devices := 1
+			if !single {
+				devices = len(tmpRoutes)
+			}
+			tmpRoutes[i].Handler = sequence(devices, routeTimeout, timeout(routeTimeout, r.Streams, enabled(name, reshape(dryRun(supported, retrier.wrap(verifier.wrap(name, handler)))))))
+			d.names = append(d.names, name)
+			if single {
+				d.handlers[name] = r.Handler
+			}
 		}
 
 		d.routes = append(d.routes, tmpRoutes...)
@@ -60,19 +260,119 @@ func (d *Devices) Routes(config *config.Config) ([]router.Route, error) {
 		return []router.Route{}, errors.New("no routes returned from parsed config")
 	}
 
-	d.routes = append(d.routes, router.Route{
-		Path:    "/" + config.ApiVersion,
-		Handler: d.handler,
-	})
+	d.routes = append(d.routes, builtin...)
 
-	d.routes = append(d.routes, router.Route{
-		Path:    "/" + config.ApiVersion + "/",
-		Handler: d.handler,
-	})
+	if config.Health.IntervalSeconds > 0 {
+		poller := newPoller(time.Duration(config.Health.IntervalSeconds)*time.Second, d.handlers)
+		if notifier, err := newNotifier(config.Health.Alert); err != nil {
+			logging.Log(logging.Info, "Unable to enable availability alerts: %v", err)
+		} else {
+			poller.notifier = notifier
+		}
+		go poller.run()
+		d.poller = poller
+
+		d.routes = append(d.routes, router.Route{
+			Path:    "/" + config.ApiVersion + "/health/devices",
+			Handler: poller.handler,
+		})
+	}
+
+	// Organise devices by e.g. room rather than type where configured, checked against every other route
+	overridePaths(d.routes, paths, configured, "/"+config.ApiVersion)
 
 	return d.routes, nil
 }
 
+// Diagnostics summarises the devices for runtime diagnostics, including the number of health polls waiting on a device.
+func (d *Devices) Diagnostics() any {
+	diagnostics := struct {
+		Routes        int    `json:"routes"`
+		PolledDevices *int   `json:"polledDevices,omitempty"`
+		PollsInFlight *int64 `json:"pollsInFlight,omitempty"`
+	}{
+		Routes: len(d.routes),
+	}
+	if d.poller != nil {
+		polled := len(d.poller.snapshot())
+		inFlight := d.poller.inFlight.Load()
+		diagnostics.PolledDevices = &polled
+		diagnostics.PollsInFlight = &inFlight
+	}
+	return diagnostics
+}
+
+// setupRoutes builds the routes of each device type concurrently with a bounded pool of workers, results are returned in the order of devices.
+// Device types that do not finish within the setup timeout are logged and abandoned so that one unreachable device cannot hold up startup.
+func setupRoutes(config *config.Config) []setup {
+	workers := defaultSetupWorkers
+	if config.SetupWorkers > 0 {
+		workers = config.SetupWorkers
+	}
+	timeout := defaultSetupTimeout
+	if config.SetupTimeout > 0 {
+		timeout = time.Duration(config.SetupTimeout) * time.Millisecond
+	}
+
+	setups := make([]setup, len(devices))
+	semaphore := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i, d := range devices {
+		wg.Add(1)
+		go func(i int, d Device) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			// Buffered so an abandoned device type can still finish without blocking
+			result := make(chan []router.Route, 1)
+			start := time.Now()
+			go func() {
+				routes, _ := d.Routes(config)
+				result <- routes
+			}()
+
+			select {
+			case routes := <-result:
+				setups[i] = setup{routes: routes, done: true}
+				if elapsed := time.Since(start); elapsed > slowSetup {
+					logging.Log(logging.Info, "Device type %T took %s to setup", d, elapsed.Round(time.Millisecond))
+				}
+			case <-time.After(timeout):
+				logging.Log(logging.Error, "Device type %T did not setup within %s, skipping", d, timeout)
+			}
+		}(i, d)
+	}
+
+	wg.Wait()
+	return setups
+}
+
+// deviceName returns the name of the device a route belongs to, subroutes such as /<name>/webhook are matched against the configured names.
+// Routes of devices that are not configured by name, e.g. discovered radiators, fall back to the last path element.
+func deviceName(p string, configured []string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if slices.Contains(configured, parts[i]) {
+			return parts[i]
+		}
+	}
+	return path.Base(p)
+}
+
+// enabled wraps a device handler so that it returns 503 while the device is out of rotation.
+func enabled(name string, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !common.Enabled(name) {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusServiceUnavailable, "Service Unavailable", nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+		handler(w, r)
+	}
+}
+
 // Use the number of '/' characters present in the route Paths to extract top level path names
 func (d *Devices) getTopLevelRouteNames() []string {
 	topLevelNames := []string{}
@@ -101,3 +401,58 @@ func (d *Devices) handler(w http.ResponseWriter, r *http.Request) {
 
 	httpCode, jsonResponse = common.SetJSONResponse(http.StatusOK, "OK", d.getTopLevelRouteNames())
 }
+
+// enabledHandler returns whether a device is in rotation, admins can take it out of or put it back into rotation with a PUT.
+func (d *Devices) enabledHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	name := mux.Vars(r)["name"]
+	if !slices.Contains(d.names, name) {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: name", nil)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusOK, "OK", map[string]bool{"enabled": common.Enabled(name)})
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	if !auth.IsAdmin(r, d.adminTokens) {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+
+	request := common.Request{}
+
+	if err := common.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	value, err := request.Value.Int64()
+	if err != nil || (value != 0 && value != 1) {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value (Min: 0, Max: 1)", nil)
+		return
+	}
+
+	common.SetEnabled(name, value == 1)
+	logging.Log(logging.Info, "Device \"%s\" enabled set to %t", name, value == 1)
+
+	httpCode, jsonResponse = common.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// Lint returns the unknown keys in a config file and in the device configs loaded from it, e.g. a misspelled timeoutMs, which would
+// otherwise be silently ignored.
+func Lint(configBytes []byte) []string {
+	return append(common.LintConfig(configBytes), common.TakeLints()...)
+}
@@ -0,0 +1,472 @@
+// Package doorbell turns doorbell presses received by webhook or MQTT into alerts with a camera snapshot attached.
+package doorbell
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/inbox"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+// alertTarget is a single pushover compatible endpoint that presses are fanned out to.
+type alertTarget struct {
+	URL      string        `yaml:"url"`
+	Token    config.Secret `yaml:"token"`
+	User     string        `yaml:"user"`
+	Priority int           `yaml:"priority"`
+}
+
+// press is the representation of a doorbell press returned by the last code.
+type press struct {
+	Time     string `json:"time"`
+	Source   string `json:"source"`
+	Snapshot bool   `json:"snapshot"`
+	Alerted  int    `json:"alerted"`
+}
+
+// doorbell represents a doorbell configuration with a snapshot source, alert targets and an optional MQTT trigger.
+type doorbell struct {
+	Name     string         `yaml:"name"`
+	Timeout  uint           `yaml:"timeoutMs"`
+	Message  string         `yaml:"message"`
+	Debounce uint           `yaml:"debounceMs"`
+	Alerts   []*alertTarget `yaml:"alerts"`
+	Snapshot struct {
+		URL      string        `yaml:"url"`
+		Username string        `yaml:"username"`
+		Password config.Secret `yaml:"password"`
+	} `yaml:"snapshot"`
+	MQTT struct {
+		Host    string `yaml:"host"`
+		Port    int    `yaml:"port"`
+		Topic   string `yaml:"topic"`
+		Payload string `yaml:"payload"`
+	} `yaml:"mqtt"`
+	Base  base
+	last  *press
+	mutex sync.Mutex
+}
+
+// base represents a list of doorbells
+type base struct {
+	Devices []*doorbell
+}
+
+type Device struct{}
+
+// DryRun lists the alerts a press would fan out, without fetching a snapshot or recording the press.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for doorbells based on a provided configuration and subscribes to any MQTT triggers.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	base, routes, err := routes(config)
+	if err != nil {
+		return routes, err
+	}
+
+	for _, d := range base.Devices {
+		if d.MQTT.Host == "" {
+			continue
+		}
+		clientOpts := mqtt.NewClientOptions()
+		clientOpts.SetCleanSession(false)
+		clientOpts.AddBroker(fmt.Sprintf("tcp://%s:%d", d.MQTT.Host, d.MQTT.Port))
+		clientOpts.SetClientID("restate-go-doorbell-" + d.Name)
+		d.subscribe(mqtt.NewClient(clientOpts))
+	}
+
+	return routes, err
+}
+
+// routes extracts doorbells from config, returning the control, webhook and last press routes of each.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "doorbell" {
+			continue
+		}
+		doorbell := doorbell{
+			Message:  "Someone is at the door",
+			Debounce: 10000,
+			Base:     base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &doorbell); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if doorbell.Name == "" || doorbell.Timeout == 0 || len(doorbell.Alerts) == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		for _, a := range doorbell.Alerts {
+			if a.URL == "" {
+				a.URL = "https://api.pushover.net/1/messages.json"
+			}
+		}
+
+		if doorbell.MQTT.Host != "" {
+			if doorbell.MQTT.Topic == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if doorbell.MQTT.Port == 0 {
+				doorbell.MQTT.Port = 1883
+			}
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + doorbell.Name,
+			Handler: doorbell.handler,
+		})
+
+		// Cameras cannot send a code, so any request to the webhook is treated as a press
+		routes = append(routes, router.Route{
+			Path:    "/" + doorbell.Name + "/webhook",
+			Handler: doorbell.webhookHandler,
+		})
+
+		routes = append(routes, router.Route{
+			Path:    "/" + doorbell.Name + "/last",
+			Handler: doorbell.lastHandler,
+		})
+
+		base.Devices = append(base.Devices, &doorbell)
+
+		logging.Log(logging.Info, "Found device \"%s\"", doorbell.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(base.Devices) == 1 {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/doorbell" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/doorbell",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/doorbell/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// subscribe connects an MQTT client and treats matching messages on the configured topic as presses.
+func (d *doorbell) subscribe(client mqtt.Client) {
+	token := client.Connect()
+	if err := mqtt.WaitTokenTimeout(token, time.Duration(d.Timeout)*time.Millisecond); err != nil {
+		logging.Log(logging.Error, "Doorbell \"%s\" failed to connect to MQTT: %v", d.Name, err)
+		return
+	}
+
+	token = client.Subscribe(d.MQTT.Topic, 0, func(_ mqtt.Client, message mqtt.Message) {
+		if d.MQTT.Payload != "" && string(message.Payload()) != d.MQTT.Payload {
+			return
+		}
+		d.press(context.Background(), "mqtt")
+	})
+	if err := mqtt.WaitTokenTimeout(token, time.Duration(d.Timeout)*time.Millisecond); err != nil {
+		logging.Log(logging.Error, "Doorbell \"%s\" failed to subscribe to MQTT topic: %v", d.Name, err)
+	}
+}
+
+// snapshot retrieves a JPEG from the configured camera, returning it base64 encoded.
+func (d *doorbell) snapshot() (string, error) {
+	client := &http.Client{
+		Timeout: time.Duration(d.Timeout) * time.Millisecond,
+	}
+
+	req, err := http.NewRequest("GET", d.Snapshot.URL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if d.Snapshot.Username != "" {
+		req.SetBasicAuth(d.Snapshot.Username, d.Snapshot.Password.Value())
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch snapshot: status code %d", resp.StatusCode)
+	}
+
+	imageData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(imageData), nil
+}
+
+// sendAlert posts an alert request to a single target.
+func (d *doorbell) sendAlert(ctx context.Context, target *alertTarget, request alert.Request) error {
+	client := &http.Client{
+		Timeout: time.Duration(d.Timeout) * time.Millisecond,
+	}
+
+	request.Token = target.Token.Value()
+	request.User = target.User
+	request.Priority = json.Number(fmt.Sprint(target.Priority))
+
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target.URL, bytes.NewReader(requestBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received status code %d from %s", resp.StatusCode, target.URL)
+	}
+
+	return nil
+}
+
+// press records a doorbell press and fans an alert out to every target, presses within the debounce window are ignored. Dry runs record the
+// alerts without fetching a snapshot or recording the press.
+func (d *doorbell) press(ctx context.Context, source string) *press {
+	now := time.Now()
+	dryRun := device.DryRunning(ctx)
+
+	d.mutex.Lock()
+	if d.last != nil {
+		lastTime, _ := time.Parse(time.RFC3339Nano, d.last.Time)
+		if now.Sub(lastTime) < time.Duration(d.Debounce)*time.Millisecond {
+			d.mutex.Unlock()
+			return nil
+		}
+	}
+	p := &press{
+		Time:   now.Format(time.RFC3339Nano),
+		Source: source,
+	}
+	if !dryRun {
+		d.last = p
+	}
+	d.mutex.Unlock()
+
+	request := alert.Request{
+		Message: d.Message,
+		Title:   "Doorbell",
+	}
+
+	if d.Snapshot.URL != "" && !dryRun {
+		attachment, err := d.snapshot()
+		if err != nil {
+			logging.Log(logging.Error, "Doorbell \"%s\" failed to fetch snapshot: %v", d.Name, err)
+		} else {
+			request.AttachmentBase64 = attachment
+			request.AttachmentType = "image/jpeg"
+		}
+	}
+
+	if !dryRun {
+		inbox.Record("doorbell/"+d.Name, request.Title, request.Message, 0)
+	}
+
+	var wg sync.WaitGroup
+	var alerted int
+	var alertedMutex sync.Mutex
+	for _, target := range d.Alerts {
+		wg.Add(1)
+		go func(target *alertTarget) {
+			defer wg.Done()
+			if err := d.sendAlert(ctx, target, request); err != nil {
+				logging.Log(logging.Error, "Doorbell \"%s\" failed to send alert: %v", d.Name, err)
+				return
+			}
+			alertedMutex.Lock()
+			alerted++
+			alertedMutex.Unlock()
+		}(target)
+	}
+	wg.Wait()
+
+	d.mutex.Lock()
+	p.Snapshot = request.AttachmentBase64 != ""
+	p.Alerted = alerted
+	d.mutex.Unlock()
+
+	logging.Log(logging.Info, "Doorbell \"%s\" pressed via %s, alerted %d of %d targets", d.Name, source, alerted, len(d.Alerts))
+	return p
+}
+
+// lastPress returns a copy of the most recent press, or nil if there has not been one.
+func (d *doorbell) lastPress() *press {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.last == nil {
+		return nil
+	}
+	p := *d.last
+	return &p
+}
+
+// lastData returns the most recent press for use as response data, omitting data entirely if there has not been one.
+func (d *doorbell) lastData() any {
+	if p := d.lastPress(); p != nil {
+		return p
+	}
+	return nil
+}
+
+// getCodes returns a list of control codes for a doorbell.
+func getCodes() []string {
+	return []string{"press", "last"}
+}
+
+// Handler is the HTTP handler for doorbell control.
+func (d *doorbell) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "press":
+		p := d.press(r.Context(), "api")
+		if p == nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusTooManyRequests, "Too Many Requests", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", p)
+	case "last":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", d.lastData())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+	}
+}
+
+// webhookHandler is the HTTP handler for press notifications sent by Reolink or Amcrest doorbells.
+func (d *doorbell) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	// Alerting can take a while with a snapshot attached, so respond to the camera straight away, dry runs wait to return the alerts
+	if device.DryRunning(r.Context()) {
+		d.press(r.Context(), "webhook")
+	} else {
+		go d.press(context.Background(), "webhook")
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// lastHandler is the HTTP handler for retrieving the most recent press.
+func (d *doorbell) lastHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method != http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", d.lastData())
+}
+
+// getDeviceNames returns the names of all doorbells in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured doorbells.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
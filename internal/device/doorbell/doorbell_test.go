@@ -0,0 +1,309 @@
+package doorbell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	mockMqtt "github.com/kennedn/restate-go/internal/mqtt/frigate/mock"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read doorbell input")
+	}
+
+	doorbellConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &doorbellConfig); err != nil {
+		t.Fatalf("Could not read doorbell input")
+	}
+	return &doorbellConfig
+}
+
+// recorder captures alert requests received by a mock pushover server.
+type recorder struct {
+	mutex    sync.Mutex
+	requests []alert.Request
+}
+
+func (r *recorder) tokens() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var tokens []string
+	for _, request := range r.requests {
+		tokens = append(tokens, request.Token)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// setupHTTPServer serves a snapshot on /snapshot.jpg and records alerts posted to /alert.
+func setupHTTPServer(t *testing.T, alerts *recorder) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/snapshot.jpg":
+			if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("jpeg"))
+		case "/alert":
+			request := alert.Request{}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			alerts.mutex.Lock()
+			alerts.requests = append(alerts.requests, request)
+			alerts.mutex.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":1,"request":"xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/doorbellConfig/normal_config.yaml",
+			routeCount:    8,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/doorbellConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/doorbellConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/doorbellConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/doorbellConfig/single_device_config.yaml",
+			routeCount:    3,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestPress(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	alerts := &recorder{}
+	server := setupHTTPServer(t, alerts)
+	defer server.Close()
+
+	base, _, err := routes(loadConfig(t, "testdata/doorbellConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	front := base.Devices[0]
+	front.Snapshot.URL = server.URL + "/snapshot.jpg"
+	for _, a := range front.Alerts {
+		a.URL = server.URL + "/alert"
+	}
+
+	// Dry runs record the alerts without sending them or counting as a press
+	ctx, dryRun := device.WithDryRun(context.Background())
+	assert.NotNil(t, front.press(ctx, "api"))
+	calls := dryRun.Calls()
+	assert.Len(t, calls, 2)
+	for _, call := range calls {
+		assert.Equal(t, server.URL+"/alert", call.URL)
+		assert.Equal(t, device.Redacted, call.Payload.(map[string]any)["token"])
+	}
+	assert.Empty(t, alerts.requests)
+	assert.Nil(t, front.lastPress())
+
+	p := front.press(context.Background(), "api")
+	assert.NotNil(t, p)
+	assert.True(t, p.Snapshot)
+	assert.Equal(t, 2, p.Alerted)
+	assert.Equal(t, []string{"token-one", "token-two"}, alerts.tokens())
+	for _, request := range alerts.requests {
+		assert.Equal(t, "anBlZw==", request.AttachmentBase64)
+		assert.Equal(t, "image/jpeg", request.AttachmentType)
+	}
+
+	// A second press inside the debounce window is ignored
+	assert.Nil(t, front.press(context.Background(), "api"))
+	assert.Len(t, alerts.requests, 2)
+	assert.Equal(t, p, front.lastPress())
+}
+
+func TestSubscribe(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	alerts := &recorder{}
+	server := setupHTTPServer(t, alerts)
+	defer server.Close()
+
+	base, _, err := routes(loadConfig(t, "testdata/doorbellConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	back := base.Devices[1]
+	back.Alerts[0].URL = server.URL + "/alert"
+
+	back.subscribe(&mockMqtt.Client{
+		SubscribeFunc: func(client mqtt.Client, callback mqtt.MessageHandler) {
+			callback(client, &mockMqtt.Message{PayloadVar: []byte("off")})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte("on")})
+		},
+	})
+
+	assert.Equal(t, []string{"token-one"}, alerts.tokens())
+	assert.Equal(t, "mqtt", back.lastPress().Source)
+	assert.False(t, back.lastPress().Snapshot)
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/doorbell/front",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["press","last"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/doorbell/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["front","back"]}`,
+		},
+		{
+			name:         "last_before_press",
+			method:       "GET",
+			url:          "/doorbell/front/last",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "last_code_before_press",
+			method:       "POST",
+			url:          "/doorbell/front?code=last",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "unsupported_last_method",
+			method:       "POST",
+			url:          "/doorbell/front/last",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_webhook_method",
+			method:       "DELETE",
+			url:          "/doorbell/front/webhook",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/doorbell/front?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/doorbell/front",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/doorbell/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	_, routes, err := routes(loadConfig(t, "testdata/doorbellConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package device
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// dryRunner is implemented by device types whose handlers send upstream calls with the request context, so that they can be previewed.
+type dryRunner interface {
+	DryRun() bool
+}
+
+// supportsDryRun reports whether a device type can preview its upstream calls.
+func supportsDryRun(d Device) bool {
+	runner, ok := d.(dryRunner)
+	return ok && runner.DryRun()
+}
+
+// dryRun wraps a device handler so that POSTs with a dryRun query parameter are validated as normal but return the upstream calls they would make instead of making them.
+// Requests that fail validation, or that only read state, return the handler's own response. Device types that cannot preview their calls return 501 rather than risk acting.
+func dryRun(supported bool, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodPost || !query.Has("dryRun") {
+			handler(w, r)
+			return
+		}
+
+		enabled, err := strconv.ParseBool(query.Get("dryRun"))
+		if err != nil {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: dryRun", nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+
+		// Device handlers reject unknown query parameters
+		query.Del("dryRun")
+		r.URL.RawQuery = query.Encode()
+
+		if !enabled {
+			handler(w, r)
+			return
+		}
+
+		if !supported {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusNotImplemented, "Not Implemented", nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+
+		ctx, run := common.WithDryRun(r.Context())
+		recorder := recorder{}
+		handler(&recorder, r.WithContext(ctx))
+
+		calls := run.Calls()
+		if len(calls) == 0 {
+			copyResponse(w, &recorder)
+			return
+		}
+
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", struct {
+			DryRun bool          `json:"dryRun"`
+			Calls  []common.Call `json:"calls"`
+		}{
+			DryRun: true,
+			Calls:  calls,
+		})
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}
+}
@@ -0,0 +1,55 @@
+package device
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupportsDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	// Every registered device type must be able to preview its calls, or dry runs of it would be turned away with 501
+	for _, d := range devices {
+		assert.True(t, supportsDryRun(d), "%T does not support dry runs", d)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, "http://192.0.2.1/config", nil)
+		common.Do(http.DefaultClient, req)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	for _, tc := range []struct {
+		supported    bool
+		query        string
+		expectedCode int
+		expectedBody string
+		expectCall   bool
+	}{
+		{supported: true, query: "?dryRun=true", expectedCode: 200, expectedBody: `{"version":1,"message":"OK","data":{"dryRun":true,"calls":[{"method":"POST","url":"http://192.0.2.1/config"}]}}`, expectCall: true},
+		{supported: false, query: "?dryRun=true", expectedCode: 501, expectedBody: `{"version":1,"message":"Not Implemented"}`},
+		{supported: true, query: "?dryRun=maybe", expectedCode: 400, expectedBody: `{"version":1,"message":"Invalid Parameter: dryRun"}`},
+	} {
+		t.Run(fmt.Sprintf("%t%s", tc.supported, tc.query), func(t *testing.T) {
+			calls = 0
+			recorder := httptest.NewRecorder()
+			dryRun(tc.supported, handler)(recorder, httptest.NewRequest(http.MethodPost, "/lamp"+tc.query, nil))
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+			assert.Equal(t, tc.expectedBody, recorder.Body.String())
+			assert.Equal(t, tc.expectCall, calls == 1)
+		})
+	}
+}
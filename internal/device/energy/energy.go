@@ -0,0 +1,424 @@
+// Package energy provides current and upcoming electricity prices from Octopus Agile or Nord Pool tariffs.
+package energy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// price is a single tariff slot.
+type price struct {
+	Price     float64 `json:"price"`
+	ValidFrom string  `json:"validFrom"`
+	ValidTo   string  `json:"validTo"`
+	from      time.Time
+	to        time.Time
+}
+
+// status is the representation of the tariff returned by the status code.
+type status struct {
+	Unit     string   `json:"unit"`
+	Current  *price   `json:"current,omitempty"`
+	Upcoming []*price `json:"upcoming,omitempty"`
+}
+
+// octopusResponse represents the raw response from the Octopus standard-unit-rates endpoint.
+type octopusResponse struct {
+	Results []struct {
+		ValueIncVat float64 `json:"value_inc_vat"`
+		ValidFrom   string  `json:"valid_from"`
+		ValidTo     string  `json:"valid_to"`
+	} `json:"results"`
+}
+
+// nordpoolResponse represents the raw response from the Nord Pool day ahead prices endpoint.
+type nordpoolResponse struct {
+	MultiAreaEntries []struct {
+		DeliveryStart string             `json:"deliveryStart"`
+		DeliveryEnd   string             `json:"deliveryEnd"`
+		EntryPerArea  map[string]float64 `json:"entryPerArea"`
+	} `json:"multiAreaEntries"`
+}
+
+// energy represents a tariff configuration with name, provider and provider specific parameters.
+type energy struct {
+	Name     string `yaml:"name"`
+	Timeout  uint   `yaml:"timeoutMs"`
+	Provider string `yaml:"provider"`
+	URL      string `yaml:"url"`
+	Product  string `yaml:"product"`
+	Tariff   string `yaml:"tariff"`
+	Area     string `yaml:"area"`
+	Currency string `yaml:"currency"`
+	Base     base
+}
+
+// base represents a list of tariffs
+type base struct {
+	Devices []*energy
+}
+
+type Device struct{}
+
+// DryRun is always safe, tariffs are only ever read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for tariffs based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Octopus and Nord Pool tariffs from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "energy" {
+			continue
+		}
+		energy := energy{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &energy); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if energy.Name == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch energy.Provider {
+		case "octopus":
+			if energy.Product == "" || energy.Tariff == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if energy.URL == "" {
+				energy.URL = "https://api.octopus.energy"
+			}
+		case "nordpool":
+			if energy.Area == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if energy.Currency == "" {
+				energy.Currency = "EUR"
+			}
+			if energy.URL == "" {
+				energy.URL = "https://dataportal-api.nordpoolgroup.com"
+			}
+		default:
+			logging.Log(logging.Info, "Unable to load device: provider must be either 'octopus' or 'nordpool'")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + energy.Name,
+			Handler: energy.handler,
+		})
+
+		base.Devices = append(base.Devices, &energy)
+
+		logging.Log(logging.Info, "Found device \"%s\"", energy.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/energy" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/energy",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/energy/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// unit returns the unit that prices are reported in.
+func (e *energy) unit() string {
+	if e.Provider == "octopus" {
+		return "p/kWh"
+	}
+	return e.Currency + "/MWh"
+}
+
+// get sends a GET request to the provider and decodes the JSON response into v.
+func (e *energy) get(requestUrl string, v any) error {
+	client := &http.Client{
+		Timeout: time.Duration(e.Timeout) * time.Millisecond,
+	}
+
+	resp, err := client.Get(requestUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// newPrice parses provider timestamps into a price slot.
+func newPrice(value float64, validFrom string, validTo string) (*price, error) {
+	from, err := time.Parse(time.RFC3339, validFrom)
+	if err != nil {
+		return nil, err
+	}
+	to, err := time.Parse(time.RFC3339, validTo)
+	if err != nil {
+		return nil, err
+	}
+	return &price{
+		Price:     value,
+		ValidFrom: from.Format(time.RFC3339),
+		ValidTo:   to.Format(time.RFC3339),
+		from:      from,
+		to:        to,
+	}, nil
+}
+
+// prices retrieves all known price slots from now onwards, sorted by start time.
+func (e *energy) prices(now time.Time) ([]*price, error) {
+	var prices []*price
+
+	switch e.Provider {
+	case "octopus":
+		query := url.Values{}
+		query.Set("period_from", now.UTC().Truncate(30*time.Minute).Format(time.RFC3339))
+		requestUrl := fmt.Sprintf("%s/v1/products/%s/electricity-tariffs/%s/standard-unit-rates/?%s", e.URL, e.Product, e.Tariff, query.Encode())
+
+		response := octopusResponse{}
+		if err := e.get(requestUrl, &response); err != nil {
+			return nil, err
+		}
+
+		for _, r := range response.Results {
+			p, err := newPrice(r.ValueIncVat, r.ValidFrom, r.ValidTo)
+			if err != nil {
+				return nil, err
+			}
+			prices = append(prices, p)
+		}
+	case "nordpool":
+		// Day ahead prices are published around midday, so tomorrow's prices may not exist yet
+		for _, day := range []time.Time{now, now.AddDate(0, 0, 1)} {
+			query := url.Values{}
+			query.Set("date", day.Format("2006-01-02"))
+			query.Set("market", "DayAhead")
+			query.Set("deliveryArea", e.Area)
+			query.Set("currency", e.Currency)
+			requestUrl := fmt.Sprintf("%s/api/DayAheadPrices?%s", e.URL, query.Encode())
+
+			response := nordpoolResponse{}
+			if err := e.get(requestUrl, &response); err != nil {
+				if len(prices) > 0 {
+					break
+				}
+				return nil, err
+			}
+
+			for _, r := range response.MultiAreaEntries {
+				p, err := newPrice(r.EntryPerArea[e.Area], r.DeliveryStart, r.DeliveryEnd)
+				if err != nil {
+					return nil, err
+				}
+				prices = append(prices, p)
+			}
+		}
+	}
+
+	sort.SliceStable(prices, func(i int, j int) bool {
+		return prices[i].from.Before(prices[j].from)
+	})
+
+	// Discard slots that have already ended
+	for len(prices) > 0 && !prices[0].to.After(now) {
+		prices = prices[1:]
+	}
+
+	if len(prices) == 0 {
+		return nil, errors.New("no prices returned from provider")
+	}
+
+	return prices, nil
+}
+
+// status returns the current price slot along with all upcoming slots.
+func (e *energy) status(now time.Time) (*status, error) {
+	prices, err := e.prices(now)
+	if err != nil {
+		return nil, err
+	}
+
+	status := status{
+		Unit: e.unit(),
+	}
+
+	if !prices[0].from.After(now) {
+		status.Current = prices[0]
+		prices = prices[1:]
+	}
+	status.Upcoming = prices
+
+	return &status, nil
+}
+
+// cheapest returns the cheapest window of consecutive slots, with price being the average across the window.
+func (e *energy) cheapest(now time.Time, slots int) (*price, error) {
+	prices, err := e.prices(now)
+	if err != nil {
+		return nil, err
+	}
+
+	if slots > len(prices) {
+		return nil, fmt.Errorf("only %d slots are available", len(prices))
+	}
+
+	var best *price
+	for i := 0; i+slots <= len(prices); i++ {
+		total := 0.0
+		for _, p := range prices[i : i+slots] {
+			total += p.Price
+		}
+		average := total / float64(slots)
+		if best == nil || average < best.Price {
+			best = &price{
+				Price:     average,
+				ValidFrom: prices[i].ValidFrom,
+				ValidTo:   prices[i+slots-1].ValidTo,
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// getCodes returns a list of control codes for a tariff.
+func getCodes() []string {
+	return []string{"status", "cheapest"}
+}
+
+// Handler is the HTTP handler for tariff requests.
+func (e *energy) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "status":
+		status, err := e.status(time.Now())
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", status)
+	case "cheapest":
+		slots := int64(1)
+		if request.Value != "" {
+			var err error
+			slots, err = request.Value.Int64()
+			if err != nil || slots < 1 {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+				return
+			}
+		}
+		cheapest, err := e.cheapest(time.Now(), int(slots))
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", cheapest)
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+	}
+}
+
+// getDeviceNames returns the names of all tariffs in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured tariffs.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
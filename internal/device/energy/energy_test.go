@@ -0,0 +1,295 @@
+package energy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read energy input")
+	}
+
+	energyConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &energyConfig); err != nil {
+		t.Fatalf("Could not read energy input")
+	}
+	return &energyConfig
+}
+
+// setupHTTPServer serves a canned provider response for 2024-06-21, other dates have no content like the real APIs.
+func setupHTTPServer(t *testing.T, responsePath string, httpCode int) *httptest.Server {
+	response, err := os.ReadFile(responsePath)
+	if err != nil {
+		t.Fatalf("Could not read responsePath")
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if date := r.URL.Query().Get("date"); date != "" && date != "2024-06-21" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(httpCode)
+		w.Write(response)
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/energyConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/energyConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/energyConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/energyConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/energyConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	now := time.Date(2024, 6, 21, 12, 40, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		energy           *energy
+		responsePath     string
+		expectedUnit     string
+		expectedCurrent  float64
+		expectedUpcoming []float64
+	}{
+		{
+			name:             "octopus",
+			energy:           &energy{Provider: "octopus", Product: "AGILE-24-10-01", Tariff: "E-1R-AGILE-24-10-01-C"},
+			responsePath:     "testdata/serverConfig/octopus_responses.json",
+			expectedUnit:     "p/kWh",
+			expectedCurrent:  15.0,
+			expectedUpcoming: []float64{10.0, 21.0},
+		},
+		{
+			name:             "nordpool",
+			energy:           &energy{Provider: "nordpool", Area: "NO1", Currency: "NOK"},
+			responsePath:     "testdata/serverConfig/nordpool_responses.json",
+			expectedUnit:     "NOK/MWh",
+			expectedCurrent:  400.5,
+			expectedUpcoming: []float64{380.25},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := setupHTTPServer(t, tc.responsePath, http.StatusOK)
+			defer server.Close()
+			tc.energy.URL = server.URL
+			tc.energy.Timeout = 1000
+
+			status, err := tc.energy.status(now)
+			if err != nil {
+				t.Fatalf("status returned an error: %v", err)
+			}
+
+			assert.Equal(t, tc.expectedUnit, status.Unit)
+			assert.Equal(t, tc.expectedCurrent, status.Current.Price)
+
+			var upcoming []float64
+			for _, p := range status.Upcoming {
+				upcoming = append(upcoming, p.Price)
+			}
+			assert.Equal(t, tc.expectedUpcoming, upcoming)
+		})
+	}
+}
+
+func TestCheapest(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	now := time.Date(2024, 6, 21, 12, 10, 0, 0, time.UTC)
+
+	server := setupHTTPServer(t, "testdata/serverConfig/octopus_responses.json", http.StatusOK)
+	defer server.Close()
+
+	e := &energy{Provider: "octopus", URL: server.URL, Timeout: 1000}
+
+	testCases := []struct {
+		name          string
+		slots         int
+		expectedPrice *price
+		expectError   bool
+	}{
+		{
+			name:          "single_slot",
+			slots:         1,
+			expectedPrice: &price{Price: 10.0, ValidFrom: "2024-06-21T13:00:00Z", ValidTo: "2024-06-21T13:30:00Z"},
+		},
+		{
+			name:          "two_slots",
+			slots:         2,
+			expectedPrice: &price{Price: 12.5, ValidFrom: "2024-06-21T12:30:00Z", ValidTo: "2024-06-21T13:30:00Z"},
+		},
+		{
+			name:        "too_many_slots",
+			slots:       5,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cheapest, err := e.cheapest(now, tc.slots)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPrice, cheapest)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/energy/prices",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","cheapest"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/energy/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["prices","nordpool"]}`,
+		},
+		{
+			name:         "status_server_error",
+			method:       "POST",
+			url:          "/energy/prices?code=status",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "cheapest_invalid_value",
+			method:       "POST",
+			url:          "/energy/prices?code=cheapest&value=0",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/energy/prices?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/energy/prices",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/energy/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	server := setupHTTPServer(t, "testdata/serverConfig/octopus_responses.json", http.StatusInternalServerError)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/energyConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		d.URL = server.URL
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+// Package fronius provides PV generation, battery and grid readings from Fronius inverters via the Solar API v1.
+package fronius
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rawResponse represents the response from the GetPowerFlowRealtimeData endpoint, powers are in watts and may be null.
+type rawResponse struct {
+	Body struct {
+		Data struct {
+			Site struct {
+				PGrid *float64 `json:"P_Grid"`
+				PPV   *float64 `json:"P_PV"`
+				PAkku *float64 `json:"P_Akku"`
+				PLoad *float64 `json:"P_Load"`
+				EDay  *float64 `json:"E_Day"`
+			} `json:"Site"`
+			Inverters map[string]struct {
+				SOC *float64 `json:"SOC"`
+			} `json:"Inverters"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head struct {
+		Status struct {
+			Code   int    `json:"Code"`
+			Reason string `json:"Reason"`
+		} `json:"Status"`
+	} `json:"Head"`
+}
+
+// status is the representation of the site returned by the status code, powers are in watts.
+type status struct {
+	PV         float64  `json:"pv"`
+	Load       float64  `json:"load"`
+	Grid       float64  `json:"grid"`
+	Import     float64  `json:"import"`
+	Export     float64  `json:"export"`
+	Battery    float64  `json:"battery"`
+	BatterySoc *float64 `json:"batterySoc,omitempty"`
+	EnergyDay  float64  `json:"energyDay"`
+}
+
+// fronius represents an inverter configuration with name and host.
+type fronius struct {
+	Name    string `yaml:"name"`
+	Host    string `yaml:"host"`
+	Timeout uint   `yaml:"timeoutMs"`
+	Base    base
+}
+
+// base represents a list of inverters
+type base struct {
+	Devices []*fronius
+}
+
+type Device struct{}
+
+// DryRun is always safe, inverters are only ever read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for inverters based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Fronius inverters from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "fronius" {
+			continue
+		}
+		fronius := fronius{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &fronius); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if fronius.Name == "" || fronius.Host == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + fronius.Name,
+			Handler: fronius.handler,
+		})
+
+		base.Devices = append(base.Devices, &fronius)
+
+		logging.Log(logging.Info, "Found device \"%s\"", fronius.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/fronius" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/fronius",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/fronius/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// value dereferences a nullable reading, the inverter reports null for absent components or at night.
+func value(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// status retrieves and summarises the current power flow of the site.
+func (f *fronius) status() (*status, error) {
+	client := &http.Client{
+		Timeout: time.Duration(f.Timeout) * time.Millisecond,
+	}
+
+	resp, err := client.Get(fmt.Sprintf("http://%s/solar_api/v1/GetPowerFlowRealtimeData.fcgi", f.Host))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := rawResponse{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	if raw.Head.Status.Code != 0 {
+		return nil, fmt.Errorf("inverter returned status %d: %s", raw.Head.Status.Code, raw.Head.Status.Reason)
+	}
+
+	site := raw.Body.Data.Site
+	status := status{
+		PV: value(site.PPV),
+		// Load is reported as a negative consumption figure
+		Load:      -value(site.PLoad),
+		Grid:      value(site.PGrid),
+		Battery:   value(site.PAkku),
+		EnergyDay: value(site.EDay),
+	}
+
+	// Positive grid power is import, negative is export
+	if status.Grid > 0 {
+		status.Import = status.Grid
+	} else {
+		status.Export = -status.Grid
+	}
+
+	for _, inverter := range raw.Body.Data.Inverters {
+		if inverter.SOC != nil {
+			status.BatterySoc = inverter.SOC
+			break
+		}
+	}
+
+	return &status, nil
+}
+
+// getCodes returns a list of control codes for an inverter.
+func getCodes() []string {
+	return []string{"status"}
+}
+
+// Handler is the HTTP handler for inverter requests.
+func (f *fronius) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if request.Code != "status" {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	status, err := f.status()
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", status)
+}
+
+// getDeviceNames returns the names of all inverters in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured inverters.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,242 @@
+package fronius
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type code struct {
+	Name     string `yaml:"name"`
+	HttpCode int    `yaml:"httpCode"`
+	Json     string `yaml:"json"`
+}
+
+type serverConfig struct {
+	Codes []code
+}
+
+func findCode(name string, serverConfig *serverConfig) *code {
+	for _, s := range serverConfig.Codes {
+		if s.Name == name {
+			return &s
+		}
+	}
+	return nil
+}
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read fronius input")
+	}
+
+	froniusConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &froniusConfig); err != nil {
+		t.Fatalf("Could not read fronius input")
+	}
+	return &froniusConfig
+}
+
+// setupHTTPServer serves the named response from serverConfigPath, selected by the value pointed to by response.
+func setupHTTPServer(t *testing.T, serverConfigPath string, response *string) *httptest.Server {
+	serverConfigFile, err := os.ReadFile(serverConfigPath)
+	if err != nil {
+		t.Fatalf("Could not read serverConfigPath")
+	}
+
+	serverConfig := &serverConfig{}
+	if err := yaml.Unmarshal(serverConfigFile, &serverConfig); err != nil {
+		t.Fatalf("Could not parse serverConfigPath")
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/solar_api/v1/GetPowerFlowRealtimeData.fcgi" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp := findCode(*response, serverConfig)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.HttpCode)
+		w.Write([]byte(resp.Json))
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/froniusConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/froniusConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/froniusConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/froniusConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/froniusConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		response     string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/fronius/roof",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/fronius/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["roof","garage"]}`,
+		},
+		{
+			name:         "status_exporting",
+			method:       "POST",
+			url:          "/fronius/roof?code=status",
+			response:     "exporting",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"pv":3200,"load":1500,"grid":-1200.5,"import":0,"export":1200.5,"battery":-500,"batterySoc":84.5,"energyDay":8123}}`,
+		},
+		{
+			name:         "status_night",
+			method:       "POST",
+			url:          "/fronius/roof?code=status",
+			response:     "night",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"pv":0,"load":450,"grid":450,"import":450,"export":0,"battery":0,"energyDay":0}}`,
+		},
+		{
+			name:         "status_inverter_error",
+			method:       "POST",
+			url:          "/fronius/roof?code=status",
+			response:     "inverter-error",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "status_internal_error",
+			method:       "POST",
+			url:          "/fronius/roof?code=status",
+			response:     "internal-error",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/fronius/roof?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/fronius/roof",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/fronius/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	response := ""
+	server := setupHTTPServer(t, "testdata/serverConfig/normal_responses.yaml", &response)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/froniusConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		d.Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response = tc.response
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+// Package garage provides control of garage doors driven by a relay or opener, with interlocks that stop the door being closed while it
+// is obstructed and an optional timer that closes a door left open.
+package garage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driver is implemented by each supported opener. Openers with a single button move the door either way, so open and close are only
+// called once the door is known to be in the other state.
+type driver interface {
+	open(ctx context.Context) error
+	close(ctx context.Context) error
+	closed() (bool, error)
+}
+
+var (
+	errObstructed = errors.New("door is obstructed")
+	errInterlock  = errors.New("unable to read interlock")
+)
+
+// status is the representation of a garage door returned by the status code. Obstructed is omitted without interlocks and autoClose
+// while the door is closed or has no timer.
+type status struct {
+	State      string `json:"state"`
+	Obstructed *bool  `json:"obstructed,omitempty"`
+	AutoClose  string `json:"autoClose,omitempty"`
+}
+
+// interlock is a request whose response reports an obstruction at a dot separated path into data, e.g. a beam sensor across the door.
+type interlock struct {
+	device.Action `yaml:",inline"`
+	Field         string `yaml:"field"`
+	// Value of the field while obstructed
+	Obstructed string `yaml:"obstructed"`
+}
+
+// garage represents a garage door configuration with name, driver, driver specific parameters, interlocks and auto close timer.
+type garage struct {
+	Name       string       `yaml:"name"`
+	Timeout    uint         `yaml:"timeoutMs"`
+	Driver     string       `yaml:"driver"`
+	Shelly     *shelly      `yaml:"shelly"`
+	Meross     *msg100      `yaml:"meross"`
+	AutoClose  uint         `yaml:"autoCloseMinutes"`
+	Poll       uint         `yaml:"pollSeconds"`
+	Interlocks []*interlock `yaml:"interlocks"`
+	Base       base
+	driver     driver
+	// When the door was seen open, the auto close timer runs from here. Zero while the door is closed.
+	opened time.Time
+	// Requests that move the door wait for each other, so that a single button opener is not pulsed twice
+	moving sync.Mutex
+	mutex  sync.Mutex
+}
+
+// base represents a list of garage doors
+type base struct {
+	Devices []*garage
+}
+
+type Device struct{}
+
+// DryRun previews pulses to the opener, the door and interlocks are still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for garage doors based on a provided configuration and starts the auto close timer of each.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	base, routes, err := routes(config)
+	if err != nil {
+		return routes, err
+	}
+
+	for _, g := range base.Devices {
+		if g.AutoClose > 0 {
+			go g.run()
+		}
+	}
+
+	return routes, err
+}
+
+// routes extracts Shelly and Meross garage doors from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "garage" {
+			continue
+		}
+		garage := garage{
+			Poll: 30,
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &garage); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if garage.Name == "" || garage.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch garage.Driver {
+		case "shelly":
+			if garage.Shelly == nil || garage.Shelly.Host == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if garage.Shelly.PulseMs == 0 {
+				garage.Shelly.PulseMs = 500
+			}
+			garage.Shelly.timeout = garage.Timeout
+			garage.driver = garage.Shelly
+		case "meross":
+			if garage.Meross == nil || garage.Meross.Host == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			garage.Meross.timeout = garage.Timeout
+			garage.driver = garage.Meross
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'shelly' or 'meross'")
+			continue
+		}
+
+		if err := garage.validate(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", garage.Name, err)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + garage.Name,
+			Handler: garage.handler,
+		})
+
+		base.Devices = append(base.Devices, &garage)
+
+		logging.Log(logging.Info, "Found device \"%s\"", garage.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/garage" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/garage",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/garage/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// validate checks the interlocks and timer, filling in defaults.
+func (g *garage) validate() error {
+	if g.Poll == 0 {
+		return errors.New("pollSeconds must be greater than 0")
+	}
+	for _, i := range g.Interlocks {
+		if i.URL == "" || i.Code == "" || i.Field == "" {
+			return errors.New("interlocks need a url, code and field")
+		}
+		if i.Obstructed == "" {
+			i.Obstructed = "true"
+		}
+	}
+	return nil
+}
+
+// read returns the value of the interlock field formatted as a string, so that it can be compared with the obstructed value.
+func (i *interlock) read(timeout uint) (string, error) {
+	response, code, err := i.Post(timeout)
+	if err != nil {
+		return "", err
+	} else if code != http.StatusOK {
+		return "", fmt.Errorf("received status code %d from %s", code, i.URL)
+	}
+
+	data := response.Data
+	for _, key := range strings.Split(i.Field, ".") {
+		object, ok := data.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("field \"%s\" not found", i.Field)
+		}
+		if data, ok = object[key]; !ok {
+			return "", fmt.Errorf("field \"%s\" not found", i.Field)
+		}
+	}
+
+	switch v := data.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("field \"%s\" is not a value", i.Field)
+}
+
+// obstructed reports whether any interlock reports an obstruction. An interlock that cannot be read is an error, so that the door is
+// not closed without knowing whether it is clear.
+func (g *garage) obstructed() (bool, error) {
+	for _, i := range g.Interlocks {
+		value, err := i.read(g.Timeout)
+		if err != nil {
+			return false, fmt.Errorf("%w %s: %v", errInterlock, i.URL, err)
+		}
+		if strings.EqualFold(value, i.Obstructed) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// open opens the door unless it is already open, starting the auto close timer outside of a dry run.
+func (g *garage) open(ctx context.Context, now time.Time) error {
+	g.moving.Lock()
+	defer g.moving.Unlock()
+
+	closed, err := g.driver.closed()
+	if err != nil || !closed {
+		return err
+	}
+	if err := g.driver.open(ctx); err != nil {
+		return err
+	}
+	if device.DryRunning(ctx) {
+		return nil
+	}
+
+	g.mutex.Lock()
+	g.opened = now
+	g.mutex.Unlock()
+	logging.Log(logging.Info, "Opened \"%s\"", g.Name)
+	return nil
+}
+
+// close closes the door unless it is already closed, refusing while an interlock reports an obstruction.
+func (g *garage) close(ctx context.Context) error {
+	g.moving.Lock()
+	defer g.moving.Unlock()
+
+	closed, err := g.driver.closed()
+	if err != nil || closed {
+		return err
+	}
+	obstructed, err := g.obstructed()
+	if err != nil {
+		return err
+	} else if obstructed {
+		return errObstructed
+	}
+	if err := g.driver.close(ctx); err != nil {
+		return err
+	}
+	if device.DryRunning(ctx) {
+		return nil
+	}
+	logging.Log(logging.Info, "Closed \"%s\"", g.Name)
+	return nil
+}
+
+// check reads the state of the door and closes it once it has been open for the auto close time. The timer restarts with each attempt,
+// so that an obstructed door or one that failed to close is retried rather than pulsed again while it is still moving.
+func (g *garage) check(now time.Time) error {
+	closed, err := g.driver.closed()
+	if err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	if closed {
+		g.opened = time.Time{}
+		g.mutex.Unlock()
+		return nil
+	}
+	if g.opened.IsZero() {
+		g.opened = now
+	}
+	due := now.Sub(g.opened) >= time.Duration(g.AutoClose)*time.Minute
+	if due {
+		g.opened = now
+	}
+	g.mutex.Unlock()
+
+	if !due {
+		return nil
+	}
+	logging.Log(logging.Info, "Closing \"%s\" after %d minutes open", g.Name, g.AutoClose)
+	return g.close(context.Background())
+}
+
+// run checks the door at the configured interval for the lifetime of the process.
+func (g *garage) run() {
+	ticker := time.NewTicker(time.Duration(g.Poll) * time.Second)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		if err := g.check(time.Now()); err != nil {
+			logging.Log(logging.Error, "Unable to auto close \"%s\": %v", g.Name, err)
+		}
+	}
+}
+
+// status returns the state of the door, whether it is obstructed and when it will be closed automatically.
+func (g *garage) status() (*status, error) {
+	closed, err := g.driver.closed()
+	if err != nil {
+		return nil, err
+	}
+
+	status := status{
+		State: "open",
+	}
+	if closed {
+		status.State = "closed"
+	}
+
+	if len(g.Interlocks) > 0 {
+		obstructed, err := g.obstructed()
+		if err != nil {
+			return nil, err
+		}
+		status.Obstructed = &obstructed
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !closed && g.AutoClose > 0 && !g.opened.IsZero() {
+		status.AutoClose = g.opened.Add(time.Duration(g.AutoClose) * time.Minute).Format(time.RFC3339)
+	}
+	return &status, nil
+}
+
+// getCodes returns a list of control codes for a garage door.
+func getCodes() []string {
+	return []string{"status", "open", "close"}
+}
+
+// Handler is the HTTP handler for garage door control.
+func (g *garage) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = g.status()
+	case "open":
+		err = g.open(r.Context(), time.Now())
+	case "close":
+		err = g.close(r.Context())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	switch {
+	case errors.Is(err, errObstructed):
+		logging.Log(logging.Info, "Refused to close \"%s\", %v", g.Name, err)
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusConflict, "Obstructed", nil)
+	case errors.Is(err, errInterlock):
+		logging.Log(logging.Error, "Refused to close \"%s\", %v", g.Name, err)
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusFailedDependency, "Failed Dependency", nil)
+	case err != nil:
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+	}
+}
+
+// getDeviceNames returns the names of all garage doors in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured garage doors.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
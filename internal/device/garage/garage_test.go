@@ -0,0 +1,381 @@
+package garage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read garage input")
+	}
+
+	garageConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &garageConfig); err != nil {
+		t.Fatalf("Could not read garage input")
+	}
+	return &garageConfig
+}
+
+// door simulates a single button opener wired to a Shelly, with a reed switch on its input and a beam sensor across the door.
+type door struct {
+	mutex      sync.Mutex
+	closed     bool
+	obstructed bool
+	beamDown   bool
+	pulses     []string
+}
+
+func (d *door) handler(w http.ResponseWriter, r *http.Request) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/rpc/Switch.Set":
+		d.pulses = append(d.pulses, r.URL.RawQuery)
+		d.closed = !d.closed
+		w.Write([]byte(`{"was_on":false}`))
+	case "/rpc/Input.GetStatus":
+		json.NewEncoder(w).Encode(map[string]any{"id": 0, "state": d.closed})
+	case "/beam":
+		if d.beamDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"version": 1, "message": "OK", "data": map[string]any{"broken": d.obstructed}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// setup returns the garage from the single device config driven by a simulated door.
+func setup(t *testing.T) (*garage, []func(http.ResponseWriter, *http.Request), *door) {
+	d := &door{closed: true}
+	server := httptest.NewServer(http.HandlerFunc(d.handler))
+	t.Cleanup(server.Close)
+
+	base, routes, err := routes(loadConfig(t, "testdata/garageConfig/single_device_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	g := base.Devices[0]
+	g.Shelly.Host = strings.TrimPrefix(server.URL, "http://")
+	g.Interlocks[0].URL = server.URL + "/beam"
+
+	handlers := []func(http.ResponseWriter, *http.Request){}
+	for _, r := range routes {
+		handlers = append(handlers, r.Handler)
+	}
+	return g, handlers, d
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/garageConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/garageConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/garageConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/garageConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/garageConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestInterlock(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	g, _, d := setup(t)
+	now := time.Now()
+
+	// Single button openers are only pulsed when the door is in the other state
+	assert.NoError(t, g.open(context.Background(), now))
+	assert.NoError(t, g.open(context.Background(), now))
+	assert.Equal(t, []string{"id=0&on=true&toggle_after=0.5"}, d.pulses)
+
+	status, err := g.status()
+	assert.NoError(t, err)
+	assert.Equal(t, "open", status.State)
+	assert.False(t, *status.Obstructed)
+	assert.Equal(t, now.Add(10*time.Minute).Format(time.RFC3339), status.AutoClose)
+
+	// The door is not closed while obstructed or while the beam cannot be read
+	d.obstructed = true
+	assert.ErrorIs(t, g.close(context.Background()), errObstructed)
+	d.obstructed = false
+	d.beamDown = true
+	assert.ErrorIs(t, g.close(context.Background()), errInterlock)
+	assert.Len(t, d.pulses, 1)
+
+	d.beamDown = false
+	assert.NoError(t, g.close(context.Background()))
+	assert.NoError(t, g.close(context.Background()))
+	assert.Len(t, d.pulses, 2)
+	assert.True(t, d.closed)
+}
+
+func TestAutoClose(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	g, _, d := setup(t)
+	now := time.Now()
+
+	// A door opened by its remote is closed once it has been seen open for the auto close time
+	d.closed = false
+	assert.NoError(t, g.check(now))
+	assert.NoError(t, g.check(now.Add(9*time.Minute)))
+	assert.Empty(t, d.pulses)
+
+	// An obstructed door is retried after another auto close time rather than on the next check
+	d.obstructed = true
+	assert.ErrorIs(t, g.check(now.Add(10*time.Minute)), errObstructed)
+	d.obstructed = false
+	assert.NoError(t, g.check(now.Add(11*time.Minute)))
+	assert.Empty(t, d.pulses)
+	assert.NoError(t, g.check(now.Add(20*time.Minute)))
+	assert.Len(t, d.pulses, 1)
+	assert.True(t, d.closed)
+
+	// The timer starts afresh each time the door opens
+	assert.NoError(t, g.check(now.Add(21*time.Minute)))
+	d.closed = false
+	assert.NoError(t, g.check(now.Add(25*time.Minute)))
+	assert.NoError(t, g.check(now.Add(34*time.Minute)))
+	assert.Len(t, d.pulses, 1)
+}
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	g, _, d := setup(t)
+
+	// The door is read to decide whether to pulse, but the pulse is only recorded and the auto close timer is not started
+	ctx, dryRun := device.WithDryRun(context.Background())
+	assert.NoError(t, g.open(ctx, time.Now()))
+	assert.Empty(t, d.pulses)
+	assert.True(t, d.closed)
+	assert.True(t, g.opened.IsZero())
+	assert.Equal(t, []device.Call{{Method: "GET", URL: "http://" + g.Shelly.Host + "/rpc/Switch.Set?id=0&on=true&toggle_after=0.5"}}, dryRun.Calls())
+}
+
+func TestMsg100(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	open := int64(0)
+	namespaces := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := struct {
+			Header struct {
+				Namespace string `json:"namespace"`
+				Method    string `json:"method"`
+			} `json:"header"`
+			Payload struct {
+				State struct {
+					Channel int   `json:"channel"`
+					Open    int64 `json:"open"`
+				} `json:"state"`
+			} `json:"payload"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&message)
+		namespaces = append(namespaces, message.Header.Method+" "+message.Header.Namespace)
+
+		w.Header().Set("Content-Type", "application/json")
+		if message.Header.Method == "SET" {
+			assert.Equal(t, 1, message.Payload.State.Channel)
+			open = message.Payload.State.Open
+			w.Write([]byte(`{"payload":{}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"payload": map[string]any{"all": map[string]any{"digest": map[string]any{"garageDoor": []map[string]any{
+				{"channel": 1, "open": open},
+				{"channel": 2, "open": 1},
+			}}}},
+		})
+	}))
+	defer server.Close()
+
+	base, _, err := routes(loadConfig(t, "testdata/garageConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	carport := base.Devices[1]
+	carport.Meross.Host = strings.TrimPrefix(server.URL, "http://")
+
+	assert.NoError(t, carport.open(context.Background(), time.Now()))
+	status, err := carport.status()
+	assert.NoError(t, err)
+	assert.Equal(t, "open", status.State)
+	assert.Nil(t, status.Obstructed)
+	assert.Empty(t, status.AutoClose)
+
+	assert.NoError(t, carport.close(context.Background()))
+	assert.Equal(t, []string{
+		"GET Appliance.System.All", "SET Appliance.GarageDoor.State", "GET Appliance.System.All",
+		"GET Appliance.System.All", "SET Appliance.GarageDoor.State",
+	}, namespaces)
+
+	carport.Meross.Channel = 3
+	_, err = carport.driver.closed()
+	assert.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		data         string
+		obstructed   bool
+		beamDown     bool
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/garage",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","open","close"]}`,
+		},
+		{
+			name:         "status",
+			method:       "POST",
+			url:          "/garage",
+			data:         `{"code":"status"}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"closed","obstructed":false}}`,
+		},
+		{
+			name:         "open",
+			method:       "POST",
+			url:          "/garage?code=open",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "close_obstructed",
+			method:       "POST",
+			url:          "/garage?code=close",
+			obstructed:   true,
+			expectedCode: 409,
+			expectedBody: `{"version":1,"message":"Obstructed"}`,
+		},
+		{
+			name:         "close_interlock_unavailable",
+			method:       "POST",
+			url:          "/garage?code=close",
+			beamDown:     true,
+			expectedCode: 424,
+			expectedBody: `{"version":1,"message":"Failed Dependency"}`,
+		},
+		{
+			name:         "close",
+			method:       "POST",
+			url:          "/garage?code=close",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/garage?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/garage",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	_, handlers, d := setup(t)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/garage", handlers[0])
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d.mutex.Lock()
+			d.obstructed = tc.obstructed
+			d.beamDown = tc.beamDown
+			d.mutex.Unlock()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
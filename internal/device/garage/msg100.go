@@ -0,0 +1,125 @@
+package garage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// msg100 drives a Meross MSG100 garage door opener over its local HTTP API, reading the state of the door from the opener's own sensor.
+type msg100 struct {
+	Host    string        `yaml:"host"`
+	Key     config.Secret `yaml:"key"`
+	Channel int           `yaml:"channel"`
+	timeout uint
+}
+
+// msg100Response represents the fields of interest from Appliance.System.All and the error reported by any namespace.
+type msg100Response struct {
+	Payload struct {
+		Error struct {
+			Code   int64  `json:"code,omitempty"`
+			Detail string `json:"detail,omitempty"`
+		} `json:"error,omitempty"`
+		All struct {
+			Digest struct {
+				GarageDoor []struct {
+					Channel int   `json:"channel"`
+					Open    int64 `json:"open"`
+				} `json:"garageDoor"`
+			} `json:"digest"`
+		} `json:"all"`
+	} `json:"payload"`
+}
+
+// send signs a payload for a namespace and sends it to the opener, returning the decoded response.
+func (m *msg100) send(ctx context.Context, method string, namespace string, payload any) (*msg100Response, error) {
+	client := &http.Client{
+		Timeout: time.Duration(m.timeout) * time.Millisecond,
+	}
+
+	// Newer firmware requires a unique nonce for messageId
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	messageId := hex.EncodeToString(nonce)
+	sum := md5.Sum([]byte(messageId + m.Key.Value() + "0"))
+
+	jsonPayload, err := device.MerossMessage(messageId, method, namespace, hex.EncodeToString(sum[:]), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+m.Host+"/config", bytes.NewReader(jsonPayload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d from %s", resp.StatusCode, m.Host)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := msg100Response{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.Payload.Error.Code != 0 {
+		return nil, errors.New(response.Payload.Error.Detail)
+	}
+	return &response, nil
+}
+
+// set opens or closes the door on the configured channel.
+func (m *msg100) set(ctx context.Context, open int) error {
+	_, err := m.send(ctx, "SET", "Appliance.GarageDoor.State", map[string]any{
+		"state": map[string]any{
+			"channel": m.Channel,
+			"open":    open,
+			"uuid":    "",
+		},
+	})
+	return err
+}
+
+func (m *msg100) open(ctx context.Context) error {
+	return m.set(ctx, 1)
+}
+
+func (m *msg100) close(ctx context.Context) error {
+	return m.set(ctx, 0)
+}
+
+func (m *msg100) closed() (bool, error) {
+	response, err := m.send(context.Background(), "GET", "Appliance.System.All", map[string]any{})
+	if err != nil {
+		return false, err
+	}
+	for _, d := range response.Payload.All.Digest.GarageDoor {
+		if d.Channel == m.Channel {
+			return d.Open == 0, nil
+		}
+	}
+	return false, fmt.Errorf("channel %d not reported by %s", m.Channel, m.Host)
+}
@@ -0,0 +1,88 @@
+package garage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// shelly drives a single button opener through the relay of a Shelly Plus or Pro relay over its Gen2 RPC API, reading the state of the
+// door from a reed switch wired to one of its inputs.
+type shelly struct {
+	Host     string `yaml:"host"`
+	SwitchID int    `yaml:"switchId"`
+	InputID  int    `yaml:"inputId"`
+	PulseMs  uint   `yaml:"pulseMs"`
+	// Reed switches are taken to be closed while the door is, invert for those that open instead
+	Invert  bool `yaml:"invert"`
+	timeout uint
+}
+
+// call sends a GET request to an RPC method and decodes the result into v.
+func (s *shelly) call(ctx context.Context, method string, query url.Values, v any) error {
+	client := &http.Client{
+		Timeout: time.Duration(s.timeout) * time.Millisecond,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/rpc/%s?%s", s.Host, method, query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("shelly returned status code %d for %s", resp.StatusCode, method)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// pulse switches the relay on, letting the Shelly switch it off again after the pulse so that it is not left on if restate-go is not
+// around to do so.
+func (s *shelly) pulse(ctx context.Context) error {
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(s.SwitchID))
+	query.Set("on", "true")
+	query.Set("toggle_after", strconv.FormatFloat(float64(s.PulseMs)/1000, 'f', -1, 64))
+	return s.call(device.Write(ctx), "Switch.Set", query, &struct{}{})
+}
+
+func (s *shelly) open(ctx context.Context) error {
+	return s.pulse(ctx)
+}
+
+func (s *shelly) close(ctx context.Context) error {
+	return s.pulse(ctx)
+}
+
+func (s *shelly) closed() (bool, error) {
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(s.InputID))
+
+	response := struct {
+		State *bool `json:"state"`
+	}{}
+	if err := s.call(context.Background(), "Input.GetStatus", query, &response); err != nil {
+		return false, err
+	}
+	if response.State == nil {
+		return false, fmt.Errorf("shelly input %d is not a switch input", s.InputID)
+	}
+	return *response.State != s.Invert, nil
+}
@@ -0,0 +1,360 @@
+// Package goecharger provides control of go-eCharger EV chargers via the local HTTP API v2.
+package goecharger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Force states accepted by the frc key
+const (
+	forceNeutral = 0
+	forceOff     = 1
+	forceOn      = 2
+)
+
+// Car states reported by the car key
+var carStates = map[int]string{
+	0: "unknown",
+	1: "idle",
+	2: "charging",
+	3: "waiting",
+	4: "complete",
+	5: "error",
+}
+
+// rawStatus represents the subset of keys requested from the /api/status endpoint.
+type rawStatus struct {
+	Car   int       `json:"car"`
+	Amp   int       `json:"amp"`
+	Frc   int       `json:"frc"`
+	Wh    float64   `json:"wh"`
+	Nrg   []float64 `json:"nrg"`
+	Error *int      `json:"err"`
+}
+
+// status is the representation of the charger returned by the status code.
+type status struct {
+	Car          string  `json:"car"`
+	Charging     bool    `json:"charging"`
+	Force        string  `json:"force"`
+	CurrentLimit int     `json:"currentLimit"`
+	Power        float64 `json:"power"`
+	SessionKwh   float64 `json:"sessionKwh"`
+}
+
+// goecharger represents a charger configuration with name, host and current limits.
+type goecharger struct {
+	Name       string `yaml:"name"`
+	Host       string `yaml:"host"`
+	Timeout    uint   `yaml:"timeoutMs"`
+	MinCurrent int    `yaml:"minCurrent"`
+	MaxCurrent int    `yaml:"maxCurrent"`
+	Base       base
+}
+
+// base represents a list of chargers
+type base struct {
+	Devices []*goecharger
+}
+
+type Device struct{}
+
+// DryRun previews the keys a request would set on the charger, status is still read to decide toggles.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for chargers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts go-eCharger wallboxes from config, rejecting current limits that cross, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "goecharger" {
+			continue
+		}
+		goecharger := goecharger{
+			MinCurrent: 6,
+			MaxCurrent: 16,
+			Base:       base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &goecharger); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if goecharger.Name == "" || goecharger.Host == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if goecharger.MinCurrent > goecharger.MaxCurrent {
+			logging.Log(logging.Info, "Unable to load device \"%s\": minCurrent is greater than maxCurrent", goecharger.Name)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + goecharger.Name,
+			Handler: goecharger.handler,
+		})
+
+		base.Devices = append(base.Devices, &goecharger)
+
+		logging.Log(logging.Info, "Found device \"%s\"", goecharger.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/goecharger" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/goecharger",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/goecharger/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// get sends a GET request to an API endpoint on the charger and returns the body.
+func (g *goecharger) get(ctx context.Context, endpoint string, query url.Values) ([]byte, error) {
+	client := &http.Client{
+		Timeout: time.Duration(g.Timeout) * time.Millisecond,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s/api/%s?%s", g.Host, endpoint, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d: %s", resp.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+// set writes a single key on the charger, the API responds with true for each key that was accepted. The write is recorded rather than
+// sent during a dry run.
+func (g *goecharger) set(ctx context.Context, key string, value int) error {
+	query := url.Values{}
+	query.Set(key, fmt.Sprint(value))
+
+	body, err := g.get(device.Write(ctx), "set", query)
+	if err != nil || device.DryRunning(ctx) {
+		return err
+	}
+
+	response := map[string]any{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+
+	if accepted, ok := response[key].(bool); !ok || !accepted {
+		return fmt.Errorf("charger rejected %s=%d: %v", key, value, response[key])
+	}
+
+	return nil
+}
+
+// status retrieves and summarises the current state of the charger.
+func (g *goecharger) status(ctx context.Context) (*status, error) {
+	query := url.Values{}
+	query.Set("filter", "car,amp,frc,wh,nrg,err")
+
+	body, err := g.get(ctx, "status", query)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := rawStatus{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	status := status{
+		Car:          carStates[raw.Car],
+		Charging:     raw.Car == 2,
+		CurrentLimit: raw.Amp,
+		SessionKwh:   raw.Wh / 1000,
+	}
+
+	switch raw.Frc {
+	case forceOff:
+		status.Force = "off"
+	case forceOn:
+		status.Force = "on"
+	default:
+		status.Force = "neutral"
+	}
+
+	// nrg index 11 is the total power across all phases in watts
+	if len(raw.Nrg) > 11 {
+		status.Power = raw.Nrg[11]
+	}
+
+	return &status, nil
+}
+
+// getCodes returns a list of control codes for a charger.
+func getCodes() []string {
+	return []string{"status", "start", "stop", "toggle", "auto", "current"}
+}
+
+// Handler is the HTTP handler for charger control.
+func (g *goecharger) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+
+	switch request.Code {
+	case "status":
+		status, err := g.status(r.Context())
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", status)
+		return
+	case "start":
+		err = g.set(r.Context(), "frc", forceOn)
+	case "stop":
+		err = g.set(r.Context(), "frc", forceOff)
+	case "auto":
+		err = g.set(r.Context(), "frc", forceNeutral)
+	case "toggle":
+		var force int
+		switch request.Value {
+		case "0":
+			force = forceOff
+		case "1":
+			force = forceOn
+		case "":
+			status, err := g.status(r.Context())
+			if err != nil {
+				logging.Log(logging.Error, err.Error())
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				return
+			}
+			force = forceOn
+			if status.Charging {
+				force = forceOff
+			}
+		default:
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = g.set(r.Context(), "frc", force)
+	case "current":
+		current, valueErr := request.Value.Int64()
+		if valueErr != nil || int(current) < g.MinCurrent || int(current) > g.MaxCurrent {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = g.set(r.Context(), "amp", int(current))
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// getDeviceNames returns the names of all chargers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured chargers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
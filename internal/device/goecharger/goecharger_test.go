@@ -0,0 +1,287 @@
+package goecharger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read goecharger input")
+	}
+
+	goechargerConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &goechargerConfig); err != nil {
+		t.Fatalf("Could not read goecharger input")
+	}
+	return &goechargerConfig
+}
+
+// setupHTTPServer emulates the go-eCharger API v2, keys written via /api/set are reflected in /api/status.
+func setupHTTPServer(t *testing.T) *httptest.Server {
+	state := map[string]any{
+		"car": 2,
+		"amp": 16,
+		"frc": 0,
+		"wh":  5230.5,
+		"nrg": []float64{230, 231, 229, 0, 10, 10, 10, 2300, 2310, 2290, 0, 6900, 100, 100, 100, 0},
+		"err": 0,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/status":
+			json.NewEncoder(w).Encode(state)
+		case "/api/set":
+			response := map[string]any{}
+			for key, values := range r.URL.Query() {
+				value, err := strconv.Atoi(values[0])
+				if err != nil {
+					response[key] = "invalid value"
+					continue
+				}
+				state[key] = value
+				response[key] = true
+			}
+			json.NewEncoder(w).Encode(response)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/goechargerConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/goechargerConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/goechargerConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/goechargerConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/goechargerConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		data         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/goecharger/driveway",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","start","stop","toggle","auto","current"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/goecharger/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["driveway","garage"]}`,
+		},
+		{
+			name:         "status",
+			method:       "POST",
+			url:          "/goecharger/driveway?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"car":"charging","charging":true,"force":"neutral","currentLimit":16,"power":6900,"sessionKwh":5.2305}}`,
+		},
+		{
+			name:         "toggle_without_value_stops_charging",
+			method:       "POST",
+			url:          "/goecharger/driveway?code=toggle",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "current",
+			method:       "POST",
+			url:          "/goecharger/driveway",
+			data:         `{"code":"current","value":24}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "status_reflects_changes",
+			method:       "POST",
+			url:          "/goecharger/driveway?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"car":"charging","charging":true,"force":"off","currentLimit":24,"power":6900,"sessionKwh":5.2305}}`,
+		},
+		{
+			name:         "current_above_max",
+			method:       "POST",
+			url:          "/goecharger/garage?code=current&value=32",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "toggle_invalid_value",
+			method:       "POST",
+			url:          "/goecharger/driveway?code=toggle&value=2",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "malformed_json",
+			method:       "POST",
+			url:          "/goecharger/driveway",
+			data:         `{"code":`,
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Malformed Or Empty JSON Body"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/goecharger/driveway?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/goecharger/driveway",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/goecharger/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	server := setupHTTPServer(t)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/goechargerConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		d.Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	server := setupHTTPServer(t)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/goechargerConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, d := range base.Devices {
+		d.Host = host
+	}
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	// Toggles read the status to decide the new force state, the write itself is recorded rather than sent
+	ctx, run := device.WithDryRun(context.Background())
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/goecharger/driveway?code=toggle", nil).WithContext(ctx))
+	assert.Equal(t, `{"version":1,"message":"OK"}`, recorder.Body.String())
+	assert.Equal(t, []device.Call{{Method: "GET", URL: "http://" + host + "/api/set?frc=1"}}, run.Calls())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/goecharger/driveway?code=status", nil))
+	assert.Contains(t, recorder.Body.String(), `"charging":true`)
+}
@@ -0,0 +1,225 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// health is the reachability of a device as last observed by the poller.
+type health struct {
+	Name        string     `json:"name"`
+	Enabled     bool       `json:"enabled"`
+	Reachable   *bool      `json:"reachable"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	RTT         *int64     `json:"rttMs,omitempty"`
+	Signal      *int64     `json:"signal,omitempty"`
+	handler     func(http.ResponseWriter, *http.Request)
+	codes       []string
+}
+
+// poller periodically requests the status of every device that supports one, so that degrading devices are noticed before they are used.
+type poller struct {
+	interval time.Duration
+	devices  []*health
+	notifier *notifier
+	mutex    sync.RWMutex
+	// Number of polls waiting on a device, reported by diagnostics
+	inFlight atomic.Int64
+}
+
+// recorder is a minimal http.ResponseWriter used to call device handlers directly.
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	if r.header == nil {
+		r.header = http.Header{}
+	}
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.code = code
+}
+
+// newPoller creates a poller for the handlers of each named route, routes sharing a name are polled once.
+func newPoller(interval time.Duration, handlers map[string]func(http.ResponseWriter, *http.Request)) *poller {
+	p := poller{
+		interval: interval,
+	}
+	for name, handler := range handlers {
+		p.devices = append(p.devices, &health{
+			Name:    name,
+			handler: handler,
+		})
+	}
+	sort.Slice(p.devices, func(i int, j int) bool {
+		return p.devices[i].Name < p.devices[j].Name
+	})
+	return &p
+}
+
+// call sends a request to a device handler and decodes the data of its response.
+func (h *health) call(method string, code string) (int, any) {
+	request, _ := http.NewRequest(method, "/"+h.Name, nil)
+	if code != "" {
+		body, _ := json.Marshal(common.Request{Code: code})
+		request, _ = http.NewRequest(method, "/"+h.Name, bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	recorder := recorder{}
+	h.handler(&recorder, request)
+
+	response := common.Response{}
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil {
+		return recorder.code, nil
+	}
+	return recorder.code, response.Data
+}
+
+// pollable reports whether a route accepts the status code, base routes return device names rather than codes and are skipped.
+func (p *poller) pollable(h *health) bool {
+	if h.codes == nil {
+		codes := h.getCodes()
+		p.mutex.Lock()
+		h.codes = codes
+		p.mutex.Unlock()
+	}
+	return slices.Contains(h.codes, "status")
+}
+
+// getCodes returns the codes a route lists in response to a GET.
+func (h *health) getCodes() []string {
+	codes := []string{}
+	if code, data := h.call(http.MethodGet, ""); code == http.StatusOK {
+		values, _ := data.([]any)
+		for _, c := range values {
+			if c, ok := c.(string); ok {
+				codes = append(codes, c)
+			}
+		}
+	}
+	return codes
+}
+
+// poll requests the status of a device, recording its reachability, round trip time and, for devices with an info code, signal strength.
+func (h *health) poll() health {
+	result := health{
+		Name:        h.Name,
+		Enabled:     common.Enabled(h.Name),
+		LastSuccess: h.LastSuccess,
+	}
+	if !result.Enabled {
+		return result
+	}
+
+	start := time.Now()
+	code, _ := h.call(http.MethodPost, "status")
+	rtt := time.Since(start).Milliseconds()
+	reachable := code == http.StatusOK
+
+	result.Reachable = &reachable
+	result.RTT = &rtt
+	if reachable {
+		now := time.Now()
+		result.LastSuccess = &now
+	}
+
+	if reachable && slices.Contains(h.codes, "info") {
+		if code, data := h.call(http.MethodPost, "info"); code == http.StatusOK {
+			info, _ := data.(map[string]any)
+			if signal, ok := info["signal"].(float64); ok {
+				value := int64(signal)
+				result.Signal = &value
+			}
+		}
+	}
+	return result
+}
+
+// pollAll polls each device concurrently and records the results.
+func (p *poller) pollAll() {
+	var wg sync.WaitGroup
+	for _, h := range p.devices {
+		if !p.pollable(h) {
+			continue
+		}
+		wg.Add(1)
+		go func(h *health) {
+			defer wg.Done()
+			p.inFlight.Add(1)
+			result := h.poll()
+			p.inFlight.Add(-1)
+
+			p.mutex.Lock()
+			h.Enabled, h.Reachable, h.LastSuccess, h.RTT, h.Signal = result.Enabled, result.Reachable, result.LastSuccess, result.RTT, result.Signal
+			p.mutex.Unlock()
+		}(h)
+	}
+	wg.Wait()
+}
+
+// run polls every device immediately and then once per interval.
+func (p *poller) run() {
+	logging.Log(logging.Info, "Polling device health every %s", p.interval)
+	for {
+		p.pollAll()
+		if p.notifier != nil {
+			p.notifier.notify(p.snapshot(), time.Now())
+		}
+		time.Sleep(p.interval)
+	}
+}
+
+// snapshot returns the last observed health of every pollable device.
+func (p *poller) snapshot() []health {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	devices := []health{}
+	for _, h := range p.devices {
+		if !slices.Contains(h.codes, "status") {
+			continue
+		}
+		devices = append(devices, *h)
+	}
+	return devices
+}
+
+// handler returns the last observed health of every device.
+func (p *poller) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method != http.MethodGet {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	devices := p.snapshot()
+	httpCode, jsonResponse = common.SetJSONResponse(http.StatusOK, "OK", devices)
+}
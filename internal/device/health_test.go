@@ -0,0 +1,113 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRoute is a device route listing codes on GET and answering status and info while up.
+type fakeRoute struct {
+	codes []string
+	up    bool
+	polls int
+}
+
+func (f *fakeRoute) handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", f.codes)
+		common.JSONResponse(w, httpCode, jsonResponse)
+		return
+	}
+
+	request := common.Request{}
+	if err := common.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		common.JSONResponse(w, httpCode, jsonResponse)
+		return
+	}
+	if request.Code == "status" {
+		f.polls++
+	}
+	if !f.up {
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		common.JSONResponse(w, httpCode, jsonResponse)
+		return
+	}
+	httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", map[string]any{"onoff": 1, "signal": -61})
+	common.JSONResponse(w, httpCode, jsonResponse)
+}
+
+func TestPoller(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	lamp := &fakeRoute{codes: []string{"status", "toggle", "info"}, up: true}
+	plug := &fakeRoute{codes: []string{"status", "toggle"}, up: true}
+	tv := &fakeRoute{codes: []string{"status", "power"}, up: true}
+	base := &fakeRoute{codes: []string{"lamp", "plug"}, up: true}
+	p := newPoller(time.Minute, map[string]func(http.ResponseWriter, *http.Request){
+		"lamp":   lamp.handler,
+		"plug":   plug.handler,
+		"tv":     tv.handler,
+		"meross": base.handler,
+	})
+
+	get := func() []health {
+		recorder := httptest.NewRecorder()
+		p.handler(recorder, httptest.NewRequest(http.MethodGet, "/health/devices", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := struct {
+			Data []health `json:"data"`
+		}{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	// Devices are reachable once they answer, base routes that list names rather than codes are left out, and signal is read with info
+	common.SetEnabled("tv", false)
+	t.Cleanup(func() { common.SetEnabled("tv", true) })
+	p.pollAll()
+	devices := get()
+	if assert.Len(t, devices, 3) {
+		assert.Equal(t, "lamp", devices[0].Name)
+		assert.True(t, *devices[0].Reachable)
+		assert.NotNil(t, devices[0].LastSuccess)
+		assert.Equal(t, int64(-61), *devices[0].Signal)
+		assert.True(t, *devices[1].Reachable)
+		assert.Nil(t, devices[1].Signal)
+
+		// Devices out of rotation are listed but not polled
+		assert.Equal(t, "tv", devices[2].Name)
+		assert.False(t, devices[2].Enabled)
+		assert.Nil(t, devices[2].Reachable)
+	}
+	assert.Zero(t, tv.polls)
+	assert.Zero(t, base.polls)
+
+	// A device that stops answering is unreachable, keeping the time it last answered
+	lastSuccess := *devices[1].LastSuccess
+	plug.up = false
+	p.pollAll()
+	devices = get()
+	assert.False(t, *devices[1].Reachable)
+	assert.Equal(t, lastSuccess, *devices[1].LastSuccess)
+	assert.Equal(t, 2, plug.polls)
+
+	// And reachable again once it answers
+	plug.up = true
+	common.SetEnabled("tv", true)
+	p.pollAll()
+	devices = get()
+	assert.True(t, *devices[1].Reachable)
+	assert.True(t, *devices[2].Reachable)
+
+	recorder := httptest.NewRecorder()
+	p.handler(recorder, httptest.NewRequest(http.MethodPost, "/health/devices", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
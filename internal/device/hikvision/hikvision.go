@@ -3,24 +3,26 @@ package hikvision
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"slices"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
 	"github.com/kennedn/restate-go/internal/common/logging"
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
 	"gopkg.in/yaml.v3"
 )
 
@@ -30,10 +32,59 @@ type request struct {
 	Hosts string `json:"hosts,omitempty"`
 }
 
+type exportRequest struct {
+	Start string `schema:"start"`
+	End   string `schema:"end"`
+}
+
+// Number of recording segments requested per ContentMgmt search and the most searches made for one export
+const (
+	searchResults = 40
+	maxSearches   = 10
+)
+
+// Longest a single recording segment may take to download, segments are large so this is well beyond the device timeout
+const downloadTimeout = 30 * time.Minute
+
+// Time format used in ContentMgmt searches and playback URIs
+const (
+	isapiTime    = "2006-01-02T15:04:05Z"
+	playbackTime = "20060102T150405Z"
+)
+
+// searchDescription is a ContentMgmt search for the recordings of a track within a time span.
+type searchDescription struct {
+	XMLName   xml.Name `xml:"CMSearchDescription"`
+	SearchID  string   `xml:"searchID"`
+	TrackID   int      `xml:"trackList>trackID"`
+	StartTime string   `xml:"timeSpanList>timeSpan>startTime"`
+	EndTime   string   `xml:"timeSpanList>timeSpan>endTime"`
+	Max       int      `xml:"maxResults"`
+	Position  int      `xml:"searchResultPostion"`
+	Metadata  string   `xml:"metadataList>metadataDescriptor"`
+}
+
+// searchResult is the part of a ContentMgmt search response used to download recordings.
+type searchResult struct {
+	XMLName        xml.Name `xml:"CMSearchResult"`
+	ResponseStatus string   `xml:"responseStatusStrg"`
+	Matches        []struct {
+		PlaybackURI string `xml:"mediaSegmentDescriptor>playbackURI"`
+	} `xml:"matchList>searchMatchItem"`
+}
+
+// downloadRequest requests the recording at a playback URI.
+type downloadRequest struct {
+	XMLName     xml.Name `xml:"downloadRequest"`
+	PlaybackURI string   `xml:"playbackURI"`
+}
+
 // namedStatus associates a devices name with its status.
 type namedStatus struct {
 	Name   string `json:"name"`
 	Status any    `json:"status"`
+	// Why the device did not respond, listed in the errors of multi-device responses
+	err error
 }
 
 // Struct for the main SupplementLight element
@@ -57,12 +108,14 @@ type eventIntelligenceModeCfg struct {
 
 // hikvision represents a Hikvision device configuration with name, host, device type, timeout, and base configuration.
 type hikvision struct {
-	Name        string `yaml:"name"`
-	Host        string `yaml:"host"`
-	Timeout     uint   `yaml:"timeoutMs"`
-	DefaultMode string `yaml:"defaultMode"`
-	User        string `yaml:"user"`
-	Password    string `yaml:"password"`
+	Name        string        `yaml:"name"`
+	Host        string        `yaml:"host"`
+	Timeout     uint          `yaml:"timeoutMs"`
+	DefaultMode string        `yaml:"defaultMode"`
+	User        string        `yaml:"user"`
+	Password    config.Secret `yaml:"password"`
+	Track       int           `yaml:"track"`
+	Vote        string        `yaml:"vote,omitempty"`
 	Base        base
 }
 
@@ -73,9 +126,19 @@ type deviceValues struct {
 
 // base represents a list of Hikvision devices, endpoints and common configuration
 type base struct {
-	SupplementLightTemplate string `yaml:"supplementLightTemplate"`
-	IrcutTemplate           string `yaml:"IrcutTemplate"`
-	Devices                 []*hikvision
+	Devices []*hikvision
+}
+
+// supplementLightPut sets the mode of a camera's supplement light.
+type supplementLightPut struct {
+	XMLName             xml.Name `xml:"SupplementLight"`
+	SupplementLightMode string   `xml:"supplementLightMode"`
+}
+
+// ircutFilterPut sets the type of a camera's IR cut filter.
+type ircutFilterPut struct {
+	XMLName         xml.Name `xml:"IrcutFilter"`
+	IrcutFilterType string   `xml:"IrcutFilterType"`
 }
 
 type statusResponse struct {
@@ -85,6 +148,11 @@ type statusResponse struct {
 
 type Device struct{}
 
+// DryRun previews supplement light and IR cut filter updates, their current settings are still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 // Routes generates routes for Hikvision device control based on a provided configuration.
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config)
@@ -94,10 +162,7 @@ func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 // generateRoutesFromConfig generates routes and base configuration from a provided configuration and internal config file.
 func routes(config *config.Config) (*base, []router.Route, error) {
 	routes := []router.Route{}
-	base := base{
-		SupplementLightTemplate: "<SupplementLight><supplementLightMode>%s</supplementLightMode></SupplementLight>",
-		IrcutTemplate:           "<IrcutFilter><IrcutFilterType>%s</IrcutFilterType></IrcutFilter>",
-	}
+	base := base{}
 
 	for _, d := range config.Devices {
 		if d.Type != "hikvision" {
@@ -113,7 +178,7 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &hikvision); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &hikvision); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -123,24 +188,38 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 			continue
 		}
 
+		if !device.ValidVote(hikvision.Vote) {
+			logging.Log(logging.Info, "Unable to load device due to invalid vote \"%s\"", hikvision.Vote)
+			continue
+		}
+
 		if hikvision.DefaultMode != "irLight" && hikvision.DefaultMode != "eventIntelligence" {
 			logging.Log(logging.Info, "Unable to load device: DefaultMode must be either 'irLight' or 'eventIntelligence'")
 			continue
 		}
 
+		if hikvision.Track == 0 {
+			hikvision.Track = 101
+		}
+
 		routes = append(routes, router.Route{
 			Path:    "/" + hikvision.Name,
 			Handler: hikvision.handler,
 		})
 
+		routes = append(routes, router.Route{
+			Path:    "/" + hikvision.Name + "/export",
+			Handler: hikvision.exportHandler,
+		})
+
 		base.Devices = append(base.Devices, &hikvision)
 
 		logging.Log(logging.Info, "Found device \"%s\"", hikvision.Name)
 	}
 
-	if len(routes) == 0 {
+	if len(base.Devices) == 0 {
 		return nil, []router.Route{}, errors.New("no routes found in config")
-	} else if len(routes) == 1 {
+	} else if len(base.Devices) == 1 {
 		return &base, routes, nil
 	}
 
@@ -176,21 +255,21 @@ func validValue(value string) bool {
 }
 
 // get constructs and sends a GET request to a Hikvision device and will return a flattened status when the method is equal to GET.
-func (m *hikvision) get() (*supplementLightResponseGet, error) {
+func (m *hikvision) get(ctx context.Context) (*supplementLightResponseGet, error) {
 	client := &http.Client{
 		Timeout: time.Duration(m.Timeout) * time.Millisecond,
 	}
 
-	req, err := http.NewRequest("GET", "http://"+m.Host+"/ISAPI/Image/channels/1/supplementLight", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+m.Host+"/ISAPI/Image/channels/1/supplementLight", nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/xml")
-	req.SetBasicAuth(m.User, m.Password)
+	req.SetBasicAuth(m.User, m.Password.Value())
 
 	// Send the request and get the response
-	resp, err := client.Do(req)
+	resp, err := device.Do(client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -215,26 +294,30 @@ func (m *hikvision) get() (*supplementLightResponseGet, error) {
 }
 
 // put constructs and sends a PUT request to a Hikvision device
-func (m *hikvision) put(value string) error {
+func (m *hikvision) put(ctx context.Context, value string) error {
 	client := &http.Client{
 		Timeout: time.Duration(m.Timeout) * time.Millisecond,
 	}
 
-	if value == "" {
-		return errors.New("value is required")
+	// Values are checked by the handlers too, but are never written to the device unless they are one of the known modes
+	if !validValue(value) {
+		return fmt.Errorf("invalid supplement light mode \"%s\"", value)
 	}
 
-	payload := []byte(fmt.Sprintf(m.Base.SupplementLightTemplate, value))
-	req, err := http.NewRequest("PUT", "http://"+m.Host+"/ISAPI/Image/channels/1/supplementLight", bytes.NewReader(payload))
+	payload, err := xml.Marshal(supplementLightPut{SupplementLightMode: value})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", "http://"+m.Host+"/ISAPI/Image/channels/1/supplementLight", bytes.NewReader(payload))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/xml")
-	req.SetBasicAuth(m.User, m.Password)
+	req.SetBasicAuth(m.User, m.Password.Value())
 
 	// Send the request and get the response
-	resp, err := client.Do(req)
+	resp, err := device.Do(client, req)
 	if err != nil {
 		return err
 	}
@@ -247,7 +330,7 @@ func (m *hikvision) put(value string) error {
 	return nil
 }
 
-func (m *hikvision) ircutPut(filterType string) error {
+func (m *hikvision) ircutPut(ctx context.Context, filterType string) error {
 	if (filterType != "auto" && filterType != "night" && filterType != "day") || filterType == "" {
 		return errors.New("filterType must be auto, night or day")
 	}
@@ -256,17 +339,20 @@ func (m *hikvision) ircutPut(filterType string) error {
 		Timeout: time.Duration(m.Timeout) * time.Millisecond,
 	}
 
-	payload := []byte(fmt.Sprintf(m.Base.IrcutTemplate, filterType))
-	req, err := http.NewRequest("PUT", "http://"+m.Host+"/ISAPI/Image/channels/1/ircutFilter", bytes.NewReader(payload))
+	payload, err := xml.Marshal(ircutFilterPut{IrcutFilterType: filterType})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", "http://"+m.Host+"/ISAPI/Image/channels/1/ircutFilter", bytes.NewReader(payload))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/xml")
-	req.SetBasicAuth(m.User, m.Password)
+	req.SetBasicAuth(m.User, m.Password.Value())
 
 	// Send the request and get the response
-	resp, err := client.Do(req)
+	resp, err := device.Do(client, req)
 	if err != nil {
 		return err
 	}
@@ -307,16 +393,9 @@ func (m *hikvision) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	if !validCode(request.Code) {
@@ -326,7 +405,7 @@ func (m *hikvision) handler(w http.ResponseWriter, r *http.Request) {
 
 	switch request.Code {
 	case "status":
-		status, err = m.get()
+		status, err = m.get(r.Context())
 		if err != nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
@@ -347,7 +426,7 @@ func (m *hikvision) handler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if request.Value == "" {
-			status, err = m.get()
+			status, err = m.get(r.Context())
 			if err != nil {
 				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 				return
@@ -362,13 +441,13 @@ func (m *hikvision) handler(w http.ResponseWriter, r *http.Request) {
 		if request.Value == "colorVuWhiteLight" {
 			irCutFilterType = "night"
 		}
-		err = m.ircutPut(irCutFilterType)
+		err = m.ircutPut(r.Context(), irCutFilterType)
 		if err != nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
 		}
 
-		err = m.put(request.Value)
+		err = m.put(r.Context(), request.Value)
 		if err != nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
@@ -378,6 +457,182 @@ func (m *hikvision) handler(w http.ResponseWriter, r *http.Request) {
 	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
 }
 
+// search returns the playback URIs of recordings on the device's track that overlap a time span.
+func (m *hikvision) search(ctx context.Context, start time.Time, end time.Time) ([]string, error) {
+	client := egress.Client("hikvision", time.Duration(m.Timeout)*time.Millisecond)
+	// Searches are sent as POSTs, mark them as reads so that they still happen during a dry run
+	ctx = device.Read(ctx)
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	description := searchDescription{
+		SearchID:  fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]),
+		TrackID:   m.Track,
+		StartTime: start.UTC().Format(isapiTime),
+		EndTime:   end.UTC().Format(isapiTime),
+		Max:       searchResults,
+		Metadata:  "//recordType.meta.std-cgi.com",
+	}
+
+	uris := []string{}
+	for i := 0; i < maxSearches; i++ {
+		payload, err := xml.Marshal(description)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", "http://"+m.Host+"/ISAPI/ContentMgmt/search", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/xml")
+		req.SetBasicAuth(m.User, m.Password.Value())
+
+		resp, err := device.Do(client, req)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("search returned status code %d", resp.StatusCode)
+		}
+
+		result := searchResult{}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+
+		for _, match := range result.Matches {
+			uris = append(uris, match.PlaybackURI)
+		}
+
+		if result.ResponseStatus != "MORE" || len(result.Matches) == 0 {
+			break
+		}
+		description.Position += len(result.Matches)
+	}
+
+	return uris, nil
+}
+
+// clampPlaybackURI limits the start and end time of a playback URI to a time span, so that only the requested part of a segment is downloaded.
+func clampPlaybackURI(uri string, start time.Time, end time.Time) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	query := u.Query()
+	if t, err := time.Parse(playbackTime, query.Get("starttime")); err == nil && t.Before(start) {
+		query.Set("starttime", start.UTC().Format(playbackTime))
+	}
+	if t, err := time.Parse(playbackTime, query.Get("endtime")); err == nil && t.After(end) {
+		query.Set("endtime", end.UTC().Format(playbackTime))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// download streams the recording at a playback URI to w. The request is cancelled with the export request, or after downloadTimeout
+// as recordings can be large.
+func (m *hikvision) download(r *http.Request, uri string, w io.Writer) error {
+	payload, err := xml.Marshal(downloadRequest{PlaybackURI: uri})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), "GET", "http://"+m.Host+"/ISAPI/ContentMgmt/download", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/xml")
+	req.SetBasicAuth(m.User, m.Password.Value())
+
+	resp, err := device.Do(egress.Client("hikvision", downloadTimeout), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("download returned status code %d", resp.StatusCode)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// exportHandler streams the recordings of the device between a start and end time, segments are concatenated in the order the device returns them.
+func (m *hikvision) exportHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+	streaming := false
+
+	defer func() {
+		if !streaming {
+			device.JSONResponse(w, httpCode, jsonResponse)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := exportRequest{}
+	if err := device.DecodeQuery(r.URL.Query(), &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, request.Start)
+	if err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: start", nil)
+		return
+	}
+
+	end, err := time.Parse(time.RFC3339, request.End)
+	if err != nil || !end.After(start) {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: end", nil)
+		return
+	}
+
+	uris, err := m.search(r.Context(), start, end)
+	if err != nil {
+		logging.Log(logging.Error, "Failed to search recordings of \"%s\": %v", m.Name, err)
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	if len(uris) == 0 {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusNotFound, "Not Found", nil)
+		return
+	}
+
+	streaming = true
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_%s_%s.mp4\"", m.Name, start.UTC().Format(playbackTime), end.UTC().Format(playbackTime)))
+	w.WriteHeader(http.StatusOK)
+
+	for _, uri := range uris {
+		if err := m.download(r, clampPlaybackURI(uri, start, end), w); err != nil {
+			logging.Log(logging.Error, "Failed to export recording of \"%s\": %v", m.Name, err)
+			return
+		}
+	}
+}
+
 // getDeviceNames returns the names of all Hikvision devices in the base configuration.
 func (b *base) getDeviceNames() []string {
 	var names []string
@@ -397,19 +652,18 @@ func (b *base) getDevice(name string) *hikvision {
 	return nil
 }
 
-// multiHTTP performs HTTP requests to control multiple Hikvision devices in parallel and returns their statuses.
-func (b *base) multiHTTP(devices []*deviceValues, method string) chan *namedStatus {
+// multiHTTP performs HTTP requests to control multiple Hikvision devices in parallel, or in sequence when the request asked for one, and
+// returns their statuses.
+func (b *base) multiHTTP(ctx context.Context, devices []*deviceValues, method string) chan *namedStatus {
 	if method != "GET" && method != "PUT" {
 		return nil
 	}
 
-	wg := sync.WaitGroup{}
 	responses := make(chan *namedStatus, len(devices))
 
-	for _, d := range devices {
-		wg.Add(1)
-		go func(d *deviceValues, method string) {
-			defer wg.Done()
+	go func() {
+		device.Each(ctx, len(devices), method == "PUT", func(i int) {
+			d := devices[i]
 			response := namedStatus{
 				Name:   d.Device.Name,
 				Status: nil,
@@ -418,18 +672,19 @@ func (b *base) multiHTTP(devices []*deviceValues, method string) chan *namedStat
 			var status *supplementLightResponseGet
 			var err error
 			if method == "GET" {
-				status, err = d.Device.get()
+				status, err = d.Device.get(ctx)
 			} else if method == "PUT" {
 				irCutFilterType := "auto"
 				if d.Value == "colorVuWhiteLight" {
 					irCutFilterType = "night"
 				}
-				err = d.Device.ircutPut(irCutFilterType)
+				err = d.Device.ircutPut(ctx, irCutFilterType)
 				if err == nil {
-					err = d.Device.put(d.Value)
+					err = d.Device.put(ctx, d.Value)
 				}
 			}
 			if err != nil {
+				response.err = err
 				responses <- &response
 				return
 			}
@@ -447,11 +702,7 @@ func (b *base) multiHTTP(devices []*deviceValues, method string) chan *namedStat
 				response.Status = statusResp
 			}
 			responses <- &response
-		}(d, method)
-	}
-
-	go func() {
-		wg.Wait()
+		})
 		close(responses)
 	}()
 
@@ -477,16 +728,9 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	if !validCode(request.Code) {
@@ -508,12 +752,22 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter: hosts (Device '%s' does not exist)", h), nil)
 			return
 		}
+
+		// Devices taken out of rotation are excluded from groups
+		if !device.Enabled(d.Name) {
+			continue
+		}
 		devices = append(devices, &deviceValues{
 			Device: d,
 			Value:  d.DefaultMode,
 		})
 	}
 
+	if len(devices) == 0 {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusServiceUnavailable, "Service Unavailable", nil)
+		return
+	}
+
 	if request.Value != "" && !validValue(request.Value) {
 		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
 		return
@@ -521,16 +775,16 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 
 	switch request.Code {
 	case "status":
-		responses := b.multiHTTP(devices, "GET")
+		responses := b.multiHTTP(r.Context(), devices, "GET")
 
 		responseStruct := struct {
 			Devices []*namedStatus `json:"devices,omitempty"`
-			Errors  []string       `json:"errors,omitempty"`
 		}{}
+		failures := []device.Failure{}
 
 		for r := range responses {
 			if r.Status == nil {
-				responseStruct.Errors = append(responseStruct.Errors, r.Name)
+				failures = append(failures, device.NewFailure(r.Name, r.err))
 				continue
 			}
 			responseStruct.Devices = append(responseStruct.Devices, r)
@@ -540,13 +794,17 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 			return responseStruct.Devices[i].Name < responseStruct.Devices[j].Name
 		})
 
-		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", responseStruct)
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(responseStruct.Devices), responseStruct.Devices, failures)
 	case "toggle":
-		valueTally := int64(0)
-		ledOnDevices := []*deviceValues{}
+		// The first device of the group decides the vote strategy of the group
+		strategy := devices[0].Device.Vote
+		on := false
 
-		if request.Value == "" {
-			responses := b.multiHTTP(devices, "GET")
+		if request.Value == "" && !device.VoteNeedsState(strategy) {
+			on = device.Vote(strategy, nil)
+		} else if request.Value == "" {
+			responses := b.multiHTTP(r.Context(), devices, "GET")
+			votes := map[string]bool{}
 
 			for r := range responses {
 				if r.Status == nil {
@@ -566,46 +824,45 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 
-				if d.supplementLightModeIsDefault(response.SupplementLightMode) {
-					valueTally++
-				}
-
-				ledOnDevices = append(ledOnDevices, &deviceValues{
-					Device: d,
-					Value:  "colorVuWhiteLight",
-				})
+				votes[r.Name] = !d.supplementLightModeIsDefault(response.SupplementLightMode)
 			}
 
-			// Each device votes for next state, if most devices are in default state (off), all device LEDs will be toggled on and vice versa
+			// Each device votes for next state, by default if most device LEDs are on, all device LEDs will be toggled off (default
+			// state) and vice versa
 			if len(devices) == 0 {
 				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 				return
 			}
+			states := []bool{}
+			for _, d := range devices {
+				if state, ok := votes[d.Device.Name]; ok {
+					states = append(states, state)
+				}
+			}
+			on = device.Vote(strategy, states)
 		} else {
 			for i := range devices {
 				devices[i].Value = request.Value
 			}
 		}
 
-		var responses chan *namedStatus
-		if valueTally <= int64(len(devices))/2 {
-			responses = b.multiHTTP(devices, "PUT")
-		} else {
-			responses = b.multiHTTP(ledOnDevices, "PUT")
+		if on {
+			for i := range devices {
+				devices[i].Value = "colorVuWhiteLight"
+			}
 		}
+		responses := b.multiHTTP(r.Context(), devices, "PUT")
 
-		hik := []*hikvision{}
+		succeeded := 0
+		failures := []device.Failure{}
 		for r := range responses {
 			if r.Status == nil {
+				failures = append(failures, device.NewFailure(r.Name, r.err))
 				continue
 			}
-			hik = append(hik, b.getDevice(r.Name))
+			succeeded++
 		}
 
-		if len(hik) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
-		}
+		httpCode, jsonResponse = device.SetMultiStatusResponse(succeeded, nil, failures)
 	}
 }
@@ -2,15 +2,20 @@ package hikvision
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/kennedn/restate-go/internal/common/config"
 	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +37,10 @@ func setupHTTPServer(t *testing.T, serverConfigPath string) *httptest.Server {
 			Code int    `yaml:"code"`
 			JSON string `yaml:"json"`
 		} `yaml:"put"`
+		Search struct {
+			Code int    `yaml:"code"`
+			XML  string `yaml:"xml"`
+		} `yaml:"search"`
 	}{}
 
 	if err := yaml.Unmarshal(serverConfigFile, &serverConfig); err != nil {
@@ -40,12 +49,21 @@ func setupHTTPServer(t *testing.T, serverConfigPath string) *httptest.Server {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
-		switch r.Method {
-		case "GET":
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/ISAPI/ContentMgmt/search":
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(serverConfig.Search.Code)
+			w.Write([]byte(serverConfig.Search.XML))
+		case r.Method == "GET" && r.URL.Path == "/ISAPI/ContentMgmt/download":
+			// Echo the download request so that the requested playback URI can be asserted
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+		case r.Method == "GET":
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(serverConfig.Get.Code)
 			w.Write([]byte(serverConfig.Get.JSON))
-		case "PUT":
+		case r.Method == "PUT":
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(serverConfig.Put.Code)
 			w.Write([]byte(serverConfig.Put.JSON))
@@ -67,7 +85,7 @@ func TestRoutes(t *testing.T) {
 		{
 			name:          "no_error",
 			configPath:    "testdata/hikvisionConfig/normal_config.yaml",
-			routeCount:    4,
+			routeCount:    6,
 			expectedError: nil,
 		},
 		{
@@ -123,9 +141,60 @@ func TestHandler(t *testing.T) {
 		data            []byte
 		serverConfig    string
 		hikvisionConfig string
+		disabled        []string
 		expectedCode    int
 		expectedBody    string
 	}{
+		{
+			name:            "export",
+			method:          "GET",
+			url:             "/hikvision/front_camera/export?start=2024-01-01T12:00:00Z&end=2024-01-01T12:30:00Z",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			expectedCode:    200,
+			expectedBody:    `<downloadRequest><playbackURI>rtsp://192.168.1.1/Streaming/tracks/101/?endtime=20240101T121500Z&amp;name=00000000001000000&amp;size=1024&amp;starttime=20240101T120000Z</playbackURI></downloadRequest><downloadRequest><playbackURI>rtsp://192.168.1.1/Streaming/tracks/101/?endtime=20240101T123000Z&amp;name=00000000002000000&amp;size=1024&amp;starttime=20240101T121500Z</playbackURI></downloadRequest>`,
+		},
+		{
+			name:            "export_no_recordings",
+			method:          "GET",
+			url:             "/hikvision/front_camera/export?start=2024-01-01T12:00:00Z&end=2024-01-01T12:30:00Z",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/no_recordings_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			expectedCode:    404,
+			expectedBody:    `{"version":1,"message":"Not Found"}`,
+		},
+		{
+			name:            "export_invalid_start",
+			method:          "GET",
+			url:             "/hikvision/front_camera/export?start=yesterday&end=2024-01-01T12:30:00Z",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			expectedCode:    400,
+			expectedBody:    `{"version":1,"message":"Invalid Parameter: start"}`,
+		},
+		{
+			name:            "export_end_before_start",
+			method:          "GET",
+			url:             "/hikvision/front_camera/export?start=2024-01-01T12:30:00Z&end=2024-01-01T12:00:00Z",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			expectedCode:    400,
+			expectedBody:    `{"version":1,"message":"Invalid Parameter: end"}`,
+		},
+		{
+			name:            "export_invalid_method",
+			method:          "POST",
+			url:             "/hikvision/front_camera/export?start=2024-01-01T12:00:00Z&end=2024-01-01T12:30:00Z",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			expectedCode:    405,
+			expectedBody:    `{"version":1,"message":"Method Not Allowed"}`,
+		},
 		{
 			name:            "status_no_error",
 			method:          "POST",
@@ -134,7 +203,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    200,
-			expectedBody:    `{"message":"OK","data":{"onoff":"on","supplementlightmode":"irLight"}}`,
+			expectedBody:    `{"version":1,"message":"OK","data":{"onoff":"on","supplementlightmode":"irLight"}}`,
 		},
 		{
 			name:            "toggle_no_error",
@@ -144,7 +213,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    200,
-			expectedBody:    `{"message":"OK"}`,
+			expectedBody:    `{"version":1,"message":"OK"}`,
 		},
 		{
 			name:            "get_device_request",
@@ -154,7 +223,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    200,
-			expectedBody:    `{"message":"OK","data":["toggle","status"]}`,
+			expectedBody:    `{"version":1,"message":"OK","data":["toggle","status"]}`,
 		},
 		{
 			name:            "get_base_request",
@@ -164,7 +233,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    200,
-			expectedBody:    `{"message":"OK","data":["front_camera","back_camera"]}`,
+			expectedBody:    `{"version":1,"message":"OK","data":["front_camera","back_camera"]}`,
 		},
 		{
 			name:            "get_base_request_single_device",
@@ -184,7 +253,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    405,
-			expectedBody:    `{"message":"Method Not Allowed"}`,
+			expectedBody:    `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:            "unsupported_base_method",
@@ -194,7 +263,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    405,
-			expectedBody:    `{"message":"Method Not Allowed"}`,
+			expectedBody:    `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:            "malformed_json_body",
@@ -204,7 +273,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    400,
-			expectedBody:    `{"message":"Malformed Or Empty JSON Body"}`,
+			expectedBody:    `{"version":1,"message":"Malformed Or Empty JSON Body"}`,
 		},
 		{
 			name:            "malformed_query_string",
@@ -214,7 +283,17 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    400,
-			expectedBody:    `{"message":"Malformed or empty query string"}`,
+			expectedBody:    `{"version":1,"message":"Malformed or empty query string"}`,
+		},
+		{
+			name:            "unknown_json_field",
+			method:          "POST",
+			url:             "/hikvision/front_camera",
+			data:            []byte(`{"code":"toggle","monkey":"test"}`),
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			expectedCode:    400,
+			expectedBody:    `{"version":1,"message":"Malformed Or Empty JSON Body"}`,
 		},
 		{
 			name:            "unsupported_code_variable",
@@ -224,7 +303,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    400,
-			expectedBody:    `{"message":"Invalid Parameter: code"}`,
+			expectedBody:    `{"version":1,"message":"Invalid Parameter: code"}`,
 		},
 		{
 			name:            "malformed_value",
@@ -234,7 +313,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    400,
-			expectedBody:    `{"message":"Invalid Parameter: value"}`,
+			expectedBody:    `{"version":1,"message":"Invalid Parameter: value"}`,
 		},
 		{
 			name:            "multi_status_no_error",
@@ -244,7 +323,29 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    200,
-			expectedBody:    `{"message":"OK","data":{"devices":[{"name":"back_camera","status":{"onoff":"off","supplementlightmode":"irLight"}},{"name":"front_camera","status":{"onoff":"on","supplementlightmode":"irLight"}}]}}`,
+			expectedBody:    `{"version":1,"message":"OK","data":{"devices":[{"name":"back_camera","status":{"onoff":"off","supplementlightmode":"irLight"}},{"name":"front_camera","status":{"onoff":"on","supplementlightmode":"irLight"}}]}}`,
+		},
+		{
+			name:            "multi_status_disabled_excluded",
+			method:          "POST",
+			url:             "/hikvision/?code=status&hosts=front_camera,back_camera",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			disabled:        []string{"front_camera"},
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK","data":{"devices":[{"name":"back_camera","status":{"onoff":"off","supplementlightmode":"irLight"}}]}}`,
+		},
+		{
+			name:            "multi_status_all_disabled",
+			method:          "POST",
+			url:             "/hikvision/?code=status&hosts=front_camera,back_camera",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			disabled:        []string{"front_camera", "back_camera"},
+			expectedCode:    503,
+			expectedBody:    `{"version":1,"message":"Service Unavailable"}`,
 		},
 		{
 			name:            "multi_toggle_no_error",
@@ -254,7 +355,17 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    200,
-			expectedBody:    `{"message":"OK"}`,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:            "multi_status_repeated_hosts",
+			method:          "POST",
+			url:             "/hikvision/?code=status&hosts=front_camera&hosts=back_camera",
+			data:            nil,
+			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
+			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK","data":{"devices":[{"name":"back_camera","status":{"onoff":"off","supplementlightmode":"irLight"}},{"name":"front_camera","status":{"onoff":"on","supplementlightmode":"irLight"}}]}}`,
 		},
 		{
 			name:            "multi_toggle_no_value",
@@ -264,7 +375,7 @@ func TestHandler(t *testing.T) {
 			serverConfig:    "testdata/serverConfig/normal_responses.yaml",
 			hikvisionConfig: "testdata/hikvisionConfig/normal_config.yaml",
 			expectedCode:    200,
-			expectedBody:    `{"message":"OK"}`,
+			expectedBody:    `{"version":1,"message":"OK"}`,
 		},
 	}
 
@@ -291,6 +402,11 @@ func TestHandler(t *testing.T) {
 				router.HandleFunc(r.Path, r.Handler)
 			}
 
+			for _, name := range tc.disabled {
+				device.SetEnabled(name, false)
+				defer device.SetEnabled(name, true)
+			}
+
 			server := setupHTTPServer(t, tc.serverConfig)
 			for i := range base.Devices {
 				base.Devices[i].Host = strings.TrimPrefix(server.URL, "http://")
@@ -315,3 +431,263 @@ func TestHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	configFile, err := os.ReadFile("testdata/hikvisionConfig/normal_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read hikvision config")
+	}
+	hikvisionConfig := config.Config{}
+	if err := yaml.Unmarshal(configFile, &hikvisionConfig); err != nil {
+		t.Fatalf("Could not parse hikvision config")
+	}
+
+	base, routes, err := routes(&hikvisionConfig)
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			puts++
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	for i := range base.Devices {
+		base.Devices[i].Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	ctx, dryRun := device.WithDryRun(context.Background())
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/hikvision/front_camera?code=toggle&value=colorVuWhiteLight", nil)
+	router.ServeHTTP(recorder, request.WithContext(ctx))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", http.StatusOK, recorder.Code)
+	}
+	if puts != 0 {
+		t.Errorf("Expected no PUT requests during a dry run, got %d", puts)
+	}
+
+	calls := dryRun.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 recorded calls, got %d", len(calls))
+	}
+	expectedURLs := []string{server.URL + "/ISAPI/Image/channels/1/ircutFilter", server.URL + "/ISAPI/Image/channels/1/supplementLight"}
+	for i, call := range calls {
+		if call.Method != "PUT" || call.URL != expectedURLs[i] {
+			t.Errorf("Unexpected call. Expected: PUT %s, Got: %s %s", expectedURLs[i], call.Method, call.URL)
+		}
+	}
+}
+
+func TestMultiStatus(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	configFile, err := os.ReadFile("testdata/hikvisionConfig/normal_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read hikvision config")
+	}
+	hikvisionConfig := config.Config{}
+	if err := yaml.Unmarshal(configFile, &hikvisionConfig); err != nil {
+		t.Fatalf("Could not parse hikvision config")
+	}
+
+	base, routes, err := routes(&hikvisionConfig)
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	server := setupHTTPServer(t, "testdata/serverConfig/normal_responses.yaml")
+	defer server.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	for i := range base.Devices {
+		base.Devices[i].Host = strings.TrimPrefix(server.URL, "http://")
+		if base.Devices[i].Name == "back_camera" {
+			base.Devices[i].Host = strings.TrimPrefix(unreachable.URL, "http://")
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedData string
+	}{
+		{
+			name:         "status_partial_failure",
+			url:          "/hikvision/?code=status&hosts=front_camera,back_camera",
+			expectedCode: 207,
+			expectedData: `{"devices":[{"name":"front_camera","status":{"onoff":"on","supplementlightmode":"irLight"}}],"errors":[{"name":"back_camera","code":500}]}`,
+		},
+		{
+			name:         "toggle_partial_failure",
+			url:          "/hikvision/?code=toggle&hosts=front_camera,back_camera&value=eventIntelligence",
+			expectedCode: 207,
+			expectedData: `{"errors":[{"name":"back_camera","code":500}]}`,
+		},
+		{
+			name:         "toggle_all_failed",
+			url:          "/hikvision/?code=toggle&hosts=back_camera&value=eventIntelligence",
+			expectedCode: 500,
+			expectedData: `{"errors":[{"name":"back_camera","code":500}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", tc.url, nil))
+
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+
+			response := struct {
+				Data struct {
+					Devices []any `json:"devices,omitempty"`
+					Errors  []struct {
+						Name  string `json:"name"`
+						Code  int    `json:"code"`
+						Error string `json:"error,omitempty"`
+					} `json:"errors"`
+				} `json:"data"`
+			}{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Could not decode response: %v", err)
+			}
+			// Error details name the unreachable address, which changes between runs
+			for i := range response.Data.Errors {
+				assert.NotEmpty(t, response.Data.Errors[i].Error)
+				response.Data.Errors[i].Error = ""
+			}
+			data, _ := json.Marshal(response.Data)
+			assert.JSONEq(t, tc.expectedData, string(data))
+		})
+	}
+}
+
+func TestVote(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	configFile, err := os.ReadFile("testdata/hikvisionConfig/normal_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read hikvision config")
+	}
+	hikvisionConfig := config.Config{}
+	if err := yaml.Unmarshal(configFile, &hikvisionConfig); err != nil {
+		t.Fatalf("Could not parse hikvision config")
+	}
+
+	base, routes, err := routes(&hikvisionConfig)
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	// Both cameras report irLight, which is on for front_camera and the default (off) for back_camera
+	get, err := os.ReadFile("testdata/serverConfig/normal_responses.yaml")
+	if err != nil {
+		t.Fatalf("Could not read serverConfigPath")
+	}
+	serverConfig := struct {
+		Get struct {
+			JSON string `yaml:"json"`
+		} `yaml:"get"`
+	}{}
+	if err := yaml.Unmarshal(get, &serverConfig); err != nil {
+		t.Fatalf("Could not parse serverConfigPath")
+	}
+
+	// The LEDs of each camera are on when it was last sent the white light mode
+	ledOn := map[string]bool{}
+	mutex := sync.Mutex{}
+	for _, d := range base.Devices {
+		name := d.Name
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/supplementLight") {
+				mutex.Lock()
+				ledOn[name] = strings.Contains(string(body), "colorVuWhiteLight")
+				mutex.Unlock()
+			}
+			w.WriteHeader(http.StatusOK)
+			if r.Method == "GET" {
+				w.Write([]byte(serverConfig.Get.JSON))
+			}
+		}))
+		defer server.Close()
+		d.Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	testCases := []struct {
+		name     string
+		vote     string
+		hosts    string
+		expected bool
+	}{
+		{
+			name:     "majority_tie",
+			vote:     "",
+			hosts:    "front_camera,back_camera",
+			expected: true,
+		},
+		{
+			name:     "any",
+			vote:     device.VoteAny,
+			hosts:    "front_camera,back_camera",
+			expected: false,
+		},
+		{
+			name:     "first_on",
+			vote:     device.VoteFirst,
+			hosts:    "front_camera,back_camera",
+			expected: false,
+		},
+		{
+			name:     "first_off",
+			vote:     device.VoteFirst,
+			hosts:    "back_camera,front_camera",
+			expected: true,
+		},
+		{
+			name:     "on",
+			vote:     device.VoteOn,
+			hosts:    "front_camera,back_camera",
+			expected: true,
+		},
+		{
+			name:     "off",
+			vote:     device.VoteOff,
+			hosts:    "back_camera,front_camera",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, d := range base.Devices {
+				d.Vote = tc.vote
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", "/hikvision/?code=toggle&hosts="+tc.hosts, nil))
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, map[string]bool{"front_camera": tc.expected, "back_camera": tc.expected}, ledOn)
+		})
+	}
+}
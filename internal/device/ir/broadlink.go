@@ -0,0 +1,262 @@
+package ir
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Broadlink command types and IR commands
+const (
+	broadlinkAuth    = 0x65
+	broadlinkCommand = 0x6a
+	broadlinkSend    = 0x02
+	broadlinkLearn   = 0x03
+	broadlinkCheck   = 0x04
+)
+
+var (
+	// Every device starts with the same key and IV, authenticating swaps the key for one unique to the session
+	broadlinkKey = []byte{0x09, 0x76, 0x28, 0x34, 0x3f, 0xe9, 0x9e, 0x23, 0x76, 0x5c, 0x15, 0x13, 0xac, 0xcf, 0x8b, 0x02}
+	broadlinkIV  = []byte{0x56, 0x2e, 0x17, 0x99, 0x6d, 0x09, 0x3d, 0x28, 0xdd, 0xb3, 0xba, 0x69, 0x5a, 0xe2, 0xe8, 0xb0}
+)
+
+// broadlink drives Broadlink RM blasters over their encrypted UDP protocol, learning codes as well as sending them.
+// Codes are the base64 encoded data captured by the blaster.
+type broadlink struct {
+	Host    string `yaml:"host"`
+	MAC     string `yaml:"mac"`
+	DevType uint16 `yaml:"devType"`
+	RM4     bool   `yaml:"rm4"`
+	timeout uint
+	poll    time.Duration
+	mutex   sync.Mutex
+	key     []byte
+	id      uint32
+	count   uint16
+}
+
+// broadlinkError is an error code returned by a blaster, checking for a learned code before one has been received returns one.
+type broadlinkError struct {
+	code int16
+}
+
+func (e *broadlinkError) Error() string {
+	return fmt.Sprintf("broadlink returned error %d", e.code)
+}
+
+// broadlinkCrypt encrypts or decrypts data with AES-128-CBC.
+func broadlinkCrypt(key []byte, data []byte, encrypt bool) ([]byte, error) {
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("broadlink payload is not a multiple of the block size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCBCEncrypter(block, broadlinkIV).CryptBlocks(out, data)
+	} else {
+		cipher.NewCBCDecrypter(block, broadlinkIV).CryptBlocks(out, data)
+	}
+	return out, nil
+}
+
+// broadlinkChecksum returns the checksum used for both packets and payloads.
+func broadlinkChecksum(b []byte) uint16 {
+	sum := uint32(0xbeaf)
+	for _, c := range b {
+		sum += uint32(c)
+	}
+	return uint16(sum)
+}
+
+// packet builds a packet of the given type around an encrypted payload.
+func (b *broadlink) packet(packetType uint16, payload []byte, key []byte) ([]byte, error) {
+	mac, err := net.ParseMAC(b.MAC)
+	if err != nil && b.MAC != "" {
+		return nil, err
+	}
+
+	b.count = (b.count + 1) | 0x8000
+	packet := make([]byte, 0x38)
+	copy(packet, []byte{0x5a, 0xa5, 0xaa, 0x55, 0x5a, 0xa5, 0xaa, 0x55})
+	binary.LittleEndian.PutUint16(packet[0x24:], b.DevType)
+	binary.LittleEndian.PutUint16(packet[0x26:], packetType)
+	binary.LittleEndian.PutUint16(packet[0x28:], b.count)
+	// The MAC address is sent in reverse
+	for i := 0; i < len(mac) && i < 6; i++ {
+		packet[0x2f-i] = mac[i]
+	}
+	binary.LittleEndian.PutUint32(packet[0x30:], b.id)
+	binary.LittleEndian.PutUint16(packet[0x34:], broadlinkChecksum(payload))
+
+	padded := append(append([]byte{}, payload...), make([]byte, (aes.BlockSize-len(payload)%aes.BlockSize)%aes.BlockSize)...)
+	encrypted, err := broadlinkCrypt(key, padded, true)
+	if err != nil {
+		return nil, err
+	}
+	packet = append(packet, encrypted...)
+	binary.LittleEndian.PutUint16(packet[0x20:], broadlinkChecksum(packet))
+	return packet, nil
+}
+
+// exchange sends a packet to the blaster and returns the decrypted payload of its response.
+func (b *broadlink) exchange(packetType uint16, payload []byte, key []byte) ([]byte, error) {
+	packet, err := b.packet(packetType, payload, key)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", b.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(b.timeout) * time.Millisecond)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 2048)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0x38 {
+		return nil, errors.New("short response from broadlink")
+	}
+	if code := int16(binary.LittleEndian.Uint16(response[0x22:])); code != 0 {
+		return nil, &broadlinkError{code: code}
+	}
+	return broadlinkCrypt(key, response[0x38:n], false)
+}
+
+// authenticate exchanges the shared key for a session key and ID.
+func (b *broadlink) authenticate() error {
+	payload := make([]byte, 0x50)
+	for i := 0x04; i < 0x14; i++ {
+		payload[i] = 0x31
+	}
+	payload[0x1e] = 0x01
+	payload[0x2d] = 0x01
+	copy(payload[0x30:], "restate")
+
+	b.id = 0
+	response, err := b.exchange(broadlinkAuth, payload, broadlinkKey)
+	if err != nil {
+		return err
+	}
+	if len(response) < 0x14 {
+		return errors.New("short authentication response from broadlink")
+	}
+	b.id = binary.LittleEndian.Uint32(response)
+	b.key = append([]byte{}, response[0x04:0x14]...)
+	return nil
+}
+
+// command authenticates if needed and runs an IR command, returning its response data. RM4 models prefix commands and responses
+// with their length.
+func (b *broadlink) command(command uint32, data []byte) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.key == nil {
+		if err := b.authenticate(); err != nil {
+			return nil, err
+		}
+	}
+
+	payload := binary.LittleEndian.AppendUint32(nil, command)
+	if b.RM4 {
+		payload = binary.LittleEndian.AppendUint16(nil, uint16(len(data)+4))
+		payload = binary.LittleEndian.AppendUint32(payload, command)
+	}
+	payload = append(payload, data...)
+
+	response, err := b.exchange(broadlinkCommand, payload, b.key)
+	if err != nil {
+		// Sessions do not survive a restart of the blaster, so authenticate again next time
+		var blErr *broadlinkError
+		if !errors.As(err, &blErr) {
+			b.key = nil
+		}
+		return nil, err
+	}
+
+	if !b.RM4 {
+		if len(response) < 4 {
+			return nil, errors.New("short response from broadlink")
+		}
+		return response[4:], nil
+	}
+	if len(response) < 6 {
+		return nil, errors.New("short response from broadlink")
+	}
+	length := int(binary.LittleEndian.Uint16(response)) + 2
+	if length < 6 || length > len(response) {
+		return nil, errors.New("invalid response length from broadlink")
+	}
+	return response[6:length], nil
+}
+
+// send replays a learned code, recording it instead during a dry run.
+func (b *broadlink) send(ctx context.Context, code string) error {
+	data, err := base64.StdEncoding.DecodeString(code)
+	if err != nil {
+		return err
+	}
+	if device.Record(ctx, device.Call{Method: "UDP", URL: "udp://" + b.Host, Payload: map[string]string{"code": code}}) {
+		return nil
+	}
+	_, err = b.command(broadlinkSend, data)
+	return err
+}
+
+// validate checks that a code can be sent by the blaster.
+func (b *broadlink) validate(code string) error {
+	data, err := base64.StdEncoding.DecodeString(code)
+	if err == nil && len(data) == 0 {
+		err = errors.New("empty code")
+	}
+	return err
+}
+
+// learn puts the blaster into learning mode and polls it until a code is received or timeout passes.
+func (b *broadlink) learn(timeout time.Duration) (string, error) {
+	if _, err := b.command(broadlinkLearn, nil); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(b.poll)
+		data, err := b.command(broadlinkCheck, nil)
+		// The blaster returns an error until it has received a code
+		var blErr *broadlinkError
+		if errors.As(err, &blErr) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(data) > 0 {
+			return base64.StdEncoding.EncodeToString(data), nil
+		}
+	}
+	return "", errors.New("no code received before learning timed out")
+}
@@ -0,0 +1,415 @@
+// Package ir provides IR blasters with a library of named codes, learning new codes from a remote and replaying them by name.
+package ir
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driver is implemented by each supported blaster.
+type driver interface {
+	send(ctx context.Context, code string) error
+	validate(code string) error
+}
+
+// learner is implemented by blasters that can capture codes from a remote.
+type learner interface {
+	learn(timeout time.Duration) (string, error)
+}
+
+// request allows code names as values, and a library of codes to import.
+type request struct {
+	Code  string            `json:"code"`
+	Value string            `json:"value,omitempty"`
+	Codes map[string]string `json:"codes,omitempty" schema:"-"`
+}
+
+// learnResult is the outcome of the most recent learning attempt.
+type learnResult struct {
+	Name  string `json:"name"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// status is the representation of a blaster returned by the status code.
+type status struct {
+	Learning string       `json:"learning,omitempty"`
+	Last     *learnResult `json:"last,omitempty"`
+	Codes    int          `json:"codes"`
+}
+
+// ir represents an IR blaster configuration with name, driver, driver specific parameters and any codes known up front.
+type ir struct {
+	Name         string            `yaml:"name"`
+	Timeout      uint              `yaml:"timeoutMs"`
+	LearnTimeout uint              `yaml:"learnTimeoutMs"`
+	Driver       string            `yaml:"driver"`
+	Broadlink    *broadlink        `yaml:"broadlink"`
+	Tasmota      *tasmota          `yaml:"tasmota"`
+	Codes        map[string]string `yaml:"codes"`
+	Base         base
+	driver       driver
+	mutex        sync.Mutex
+	library      map[string]string
+	learning     string
+	last         *learnResult
+}
+
+// base represents a list of blasters
+type base struct {
+	Devices []*ir
+}
+
+type Device struct{}
+
+// DryRun previews codes sent to the blaster, learning, deleting and importing only validate.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for IR blasters based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Broadlink and Tasmota blasters from config, checking each code against its driver, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "ir" {
+			continue
+		}
+		ir := ir{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &ir); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if ir.Name == "" || ir.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch ir.Driver {
+		case "broadlink":
+			if ir.Broadlink == nil || ir.Broadlink.Host == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if _, _, err := net.SplitHostPort(ir.Broadlink.Host); err != nil {
+				ir.Broadlink.Host = net.JoinHostPort(ir.Broadlink.Host, "80")
+			}
+			// Defaults to an RM mini 3, which identifies itself the same way as most older models
+			if ir.Broadlink.DevType == 0 {
+				ir.Broadlink.DevType = 0x2737
+			}
+			ir.Broadlink.timeout = ir.Timeout
+			ir.Broadlink.poll = time.Second
+			ir.driver = ir.Broadlink
+		case "tasmota":
+			if ir.Tasmota == nil || ir.Tasmota.URL == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			ir.Tasmota.timeout = ir.Timeout
+			ir.driver = ir.Tasmota
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'broadlink' or 'tasmota'")
+			continue
+		}
+
+		if ir.LearnTimeout == 0 {
+			ir.LearnTimeout = 30000
+		}
+
+		invalid := false
+		for name, code := range ir.Codes {
+			if err := ir.driver.validate(code); err != nil {
+				logging.Log(logging.Info, "Unable to load device \"%s\": code \"%s\": %v", ir.Name, name, err)
+				invalid = true
+				break
+			}
+		}
+		if invalid {
+			continue
+		}
+		ir.restore()
+
+		routes = append(routes, router.Route{
+			Path:    "/" + ir.Name,
+			Handler: ir.handler,
+		})
+
+		base.Devices = append(base.Devices, &ir)
+
+		logging.Log(logging.Info, "Found device \"%s\"", ir.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/ir" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/ir",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/ir/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// restore builds the library from the configured codes and those persisted from earlier learning and imports, which take precedence.
+func (i *ir) restore() {
+	i.library = map[string]string{}
+	for name, code := range i.Codes {
+		i.library[name] = code
+	}
+
+	saved := map[string]string{}
+	storage.Load("ir/"+i.Name, &saved)
+	for name, code := range saved {
+		i.library[name] = code
+	}
+}
+
+// save persists the library, must be called with the mutex held.
+func (i *ir) save() {
+	if err := storage.Save("ir/"+i.Name, i.library); err != nil {
+		logging.Log(logging.Error, "Unable to save codes of \"%s\": %v", i.Name, err)
+	}
+}
+
+// getCodes returns a list of control codes for a blaster, learn is only offered by blasters that support it.
+func (i *ir) getCodes() []string {
+	if _, ok := i.driver.(learner); ok {
+		return []string{"status", "codes", "send", "learn", "delete", "export", "import"}
+	}
+	return []string{"status", "codes", "send", "delete", "export", "import"}
+}
+
+// names returns the sorted names of the codes in the library.
+func (i *ir) names() []string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	names := []string{}
+	for name := range i.library {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// status returns the learning state and size of the library.
+func (i *ir) status() *status {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return &status{Learning: i.learning, Last: i.last, Codes: len(i.library)}
+}
+
+// startLearning captures a code in the background, since waiting for a button press outlasts a request. It reports false when
+// learning is already in progress.
+func (i *ir) startLearning(l learner, name string) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.learning != "" {
+		return false
+	}
+	i.learning = name
+
+	go func() {
+		code, err := l.learn(time.Duration(i.LearnTimeout) * time.Millisecond)
+
+		i.mutex.Lock()
+		defer i.mutex.Unlock()
+		i.learning = ""
+		i.last = &learnResult{Name: name}
+		if err != nil {
+			logging.Log(logging.Error, "Unable to learn \"%s\" on \"%s\": %v", name, i.Name, err)
+			i.last.Error = err.Error()
+			return
+		}
+		i.last.Code = code
+		i.library[name] = code
+		i.save()
+		logging.Log(logging.Info, "Learned \"%s\" on \"%s\"", name, i.Name)
+	}()
+	return true
+}
+
+// Handler is the HTTP handler for IR blaster control.
+func (i *ir) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", i.getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data = i.status()
+	case "codes":
+		data = i.names()
+	case "send":
+		i.mutex.Lock()
+		code, ok := i.library[request.Value]
+		i.mutex.Unlock()
+		if !ok {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = i.driver.send(r.Context(), code)
+	case "learn":
+		l, ok := i.driver.(learner)
+		if !ok {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+			return
+		}
+		if request.Value == "" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		if device.DryRunning(r.Context()) {
+			data = i.status()
+			break
+		}
+		if !i.startLearning(l, request.Value) {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusConflict, "Learning In Progress", nil)
+			return
+		}
+		data = i.status()
+	case "delete":
+		i.mutex.Lock()
+		_, ok := i.library[request.Value]
+		if ok && !device.DryRunning(r.Context()) {
+			delete(i.library, request.Value)
+			i.save()
+		}
+		i.mutex.Unlock()
+		if !ok {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+	case "export":
+		i.mutex.Lock()
+		library := map[string]string{}
+		for name, code := range i.library {
+			library[name] = code
+		}
+		i.mutex.Unlock()
+		data = library
+	case "import":
+		// Imported codes are merged into the library, replacing codes with the same name
+		if len(request.Codes) == 0 {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: codes", nil)
+			return
+		}
+		for name, code := range request.Codes {
+			if name == "" || i.driver.validate(code) != nil {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: codes", nil)
+				return
+			}
+		}
+		if device.DryRunning(r.Context()) {
+			data = i.names()
+			break
+		}
+		i.mutex.Lock()
+		for name, code := range request.Codes {
+			i.library[name] = code
+		}
+		i.save()
+		i.mutex.Unlock()
+		data = i.names()
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all blasters in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured blasters.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
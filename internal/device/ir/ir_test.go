@@ -0,0 +1,520 @@
+package ir
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// learnedCode is the code the emulated blaster captures while learning.
+var learnedCode = []byte{0x26, 0x00, 0x0a, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88}
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read ir input")
+	}
+
+	irConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &irConfig); err != nil {
+		t.Fatalf("Could not read ir input")
+	}
+	return &irConfig
+}
+
+// setupBroadlinkServer emulates an RM blaster that receives a code on the second check after entering learning mode, recording the
+// codes sent to it.
+func setupBroadlinkServer(t *testing.T, mutex *sync.Mutex, sent *[]string) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	sessionKey := []byte("0123456789abcdef")
+	checks := -1
+
+	// reply sends a response with an error code, encrypting any payload
+	reply := func(addr net.Addr, request []byte, code int16, key []byte, payload []byte) {
+		response := make([]byte, 0x38)
+		copy(response, request[:0x38])
+		binary.LittleEndian.PutUint16(response[0x22:], uint16(code))
+		if payload != nil {
+			padded := append(payload, make([]byte, (16-len(payload)%16)%16)...)
+			encrypted, _ := broadlinkCrypt(key, padded, true)
+			response = append(response, encrypted...)
+		}
+		conn.WriteTo(response, addr)
+	}
+
+	go func() {
+		buffer := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			request := append([]byte{}, buffer[:n]...)
+			unsigned := append([]byte{}, request...)
+			unsigned[0x20], unsigned[0x21] = 0, 0
+			if n < 0x38 || binary.LittleEndian.Uint16(request[0x20:]) != broadlinkChecksum(unsigned) {
+				continue
+			}
+
+			switch binary.LittleEndian.Uint16(request[0x26:]) {
+			case broadlinkAuth:
+				payload := make([]byte, 0x14)
+				binary.LittleEndian.PutUint32(payload, 1)
+				copy(payload[0x04:], sessionKey)
+				reply(addr, request, 0, broadlinkKey, payload)
+			case broadlinkCommand:
+				if binary.LittleEndian.Uint32(request[0x30:]) != 1 {
+					reply(addr, request, -1, sessionKey, nil)
+					continue
+				}
+				payload, err := broadlinkCrypt(sessionKey, request[0x38:], false)
+				if err != nil {
+					continue
+				}
+
+				mutex.Lock()
+				switch binary.LittleEndian.Uint32(payload) {
+				case broadlinkSend:
+					*sent = append(*sent, base64.StdEncoding.EncodeToString(payload[4:16]))
+					reply(addr, request, 0, sessionKey, payload[:4])
+				case broadlinkLearn:
+					checks = 0
+					reply(addr, request, 0, sessionKey, payload[:4])
+				case broadlinkCheck:
+					if checks < 1 {
+						if checks == 0 {
+							checks++
+						}
+						reply(addr, request, -7, sessionKey, nil)
+						break
+					}
+					checks = -1
+					reply(addr, request, 0, sessionKey, append(payload[:4], learnedCode...))
+				}
+				mutex.Unlock()
+			}
+		}
+	}()
+	return conn
+}
+
+// setupTasmotaServer emulates a Tasmota blaster that rejects the code "bad", recording the commands sent to it.
+func setupTasmotaServer(t *testing.T, mutex *sync.Mutex, commands *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/cm" || query.Get("user") != "admin" || query.Get("password") != "tasmota-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mutex.Lock()
+		*commands = append(*commands, query.Get("cmnd"))
+		mutex.Unlock()
+
+		if query.Get("cmnd") == "IRsend bad" {
+			w.Write([]byte(`{"IRSend":"Invalid JSON"}`))
+			return
+		}
+		w.Write([]byte(`{"IRSend":"Done"}`))
+	}))
+}
+
+// setupRouter loads the normal configuration against emulated blasters.
+func setupRouter(t *testing.T, broadlinkAddr string, tasmotaURL string) (*base, *mux.Router) {
+	base, routes, err := routes(loadConfig(t, "testdata/irConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	base.Devices[0].Broadlink.Host = broadlinkAddr
+	base.Devices[0].Broadlink.poll = time.Millisecond
+	base.Devices[1].Tasmota.URL = tasmotaURL
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+	return base, router
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/irConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/irConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/irConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/irConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/irConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		data             string
+		expectedCode     int
+		expectedBody     string
+		expectedSent     []string
+		expectedCommands []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/ir/lounge",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","codes","send","learn","delete","export","import"]}`,
+		},
+		{
+			name:         "get_device_request_without_learning",
+			method:       "GET",
+			url:          "/ir/bedroom",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","codes","send","delete","export","import"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/ir/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lounge","bedroom"]}`,
+		},
+		{
+			name:         "codes",
+			method:       "POST",
+			url:          "/ir/lounge?code=codes",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["tv_power"]}`,
+		},
+		{
+			name:         "send_broadlink",
+			method:       "POST",
+			url:          "/ir/lounge?code=send&value=tv_power",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSent: []string{"JgAKAAECAwQFBgcI"},
+		},
+		{
+			name:             "send_tasmota",
+			method:           "POST",
+			url:              "/ir/bedroom?code=send&value=fan",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedCommands: []string{`IRsend {"Protocol":"NEC","Bits":32,"Data":"0x00FF00FF"}`},
+		},
+		{
+			name:         "send_unknown_code",
+			method:       "POST",
+			url:          "/ir/lounge?code=send&value=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+			expectedSent: []string{},
+		},
+		{
+			name:         "learn_unsupported",
+			method:       "POST",
+			url:          "/ir/bedroom?code=learn&value=light",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "learn_without_value",
+			method:       "POST",
+			url:          "/ir/lounge?code=learn",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "import",
+			method:       "POST",
+			url:          "/ir/lounge",
+			data:         `{"code":"import","codes":{"tv_mute":"JgAKAAkJCQkJCQkJ"}}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["tv_mute","tv_power"]}`,
+		},
+		{
+			name:         "import_invalid_code",
+			method:       "POST",
+			url:          "/ir/lounge",
+			data:         `{"code":"import","codes":{"tv_input":"not base64!"}}`,
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: codes"}`,
+		},
+		{
+			name:         "import_without_codes",
+			method:       "POST",
+			url:          "/ir/lounge?code=import",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: codes"}`,
+		},
+		{
+			name:         "export",
+			method:       "POST",
+			url:          "/ir/lounge?code=export",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"tv_mute":"JgAKAAkJCQkJCQkJ","tv_power":"JgAKAAECAwQFBgcI"}}`,
+		},
+		{
+			name:         "send_imported",
+			method:       "POST",
+			url:          "/ir/lounge?code=send&value=tv_mute",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSent: []string{"JgAKAAkJCQkJCQkJ"},
+		},
+		{
+			name:         "delete",
+			method:       "POST",
+			url:          "/ir/lounge?code=delete&value=tv_mute",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "delete_unknown_code",
+			method:       "POST",
+			url:          "/ir/lounge?code=delete&value=tv_mute",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "status",
+			method:       "POST",
+			url:          "/ir/lounge?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"codes":1}}`,
+		},
+		{
+			name:         "import_rejected_code",
+			method:       "POST",
+			url:          "/ir/bedroom",
+			data:         `{"code":"import","codes":{"light":"bad"}}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["fan","light"]}`,
+		},
+		{
+			name:             "send_rejected_code",
+			method:           "POST",
+			url:              "/ir/bedroom?code=send&value=light",
+			expectedCode:     500,
+			expectedBody:     `{"version":1,"message":"Internal Server Error"}`,
+			expectedCommands: []string{"IRsend bad"},
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/ir/lounge?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/ir/lounge",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/ir/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	mutex := sync.Mutex{}
+	sent := []string{}
+	commands := []string{}
+	blaster := setupBroadlinkServer(t, &mutex, &sent)
+	defer blaster.Close()
+	tasmota := setupTasmotaServer(t, &mutex, &commands)
+	defer tasmota.Close()
+
+	_, router := setupRouter(t, blaster.LocalAddr().String(), tasmota.URL)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mutex.Lock()
+			sent = sent[:0]
+			commands = commands[:0]
+			mutex.Unlock()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if tc.expectedSent != nil {
+				assert.Equal(t, tc.expectedSent, sent)
+			}
+			if tc.expectedCommands != nil {
+				assert.Equal(t, tc.expectedCommands, commands)
+			}
+		})
+	}
+}
+
+func TestLearn(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	if err := storage.SetPath(filepath.Join(t.TempDir(), "state.json")); err != nil {
+		t.Fatalf("Could not set storage path: %v", err)
+	}
+	defer storage.SetPath("")
+
+	mutex := sync.Mutex{}
+	sent := []string{}
+	blaster := setupBroadlinkServer(t, &mutex, &sent)
+	defer blaster.Close()
+
+	base, router := setupRouter(t, blaster.LocalAddr().String(), "http://192.0.2.1")
+	base.Devices[0].Broadlink.poll = 50 * time.Millisecond
+
+	post := func(url string) (int, string) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// Learning is answered straight away and finishes in the background
+	code, body := post("/ir/lounge?code=learn&value=volume_up")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, `{"version":1,"message":"OK","data":{"learning":"volume_up","codes":1}}`, body)
+
+	code, body = post("/ir/lounge?code=learn&value=volume_down")
+	assert.Equal(t, 409, code)
+	assert.Equal(t, `{"version":1,"message":"Learning In Progress"}`, body)
+
+	learned := base64.StdEncoding.EncodeToString(learnedCode)
+	assert.Eventually(t, func() bool {
+		_, body := post("/ir/lounge?code=status")
+		return body == `{"version":1,"message":"OK","data":{"last":{"name":"volume_up","code":"`+learned+`"},"codes":2}}`
+	}, time.Second, 10*time.Millisecond)
+
+	code, _ = post("/ir/lounge?code=send&value=volume_up")
+	assert.Equal(t, 200, code)
+	mutex.Lock()
+	assert.Equal(t, []string{learned}, sent)
+	mutex.Unlock()
+
+	// Learned codes are persisted and restored alongside those from config
+	base, _, err := routes(loadConfig(t, "testdata/irConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	assert.Equal(t, map[string]string{"tv_power": "JgAKAAECAwQFBgcI", "volume_up": learned}, base.Devices[0].library)
+}
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	mutex := sync.Mutex{}
+	sent := []string{}
+	commands := []string{}
+	blaster := setupBroadlinkServer(t, &mutex, &sent)
+	defer blaster.Close()
+	tasmota := setupTasmotaServer(t, &mutex, &commands)
+	defer tasmota.Close()
+
+	base, router := setupRouter(t, blaster.LocalAddr().String(), tasmota.URL)
+	ctx, dryRun := device.WithDryRun(context.Background())
+	for _, url := range []string{"/ir/lounge?code=send&value=tv_power", "/ir/bedroom?code=send&value=fan", "/ir/lounge?code=delete&value=tv_power", "/ir/lounge?code=learn&value=volume_up"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil).WithContext(ctx))
+		assert.Equal(t, 200, recorder.Code, url)
+	}
+
+	// Codes are recorded rather than sent, and the library is left alone
+	mutex.Lock()
+	assert.Empty(t, sent)
+	assert.Empty(t, commands)
+	mutex.Unlock()
+	assert.Contains(t, base.Devices[0].library, "tv_power")
+	assert.Empty(t, base.Devices[0].learning)
+
+	calls := dryRun.Calls()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, device.Call{Method: "UDP", URL: "udp://" + blaster.LocalAddr().String(), Payload: map[string]any{"code": "JgAKAAECAwQFBgcI"}}, calls[0])
+		assert.Equal(t, "GET", calls[1].Method)
+		assert.True(t, strings.HasPrefix(calls[1].URL, tasmota.URL+"/cm?cmnd=IRsend"))
+		assert.NotContains(t, calls[1].URL, "tasmota-password")
+	}
+}
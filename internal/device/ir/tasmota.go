@@ -0,0 +1,78 @@
+package ir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// tasmota drives ESP8266 and ESP32 blasters running Tasmota through its HTTP command interface. Codes are the JSON reported in
+// IrReceived messages, e.g. {"Protocol":"NEC","Bits":32,"Data":"0x20DF10EF"}, or raw timings. Tasmota only reports received codes
+// over MQTT so they are imported rather than learned.
+type tasmota struct {
+	URL      string        `yaml:"url"`
+	Username string        `yaml:"username"`
+	Password config.Secret `yaml:"password"`
+	timeout  uint
+}
+
+// send sends a code with the IRsend command.
+func (t *tasmota) send(ctx context.Context, code string) error {
+	client := &http.Client{
+		Timeout: time.Duration(t.timeout) * time.Millisecond,
+	}
+
+	query := url.Values{"cmnd": {"IRsend " + code}}
+	if t.Username != "" {
+		query.Set("user", t.Username)
+		query.Set("password", t.Password.Value())
+	}
+
+	req, err := http.NewRequestWithContext(device.Write(ctx), http.MethodGet, strings.TrimRight(t.URL, "/")+"/cm?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tasmota returned %d", resp.StatusCode)
+	}
+	if device.DryRunning(ctx) {
+		return nil
+	}
+
+	response := map[string]any{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	if response["IRSend"] != "Done" {
+		return fmt.Errorf("tasmota rejected code: %s", strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// validate checks that a code can be sent by the blaster.
+func (t *tasmota) validate(code string) error {
+	if strings.TrimSpace(code) == "" {
+		return errors.New("empty code")
+	}
+	return nil
+}
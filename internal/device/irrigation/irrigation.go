@@ -0,0 +1,373 @@
+// Package irrigation provides timed zone control for OpenSprinkler controllers or zones backed by other restate relays.
+package irrigation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Longest runtime accepted by the run code, matching the OpenSprinkler manual run limit
+const maxRunMinutes = 18 * 60
+
+// driver is implemented by each supported irrigation backend.
+type driver interface {
+	run(ctx context.Context, z *zone, duration time.Duration) error
+	stop(ctx context.Context, z *zone) error
+	stopAll(ctx context.Context) error
+	// remaining returns the runtime left for each zone that is currently running, keyed by zone name
+	remaining(ctx context.Context) (map[string]time.Duration, error)
+	setRainDelay(ctx context.Context, hours int) error
+	rainDelay(ctx context.Context) (time.Time, error)
+}
+
+// zone is a single irrigation zone, identified by station index for OpenSprinkler or on/off actions for relays.
+type zone struct {
+	Name    string         `yaml:"name"`
+	Station int            `yaml:"station"`
+	On      *device.Action `yaml:"on"`
+	Off     *device.Action `yaml:"off"`
+}
+
+// request extends the standard request with the zone being targeted.
+type request struct {
+	Code  string      `json:"code"`
+	Zone  string      `json:"zone,omitempty"`
+	Value json.Number `json:"value,omitempty"`
+}
+
+type zoneStatus struct {
+	Name      string `json:"name"`
+	Running   bool   `json:"running"`
+	Remaining int    `json:"remaining"`
+}
+
+// status is the representation of the controller returned by the status code, durations are in seconds.
+type status struct {
+	Zones          []*zoneStatus `json:"zones"`
+	RainDelay      bool          `json:"rainDelay"`
+	RainDelayUntil string        `json:"rainDelayUntil,omitempty"`
+	RainDelayHours float64       `json:"rainDelayHours"`
+}
+
+// irrigation represents a controller configuration with name, driver and zones.
+type irrigation struct {
+	Name          string         `yaml:"name"`
+	Timeout       uint           `yaml:"timeoutMs"`
+	Driver        string         `yaml:"driver"`
+	OpenSprinkler *openSprinkler `yaml:"opensprinkler"`
+	Zones         []*zone        `yaml:"zones"`
+	Base          base
+	driver        driver
+}
+
+// base represents a list of controllers
+type base struct {
+	Devices []*irrigation
+}
+
+type Device struct{}
+
+// DryRun previews the zone and rain delay changes a request would make, without starting run timers.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for irrigation controllers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// validate checks that zones are uniquely named and carry the parameters required by the driver.
+func (i *irrigation) validate() error {
+	if len(i.Zones) == 0 {
+		return errors.New("no zones configured")
+	}
+
+	names := []string{}
+	for _, z := range i.Zones {
+		if z.Name == "" {
+			return errors.New("zone is missing name")
+		}
+		if slices.Contains(names, z.Name) {
+			return errors.New("duplicate zone \"" + z.Name + "\"")
+		}
+		names = append(names, z.Name)
+
+		if i.Driver == "relay" && (z.On == nil || z.Off == nil || z.On.URL == "" || z.On.Code == "" || z.Off.URL == "" || z.Off.Code == "") {
+			return errors.New("relay zone \"" + z.Name + "\" is missing on or off action")
+		}
+		if i.Driver == "opensprinkler" && z.Station < 0 {
+			return errors.New("zone \"" + z.Name + "\" has an invalid station")
+		}
+	}
+	return nil
+}
+
+// routes extracts OpenSprinkler and relay irrigation controllers from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "irrigation" {
+			continue
+		}
+		irrigation := irrigation{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &irrigation); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if irrigation.Name == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch irrigation.Driver {
+		case "opensprinkler":
+			if irrigation.OpenSprinkler == nil || irrigation.OpenSprinkler.Host == "" || irrigation.OpenSprinkler.Password == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			irrigation.OpenSprinkler.timeout = irrigation.Timeout
+			irrigation.OpenSprinkler.zones = irrigation.Zones
+			irrigation.driver = irrigation.OpenSprinkler
+		case "relay":
+			irrigation.driver = newRelay(irrigation.Name, irrigation.Timeout, irrigation.Zones)
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'opensprinkler' or 'relay'")
+			continue
+		}
+
+		if err := irrigation.validate(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", irrigation.Name, err)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + irrigation.Name,
+			Handler: irrigation.handler,
+		})
+
+		base.Devices = append(base.Devices, &irrigation)
+
+		logging.Log(logging.Info, "Found device \"%s\"", irrigation.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/irrigation" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/irrigation",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/irrigation/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// findZone returns the zone with the given name, or nil if there is none.
+func (i *irrigation) findZone(name string) *zone {
+	for _, z := range i.Zones {
+		if z.Name == name {
+			return z
+		}
+	}
+	return nil
+}
+
+// getZoneNames returns the names of all zones on the controller.
+func (i *irrigation) getZoneNames() []string {
+	var names []string
+	for _, z := range i.Zones {
+		names = append(names, z.Name)
+	}
+	return names
+}
+
+// status reports the remaining runtime of each zone along with any active rain delay.
+func (i *irrigation) status(ctx context.Context, now time.Time) (*status, error) {
+	remaining, err := i.driver.remaining(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rainDelay, err := i.driver.rainDelay(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := status{}
+	for _, z := range i.Zones {
+		status.Zones = append(status.Zones, &zoneStatus{
+			Name:      z.Name,
+			Running:   remaining[z.Name] > 0,
+			Remaining: int(remaining[z.Name].Round(time.Second).Seconds()),
+		})
+	}
+
+	if rainDelay.After(now) {
+		status.RainDelay = true
+		status.RainDelayUntil = rainDelay.Format(time.RFC3339)
+		status.RainDelayHours = math.Round(rainDelay.Sub(now).Hours()*100) / 100
+	}
+
+	return &status, nil
+}
+
+// getCodes returns a list of control codes for an irrigation controller.
+func getCodes() []string {
+	return []string{"run", "stop", "status", "raindelay", "zones"}
+}
+
+// Handler is the HTTP handler for irrigation control.
+func (i *irrigation) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+
+	switch request.Code {
+	case "zones":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", i.getZoneNames())
+		return
+	case "status":
+		status, err := i.status(r.Context(), time.Now())
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", status)
+		return
+	case "run":
+		zone := i.findZone(request.Zone)
+		if zone == nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: zone", nil)
+			return
+		}
+		minutes, valueErr := request.Value.Int64()
+		if valueErr != nil || minutes < 1 || minutes > maxRunMinutes {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		rainDelay, delayErr := i.driver.rainDelay(r.Context())
+		if delayErr != nil {
+			logging.Log(logging.Error, delayErr.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		// Scheduled runs should not water through a rain delay, cancel it with raindelay=0 to force a run
+		if rainDelay.After(time.Now()) {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusConflict, "Rain Delay Active", nil)
+			return
+		}
+		err = i.driver.run(r.Context(), zone, time.Duration(minutes)*time.Minute)
+	case "stop":
+		if request.Zone == "" {
+			err = i.driver.stopAll(r.Context())
+			break
+		}
+		zone := i.findZone(request.Zone)
+		if zone == nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: zone", nil)
+			return
+		}
+		err = i.driver.stop(r.Context(), zone)
+	case "raindelay":
+		hours, valueErr := request.Value.Int64()
+		if valueErr != nil || hours < 0 || hours > 32767 {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = i.driver.setRainDelay(r.Context(), int(hours))
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// getDeviceNames returns the names of all controllers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured controllers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
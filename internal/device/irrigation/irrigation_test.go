@@ -0,0 +1,355 @@
+package irrigation
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read irrigation input")
+	}
+
+	irrigationConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &irrigationConfig); err != nil {
+		t.Fatalf("Could not read irrigation input")
+	}
+	return &irrigationConfig
+}
+
+// setupOpenSprinklerServer emulates an eight station OpenSprinkler controller.
+func setupOpenSprinklerServer(t *testing.T, password string) *httptest.Server {
+	hash := md5.Sum([]byte(password))
+	var mutex sync.Mutex
+	remaining := make([]int64, 8)
+	rainDelayHours := int64(0)
+	deviceTime := int64(1718971200)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		query := r.URL.Query()
+
+		if query.Get("pw") != hex.EncodeToString(hash[:]) {
+			w.Write([]byte(`{"result":2}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/cm":
+			sid, err := strconv.Atoi(query.Get("sid"))
+			if err != nil || sid >= len(remaining) {
+				w.Write([]byte(`{"result":17}`))
+				return
+			}
+			remaining[sid] = 0
+			if query.Get("en") == "1" {
+				remaining[sid], _ = strconv.ParseInt(query.Get("t"), 10, 64)
+			}
+		case "/cv":
+			if query.Get("rsn") == "1" {
+				remaining = make([]int64, 8)
+			}
+			if rd := query.Get("rd"); rd != "" {
+				rainDelayHours, _ = strconv.ParseInt(rd, 10, 64)
+			}
+		case "/jc":
+			ps := [][]int64{}
+			for _, seconds := range remaining {
+				pid := int64(0)
+				if seconds > 0 {
+					pid = 99
+				}
+				ps = append(ps, []int64{pid, seconds, deviceTime})
+			}
+			rd := 0
+			if rainDelayHours > 0 {
+				rd = 1
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"devt": deviceTime,
+				"rd":   rd,
+				"rdst": deviceTime + rainDelayHours*3600,
+				"ps":   ps,
+			})
+			return
+		default:
+			w.Write([]byte(`{"result":19}`))
+			return
+		}
+		w.Write([]byte(`{"result":1}`))
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/irrigationConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/irrigationConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/irrigationConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/irrigationConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/irrigationConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestRelay(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	var mutex sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		received = append(received, request.Code+":"+request.Value.String())
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version":1,"message":"OK"}`))
+	}))
+	defer server.Close()
+
+	z := &zone{
+		Name: "drip",
+		On:   &device.Action{URL: server.URL, Code: "toggle", Value: "1"},
+		Off:  &device.Action{URL: server.URL, Code: "toggle", Value: "0"},
+	}
+	r := newRelay("greenhouse", 1000, []*zone{z})
+
+	ctx := context.Background()
+	assert.NoError(t, r.run(ctx, z, time.Minute))
+	remaining, _ := r.remaining(ctx)
+	assert.Greater(t, remaining["drip"].Seconds(), 59.0)
+
+	assert.NoError(t, r.stopAll(ctx))
+	remaining, _ = r.remaining(ctx)
+	assert.Empty(t, remaining)
+
+	// Dry runs record the on action without starting the off timer
+	dryCtx, dryRun := device.WithDryRun(ctx)
+	assert.NoError(t, r.run(dryCtx, z, time.Minute))
+	remaining, _ = r.remaining(ctx)
+	assert.Empty(t, remaining)
+	assert.Equal(t, []device.Call{{Method: "POST", URL: server.URL, Payload: map[string]any{"code": "toggle", "value": "1"}}}, dryRun.Calls())
+
+	mutex.Lock()
+	assert.Equal(t, []string{"toggle:1", "toggle:0"}, received)
+	mutex.Unlock()
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		data         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/irrigation/garden",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["run","stop","status","raindelay","zones"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/irrigation/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["garden","greenhouse"]}`,
+		},
+		{
+			name:         "zones",
+			method:       "POST",
+			url:          "/irrigation/garden?code=zones",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lawn","beds"]}`,
+		},
+		{
+			name:         "run",
+			method:       "POST",
+			url:          "/irrigation/garden",
+			data:         `{"code":"run","zone":"beds","value":15}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "status_running",
+			method:       "POST",
+			url:          "/irrigation/garden?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"zones":[{"name":"lawn","running":false,"remaining":0},{"name":"beds","running":true,"remaining":900}],"rainDelay":false,"rainDelayHours":0}}`,
+		},
+		{
+			name:         "stop_all",
+			method:       "POST",
+			url:          "/irrigation/garden?code=stop",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "status_stopped",
+			method:       "POST",
+			url:          "/irrigation/garden?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"zones":[{"name":"lawn","running":false,"remaining":0},{"name":"beds","running":false,"remaining":0}],"rainDelay":false,"rainDelayHours":0}}`,
+		},
+		{
+			name:         "raindelay",
+			method:       "POST",
+			url:          "/irrigation/garden?code=raindelay&value=24",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "run_during_raindelay",
+			method:       "POST",
+			url:          "/irrigation/garden?code=run&zone=lawn&value=10",
+			expectedCode: 409,
+			expectedBody: `{"version":1,"message":"Rain Delay Active"}`,
+		},
+		{
+			name:         "cancel_raindelay",
+			method:       "POST",
+			url:          "/irrigation/garden?code=raindelay&value=0",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "run_invalid_zone",
+			method:       "POST",
+			url:          "/irrigation/garden?code=run&zone=patio&value=10",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: zone"}`,
+		},
+		{
+			name:         "run_invalid_value",
+			method:       "POST",
+			url:          "/irrigation/garden?code=run&zone=lawn&value=0",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/irrigation/garden?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/irrigation/garden",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/irrigation/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	server := setupOpenSprinklerServer(t, "opendoor")
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/irrigationConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	base.Devices[0].OpenSprinkler.Host = strings.TrimPrefix(server.URL, "http://")
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
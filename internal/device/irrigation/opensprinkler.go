@@ -0,0 +1,168 @@
+package irrigation
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// openSprinkler drives an OpenSprinkler controller through its HTTP API.
+type openSprinkler struct {
+	Host     string        `yaml:"host"`
+	Password config.Secret `yaml:"password"`
+	timeout  uint
+	zones    []*zone
+}
+
+// Result codes returned by the controller, 1 indicates success
+var openSprinklerResults = map[int]string{
+	2:  "unauthorized",
+	3:  "mismatch",
+	16: "data missing",
+	17: "out of range",
+	18: "data format error",
+	19: "page not found",
+	32: "not permitted",
+}
+
+// openSprinklerVariables represents the fields of interest from the /jc endpoint, times are in controller local seconds.
+type openSprinklerVariables struct {
+	DeviceTime    int64     `json:"devt"`
+	RainDelay     int       `json:"rd"`
+	RainDelayStop int64     `json:"rdst"`
+	ProgramStatus [][]int64 `json:"ps"`
+}
+
+// call sends a GET request to a controller endpoint, authenticating with the md5 hash of the password. The controller acts on GET requests,
+// so calls that change state are made with a context marked by device.Write.
+func (o *openSprinkler) call(ctx context.Context, endpoint string, query url.Values) ([]byte, error) {
+	client := &http.Client{
+		Timeout: time.Duration(o.timeout) * time.Millisecond,
+	}
+
+	hash := md5.Sum([]byte(o.Password.Value()))
+	query.Set("pw", hex.EncodeToString(hash[:]))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s/%s?%s", o.Host, endpoint, query.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("opensprinkler request to %s failed", endpoint)
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("opensprinkler request to %s failed", endpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("opensprinkler returned status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := struct {
+		Result *int `json:"result"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Result != nil && *result.Result != 1 {
+		reason, ok := openSprinklerResults[*result.Result]
+		if !ok {
+			reason = fmt.Sprintf("result %d", *result.Result)
+		}
+		return nil, fmt.Errorf("opensprinkler %s: %s", endpoint, reason)
+	}
+
+	return body, nil
+}
+
+func (o *openSprinkler) run(ctx context.Context, z *zone, duration time.Duration) error {
+	query := url.Values{}
+	query.Set("sid", fmt.Sprint(z.Station))
+	query.Set("en", "1")
+	query.Set("t", fmt.Sprint(int(duration.Seconds())))
+	_, err := o.call(device.Write(ctx), "cm", query)
+	return err
+}
+
+func (o *openSprinkler) stop(ctx context.Context, z *zone) error {
+	query := url.Values{}
+	query.Set("sid", fmt.Sprint(z.Station))
+	query.Set("en", "0")
+	_, err := o.call(device.Write(ctx), "cm", query)
+	return err
+}
+
+func (o *openSprinkler) stopAll(ctx context.Context) error {
+	query := url.Values{}
+	query.Set("rsn", "1")
+	_, err := o.call(device.Write(ctx), "cv", query)
+	return err
+}
+
+func (o *openSprinkler) setRainDelay(ctx context.Context, hours int) error {
+	query := url.Values{}
+	query.Set("rd", fmt.Sprint(hours))
+	_, err := o.call(device.Write(ctx), "cv", query)
+	return err
+}
+
+func (o *openSprinkler) variables(ctx context.Context) (*openSprinklerVariables, error) {
+	body, err := o.call(ctx, "jc", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	variables := openSprinklerVariables{}
+	if err := json.Unmarshal(body, &variables); err != nil {
+		return nil, err
+	}
+	return &variables, nil
+}
+
+func (o *openSprinkler) remaining(ctx context.Context) (map[string]time.Duration, error) {
+	variables, err := o.variables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := map[string]time.Duration{}
+	for _, z := range o.zones {
+		// Each station entry is [program id, remaining seconds, start time, ...]
+		if z.Station >= len(variables.ProgramStatus) || len(variables.ProgramStatus[z.Station]) < 2 {
+			continue
+		}
+		if seconds := variables.ProgramStatus[z.Station][1]; seconds > 0 {
+			remaining[z.Name] = time.Duration(seconds) * time.Second
+		}
+	}
+	return remaining, nil
+}
+
+func (o *openSprinkler) rainDelay(ctx context.Context) (time.Time, error) {
+	variables, err := o.variables(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if variables.RainDelay == 0 || variables.RainDelayStop <= variables.DeviceTime {
+		return time.Time{}, nil
+	}
+
+	// Controller times are local seconds, so only the difference between them is meaningful
+	return time.Now().Add(time.Duration(variables.RainDelayStop-variables.DeviceTime) * time.Second), nil
+}
@@ -0,0 +1,142 @@
+package irrigation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// relay drives zones through on/off actions against other restate devices, with runtimes tracked locally.
+type relay struct {
+	name      string
+	timeout   uint
+	zones     []*zone
+	timers    map[string]*time.Timer
+	ends      map[string]time.Time
+	rainUntil time.Time
+	mutex     sync.Mutex
+}
+
+func newRelay(name string, timeout uint, zones []*zone) *relay {
+	return &relay{
+		name:    name,
+		timeout: timeout,
+		zones:   zones,
+		timers:  map[string]*time.Timer{},
+		ends:    map[string]time.Time{},
+	}
+}
+
+// switchZone posts the on or off action for a zone.
+func (r *relay) switchZone(ctx context.Context, z *zone, on bool) error {
+	action := z.Off
+	if on {
+		action = z.On
+	}
+
+	_, code, err := action.PostContext(ctx, r.timeout)
+	if err != nil {
+		return err
+	} else if code != http.StatusOK {
+		return fmt.Errorf("received status code %d from %s", code, action.URL)
+	}
+	return nil
+}
+
+// clear cancels any pending off timer for a zone, the caller must hold the mutex.
+func (r *relay) clear(z *zone) {
+	if timer, ok := r.timers[z.Name]; ok {
+		timer.Stop()
+		delete(r.timers, z.Name)
+		delete(r.ends, z.Name)
+	}
+}
+
+func (r *relay) run(ctx context.Context, z *zone, duration time.Duration) error {
+	if err := r.switchZone(ctx, z, true); err != nil {
+		return err
+	}
+
+	// Runtimes are tracked locally, so a dry run must not start the off timer
+	if device.DryRunning(ctx) {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.clear(z)
+	r.ends[z.Name] = time.Now().Add(duration)
+	r.timers[z.Name] = time.AfterFunc(duration, func() {
+		r.mutex.Lock()
+		delete(r.timers, z.Name)
+		delete(r.ends, z.Name)
+		r.mutex.Unlock()
+
+		if err := r.switchZone(context.Background(), z, false); err != nil {
+			logging.Log(logging.Error, "Irrigation \"%s\" failed to stop zone \"%s\": %v", r.name, z.Name, err)
+		}
+	})
+	return nil
+}
+
+func (r *relay) stop(ctx context.Context, z *zone) error {
+	if !device.DryRunning(ctx) {
+		r.mutex.Lock()
+		r.clear(z)
+		r.mutex.Unlock()
+	}
+
+	return r.switchZone(ctx, z, false)
+}
+
+func (r *relay) stopAll(ctx context.Context) error {
+	var errs []error
+	for _, z := range r.zones {
+		if err := r.stop(ctx, z); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *relay) remaining(ctx context.Context) (map[string]time.Duration, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	remaining := map[string]time.Duration{}
+	for name, end := range r.ends {
+		if d := time.Until(end); d > 0 {
+			remaining[name] = d
+		}
+	}
+	return remaining, nil
+}
+
+func (r *relay) setRainDelay(ctx context.Context, hours int) error {
+	// Rain delays are tracked locally and make no calls to preview
+	if device.DryRunning(ctx) {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rainUntil = time.Time{}
+	if hours > 0 {
+		r.rainUntil = time.Now().Add(time.Duration(hours) * time.Hour)
+	}
+	return nil
+}
+
+func (r *relay) rainDelay(ctx context.Context) (time.Time, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rainUntil, nil
+}
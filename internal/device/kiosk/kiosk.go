@@ -0,0 +1,276 @@
+// Package kiosk provides projections of other device statuses, returning only the fields a display needs.
+package kiosk
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// source is a named request whose response data is available to fields and templates.
+type source struct {
+	device.Action `yaml:",inline"`
+	Name          string `yaml:"name"`
+}
+
+// kiosk represents a projection configuration with name, sources and either fields or a template.
+type kiosk struct {
+	Name     string            `yaml:"name"`
+	Timeout  uint              `yaml:"timeoutMs"`
+	Sources  []*source         `yaml:"sources"`
+	Fields   map[string]string `yaml:"fields"`
+	Template string            `yaml:"template"`
+	Base     base
+	template *template.Template
+}
+
+// base represents a list of kiosks
+type base struct {
+	Devices []*kiosk
+}
+
+type Device struct{}
+
+// DryRun is always safe, kiosks only read their sources.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for kiosks based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts kiosks from config, compiling the template of those that render one, and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "kiosk" {
+			continue
+		}
+		kiosk := kiosk{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &kiosk); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if kiosk.Name == "" || kiosk.Timeout == 0 || len(kiosk.Sources) == 0 || (len(kiosk.Fields) == 0 && kiosk.Template == "") {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if !kiosk.validSources() {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if kiosk.Template != "" {
+			kiosk.template, err = template.New(kiosk.Name).Option("missingkey=zero").Parse(kiosk.Template)
+			if err != nil {
+				logging.Log(logging.Info, "Unable to load device \"%s\" due to invalid template: %v", kiosk.Name, err)
+				continue
+			}
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + kiosk.Name,
+			Handler: kiosk.handler,
+		})
+
+		base.Devices = append(base.Devices, &kiosk)
+
+		logging.Log(logging.Info, "Found device \"%s\"", kiosk.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/kiosk" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/kiosk",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/kiosk/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// validSources reports whether every source is complete and uniquely named.
+func (k *kiosk) validSources() bool {
+	names := map[string]bool{}
+	for _, s := range k.Sources {
+		if s.Name == "" || s.URL == "" || s.Code == "" || names[s.Name] {
+			return false
+		}
+		names[s.Name] = true
+	}
+	return true
+}
+
+// fetch requests each source and returns their response data keyed by source name, failed sources are left null.
+func (k *kiosk) fetch() map[string]any {
+	data := map[string]any{}
+	for _, s := range k.Sources {
+		response, code, err := s.Post(k.Timeout)
+		if err == nil && code != http.StatusOK {
+			err = fmt.Errorf("received status code %d from %s", code, s.URL)
+		}
+		if err != nil {
+			logging.Log(logging.Error, "Kiosk \"%s\" failed to fetch source \"%s\": %v", k.Name, s.Name, err)
+			data[s.Name] = nil
+			continue
+		}
+		data[s.Name] = response.Data
+	}
+	return data
+}
+
+// lookup resolves a dot separated path through nested objects and arrays, e.g. "printer.supplies.0.percent".
+func lookup(data any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch value := data.(type) {
+		case map[string]any:
+			var ok bool
+			if data, ok = value[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil, false
+			}
+			data = value[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// project builds the configured fields from source data, fields that cannot be resolved are null.
+func (k *kiosk) project(data map[string]any) map[string]any {
+	projection := map[string]any{}
+	for name, path := range k.Fields {
+		value, ok := lookup(data, path)
+		if !ok {
+			logging.Log(logging.Error, "Kiosk \"%s\" could not resolve field \"%s\" from \"%s\"", k.Name, name, path)
+		}
+		projection[name] = value
+	}
+	return projection
+}
+
+// status fetches all sources and returns the rendered template, or the projected fields when no template is configured.
+func (k *kiosk) status() (any, error) {
+	data := k.fetch()
+
+	if k.template == nil {
+		return k.project(data), nil
+	}
+
+	if len(k.Fields) > 0 {
+		data["fields"] = k.project(data)
+	}
+
+	var rendered strings.Builder
+	if err := k.template.Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+	return rendered.String(), nil
+}
+
+// Handler is the HTTP handler for kiosk projections.
+func (k *kiosk) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", []string{"status"})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if request.Code != "status" {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	data, err := k.status()
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all kiosks in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured kiosks.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,49 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLint(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	configBytes := []byte(`apiVersion: v2
+requestTimeotMs: 500
+Diagnostics: true
+devices:
+  - type: meross
+    config:
+      name: lamp
+      hots: 192.0.2.1
+      deviceType: bulb
+      timeoutMs: 200
+      colour: red
+`)
+	c := &config.Config{}
+	if err := yaml.Unmarshal(configBytes, c); err != nil {
+		t.Fatalf("Unmarshal returned an error: %v", err)
+	}
+	common.TakeLints()
+
+	// Problems in device configs are only known once the devices are loaded, and are reported once
+	d := &Devices{}
+	d.Routes(c)
+	assert.ElementsMatch(t, []string{
+		`Unknown key "requestTimeotMs" on line 2, did you mean "requestTimeoutMs"?`,
+		`Unknown key "Diagnostics" on line 3, did you mean "diagnostics"?`,
+		`Unknown key "hots" in config of device "lamp", did you mean "host"?`,
+		`Unknown key "colour" in config of device "lamp"`,
+	}, Lint(configBytes))
+	assert.Equal(t, []string{
+		`Unknown key "requestTimeotMs" on line 2, did you mean "requestTimeoutMs"?`,
+		`Unknown key "Diagnostics" on line 3, did you mean "diagnostics"?`,
+	}, Lint(configBytes))
+
+	assert.Empty(t, Lint([]byte("apiVersion: v2\ndevices: []\n")))
+}
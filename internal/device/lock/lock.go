@@ -0,0 +1,327 @@
+// Package lock provides control of smart door locks with audited lock/unlock requests and admin only unlocking.
+package lock
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/auth"
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Number of audit entries retained per lock
+const auditSize = 50
+
+// driver is implemented by each supported lock backend.
+type driver interface {
+	lock(ctx context.Context) error
+	unlock(ctx context.Context) error
+	status(ctx context.Context) (*status, error)
+}
+
+// status is the representation of a lock returned by the status code.
+type status struct {
+	State           string `json:"state"`
+	Door            string `json:"door,omitempty"`
+	BatteryCritical bool   `json:"batteryCritical"`
+	BatteryCharge   *int   `json:"batteryCharge,omitempty"`
+}
+
+// request extends the standard request with an optional PIN.
+type request struct {
+	Code string `json:"code"`
+	Pin  string `json:"pin,omitempty"`
+}
+
+// auditEntry records a single lock or unlock attempt.
+type auditEntry struct {
+	Time   string `json:"time"`
+	Code   string `json:"code"`
+	Client string `json:"client"`
+	Result string `json:"result"`
+}
+
+// lock represents a lock configuration with name, driver and driver specific parameters.
+type lock struct {
+	Name        string        `yaml:"name"`
+	Timeout     uint          `yaml:"timeoutMs"`
+	Driver      string        `yaml:"driver"`
+	Nuki        *nuki         `yaml:"nuki"`
+	Yale        *yale         `yaml:"yale"`
+	Pin         config.Secret `yaml:"pin"`
+	Audit       *bool         `yaml:"audit"`
+	Base        base
+	adminTokens []config.Secret
+	driver      driver
+	auditLog    []*auditEntry
+	mutex       sync.Mutex
+}
+
+// base represents a list of locks
+type base struct {
+	Devices []*lock
+}
+
+type Device struct{}
+
+// DryRun previews lock actions, which are audited as dry runs rather than as results.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for locks based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Nuki and Yale locks from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "lock" {
+			continue
+		}
+		lock := lock{
+			Base:        base,
+			adminTokens: config.AdminTokens,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &lock); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if lock.Name == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch lock.Driver {
+		case "nuki":
+			if lock.Nuki == nil || lock.Nuki.Host == "" || lock.Nuki.Token == "" || lock.Nuki.NukiID == 0 {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			lock.Nuki.timeout = lock.Timeout
+			lock.driver = lock.Nuki
+		case "yale":
+			if lock.Yale == nil || lock.Yale.ApiKey == "" || lock.Yale.AccessToken == "" || lock.Yale.LockID == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if lock.Yale.URL == "" {
+				lock.Yale.URL = "https://api-production.august.com"
+			}
+			lock.Yale.timeout = lock.Timeout
+			lock.driver = lock.Yale
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'nuki' or 'yale'")
+			continue
+		}
+
+		if len(lock.adminTokens) == 0 {
+			logging.Log(logging.Info, "No adminTokens configured, unlock will be refused for \"%s\"", lock.Name)
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + lock.Name,
+			Handler: lock.handler,
+		})
+
+		base.Devices = append(base.Devices, &lock)
+
+		logging.Log(logging.Info, "Found device \"%s\"", lock.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/lock" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/lock",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/lock/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// auditing reports whether attempts against the lock should be recorded, which is the default.
+func (l *lock) auditing() bool {
+	return l.Audit == nil || *l.Audit
+}
+
+// audit records a lock or unlock attempt in the log and the lock's audit history.
+func (l *lock) audit(r *http.Request, code string, result string) {
+	if !l.auditing() {
+		return
+	}
+
+	client := r.Header.Get("X-Forwarded-For")
+	if client == "" {
+		client = strings.Split(r.RemoteAddr, ":")[0]
+	}
+
+	logging.Log(logging.Info, "Audit: lock \"%s\" code \"%s\" from %s: %s", l.Name, code, client, result)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.auditLog = append([]*auditEntry{{
+		Time:   time.Now().Format(time.RFC3339),
+		Code:   code,
+		Client: client,
+		Result: result,
+	}}, l.auditLog...)
+
+	if len(l.auditLog) > auditSize {
+		l.auditLog = l.auditLog[:auditSize]
+	}
+}
+
+// history returns a copy of the lock's audit entries, newest first.
+func (l *lock) history() []*auditEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]*auditEntry{}, l.auditLog...)
+}
+
+// getCodes returns a list of control codes for a lock.
+func (l *lock) getCodes() []string {
+	codes := []string{"lock", "unlock", "status"}
+	if l.auditing() {
+		codes = append(codes, "audit")
+	}
+	return codes
+}
+
+// Handler is the HTTP handler for lock control.
+func (l *lock) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", l.getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+
+	switch request.Code {
+	case "status":
+		status, err := l.driver.status(r.Context())
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", status)
+		return
+	case "audit":
+		if !l.auditing() {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", l.history())
+		return
+	case "lock":
+		err = l.driver.lock(r.Context())
+	case "unlock":
+		if !auth.IsAdmin(r, l.adminTokens) {
+			l.audit(r, request.Code, "forbidden")
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+		if l.Pin != "" && subtle.ConstantTimeCompare([]byte(request.Pin), []byte(l.Pin.Value())) != 1 {
+			l.audit(r, request.Code, "invalid pin")
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+		err = l.driver.unlock(r.Context())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		l.audit(r, request.Code, "failed")
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	result := "ok"
+	if device.DryRunning(r.Context()) {
+		result = "dry run"
+	}
+	l.audit(r, request.Code, result)
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// getDeviceNames returns the names of all locks in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured locks.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
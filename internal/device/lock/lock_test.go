@@ -0,0 +1,376 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read lock input")
+	}
+
+	lockConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &lockConfig); err != nil {
+		t.Fatalf("Could not read lock input")
+	}
+	return &lockConfig
+}
+
+// setupHTTPServer emulates both a Nuki bridge and the Yale cloud API, tracking a single lock state.
+func setupHTTPServer(t *testing.T) *httptest.Server {
+	locked := true
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		stateName := "unlocked"
+		augState := "kAugLockState_Unlocked"
+		if locked {
+			stateName = "locked"
+			augState = "kAugLockState_Locked"
+		}
+
+		switch {
+		case r.URL.Path == "/lockState" || r.URL.Path == "/lockAction":
+			if r.URL.Query().Get("token") != "bridge-token" || r.URL.Query().Get("nukiId") != "12345" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Path == "/lockAction" {
+				locked = r.URL.Query().Get("action") == "2"
+				w.Write([]byte(`{"success":true,"batteryCritical":false}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"mode":                2,
+				"state":               1,
+				"stateName":           stateName,
+				"batteryCritical":     false,
+				"batteryChargeState":  80,
+				"doorsensorState":     2,
+				"doorsensorStateName": "door closed",
+				"success":             true,
+			})
+		case strings.HasPrefix(r.URL.Path, "/remoteoperate/ABCDEF/"), r.URL.Path == "/locks/ABCDEF/status":
+			if r.Header.Get("x-august-access-token") != "access-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Method == "PUT" {
+				locked = strings.HasSuffix(r.URL.Path, "/lock")
+				augState = "kAugLockState_Unlocked"
+				if locked {
+					augState = "kAugLockState_Locked"
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"status":    augState,
+				"doorState": "kAugDoorState_Closed",
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/lockConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/lockConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/lockConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/lockConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/lockConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		data         string
+		token        string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/lock/front",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lock","unlock","status","audit"]}`,
+		},
+		{
+			name:         "get_device_request_without_audit",
+			method:       "GET",
+			url:          "/lock/back",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lock","unlock","status"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/lock/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["front","back"]}`,
+		},
+		{
+			name:         "nuki_status",
+			method:       "POST",
+			url:          "/lock/front?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"locked","door":"door closed","batteryCritical":false,"batteryCharge":80}}`,
+		},
+		{
+			name:         "nuki_unlock_without_token",
+			method:       "POST",
+			url:          "/lock/front",
+			data:         `{"code":"unlock","pin":"1234"}`,
+			expectedCode: 403,
+			expectedBody: `{"version":1,"message":"Forbidden"}`,
+		},
+		{
+			name:         "nuki_unlock_wrong_token",
+			method:       "POST",
+			url:          "/lock/front",
+			data:         `{"code":"unlock","pin":"1234"}`,
+			token:        "guest-token",
+			expectedCode: 403,
+			expectedBody: `{"version":1,"message":"Forbidden"}`,
+		},
+		{
+			name:         "nuki_unlock_wrong_pin",
+			method:       "POST",
+			url:          "/lock/front",
+			data:         `{"code":"unlock","pin":"0000"}`,
+			token:        "admin-token",
+			expectedCode: 403,
+			expectedBody: `{"version":1,"message":"Forbidden"}`,
+		},
+		{
+			name:         "nuki_unlock",
+			method:       "POST",
+			url:          "/lock/front",
+			data:         `{"code":"unlock","pin":"1234"}`,
+			token:        "admin-token",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "nuki_status_after_unlock",
+			method:       "POST",
+			url:          "/lock/front?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"unlocked","door":"door closed","batteryCritical":false,"batteryCharge":80}}`,
+		},
+		{
+			name:         "yale_lock",
+			method:       "POST",
+			url:          "/lock/back?code=lock",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "yale_status",
+			method:       "POST",
+			url:          "/lock/back?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"locked","door":"closed","batteryCritical":false}}`,
+		},
+		{
+			name:         "yale_audit_disabled",
+			method:       "POST",
+			url:          "/lock/back?code=audit",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/lock/front?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/lock/front",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/lock/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	server := setupHTTPServer(t)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/lockConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	// PINs are redacted when formatted
+	assert.Equal(t, "REDACTED", fmt.Sprint(base.Devices[0].Pin))
+	assert.Equal(t, "1234", base.Devices[0].Pin.Value())
+
+	for _, d := range base.Devices {
+		if d.Nuki != nil {
+			d.Nuki.Host = strings.TrimPrefix(server.URL, "http://")
+		}
+		if d.Yale != nil {
+			d.Yale.URL = server.URL
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			if tc.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+
+	t.Run("audit_records_attempts", func(t *testing.T) {
+		var results []string
+		for _, e := range base.Devices[0].history() {
+			results = append(results, e.Code+":"+e.Result)
+		}
+		assert.Equal(t, []string{"unlock:ok", "unlock:invalid pin", "unlock:forbidden", "unlock:forbidden"}, results)
+		assert.Empty(t, base.Devices[1].history())
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	server := setupHTTPServer(t)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/lockConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	base.Devices[0].Nuki.Host = strings.TrimPrefix(server.URL, "http://")
+	base.Devices[1].Yale.URL = server.URL
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	send := func(ctx context.Context, url string, data string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", url, strings.NewReader(data))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Authorization", "Bearer admin-token")
+		router.ServeHTTP(recorder, request.WithContext(ctx))
+		return recorder
+	}
+
+	// Nuki actions are GET requests, they are recorded with the bridge token redacted rather than sent
+	ctx, dryRun := device.WithDryRun(context.Background())
+	assert.Equal(t, http.StatusOK, send(ctx, "/lock/front", `{"code":"unlock","pin":"1234"}`).Code)
+	assert.Equal(t, []device.Call{{
+		Method: "GET",
+		URL:    server.URL + "/lockAction?action=1&deviceType=0&nukiId=12345&token=REDACTED",
+	}}, dryRun.Calls())
+	assert.Equal(t, "unlock:dry run", base.Devices[0].history()[0].Code+":"+base.Devices[0].history()[0].Result)
+
+	ctx, dryRun = device.WithDryRun(context.Background())
+	assert.Equal(t, http.StatusOK, send(ctx, "/lock/back", `{"code":"unlock"}`).Code)
+	assert.Equal(t, []device.Call{{Method: "PUT", URL: server.URL + "/remoteoperate/ABCDEF/unlock"}}, dryRun.Calls())
+
+	// Status reads are still sent and show that neither lock was unlocked
+	for _, url := range []string{"/lock/front", "/lock/back"} {
+		recorder := send(ctx, url, `{"code":"status"}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"state":"locked"`)
+	}
+	assert.Len(t, dryRun.Calls(), 1)
+}
@@ -0,0 +1,99 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// yale drives a lock through the Yale Access / August cloud API, the access token must be obtained out of band.
+type yale struct {
+	URL         string        `yaml:"url"`
+	ApiKey      config.Secret `yaml:"apiKey"`
+	AccessToken config.Secret `yaml:"accessToken"`
+	LockID      string        `yaml:"lockId"`
+	timeout     uint
+}
+
+// yaleResponse represents the fields of interest from the status and remoteoperate endpoints.
+type yaleResponse struct {
+	Status    string `json:"status"`
+	DoorState string `json:"doorState"`
+}
+
+// call sends a request to the cloud API and decodes the response.
+func (y *yale) call(ctx context.Context, method string, endpoint string) (*yaleResponse, error) {
+	client := &http.Client{
+		Timeout: time.Duration(y.timeout) * time.Millisecond,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", y.URL, endpoint), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept-Version", "0.0.1")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-august-api-key", y.ApiKey.Value())
+	req.Header.Set("x-kease-api-key", y.ApiKey.Value())
+	req.Header.Set("x-august-access-token", y.AccessToken.Value())
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("yale api returned status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := yaleResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// state converts API states such as kAugLockState_Locked into lowercase names such as locked.
+func state(s string) string {
+	if i := strings.LastIndex(s, "_"); i != -1 {
+		s = s[i+1:]
+	}
+	return strings.ToLower(s)
+}
+
+func (y *yale) lock(ctx context.Context) error {
+	_, err := y.call(ctx, "PUT", "remoteoperate/"+y.LockID+"/lock")
+	return err
+}
+
+func (y *yale) unlock(ctx context.Context) error {
+	_, err := y.call(ctx, "PUT", "remoteoperate/"+y.LockID+"/unlock")
+	return err
+}
+
+func (y *yale) status(ctx context.Context) (*status, error) {
+	response, err := y.call(ctx, "GET", "locks/"+y.LockID+"/status")
+	if err != nil {
+		return nil, err
+	}
+
+	return &status{
+		State: state(response.Status),
+		Door:  state(response.DoorState),
+	}, nil
+}
@@ -3,27 +3,29 @@ package meross
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
+	_ "embed"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"slices"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/kennedn/restate-go/internal/common/auth"
 	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/i18n"
 	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
 	"gopkg.in/yaml.v3"
 )
 
@@ -35,10 +37,42 @@ type status struct {
 	Luminance   int64 `json:"luminance,omitempty"`
 }
 
-// namedStatus associates a devices name with its status.
+// namedStatus associates a devices name with its status, stale statuses are the last known state of a device that could not be reached.
 type namedStatus struct {
-	Name   string `json:"name"`
-	Status any    `json:"status"`
+	Name    string     `json:"name"`
+	Status  any        `json:"status"`
+	Stale   bool       `json:"stale,omitempty"`
+	Updated *time.Time `json:"updated,omitempty"`
+	// Set on streamed results for devices that did not respond
+	Error string `json:"error,omitempty"`
+	// Why the device did not respond, listed in the errors of multi-device responses
+	err error
+}
+
+// knownState is the last status read from a device, persisted so that it can stand in while the device is unreachable, e.g. after a restart.
+type knownState struct {
+	Status  status    `json:"status"`
+	Updated time.Time `json:"updated"`
+}
+
+// Known states are rewritten at most this often unless the status changes
+const knownStateInterval = 10 * time.Minute
+
+// groupState is the devices of a group that were on when the group was last toggled off.
+type groupState struct {
+	On      []string  `json:"on"`
+	Updated time.Time `json:"updated"`
+}
+
+// baseRequest extends the standard request with whether toggling a group on restores only the devices that were on when it was
+// toggled off.
+type baseRequest struct {
+	Code    string      `json:"code"`
+	Value   json.Number `json:"value,omitempty"`
+	Hosts   string      `json:"hosts,omitempty"`
+	Restore *bool       `json:"restore,omitempty"`
+	// Values sets a different value for each device, hosts defaults to the devices named
+	Values map[string]json.Number `json:"values,omitempty"`
 }
 
 // rawStatus represents the raw status response from a Meross device.
@@ -63,6 +97,30 @@ type rawStatus struct {
 	} `json:"payload"`
 }
 
+// request extends the standard request with the fields of the admin only raw code and a list of commands to send together.
+type request struct {
+	device.Request
+	Namespace string          `json:"namespace,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty" schema:"-"`
+	Commands  []command       `json:"commands,omitempty" schema:"-"`
+}
+
+// command is a single code and value of a multi-value request.
+type command struct {
+	Code  string      `json:"code"`
+	Value json.Number `json:"value,omitempty"`
+}
+
+// call is a SET of a namespace built from one or more commands.
+type call struct {
+	namespace string
+	payload   map[string]any
+}
+
+// Codes that read state or carry out more than a single SET, which cannot be sent as commands
+var singleCodes = []string{"status", "info", "reboot", "fade", "raw"}
+
 // endpoint describes a Meross device control endpoint with code, supported devices, and other properties.
 type endpoint struct {
 	Code             string   `yaml:"code"`
@@ -71,27 +129,140 @@ type endpoint struct {
 	MaxValue         int64    `yaml:"maxValue,omitempty"`
 	Namespace        string   `yaml:"namespace"`
 	Template         string   `yaml:"template"`
+	compiled         template
 }
 
 // meross represents a Meross device configuration with name, host, device type, timeout, and base configuration.
 type meross struct {
-	Name       string `yaml:"name"`
-	Host       string `yaml:"host"`
-	DeviceType string `yaml:"deviceType"`
-	Timeout    uint   `yaml:"timeoutMs"`
-	Key        string `yaml:"key,omitempty"`
-	Base       base
+	Name       string        `yaml:"name"`
+	Host       string        `yaml:"host"`
+	DeviceType string        `yaml:"deviceType"`
+	Timeout    uint          `yaml:"timeoutMs"`
+	Key        config.Secret `yaml:"key,omitempty"`
+	// Vote is the strategy of group toggles led by this device
+	Vote string `yaml:"vote,omitempty"`
+	// ExtraEndpoints extends the manifest with device specific codes, always sent with the SET method
+	ExtraEndpoints []*endpoint `yaml:"extraEndpoints,omitempty"`
+	Base           base
+	adminTokens    []config.Secret
+	client         *http.Client
 }
 
 // base represents a list of Meross devices, endpoints and common configuration
 type base struct {
-	BaseTemplate string      `yaml:"baseTemplate"`
-	Endpoints    []*endpoint `yaml:"endpoints"`
-	Devices      []*meross
+	Endpoints []*endpoint `yaml:"endpoints"`
+	Devices   []*meross
+}
+
+// Light capacities are flags of the fields present in a light payload
+const (
+	capacityRGB         = 1
+	capacityTemperature = 2
+	capacityLuminance   = 4
+)
+
+type toggleXPayload struct {
+	ToggleX toggleX `json:"togglex"`
 }
 
+type toggleX struct {
+	Channel int64 `json:"channel"`
+	Onoff   int64 `json:"onoff"`
+}
+
+type lightPayload struct {
+	Light light `json:"light"`
+}
+
+type light struct {
+	Capacity    int64  `json:"capacity"`
+	RGB         *int64 `json:"rgb,omitempty"`
+	Temperature *int64 `json:"temperature,omitempty"`
+	Luminance   *int64 `json:"luminance,omitempty"`
+}
+
+// typedPayload builds the payload of a manifest code from its value.
+type typedPayload struct {
+	// Set when the code cannot be sent without a value
+	value bool
+	build func(value int64) any
+}
+
+func emptyPayload(int64) any {
+	return struct{}{}
+}
+
+// typedPayloads are the payloads of the codes in the manifest, marshalled rather than formatted so that they are always valid JSON
+var typedPayloads = map[string]typedPayload{
+	"status": {build: emptyPayload},
+	"info":   {build: emptyPayload},
+	"reboot": {build: emptyPayload},
+	"toggle": {value: true, build: func(v int64) any {
+		return toggleXPayload{ToggleX: toggleX{Onoff: v}}
+	}},
+	"luminance": {value: true, build: func(v int64) any {
+		return lightPayload{Light: light{Capacity: capacityLuminance, Luminance: &v}}
+	}},
+	"temperature": {value: true, build: func(v int64) any {
+		return lightPayload{Light: light{Capacity: capacityTemperature, Temperature: &v}}
+	}},
+	"rgb": {value: true, build: func(v int64) any {
+		return lightPayload{Light: light{Capacity: capacityRGB, RGB: &v}}
+	}},
+	// Fades to the given luminance from the warmest temperature
+	"fade": {value: true, build: func(v int64) any {
+		temperature := int64(1)
+		return lightPayload{Light: light{Capacity: capacityTemperature, Temperature: &temperature, Luminance: &v}}
+	}},
+}
+
+// template is a JSON template split around its %s verbs, so that payloads are built by appending values rather than formatting them.
+type template []string
+
+func compileTemplate(t string) template {
+	return strings.Split(t, "%s")
+}
+
+// append appends the template to dst with its verbs replaced by values in order.
+func (t template) append(dst []byte, values ...string) []byte {
+	for i, part := range t {
+		dst = append(dst, part...)
+		if i < len(t)-1 && i < len(values) {
+			dst = append(dst, values[i]...)
+		}
+	}
+	return dst
+}
+
+// size returns the length of the template with its verbs replaced by values.
+func (t template) size(values ...string) int {
+	n := 0
+	for i, part := range t {
+		n += len(part)
+		if i < len(t)-1 && i < len(values) {
+			n += len(values[i])
+		}
+	}
+	return n
+}
+
+// fill returns the template with its verbs replaced by values.
+func (t template) fill(values ...string) string {
+	return string(t.append(make([]byte, 0, t.size(values...)), values...))
+}
+
+// manifest holds the endpoints supported by the device, embedded so that it does not depend on the working directory
+//
+//go:embed device.yaml
+var manifest []byte
+
 type Device struct{}
 
+// DryRun previews the SET messages a request would send, toggles still read state and groups keep what they remembered.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 // Routes generates routes for Meross device control based on a provided configuration.
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config, "")
@@ -108,28 +279,39 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 	routes := []router.Route{}
 	base := base{}
 
+	// Fall back to the embedded manifest unless a custom one is provided
 	if internalConfigPath == "" {
-		internalConfigPath = "./internal/device/meross/device.yaml"
+		internalConfigPath = os.Getenv("RESTATE_MEROSS_MANIFEST")
 	}
 
-	internalConfigFile, err := os.ReadFile(internalConfigPath)
-	if err != nil {
-		return nil, []router.Route{}, err
+	internalConfigFile := manifest
+	if internalConfigPath != "" {
+		var err error
+		if internalConfigFile, err = os.ReadFile(internalConfigPath); err != nil {
+			return nil, []router.Route{}, err
+		}
 	}
 
 	if err := yaml.Unmarshal(internalConfigFile, &base); err != nil {
 		return nil, []router.Route{}, err
 	}
-	if len(base.Endpoints) == 0 || base.BaseTemplate == "" {
+	if len(base.Endpoints) == 0 {
 		return nil, []router.Route{}, fmt.Errorf("unable to load internalConfigPath \"%s\"", internalConfigPath)
 	}
+	for _, e := range base.Endpoints {
+		if _, ok := typedPayloads[e.Code]; !ok && e.Template == "" {
+			return nil, []router.Route{}, fmt.Errorf("endpoint \"%s\" in internalConfigPath \"%s\" has no template", e.Code, internalConfigPath)
+		}
+		e.compiled = compileTemplate(e.Template)
+	}
 
 	for _, d := range config.Devices {
 		if d.Type != "meross" {
 			continue
 		}
 		meross := meross{
-			Base: base,
+			Base:        base,
+			adminTokens: config.AdminTokens,
 		}
 
 		yamlConfig, err := yaml.Marshal(d.Config)
@@ -138,7 +320,7 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &meross); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &meross); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -148,6 +330,20 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 			continue
 		}
 
+		if !device.ValidVote(meross.Vote) {
+			logging.Log(logging.Info, "Unable to load device due to invalid vote \"%s\"", meross.Vote)
+			continue
+		}
+
+		meross.client = &http.Client{
+			Timeout: time.Duration(meross.Timeout) * time.Millisecond,
+		}
+
+		if err := meross.mergeExtraEndpoints(); err != nil {
+			logging.Log(logging.Info, "Unable to load device due to invalid extra endpoints: %v", err)
+			continue
+		}
+
 		routes = append(routes, router.Route{
 			Path:    "/" + meross.Name,
 			Handler: meross.handler,
@@ -160,7 +356,7 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 
 	if len(routes) == 0 {
 		return nil, []router.Route{}, errors.New("no routes found in config")
-	} else if len(routes) == 1 {
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
 		return &base, routes, nil
 	}
 
@@ -171,19 +367,45 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 	routes = append(routes, router.Route{
 		Path:    "/meross",
 		Handler: base.handler,
+		Streams: true,
 	})
 
 	routes = append(routes, router.Route{
 		Path:    "/meross/",
 		Handler: base.handler,
+		Streams: true,
 	})
 	return &base, routes, nil
 }
 
+// mergeExtraEndpoints validates the extra endpoints of a device and marks them as supported by its device type.
+// Extra endpoints may not replace a code already provided by the manifest.
+func (m *meross) mergeExtraEndpoints() error {
+	for i, e := range m.ExtraEndpoints {
+		if e == nil || e.Code == "" || e.Namespace == "" || e.Template == "" {
+			return fmt.Errorf("extra endpoint %d is missing a code, namespace or template", i)
+		}
+		if e.MinValue > e.MaxValue {
+			return fmt.Errorf("extra endpoint \"%s\" has a minValue greater than its maxValue", e.Code)
+		}
+		if m.getEndpoint(e.Code) != nil {
+			return fmt.Errorf("extra endpoint \"%s\" is already defined", e.Code)
+		}
+		e.SupportedDevices = []string{m.DeviceType}
+		e.compiled = compileTemplate(e.Template)
+	}
+	return nil
+}
+
+// endpoints returns the manifest endpoints followed by any extra endpoints configured for the device.
+func (m *meross) endpoints() []*endpoint {
+	return append(slices.Clip(m.Base.Endpoints), m.ExtraEndpoints...)
+}
+
 // getCodes returns a list of control codes for a Meross device.
 func (m *meross) getCodes() []string {
 	var codes []string
-	for _, e := range m.Base.Endpoints {
+	for _, e := range m.endpoints() {
 		codes = append(codes, e.Code)
 	}
 	return codes
@@ -191,7 +413,7 @@ func (m *meross) getCodes() []string {
 
 // getEndpoint retrieves an endpoint configuration by its code.
 func (m *meross) getEndpoint(code string) *endpoint {
-	for _, e := range m.Base.Endpoints {
+	for _, e := range m.endpoints() {
 		if code == e.Code && slices.Contains(e.SupportedDevices, m.DeviceType) {
 			return e
 		}
@@ -199,69 +421,97 @@ func (m *meross) getEndpoint(code string) *endpoint {
 	return nil
 }
 
-func randomHex(n int) string {
-	bytes := make([]byte, n)
-	if _, err := rand.Read(bytes); err != nil {
-		return ""
-	}
-	return hex.EncodeToString(bytes)
+// sign returns a new messageId and the signature of a message sent with it. The signature is the MD5 of the messageId, key and a
+// timestamp of 0, built on the stack as it is computed for every request.
+func (m *meross) sign() (string, string) {
+	// Newer firmware (6.2.5) requires a unique nonce for messageId
+	var nonce [16]byte
+	var messageId [32]byte
+	rand.Read(nonce[:])
+	hex.Encode(messageId[:], nonce[:])
+
+	var signed [64]byte
+	sum := md5.Sum(append(append(append(signed[:0], messageId[:]...), m.Key.Value()...), '0'))
+	var sign [32]byte
+	hex.Encode(sign[:], sum[:])
+
+	return string(messageId[:]), string(sign[:])
 }
 
-func md5SumString(s string) string {
-	// Calculate the MD5 hash
-	hasher := md5.New()
-	hasher.Write([]byte(s))
-	hashBytes := hasher.Sum(nil)
+// send signs a payload for a namespace and sends it to a Meross device, returning the status code and body of the response.
+func (m *meross) send(ctx context.Context, method string, namespace string, payload json.RawMessage) (int, []byte, error) {
+	messageId, sign := m.sign()
 
-	// Convert the hash bytes to a hexadecimal string
-	return hex.EncodeToString(hashBytes)
+	jsonPayload, err := device.MerossMessage(messageId, method, namespace, sign, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Reads are sent as POSTs too, mark them so that they still happen during a dry run
+	if method == "GET" {
+		ctx = device.Read(ctx)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+m.Host+"/config", bytes.NewReader(jsonPayload))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Send the request and get the response
+	resp, err := device.Do(m.client, req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
 
+	// Size the body up front where possible, rather than growing it while reading
+	body := bytes.NewBuffer(make([]byte, 0, max(resp.ContentLength+1, bytes.MinRead)))
+	_, err = body.ReadFrom(resp.Body)
+	return resp.StatusCode, body.Bytes(), err
 }
 
-// post constructs and sends a POST request to a Meross device and will return a flattened status when the method is equal to GET.
-func (m *meross) post(method string, endpoint endpoint, value json.Number) (*status, error) {
-	client := &http.Client{
-		Timeout: time.Duration(m.Timeout) * time.Millisecond,
+// info retrieves hardware and firmware details from Appliance.System.All along with uptime and signal strength where the firmware reports them.
+func (m *meross) info(ctx context.Context, endpoint endpoint) (*device.MerossInfo, error) {
+	payload, err := endpoint.payload("")
+	if err != nil {
+		return nil, err
 	}
-	var payload string
 
-	if value != "" {
-		payload = fmt.Sprintf(endpoint.Template, value.String())
-	} else {
-		payload = endpoint.Template
+	statusCode, all, err := m.send(ctx, "GET", endpoint.Namespace, payload)
+	if err == nil && statusCode != http.StatusOK {
+		err = fmt.Errorf("received status code %d from %s", statusCode, m.Host)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Newer firmware (6.2.5) requires a unique nonce for messageId
-	messageId := randomHex(16)
-	sign := md5SumString(fmt.Sprintf("%s%s%d", messageId, m.Key, 0))
+	_, debug, err := m.send(ctx, "GET", device.MerossDebugNamespace, json.RawMessage("{}"))
+	if err != nil {
+		logging.Log(logging.Info, "Unable to retrieve debug information from \"%s\": %v", m.Name, err)
+	}
 
-	jsonPayload := []byte(fmt.Sprintf(m.Base.BaseTemplate, messageId, method, endpoint.Namespace, sign, payload))
+	return device.ParseMerossInfo(all, debug)
+}
 
-	req, err := http.NewRequest("POST", "http://"+m.Host+"/config", bytes.NewReader(jsonPayload))
+// post constructs and sends a POST request to a Meross device and will return a flattened status when the method is equal to GET.
+func (m *meross) post(ctx context.Context, method string, endpoint endpoint, value json.Number) (*status, error) {
+	payload, err := endpoint.payload(value)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	// Send the request and get the response
-	resp, err := client.Do(req)
+
+	statusCode, body, err := m.send(ctx, method, endpoint.Namespace, payload)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, err
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d from %s", statusCode, m.Host)
 	}
 
 	if method == "SET" {
 		return nil, nil
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
 	rawResponse := rawStatus{}
 
 	if err := json.Unmarshal(body, &rawResponse); err != nil {
@@ -278,10 +528,90 @@ func (m *meross) post(method string, endpoint endpoint, value json.Number) (*sta
 		Temperature: rawResponse.Payload.All.Digest.Light.Temperature,
 		Luminance:   rawResponse.Payload.All.Digest.Light.Luminance,
 	}
+	m.remember(response, time.Now())
 
 	return &response, err
 }
 
+// remember persists a status read from the device.
+func (m *meross) remember(s status, now time.Time) {
+	if !storage.Enabled() {
+		return
+	}
+	known := knownState{}
+	if storage.Load("meross/"+m.Name, &known) && known.Status == s && now.Sub(known.Updated) < knownStateInterval {
+		return
+	}
+	if err := storage.Save("meross/"+m.Name, knownState{Status: s, Updated: now}); err != nil {
+		logging.Log(logging.Error, "Unable to save state of \"%s\": %v", m.Name, err)
+	}
+}
+
+// known returns the last status read from the device as a stale status, or nil if there is none.
+func (m *meross) known() *namedStatus {
+	known := knownState{}
+	if !storage.Load("meross/"+m.Name, &known) {
+		return nil
+	}
+	return &namedStatus{
+		Name:    m.Name,
+		Status:  &known.Status,
+		Stale:   true,
+		Updated: &known.Updated,
+	}
+}
+
+// groupKey returns the storage key of a group of hosts, regardless of their order.
+func groupKey(hosts []string) string {
+	sorted := slices.Clone(hosts)
+	slices.Sort(sorted)
+	return "meross/groups/" + strings.Join(slices.Compact(sorted), ",")
+}
+
+// rememberGroup persists which devices of a group are on as it is toggled off.
+func rememberGroup(key string, devices []*meross, states map[string]bool, now time.Time) {
+	on := []string{}
+	for _, m := range devices {
+		if states[m.Name] {
+			on = append(on, m.Name)
+		}
+	}
+
+	// Toggling an already off group keeps the devices remembered when it was last on
+	if len(on) == 0 {
+		return
+	}
+	if err := storage.Save(key, groupState{On: on, Updated: now}); err != nil {
+		logging.Log(logging.Error, "Unable to save state of group \"%s\": %v", key, err)
+	}
+}
+
+// restoreGroup returns the devices of a group to toggle on, those that were on when it was last toggled off or all of them when
+// none are remembered or restore is false. The remembered devices are forgotten either way, as the group is on again.
+func restoreGroup(key string, devices []*meross, restore bool) []*meross {
+	group := groupState{}
+	if !storage.Load(key, &group) || len(group.On) == 0 {
+		return devices
+	}
+	if err := storage.Save(key, groupState{}); err != nil {
+		logging.Log(logging.Error, "Unable to save state of group \"%s\": %v", key, err)
+	}
+	if !restore {
+		return devices
+	}
+
+	restored := []*meross{}
+	for _, m := range devices {
+		if slices.Contains(group.On, m.Name) {
+			restored = append(restored, m)
+		}
+	}
+	if len(restored) == 0 {
+		return devices
+	}
+	return restored
+}
+
 // Handler is the HTTP handler for Meross device control.
 func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 	var jsonResponse []byte
@@ -303,18 +633,21 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	request := device.Request{}
+	request := request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if len(request.Commands) > 0 {
+		httpCode, jsonResponse = m.commands(r.Context(), request.Commands)
+		return
+	}
+
+	if request.Code == "raw" {
+		httpCode, jsonResponse = m.raw(r, &request)
+		return
 	}
 
 	endpoint := m.getEndpoint(request.Code)
@@ -323,19 +656,14 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if request.Value != "" && endpoint.MaxValue != 0 {
-		valueInt64, err := request.Value.Int64()
-		if err != nil || valueInt64 > endpoint.MaxValue || valueInt64 < endpoint.MinValue || valueInt64 < 0 {
-			errorMessage := fmt.Sprintf("Invalid Parameter: value (Min: %d, Max: %d)", endpoint.MinValue, endpoint.MaxValue)
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, errorMessage, nil)
-			return
-		}
-
+	if errorMessage := endpoint.invalidValue(request.Value); errorMessage != "" {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, errorMessage, nil)
+		return
 	}
 
 	switch endpoint.Code {
 	case "status":
-		status, err = m.post("GET", *m.getEndpoint("status"), "")
+		status, err = m.post(r.Context(), "GET", *m.getEndpoint("status"), "")
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -346,7 +674,7 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	case "toggle":
 		if request.Value == "" {
-			status, err = m.post("GET", *m.getEndpoint("status"), "")
+			status, err = m.post(r.Context(), "GET", *m.getEndpoint("status"), "")
 			if err != nil {
 				logging.Log(logging.Error, err.Error())
 				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -356,21 +684,40 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 			request.Value = toJsonNumber(1 - status.Onoff)
 		}
 
-		_, err = m.post("SET", *endpoint, request.Value)
+		_, err = m.post(r.Context(), "SET", *endpoint, request.Value)
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+
+	case "info":
+		info, err := m.info(r.Context(), *endpoint)
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
 		}
 
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", info)
+		return
+	case "reboot":
+		_, err = m.post(r.Context(), "SET", *endpoint, "")
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		logging.Log(logging.Info, "Rebooting \"%s\"", m.Name)
+
 	case "fade":
-		_, err = m.post("SET", *m.getEndpoint("toggle"), toJsonNumber(0))
+		_, err = m.post(r.Context(), "SET", *m.getEndpoint("toggle"), toJsonNumber(0))
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
 		}
-		_, err = m.post("SET", *endpoint, toJsonNumber(-1))
+		_, err = m.post(r.Context(), "SET", *endpoint, toJsonNumber(-1))
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -378,11 +725,11 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		}
 
 	default:
-		if request.Value == "" {
+		if request.Value == "" && endpoint.needsValue() {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
 			return
 		}
-		_, err = m.post("SET", *endpoint, request.Value)
+		_, err = m.post(r.Context(), "SET", *endpoint, request.Value)
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -393,6 +740,192 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
 }
 
+// needsValue reports whether the endpoint cannot be sent without a value.
+func (e *endpoint) needsValue() bool {
+	if e.Template != "" {
+		return strings.Contains(e.Template, "%s")
+	}
+	return typedPayloads[e.Code].value
+}
+
+// payload returns the payload of a request to the endpoint. Endpoints with a template, such as extra endpoints, have the value written
+// into it, the payloads of other codes are built from their typed payload.
+func (e *endpoint) payload(value json.Number) (json.RawMessage, error) {
+	if e.Template != "" {
+		if value == "" {
+			return json.RawMessage(e.Template), nil
+		}
+		// Values are checked to be numbers, but the template itself may still not be valid JSON
+		payload := json.RawMessage(e.compiled.fill(value.String()))
+		if !json.Valid(payload) {
+			return nil, fmt.Errorf("template for code \"%s\" is not valid JSON with value %s", e.Code, value)
+		}
+		return payload, nil
+	}
+
+	typed, ok := typedPayloads[e.Code]
+	if !ok {
+		return nil, fmt.Errorf("no payload for code \"%s\"", e.Code)
+	}
+	var v int64
+	if value != "" {
+		var err error
+		if v, err = value.Int64(); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(typed.build(v))
+}
+
+// invalidValue returns an error message when a value is not a number, or is outside of the endpoint's range.
+func (e *endpoint) invalidValue(value json.Number) string {
+	if value == "" {
+		return ""
+	}
+	// Typed payloads take integers, templates have the value written into them verbatim so it must at least be a JSON number
+	if _, err := value.Int64(); err != nil {
+		if _, err := value.Float64(); err != nil || e.Template == "" || !json.Valid([]byte(value)) {
+			return "Invalid Parameter: value"
+		}
+	}
+	if e.MaxValue == 0 {
+		return ""
+	}
+	valueInt64, err := value.Int64()
+	if err != nil || valueInt64 > e.MaxValue || valueInt64 < e.MinValue || valueInt64 < 0 {
+		return fmt.Sprintf("Invalid Parameter: value (Min: %d, Max: %d)", e.MinValue, e.MaxValue)
+	}
+	return ""
+}
+
+// mergePayload merges src into dst, Meross capacity fields are bit masks of the properties present so they are combined rather than replaced.
+func mergePayload(dst map[string]any, src map[string]any) {
+	for k, v := range src {
+		existing, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		existingMap, existingOk := existing.(map[string]any)
+		vMap, vOk := v.(map[string]any)
+		if existingOk && vOk {
+			mergePayload(existingMap, vMap)
+			continue
+		}
+
+		existingNumber, existingOk := existing.(json.Number)
+		vNumber, vOk := v.(json.Number)
+		if k == "capacity" && existingOk && vOk {
+			a, errA := existingNumber.Int64()
+			b, errB := vNumber.Int64()
+			if errA == nil && errB == nil {
+				dst[k] = json.Number(fmt.Sprint(a | b))
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// commands validates every command before sending any of them, then sends them in order. Consecutive commands sharing a namespace
+// are merged into a single call so that e.g. rgb and luminance change together without a visible intermediate state.
+func (m *meross) commands(ctx context.Context, commands []command) (int, []byte) {
+	calls := []*call{}
+	for _, c := range commands {
+		endpoint := m.getEndpoint(c.Code)
+		if endpoint == nil || slices.Contains(singleCodes, c.Code) {
+			return device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		}
+
+		if c.Value == "" && endpoint.needsValue() {
+			return device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+		}
+
+		if errorMessage := endpoint.invalidValue(c.Value); errorMessage != "" {
+			return device.SetJSONResponse(http.StatusBadRequest, errorMessage, nil)
+		}
+
+		encoded, err := endpoint.payload(c.Value)
+		if err != nil {
+			logging.Log(logging.Error, "Unable to build payload for code \"%s\": %v", c.Code, err)
+			return device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		}
+
+		payload := map[string]any{}
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.UseNumber()
+		if err := decoder.Decode(&payload); err != nil {
+			logging.Log(logging.Error, "Invalid template for code \"%s\": %v", c.Code, err)
+			return device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		}
+
+		if len(calls) > 0 && calls[len(calls)-1].namespace == endpoint.Namespace {
+			mergePayload(calls[len(calls)-1].payload, payload)
+			continue
+		}
+		calls = append(calls, &call{namespace: endpoint.Namespace, payload: payload})
+	}
+
+	for _, c := range calls {
+		payload, err := json.Marshal(c.payload)
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			return device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		}
+
+		statusCode, _, err := m.send(ctx, "SET", c.namespace, payload)
+		if err == nil && statusCode != http.StatusOK {
+			err = fmt.Errorf("received status code %d from %s", statusCode, m.Host)
+		}
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			return device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		}
+	}
+
+	return device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// raw forwards an arbitrary namespace and payload to the device on behalf of an admin, returning the unmodified response for debugging new firmware features.
+func (m *meross) raw(r *http.Request, request *request) (int, []byte) {
+	if !auth.IsAdmin(r, m.adminTokens) {
+		return device.SetJSONResponse(http.StatusForbidden, "Forbidden", nil)
+	}
+
+	if request.Namespace == "" {
+		return device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: namespace", nil)
+	}
+
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "GET"
+	}
+	if method != "GET" && method != "SET" {
+		return device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: method", nil)
+	}
+
+	payload := json.RawMessage("{}")
+	if len(request.Payload) != 0 {
+		payload = request.Payload
+	}
+
+	statusCode, body, err := m.send(r.Context(), method, request.Namespace, payload)
+	if err == nil && statusCode != http.StatusOK {
+		err = fmt.Errorf("received status code %d from %s", statusCode, m.Host)
+	}
+	if err == nil && !json.Valid(body) {
+		err = fmt.Errorf("received invalid JSON from %s", m.Host)
+	}
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		return device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+	}
+
+	logging.Log(logging.Info, "Raw %s of namespace \"%s\" sent to \"%s\"", method, request.Namespace, m.Name)
+	return device.SetJSONResponse(http.StatusOK, "OK", json.RawMessage(body))
+}
+
 // getDeviceNames returns the names of all Meross devices in the base configuration.
 func (b *base) getDeviceNames() []string {
 	var names []string
@@ -412,22 +945,31 @@ func (b *base) getDevice(name string) *meross {
 	return nil
 }
 
-// multiPost performs multiple POST requests to control multiple Meross devices in parallel and returns their statuses.
-func (b *base) multiPost(devices []*meross, method string, endpoint string, value json.Number) chan *namedStatus {
-	wg := sync.WaitGroup{}
+// multiPost performs multiple POST requests to control multiple Meross devices in parallel, or in sequence when the request asked for
+// one, and returns their statuses.
+func (b *base) multiPost(ctx context.Context, devices []*meross, method string, endpoint string, value json.Number) chan *namedStatus {
+	return b.multiPostValues(ctx, devices, method, endpoint, value, nil)
+}
+
+// multiPostValues is multiPost with the value of each device named in values replaced by its own.
+func (b *base) multiPostValues(ctx context.Context, devices []*meross, method string, endpoint string, value json.Number, values map[string]json.Number) chan *namedStatus {
 	responses := make(chan *namedStatus, len(devices))
 
-	for _, m := range devices {
-		wg.Add(1)
-		go func(m *meross, method string, endpoint string, value json.Number) {
-			defer wg.Done()
+	go func() {
+		device.Each(ctx, len(devices), method == "SET", func(i int) {
+			m := devices[i]
+			value := value
+			if v, ok := values[m.Name]; ok {
+				value = v
+			}
 			response := namedStatus{
 				Name:   m.Name,
 				Status: nil,
 			}
 
-			status, err := m.post(method, *m.getEndpoint(endpoint), value)
+			status, err := m.post(ctx, method, *m.getEndpoint(endpoint), value)
 			if err != nil {
+				response.err = err
 				responses <- &response
 				return
 			}
@@ -437,23 +979,77 @@ func (b *base) multiPost(devices []*meross, method string, endpoint string, valu
 				response.Status = status
 			}
 			responses <- &response
-		}(m, method, endpoint, value)
-	}
-
-	go func() {
-		wg.Wait()
+		})
 		close(responses)
 	}()
 
 	return responses
 }
 
+// collect returns the devices that responded to a multi-device request and the failures of those that did not. When streaming, devices
+// that did not respond are written as they arrive, as are those that did when the request is the last of an operation.
+func (b *base) collect(writer *device.NDJSONWriter, responses chan *namedStatus, last bool) ([]*meross, []device.Failure) {
+	devices := []*meross{}
+	failures := []device.Failure{}
+	for r := range responses {
+		if r.Status == nil {
+			failures = append(failures, device.NewFailure(r.Name, r.err))
+			if writer != nil {
+				r.Error = i18n.T("Internal Server Error")
+				writer.Write(r)
+			}
+			continue
+		}
+		if writer != nil && last {
+			writer.Write(r)
+		}
+		devices = append(devices, b.getDevice(r.Name))
+	}
+	return devices, failures
+}
+
+// states reads whether each device is on. Unreachable devices stand in with their last known state, those without one are returned
+// as failures.
+func (b *base) states(ctx context.Context, devices []*meross) (map[string]bool, []device.Failure, error) {
+	states := map[string]bool{}
+	failures := []device.Failure{}
+
+	for r := range b.multiPost(ctx, devices, "GET", "status", "") {
+		if r.Status == nil {
+			if known := b.getDevice(r.Name).known(); known != nil {
+				r = known
+			} else {
+				failures = append(failures, device.NewFailure(r.Name, r.err))
+				continue
+			}
+		}
+
+		var status *status
+		yamlConfig, err := yaml.Marshal(r.Status)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := yaml.Unmarshal(yamlConfig, &status); err != nil {
+			return nil, nil, err
+		}
+
+		states[r.Name] = status.Onoff == 1
+	}
+	return states, failures, nil
+}
+
 // Handler is the HTTP handler for handling requests to control multiple Meross devices.
 func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 	var jsonResponse []byte
 	var httpCode int
 
-	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+	// Streamed responses are written as each device completes
+	defer func() {
+		if httpCode != 0 {
+			device.JSONResponse(w, httpCode, jsonResponse)
+		}
+	}()
 
 	if r.Method == http.MethodGet {
 		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
@@ -465,18 +1061,20 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	request := device.Request{}
+	request := baseRequest{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if request.Hosts == "" && len(request.Values) > 0 {
+		names := []string{}
+		for name := range request.Values {
+			names = append(names, name)
 		}
+		sort.Strings(names)
+		request.Hosts = strings.Join(names, ",")
 	}
 
 	if request.Hosts == "" {
@@ -496,6 +1094,11 @@ DUPLICATE_DEVICE:
 			return
 		}
 
+		// Devices taken out of rotation are excluded from groups
+		if !device.Enabled(m.Name) {
+			continue
+		}
+
 		endpoint = m.getEndpoint(request.Code)
 		if endpoint == nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter for device '%s': code", m.Name), nil)
@@ -511,28 +1114,81 @@ DUPLICATE_DEVICE:
 		devices = append(devices, m)
 	}
 
-	if request.Value != "" && endpoint.MaxValue != 0 {
-		valueInt64, err := request.Value.Int64()
-		if err != nil || valueInt64 > endpoint.MaxValue || valueInt64 < endpoint.MinValue || valueInt64 < 0 {
-			errorMessage := fmt.Sprintf("Invalid Parameter: value (Min: %d, Max: %d)", endpoint.MinValue, endpoint.MaxValue)
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, errorMessage, nil)
+	// info and reboot address a single device rather than a group
+	if endpoint != nil && (endpoint.Code == "info" || endpoint.Code == "reboot") {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if len(devices) == 0 {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusServiceUnavailable, "Service Unavailable", nil)
+		return
+	}
+
+	if errorMessage := endpoint.invalidValue(request.Value); errorMessage != "" {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, errorMessage, nil)
+		return
+	}
+
+	if len(request.Values) > 0 {
+		if request.Value != "" || endpoint.Code == "status" || endpoint.Code == "toggle" || endpoint.Code == "fade" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: values", nil)
 			return
 		}
+		for name := range request.Values {
+			if !slices.Contains(hosts, name) {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter: values (Device '%s' is not in hosts)", name), nil)
+				return
+			}
+		}
+		// Each value is validated against the endpoint of its own device, as extra endpoints can differ between devices
+		for _, m := range devices {
+			value, ok := request.Values[m.Name]
+			if !ok {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter: values (Device '%s' has no value)", m.Name), nil)
+				return
+			}
+			if errorMessage := m.getEndpoint(request.Code).invalidValue(value); errorMessage != "" {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter for device '%s': %s", m.Name, strings.TrimPrefix(errorMessage, "Invalid Parameter: ")), nil)
+				return
+			}
+		}
+	}
 
+	// Dashboards can ask for each device's result as soon as it completes rather than waiting for the slowest
+	var writer *device.NDJSONWriter
+	if device.Streaming(r) {
+		writer = device.NewNDJSONWriter(w)
 	}
 
 	switch endpoint.Code {
 	case "status":
-		responses := b.multiPost(devices, "GET", "status", "")
+		responses := b.multiPost(r.Context(), devices, "GET", "status", "")
+
+		if writer != nil {
+			for r := range responses {
+				if r.Status == nil {
+					if known := b.getDevice(r.Name).known(); known != nil {
+						r = known
+					}
+					r.Error = i18n.T("Internal Server Error")
+				}
+				writer.Write(r)
+			}
+			return
+		}
 
 		responseStruct := struct {
 			Devices []*namedStatus `json:"devices,omitempty"`
-			Errors  []string       `json:"errors,omitempty"`
 		}{}
+		failures := []device.Failure{}
 
 		for r := range responses {
 			if r.Status == nil {
-				responseStruct.Errors = append(responseStruct.Errors, r.Name)
+				failures = append(failures, device.NewFailure(r.Name, r.err))
+				if known := b.getDevice(r.Name).known(); known != nil {
+					responseStruct.Devices = append(responseStruct.Devices, known)
+				}
 				continue
 			}
 			responseStruct.Devices = append(responseStruct.Devices, r)
@@ -542,116 +1198,96 @@ DUPLICATE_DEVICE:
 			return responseStruct.Devices[i].Name < responseStruct.Devices[j].Name
 		})
 
-		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", responseStruct)
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(responseStruct.Devices), responseStruct.Devices, failures)
 	case "toggle":
-		valueTally := int64(0)
+		failures := []device.Failure{}
+		// The first device of the group decides the vote strategy of the group
+		strategy := devices[0].Vote
+		group := devices
+		votes := map[string]bool{}
 
-		if request.Value == "" {
+		if request.Value == "" && !device.VoteNeedsState(strategy) {
+			request.Value = toJsonNumber(0)
+			if device.Vote(strategy, nil) {
+				request.Value = toJsonNumber(1)
+			}
+		} else if request.Value == "" {
 			request.Value = toJsonNumber(0)
 
-			responses := b.multiPost(devices, "GET", "status", "")
+			var err error
+			if votes, failures, err = b.states(r.Context(), devices); err != nil {
+				logging.Log(logging.Error, err.Error())
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				return
+			}
 			devices = nil
 
-			for r := range responses {
-				if r.Status == nil {
-					continue
-				}
-				// Capture non-errored devices
-				devices = append(devices, b.getDevice(r.Name))
-
-				var status *status
-				yamlConfig, err := yaml.Marshal(r.Status)
-				if err != nil {
-					logging.Log(logging.Error, err.Error())
-					httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-					return
-				}
-
-				if err := yaml.Unmarshal(yamlConfig, &status); err != nil {
-					logging.Log(logging.Error, err.Error())
-					httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-					return
+			// Capture the devices to send the new state to, in the order of the hosts
+			states := []bool{}
+			for _, m := range group {
+				if on, ok := votes[m.Name]; ok {
+					devices = append(devices, m)
+					states = append(states, on)
 				}
-
-				valueTally += status.Onoff
 			}
 
-			// Each device votes for next state, if most devices are on, all devices will be toggled off and vice versa
+			// Each device votes for next state, by default if most devices are on, all devices will be toggled off and vice versa
 			if len(devices) == 0 {
-				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				httpCode, jsonResponse = device.SetMultiStatusResponse(0, nil, failures)
 				return
-			} else if valueTally <= int64(len(devices))/2 {
+			} else if device.Vote(strategy, states) {
 				request.Value = toJsonNumber(1)
 			}
 		}
 
-		responses := b.multiPost(devices, "SET", "toggle", request.Value)
-
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
+		// Groups remember which of their devices were on when toggled off, so that toggling them on restores only those devices
+		if len(group) > 1 && storage.Enabled() && !device.DryRunning(r.Context()) {
+			key := groupKey(hosts)
+			if value, _ := request.Value.Int64(); value != 0 {
+				devices = restoreGroup(key, devices, request.Restore == nil || *request.Restore)
+			} else if len(votes) > 0 {
+				rememberGroup(key, group, votes, time.Now())
+			} else if votes, _, err := b.states(r.Context(), group); err == nil {
+				// Devices that cannot be read are reported by the toggle itself
+				rememberGroup(key, group, votes, time.Now())
 			}
-			devices = append(devices, b.getDevice(r.Name))
 		}
 
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
-		}
-	case "fade":
-		responses := b.multiPost(devices, "SET", "toggle", toJsonNumber(0))
+		var toggleFailures []device.Failure
+		devices, toggleFailures = b.collect(writer, b.multiPost(r.Context(), devices, "SET", "toggle", request.Value), true)
 
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
-			}
-			devices = append(devices, b.getDevice(r.Name))
+		if writer != nil {
+			return
 		}
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(devices), nil, append(failures, toggleFailures...))
+	case "fade":
+		var failures, fadeFailures []device.Failure
+		devices, failures = b.collect(writer, b.multiPost(r.Context(), devices, "SET", "toggle", toJsonNumber(0)), false)
 
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		if len(devices) == 0 && writer == nil {
+			httpCode, jsonResponse = device.SetMultiStatusResponse(0, nil, failures)
 			return
 		}
 
-		responses = b.multiPost(devices, "SET", "fade", toJsonNumber(-1))
-
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
-			}
-			devices = append(devices, b.getDevice(r.Name))
-		}
+		devices, fadeFailures = b.collect(writer, b.multiPost(r.Context(), devices, "SET", "fade", toJsonNumber(-1)), true)
 
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+		if writer != nil {
+			return
 		}
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(devices), nil, append(failures, fadeFailures...))
 
 	default:
-		if request.Value == "" {
+		if request.Value == "" && len(request.Values) == 0 && endpoint.needsValue() {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
 			return
 		}
 
-		responses := b.multiPost(devices, "SET", request.Code, request.Value)
+		var failures []device.Failure
+		devices, failures = b.collect(writer, b.multiPostValues(r.Context(), devices, "SET", request.Code, request.Value, request.Values), true)
 
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
-			}
-			devices = append(devices, b.getDevice(r.Name))
-		}
-
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+		if writer != nil {
+			return
 		}
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(devices), nil, failures)
 	}
 }
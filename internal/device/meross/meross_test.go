@@ -0,0 +1,521 @@
+package meross
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// roundTripper answers requests without a network.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// setupBenchmark returns a base of n bulbs whose requests are all answered with the normal responses.
+func setupBenchmark(b *testing.B, n int) *base {
+	serverConfigFile, err := os.ReadFile("testdata/serverConfig/normal_responses.yaml")
+	if err != nil {
+		b.Fatalf("Could not read serverConfigPath")
+	}
+
+	serverConfig := struct {
+		Get struct {
+			Code int    `yaml:"code"`
+			JSON string `yaml:"json"`
+		} `yaml:"get"`
+	}{}
+	if err := yaml.Unmarshal(serverConfigFile, &serverConfig); err != nil {
+		b.Fatalf("Could not unmarshal serverConfig")
+	}
+
+	// Replace the transport rather than serving the responses, so that only the allocations of the client are measured
+	transport := http.DefaultTransport
+	http.DefaultTransport = roundTripper(func(r *http.Request) (*http.Response, error) {
+		io.Copy(io.Discard, r.Body)
+		return &http.Response{
+			StatusCode:    serverConfig.Get.Code,
+			ContentLength: int64(len(serverConfig.Get.JSON)),
+			Body:          io.NopCloser(strings.NewReader(serverConfig.Get.JSON)),
+		}, nil
+	})
+	b.Cleanup(func() { http.DefaultTransport = transport })
+
+	merossConfig := config.Config{}
+	for i := 0; i < n; i++ {
+		merossConfig.Devices = append(merossConfig.Devices, config.Devices{
+			Type: "meross",
+			Config: map[string]any{
+				"name":       fmt.Sprintf("test%d", i),
+				"deviceType": "bulb",
+				"timeoutMs":  5000,
+				"host":       "127.0.0.1",
+			},
+		})
+	}
+
+	logging.SetLogLevel(logging.Error)
+	base, _, err := routes(&merossConfig, "")
+	if err != nil {
+		b.Fatalf("Could not create routes: %v", err)
+	}
+	return base
+}
+
+// Templates that built payloads before they were typed
+const baseTemplate = `{"header":{"from": "http://10.10.10.1/config", "messageId":"%s","method":"%s","namespace":"%s","payloadVersion":1,"sign":"%s","timestamp":0},"payload":%s}`
+
+var templates = map[string]string{
+	"toggle":      `{"togglex":{"channel":0,"onoff": %s}}`,
+	"status":      `{}`,
+	"luminance":   `{"light":{"capacity":4, "luminance": %s}}`,
+	"temperature": `{"light":{"capacity":2, "temperature": %s}}`,
+	"rgb":         `{"light":{"capacity":1, "rgb": %s}}`,
+	"fade":        `{"light":{"capacity":2, "temperature": 1, "luminance": %s}}`,
+	"info":        `{}`,
+	"reboot":      `{}`,
+}
+
+// compact strips the insignificant whitespace of a template.
+func compact(t *testing.T, s string) string {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, []byte(s)); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", s, err)
+	}
+	return buffer.String()
+}
+
+func TestPayloads(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	base, _, err := routes(&config.Config{Devices: []config.Devices{{
+		Type:   "meross",
+		Config: map[string]any{"name": "lamp", "deviceType": "bulb", "timeoutMs": 500, "host": "127.0.0.1", "key": "meross-key"},
+	}}}, "")
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	m := base.Devices[0]
+
+	// Typed payloads and the messages wrapping them match the templates byte for byte, once the templates are compacted
+	assert.Len(t, typedPayloads, len(templates))
+	for code, template := range templates {
+		for _, value := range []string{"0", "1", "100", "16777215"} {
+			e := m.getEndpoint(code)
+			if !assert.NotNil(t, e, code) {
+				continue
+			}
+			if !e.needsValue() {
+				value = ""
+			}
+
+			payload, err := e.payload(json.Number(value))
+			assert.NoError(t, err)
+			expected := template
+			if value != "" {
+				expected = fmt.Sprintf(template, value)
+			}
+			assert.Equal(t, compact(t, expected), string(payload), code)
+
+			message, err := device.MerossMessage("0123456789abcdef0123456789abcdef", "SET", e.Namespace, "fedcba9876543210fedcba9876543210", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, compact(t, fmt.Sprintf(baseTemplate, "0123456789abcdef0123456789abcdef", "SET", e.Namespace, "fedcba9876543210fedcba9876543210", expected)), string(message), code)
+		}
+	}
+
+	// Signatures are the MD5 of the messageId, key and a timestamp of 0, with a new messageId each time
+	messageId, sign := m.sign()
+	sum := md5.Sum([]byte(fmt.Sprintf("%s%s%d", messageId, "meross-key", 0)))
+	assert.Len(t, messageId, 32)
+	assert.Equal(t, hex.EncodeToString(sum[:]), sign)
+	otherId, _ := m.sign()
+	assert.NotEqual(t, messageId, otherId)
+}
+
+// fakeBulb emulates a Meross bulb, recording the namespace and payload of each SET it receives and reporting whether it is on. Broken
+// bulbs drop the connection instead.
+type fakeBulb struct {
+	mutex   sync.Mutex
+	sets    []string
+	on      bool
+	broken  bool
+	failing bool
+}
+
+func (f *fakeBulb) handler(w http.ResponseWriter, r *http.Request) {
+	message := struct {
+		Header struct {
+			Method    string `json:"method"`
+			Namespace string `json:"namespace"`
+		} `json:"header"`
+		Payload json.RawMessage `json:"payload"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&message)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.broken {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+	if f.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if message.Header.Method != "SET" {
+		onoff := 0
+		if f.on {
+			onoff = 1
+		}
+		fmt.Fprintf(w, `{"payload":{"all":{"digest":{"togglex":[{"channel":0,"onoff":%d}]}}}}`, onoff)
+		return
+	}
+
+	f.sets = append(f.sets, message.Header.Namespace+" "+string(message.Payload))
+	if message.Header.Namespace == "Appliance.Control.ToggleX" {
+		toggle := struct {
+			Togglex struct {
+				Onoff int `json:"onoff"`
+			} `json:"togglex"`
+		}{}
+		json.Unmarshal(message.Payload, &toggle)
+		f.on = toggle.Togglex.Onoff == 1
+	}
+	w.Write([]byte(`{"payload":{}}`))
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		url          string
+		body         string
+		expectedCode int
+		expectedBody string
+		expectedSets []string
+	}{
+		{
+			name:         "commands_same_namespace_merged",
+			url:          "/lamp",
+			body:         `{"commands":[{"code":"luminance","value":50},{"code":"temperature","value":20}]}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSets: []string{
+				`Appliance.Control.Light {"light":{"capacity":6,"luminance":50,"temperature":20}}`,
+			},
+		},
+		{
+			name:         "commands_capacity_bits_combined",
+			url:          "/lamp",
+			body:         `{"commands":[{"code":"rgb","value":255},{"code":"luminance","value":10},{"code":"rgb","value":65280}]}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSets: []string{
+				`Appliance.Control.Light {"light":{"capacity":5,"luminance":10,"rgb":65280}}`,
+			},
+		},
+		{
+			name:         "commands_other_namespace_between_not_merged",
+			url:          "/lamp",
+			body:         `{"commands":[{"code":"luminance","value":50},{"code":"toggle","value":1},{"code":"rgb","value":255}]}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSets: []string{
+				`Appliance.Control.Light {"light":{"capacity":4,"luminance":50}}`,
+				`Appliance.Control.ToggleX {"togglex":{"channel":0,"onoff":1}}`,
+				`Appliance.Control.Light {"light":{"capacity":1,"rgb":255}}`,
+			},
+		},
+		{
+			name:         "commands_invalid_value_sends_nothing",
+			url:          "/lamp",
+			body:         `{"commands":[{"code":"luminance","value":50},{"code":"temperature","value":101}]}`,
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value (Min: 0, Max: 100)"}`,
+		},
+		{
+			name:         "commands_single_code",
+			url:          "/lamp",
+			body:         `{"commands":[{"code":"toggle","value":1},{"code":"status"}]}`,
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+	}
+
+	f := &fakeBulb{}
+	server := httptest.NewServer(http.HandlerFunc(f.handler))
+	defer server.Close()
+
+	base, routes, err := routes(&config.Config{Devices: []config.Devices{{
+		Type:   "meross",
+		Config: map[string]any{"name": "lamp", "deviceType": "bulb", "timeoutMs": 500, "host": "127.0.0.1"},
+	}}}, "")
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, m := range base.Devices {
+		m.Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f.sets = nil
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", "application/json")
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			assert.Equal(t, tc.expectedSets, f.sets)
+		})
+	}
+}
+
+// setupBulbs returns a router for a bulb of each name, each served by its own fakeBulb.
+func setupBulbs(t *testing.T, names ...string) (map[string]*fakeBulb, *mux.Router) {
+	bulbs := map[string]*fakeBulb{}
+	merossConfig := config.Config{}
+	for _, name := range names {
+		bulbs[name] = &fakeBulb{}
+		server := httptest.NewServer(http.HandlerFunc(bulbs[name].handler))
+		t.Cleanup(server.Close)
+		merossConfig.Devices = append(merossConfig.Devices, config.Devices{
+			Type:   "meross",
+			Config: map[string]any{"name": name, "deviceType": "bulb", "timeoutMs": 500, "host": strings.TrimPrefix(server.URL, "http://")},
+		})
+	}
+
+	_, routes, err := routes(&merossConfig, "")
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+	return bulbs, router
+}
+
+func TestBaseValues(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	bulbs, router := setupBulbs(t, "lamp1", "lamp2", "lamp3")
+
+	post := func(body string) (int, string) {
+		for _, b := range bulbs {
+			b.sets = nil
+		}
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/meross", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(recorder, request)
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// Each device is sent its own value, the hosts defaulting to the devices named
+	code, body := post(`{"code":"luminance","values":{"lamp1":10,"lamp3":90}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"version":1,"message":"OK"}`, body)
+	assert.Equal(t, []string{`Appliance.Control.Light {"light":{"capacity":4,"luminance":10}}`}, bulbs["lamp1"].sets)
+	assert.Empty(t, bulbs["lamp2"].sets)
+	assert.Equal(t, []string{`Appliance.Control.Light {"light":{"capacity":4,"luminance":90}}`}, bulbs["lamp3"].sets)
+
+	// Values are validated for every device before any is sent
+	code, body = post(`{"code":"luminance","values":{"lamp1":10,"lamp2":101}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, `{"version":1,"message":"Invalid Parameter for device 'lamp2': value (Min: 0, Max: 100)"}`, body)
+	code, body = post(`{"code":"luminance","hosts":"lamp1,lamp2","values":{"lamp1":10}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, `{"version":1,"message":"Invalid Parameter: values (Device 'lamp2' has no value)"}`, body)
+	code, body = post(`{"code":"luminance","hosts":"lamp1","values":{"lamp1":10,"lamp2":20}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, `{"version":1,"message":"Invalid Parameter: values (Device 'lamp2' is not in hosts)"}`, body)
+	code, _ = post(`{"code":"toggle","values":{"lamp1":1}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = post(`{"code":"luminance","value":50,"values":{"lamp1":10}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	for _, b := range bulbs {
+		assert.Empty(t, b.sets)
+	}
+
+	// Devices that fail are listed alongside those that succeeded
+	bulbs["lamp2"].broken = true
+	code, body = post(`{"code":"rgb","values":{"lamp1":255,"lamp2":65280,"lamp3":16711680}}`)
+	assert.Equal(t, http.StatusMultiStatus, code)
+	response := struct {
+		Data struct {
+			Errors []device.Failure `json:"errors"`
+		} `json:"data"`
+	}{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &response))
+	if assert.Len(t, response.Data.Errors, 1) {
+		assert.Equal(t, "lamp2", response.Data.Errors[0].Name)
+		assert.Equal(t, http.StatusInternalServerError, response.Data.Errors[0].Code)
+	}
+	assert.Equal(t, []string{`Appliance.Control.Light {"light":{"capacity":1,"rgb":255}}`}, bulbs["lamp1"].sets)
+	assert.Equal(t, []string{`Appliance.Control.Light {"light":{"capacity":1,"rgb":16711680}}`}, bulbs["lamp3"].sets)
+
+	// Devices that reply with an error status fail rather than being reported as set
+	bulbs["lamp2"].broken = false
+	bulbs["lamp3"].failing = true
+	code, body = post(`{"code":"luminance","values":{"lamp1":10,"lamp2":20,"lamp3":30}}`)
+	assert.Equal(t, http.StatusMultiStatus, code)
+	response.Data.Errors = nil
+	assert.NoError(t, json.Unmarshal([]byte(body), &response))
+	if assert.Len(t, response.Data.Errors, 1) {
+		assert.Equal(t, "lamp3", response.Data.Errors[0].Name)
+		assert.Equal(t, http.StatusInternalServerError, response.Data.Errors[0].Code)
+	}
+	assert.Equal(t, []string{`Appliance.Control.Light {"light":{"capacity":4,"luminance":10}}`}, bulbs["lamp1"].sets)
+	assert.Equal(t, []string{`Appliance.Control.Light {"light":{"capacity":4,"luminance":20}}`}, bulbs["lamp2"].sets)
+}
+
+func TestGroupToggle(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	if err := storage.SetPath(statePath); err != nil {
+		t.Fatalf("Could not set storage path: %v", err)
+	}
+	defer storage.SetPath("")
+
+	bulbs, router := setupBulbs(t, "lamp1", "lamp2", "lamp3")
+
+	post := func(url string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, url, nil))
+		return recorder.Code
+	}
+	set := func(on ...bool) {
+		for i, name := range []string{"lamp1", "lamp2", "lamp3"} {
+			bulbs[name].on = on[i]
+		}
+	}
+	states := func() []bool {
+		return []bool{bulbs["lamp1"].on, bulbs["lamp2"].on, bulbs["lamp3"].on}
+	}
+	remembered := func(hosts ...string) []string {
+		group := groupState{}
+		storage.Load(groupKey(hosts), &group)
+		return group.On
+	}
+
+	// Toggling a group off remembers the devices that were on
+	set(true, true, false)
+	assert.Equal(t, http.StatusOK, post("/meross?code=toggle&value=0&hosts=lamp1,lamp2,lamp3"))
+	assert.Equal(t, []bool{false, false, false}, states())
+	assert.Equal(t, []string{"lamp1", "lamp2"}, remembered("lamp1", "lamp2", "lamp3"))
+
+	// Toggling an already off group keeps the devices remembered when it was last on
+	assert.Equal(t, http.StatusOK, post("/meross?code=toggle&value=0&hosts=lamp1,lamp2,lamp3"))
+	assert.Equal(t, []string{"lamp1", "lamp2"}, remembered("lamp1", "lamp2", "lamp3"))
+
+	// The remembered devices survive a restart and are restored whatever the order of the hosts, then forgotten
+	if err := storage.SetPath(statePath); err != nil {
+		t.Fatalf("Could not reload storage: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, post("/meross?code=toggle&value=1&hosts=lamp3,lamp2,lamp1"))
+	assert.Equal(t, []bool{true, true, false}, states())
+	assert.Empty(t, remembered("lamp1", "lamp2", "lamp3"))
+
+	// Groups are remembered separately
+	assert.Equal(t, http.StatusOK, post("/meross?code=toggle&value=0&hosts=lamp1,lamp3"))
+	assert.Equal(t, []string{"lamp1"}, remembered("lamp1", "lamp3"))
+	assert.Empty(t, remembered("lamp1", "lamp2", "lamp3"))
+
+	// Without remembered devices, or when asked not to restore them, the whole group is toggled on
+	set(false, false, false)
+	assert.Equal(t, http.StatusOK, post("/meross?code=toggle&value=1&hosts=lamp1,lamp2,lamp3"))
+	assert.Equal(t, []bool{true, true, true}, states())
+
+	set(true, false, false)
+	assert.Equal(t, http.StatusOK, post("/meross?code=toggle&value=0&hosts=lamp1,lamp2,lamp3"))
+	assert.Equal(t, http.StatusOK, post("/meross?code=toggle&value=1&hosts=lamp1,lamp2,lamp3&restore=false"))
+	assert.Equal(t, []bool{true, true, true}, states())
+	assert.Empty(t, remembered("lamp1", "lamp2", "lamp3"))
+
+	// Dry runs leave the remembered devices alone
+	set(true, false, true)
+	dryRun, _ := device.WithDryRun(context.Background())
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/meross?code=toggle&value=0&hosts=lamp1,lamp2,lamp3", nil).WithContext(dryRun))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []bool{true, false, true}, states())
+	assert.Empty(t, remembered("lamp1", "lamp2", "lamp3"))
+}
+
+func BenchmarkPostStatus(b *testing.B) {
+	base := setupBenchmark(b, 1)
+	m := base.Devices[0]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.post(context.Background(), "GET", *m.getEndpoint("status"), ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPostToggle(b *testing.B) {
+	base := setupBenchmark(b, 1)
+	m := base.Devices[0]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.post(context.Background(), "SET", *m.getEndpoint("toggle"), "1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPoll100 polls the status of 100 devices concurrently, as the health poller does.
+func BenchmarkPoll100(b *testing.B) {
+	base := setupBenchmark(b, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for r := range base.multiPost(context.Background(), base.Devices, "GET", "status", "") {
+			if r.Status == nil {
+				b.Fatalf("No status from %s", r.Name)
+			}
+		}
+	}
+}
@@ -3,8 +3,10 @@ package meross_thermostat
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
+	_ "embed"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -15,15 +17,14 @@ import (
 	"slices"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/i18n"
 	"github.com/kennedn/restate-go/internal/common/logging"
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
 	"gopkg.in/yaml.v3"
 )
 
@@ -34,17 +35,23 @@ type status struct {
 	Temperature *temperature `json:"temperature,omitempty"`
 }
 
+// temperature holds readings in tenths of a degree Celsius, or in the configured units when unit is set.
 type temperature struct {
-	Current    *int64 `json:"current"`
-	Target     *int64 `json:"target"`
-	Heating    *bool  `json:"heating"`
-	OpenWindow *bool  `json:"openWindow"`
+	Current    *json.Number `json:"current"`
+	Target     *json.Number `json:"target"`
+	Unit       string       `json:"unit,omitempty"`
+	Heating    *bool        `json:"heating"`
+	OpenWindow *bool        `json:"openWindow"`
 }
 
 // namedStatus associates a devices name with its status.
 type namedStatus struct {
 	Name   string `json:"name"`
 	Status any    `json:"status"`
+	// Set on streamed results for devices that did not respond
+	Error string `json:"error,omitempty"`
+	// Why the device did not respond, listed in the errors of multi-device responses
+	err error
 }
 
 // rawStatus represents the raw status response from a Meross device.
@@ -104,28 +111,77 @@ type endpoint struct {
 	MinValue         int64    `yaml:"minValue,omitempty"`
 	MaxValue         int64    `yaml:"maxValue,omitempty"`
 	Namespace        string   `yaml:"namespace"`
-	Template         string   `yaml:"template"`
 }
 
 // meross represents a Meross device configuration with name, host, device type, timeout, and base configuration.
 type meross struct {
-	Name       string `yaml:"name"`
-	Host       string `yaml:"host"`
-	DeviceType string `yaml:"deviceType"`
-	Timeout    uint   `yaml:"timeoutMs"`
-	Key        string `yaml:"key,omitempty"`
+	Name       string        `yaml:"name"`
+	Host       string        `yaml:"host"`
+	DeviceType string        `yaml:"deviceType"`
+	Timeout    uint          `yaml:"timeoutMs"`
+	Key        config.Secret `yaml:"key,omitempty"`
+	Units      string        `yaml:"units"`
+	MinTarget  json.Number   `yaml:"minTarget"`
+	MaxTarget  json.Number   `yaml:"maxTarget"`
+	Vote       string        `yaml:"vote,omitempty"`
 	Base       base
+	limits     *device.Limits
 }
 
 // base represents a list of Meross devices, endpoints and common configuration
 type base struct {
-	BaseTemplate string      `yaml:"baseTemplate"`
-	Endpoints    []*endpoint `yaml:"endpoints"`
-	Devices      []*meross
+	Endpoints []*endpoint `yaml:"endpoints"`
+	Devices   []*meross
 }
 
+type modePayload struct {
+	Mode []mode `json:"mode"`
+}
+
+// mode sets one field of the thermostat's mode, the others are left out so that they are unchanged
+type mode struct {
+	Channel    int64  `json:"channel"`
+	Onoff      *int64 `json:"onoff,omitempty"`
+	Mode       *int64 `json:"mode,omitempty"`
+	ManualTemp *int64 `json:"manualTemp,omitempty"`
+}
+
+func emptyPayload(int64) any {
+	return struct{}{}
+}
+
+// payloads build the payload of each code in the manifest from its value
+var payloads = map[string]func(value int64) any{
+	"status": emptyPayload,
+	"info":   emptyPayload,
+	"reboot": emptyPayload,
+	"toggle": func(v int64) any {
+		return modePayload{Mode: []mode{{Onoff: &v}}}
+	},
+	"mode": func(v int64) any {
+		return modePayload{Mode: []mode{{Mode: &v}}}
+	},
+	// Targets are in tenths of a degree Celsius
+	"target": func(v int64) any {
+		return modePayload{Mode: []mode{{ManualTemp: &v}}}
+	},
+}
+
+// errOutsideLimits is returned when a requested setpoint is outside of a device's safety limits
+var errOutsideLimits = errors.New("outside safety limits")
+
+// manifest holds the endpoints supported by the device, embedded so that it does not depend on the working directory
+//
+//go:embed device.yaml
+var manifest []byte
+
 type Device struct{}
 
+// DryRun previews the setpoint and mode messages a request would send, status is still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 // Routes generates routes for Meross device control based on a provided configuration.
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config, "")
@@ -142,28 +198,38 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 	routes := []router.Route{}
 	base := base{}
 
+	// Fall back to the embedded manifest unless a custom one is provided
 	if internalConfigPath == "" {
-		internalConfigPath = "./internal/device/meross_thermostat/device.yaml"
+		internalConfigPath = os.Getenv("RESTATE_MEROSS_THERMOSTAT_MANIFEST")
 	}
 
-	internalConfigFile, err := os.ReadFile(internalConfigPath)
-	if err != nil {
-		return nil, []router.Route{}, err
+	internalConfigFile := manifest
+	if internalConfigPath != "" {
+		var err error
+		if internalConfigFile, err = os.ReadFile(internalConfigPath); err != nil {
+			return nil, []router.Route{}, err
+		}
 	}
 
 	if err := yaml.Unmarshal(internalConfigFile, &base); err != nil {
 		return nil, []router.Route{}, err
 	}
-	if len(base.Endpoints) == 0 || base.BaseTemplate == "" {
+	if len(base.Endpoints) == 0 {
 		return nil, []router.Route{}, fmt.Errorf("unable to load internalConfigPath \"%s\"", internalConfigPath)
 	}
+	for _, e := range base.Endpoints {
+		if _, ok := payloads[e.Code]; !ok {
+			return nil, []router.Route{}, fmt.Errorf("unknown code \"%s\" in internalConfigPath \"%s\"", e.Code, internalConfigPath)
+		}
+	}
 
 	for _, d := range config.Devices {
 		if d.Type != "meross_thermostat" {
 			continue
 		}
 		meross := meross{
-			Base: base,
+			Units: config.Units,
+			Base:  base,
 		}
 
 		yamlConfig, err := yaml.Marshal(d.Config)
@@ -172,7 +238,7 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &meross); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &meross); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -182,6 +248,22 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 			continue
 		}
 
+		if !device.ValidVote(meross.Vote) {
+			logging.Log(logging.Info, "Unable to load device due to invalid vote \"%s\"", meross.Vote)
+			continue
+		}
+
+		if !device.ValidUnits(meross.Units) {
+			logging.Log(logging.Info, "Unable to load device due to invalid units \"%s\"", meross.Units)
+			continue
+		}
+
+		meross.limits, err = device.NewLimits(meross.MinTarget, meross.MaxTarget, meross.Units)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to load device due to invalid target limits: %v", err)
+			continue
+		}
+
 		routes = append(routes, router.Route{
 			Path:    "/" + meross.Name,
 			Handler: meross.handler,
@@ -194,7 +276,7 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 
 	if len(routes) == 0 {
 		return nil, []router.Route{}, errors.New("no routes found in config")
-	} else if len(routes) == 1 {
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
 		return &base, routes, nil
 	}
 
@@ -205,11 +287,13 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 	routes = append(routes, router.Route{
 		Path:    "/meross",
 		Handler: base.handler,
+		Streams: true,
 	})
 
 	routes = append(routes, router.Route{
 		Path:    "/meross/",
 		Handler: base.handler,
+		Streams: true,
 	})
 	return &base, routes, nil
 }
@@ -252,50 +336,82 @@ func md5SumString(s string) string {
 
 }
 
-// post constructs and sends a POST request to a Meross device and will return a flattened status when the method is equal to GET.
-func (m *meross) post(method string, endpoint endpoint, value json.Number) (*status, error) {
+// send signs a payload for a namespace and sends it to a Meross device, returning the status code and body of the response.
+func (m *meross) send(ctx context.Context, method string, namespace string, payload any) (int, []byte, error) {
 	client := &http.Client{
 		Timeout: time.Duration(m.Timeout) * time.Millisecond,
 	}
-	var payload string
-
-	if value != "" {
-		payload = fmt.Sprintf(endpoint.Template, value.String())
-	} else {
-		payload = endpoint.Template
-	}
 
 	// Newer firmware (6.2.5) requires a unique nonce for messageId
 	messageId := randomHex(16)
-	sign := md5SumString(fmt.Sprintf("%s%s%d", messageId, m.Key, 0))
+	sign := md5SumString(fmt.Sprintf("%s%s%d", messageId, m.Key.Value(), 0))
 
-	jsonPayload := []byte(fmt.Sprintf(m.Base.BaseTemplate, messageId, method, endpoint.Namespace, sign, payload))
+	jsonPayload, err := device.MerossMessage(messageId, method, namespace, sign, payload)
+	if err != nil {
+		return 0, nil, err
+	}
 
-	req, err := http.NewRequest("POST", "http://"+m.Host+"/config", bytes.NewReader(jsonPayload))
+	// Reads are sent as POSTs too, mark them so that they still happen during a dry run
+	if method == "GET" {
+		ctx = device.Read(ctx)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+m.Host+"/config", bytes.NewReader(jsonPayload))
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	// Send the request and get the response
-	resp, err := client.Do(req)
+	resp, err := device.Do(client, req)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+// info retrieves hardware and firmware details from Appliance.System.All along with uptime and signal strength where the firmware reports them.
+func (m *meross) info(ctx context.Context, endpoint endpoint) (*device.MerossInfo, error) {
+	statusCode, all, err := m.send(ctx, "GET", endpoint.Namespace, emptyPayload(0))
+	if err == nil && statusCode != http.StatusOK {
+		err = fmt.Errorf("received status code %d from %s", statusCode, m.Host)
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	if method == "SET" {
-		return nil, nil
+	_, debug, err := m.send(ctx, "GET", device.MerossDebugNamespace, emptyPayload(0))
+	if err != nil {
+		logging.Log(logging.Info, "Unable to retrieve debug information from \"%s\": %v", m.Name, err)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return device.ParseMerossInfo(all, debug)
+}
+
+// post constructs and sends a POST request to a Meross device and will return a flattened status when the method is equal to GET.
+func (m *meross) post(ctx context.Context, method string, endpoint endpoint, value json.Number) (*status, error) {
+	var v int64
+	if value != "" {
+		var err error
+		if v, err = value.Int64(); err != nil {
+			return nil, err
+		}
+	}
+
+	statusCode, body, err := m.send(ctx, method, endpoint.Namespace, payloads[endpoint.Code](v))
 	if err != nil {
 		return nil, err
 	}
 
+	if statusCode != 200 {
+		return nil, err
+	}
+
+	if method == "SET" {
+		return nil, nil
+	}
+
 	rawResponse := rawStatus{}
 
 	if err := json.Unmarshal(body, &rawResponse); err != nil {
@@ -308,12 +424,15 @@ func (m *meross) post(method string, endpoint endpoint, value json.Number) (*sta
 
 	heating := rawResponse.Payload.All.Digest.Thermostat.Mode[0].TargetTemp-rawResponse.Payload.All.Digest.Thermostat.Mode[0].CurrentTemp > 0
 	openWindow := rawResponse.Payload.All.Digest.Thermostat.WindowOpened[0].Status != 0
+	current := device.Temperature(rawResponse.Payload.All.Digest.Thermostat.Mode[0].CurrentTemp, m.Units)
+	target := device.Temperature(rawResponse.Payload.All.Digest.Thermostat.Mode[0].TargetTemp, m.Units)
 	response := status{
 		Onoff: &rawResponse.Payload.All.Digest.Thermostat.Mode[0].Onoff,
 		Mode:  &rawResponse.Payload.All.Digest.Thermostat.Mode[0].Mode,
 		Temperature: &temperature{
-			Current:    &rawResponse.Payload.All.Digest.Thermostat.Mode[0].CurrentTemp,
-			Target:     &rawResponse.Payload.All.Digest.Thermostat.Mode[0].TargetTemp,
+			Current:    &current,
+			Target:     &target,
+			Unit:       device.UnitSymbol(m.Units),
 			Heating:    &heating,
 			OpenWindow: &openWindow,
 		},
@@ -322,6 +441,28 @@ func (m *meross) post(method string, endpoint endpoint, value json.Number) (*sta
 	return &response, err
 }
 
+// parseTarget converts a requested setpoint into tenths of a degree Celsius, rejecting values outside of the safety limits.
+func (m *meross) parseTarget(value json.Number) (json.Number, error) {
+	tenths, err := device.ParseTemperature(value, m.Units)
+	if err != nil {
+		return "", err
+	}
+
+	if !m.limits.Allows(tenths) {
+		logging.Log(logging.Error, "Rejected target %s for \"%s\", outside of safety limits (%s)", value, m.Name, m.limits.String(m.Units))
+		return "", errOutsideLimits
+	}
+	return toJsonNumber(tenths), nil
+}
+
+// targetResponse sets the response for a failed parseTarget.
+func (m *meross) targetResponse(err error) (int, []byte) {
+	if errors.Is(err, errOutsideLimits) {
+		return device.SetJSONResponse(http.StatusUnprocessableEntity, fmt.Sprintf("Target Outside Safety Limits (%s)", m.limits.String(m.Units)), nil)
+	}
+	return device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+}
+
 // Handler is the HTTP handler for Meross device control.
 func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 	var jsonResponse []byte
@@ -345,16 +486,9 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	endpoint := m.getEndpoint(request.Code)
@@ -363,6 +497,13 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if endpoint.Code == "target" && request.Value != "" {
+		if request.Value, err = m.parseTarget(request.Value); err != nil {
+			httpCode, jsonResponse = m.targetResponse(err)
+			return
+		}
+	}
+
 	if request.Value != "" && endpoint.MaxValue != 0 {
 		valueInt64, err := request.Value.Int64()
 		if err != nil || valueInt64 > endpoint.MaxValue || valueInt64 < endpoint.MinValue || valueInt64 < 0 {
@@ -375,7 +516,7 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 
 	switch endpoint.Code {
 	case "status":
-		status, err = m.post("GET", *m.getEndpoint("status"), "")
+		status, err = m.post(r.Context(), "GET", *m.getEndpoint("status"), "")
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -386,7 +527,7 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	case "toggle":
 		if request.Value == "" {
-			status, err = m.post("GET", *m.getEndpoint("status"), "")
+			status, err = m.post(r.Context(), "GET", *m.getEndpoint("status"), "")
 			if err != nil {
 				logging.Log(logging.Error, err.Error())
 				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -396,21 +537,40 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 			request.Value = toJsonNumber(1 - *status.Onoff)
 		}
 
-		_, err = m.post("SET", *endpoint, request.Value)
+		_, err = m.post(r.Context(), "SET", *endpoint, request.Value)
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+
+	case "info":
+		info, err := m.info(r.Context(), *endpoint)
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", info)
+		return
+	case "reboot":
+		_, err = m.post(r.Context(), "SET", *endpoint, "")
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
 		}
+		logging.Log(logging.Info, "Rebooting \"%s\"", m.Name)
 
 	case "fade":
-		_, err = m.post("SET", *m.getEndpoint("toggle"), toJsonNumber(0))
+		_, err = m.post(r.Context(), "SET", *m.getEndpoint("toggle"), toJsonNumber(0))
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
 		}
-		_, err = m.post("SET", *endpoint, toJsonNumber(-1))
+		_, err = m.post(r.Context(), "SET", *endpoint, toJsonNumber(-1))
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -422,7 +582,7 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
 			return
 		}
-		_, err = m.post("SET", *endpoint, request.Value)
+		_, err = m.post(r.Context(), "SET", *endpoint, request.Value)
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -452,22 +612,22 @@ func (b *base) getDevice(name string) *meross {
 	return nil
 }
 
-// multiPost performs multiple POST requests to control multiple Meross devices in parallel and returns their statuses.
-func (b *base) multiPost(devices []*meross, method string, endpoint string, value json.Number) chan *namedStatus {
-	wg := sync.WaitGroup{}
+// multiPost performs multiple POST requests to control multiple Meross devices in parallel, or in sequence when the request asked for
+// one, and returns their statuses.
+func (b *base) multiPost(ctx context.Context, devices []*meross, method string, endpoint string, value json.Number) chan *namedStatus {
 	responses := make(chan *namedStatus, len(devices))
 
-	for _, m := range devices {
-		wg.Add(1)
-		go func(m *meross, method string, endpoint string, value json.Number) {
-			defer wg.Done()
+	go func() {
+		device.Each(ctx, len(devices), method == "SET", func(i int) {
+			m := devices[i]
 			response := namedStatus{
 				Name:   m.Name,
 				Status: nil,
 			}
 
-			status, err := m.post(method, *m.getEndpoint(endpoint), value)
+			status, err := m.post(ctx, method, *m.getEndpoint(endpoint), value)
 			if err != nil {
+				response.err = err
 				responses <- &response
 				return
 			}
@@ -477,11 +637,7 @@ func (b *base) multiPost(devices []*meross, method string, endpoint string, valu
 				response.Status = status
 			}
 			responses <- &response
-		}(m, method, endpoint, value)
-	}
-
-	go func() {
-		wg.Wait()
+		})
 		close(responses)
 	}()
 
@@ -489,11 +645,38 @@ func (b *base) multiPost(devices []*meross, method string, endpoint string, valu
 }
 
 // Handler is the HTTP handler for handling requests to control multiple Meross devices.
+// collect returns the devices that responded to a multi-device request and the failures of those that did not. When streaming, devices
+// that did not respond are written as they arrive, as are those that did when the request is the last of an operation.
+func (b *base) collect(writer *device.NDJSONWriter, responses chan *namedStatus, last bool) ([]*meross, []device.Failure) {
+	devices := []*meross{}
+	failures := []device.Failure{}
+	for r := range responses {
+		if r.Status == nil {
+			failures = append(failures, device.NewFailure(r.Name, r.err))
+			if writer != nil {
+				r.Error = i18n.T("Internal Server Error")
+				writer.Write(r)
+			}
+			continue
+		}
+		if writer != nil && last {
+			writer.Write(r)
+		}
+		devices = append(devices, b.getDevice(r.Name))
+	}
+	return devices, failures
+}
+
 func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 	var jsonResponse []byte
 	var httpCode int
 
-	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+	// Streamed responses are written as each device completes
+	defer func() {
+		if httpCode != 0 {
+			device.JSONResponse(w, httpCode, jsonResponse)
+		}
+	}()
 
 	if r.Method == http.MethodGet {
 		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
@@ -507,16 +690,9 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	if request.Hosts == "" {
@@ -536,6 +712,11 @@ DUPLICATE_DEVICE:
 			return
 		}
 
+		// Devices taken out of rotation are excluded from groups
+		if !device.Enabled(m.Name) {
+			continue
+		}
+
 		endpoint = m.getEndpoint(request.Code)
 		if endpoint == nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter for device '%s': code", m.Name), nil)
@@ -551,6 +732,34 @@ DUPLICATE_DEVICE:
 		devices = append(devices, m)
 	}
 
+	// info and reboot address a single device rather than a group
+	if endpoint != nil && (endpoint.Code == "info" || endpoint.Code == "reboot") {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if len(devices) == 0 {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusServiceUnavailable, "Service Unavailable", nil)
+		return
+	}
+
+	if endpoint.Code == "target" && request.Value != "" {
+		value, err := devices[0].parseTarget(request.Value)
+		if err != nil {
+			httpCode, jsonResponse = devices[0].targetResponse(err)
+			return
+		}
+		tenths, _ := value.Int64()
+		for _, m := range devices[1:] {
+			if !m.limits.Allows(tenths) {
+				logging.Log(logging.Error, "Rejected target %s for \"%s\", outside of safety limits (%s)", request.Value, m.Name, m.limits.String(m.Units))
+				httpCode, jsonResponse = m.targetResponse(errOutsideLimits)
+				return
+			}
+		}
+		request.Value = value
+	}
+
 	if request.Value != "" && endpoint.MaxValue != 0 {
 		valueInt64, err := request.Value.Int64()
 		if err != nil || valueInt64 > endpoint.MaxValue || valueInt64 < endpoint.MinValue || valueInt64 < 0 {
@@ -561,18 +770,29 @@ DUPLICATE_DEVICE:
 
 	}
 
+	// Dashboards can ask for each device's result as soon as it completes rather than waiting for the slowest
+	var writer *device.NDJSONWriter
+	if device.Streaming(r) {
+		writer = device.NewNDJSONWriter(w)
+	}
+
 	switch endpoint.Code {
 	case "status":
-		responses := b.multiPost(devices, "GET", "status", "")
+		responses := b.multiPost(r.Context(), devices, "GET", "status", "")
+
+		if writer != nil {
+			b.collect(writer, responses, true)
+			return
+		}
 
 		responseStruct := struct {
 			Devices []*namedStatus `json:"devices,omitempty"`
-			Errors  []string       `json:"errors,omitempty"`
 		}{}
+		failures := []device.Failure{}
 
 		for r := range responses {
 			if r.Status == nil {
-				responseStruct.Errors = append(responseStruct.Errors, r.Name)
+				failures = append(failures, device.NewFailure(r.Name, r.err))
 				continue
 			}
 			responseStruct.Devices = append(responseStruct.Devices, r)
@@ -582,22 +802,30 @@ DUPLICATE_DEVICE:
 			return responseStruct.Devices[i].Name < responseStruct.Devices[j].Name
 		})
 
-		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", responseStruct)
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(responseStruct.Devices), responseStruct.Devices, failures)
 	case "toggle":
-		valueTally := int64(0)
+		failures := []device.Failure{}
+		// The first device of the group decides the vote strategy of the group
+		strategy := devices[0].Vote
 
-		if request.Value == "" {
+		if request.Value == "" && !device.VoteNeedsState(strategy) {
+			request.Value = toJsonNumber(0)
+			if device.Vote(strategy, nil) {
+				request.Value = toJsonNumber(1)
+			}
+		} else if request.Value == "" {
 			request.Value = toJsonNumber(0)
 
-			responses := b.multiPost(devices, "GET", "status", "")
+			responses := b.multiPost(r.Context(), devices, "GET", "status", "")
+			hosts := devices
 			devices = nil
+			votes := map[string]bool{}
 
 			for r := range responses {
 				if r.Status == nil {
+					failures = append(failures, device.NewFailure(r.Name, r.err))
 					continue
 				}
-				// Capture non-errored devices
-				devices = append(devices, b.getDevice(r.Name))
 
 				var status *status
 				yamlConfig, err := yaml.Marshal(r.Status)
@@ -613,64 +841,49 @@ DUPLICATE_DEVICE:
 					return
 				}
 
-				valueTally += *status.Onoff
+				votes[r.Name] = *status.Onoff == 1
+			}
+
+			// Capture non-errored devices, in the order of the hosts
+			states := []bool{}
+			for _, m := range hosts {
+				if on, ok := votes[m.Name]; ok {
+					devices = append(devices, m)
+					states = append(states, on)
+				}
 			}
 
-			// Each device votes for next state, if most devices are on, all devices will be toggled off and vice versa
+			// Each device votes for next state, by default if most devices are on, all devices will be toggled off and vice versa
 			if len(devices) == 0 {
-				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				httpCode, jsonResponse = device.SetMultiStatusResponse(0, nil, failures)
 				return
-			} else if valueTally <= int64(len(devices))/2 {
+			} else if device.Vote(strategy, states) {
 				request.Value = toJsonNumber(1)
 			}
 		}
 
-		responses := b.multiPost(devices, "SET", "toggle", request.Value)
+		var toggleFailures []device.Failure
+		devices, toggleFailures = b.collect(writer, b.multiPost(r.Context(), devices, "SET", "toggle", request.Value), true)
 
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
-			}
-			devices = append(devices, b.getDevice(r.Name))
-		}
-
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+		if writer != nil {
+			return
 		}
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(devices), nil, append(failures, toggleFailures...))
 	case "fade":
-		responses := b.multiPost(devices, "SET", "toggle", toJsonNumber(0))
+		var failures, fadeFailures []device.Failure
+		devices, failures = b.collect(writer, b.multiPost(r.Context(), devices, "SET", "toggle", toJsonNumber(0)), false)
 
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
-			}
-			devices = append(devices, b.getDevice(r.Name))
-		}
-
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		if len(devices) == 0 && writer == nil {
+			httpCode, jsonResponse = device.SetMultiStatusResponse(0, nil, failures)
 			return
 		}
 
-		responses = b.multiPost(devices, "SET", "fade", toJsonNumber(-1))
-
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
-			}
-			devices = append(devices, b.getDevice(r.Name))
-		}
+		devices, fadeFailures = b.collect(writer, b.multiPost(r.Context(), devices, "SET", "fade", toJsonNumber(-1)), true)
 
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+		if writer != nil {
+			return
 		}
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(devices), nil, append(failures, fadeFailures...))
 
 	default:
 		if request.Value == "" {
@@ -678,20 +891,12 @@ DUPLICATE_DEVICE:
 			return
 		}
 
-		responses := b.multiPost(devices, "SET", request.Code, request.Value)
-
-		devices = nil
-		for r := range responses {
-			if r.Status == nil {
-				continue
-			}
-			devices = append(devices, b.getDevice(r.Name))
-		}
+		var failures []device.Failure
+		devices, failures = b.collect(writer, b.multiPost(r.Context(), devices, "SET", request.Code, request.Value), true)
 
-		if len(devices) == 0 {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+		if writer != nil {
+			return
 		}
+		httpCode, jsonResponse = device.SetMultiStatusResponse(len(devices), nil, failures)
 	}
 }
@@ -0,0 +1,423 @@
+// Package miio provides control of Xiaomi and Aqara plugs and gateways, and readings from sensors paired to gateways, over the
+// miIO LAN protocol.
+package miio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Brightness and colour the gateway light is turned on with before it has been seen on, full brightness white
+const defaultRGB = 0x64ffffff
+
+// status is the representation of a device returned by the status code, only the fields reported by the model are set.
+type status struct {
+	Power        string   `json:"power,omitempty"`
+	Brightness   *int     `json:"brightness,omitempty"`
+	Illumination *int     `json:"illumination,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	Humidity     *float64 `json:"humidity,omitempty"`
+	Pressure     *float64 `json:"pressure,omitempty"`
+}
+
+// miotProperty identifies a property of a device implementing the MIoT specification.
+type miotProperty struct {
+	DID   string `json:"did"`
+	SIID  int    `json:"siid"`
+	PIID  int    `json:"piid"`
+	Value any    `json:"value,omitempty"`
+	Code  int    `json:"code,omitempty"`
+}
+
+// Control codes offered by each model
+var modelCodes = map[string][]string{
+	"plug":    {"status", "toggle", "on", "off"},
+	"gateway": {"status", "toggle", "on", "off"},
+	"sensor":  {"status"},
+}
+
+// miio represents a miIO device configuration with name, address, token and model specific parameters.
+type miio struct {
+	Name     string        `yaml:"name"`
+	Timeout  uint          `yaml:"timeoutMs"`
+	Host     string        `yaml:"host"`
+	Token    config.Secret `yaml:"token"`
+	Model    string        `yaml:"model"`
+	Protocol string        `yaml:"protocol"`
+	SIID     int           `yaml:"siid"`
+	PIID     int           `yaml:"piid"`
+	SID      string        `yaml:"sid"`
+	Base     base
+	client   *client
+	mutex    sync.Mutex
+	rgb      int64
+}
+
+// base represents a list of miIO devices
+type base struct {
+	Devices []*miio
+}
+
+type Device struct{}
+
+// DryRun previews calls that switch a plug or light, status is still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for miIO devices based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts miIO devices from config, creating a client for each from its token, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "miio" {
+			continue
+		}
+		miio := miio{
+			Base: base,
+			rgb:  defaultRGB,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &miio); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if miio.Name == "" || miio.Timeout == 0 || miio.Host == "" || miio.Token == "" || miio.Model == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if err := miio.validate(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", miio.Name, err)
+			continue
+		}
+
+		if miio.client, err = newClient(miio.Host, miio.Token.Value(), time.Duration(miio.Timeout)*time.Millisecond); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", miio.Name, err)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + miio.Name,
+			Handler: miio.handler,
+		})
+
+		base.Devices = append(base.Devices, &miio)
+
+		logging.Log(logging.Info, "Found device \"%s\"", miio.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/miio" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/miio",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/miio/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// validate checks the model specific parameters, filling in defaults.
+func (m *miio) validate() error {
+	if _, ok := modelCodes[m.Model]; !ok {
+		return errors.New("model must be one of 'plug', 'gateway' or 'sensor'")
+	}
+
+	switch m.Protocol {
+	case "":
+		m.Protocol = "miio"
+	case "miio", "miot":
+	default:
+		return errors.New("protocol must be either 'miio' or 'miot'")
+	}
+	if m.Protocol == "miot" && m.Model != "plug" {
+		return errors.New("only plugs support the miot protocol")
+	}
+	// Most MIoT plugs have their switch as the first property of the second service
+	if m.SIID == 0 {
+		m.SIID = 2
+	}
+	if m.PIID == 0 {
+		m.PIID = 1
+	}
+
+	if m.Model == "sensor" && m.SID == "" {
+		return errors.New("sensors need the sid of the sensor on their gateway")
+	}
+	return nil
+}
+
+// supports reports whether code is a control code for the device.
+func (m *miio) supports(code string) bool {
+	for _, c := range modelCodes[m.Model] {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// plugPower returns whether a plug is on.
+func (m *miio) plugPower() (bool, error) {
+	if m.Protocol == "miot" {
+		result := []miotProperty{}
+		if err := m.client.call("get_properties", []miotProperty{{DID: "power", SIID: m.SIID, PIID: m.PIID}}, &result); err != nil {
+			return false, err
+		}
+		if len(result) != 1 || result[0].Code != 0 {
+			return false, fmt.Errorf("unable to read power property of \"%s\"", m.Name)
+		}
+		on, ok := result[0].Value.(bool)
+		if !ok {
+			return false, fmt.Errorf("unexpected power property of \"%s\": %v", m.Name, result[0].Value)
+		}
+		return on, nil
+	}
+
+	result := []string{}
+	if err := m.client.call("get_prop", []string{"power"}, &result); err != nil {
+		return false, err
+	}
+	if len(result) != 1 {
+		return false, fmt.Errorf("unable to read power of \"%s\"", m.Name)
+	}
+	return result[0] == "on", nil
+}
+
+// setPlugPower turns a plug on or off.
+func (m *miio) setPlugPower(ctx context.Context, on bool) error {
+	if m.Protocol == "miot" {
+		properties := []miotProperty{{DID: "power", SIID: m.SIID, PIID: m.PIID, Value: on}}
+		if m.client.record(ctx, "set_properties", properties) {
+			return nil
+		}
+		result := []miotProperty{}
+		if err := m.client.call("set_properties", properties, &result); err != nil {
+			return err
+		}
+		if len(result) != 1 || result[0].Code != 0 {
+			return fmt.Errorf("unable to set power property of \"%s\"", m.Name)
+		}
+		return nil
+	}
+
+	power := "off"
+	if on {
+		power = "on"
+	}
+	if m.client.record(ctx, "set_power", []string{power}) {
+		return nil
+	}
+	return m.client.call("set_power", []string{power}, nil)
+}
+
+// gatewayLight returns the brightness and colour of the gateway light and the illumination measured by the gateway.
+func (m *miio) gatewayLight() (int64, int, error) {
+	result := []int64{}
+	if err := m.client.call("get_prop", []string{"rgb", "illumination"}, &result); err != nil {
+		return 0, 0, err
+	}
+	if len(result) != 2 {
+		return 0, 0, fmt.Errorf("unable to read light of \"%s\"", m.Name)
+	}
+
+	// Remember the colour the light was on with, so that it can be turned back on the same
+	if result[0]>>24 > 0 {
+		m.mutex.Lock()
+		m.rgb = result[0]
+		m.mutex.Unlock()
+	}
+	return result[0], int(result[1]), nil
+}
+
+// setGatewayLight turns the gateway light on with its last known brightness and colour, or off.
+func (m *miio) setGatewayLight(ctx context.Context, on bool) error {
+	m.mutex.Lock()
+	rgb := m.rgb
+	m.mutex.Unlock()
+	if !on {
+		rgb = 0
+	}
+	if m.client.record(ctx, "set_rgb", []int64{rgb}) {
+		return nil
+	}
+	return m.client.call("set_rgb", []int64{rgb}, nil)
+}
+
+// sensor returns the readings of a sensor paired to the gateway, readings the sensor does not support are left unset.
+func (m *miio) sensor() (*status, error) {
+	result := [][]any{}
+	if err := m.client.call("get_device_prop_exp", [][]string{{m.SID, "temperature", "humidity", "pressure"}}, &result); err != nil {
+		return nil, err
+	}
+	if len(result) != 1 || len(result[0]) != 3 {
+		return nil, fmt.Errorf("unable to read sensor \"%s\"", m.SID)
+	}
+
+	// Temperature and humidity are reported in hundredths, and pressure in pascals
+	readings := []*float64{}
+	for _, v := range result[0] {
+		n, ok := v.(float64)
+		if !ok {
+			readings = append(readings, nil)
+			continue
+		}
+		n /= 100
+		readings = append(readings, &n)
+	}
+	return &status{Temperature: readings[0], Humidity: readings[1], Pressure: readings[2]}, nil
+}
+
+// status returns the state of the device.
+func (m *miio) status() (*status, error) {
+	switch m.Model {
+	case "plug":
+		on, err := m.plugPower()
+		if err != nil {
+			return nil, err
+		}
+		if on {
+			return &status{Power: "on"}, nil
+		}
+		return &status{Power: "off"}, nil
+	case "gateway":
+		rgb, illumination, err := m.gatewayLight()
+		if err != nil {
+			return nil, err
+		}
+		brightness := int(rgb >> 24)
+		power := "off"
+		if brightness > 0 {
+			power = "on"
+		}
+		return &status{Power: power, Brightness: &brightness, Illumination: &illumination}, nil
+	default:
+		return m.sensor()
+	}
+}
+
+// setPower turns a plug or gateway light on or off.
+func (m *miio) setPower(ctx context.Context, on bool) error {
+	if m.Model == "gateway" {
+		return m.setGatewayLight(ctx, on)
+	}
+	return m.setPlugPower(ctx, on)
+}
+
+// Handler is the HTTP handler for miIO device control.
+func (m *miio) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", modelCodes[m.Model])
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !m.supports(request.Code) {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = m.status()
+	case "on":
+		err = m.setPower(r.Context(), true)
+	case "off":
+		err = m.setPower(r.Context(), false)
+	case "toggle":
+		var s *status
+		if s, err = m.status(); err == nil {
+			err = m.setPower(r.Context(), s.Power != "on")
+		}
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all miIO devices in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured miIO devices.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
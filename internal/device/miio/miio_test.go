@@ -0,0 +1,420 @@
+package miio
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read miio input")
+	}
+
+	miioConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &miioConfig); err != nil {
+		t.Fatalf("Could not read miio input")
+	}
+	return &miioConfig
+}
+
+// setupMIIOServer emulates a miIO device with a token, answering calls with the result returned by handle, or an error when it
+// does not return ok, and recording them.
+func setupMIIOServer(t *testing.T, token string, mutex *sync.Mutex, calls *[]string, handle func(method string, params string) (string, bool)) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	c, err := newClient(conn.LocalAddr().String(), token, time.Second)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	c.deviceID = 0x0102abcd
+
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			request := append([]byte{}, buffer[:n]...)
+
+			if n == 32 && binary.BigEndian.Uint32(request[4:]) == 0xffffffff {
+				hello := make([]byte, 32)
+				copy(hello, request[:4])
+				binary.BigEndian.PutUint32(hello[8:], c.deviceID)
+				binary.BigEndian.PutUint32(hello[12:], 1000)
+				conn.WriteTo(hello, addr)
+				continue
+			}
+
+			// Requests that cannot be decrypted or are stamped before the hello are dropped, as they are by devices
+			payload, err := c.decrypt(request[32:])
+			if err != nil || binary.BigEndian.Uint32(request[8:]) != c.deviceID || binary.BigEndian.Uint32(request[12:]) <= 1000 {
+				continue
+			}
+			rpc := struct {
+				ID     int             `json:"id"`
+				Method string          `json:"method"`
+				Params json.RawMessage `json:"params"`
+			}{}
+			if json.Unmarshal(payload, &rpc) != nil {
+				continue
+			}
+
+			mutex.Lock()
+			*calls = append(*calls, rpc.Method+" "+string(rpc.Params))
+			result, ok := handle(rpc.Method, string(rpc.Params))
+			mutex.Unlock()
+
+			response := fmt.Sprintf(`{"id":%d,"result":%s}`, rpc.ID, result)
+			if !ok {
+				response = fmt.Sprintf(`{"id":%d,"error":{"code":-5001,"message":"%s"}}`, rpc.ID, result)
+			}
+			conn.WriteTo(c.packet([]byte(response), 1001), addr)
+		}
+	}()
+	return conn
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/miioConfig/normal_config.yaml",
+			routeCount:    7,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/miioConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/miioConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/miioConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/miioConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		expectedCode  int
+		expectedBody  string
+		expectedCalls []string
+	}{
+		{
+			name:         "get_plug_request",
+			method:       "GET",
+			url:          "/miio/heater",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","toggle","on","off"]}`,
+		},
+		{
+			name:         "get_sensor_request",
+			method:       "GET",
+			url:          "/miio/bedroom",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/miio/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["heater","fan","gateway","bedroom","hallway"]}`,
+		},
+		{
+			name:          "plug_status",
+			method:        "POST",
+			url:           "/miio/heater?code=status",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK","data":{"power":"off"}}`,
+			expectedCalls: []string{`get_prop ["power"]`},
+		},
+		{
+			name:          "plug_toggle",
+			method:        "POST",
+			url:           "/miio/heater?code=toggle",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{`get_prop ["power"]`, `set_power ["on"]`},
+		},
+		{
+			name:          "plug_status_after_toggle",
+			method:        "POST",
+			url:           "/miio/heater?code=status",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK","data":{"power":"on"}}`,
+			expectedCalls: []string{`get_prop ["power"]`},
+		},
+		{
+			name:          "miot_plug_on",
+			method:        "POST",
+			url:           "/miio/fan?code=on",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{`set_properties [{"did":"power","siid":2,"piid":1,"value":true}]`},
+		},
+		{
+			name:          "miot_plug_status",
+			method:        "POST",
+			url:           "/miio/fan?code=status",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK","data":{"power":"on"}}`,
+			expectedCalls: []string{`get_properties [{"did":"power","siid":2,"piid":1}]`},
+		},
+		{
+			name:          "gateway_status",
+			method:        "POST",
+			url:           "/miio/gateway?code=status",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK","data":{"power":"on","brightness":50,"illumination":1024}}`,
+			expectedCalls: []string{`get_prop ["rgb","illumination"]`},
+		},
+		{
+			name:          "gateway_toggle_off",
+			method:        "POST",
+			url:           "/miio/gateway?code=toggle",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{`get_prop ["rgb","illumination"]`, `set_rgb [0]`},
+		},
+		{
+			name:          "gateway_on_restores_colour",
+			method:        "POST",
+			url:           "/miio/gateway?code=on",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{`set_rgb [855638015]`},
+		},
+		{
+			name:          "sensor_status",
+			method:        "POST",
+			url:           "/miio/bedroom?code=status",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK","data":{"temperature":21.5,"humidity":48,"pressure":1001}}`,
+			expectedCalls: []string{`get_device_prop_exp [["lumi.158d0001a2b3c4","temperature","humidity","pressure"]]`},
+		},
+		{
+			name:         "sensor_without_pressure",
+			method:       "POST",
+			url:          "/miio/hallway?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"temperature":20.5,"humidity":55.1}}`,
+		},
+		{
+			name:         "device_error",
+			method:       "POST",
+			url:          "/miio/fan?code=off",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "toggle_sensor",
+			method:       "POST",
+			url:          "/miio/bedroom?code=toggle",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/miio/heater",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/miio/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	mutex := sync.Mutex{}
+	calls := []string{}
+
+	heaterPower := "off"
+	heater := setupMIIOServer(t, "00112233445566778899aabbccddeeff", &mutex, &calls, func(method string, params string) (string, bool) {
+		switch method {
+		case "get_prop":
+			return `["` + heaterPower + `"]`, true
+		case "set_power":
+			heaterPower = params[2 : len(params)-2]
+			return `["ok"]`, true
+		}
+		return "unknown method", false
+	})
+	defer heater.Close()
+
+	fanPower := false
+	fan := setupMIIOServer(t, "ffeeddccbbaa99887766554433221100", &mutex, &calls, func(method string, params string) (string, bool) {
+		switch method {
+		case "get_properties":
+			return fmt.Sprintf(`[{"did":"power","siid":2,"piid":1,"code":0,"value":%t}]`, fanPower), true
+		case "set_properties":
+			// The fan refuses to turn off, as when a child lock is set
+			if params == `[{"did":"power","siid":2,"piid":1,"value":false}]` {
+				return "child lock", false
+			}
+			fanPower = true
+			return `[{"did":"power","siid":2,"piid":1,"code":0}]`, true
+		}
+		return "unknown method", false
+	})
+	defer fan.Close()
+
+	rgb := 0x32ffffff
+	gateway := setupMIIOServer(t, "0123456789abcdef0123456789abcdef", &mutex, &calls, func(method string, params string) (string, bool) {
+		switch method {
+		case "get_prop":
+			return fmt.Sprintf(`[%d,1024]`, rgb), true
+		case "set_rgb":
+			fmt.Sscanf(params, "[%d]", &rgb)
+			return `["ok"]`, true
+		case "get_device_prop_exp":
+			if params == `[["lumi.158d0001a2b3c4","temperature","humidity","pressure"]]` {
+				return `[[2150,4800,100100]]`, true
+			}
+			return `[[2050,5510,""]]`, true
+		}
+		return "unknown method", false
+	})
+	defer gateway.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/miioConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		switch d.Name {
+		case "heater":
+			d.client.host = heater.LocalAddr().String()
+		case "fan":
+			d.client.host = fan.LocalAddr().String()
+		default:
+			d.client.host = gateway.LocalAddr().String()
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mutex.Lock()
+			calls = calls[:0]
+			mutex.Unlock()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if tc.expectedCalls != nil {
+				assert.Equal(t, tc.expectedCalls, calls)
+			}
+		})
+	}
+
+	t.Run("dry_run_toggle", func(t *testing.T) {
+		mutex.Lock()
+		calls = calls[:0]
+		mutex.Unlock()
+		ctx, dryRun := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/miio/fan?code=toggle", nil).WithContext(ctx))
+		assert.Equal(t, 200, recorder.Code)
+
+		// The power is still read to decide the toggle, but setting it is only recorded
+		mutex.Lock()
+		for _, c := range calls {
+			assert.Contains(t, c, "get_properties")
+		}
+		mutex.Unlock()
+		recorded := dryRun.Calls()
+		if assert.Len(t, recorded, 1) {
+			assert.Equal(t, "udp://"+fan.LocalAddr().String(), recorded[0].URL)
+			assert.Equal(t, "set_properties", recorded[0].Payload.(map[string]any)["method"])
+		}
+	})
+
+	t.Run("wrong_token", func(t *testing.T) {
+		c, err := newClient(gateway.LocalAddr().String(), "00000000000000000000000000000000", 100*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Could not create client: %v", err)
+		}
+		assert.Error(t, c.call("get_prop", []string{"power"}, nil))
+	})
+}
@@ -0,0 +1,207 @@
+package miio
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// client speaks the miIO protocol to a single device, JSON-RPC calls encrypted with a key derived from the device token.
+type client struct {
+	host     string
+	token    []byte
+	timeout  time.Duration
+	mutex    sync.Mutex
+	deviceID uint32
+	stamp    uint32
+	stampAt  time.Time
+	id       int
+}
+
+// rpcError is an error returned by a device in response to a call.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("miio returned %d: %s", e.Code, e.Message)
+}
+
+// newClient returns a client for a device with a 32 character hex token.
+func newClient(host string, token string, timeout time.Duration) (*client, error) {
+	t, err := hex.DecodeString(token)
+	if err != nil || len(t) != 16 {
+		return nil, errors.New("token must be 32 hex characters")
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "54321")
+	}
+	return &client{host: host, token: t, timeout: timeout}, nil
+}
+
+// keys returns the key and IV derived from the token.
+func (c *client) keys() ([]byte, []byte) {
+	key := md5.Sum(c.token)
+	iv := md5.Sum(append(key[:], c.token...))
+	return key[:], iv[:]
+}
+
+// encrypt encrypts data with PKCS#7 padding.
+func (c *client) encrypt(data []byte) []byte {
+	key, iv := c.keys()
+	block, _ := aes.NewCipher(key)
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	return out
+}
+
+// decrypt decrypts data and removes its PKCS#7 padding.
+func (c *client) decrypt(data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("miio payload is not a multiple of the block size")
+	}
+	key, iv := c.keys()
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("invalid padding in miio payload, check the token")
+	}
+	return out[:len(out)-padding], nil
+}
+
+// packet builds a packet around an encrypted payload, checksummed with the token.
+func (c *client) packet(payload []byte, stamp uint32) []byte {
+	encrypted := c.encrypt(payload)
+	packet := make([]byte, 32, 32+len(encrypted))
+	binary.BigEndian.PutUint16(packet, 0x2131)
+	binary.BigEndian.PutUint16(packet[2:], uint16(32+len(encrypted)))
+	binary.BigEndian.PutUint32(packet[8:], c.deviceID)
+	binary.BigEndian.PutUint32(packet[12:], stamp)
+	copy(packet[16:], c.token)
+	packet = append(packet, encrypted...)
+	checksum := md5.Sum(packet)
+	copy(packet[16:], checksum[:])
+	return packet
+}
+
+// exchange writes a packet and returns the first response read before the deadline.
+func (c *client) exchange(conn net.Conn, packet []byte) ([]byte, error) {
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+	response := make([]byte, 4096)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+	if n < 32 || binary.BigEndian.Uint16(response) != 0x2131 {
+		return nil, errors.New("invalid response from miio device")
+	}
+	return response[:n], nil
+}
+
+// hello learns the device ID and the device's clock, which requests must be stamped with.
+func (c *client) hello(conn net.Conn) error {
+	packet := bytes.Repeat([]byte{0xff}, 32)
+	binary.BigEndian.PutUint16(packet, 0x2131)
+	binary.BigEndian.PutUint16(packet[2:], 32)
+
+	response, err := c.exchange(conn, packet)
+	if err != nil {
+		return err
+	}
+	c.deviceID = binary.BigEndian.Uint32(response[8:])
+	c.stamp = binary.BigEndian.Uint32(response[12:])
+	c.stampAt = time.Now()
+	return nil
+}
+
+// record records a JSON-RPC call that changes the device when ctx belongs to a dry run, reporting whether it should be skipped.
+func (c *client) record(ctx context.Context, method string, params any) bool {
+	return device.Record(ctx, device.Call{Method: "UDP", URL: "udp://" + c.host, Payload: map[string]any{"method": method, "params": params}})
+}
+
+// call sends a JSON-RPC call, decoding its result into result when provided. A handshake is made before every call as devices
+// drop sessions that have been idle for a while.
+func (c *client) call(method string, params any, result any) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conn, err := net.Dial("udp", c.host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+
+	if err := c.hello(conn); err != nil {
+		return err
+	}
+
+	c.id++
+	if params == nil {
+		params = []any{}
+	}
+	payload, err := json.Marshal(map[string]any{"id": c.id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+
+	stamp := c.stamp + uint32(time.Since(c.stampAt)/time.Second) + 1
+	response, err := c.exchange(conn, c.packet(payload, stamp))
+	if err != nil {
+		return err
+	}
+
+	checksum := append([]byte{}, response[16:32]...)
+	copy(response[16:], c.token)
+	if sum := md5.Sum(response); !bytes.Equal(sum[:], checksum) {
+		return errors.New("invalid checksum in miio response, check the token")
+	}
+
+	decrypted, err := c.decrypt(response[32:])
+	if err != nil {
+		return err
+	}
+
+	rpcResponse := struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}{}
+	// Some devices null terminate their responses
+	if err := json.Unmarshal(bytes.TrimRight(decrypted, "\x00"), &rpcResponse); err != nil {
+		return err
+	}
+	if rpcResponse.Error != nil {
+		return rpcResponse.Error
+	}
+	if rpcResponse.ID != c.id {
+		return fmt.Errorf("unexpected response id %d from miio device, expected %d", rpcResponse.ID, c.id)
+	}
+	if result != nil {
+		return json.Unmarshal(rpcResponse.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+// Package mode provides house wide modes such as away, which lower heating to a frost protection setpoint and suspend schedules until cleared.
+package mode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setpoint is a heating device whose target is lowered while the mode is active and restored once it is cleared.
+type setpoint struct {
+	URL   string `yaml:"url"`
+	Field string `yaml:"field"`
+	saved string
+}
+
+type status struct {
+	Active bool              `json:"active"`
+	Saved  map[string]string `json:"saved,omitempty"`
+}
+
+// mode represents a mode configuration with name, frost protection setpoint, heating devices and schedules to suspend.
+type mode struct {
+	Name        string      `yaml:"name"`
+	Timeout     uint        `yaml:"timeoutMs"`
+	FrostTarget string      `yaml:"frostTarget"`
+	Heating     []*setpoint `yaml:"heating"`
+	Schedules   []string    `yaml:"schedules"`
+	Base        base
+	active      bool
+	mutex       sync.Mutex
+}
+
+// base represents a list of modes
+type base struct {
+	Devices []*mode
+}
+
+type Device struct{}
+
+// DryRun lists the setpoints a mode would lower, without saving them or marking it active.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for modes based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts modes from config, defaulting the field each heating setpoint is written to, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+DEVICE:
+	for _, d := range config.Devices {
+		if d.Type != "mode" {
+			continue
+		}
+		mode := mode{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &mode); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if mode.Name == "" || mode.Timeout == 0 || (len(mode.Heating) == 0 && len(mode.Schedules) == 0) || (len(mode.Heating) > 0 && mode.FrostTarget == "") {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		for _, s := range mode.Heating {
+			if s.URL == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue DEVICE
+			}
+			if s.Field == "" {
+				s.Field = "temperature.target"
+			}
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + mode.Name,
+			Handler: mode.handler,
+		})
+
+		base.Devices = append(base.Devices, &mode)
+
+		logging.Log(logging.Info, "Found device \"%s\"", mode.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/mode" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/mode",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/mode/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// post sends a code and value to another restate endpoint, returning the response data.
+func (m *mode) post(ctx context.Context, url string, code string, value string) (any, error) {
+	action := device.Action{
+		URL:   url,
+		Code:  code,
+		Value: value,
+	}
+
+	response, httpCode, err := action.PostContext(ctx, m.Timeout)
+	if err == nil && httpCode != http.StatusOK {
+		err = fmt.Errorf("received status code %d from %s", httpCode, url)
+	}
+	if err != nil {
+		logging.Log(logging.Error, "Mode \"%s\" failed to send code \"%s\" to %s: %v", m.Name, code, url, err)
+		return nil, err
+	}
+	return response.Data, nil
+}
+
+// current returns the setpoint currently reported by a heating device's status.
+func (m *mode) current(ctx context.Context, s *setpoint) (string, error) {
+	data, err := m.post(ctx, s.URL, "status", "")
+	if err != nil {
+		return "", err
+	}
+
+	for _, key := range strings.Split(s.Field, ".") {
+		object, ok := data.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("field \"%s\" not found in status from %s", s.Field, s.URL)
+		}
+		if data, ok = object[key]; !ok {
+			return "", fmt.Errorf("field \"%s\" not found in status from %s", s.Field, s.URL)
+		}
+	}
+
+	value, ok := data.(float64)
+	if !ok {
+		return "", fmt.Errorf("field \"%s\" is not a number in status from %s", s.Field, s.URL)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64), nil
+}
+
+// activate saves the current setpoint of each heating device, lowers them to the frost target and disables schedules.
+// Devices whose setpoint cannot be read are still lowered, but are not restored when the mode is cleared. A dry run records the calls
+// without saving setpoints or activating the mode.
+func (m *mode) activate(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.active {
+		return nil
+	}
+
+	var errs []error
+	for _, s := range m.Heating {
+		saved, err := m.current(ctx, s)
+		if err != nil {
+			logging.Log(logging.Error, "Mode \"%s\" will not restore %s: %v", m.Name, s.URL, err)
+			errs = append(errs, err)
+		}
+		if !device.DryRunning(ctx) {
+			s.saved = saved
+		}
+
+		if _, err := m.post(ctx, s.URL, "target", m.FrostTarget); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, url := range m.Schedules {
+		if _, err := m.post(ctx, url, "disable", ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if device.DryRunning(ctx) {
+		return errors.Join(errs...)
+	}
+
+	m.active = true
+	logging.Log(logging.Info, "Mode \"%s\" activated", m.Name)
+	return errors.Join(errs...)
+}
+
+// deactivate restores the saved setpoint of each heating device and enables schedules, a dry run keeps the mode active.
+func (m *mode) deactivate(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.active {
+		return nil
+	}
+
+	var errs []error
+	for _, s := range m.Heating {
+		if s.saved == "" {
+			continue
+		}
+		if _, err := m.post(ctx, s.URL, "target", s.saved); err != nil {
+			errs = append(errs, err)
+		}
+		if !device.DryRunning(ctx) {
+			s.saved = ""
+		}
+	}
+
+	for _, url := range m.Schedules {
+		if _, err := m.post(ctx, url, "enable", ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if device.DryRunning(ctx) {
+		return errors.Join(errs...)
+	}
+
+	m.active = false
+	logging.Log(logging.Info, "Mode \"%s\" cleared", m.Name)
+	return errors.Join(errs...)
+}
+
+// status returns whether the mode is active and the setpoints that will be restored when it is cleared.
+func (m *mode) status() *status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	status := status{
+		Active: m.active,
+	}
+	for _, s := range m.Heating {
+		if s.saved == "" {
+			continue
+		}
+		if status.Saved == nil {
+			status.Saved = map[string]string{}
+		}
+		status.Saved[s.URL] = s.saved
+	}
+	return &status
+}
+
+// getCodes returns a list of control codes for a mode.
+func getCodes() []string {
+	return []string{"status", "on", "off"}
+}
+
+// Handler is the HTTP handler for mode control.
+func (m *mode) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+	var err error
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "status":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", m.status())
+		return
+	case "on":
+		err = m.activate(r.Context())
+	case "off":
+		err = m.deactivate(r.Context())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// getDeviceNames returns the names of all modes in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured modes.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
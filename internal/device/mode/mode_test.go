@@ -0,0 +1,273 @@
+package mode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read mode input")
+	}
+
+	modeConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &modeConfig); err != nil {
+		t.Fatalf("Could not read mode input")
+	}
+	return &modeConfig
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/modeConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/modeConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/modeConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/modeConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/modeConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		data             string
+		expectedCode     int
+		expectedBody     string
+		expectedRequests []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/mode/away",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","on","off"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/mode/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["away","holiday"]}`,
+		},
+		{
+			name:             "on_lowers_setpoints_and_disables_schedules",
+			method:           "POST",
+			url:              "/mode/away",
+			data:             `{"code":"on"}`,
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{"/hallway status:", "/hallway target:7", "/thermostat status:", "/thermostat target:7", "/heating disable:"},
+		},
+		{
+			name:             "on_when_active_is_noop",
+			method:           "POST",
+			url:              "/mode/away?code=on",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{},
+		},
+		{
+			name:         "status_shows_saved_setpoints",
+			method:       "POST",
+			url:          "/mode/away?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"active":true,"saved":{"SERVER/hallway":"21.5","SERVER/thermostat":"19"}}}`,
+		},
+		{
+			name:             "off_restores_setpoints_and_enables_schedules",
+			method:           "POST",
+			url:              "/mode/away?code=off",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{"/hallway target:21.5", "/thermostat target:19", "/heating enable:"},
+		},
+		{
+			name:         "status_after_off",
+			method:       "POST",
+			url:          "/mode/away?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"active":false}}`,
+		},
+		{
+			name:             "on_continues_past_failure",
+			method:           "POST",
+			url:              "/mode/holiday?code=on",
+			expectedCode:     500,
+			expectedBody:     `{"version":1,"message":"Internal Server Error"}`,
+			expectedRequests: []string{"/lights disable:"},
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/mode/away?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/mode/away",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/mode/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	var mutex sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		received = append(received, r.URL.Path+" "+request.Code+":"+request.Value.String())
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/lights":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"version":1,"message":"Internal Server Error"}`))
+		case r.URL.Path == "/hallway" && request.Code == "status":
+			w.Write([]byte(`{"version":1,"message":"OK","data":{"onoff":1,"temperature":{"current":20,"target":21.5,"unit":"C"}}}`))
+		case r.URL.Path == "/thermostat" && request.Code == "status":
+			w.Write([]byte(`{"version":1,"message":"OK","data":{"onoff":1,"temperature":{"current":19,"target":22}}}`))
+		default:
+			w.Write([]byte(`{"version":1,"message":"OK"}`))
+		}
+	}))
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/modeConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	rewrite := func(url string) string {
+		return server.URL + url[strings.LastIndex(url, "/"):]
+	}
+	for _, d := range base.Devices {
+		for _, s := range d.Heating {
+			s.URL = rewrite(s.URL)
+		}
+		for i, s := range d.Schedules {
+			d.Schedules[i] = rewrite(s)
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = []string{}
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			expectedBody := strings.ReplaceAll(tc.expectedBody, "SERVER", server.URL)
+			if recorder.Body.String() != expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedRequests != nil {
+				assert.Equal(t, tc.expectedRequests, received)
+			}
+		})
+	}
+
+	t.Run("dry_run_records_without_activating", func(t *testing.T) {
+		received = []string{}
+		away := base.Devices[0]
+		ctx, dryRun := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/mode/away?code=on", nil).WithContext(ctx))
+
+		// Setpoints are still read, but the frost target and schedule calls are only recorded
+		for _, r := range received {
+			assert.Contains(t, r, " status:")
+		}
+		assert.NotEmpty(t, dryRun.Calls())
+		assert.False(t, away.status().Active)
+		for _, s := range away.Heating {
+			assert.Empty(t, s.saved)
+		}
+	})
+}
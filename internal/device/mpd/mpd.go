@@ -0,0 +1,377 @@
+// Package mpd provides control of Music Player Daemon instances, playing, pausing and loading stored playlists.
+package mpd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// request allows playlist names as values, as well as volumes
+type request struct {
+	Code  string `json:"code"`
+	Value string `json:"value,omitempty"`
+}
+
+// song is the representation of the current song returned by the status code.
+type song struct {
+	File   string `json:"file"`
+	Artist string `json:"artist,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Album  string `json:"album,omitempty"`
+}
+
+// status is the representation of a player returned by the status code.
+type status struct {
+	State    string   `json:"state"`
+	Volume   *int     `json:"volume,omitempty"`
+	Elapsed  *float64 `json:"elapsed,omitempty"`
+	Duration *float64 `json:"duration,omitempty"`
+	Playlist int      `json:"playlist"`
+	Song     *song    `json:"song,omitempty"`
+}
+
+// mpd represents a Music Player Daemon configuration with name, address and password.
+type mpd struct {
+	Name     string        `yaml:"name"`
+	Timeout  uint          `yaml:"timeoutMs"`
+	Host     string        `yaml:"host"`
+	Password config.Secret `yaml:"password"`
+	Base     base
+	mutex    sync.Mutex
+}
+
+// base represents a list of players
+type base struct {
+	Devices []*mpd
+}
+
+type Device struct{}
+
+// DryRun previews player commands, status is still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// ackError is an error returned by the daemon in response to a command.
+type ackError struct {
+	message string
+}
+
+func (e *ackError) Error() string {
+	return "mpd returned " + e.message
+}
+
+// Routes generates routes for players based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts MPD players from config, adding the default port to hosts without one, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "mpd" {
+			continue
+		}
+		mpd := mpd{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &mpd); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if mpd.Name == "" || mpd.Timeout == 0 || mpd.Host == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(mpd.Host); err != nil {
+			mpd.Host = net.JoinHostPort(mpd.Host, "6600")
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + mpd.Name,
+			Handler: mpd.handler,
+		})
+
+		base.Devices = append(base.Devices, &mpd)
+
+		logging.Log(logging.Info, "Found device \"%s\"", mpd.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/mpd" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/mpd",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/mpd/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// getCodes returns a list of control codes for a player.
+func getCodes() []string {
+	return []string{"status", "play", "pause", "toggle", "stop", "next", "previous", "volume", "playlist"}
+}
+
+// quote quotes a command argument.
+func quote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// send writes a command and reads its response into key value pairs, in the order received.
+func send(conn net.Conn, reader *bufio.Reader, command string) ([][2]string, error) {
+	if _, err := conn.Write([]byte(command + "\n")); err != nil {
+		return nil, err
+	}
+
+	pairs := [][2]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if line == "OK" {
+			return pairs, nil
+		}
+		if strings.HasPrefix(line, "ACK ") {
+			return nil, &ackError{message: strings.TrimPrefix(line, "ACK ")}
+		}
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			pairs = append(pairs, [2]string{key, value})
+		}
+	}
+}
+
+// run connects to the daemon, authenticates and runs commands in a command list, returning the response of the last command.
+// Commands are recorded rather than run during a dry run.
+func (m *mpd) run(ctx context.Context, commands ...string) ([][2]string, error) {
+	if device.Record(ctx, device.Call{Method: "TCP", URL: "tcp://" + m.Host, Payload: strings.Join(commands, "\n")}) {
+		return nil, nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	timeout := time.Duration(m.Timeout) * time.Millisecond
+	conn, err := net.DialTimeout("tcp", m.Host, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	greeting, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		return nil, fmt.Errorf("unexpected greeting from mpd: %s", strings.TrimSpace(greeting))
+	}
+
+	if m.Password != "" {
+		if _, err := send(conn, reader, "password "+quote(m.Password.Value())); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(commands) == 1 {
+		return send(conn, reader, commands[0])
+	}
+
+	// Commands in a list are run together, stopping at the first to fail
+	return send(conn, reader, "command_list_begin\n"+strings.Join(commands, "\n")+"\ncommand_list_end")
+}
+
+// status returns the state of the player and its current song.
+func (m *mpd) status(ctx context.Context) (*status, error) {
+	pairs, err := m.run(device.Read(ctx), "command_list_ok_begin\nstatus\ncurrentsong\ncommand_list_end")
+	if err != nil {
+		return nil, err
+	}
+
+	status := status{}
+	current := song{}
+	for _, p := range pairs {
+		switch p[0] {
+		case "state":
+			status.State = p[1]
+		case "volume":
+			// Players without a mixer report -1
+			if v, err := strconv.Atoi(p[1]); err == nil && v >= 0 {
+				status.Volume = &v
+			}
+		case "elapsed":
+			if v, err := strconv.ParseFloat(p[1], 64); err == nil {
+				status.Elapsed = &v
+			}
+		case "duration":
+			if v, err := strconv.ParseFloat(p[1], 64); err == nil {
+				status.Duration = &v
+			}
+		case "playlistlength":
+			status.Playlist, _ = strconv.Atoi(p[1])
+		case "file":
+			current.File = p[1]
+		case "Artist":
+			current.Artist = p[1]
+		case "Title":
+			current.Title = p[1]
+		case "Album":
+			current.Album = p[1]
+		}
+	}
+	if current.File != "" {
+		status.Song = &current
+	}
+	return &status, nil
+}
+
+// Handler is the HTTP handler for player control.
+func (m *mpd) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = m.status(r.Context())
+	case "play", "stop", "next", "previous":
+		_, err = m.run(r.Context(), request.Code)
+	case "pause":
+		_, err = m.run(r.Context(), "pause 1")
+	case "toggle":
+		// pause without an argument toggles between playing and paused, and does nothing when stopped
+		var s *status
+		if s, err = m.status(r.Context()); err == nil {
+			if s.State == "stop" {
+				_, err = m.run(r.Context(), "play")
+			} else {
+				_, err = m.run(r.Context(), "pause")
+			}
+		}
+	case "volume":
+		volume, convErr := strconv.Atoi(request.Value)
+		if convErr != nil || volume < 0 || volume > 100 {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		_, err = m.run(r.Context(), "setvol "+strconv.Itoa(volume))
+	case "playlist":
+		// Replaces the queue with a stored playlist and starts playing it
+		if request.Value == "" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		_, err = m.run(r.Context(), "clear", "load "+quote(request.Value), "play")
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	// Unknown playlists are the only errors caused by the request
+	var ack *ackError
+	if request.Code == "playlist" && errors.As(err, &ack) && strings.Contains(ack.message, "No such playlist") {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all players in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured players.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
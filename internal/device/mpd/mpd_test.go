@@ -0,0 +1,425 @@
+package mpd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read mpd input")
+	}
+
+	mpdConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &mpdConfig); err != nil {
+		t.Fatalf("Could not read mpd input")
+	}
+	return &mpdConfig
+}
+
+// setupMPDServer emulates a password protected daemon with a stored playlist, recording the commands sent to it.
+func setupMPDServer(t *testing.T, mutex *sync.Mutex, commands *[]string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+
+	state := "stop"
+	volume := 50
+	queue := []string{}
+	playlists := map[string][]string{"Party Mix": {"party/one.flac", "party/two.flac"}}
+
+	// run runs a single command, returning its response or an ACK
+	run := func(command string, authenticated bool) (string, bool) {
+		name, arg, _ := strings.Cut(command, " ")
+		arg = strings.Trim(arg, `"`)
+		if name != "password" && !authenticated {
+			return fmt.Sprintf("ACK [4@0] {%s} you don't have permission for \"%s\"\n", name, name), false
+		}
+		*commands = append(*commands, command)
+
+		switch name {
+		case "status":
+			response := fmt.Sprintf("volume: %d\nstate: %s\nplaylistlength: %d\n", volume, state, len(queue))
+			if state != "stop" {
+				response += "elapsed: 12.500\nduration: 180.000\n"
+			}
+			return response, true
+		case "currentsong":
+			if state == "stop" || len(queue) == 0 {
+				return "", true
+			}
+			return "file: " + queue[0] + "\nArtist: The Band\nTitle: One\n", true
+		case "play":
+			if len(queue) > 0 {
+				state = "play"
+			}
+		case "pause":
+			switch {
+			case arg == "1" && state == "play":
+				state = "pause"
+			case arg == "" && state == "play":
+				state = "pause"
+			case arg == "" && state == "pause":
+				state = "play"
+			}
+		case "stop":
+			state = "stop"
+		case "setvol":
+			fmt.Sscan(arg, &volume)
+		case "clear":
+			queue = []string{}
+			state = "stop"
+		case "load":
+			songs, ok := playlists[strings.ReplaceAll(arg, `\"`, `"`)]
+			if !ok {
+				return "ACK [50@0] {load} No such playlist\n", false
+			}
+			queue = append(queue, songs...)
+		case "next", "previous", "password":
+		default:
+			return fmt.Sprintf("ACK [5@0] {} unknown command \"%s\"\n", name), false
+		}
+		return "", true
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte("OK MPD 0.23.5\n"))
+				reader := bufio.NewReader(conn)
+				authenticated := false
+				list := []string{}
+				listOK := false
+				inList := false
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSuffix(line, "\n")
+
+					mutex.Lock()
+					switch {
+					case line == "command_list_begin" || line == "command_list_ok_begin":
+						inList, listOK, list = true, line == "command_list_ok_begin", []string{}
+					case line == "command_list_end":
+						inList = false
+						response := ""
+						for _, c := range list {
+							r, ok := run(c, authenticated)
+							if !ok {
+								response = r
+								break
+							}
+							response += r
+							if listOK {
+								response += "list_OK\n"
+							}
+						}
+						if !strings.HasPrefix(response, "ACK") {
+							response += "OK\n"
+						}
+						conn.Write([]byte(response))
+					case inList:
+						list = append(list, line)
+					default:
+						response, ok := run(line, authenticated)
+						if strings.HasPrefix(line, "password ") {
+							authenticated = line == `password "mpd-password"`
+							if !authenticated {
+								response, ok = "ACK [3@0] {password} incorrect password\n", false
+							}
+						}
+						if ok {
+							response += "OK\n"
+						}
+						conn.Write([]byte(response))
+					}
+					mutex.Unlock()
+				}
+			}(conn)
+		}
+	}()
+	return listener
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/mpdConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/mpdConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/mpdConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/mpdConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/mpdConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		data             string
+		expectedCode     int
+		expectedBody     string
+		expectedCommands []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/mpd/lounge",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","play","pause","toggle","stop","next","previous","volume","playlist"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/mpd/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lounge","office"]}`,
+		},
+		{
+			name:         "status_stopped",
+			method:       "POST",
+			url:          "/mpd/lounge?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"stop","volume":50,"playlist":0}}`,
+		},
+		{
+			name:             "playlist",
+			method:           "POST",
+			url:              "/mpd/lounge",
+			data:             `{"code":"playlist","value":"Party Mix"}`,
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedCommands: []string{`password "mpd-password"`, "clear", `load "Party Mix"`, "play"},
+		},
+		{
+			name:         "status_playing",
+			method:       "POST",
+			url:          "/mpd/lounge?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"play","volume":50,"elapsed":12.5,"duration":180,"playlist":2,"song":{"file":"party/one.flac","artist":"The Band","title":"One"}}}`,
+		},
+		{
+			name:             "volume",
+			method:           "POST",
+			url:              "/mpd/lounge?code=volume&value=80",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedCommands: []string{`password "mpd-password"`, "setvol 80"},
+		},
+		{
+			name:             "pause",
+			method:           "POST",
+			url:              "/mpd/lounge?code=pause",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedCommands: []string{`password "mpd-password"`, "pause 1"},
+		},
+		{
+			name:             "toggle_paused",
+			method:           "POST",
+			url:              "/mpd/lounge?code=toggle",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedCommands: []string{`password "mpd-password"`, "status", "currentsong", `password "mpd-password"`, "pause"},
+		},
+		{
+			name:             "stop",
+			method:           "POST",
+			url:              "/mpd/lounge?code=stop",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedCommands: []string{`password "mpd-password"`, "stop"},
+		},
+		{
+			name:             "toggle_stopped",
+			method:           "POST",
+			url:              "/mpd/lounge?code=toggle",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedCommands: []string{`password "mpd-password"`, "status", "currentsong", `password "mpd-password"`, "play"},
+		},
+		{
+			name:         "unknown_playlist",
+			method:       "POST",
+			url:          "/mpd/lounge?code=playlist&value=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "playlist_without_value",
+			method:       "POST",
+			url:          "/mpd/lounge?code=playlist",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "volume_out_of_range",
+			method:       "POST",
+			url:          "/mpd/lounge?code=volume&value=-1",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "wrong_password",
+			method:       "POST",
+			url:          "/mpd/office?code=status",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/mpd/lounge?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/mpd/lounge",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/mpd/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	mutex := sync.Mutex{}
+	commands := []string{}
+	server := setupMPDServer(t, &mutex, &commands)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/mpdConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	// The office player connects without a password
+	for _, d := range base.Devices {
+		d.Host = server.Addr().String()
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mutex.Lock()
+			commands = commands[:0]
+			mutex.Unlock()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if tc.expectedCommands != nil {
+				assert.Equal(t, tc.expectedCommands, commands)
+			}
+		})
+	}
+
+	t.Run("dry_run_playlist", func(t *testing.T) {
+		mutex.Lock()
+		commands = commands[:0]
+		mutex.Unlock()
+		ctx, dryRun := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/mpd/office?code=playlist&value=Morning", nil).WithContext(ctx))
+		assert.Equal(t, 200, recorder.Code)
+
+		mutex.Lock()
+		assert.Empty(t, commands)
+		mutex.Unlock()
+		assert.Equal(t, []device.Call{{Method: "TCP", URL: "tcp://" + server.Addr().String(), Payload: "clear\nload \"Morning\"\nplay"}}, dryRun.Calls())
+	})
+}
@@ -0,0 +1,300 @@
+// Package network provides control of UniFi controllers and OpenWrt routers, toggling guest Wi-Fi, rebooting access points, blocking
+// clients and reporting connected client counts.
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driver is implemented by each supported network controller.
+type driver interface {
+	status() (*status, error)
+	guestEnabled() (bool, error)
+	setGuest(ctx context.Context, enabled bool) error
+	reboot(ctx context.Context, mac string) error
+	block(ctx context.Context, mac string, blocked bool) error
+}
+
+// status is the representation of a network returned by the status code.
+type status struct {
+	Clients   int   `json:"clients"`
+	Wireless  *int  `json:"wireless,omitempty"`
+	Wired     *int  `json:"wired,omitempty"`
+	Guests    *int  `json:"guests,omitempty"`
+	GuestWifi *bool `json:"guestWifi,omitempty"`
+}
+
+// request is the network equivalent of device.Request, values are MAC addresses rather than numbers.
+type request struct {
+	Code  string `json:"code"`
+	Value string `json:"value,omitempty"`
+}
+
+// network represents a network configuration with name, driver and driver specific parameters.
+type network struct {
+	Name    string   `yaml:"name"`
+	Timeout uint     `yaml:"timeoutMs"`
+	Driver  string   `yaml:"driver"`
+	Unifi   *unifi   `yaml:"unifi"`
+	OpenWrt *openwrt `yaml:"openwrt"`
+	Base    base
+	driver  driver
+	guest   bool
+}
+
+// base represents a list of networks
+type base struct {
+	Devices []*network
+}
+
+type Device struct{}
+
+// DryRun previews guest Wi-Fi, reboot and block changes, clients and settings are still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for networks based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts UniFi and OpenWrt networks from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "network" {
+			continue
+		}
+		network := network{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &network); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if network.Name == "" || network.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch network.Driver {
+		case "unifi":
+			if network.Unifi == nil || network.Unifi.URL == "" || network.Unifi.Username == "" || network.Unifi.Password == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if network.Unifi.Site == "" {
+				network.Unifi.Site = "default"
+			}
+			network.Unifi.init(network.Timeout)
+			network.driver = network.Unifi
+			network.guest = true
+		case "openwrt":
+			if network.OpenWrt == nil || network.OpenWrt.URL == "" || network.OpenWrt.Username == "" || len(network.OpenWrt.Interfaces) == 0 {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			network.OpenWrt.timeout = network.Timeout
+			network.driver = network.OpenWrt
+			network.guest = network.OpenWrt.GuestSection != ""
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'unifi' or 'openwrt'")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + network.Name,
+			Handler: network.handler,
+		})
+
+		base.Devices = append(base.Devices, &network)
+
+		logging.Log(logging.Info, "Found device \"%s\"", network.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/network" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/network",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/network/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// getCodes returns a list of control codes for a network, guest is only offered when a guest network is known.
+func (n *network) getCodes() []string {
+	codes := []string{"status", "reboot", "block", "unblock"}
+	if n.guest {
+		codes = append(codes, "guest")
+	}
+	return codes
+}
+
+// status returns the client counts of the network along with the state of its guest Wi-Fi.
+func (n *network) status() (*status, error) {
+	status, err := n.driver.status()
+	if err != nil {
+		return nil, err
+	}
+	if n.guest {
+		enabled, err := n.driver.guestEnabled()
+		if err != nil {
+			return nil, err
+		}
+		status.GuestWifi = &enabled
+	}
+	return status, nil
+}
+
+// guestWifi enables guest Wi-Fi for a value of 1, disables it for 0 and toggles it when no value is given.
+func (n *network) guestWifi(ctx context.Context, value string) error {
+	var enabled bool
+	switch value {
+	case "0":
+	case "1":
+		enabled = true
+	case "":
+		current, err := n.driver.guestEnabled()
+		if err != nil {
+			return err
+		}
+		enabled = !current
+	}
+	return n.driver.setGuest(ctx, enabled)
+}
+
+// parseMAC returns a MAC address in the lower case, colon separated form used by both controllers, or an empty string if it is invalid.
+func parseMAC(value string) string {
+	mac, err := net.ParseMAC(value)
+	if err != nil || len(mac) != 6 {
+		return ""
+	}
+	return strings.ToLower(mac.String())
+}
+
+// Handler is the HTTP handler for network control.
+func (n *network) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", n.getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !slices.Contains(n.getCodes(), request.Code) {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	// UniFi controllers reboot the access point with the given MAC address, OpenWrt routers reboot themselves
+	mac := parseMAC(request.Value)
+	switch {
+	case (request.Code == "block" || request.Code == "unblock") && mac == "",
+		request.Code == "reboot" && n.Unifi != nil && mac == "",
+		request.Code == "guest" && !slices.Contains([]string{"", "0", "1"}, request.Value):
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = n.status()
+	case "guest":
+		err = n.guestWifi(r.Context(), request.Value)
+	case "reboot":
+		err = n.driver.reboot(r.Context(), mac)
+	case "block":
+		err = n.driver.block(r.Context(), mac, true)
+	case "unblock":
+		err = n.driver.block(r.Context(), mac, false)
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all networks in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured networks.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
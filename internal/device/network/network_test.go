@@ -0,0 +1,421 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read network input")
+	}
+
+	networkConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &networkConfig); err != nil {
+		t.Fatalf("Could not read network input")
+	}
+	return &networkConfig
+}
+
+// setupUnifiServer emulates a standalone UniFi Network controller with three clients and a guest wlan, recording the commands sent to it.
+func setupUnifiServer(t *testing.T, commands *[]string) *httptest.Server {
+	guest := true
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/api/login" {
+			body := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["username"] != "admin" || body["password"] != "unifi-password" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"meta":{"rc":"error","msg":"api.err.Invalid"},"data":[]}`))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "unifises", Value: "session", Path: "/"})
+			w.Write([]byte(`{"meta":{"rc":"ok"},"data":[]}`))
+			return
+		}
+
+		if cookie, err := r.Cookie("unifises"); err != nil || cookie.Value != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"meta":{"rc":"error","msg":"api.err.LoginRequired"},"data":[]}`))
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/s/default/stat/sta":
+			w.Write([]byte(`{"meta":{"rc":"ok"},"data":[{"mac":"00:11:22:33:44:55","is_wired":true},{"mac":"00:11:22:33:44:56","is_wired":false},{"mac":"00:11:22:33:44:57","is_wired":false,"is_guest":true}]}`))
+		case "GET /api/s/default/rest/wlanconf":
+			json.NewEncoder(w).Encode(map[string]any{
+				"meta": map[string]string{"rc": "ok"},
+				"data": []map[string]any{
+					{"_id": "wlan1", "name": "Home", "enabled": true, "is_guest": false},
+					{"_id": "wlan2", "name": "Guests", "enabled": guest, "is_guest": true},
+				},
+			})
+		case "PUT /api/s/default/rest/wlanconf/wlan2":
+			body := map[string]bool{}
+			json.NewDecoder(r.Body).Decode(&body)
+			guest = body["enabled"]
+			w.Write([]byte(`{"meta":{"rc":"ok"},"data":[]}`))
+		case "POST /api/s/default/cmd/devmgr", "POST /api/s/default/cmd/stamgr":
+			body := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&body)
+			*commands = append(*commands, body["cmd"]+" "+body["mac"])
+			w.Write([]byte(`{"meta":{"rc":"ok"},"data":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"meta":{"rc":"error","msg":"api.err.NotFound"},"data":[]}`))
+		}
+	}))
+}
+
+// setupUbusServer emulates ubus on an OpenWrt router with two access point interfaces, recording the calls made.
+func setupUbusServer(t *testing.T, calls *[]string) *httptest.Server {
+	sections := map[string]map[string]any{
+		"default_radio0": {"maclist": []string{"00:11:22:33:44:58"}},
+		"default_radio1": {},
+		"guest":          {"disabled": "1"},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := ubusRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("Could not parse request body")
+		}
+		session, _ := request.Params[0].(string)
+		object, _ := request.Params[1].(string)
+		method, _ := request.Params[2].(string)
+		args, _ := request.Params[3].(map[string]any)
+
+		result := func(data any) {
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": []any{0, data}})
+		}
+
+		if object == "session" && method == "login" {
+			if args["username"] != "root" || args["password"] != "openwrt-password" {
+				json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": []any{ubusPermissionDenied}})
+				return
+			}
+			result(map[string]string{"ubus_rpc_session": "session"})
+			return
+		}
+		if session != "session" {
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "error": map[string]any{"code": -32002, "message": "Access denied"}})
+			return
+		}
+
+		*calls = append(*calls, object+" "+method)
+		switch object + " " + method {
+		case "hostapd.phy0-ap0 get_clients":
+			result(map[string]any{"clients": map[string]any{"00:11:22:33:44:55": map[string]any{}, "00:11:22:33:44:56": map[string]any{}}})
+		case "hostapd.phy1-ap0 get_clients":
+			result(map[string]any{"clients": map[string]any{"00:11:22:33:44:57": map[string]any{}}})
+		case "uci get":
+			result(map[string]any{"values": sections[args["section"].(string)]})
+		case "uci set":
+			for k, v := range args["values"].(map[string]any) {
+				sections[args["section"].(string)][k] = v
+			}
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": []any{0}})
+		case "uci commit", "system reboot", "hostapd.phy0-ap0 del_client", "hostapd.phy1-ap0 del_client":
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": []any{0}})
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "error": map[string]any{"code": -32000, "message": "Object not found"}})
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/networkConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/networkConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/networkConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/networkConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/networkConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		data          string
+		expectedCode  int
+		expectedBody  string
+		expectedCalls []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/network/unifi",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","reboot","block","unblock","guest"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/network/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["unifi","openwrt"]}`,
+		},
+		{
+			name:         "unifi_status",
+			method:       "POST",
+			url:          "/network/unifi?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"clients":3,"wireless":2,"wired":1,"guests":1,"guestWifi":true}}`,
+		},
+		{
+			name:         "unifi_guest_toggle",
+			method:       "POST",
+			url:          "/network/unifi?code=guest",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "unifi_status_after_guest_toggle",
+			method:       "POST",
+			url:          "/network/unifi?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"clients":3,"wireless":2,"wired":1,"guests":1,"guestWifi":false}}`,
+		},
+		{
+			name:          "unifi_reboot",
+			method:        "POST",
+			url:           "/network/unifi",
+			data:          `{"code":"reboot","value":"F0:9F:C2:00:00:01"}`,
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{"restart f0:9f:c2:00:00:01"},
+		},
+		{
+			name:         "unifi_reboot_without_mac",
+			method:       "POST",
+			url:          "/network/unifi?code=reboot",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:          "unifi_block",
+			method:        "POST",
+			url:           "/network/unifi?code=block&value=00-11-22-33-44-57",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{"block-sta 00:11:22:33:44:57"},
+		},
+		{
+			name:         "unifi_guest_invalid_value",
+			method:       "POST",
+			url:          "/network/unifi?code=guest&value=2",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:          "openwrt_status",
+			method:        "POST",
+			url:           "/network/openwrt?code=status",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK","data":{"clients":3,"wireless":3,"guestWifi":false}}`,
+			expectedCalls: []string{"hostapd.phy0-ap0 get_clients", "hostapd.phy1-ap0 get_clients", "uci get"},
+		},
+		{
+			name:          "openwrt_guest_on",
+			method:        "POST",
+			url:           "/network/openwrt?code=guest&value=1",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{"uci set", "uci commit"},
+		},
+		{
+			name:          "openwrt_block",
+			method:        "POST",
+			url:           "/network/openwrt?code=block&value=00:11:22:33:44:57",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{"uci get", "uci set", "uci get", "uci set", "uci commit", "hostapd.phy0-ap0 del_client", "hostapd.phy1-ap0 del_client"},
+		},
+		{
+			name:          "openwrt_unblock",
+			method:        "POST",
+			url:           "/network/openwrt?code=unblock&value=00:11:22:33:44:58",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{"uci get", "uci set", "uci get", "uci set", "uci commit"},
+		},
+		{
+			name:          "openwrt_reboot",
+			method:        "POST",
+			url:           "/network/openwrt?code=reboot",
+			expectedCode:  200,
+			expectedBody:  `{"version":1,"message":"OK"}`,
+			expectedCalls: []string{"system reboot"},
+		},
+		{
+			name:         "block_invalid_mac",
+			method:       "POST",
+			url:          "/network/openwrt?code=block&value=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/network/unifi?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/network/unifi",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/network/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	calls := []string{}
+	unifiServer := setupUnifiServer(t, &calls)
+	defer unifiServer.Close()
+	ubusServer := setupUbusServer(t, &calls)
+	defer ubusServer.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/networkConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		if d.Unifi != nil {
+			d.Unifi.URL = unifiServer.URL
+		}
+		if d.OpenWrt != nil {
+			d.OpenWrt.URL = ubusServer.URL
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls = calls[:0]
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedCalls != nil {
+				assert.Equal(t, tc.expectedCalls, calls)
+			}
+		})
+	}
+
+	t.Run("dry_run_block", func(t *testing.T) {
+		calls = calls[:0]
+		ctx, dryRun := device.WithDryRun(context.Background())
+		for _, url := range []string{"/network/unifi?code=block&value=00:11:22:33:44:59", "/network/openwrt?code=reboot"} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil).WithContext(ctx))
+			assert.Equal(t, 200, recorder.Code, url)
+		}
+
+		assert.Empty(t, calls)
+		assert.Equal(t, []device.Call{
+			{Method: "POST", URL: unifiServer.URL + "/api/s/default/cmd/stamgr", Payload: map[string]any{"cmd": "block-sta", "mac": "00:11:22:33:44:59"}},
+			{Method: "POST", URL: ubusServer.URL, Payload: map[string]any{"object": "system", "method": "reboot", "args": nil}},
+		}, dryRun.Calls())
+	})
+
+	t.Run("openwrt_maclists", func(t *testing.T) {
+		o := base.Devices[1].OpenWrt
+		for _, name := range o.Sections {
+			section, err := o.section(name)
+			assert.NoError(t, err)
+			assert.True(t, slices.Contains(section.Values.Maclist, "00:11:22:33:44:57"))
+			assert.False(t, slices.Contains(section.Values.Maclist, "00:11:22:33:44:58"))
+		}
+	})
+}
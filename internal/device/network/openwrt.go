@@ -0,0 +1,255 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Session used to log in to ubus
+const ubusAnonymous = "00000000000000000000000000000000"
+
+// ubus status codes of interest, see ubus_msg_status in libubus
+const (
+	ubusOK               = 0
+	ubusPermissionDenied = 6
+)
+
+// openwrt drives an OpenWrt router or access point through ubus over HTTP, as served by uhttpd-mod-ubus.
+type openwrt struct {
+	URL          string        `yaml:"url"`
+	Username     string        `yaml:"username"`
+	Password     config.Secret `yaml:"password"`
+	Interfaces   []string      `yaml:"interfaces"`
+	Sections     []string      `yaml:"sections"`
+	GuestSection string        `yaml:"guestSection"`
+	timeout      uint
+	session      string
+	mutex        sync.Mutex
+}
+
+// ubusRequest is a JSON-RPC call of a ubus object's method.
+type ubusRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+// ubusResponse carries either a result of a ubus status code followed by the returned data, or a JSON-RPC error.
+type ubusResponse struct {
+	Result []json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// uciSection represents the values of a uci section.
+type uciSection struct {
+	Values struct {
+		Disabled string   `json:"disabled"`
+		Maclist  []string `json:"maclist"`
+	} `json:"values"`
+}
+
+// errAccessDenied is returned for calls rejected because the session has expired or lacks permission.
+var errAccessDenied = errors.New("ubus access denied")
+
+// send makes a single ubus call with a session, decoding the returned data into v when provided.
+func (o *openwrt) send(session string, object string, method string, args any, response any) error {
+	client := &http.Client{
+		Timeout: time.Duration(o.timeout) * time.Millisecond,
+	}
+
+	if args == nil {
+		args = map[string]any{}
+	}
+	body, err := json.Marshal(ubusRequest{JSONRPC: "2.0", ID: 1, Method: "call", Params: []any{session, object, method, args}})
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(o.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ubus returned status code %d for %s %s", resp.StatusCode, object, method)
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	rpc := ubusResponse{}
+	if err := json.Unmarshal(responseBytes, &rpc); err != nil {
+		return err
+	}
+	if rpc.Error != nil {
+		// -32002 is returned for unknown or expired sessions
+		if rpc.Error.Code == -32002 {
+			return errAccessDenied
+		}
+		return fmt.Errorf("ubus returned \"%s\" for %s %s", rpc.Error.Message, object, method)
+	}
+	if len(rpc.Result) == 0 {
+		return fmt.Errorf("ubus returned no result for %s %s", object, method)
+	}
+
+	var code int
+	if err := json.Unmarshal(rpc.Result[0], &code); err != nil {
+		return err
+	}
+	if code == ubusPermissionDenied {
+		return errAccessDenied
+	} else if code != ubusOK {
+		return fmt.Errorf("ubus returned status %d for %s %s", code, object, method)
+	}
+
+	if response == nil || len(rpc.Result) < 2 {
+		return nil
+	}
+	return json.Unmarshal(rpc.Result[1], response)
+}
+
+// login starts a new ubus session.
+func (o *openwrt) login() error {
+	response := struct {
+		Session string `json:"ubus_rpc_session"`
+	}{}
+	err := o.send(ubusAnonymous, "session", "login", map[string]string{"username": o.Username, "password": o.Password.Value()}, &response)
+	if err != nil {
+		return err
+	}
+	if response.Session == "" {
+		return errors.New("ubus login returned no session")
+	}
+	o.session = response.Session
+	return nil
+}
+
+// call makes a ubus call, logging in first if there is no session or it has expired. Calls are recorded rather than made when ctx
+// belongs to a dry run, so reads pass a context that does not.
+func (o *openwrt) call(ctx context.Context, object string, method string, args any, response any) error {
+	if device.Record(ctx, device.Call{Method: "POST", URL: o.URL, Payload: map[string]any{"object": object, "method": method, "args": args}}) {
+		return nil
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.session != "" {
+		err := o.send(o.session, object, method, args, response)
+		if !errors.Is(err, errAccessDenied) {
+			return err
+		}
+	}
+
+	if err := o.login(); err != nil {
+		return err
+	}
+	return o.send(o.session, object, method, args, response)
+}
+
+func (o *openwrt) status() (*status, error) {
+	count := 0
+	for _, iface := range o.Interfaces {
+		response := struct {
+			Clients map[string]json.RawMessage `json:"clients"`
+		}{}
+		if err := o.call(context.Background(), "hostapd."+iface, "get_clients", nil, &response); err != nil {
+			return nil, err
+		}
+		count += len(response.Clients)
+	}
+	return &status{Clients: count, Wireless: &count}, nil
+}
+
+// section returns the values of a wireless uci section.
+func (o *openwrt) section(name string) (*uciSection, error) {
+	section := uciSection{}
+	if err := o.call(context.Background(), "uci", "get", map[string]string{"config": "wireless", "section": name}, &section); err != nil {
+		return nil, err
+	}
+	return &section, nil
+}
+
+func (o *openwrt) guestEnabled() (bool, error) {
+	section, err := o.section(o.GuestSection)
+	if err != nil {
+		return false, err
+	}
+	return section.Values.Disabled != "1", nil
+}
+
+// commit commits changes to the wireless config, which reloads Wi-Fi.
+func (o *openwrt) commit(ctx context.Context) error {
+	return o.call(ctx, "uci", "commit", map[string]string{"config": "wireless"}, nil)
+}
+
+func (o *openwrt) setGuest(ctx context.Context, enabled bool) error {
+	disabled := "1"
+	if enabled {
+		disabled = "0"
+	}
+	err := o.call(ctx, "uci", "set", map[string]any{"config": "wireless", "section": o.GuestSection, "values": map[string]string{"disabled": disabled}}, nil)
+	if err != nil {
+		return err
+	}
+	return o.commit(ctx)
+}
+
+// reboot reboots the router itself, OpenWrt has no access points to choose between.
+func (o *openwrt) reboot(ctx context.Context, _ string) error {
+	return o.call(ctx, "system", "reboot", nil, nil)
+}
+
+// block adds or removes a MAC address from the deny list of each wireless section, disconnecting the client when blocked.
+func (o *openwrt) block(ctx context.Context, mac string, blocked bool) error {
+	if len(o.Sections) == 0 {
+		return errors.New("no wireless sections configured to block clients on")
+	}
+
+	for _, name := range o.Sections {
+		section, err := o.section(name)
+		if err != nil {
+			return err
+		}
+
+		maclist := slices.DeleteFunc(section.Values.Maclist, func(m string) bool { return parseMAC(m) == mac })
+		if blocked {
+			maclist = append(maclist, mac)
+		}
+
+		err = o.call(ctx, "uci", "set", map[string]any{"config": "wireless", "section": name, "values": map[string]any{"macfilter": "deny", "maclist": maclist}}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := o.commit(ctx); err != nil {
+		return err
+	}
+
+	if blocked {
+		for _, iface := range o.Interfaces {
+			// Fails when the client is not connected to this interface
+			o.call(ctx, "hostapd."+iface, "del_client", map[string]any{"addr": mac, "reason": 5, "deauth": true}, nil)
+		}
+	}
+	return nil
+}
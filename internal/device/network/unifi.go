@@ -0,0 +1,243 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// unifi drives a UniFi Network controller, either standalone or running on a UniFi OS console, through its private API.
+type unifi struct {
+	URL       string        `yaml:"url"`
+	Username  string        `yaml:"username"`
+	Password  config.Secret `yaml:"password"`
+	Site      string        `yaml:"site"`
+	UnifiOS   bool          `yaml:"unifiOS"`
+	GuestSSID string        `yaml:"guestSsid"`
+	client    *http.Client
+	csrfToken string
+	mutex     sync.Mutex
+}
+
+// unifiResponse is the envelope of every controller response.
+type unifiResponse struct {
+	Meta struct {
+		RC  string `json:"rc"`
+		Msg string `json:"msg"`
+	} `json:"meta"`
+	Data json.RawMessage `json:"data"`
+}
+
+// unifiClient represents the fields of interest of a connected client.
+type unifiClient struct {
+	IsWired bool `json:"is_wired"`
+	IsGuest bool `json:"is_guest"`
+}
+
+// unifiWlan represents the fields of interest of a wireless network.
+type unifiWlan struct {
+	ID      string `json:"_id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	IsGuest bool   `json:"is_guest"`
+}
+
+// errUnauthorized is returned for requests rejected because the session has expired.
+var errUnauthorized = errors.New("unifi session expired")
+
+// init creates the client that holds the controller's session cookie.
+func (u *unifi) init(timeout uint) {
+	jar, _ := cookiejar.New(nil)
+	u.client = &http.Client{
+		Timeout: time.Duration(timeout) * time.Millisecond,
+		Jar:     jar,
+	}
+}
+
+// prefix returns the path the network application is served under.
+func (u *unifi) prefix() string {
+	if u.UnifiOS {
+		return strings.TrimRight(u.URL, "/") + "/proxy/network"
+	}
+	return strings.TrimRight(u.URL, "/")
+}
+
+// login starts a new session, UniFi OS consoles also return a CSRF token that must accompany every modifying request.
+func (u *unifi) login() error {
+	endpoint := "/api/login"
+	if u.UnifiOS {
+		endpoint = "/api/auth/login"
+	}
+
+	body, err := json.Marshal(map[string]string{"username": u.Username, "password": u.Password.Value()})
+	if err != nil {
+		return err
+	}
+
+	resp, err := u.client.Post(strings.TrimRight(u.URL, "/")+endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unifi login returned status code %d", resp.StatusCode)
+	}
+	u.csrfToken = resp.Header.Get("X-CSRF-Token")
+	return nil
+}
+
+// send sends a single request to a site endpoint, decoding the data of the response into v when provided.
+func (u *unifi) send(method string, endpoint string, body any, response any) error {
+	var reader io.Reader
+	if body != nil {
+		requestBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestBytes)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/api/s/%s/%s", u.prefix(), u.Site, endpoint), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if u.csrfToken != "" {
+		req.Header.Set("X-CSRF-Token", u.csrfToken)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errUnauthorized
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	envelope := unifiResponse{}
+	if err := json.Unmarshal(responseBytes, &envelope); err != nil {
+		return fmt.Errorf("unifi returned status code %d for %s", resp.StatusCode, endpoint)
+	}
+	if envelope.Meta.Msg == "api.err.LoginRequired" {
+		return errUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK || envelope.Meta.RC != "ok" {
+		return fmt.Errorf("unifi returned \"%s\" for %s", envelope.Meta.Msg, endpoint)
+	}
+
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, response)
+}
+
+// call sends a request to a site endpoint, logging in first if there is no session or it has expired. Requests other than GET are
+// recorded rather than sent during a dry run.
+func (u *unifi) call(ctx context.Context, method string, endpoint string, body any, response any) error {
+	url := fmt.Sprintf("%s/api/s/%s/%s", u.prefix(), u.Site, endpoint)
+	if method != http.MethodGet && device.Record(ctx, device.Call{Method: method, URL: url, Payload: body}) {
+		return nil
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.send(method, endpoint, body, response)
+	if !errors.Is(err, errUnauthorized) {
+		return err
+	}
+
+	if err := u.login(); err != nil {
+		return err
+	}
+	return u.send(method, endpoint, body, response)
+}
+
+func (u *unifi) status() (*status, error) {
+	clients := []unifiClient{}
+	if err := u.call(context.Background(), "GET", "stat/sta", nil, &clients); err != nil {
+		return nil, err
+	}
+
+	var wireless, wired, guests int
+	for _, c := range clients {
+		if c.IsWired {
+			wired++
+		} else {
+			wireless++
+		}
+		if c.IsGuest {
+			guests++
+		}
+	}
+	return &status{
+		Clients:  len(clients),
+		Wireless: &wireless,
+		Wired:    &wired,
+		Guests:   &guests,
+	}, nil
+}
+
+// guestWlan returns the guest wireless network, matched on guestSsid or otherwise the first network with guest policies.
+func (u *unifi) guestWlan() (*unifiWlan, error) {
+	wlans := []unifiWlan{}
+	if err := u.call(context.Background(), "GET", "rest/wlanconf", nil, &wlans); err != nil {
+		return nil, err
+	}
+
+	for _, w := range wlans {
+		if (u.GuestSSID != "" && w.Name == u.GuestSSID) || (u.GuestSSID == "" && w.IsGuest) {
+			return &w, nil
+		}
+	}
+	return nil, errors.New("no guest wlan found")
+}
+
+func (u *unifi) guestEnabled() (bool, error) {
+	wlan, err := u.guestWlan()
+	if err != nil {
+		return false, err
+	}
+	return wlan.Enabled, nil
+}
+
+func (u *unifi) setGuest(ctx context.Context, enabled bool) error {
+	wlan, err := u.guestWlan()
+	if err != nil {
+		return err
+	}
+	return u.call(ctx, "PUT", "rest/wlanconf/"+wlan.ID, map[string]bool{"enabled": enabled}, nil)
+}
+
+func (u *unifi) reboot(ctx context.Context, mac string) error {
+	return u.call(ctx, "POST", "cmd/devmgr", map[string]string{"cmd": "restart", "mac": mac}, nil)
+}
+
+func (u *unifi) block(ctx context.Context, mac string, blocked bool) error {
+	cmd := "unblock-sta"
+	if blocked {
+		cmd = "block-sta"
+	}
+	return u.call(ctx, "POST", "cmd/stamgr", map[string]string{"cmd": cmd, "mac": mac}, nil)
+}
@@ -0,0 +1,201 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+	"github.com/kennedn/restate-go/internal/common/i18n"
+	"github.com/kennedn/restate-go/internal/common/inbox"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+)
+
+// Changes in reachability within this window count towards flapping
+const flapWindow = time.Hour
+
+// availability is the reachability history of a single device used to decide when to alert.
+type availability struct {
+	online      bool
+	since       time.Time
+	alerted     bool
+	transitions []time.Time
+	flapAlerted time.Time
+}
+
+// notifier turns poller results into alerts when a device goes offline for longer than a threshold, comes back or flaps.
+// With summary enabled, alerts are collected and sent once a day instead.
+type notifier struct {
+	config       config.HealthAlert
+	offlineAfter time.Duration
+	summaryAt    time.Duration
+	devices      map[string]*availability
+	events       []string
+	lastSummary  time.Time
+	mutex        sync.Mutex
+}
+
+// newNotifier creates a notifier from the health alert config, returning nil when alerting is not configured.
+func newNotifier(c config.HealthAlert) (*notifier, error) {
+	if c.URL == "" {
+		return nil, nil
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = 5000
+	}
+	if c.OfflineAfterSeconds == 0 {
+		c.OfflineAfterSeconds = 300
+	}
+	if c.FlapCount == 0 {
+		c.FlapCount = 4
+	}
+	if c.SummaryTime == "" {
+		c.SummaryTime = "09:00"
+	}
+
+	summaryAt, err := time.Parse("15:04", c.SummaryTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid summaryTime \"%s\"", c.SummaryTime)
+	}
+
+	return &notifier{
+		config:       c,
+		offlineAfter: time.Duration(c.OfflineAfterSeconds) * time.Second,
+		summaryAt:    time.Duration(summaryAt.Hour())*time.Hour + time.Duration(summaryAt.Minute())*time.Minute,
+		devices:      map[string]*availability{},
+		lastSummary:  time.Now(),
+	}, nil
+}
+
+// observe records whether a device answered its latest poll and returns any alerts it caused.
+func (n *notifier) observe(name string, reachable bool, now time.Time) []string {
+	a, ok := n.devices[name]
+	if !ok {
+		n.devices[name] = &availability{
+			online: reachable,
+			since:  now,
+		}
+		return nil
+	}
+
+	events := []string{}
+	if reachable != a.online {
+		if reachable && a.alerted {
+			events = append(events, fmt.Sprintf(i18n.T("%s is back online after %s"), name, now.Sub(a.since).Round(time.Second)))
+		}
+		a.online = reachable
+		a.since = now
+		a.alerted = false
+
+		a.transitions = append(a.transitions, now)
+		for len(a.transitions) > 0 && now.Sub(a.transitions[0]) > flapWindow {
+			a.transitions = a.transitions[1:]
+		}
+		if len(a.transitions) >= n.config.FlapCount && now.Sub(a.flapAlerted) > flapWindow {
+			events = append(events, fmt.Sprintf(i18n.T("%s is flapping, %d changes in the last hour"), name, len(a.transitions)))
+			a.flapAlerted = now
+		}
+	}
+
+	if !a.online && !a.alerted && now.Sub(a.since) >= n.offlineAfter {
+		events = append(events, fmt.Sprintf(i18n.T("%s has been offline for %s"), name, now.Sub(a.since).Round(time.Second)))
+		a.alerted = true
+	}
+	return events
+}
+
+// offline returns the names of devices that are currently unreachable.
+func (n *notifier) offline() []string {
+	names := []string{}
+	for name, a := range n.devices {
+		if !a.online {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// notify feeds the latest poll results to the notifier, sending alerts straight away or adding them to the daily summary.
+func (n *notifier) notify(devices []health, now time.Time) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	events := []string{}
+	for _, h := range devices {
+		if !h.Enabled || h.Reachable == nil {
+			continue
+		}
+		events = append(events, n.observe(h.Name, *h.Reachable, now)...)
+	}
+
+	if !n.config.Summary {
+		for _, e := range events {
+			n.send(i18n.T("Device availability"), e)
+		}
+		return
+	}
+
+	n.events = append(n.events, events...)
+
+	due := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(n.summaryAt)
+	if now.Before(due) || !n.lastSummary.Before(due) {
+		return
+	}
+	n.lastSummary = now
+
+	offline := n.offline()
+	if len(n.events) == 0 && len(offline) == 0 {
+		return
+	}
+
+	message := fmt.Sprintf(i18n.T("%d availability events in the last day"), len(n.events))
+	if len(n.events) > 0 {
+		message += ":\n" + strings.Join(n.events, "\n")
+	}
+	if len(offline) > 0 {
+		message += "\n" + i18n.T("Currently offline: ") + strings.Join(offline, ", ")
+	}
+	n.send(i18n.T("Device availability summary"), message)
+	n.events = nil
+}
+
+// send posts an alert request to the configured alert URL and keeps it in the inbox.
+func (n *notifier) send(title string, message string) {
+	inbox.Record("availability", title, message, n.config.Priority)
+
+	client := egress.Client("health", time.Duration(n.config.Timeout)*time.Millisecond)
+
+	requestBytes, err := json.Marshal(alert.Request{
+		Message:  message,
+		Title:    title,
+		Priority: json.Number(fmt.Sprint(n.config.Priority)),
+		Token:    n.config.Token.Value(),
+		User:     n.config.User,
+	})
+	if err != nil {
+		logging.Log(logging.Error, "Failed to send availability alert: %v", err)
+		return
+	}
+
+	resp, err := client.Post(n.config.URL, "application/json", bytes.NewReader(requestBytes))
+	if err != nil {
+		logging.Log(logging.Error, "Failed to send availability alert: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logging.Log(logging.Error, "Failed to send availability alert: received status code %d from %s", resp.StatusCode, n.config.URL)
+		return
+	}
+	logging.Log(logging.Info, "Sent availability alert \"%s\"", strings.SplitN(message, "\n", 2)[0])
+}
@@ -0,0 +1,129 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// alertServer records the alerts posted to it.
+func alertServer(t *testing.T) (*httptest.Server, func() []alert.Request) {
+	var mutex sync.Mutex
+	alerts := []alert.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := alert.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		alerts = append(alerts, request)
+		mutex.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []alert.Request {
+		mutex.Lock()
+		defer mutex.Unlock()
+		sent := alerts
+		alerts = []alert.Request{}
+		return sent
+	}
+}
+
+// reachability returns a poll result for a device.
+func reachability(name string, reachable bool) health {
+	return health{Name: name, Enabled: true, Reachable: &reachable}
+}
+
+func TestNotifier(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	server, sent := alertServer(t)
+
+	n, err := newNotifier(config.HealthAlert{URL: server.URL, Token: "token", User: "user", OfflineAfterSeconds: 60, FlapCount: 4})
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Devices are alerted on once they have been offline for the threshold, not when they first fail to answer or again after
+	n.notify([]health{reachability("lamp", true), reachability("plug", true)}, now)
+	n.notify([]health{reachability("lamp", false), reachability("plug", true)}, now.Add(time.Minute))
+	assert.Empty(t, sent())
+	n.notify([]health{reachability("lamp", false), reachability("plug", true)}, now.Add(2*time.Minute))
+	alerts := sent()
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, "Device availability", alerts[0].Title)
+		assert.Equal(t, "lamp has been offline for 1m0s", alerts[0].Message)
+		assert.Equal(t, "token", alerts[0].Token)
+	}
+	n.notify([]health{reachability("lamp", false)}, now.Add(3*time.Minute))
+	assert.Empty(t, sent())
+
+	// Coming back is only alerted on for devices that were alerted as offline
+	n.notify([]health{reachability("lamp", true)}, now.Add(4*time.Minute))
+	alerts = sent()
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, "lamp is back online after 3m0s", alerts[0].Message)
+	}
+	n.notify([]health{reachability("plug", false)}, now.Add(5*time.Minute))
+	n.notify([]health{reachability("plug", true)}, now.Add(5*time.Minute+30*time.Second))
+	assert.Empty(t, sent())
+
+	// Disabled and unpolled devices are ignored
+	n.notify([]health{{Name: "plug", Enabled: false}, {Name: "plug", Enabled: true}}, now.Add(10*time.Minute))
+	assert.Empty(t, sent())
+
+	// Four changes within an hour are flapping, alerted on once an hour
+	for i, reachable := range []bool{false, true, false, true, false, true} {
+		n.notify([]health{reachability("plug", reachable)}, now.Add(11*time.Minute+time.Duration(i)*time.Second))
+	}
+	alerts = sent()
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, "plug is flapping, 4 changes in the last hour", alerts[0].Message)
+	}
+}
+
+func TestNotifierSummary(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	server, sent := alertServer(t)
+
+	n, err := newNotifier(config.HealthAlert{URL: server.URL, OfflineAfterSeconds: 60, Summary: true, SummaryTime: "09:00"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	n.lastSummary = day.Add(-time.Hour)
+
+	// Events are kept until the summary time and sent together with the devices still offline
+	n.notify([]health{reachability("lamp", true), reachability("plug", true)}, day.Add(7*time.Hour))
+	n.notify([]health{reachability("lamp", false), reachability("plug", false)}, day.Add(7*time.Hour+time.Minute))
+	n.notify([]health{reachability("lamp", false), reachability("plug", false)}, day.Add(8*time.Hour))
+	assert.Empty(t, sent())
+
+	n.notify([]health{reachability("lamp", false), reachability("plug", true)}, day.Add(9*time.Hour))
+	alerts := sent()
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, "Device availability summary", alerts[0].Title)
+		assert.Equal(t, "3 availability events in the last day:\nlamp has been offline for 59m0s\nplug has been offline for 59m0s\nplug is back online after 1h59m0s\nCurrently offline: lamp", alerts[0].Message)
+	}
+
+	// The summary is sent once a day
+	n.notify([]health{reachability("lamp", true)}, day.Add(10*time.Hour))
+	assert.Empty(t, sent())
+}
+
+func TestNewNotifier(t *testing.T) {
+	n, err := newNotifier(config.HealthAlert{})
+	assert.NoError(t, err)
+	assert.Nil(t, n)
+
+	_, err = newNotifier(config.HealthAlert{URL: "http://192.0.2.1", SummaryTime: "9am"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package device
+
+import (
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	router "github.com/kennedn/restate-go/internal/router/common"
+)
+
+// validPath reports whether a configured device path is usable as a route, e.g. /lights/desk.
+func validPath(p string) bool {
+	return strings.HasPrefix(p, "/") && p != "/" && path.Clean(p) == p && !strings.ContainsAny(p, "{}")
+}
+
+// overridePaths moves the routes of devices configured with a path, e.g. from /v2/meross/desk to /v2/lights/desk, along with any routes
+// nested below them. A device's path is ignored if it is invalid or any of its routes would collide with another route.
+func overridePaths(routes []router.Route, paths map[string]string, configured []string, prefix string) {
+	key := func(p string) string {
+		return strings.ToLower(strings.TrimSuffix(p, "/"))
+	}
+
+	// moved returns the path a route would be moved to, or false if it does not belong to the named device
+	moved := func(r router.Route, name string) (string, bool) {
+		parts := strings.Split(r.Path, "/")
+		i := slices.Index(parts, name)
+		if i == -1 || deviceName(r.Path, configured) != name {
+			return "", false
+		}
+		return prefix + strings.Join(append([]string{paths[name]}, parts[i+1:]...), "/"), true
+	}
+
+	taken := map[string]bool{}
+	for _, r := range routes {
+		taken[key(r.Path)] = true
+	}
+
+	names := []string{}
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !validPath(paths[name]) {
+			logging.Log(logging.Error, "Ignoring path \"%s\" of device \"%s\", paths must be absolute and clean, e.g. /lights/desk", paths[name], name)
+			continue
+		}
+
+		targets := map[int]string{}
+		order := []int{}
+		collision := ""
+		for i, r := range routes {
+			p, ok := moved(r, name)
+			if !ok {
+				continue
+			}
+			if key(p) != key(r.Path) && taken[key(p)] {
+				collision = p
+				break
+			}
+			targets[i] = p
+			order = append(order, i)
+		}
+		if collision != "" {
+			logging.Log(logging.Error, "Ignoring path \"%s\" of device \"%s\", \"%s\" is already a route", paths[name], name, collision)
+			continue
+		}
+
+		for _, i := range order {
+			p := targets[i]
+			delete(taken, key(routes[i].Path))
+			taken[key(p)] = true
+			routes[i].Path = p
+			logging.Log(logging.Info, "Serving device \"%s\" at \"%s\"", name, p)
+		}
+	}
+}
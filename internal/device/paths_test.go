@@ -0,0 +1,64 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidPath(t *testing.T) {
+	for p, valid := range map[string]bool{
+		"/lights/desk":   true,
+		"/desk":          true,
+		"lights/desk":    false,
+		"/":              false,
+		"/lights/desk/":  false,
+		"/lights//desk":  false,
+		"/lights/../tv":  false,
+		"/lights/{name}": false,
+	} {
+		assert.Equal(t, valid, validPath(p), p)
+	}
+}
+
+func TestOverridePaths(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	routes := []router.Route{
+		{Path: "/v2/meross/desk"},
+		{Path: "/v2/meross/desk/schedule"},
+		{Path: "/v2/meross/lamp"},
+		{Path: "/v2/meross/tv"},
+		{Path: "/v2/meross"},
+		{Path: "/v2/meross/"},
+		{Path: "/v2/Lights/Lamp/"},
+	}
+	overridePaths(routes, map[string]string{
+		"desk": "/lights/desk",
+		"lamp": "/lights/lamp",
+		"tv":   "lounge/tv",
+	}, []string{"desk", "lamp", "tv"}, "/v2")
+
+	// Routes nested below a device move with it, paths that collide regardless of case and trailing slash or are invalid are ignored
+	paths := []string{}
+	for _, r := range routes {
+		paths = append(paths, r.Path)
+	}
+	assert.Equal(t, []string{
+		"/v2/lights/desk",
+		"/v2/lights/desk/schedule",
+		"/v2/meross/lamp",
+		"/v2/meross/tv",
+		"/v2/meross",
+		"/v2/meross/",
+		"/v2/Lights/Lamp/",
+	}, paths)
+
+	// Devices are moved in name order, so a path freed by one device can be taken by a later one
+	routes = []router.Route{{Path: "/v2/meross/desk"}, {Path: "/v2/meross/bed"}}
+	overridePaths(routes, map[string]string{"bed": "/lights/bed", "desk": "/meross/bed"}, []string{"bed", "desk"}, "/v2")
+	assert.Equal(t, "/v2/meross/bed", routes[0].Path)
+	assert.Equal(t, "/v2/lights/bed", routes[1].Path)
+}
@@ -0,0 +1,405 @@
+// Package pid provides PID controllers closing a loop between a numeric field of one restate endpoint and a code of another, e.g. an
+// aquarium heater driven from a water temperature sensor or a greenhouse vent opened as the air warms.
+package pid
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// input is a request whose response holds the process value at a dot separated path into data, e.g. the value of a sensor.
+type input struct {
+	device.Action `yaml:",inline"`
+	Field         string `yaml:"field"`
+}
+
+type status struct {
+	Enabled  bool     `json:"enabled"`
+	Setpoint float64  `json:"setpoint"`
+	Input    *float64 `json:"input,omitempty"`
+	Output   *float64 `json:"output,omitempty"`
+	Updated  string   `json:"updated,omitempty"`
+}
+
+// pid represents a controller configuration with name, gains, output limits and the endpoints it reads from and writes to.
+type pid struct {
+	Name     string        `yaml:"name"`
+	Timeout  uint          `yaml:"timeoutMs"`
+	Sample   uint          `yaml:"sampleSeconds"`
+	Setpoint float64       `yaml:"setpoint"`
+	Kp       float64       `yaml:"kp"`
+	Ki       float64       `yaml:"ki"`
+	Kd       float64       `yaml:"kd"`
+	Min      float64       `yaml:"min"`
+	Max      float64       `yaml:"max"`
+	Decimals int           `yaml:"decimals"`
+	Reverse  bool          `yaml:"reverse"`
+	Input    input         `yaml:"input"`
+	Output   device.Action `yaml:"output"`
+	Base     base
+	// Integral term in output units, held within the output limits so that it does not wind up while the output is saturated
+	integral float64
+	// Last process value and when it was read, zero before the first sample
+	last    float64
+	sampled time.Time
+	// Last output sent, empty if none has been or sending it failed
+	sent     string
+	output   *float64
+	disabled bool
+	mutex    sync.Mutex
+}
+
+// base represents a list of controllers
+type base struct {
+	Devices []*pid
+}
+
+type Device struct{}
+
+// DryRun validates setpoint and enable changes without applying them, outputs are only ever sent on time.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for controllers based on a provided configuration and starts each controller.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	base, routes, err := routes(config)
+	if err != nil {
+		return routes, err
+	}
+
+	for _, p := range base.Devices {
+		go p.run()
+	}
+
+	return routes, err
+}
+
+// routes extracts PID controllers from config, restoring setpoints saved before a restart, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "pid" {
+			continue
+		}
+		pid := pid{
+			Sample: 60,
+			Max:    100,
+			Base:   base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &pid); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if pid.Name == "" || pid.Timeout == 0 || pid.Input.URL == "" || pid.Input.Code == "" || pid.Input.Field == "" ||
+			pid.Output.URL == "" || pid.Output.Code == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if pid.Sample == 0 || pid.Max <= pid.Min || pid.Decimals < 0 {
+			logging.Log(logging.Info, "Unable to load device \"%s\": sampleSeconds must be greater than 0 and max greater than min", pid.Name)
+			continue
+		}
+
+		// Setpoints changed with the setpoint code outlast restarts
+		storage.Load("pid/"+pid.Name, &pid.Setpoint)
+
+		routes = append(routes, router.Route{
+			Path:    "/" + pid.Name,
+			Handler: pid.handler,
+		})
+
+		base.Devices = append(base.Devices, &pid)
+
+		logging.Log(logging.Info, "Found device \"%s\"", pid.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/pid" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/pid",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/pid/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// read returns the current process value from the input endpoint.
+func (p *pid) read() (float64, error) {
+	response, code, err := p.Input.Post(p.Timeout)
+	if err != nil {
+		return 0, err
+	} else if code != http.StatusOK {
+		return 0, fmt.Errorf("received status code %d from %s", code, p.Input.URL)
+	}
+
+	data := response.Data
+	for _, key := range strings.Split(p.Input.Field, ".") {
+		object, ok := data.(map[string]any)
+		if !ok {
+			return 0, fmt.Errorf("field \"%s\" not found", p.Input.Field)
+		}
+		if data, ok = object[key]; !ok {
+			return 0, fmt.Errorf("field \"%s\" not found", p.Input.Field)
+		}
+	}
+
+	value, ok := data.(float64)
+	if !ok {
+		return 0, fmt.Errorf("field \"%s\" is not a number", p.Input.Field)
+	}
+	return value, nil
+}
+
+// step advances the controller with a process value read at now, returning the output within the limits. The derivative is taken on
+// the process value rather than the error, so that changing the setpoint does not kick the output.
+func (p *pid) step(value float64, now time.Time) float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Reverse acting loops, such as cooling, raise the output as the value rises above the setpoint
+	sign := 1.0
+	if p.Reverse {
+		sign = -1
+	}
+	e := sign * (p.Setpoint - value)
+
+	derivative := 0.0
+	if !p.sampled.IsZero() {
+		dt := now.Sub(p.sampled).Seconds()
+		if dt > 0 {
+			p.integral = math.Max(p.Min, math.Min(p.Max, p.integral+p.Ki*e*dt))
+			derivative = -sign * (value - p.last) / dt
+		}
+	}
+	p.last = value
+	p.sampled = now
+
+	output := math.Max(p.Min, math.Min(p.Max, p.Kp*e+p.integral+p.Kd*derivative))
+	p.output = &output
+	return output
+}
+
+// format rounds an output to the configured number of decimals.
+func (p *pid) format(output float64) string {
+	return strconv.FormatFloat(output, 'f', p.Decimals, 64)
+}
+
+// sample reads the input and sends the resulting output if it differs from the last one sent.
+func (p *pid) sample(now time.Time) error {
+	value, err := p.read()
+	if err != nil {
+		return err
+	}
+	output := p.format(p.step(value, now))
+
+	p.mutex.Lock()
+	unchanged := output == p.sent
+	p.mutex.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	action := p.Output
+	action.Value = output
+	_, code, err := action.Post(p.Timeout)
+	if err == nil && code != http.StatusOK {
+		err = fmt.Errorf("received status code %d from %s", code, p.Output.URL)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil {
+		p.sent = ""
+		return err
+	}
+	p.sent = output
+	logging.Log(logging.Info, "Controller \"%s\" sent code \"%s\" with value %s to %s", p.Name, p.Output.Code, output, p.Output.URL)
+	return nil
+}
+
+// run samples the controller at the configured interval while it is enabled, for the lifetime of the process.
+func (p *pid) run() {
+	ticker := time.NewTicker(time.Duration(p.Sample) * time.Second)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		if !p.enabled() {
+			continue
+		}
+		if err := p.sample(time.Now()); err != nil {
+			logging.Log(logging.Error, "Controller \"%s\" failed to sample: %v", p.Name, err)
+		}
+	}
+}
+
+func (p *pid) enabled() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return !p.disabled
+}
+
+// setEnabled enables or disables the controller. Controllers start afresh when enabled, so that the output is not driven by state
+// from before they were disabled.
+func (p *pid) setEnabled(enabled bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if enabled && p.disabled {
+		p.integral = 0
+		p.sampled = time.Time{}
+		p.sent = ""
+	}
+	p.disabled = !enabled
+}
+
+// setSetpoint changes the setpoint of the controller and persists it.
+func (p *pid) setSetpoint(setpoint float64) {
+	p.mutex.Lock()
+	p.Setpoint = setpoint
+	p.mutex.Unlock()
+
+	if err := storage.Save("pid/"+p.Name, setpoint); err != nil {
+		logging.Log(logging.Error, "Unable to save setpoint of \"%s\": %v", p.Name, err)
+	}
+}
+
+// status returns the state of the controller along with the last input read and output calculated.
+func (p *pid) status() *status {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	status := status{
+		Enabled:  !p.disabled,
+		Setpoint: p.Setpoint,
+		Output:   p.output,
+	}
+	if !p.sampled.IsZero() {
+		last := p.last
+		status.Input = &last
+		status.Updated = p.sampled.Format(time.RFC3339)
+	}
+	return &status
+}
+
+// getCodes returns a list of control codes for a controller.
+func getCodes() []string {
+	return []string{"status", "setpoint", "enable", "disable"}
+}
+
+// Handler is the HTTP handler for controller control.
+func (p *pid) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	// Changes are validated but not applied during a dry run
+	dryRun := device.DryRunning(r.Context())
+
+	switch request.Code {
+	case "status":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", p.status())
+	case "setpoint":
+		setpoint, err := request.Value.Float64()
+		if err != nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		if !dryRun {
+			p.setSetpoint(setpoint)
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+	case "enable":
+		if !dryRun {
+			p.setEnabled(true)
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+	case "disable":
+		if !dryRun {
+			p.setEnabled(false)
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+	}
+}
+
+// getDeviceNames returns the names of all controllers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured controllers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
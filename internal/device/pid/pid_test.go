@@ -0,0 +1,292 @@
+package pid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read pid input")
+	}
+
+	pidConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &pidConfig); err != nil {
+		t.Fatalf("Could not read pid input")
+	}
+	return &pidConfig
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/pidConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/pidConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/pidConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/pidConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/pidConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestStep(t *testing.T) {
+	now := time.Now()
+
+	// Proportional only, opening a vent further as a greenhouse warms above its setpoint and closing it below
+	vent := &pid{Setpoint: 22, Kp: 10, Max: 100, Reverse: true}
+	assert.Equal(t, 30.0, vent.step(25, now))
+	assert.Equal(t, 0.0, vent.step(20, now.Add(time.Minute)))
+	assert.Equal(t, 100.0, vent.step(40, now.Add(2*time.Minute)))
+
+	// The integral builds up while below the setpoint but is held within the limits, so the output falls as soon as the value
+	// overshoots rather than after unwinding
+	heater := &pid{Setpoint: 25, Ki: 0.1, Max: 100}
+	assert.Equal(t, 0.0, heater.step(20, now))
+	assert.Equal(t, 30.0, heater.step(20, now.Add(time.Minute)))
+	for i := 2; i < 10; i++ {
+		heater.step(20, now.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, 100.0, heater.integral)
+	assert.Equal(t, 82.0, heater.step(26, now.Add(12*time.Minute)))
+
+	// The derivative damps a rising value without kicking when the setpoint changes
+	damped := &pid{Setpoint: 25, Kp: 10, Kd: 60, Max: 100}
+	assert.Equal(t, 50.0, damped.step(20, now))
+	assert.Equal(t, 39.0, damped.step(21, now.Add(time.Minute)))
+	damped.Setpoint = 26
+	assert.Equal(t, 50.0, damped.step(21, now.Add(2*time.Minute)))
+}
+
+func TestSample(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	var mutex sync.Mutex
+	sent := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/aquarium" {
+			w.Write([]byte(`{"version":1,"message":"OK","data":{"value":24,"unit":"°C"}}`))
+			return
+		}
+		mutex.Lock()
+		sent = append(sent, request.Code+":"+request.Value.String())
+		mutex.Unlock()
+		w.Write([]byte(`{"version":1,"message":"OK"}`))
+	}))
+	defer server.Close()
+
+	base, _, err := routes(loadConfig(t, "testdata/pidConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	aquarium := base.Devices[0]
+	aquarium.Input.URL = server.URL + "/aquarium"
+	aquarium.Output.URL = server.URL + "/heater"
+
+	// Outputs are only sent when they change once rounded
+	now := time.Now()
+	for _, seconds := range []int{0, 60, 90} {
+		assert.NoError(t, aquarium.sample(now.Add(time.Duration(seconds)*time.Second)))
+	}
+	assert.Equal(t, []string{"luminance:20", "luminance:21"}, sent)
+
+	// Re-enabling starts afresh, resending the output
+	aquarium.setEnabled(false)
+	aquarium.setEnabled(true)
+	assert.NoError(t, aquarium.sample(now.Add(120*time.Second)))
+	assert.Equal(t, []string{"luminance:20", "luminance:21", "luminance:20"}, sent)
+
+	status := aquarium.status()
+	assert.Equal(t, 24.0, *status.Input)
+	assert.Equal(t, 20.0, *status.Output)
+
+	aquarium.Input.Field = "temperature"
+	assert.Error(t, aquarium.sample(now.Add(180*time.Second)))
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		data         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/pid/aquarium",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","setpoint","enable","disable"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/pid/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["aquarium","greenhouse"]}`,
+		},
+		{
+			name:         "status_before_sampling",
+			method:       "POST",
+			url:          "/pid/aquarium",
+			data:         `{"code":"status"}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"enabled":true,"setpoint":25}}`,
+		},
+		{
+			name:         "setpoint",
+			method:       "POST",
+			url:          "/pid/aquarium?code=setpoint&value=26.5",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "setpoint_invalid_value",
+			method:       "POST",
+			url:          "/pid/aquarium?code=setpoint&value=warm",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "disable",
+			method:       "POST",
+			url:          "/pid/aquarium?code=disable",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "status_after_changes",
+			method:       "POST",
+			url:          "/pid/aquarium?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"enabled":false,"setpoint":26.5}}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/pid/aquarium?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/pid/aquarium",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/pid/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	base, routes, err := routes(loadConfig(t, "testdata/pidConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+
+	t.Run("dry_run_leaves_controller_alone", func(t *testing.T) {
+		p := base.Devices[0]
+		before := *p.status()
+		ctx, _ := device.WithDryRun(context.Background())
+		for _, url := range []string{"/pid/" + p.Name + "?code=setpoint&value=5", "/pid/" + p.Name + "?code=disable"} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil).WithContext(ctx))
+			assert.Equal(t, `{"version":1,"message":"OK"}`, recorder.Body.String(), url)
+		}
+		assert.Equal(t, before, *p.status())
+	})
+}
@@ -0,0 +1,389 @@
+// Package printer reports printer supply levels and page counts over SNMP and power cycles printers through a smart plug device.
+package printer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"github.com/gosnmp/gosnmp"
+	"gopkg.in/yaml.v3"
+)
+
+// Printer-MIB and Host-Resources-MIB object identifiers, supplies are indexed by <marker>.<supply>
+const (
+	oidPrinterStatus     = ".1.3.6.1.2.1.25.3.5.1.1.1"
+	oidPageCount         = ".1.3.6.1.2.1.43.10.2.1.4.1.1"
+	oidSupplyDescription = ".1.3.6.1.2.1.43.11.1.1.6.1"
+	oidSupplyMaxCapacity = ".1.3.6.1.2.1.43.11.1.1.8.1"
+	oidSupplyLevel       = ".1.3.6.1.2.1.43.11.1.1.9.1"
+)
+
+// hrPrinterStatus values
+var printerStates = map[int]string{
+	1: "other",
+	2: "unknown",
+	3: "idle",
+	4: "printing",
+	5: "warmup",
+}
+
+// supply represents a single consumable, level and max are negative when the printer cannot measure them.
+type supply struct {
+	Name    string `json:"name"`
+	Level   int    `json:"level"`
+	Max     int    `json:"max"`
+	Percent *int   `json:"percent,omitempty"`
+}
+
+// status is the representation of a printer returned by the status code.
+type status struct {
+	Power    string   `json:"power"`
+	State    string   `json:"state,omitempty"`
+	Pages    *uint64  `json:"pages,omitempty"`
+	Supplies []supply `json:"supplies,omitempty"`
+}
+
+// plug references the smart plug device a printer is powered from.
+type plug struct {
+	On      *device.Action `yaml:"on"`
+	Off     *device.Action `yaml:"off"`
+	DelayMs uint           `yaml:"delayMs"`
+}
+
+// printer represents a printer configuration with name, SNMP parameters and an optional plug.
+type printer struct {
+	Name      string `yaml:"name"`
+	Host      string `yaml:"host"`
+	Port      uint16 `yaml:"port"`
+	Community string `yaml:"community"`
+	Timeout   uint   `yaml:"timeoutMs"`
+	Plug      *plug  `yaml:"plug"`
+	Base      base
+}
+
+// base represents a list of printers
+type base struct {
+	Devices []*printer
+}
+
+type Device struct{}
+
+// DryRun previews the plug actions a request would post, status is still read over SNMP.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for printers based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts printers from config, along with the plugs that power them, and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "printer" {
+			continue
+		}
+		printer := printer{
+			Port:      161,
+			Community: "public",
+			Base:      base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &printer); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if printer.Name == "" || printer.Host == "" || printer.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if printer.Plug != nil {
+			if printer.Plug.On == nil || printer.Plug.Off == nil {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if printer.Plug.DelayMs == 0 {
+				printer.Plug.DelayMs = 5000
+			}
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + printer.Name,
+			Handler: printer.handler,
+		})
+
+		base.Devices = append(base.Devices, &printer)
+
+		logging.Log(logging.Info, "Found device \"%s\"", printer.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/printer" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/printer",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/printer/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// connect opens an SNMP v2c session with the printer.
+func (p *printer) connect() (*gosnmp.GoSNMP, error) {
+	client := &gosnmp.GoSNMP{
+		Target:    p.Host,
+		Port:      p.Port,
+		Community: p.Community,
+		Version:   gosnmp.Version2c,
+		Timeout:   time.Duration(p.Timeout) * time.Millisecond,
+		Retries:   0,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	return client, client.Connect()
+}
+
+// walk returns the PDUs below an OID keyed by their remaining index.
+func walk(client *gosnmp.GoSNMP, oid string) (map[string]gosnmp.SnmpPDU, error) {
+	pdus, err := client.WalkAll(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]gosnmp.SnmpPDU{}
+	for _, pdu := range pdus {
+		values[strings.TrimPrefix(pdu.Name, oid+".")] = pdu
+	}
+	return values, nil
+}
+
+// supplies retrieves the level of each consumable reported by the printer.
+func supplies(client *gosnmp.GoSNMP) ([]supply, error) {
+	descriptions, err := walk(client, oidSupplyDescription)
+	if err != nil {
+		return nil, err
+	}
+	maxCapacities, err := walk(client, oidSupplyMaxCapacity)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := walk(client, oidSupplyLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := []int{}
+	for index := range descriptions {
+		if i, err := strconv.Atoi(index); err == nil {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+
+	supplies := []supply{}
+	for _, i := range indexes {
+		index := strconv.Itoa(i)
+		name, _ := descriptions[index].Value.([]byte)
+
+		s := supply{
+			// Some printers null terminate their descriptions
+			Name:  strings.TrimRight(string(name), "\x00 "),
+			Level: int(gosnmp.ToBigInt(levels[index].Value).Int64()),
+			Max:   int(gosnmp.ToBigInt(maxCapacities[index].Value).Int64()),
+		}
+		if s.Max > 0 && s.Level >= 0 {
+			percent := s.Level * 100 / s.Max
+			s.Percent = &percent
+		}
+		supplies = append(supplies, s)
+	}
+	return supplies, nil
+}
+
+// status probes the printer over SNMP, an unresponsive printer is reported as powered off.
+func (p *printer) status() (*status, error) {
+	client, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Conn.Close()
+
+	result, err := client.Get([]string{oidPrinterStatus, oidPageCount})
+	if err != nil {
+		logging.Log(logging.Info, "Printer \"%s\" did not respond: %v", p.Name, err)
+		return &status{Power: "off"}, nil
+	}
+
+	status := status{Power: "on"}
+	for _, pdu := range result.Variables {
+		if pdu.Type == gosnmp.NoSuchObject || pdu.Type == gosnmp.NoSuchInstance {
+			continue
+		}
+		switch pdu.Name {
+		case oidPrinterStatus:
+			status.State = printerStates[int(gosnmp.ToBigInt(pdu.Value).Int64())]
+		case oidPageCount:
+			pages := gosnmp.ToBigInt(pdu.Value).Uint64()
+			status.Pages = &pages
+		}
+	}
+
+	status.Supplies, err = supplies(client)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// switchPlug posts the on or off action to the printer's plug.
+func (p *printer) switchPlug(ctx context.Context, on bool) error {
+	action := p.Plug.Off
+	if on {
+		action = p.Plug.On
+	}
+
+	_, code, err := action.PostContext(ctx, p.Timeout)
+	if err != nil {
+		return err
+	} else if code != http.StatusOK {
+		return fmt.Errorf("received status code %d from %s", code, action.URL)
+	}
+	return nil
+}
+
+// cycle switches the plug off and schedules it back on after the configured delay. During a dry run both actions are recorded straight
+// away.
+func (p *printer) cycle(ctx context.Context) error {
+	if err := p.switchPlug(ctx, false); err != nil {
+		return err
+	}
+
+	if device.DryRunning(ctx) {
+		return p.switchPlug(ctx, true)
+	}
+
+	time.AfterFunc(time.Duration(p.Plug.DelayMs)*time.Millisecond, func() {
+		if err := p.switchPlug(context.Background(), true); err != nil {
+			logging.Log(logging.Error, "Printer \"%s\" failed to power back on: %v", p.Name, err)
+		}
+	})
+	return nil
+}
+
+// getCodes returns a list of control codes for a printer, plug codes are only offered when a plug is configured.
+func (p *printer) getCodes() []string {
+	if p.Plug == nil {
+		return []string{"status"}
+	}
+	return []string{"status", "on", "off", "cycle"}
+}
+
+// Handler is the HTTP handler for printer control.
+func (p *printer) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", p.getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch {
+	case request.Code == "status":
+		data, err = p.status()
+	case p.Plug != nil && request.Code == "on":
+		err = p.switchPlug(r.Context(), true)
+	case p.Plug != nil && request.Code == "off":
+		err = p.switchPlug(r.Context(), false)
+	case p.Plug != nil && request.Code == "cycle":
+		err = p.cycle(r.Context())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all printers in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured printers.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,362 @@
+package printer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read printer input")
+	}
+
+	printerConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &printerConfig); err != nil {
+		t.Fatalf("Could not read printer input")
+	}
+	return &printerConfig
+}
+
+// compareOIDs orders two dotted OIDs numerically.
+func compareOIDs(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "."), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "."), ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		x, _ := strconv.Atoi(aParts[i])
+		y, _ := strconv.Atoi(bParts[i])
+		if x != y {
+			return x - y
+		}
+	}
+	return len(aParts) - len(bParts)
+}
+
+// setupSNMPAgent emulates a printer answering Get and GetNext requests for the "public" community only.
+func setupSNMPAgent(t *testing.T) net.PacketConn {
+	mib := map[string]gosnmp.SnmpPDU{
+		oidPrinterStatus:            {Type: gosnmp.Integer, Value: 3},
+		oidPageCount:                {Type: gosnmp.Counter32, Value: uint(12345)},
+		oidSupplyDescription + ".1": {Type: gosnmp.OctetString, Value: []byte("Black Toner\x00")},
+		oidSupplyDescription + ".2": {Type: gosnmp.OctetString, Value: []byte("Waste Toner Box")},
+		oidSupplyMaxCapacity + ".1": {Type: gosnmp.Integer, Value: 3000},
+		oidSupplyMaxCapacity + ".2": {Type: gosnmp.Integer, Value: -2},
+		oidSupplyLevel + ".1":       {Type: gosnmp.Integer, Value: 750},
+		oidSupplyLevel + ".2":       {Type: gosnmp.Integer, Value: -3},
+	}
+	oids := []string{}
+	for oid := range mib {
+		oids = append(oids, oid)
+	}
+	sort.Slice(oids, func(i, j int) bool { return compareOIDs(oids[i], oids[j]) < 0 })
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not start snmp agent: %v", err)
+	}
+
+	go func() {
+		buffer := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			packet, err := gosnmp.Default.SnmpDecodePacket(buffer[:n])
+			if err != nil || packet.Community != "public" {
+				continue
+			}
+
+			variables := []gosnmp.SnmpPDU{}
+			for _, v := range packet.Variables {
+				name := v.Name
+				if packet.PDUType == gosnmp.GetNextRequest {
+					name = ""
+					for _, oid := range oids {
+						if compareOIDs(oid, v.Name) > 0 {
+							name = oid
+							break
+						}
+					}
+					if name == "" {
+						variables = append(variables, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.EndOfMibView})
+						continue
+					}
+				}
+
+				pdu, ok := mib[name]
+				if !ok {
+					variables = append(variables, gosnmp.SnmpPDU{Name: name, Type: gosnmp.NoSuchObject})
+					continue
+				}
+				pdu.Name = name
+				variables = append(variables, pdu)
+			}
+
+			packet.PDUType = gosnmp.GetResponse
+			packet.Variables = variables
+			response, err := packet.MarshalMsg()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/printerConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/printerConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/printerConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/printerConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/printerConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		data         string
+		expectedCode int
+		expectedBody string
+		expectedPlug []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/printer/office",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","on","off","cycle"]}`,
+		},
+		{
+			name:         "get_device_request_without_plug",
+			method:       "GET",
+			url:          "/printer/garage",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/printer/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["office","garage"]}`,
+		},
+		{
+			name:         "status",
+			method:       "POST",
+			url:          "/printer/office?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"power":"on","state":"idle","pages":12345,"supplies":[{"name":"Black Toner","level":750,"max":3000,"percent":25},{"name":"Waste Toner Box","level":-3,"max":-2}]}}`,
+		},
+		{
+			name:         "status_unresponsive",
+			method:       "POST",
+			url:          "/printer/garage?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"power":"off"}}`,
+		},
+		{
+			name:         "off",
+			method:       "POST",
+			url:          "/printer/office",
+			data:         `{"code":"off"}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedPlug: []string{"toggle:0"},
+		},
+		{
+			name:         "cycle",
+			method:       "POST",
+			url:          "/printer/office?code=cycle",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedPlug: []string{"toggle:0", "toggle:1"},
+		},
+		{
+			name:         "cycle_without_plug",
+			method:       "POST",
+			url:          "/printer/garage?code=cycle",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/printer/office?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/printer/office",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/printer/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	agent := setupSNMPAgent(t)
+	defer agent.Close()
+
+	var mutex sync.Mutex
+	received := []string{}
+	plugServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		received = append(received, request.Code+":"+request.Value.String())
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version":1,"message":"OK"}`))
+	}))
+	defer plugServer.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/printerConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	port := uint16(agent.LocalAddr().(*net.UDPAddr).Port)
+	for _, d := range base.Devices {
+		d.Host = "127.0.0.1"
+		d.Port = port
+		if d.Plug != nil {
+			d.Plug.On.URL = plugServer.URL
+			d.Plug.Off.URL = plugServer.URL
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mutex.Lock()
+			received = []string{}
+			mutex.Unlock()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedPlug != nil {
+				assert.Eventually(t, func() bool {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return assert.ObjectsAreEqual(tc.expectedPlug, received)
+				}, time.Second, 10*time.Millisecond)
+			}
+		})
+	}
+	t.Run("dry_run_cycle", func(t *testing.T) {
+		mutex.Lock()
+		received = []string{}
+		mutex.Unlock()
+
+		// Both plug actions are recorded straight away and neither is sent
+		ctx, run := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/printer/office?code=cycle", nil).WithContext(ctx))
+		assert.Equal(t, `{"version":1,"message":"OK"}`, recorder.Body.String())
+		calls := run.Calls()
+		if assert.Len(t, calls, 2) {
+			assert.Equal(t, map[string]any{"code": "toggle", "value": "0"}, calls[0].Payload)
+			assert.Equal(t, map[string]any{"code": "toggle", "value": "1"}, calls[1].Payload)
+		}
+		time.Sleep(50 * time.Millisecond)
+		mutex.Lock()
+		assert.Empty(t, received)
+		mutex.Unlock()
+	})
+}
@@ -0,0 +1,18 @@
+package device
+
+import (
+	"net/url"
+)
+
+// deviceHost returns the host requests to a device are sent to, from the host or url in its config, so that they can be sent through its proxy.
+func deviceHost(c map[string]any) string {
+	if host, ok := c["host"].(string); ok && host != "" {
+		return host
+	}
+	if rawURL, ok := c["url"].(string); ok {
+		if u, err := url.Parse(rawURL); err == nil {
+			return u.Host
+		}
+	}
+	return ""
+}
@@ -1,8 +1,9 @@
-// Package meross provides an abstraction for making HTTP calls to control Meross branded smart bulbs and sockets.
-package meross_radiator
+// Package radiator provides control of Meross thermostatic radiator valves paired with a hub, optionally discovered from the hub at startup.
+package radiator
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
@@ -12,8 +13,10 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kennedn/restate-go/internal/common/config"
@@ -21,7 +24,6 @@ import (
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
 	"gopkg.in/yaml.v3"
 )
 
@@ -37,11 +39,19 @@ type singleGet struct {
 	Value *int64 `json:"value,omitempty"`
 }
 
+// temperatureGet is the adjust response when units are configured.
+type temperatureGet struct {
+	Value json.Number `json:"value"`
+	Unit  string      `json:"unit"`
+}
+
+// temperature holds readings in tenths of a degree Celsius, or in the configured units when unit is set.
 type temperature struct {
-	Current    *int64 `json:"current"`
-	Target     *int64 `json:"target"`
-	Heating    *bool  `json:"heating"`
-	OpenWindow *bool  `json:"openWindow"`
+	Current    *json.Number `json:"current"`
+	Target     *json.Number `json:"target"`
+	Unit       string       `json:"unit,omitempty"`
+	Heating    *bool        `json:"heating"`
+	OpenWindow *bool        `json:"openWindow"`
 }
 
 // namedStatus associates a devices name with its status.
@@ -95,6 +105,25 @@ type rawStatus struct {
 	} `json:"payload"`
 }
 
+// rawDigest represents the subdevice list of a hub from its Appliance.System.All response.
+type rawDigest struct {
+	Payload struct {
+		Error struct {
+			Code   int64  `json:"code,omitempty"`
+			Detail string `json:"detail,omitempty"`
+		} `json:"error,omitempty"`
+		All struct {
+			Digest struct {
+				Hub struct {
+					Subdevice []struct {
+						ID string `json:"id"`
+					} `json:"subdevice"`
+				} `json:"hub"`
+			} `json:"digest"`
+		} `json:"all"`
+	} `json:"payload"`
+}
+
 // endpoint describes a Meross device control endpoint with code, supported devices, and other properties.
 type endpoint struct {
 	Code             string   `yaml:"code"`
@@ -102,29 +131,112 @@ type endpoint struct {
 	MinValue         int64    `yaml:"minValue,omitempty"`
 	MaxValue         int64    `yaml:"maxValue,omitempty"`
 	Namespace        string   `yaml:"namespace"`
-	Template         string   `yaml:"template"`
 }
 
 // meross represents a Meross device configuration with name, host, device type, timeout, and base configuration.
 type meross struct {
-	Name       string `yaml:"name"`
-	Id         string `yaml:"id"`
-	Host       string `yaml:"host"`
-	DeviceType string `yaml:"deviceType"`
-	Timeout    uint   `yaml:"timeoutMs"`
-	Key        string `yaml:"key,omitempty"`
+	Name       string        `yaml:"name"`
+	Id         string        `yaml:"id"`
+	Host       string        `yaml:"host"`
+	DeviceType string        `yaml:"deviceType"`
+	Timeout    uint          `yaml:"timeoutMs"`
+	Key        config.Secret `yaml:"key,omitempty"`
+	Units      string        `yaml:"units"`
+	MinTarget  json.Number   `yaml:"minTarget"`
+	MaxTarget  json.Number   `yaml:"maxTarget"`
 	Base       base
+	limits     *device.Limits
+}
+
+// hub represents a hub whose radiators are discovered rather than listed individually, names overrides generated names by id.
+type hub struct {
+	Host     string            `yaml:"host"`
+	Timeout  uint              `yaml:"timeoutMs"`
+	Key      config.Secret     `yaml:"key,omitempty"`
+	Discover bool              `yaml:"discover"`
+	Prefix   string            `yaml:"prefix"`
+	Names    map[string]string `yaml:"names"`
+	Units    string            `yaml:"units"`
+	limits   *device.Limits
 }
 
 // base represents a list of Meross devices, endpoints and common configuration
 type base struct {
-	BaseTemplate string      `yaml:"baseTemplate"`
-	Endpoints    []*endpoint `yaml:"endpoints"`
-	Devices      []*meross
+	Endpoints []*endpoint `yaml:"endpoints"`
+	Devices   []*meross
+	hubs      []*hub
+	mutex     *sync.RWMutex
+}
+
+// subdevicePayload addresses a radiator paired with a hub, only the field set by the code is present.
+type subdevicePayload struct {
+	Channel     *int64 `json:"channel,omitempty"`
+	ID          string `json:"id"`
+	Onoff       *int64 `json:"onoff,omitempty"`
+	State       *int64 `json:"state,omitempty"`
+	Temperature *int64 `json:"temperature,omitempty"`
+	Custom      *int64 `json:"custom,omitempty"`
+	Dummy       *int64 `json:"dummy,omitempty"`
 }
 
+// payloads build the subdevice payload of each code in the manifest from its value, info and reboot are sent to the hub itself.
+var payloads = map[string]func(id string, value int64) subdevicePayload{
+	"toggle": func(id string, v int64) subdevicePayload {
+		channel := int64(0)
+		return subdevicePayload{Channel: &channel, ID: id, Onoff: &v}
+	},
+	"mode": func(id string, v int64) subdevicePayload {
+		return subdevicePayload{ID: id, State: &v}
+	},
+	"adjust": func(id string, v int64) subdevicePayload {
+		return subdevicePayload{ID: id, Temperature: &v}
+	},
+	"status": func(id string, v int64) subdevicePayload {
+		return subdevicePayload{ID: id, Dummy: &v}
+	},
+	"battery": func(id string, v int64) subdevicePayload {
+		return subdevicePayload{ID: id, Dummy: &v}
+	},
+	"target": func(id string, v int64) subdevicePayload {
+		return subdevicePayload{ID: id, Custom: &v}
+	},
+}
+
+// payload builds the payload of a code for each device, reads are sent without a value.
+func payload(code string, devices []*meross, value json.Number) ([]subdevicePayload, error) {
+	values := make(map[string]json.Number, len(devices))
+	for _, m := range devices {
+		values[m.Id] = value
+	}
+	return payloadValues(code, devices, values)
+}
+
+// payloadValues builds the payload of a code for each device from the value keyed by its id, e.g. a target converted from its own units.
+func payloadValues(code string, devices []*meross, values map[string]json.Number) ([]subdevicePayload, error) {
+	subdevices := make([]subdevicePayload, 0, len(devices))
+	for _, m := range devices {
+		var v int64
+		if value := values[m.Id]; value != "" {
+			var err error
+			if v, err = value.Int64(); err != nil {
+				return nil, err
+			}
+		}
+		subdevices = append(subdevices, payloads[code](m.Id, v))
+	}
+	return subdevices, nil
+}
+
+// errOutsideLimits is returned when a requested setpoint is outside of a device's safety limits
+var errOutsideLimits = errors.New("outside safety limits")
+
 type Device struct{}
 
+// DryRun previews the mode and temperature messages a request would send to the hub, status is still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 // Routes generates routes for Meross device control based on a provided configuration.
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config, "")
@@ -139,10 +251,12 @@ func toJsonNumber(value any) json.Number {
 // generateRoutesFromConfig generates routes and base configuration from a provided configuration and internal config file.
 func routes(config *config.Config, internalConfigPath string) (*base, []router.Route, error) {
 	routes := []router.Route{}
-	base := base{}
+	base := base{
+		mutex: &sync.RWMutex{},
+	}
 
 	if internalConfigPath == "" {
-		internalConfigPath = "./internal/device/meross_radiator/device.yaml"
+		internalConfigPath = "./internal/device/radiator/device.yaml"
 	}
 
 	internalConfigFile, err := os.ReadFile(internalConfigPath)
@@ -153,16 +267,22 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 	if err := yaml.Unmarshal(internalConfigFile, &base); err != nil {
 		return nil, []router.Route{}, err
 	}
-	if len(base.Endpoints) == 0 || base.BaseTemplate == "" {
+	if len(base.Endpoints) == 0 {
 		return nil, []router.Route{}, fmt.Errorf("unable to load internalConfigPath \"%s\"", internalConfigPath)
 	}
+	for _, e := range base.Endpoints {
+		if _, ok := payloads[e.Code]; !ok && e.Code != "info" && e.Code != "reboot" {
+			return nil, []router.Route{}, fmt.Errorf("unknown code \"%s\" in internalConfigPath \"%s\"", e.Code, internalConfigPath)
+		}
+	}
 
 	for _, d := range config.Devices {
-		if d.Type != "meross_radiator" {
+		if d.Type != "radiator" {
 			continue
 		}
 		meross := meross{
-			Base: base,
+			Units: config.Units,
+			Base:  base,
 		}
 
 		yamlConfig, err := yaml.Marshal(d.Config)
@@ -171,11 +291,38 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &meross); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &meross); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
 
+		if !device.ValidUnits(meross.Units) {
+			logging.Log(logging.Info, "Unable to load device due to invalid units \"%s\"", meross.Units)
+			continue
+		}
+
+		meross.limits, err = device.NewLimits(meross.MinTarget, meross.MaxTarget, meross.Units)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to load device due to invalid target limits: %v", err)
+			continue
+		}
+
+		hub := hub{
+			Units:  meross.Units,
+			limits: meross.limits,
+		}
+		if err := yaml.Unmarshal(yamlConfig, &hub); err == nil && hub.Discover {
+			if hub.Host == "" || hub.Timeout == 0 {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if hub.Prefix == "" {
+				hub.Prefix = "radiator"
+			}
+			base.hubs = append(base.hubs, &hub)
+			continue
+		}
+
 		if meross.Name == "" || meross.Host == "" || meross.DeviceType == "" || meross.Id == "" {
 			logging.Log(logging.Info, "Unable to load device due to missing parameters")
 			continue
@@ -191,9 +338,17 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 		logging.Log(logging.Info, "Found device \"%s\"", meross.Name)
 	}
 
+	// Discovered radiators are added after explicit devices so that explicit config takes precedence for a given id
+	for _, m := range base.discover() {
+		routes = append(routes, router.Route{
+			Path:    "/" + m.Name,
+			Handler: m.handler,
+		})
+	}
+
 	if len(routes) == 0 {
 		return nil, []router.Route{}, errors.New("no routes found in config")
-	} else if len(routes) == 1 {
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
 		return &base, routes, nil
 	}
 
@@ -210,9 +365,116 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 		Path:    "/radiator/",
 		Handler: base.handler,
 	})
+
+	if len(base.hubs) > 0 {
+		routes = append(routes, router.Route{
+			Path:    "/radiator/refresh",
+			Handler: base.refreshHandler,
+		})
+	}
 	return &base, routes, nil
 }
 
+// unsafeCharacters matches runs of characters that are not safe in a route
+var unsafeCharacters = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// sanitize lower cases a name and replaces anything that is not safe in a route with underscores.
+func sanitize(name string) string {
+	return strings.Trim(unsafeCharacters.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// subdevices retrieves the ids of all subdevices paired with a hub.
+func (b *base) subdevices(h *hub) ([]string, error) {
+	client := &http.Client{
+		Timeout: time.Duration(h.Timeout) * time.Millisecond,
+	}
+	messageId := randomHex(16)
+	sign := md5SumString(fmt.Sprintf("%s%s%d", messageId, h.Key.Value(), 0))
+	jsonPayload, err := device.MerossMessage(messageId, "GET", "Appliance.System.All", sign, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", "http://"+h.Host+"/config", bytes.NewReader(jsonPayload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("hub %s returned status code %d", h.Host, resp.StatusCode)
+	}
+
+	digest := rawDigest{}
+	if err := json.NewDecoder(resp.Body).Decode(&digest); err != nil {
+		return nil, err
+	}
+
+	if digest.Payload.Error.Code != 0 {
+		return nil, errors.New(digest.Payload.Error.Detail)
+	}
+
+	ids := []string{}
+	for _, s := range digest.Payload.All.Digest.Hub.Subdevice {
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
+
+// discover queries each hub for its subdevices and adds any whose id is not already known, returning the new devices.
+func (b *base) discover() []*meross {
+	added := []*meross{}
+	for _, h := range b.hubs {
+		ids, err := b.subdevices(h)
+		if err != nil {
+			logging.Log(logging.Error, "Unable to discover radiators on hub %s: %v", h.Host, err)
+			continue
+		}
+
+		for _, id := range ids {
+			if b.getDeviceById(id) != nil {
+				continue
+			}
+
+			name, ok := h.Names[id]
+			if !ok {
+				name = h.Prefix + "_" + id
+			}
+			name = sanitize(name)
+			if b.getDevice(name) != nil {
+				logging.Log(logging.Info, "Unable to add discovered radiator \"%s\", name \"%s\" is already in use", id, name)
+				continue
+			}
+
+			m := &meross{
+				Name:       name,
+				Id:         id,
+				Host:       h.Host,
+				DeviceType: "radiator",
+				Timeout:    h.Timeout,
+				Key:        h.Key,
+				Units:      h.Units,
+				Base:       *b,
+				limits:     h.limits,
+			}
+
+			b.mutex.Lock()
+			b.Devices = append(b.Devices, m)
+			b.mutex.Unlock()
+			added = append(added, m)
+
+			logging.Log(logging.Info, "Discovered device \"%s\"", m.Name)
+		}
+	}
+	return added
+}
+
 // getCodes returns a list of control codes for a Meross device.
 func (m *meross) getCodes() []string {
 	var codes []string
@@ -251,8 +513,8 @@ func md5SumString(s string) string {
 
 }
 
-// post constructs and sends a POST request to a Meross device and will return a flattened status when the method is equal to GET.
-func (b *base) post(host string, method string, namespace string, payload string, key string, timeout uint) (*rawStatus, error) {
+// send signs a payload for a namespace and sends it to a hub, returning the status code and body of the response.
+func (b *base) send(ctx context.Context, host string, method string, namespace string, payload any, key string, timeout uint) (int, []byte, error) {
 	client := &http.Client{
 		Timeout: time.Duration(timeout) * time.Millisecond,
 	}
@@ -260,33 +522,48 @@ func (b *base) post(host string, method string, namespace string, payload string
 	messageId := randomHex(16)
 	sign := md5SumString(fmt.Sprintf("%s%s%d", messageId, key, 0))
 
-	payloadName := strings.Split(namespace, ".")
-	wrappedPayload := fmt.Sprintf("{\"%s\":[%s]}", payloadName[len(payloadName)-1], payload)
-	jsonPayload := []byte(fmt.Sprintf(b.BaseTemplate, messageId, method, namespace, sign, wrappedPayload))
+	jsonPayload, err := device.MerossMessage(messageId, method, namespace, sign, payload)
+	if err != nil {
+		return 0, nil, err
+	}
 
-	req, err := http.NewRequest("POST", "http://"+host+"/config", bytes.NewReader(jsonPayload))
+	// Reads are sent as POSTs too, mark them so that they still happen during a dry run
+	if method == "GET" {
+		ctx = device.Read(ctx)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+host+"/config", bytes.NewReader(jsonPayload))
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	// Send the request and get the response
-	resp, err := client.Do(req)
+	resp, err := device.Do(client, req)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+// post constructs and sends a POST request to a Meross device and will return a flattened status when the method is equal to GET.
+func (b *base) post(ctx context.Context, host string, method string, namespace string, payload []subdevicePayload, key string, timeout uint) (*rawStatus, error) {
+	// Subdevices are listed under the last part of the namespace
+	payloadName := strings.Split(namespace, ".")
+	wrappedPayload := map[string][]subdevicePayload{payloadName[len(payloadName)-1]: payload}
+
+	statusCode, body, err := b.send(ctx, host, method, namespace, wrappedPayload, key, timeout)
+	if err != nil {
 		return nil, err
 	}
 
-	if method == "SET" {
-		return nil, nil
+	if statusCode != 200 {
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if method == "SET" {
+		return nil, nil
 	}
 
 	rawResponse := rawStatus{}
@@ -304,8 +581,88 @@ func (b *base) post(host string, method string, namespace string, payload string
 }
 
 // post constructs and sends a POST request to a Meross device and will return a flattened status when the method is equal to GET.
-func (m *meross) post(method string, namespace string, payload string) (*rawStatus, error) {
-	return m.Base.post(m.Host, method, namespace, payload, m.Key, m.Timeout)
+func (m *meross) post(ctx context.Context, method string, namespace string, payload []subdevicePayload) (*rawStatus, error) {
+	return m.Base.post(ctx, m.Host, method, namespace, payload, m.Key.Value(), m.Timeout)
+}
+
+// info retrieves hardware and firmware details of the hub the radiator is paired with, along with uptime and signal strength where the firmware reports them.
+func (m *meross) info(ctx context.Context, endpoint endpoint) (*device.MerossInfo, error) {
+	statusCode, all, err := m.Base.send(ctx, m.Host, "GET", endpoint.Namespace, struct{}{}, m.Key.Value(), m.Timeout)
+	if err == nil && statusCode != http.StatusOK {
+		err = fmt.Errorf("received status code %d from %s", statusCode, m.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, debug, err := m.Base.send(ctx, m.Host, "GET", device.MerossDebugNamespace, struct{}{}, m.Key.Value(), m.Timeout)
+	if err != nil {
+		logging.Log(logging.Info, "Unable to retrieve debug information from \"%s\": %v", m.Name, err)
+	}
+
+	return device.ParseMerossInfo(all, debug)
+}
+
+// temperatureStatus builds a temperature in the device's units from raw readings.
+func (m *meross) temperatureStatus(room int64, currentSet int64, openWindow int64) *temperature {
+	heating := currentSet-room > 0
+	window := openWindow != 0
+	current := device.Temperature(room, m.Units)
+	target := device.Temperature(currentSet, m.Units)
+	return &temperature{
+		Current:    &current,
+		Target:     &target,
+		Unit:       device.UnitSymbol(m.Units),
+		Heating:    &heating,
+		OpenWindow: &window,
+	}
+}
+
+// adjustStatus returns the temperature adjustment in the device's units, raw adjustments keep the original shape.
+func (m *meross) adjustStatus(value *int64) any {
+	if m.Units == "" {
+		return singleGet{
+			Value: value,
+		}
+	}
+	return temperatureGet{
+		Value: device.TemperatureDelta(*value, m.Units),
+		Unit:  device.UnitSymbol(m.Units),
+	}
+}
+
+// parseValue converts adjust values given in the device's units into tenths of a degree Celsius.
+func (m *meross) parseValue(code string, value json.Number) (json.Number, error) {
+	if code != "adjust" || value == "" || m.Units == "" {
+		return value, nil
+	}
+	tenths, err := device.ParseTemperatureDelta(value, m.Units)
+	if err != nil {
+		return "", err
+	}
+	return toJsonNumber(tenths), nil
+}
+
+// parseTarget converts a requested setpoint into tenths of a degree Celsius, rejecting values outside of the safety limits.
+func (m *meross) parseTarget(value json.Number) (json.Number, error) {
+	tenths, err := device.ParseTemperature(value, m.Units)
+	if err != nil {
+		return "", err
+	}
+
+	if !m.limits.Allows(tenths) {
+		logging.Log(logging.Error, "Rejected target %s for \"%s\", outside of safety limits (%s)", value, m.Name, m.limits.String(m.Units))
+		return "", errOutsideLimits
+	}
+	return toJsonNumber(tenths), nil
+}
+
+// targetResponse sets the response for a failed parseTarget.
+func (m *meross) targetResponse(err error) (int, []byte) {
+	if errors.Is(err, errOutsideLimits) {
+		return device.SetJSONResponse(http.StatusUnprocessableEntity, fmt.Sprintf("Target Outside Safety Limits (%s)", m.limits.String(m.Units)), nil)
+	}
+	return device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
 }
 
 // Handler is the HTTP handler for Meross device control.
@@ -313,7 +670,7 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 	var jsonResponse []byte
 	var httpCode int
 	var rawStatus *rawStatus
-	var payload string
+	var subdevices []subdevicePayload
 	var status any
 	var endpoint *endpoint
 	var err error
@@ -334,16 +691,9 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	endpoint = m.getEndpoint(request.Code)
@@ -352,6 +702,23 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	request.Value, err = m.parseValue(endpoint.Code, request.Value)
+	if err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+		return
+	}
+
+	if endpoint.Code == "target" {
+		if request.Value == "" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		if request.Value, err = m.parseTarget(request.Value); err != nil {
+			httpCode, jsonResponse = m.targetResponse(err)
+			return
+		}
+	}
+
 	if request.Value != "" && endpoint.MaxValue != 0 {
 		valueInt64, err := request.Value.Int64()
 		if err != nil || valueInt64 > endpoint.MaxValue || valueInt64 < endpoint.MinValue {
@@ -366,8 +733,8 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 	case "toggle":
 		if request.Value == "" {
 			endpoint = m.getEndpoint("status")
-			payload = fmt.Sprintf(endpoint.Template, m.Id, toJsonNumber(0))
-			rawStatus, err = m.post("GET", endpoint.Namespace, payload)
+			subdevices, _ = payload("status", []*meross{m}, "")
+			rawStatus, err = m.post(r.Context(), "GET", endpoint.Namespace, subdevices)
 			if err != nil {
 				logging.Log(logging.Error, err.Error())
 				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -378,22 +745,46 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		endpoint = m.getEndpoint("toggle")
-		payload = fmt.Sprintf(endpoint.Template, m.Id, request.Value)
-		_, err = m.post("SET", endpoint.Namespace, payload)
+		subdevices, err = payload("toggle", []*meross{m}, request.Value)
+		if err == nil {
+			_, err = m.post(r.Context(), "SET", endpoint.Namespace, subdevices)
+		}
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+	case "info":
+		info, err := m.info(r.Context(), *endpoint)
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
 		}
+
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", info)
+		return
+	case "reboot":
+		// Radiators cannot be rebooted individually, the hub they are paired with is rebooted instead
+		statusCode, _, err := m.Base.send(r.Context(), m.Host, "SET", endpoint.Namespace, struct{}{}, m.Key.Value(), m.Timeout)
+		if err == nil && statusCode != http.StatusOK {
+			err = fmt.Errorf("received status code %d from %s", statusCode, m.Host)
+		}
+		if err != nil {
+			logging.Log(logging.Error, err.Error())
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+		logging.Log(logging.Info, "Rebooting hub %s of \"%s\"", m.Host, m.Name)
 	default:
 		method := "SET"
 		if request.Value == "" {
 			method = "GET"
-			// Hacky way to keep templates consistant with two placeholders
-			request.Value = toJsonNumber(0)
 		}
-		payload = fmt.Sprintf(endpoint.Template, m.Id, request.Value)
-		rawStatus, err = m.post(method, endpoint.Namespace, payload)
+		subdevices, err = payload(endpoint.Code, []*meross{m}, request.Value)
+		if err == nil {
+			rawStatus, err = m.post(r.Context(), method, endpoint.Namespace, subdevices)
+		}
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -408,18 +799,11 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 		switch endpoint.Code {
 		case "status":
 			deviceState := rawStatus.Payload.All[0]
-			heating := deviceState.Temperature.CurrentSet-deviceState.Temperature.Room > 0
-			openWindow := deviceState.Temperature.OpenWindow != 0
 			status = statusGet{
-				Onoff:  &deviceState.Togglex.Onoff,
-				Mode:   &deviceState.Mode.State,
-				Online: &deviceState.Online.Status,
-				Temperature: &temperature{
-					Current:    &deviceState.Temperature.Room,
-					Target:     &deviceState.Temperature.CurrentSet,
-					Heating:    &heating,
-					OpenWindow: &openWindow,
-				},
+				Onoff:       &deviceState.Togglex.Onoff,
+				Mode:        &deviceState.Mode.State,
+				Online:      &deviceState.Online.Status,
+				Temperature: m.temperatureStatus(deviceState.Temperature.Room, deviceState.Temperature.CurrentSet, deviceState.Temperature.OpenWindow),
 			}
 		case "battery":
 			deviceState := rawStatus.Payload.Battery[0]
@@ -433,9 +817,7 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 			}
 		case "adjust":
 			deviceState := rawStatus.Payload.Adjust[0]
-			status = singleGet{
-				Value: &deviceState.Temperature,
-			}
+			status = m.adjustStatus(&deviceState.Temperature)
 		default:
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusNotImplemented, "Not Implemented", nil)
 			return
@@ -450,6 +832,9 @@ func (m *meross) handler(w http.ResponseWriter, r *http.Request) {
 
 // getDeviceNames returns the names of all Meross devices in the base configuration.
 func (b *base) getDeviceNames() []string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
 	var names []string
 	for _, d := range b.Devices {
 		names = append(names, d.Name)
@@ -459,6 +844,9 @@ func (b *base) getDeviceNames() []string {
 
 // getDevice retrieves a Meross device by its name.
 func (b *base) getDevice(name string) *meross {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
 	for _, d := range b.Devices {
 		if d.Name == name {
 			return d
@@ -469,6 +857,9 @@ func (b *base) getDevice(name string) *meross {
 
 // getDevice retrieves a Meross device by its ID.
 func (b *base) getDeviceById(id string) *meross {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
 	for _, d := range b.Devices {
 		if d.Id == id {
 			return d
@@ -477,6 +868,26 @@ func (b *base) getDeviceById(id string) *meross {
 	return nil
 }
 
+// refreshHandler rediscovers radiators on configured hubs, new radiators are addressable via hosts until the next restart adds their own routes.
+func (b *base) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	added := []string{}
+	for _, m := range b.discover() {
+		added = append(added, m.Name)
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", added)
+}
+
 // Handler is the HTTP handler for handling requests to control multiple Meross devices.
 // func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 // 	var jsonResponse []byte
@@ -771,7 +1182,7 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 	var jsonResponse []byte
 	var httpCode int
 	var rawStatus *rawStatus
-	var payload strings.Builder
+	var subdevices []subdevicePayload
 	var status []*namedStatus
 	var endpoint *endpoint
 	var err error
@@ -792,16 +1203,9 @@ func (b *base) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	if request.Hosts == "" {
@@ -820,6 +1224,11 @@ DUPLICATE_DEVICE:
 			return
 		}
 
+		// Devices taken out of rotation are excluded from groups
+		if !device.Enabled(m.Name) {
+			continue
+		}
+
 		endpoint = m.getEndpoint(request.Code)
 		if endpoint == nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, fmt.Sprintf("Invalid Parameter for device '%s': code", m.Name), nil)
@@ -835,22 +1244,50 @@ DUPLICATE_DEVICE:
 		devices = append(devices, m)
 	}
 
+	// info and reboot address a single device rather than a group
+	if endpoint != nil && (endpoint.Code == "info" || endpoint.Code == "reboot") {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
 	if len(devices) == 0 {
-		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusServiceUnavailable, "Service Unavailable", nil)
 		return
 	}
 
-	if request.Value != "" && endpoint.MaxValue != 0 {
-		valueInt64, err := request.Value.Int64()
-		if err != nil || valueInt64 > endpoint.MaxValue || valueInt64 < endpoint.MinValue {
-			errorMessage := fmt.Sprintf("Invalid Parameter: value (Min: %d, Max: %d)", endpoint.MinValue, endpoint.MaxValue)
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, errorMessage, nil)
+	m := devices[0]
+
+	if endpoint.Code == "target" && request.Value == "" {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+		return
+	}
+
+	// Devices may be configured with different units and limits, so the value is converted and checked for each of them
+	values := map[string]json.Number{}
+	for _, d := range devices {
+		value, err := d.parseValue(endpoint.Code, request.Value)
+		if err != nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
 			return
 		}
 
-	}
+		if endpoint.Code == "target" {
+			if value, err = d.parseTarget(value); err != nil {
+				httpCode, jsonResponse = d.targetResponse(err)
+				return
+			}
+		}
 
-	m := devices[0]
+		if value != "" && endpoint.MaxValue != 0 {
+			valueInt64, err := value.Int64()
+			if err != nil || valueInt64 > endpoint.MaxValue || valueInt64 < endpoint.MinValue {
+				errorMessage := fmt.Sprintf("Invalid Parameter: value (Min: %d, Max: %d)", endpoint.MinValue, endpoint.MaxValue)
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, errorMessage, nil)
+				return
+			}
+		}
+		values[d.Id] = value
+	}
 
 	switch endpoint.Code {
 	case "toggle":
@@ -858,14 +1295,9 @@ DUPLICATE_DEVICE:
 		if request.Value == "" {
 			request.Value = toJsonNumber(0)
 			endpoint = m.getEndpoint("status")
-			// Build array of devices to send to hub as a single post
-			for i, m := range devices {
-				payload.WriteString(fmt.Sprintf(endpoint.Template, m.Id, toJsonNumber(0)))
-				if i < len(devices)-1 {
-					payload.WriteString(",")
-				}
-			}
-			rawStatus, err = b.post(m.Host, "GET", endpoint.Namespace, payload.String(), m.Key, m.Timeout)
+			// Devices are sent to the hub as a single post
+			subdevices, _ = payload("status", devices, "")
+			rawStatus, err = b.post(r.Context(), m.Host, "GET", endpoint.Namespace, subdevices, m.Key.Value(), m.Timeout)
 			if err != nil {
 				logging.Log(logging.Error, err.Error())
 				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -882,13 +1314,10 @@ DUPLICATE_DEVICE:
 		}
 
 		endpoint = devices[0].getEndpoint("toggle")
-		for i, m := range devices {
-			payload.WriteString(fmt.Sprintf(endpoint.Template, m.Id, request.Value))
-			if i < len(devices)-1 {
-				payload.WriteString(",")
-			}
+		subdevices, err = payload("toggle", devices, request.Value)
+		if err == nil {
+			_, err = b.post(r.Context(), m.Host, "SET", endpoint.Namespace, subdevices, m.Key.Value(), m.Timeout)
 		}
-		_, err = b.post(m.Host, "SET", endpoint.Namespace, payload.String(), m.Key, m.Timeout)
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -898,16 +1327,11 @@ DUPLICATE_DEVICE:
 		method := "SET"
 		if request.Value == "" {
 			method = "GET"
-			// Hacky way to keep templates consistant with two placeholders
-			request.Value = toJsonNumber(0)
 		}
-		for i, m := range devices {
-			payload.WriteString(fmt.Sprintf(endpoint.Template, m.Id, request.Value))
-			if i < len(devices)-1 {
-				payload.WriteString(",")
-			}
+		subdevices, err = payloadValues(endpoint.Code, devices, values)
+		if err == nil {
+			rawStatus, err = b.post(r.Context(), m.Host, method, endpoint.Namespace, subdevices, m.Key.Value(), m.Timeout)
 		}
-		rawStatus, err = b.post(m.Host, method, endpoint.Namespace, payload.String(), m.Key, m.Timeout)
 		if err != nil {
 			logging.Log(logging.Error, err.Error())
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
@@ -923,20 +1347,14 @@ DUPLICATE_DEVICE:
 		case "status":
 			deviceStates := rawStatus.Payload.All
 			for i := range deviceStates {
-				heating := deviceStates[i].Temperature.CurrentSet-deviceStates[i].Temperature.Room > 0
-				openWindow := deviceStates[i].Temperature.OpenWindow != 0
+				d := b.getDeviceById(deviceStates[i].ID)
 				status = append(status, &namedStatus{
-					Name: b.getDeviceById(deviceStates[i].ID).Name,
+					Name: d.Name,
 					Status: &statusGet{
-						Onoff:  &deviceStates[i].Togglex.Onoff,
-						Mode:   &deviceStates[i].Mode.State,
-						Online: &deviceStates[i].Online.Status,
-						Temperature: &temperature{
-							Current:    &deviceStates[i].Temperature.Room,
-							Target:     &deviceStates[i].Temperature.CurrentSet,
-							Heating:    &heating,
-							OpenWindow: &openWindow,
-						},
+						Onoff:       &deviceStates[i].Togglex.Onoff,
+						Mode:        &deviceStates[i].Mode.State,
+						Online:      &deviceStates[i].Online.Status,
+						Temperature: d.temperatureStatus(deviceStates[i].Temperature.Room, deviceStates[i].Temperature.CurrentSet, deviceStates[i].Temperature.OpenWindow),
 					},
 				})
 			}
@@ -963,11 +1381,10 @@ DUPLICATE_DEVICE:
 		case "adjust":
 			deviceStates := rawStatus.Payload.Adjust
 			for i := range deviceStates {
+				d := b.getDeviceById(deviceStates[i].ID)
 				status = append(status, &namedStatus{
-					Name: b.getDeviceById(deviceStates[i].ID).Name,
-					Status: singleGet{
-						Value: &deviceStates[i].Temperature,
-					},
+					Name:   d.Name,
+					Status: d.adjustStatus(&deviceStates[i].Temperature),
 				})
 			}
 		default:
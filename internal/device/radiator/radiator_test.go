@@ -0,0 +1,191 @@
+package radiator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read radiator input")
+	}
+
+	radiatorConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &radiatorConfig); err != nil {
+		t.Fatalf("Could not read radiator input")
+	}
+	return &radiatorConfig
+}
+
+// fakeHub emulates a Meross hub, recording the subdevice payloads of each SET it receives.
+type fakeHub struct {
+	mutex sync.Mutex
+	sets  map[string][]subdevicePayload
+}
+
+func (h *fakeHub) handler(w http.ResponseWriter, r *http.Request) {
+	message := struct {
+		Header struct {
+			Method    string `json:"method"`
+			Namespace string `json:"namespace"`
+		} `json:"header"`
+		Payload map[string][]subdevicePayload `json:"payload"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&message)
+
+	h.mutex.Lock()
+	if message.Header.Method == "SET" {
+		for _, subdevices := range message.Payload {
+			h.sets[message.Header.Namespace] = subdevices
+		}
+	}
+	h.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"payload":{}}`))
+}
+
+// value returns a pointer for comparing payload fields.
+func value(v int64) *int64 {
+	return &v
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		expectedCode int
+		expectedBody string
+		expectedSets map[string][]subdevicePayload
+	}{
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/radiator",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["lounge","office","hall"]}`,
+		},
+		{
+			name:         "single_target",
+			method:       "POST",
+			url:          "/radiator/office?code=target&value=70",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSets: map[string][]subdevicePayload{
+				"Appliance.Hub.Mts100.Temperature": {{ID: "03000BD2", Custom: value(211)}},
+			},
+		},
+		{
+			name:         "group_target_mixed_units",
+			method:       "POST",
+			url:          "/radiator?code=target&value=21&hosts=lounge,hall",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSets: map[string][]subdevicePayload{
+				"Appliance.Hub.Mts100.Temperature": {{ID: "03000BD1", Custom: value(210)}, {ID: "03000BD3", Custom: value(21)}},
+			},
+		},
+		{
+			name:         "group_target_outside_limits_of_later_device",
+			method:       "POST",
+			url:          "/radiator?code=target&value=21&hosts=lounge,office",
+			expectedCode: 422,
+			expectedBody: `{"version":1,"message":"Target Outside Safety Limits (Min: 41, Max: 77)"}`,
+		},
+		{
+			name:         "group_target_in_units_of_each_device",
+			method:       "POST",
+			url:          "/radiator?code=target&value=70&hosts=office,lounge",
+			expectedCode: 422,
+			expectedBody: `{"version":1,"message":"Target Outside Safety Limits (Min: 5, Max: 25)"}`,
+		},
+		{
+			name:         "group_target_missing_value",
+			method:       "POST",
+			url:          "/radiator?code=target&hosts=lounge,office",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "group_adjust_mixed_units",
+			method:       "POST",
+			url:          "/radiator?code=adjust&value=1&hosts=lounge,office",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSets: map[string][]subdevicePayload{
+				"Appliance.Hub.Mts100.Adjust": {{ID: "03000BD1", Temperature: value(10)}, {ID: "03000BD2", Temperature: value(6)}},
+			},
+		},
+		{
+			name:         "group_toggle",
+			method:       "POST",
+			url:          "/radiator?code=toggle&value=1&hosts=lounge,office,hall",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedSets: map[string][]subdevicePayload{
+				"Appliance.Hub.ToggleX": {
+					{Channel: value(0), ID: "03000BD1", Onoff: value(1)},
+					{Channel: value(0), ID: "03000BD2", Onoff: value(1)},
+					{Channel: value(0), ID: "03000BD3", Onoff: value(1)},
+				},
+			},
+		},
+	}
+
+	h := &fakeHub{}
+	server := httptest.NewServer(http.HandlerFunc(h.handler))
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/radiatorConfig/group_config.yaml"), "device.yaml")
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		d.Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h.sets = map[string][]subdevicePayload{}
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedSets == nil {
+				assert.Empty(t, h.sets)
+				return
+			}
+			assert.Equal(t, tc.expectedSets, h.sets)
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// resolve walks a dot separated path through decoded JSON objects and arrays.
+func resolve(data any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch value := data.(type) {
+		case map[string]any:
+			var ok bool
+			if data, ok = value[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil, false
+			}
+			data = value[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// include returns the parts of an object found at each path, keeping their nesting. Paths that cannot be resolved are left out.
+func include(data any, paths []string) any {
+	if _, ok := data.(map[string]any); !ok {
+		return data
+	}
+
+	projection := map[string]any{}
+	for _, path := range paths {
+		value, ok := resolve(data, path)
+		if !ok {
+			continue
+		}
+		keys := strings.Split(path, ".")
+		object := projection
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := object[key].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				object[key] = next
+			}
+			object = next
+		}
+		object[keys[len(keys)-1]] = value
+	}
+	return projection
+}
+
+// exclude removes the value at each path from an object.
+func exclude(data any, paths []string) {
+	for _, path := range paths {
+		parent, key := data, path
+		if i := strings.LastIndex(path, "."); i != -1 {
+			parent, _ = resolve(data, path[:i])
+			key = path[i+1:]
+		}
+		if object, ok := parent.(map[string]any); ok {
+			delete(object, key)
+		}
+	}
+}
+
+// less orders two JSON values, numbers numerically and everything else by its string form.
+func less(a any, b any) bool {
+	aNumber, aIsNumber := a.(json.Number)
+	bNumber, bIsNumber := b.(json.Number)
+	if aIsNumber && bIsNumber {
+		aFloat, _ := aNumber.Float64()
+		bFloat, _ := bNumber.Float64()
+		return aFloat < bFloat
+	}
+	aBytes, _ := json.Marshal(a)
+	bBytes, _ := json.Marshal(b)
+	return string(aBytes) < string(bBytes)
+}
+
+// sortDevices orders the entries of a multi-device response by a path, looked up on the entry itself, e.g. name, then within its status.
+// A leading '-' sorts in descending order, entries without the path sort last either way.
+func sortDevices(devices []any, path string) {
+	descending := strings.HasPrefix(path, "-")
+	path = strings.TrimPrefix(path, "-")
+
+	key := func(entry any) (any, bool) {
+		if value, ok := resolve(entry, path); ok {
+			return value, true
+		}
+		return resolve(entry, "status."+path)
+	}
+
+	sort.SliceStable(devices, func(i int, j int) bool {
+		a, aOk := key(devices[i])
+		b, bOk := key(devices[j])
+		if !aOk || !bOk {
+			return aOk && !bOk
+		}
+		if descending {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
+
+// summarise reduces an entry of a multi-device response to its name and, when its status has one, its onoff state.
+func summarise(entry any) any {
+	object, ok := entry.(map[string]any)
+	if !ok {
+		return entry
+	}
+	summary := map[string]any{"name": object["name"]}
+	if onoff, ok := resolve(object, "status.onoff"); ok {
+		summary["onoff"] = onoff
+	}
+	return summary
+}
+
+// reshape wraps a device handler so that POST responses can be trimmed for constrained clients. A fields query parameter lists the dot
+// separated paths to keep in a status, or to remove when prefixed with '-', and a sort parameter orders the devices of a multi-device response.
+// Multi-device responses can also be paged with limit and offset parameters, ordered by name unless sorted otherwise, and reduced to the name
+// and onoff state of each device with a summary parameter. The number of devices before paging is returned in an X-Total-Count header.
+// Paging trims the response, so every device is still sent the request.
+func reshape(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodPost || common.Streaming(r) || !(query.Has("fields") || query.Has("sort") || query.Has("limit") || query.Has("offset") || query.Has("summary")) {
+			handler(w, r)
+			return
+		}
+
+		invalid := func(parameter string) {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: "+parameter, nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+		}
+
+		includes, excludes := []string{}, []string{}
+		if query.Has("fields") {
+			for _, field := range strings.Split(query.Get("fields"), ",") {
+				field = strings.TrimSpace(field)
+				if strings.Trim(field, "-.") == "" || strings.Contains(field, "..") {
+					invalid("fields")
+					return
+				}
+				if strings.HasPrefix(field, "-") {
+					excludes = append(excludes, field[1:])
+				} else {
+					includes = append(includes, field)
+				}
+			}
+		}
+		sortPath := query.Get("sort")
+		if query.Has("sort") && strings.Trim(sortPath, "-.") == "" {
+			invalid("sort")
+			return
+		}
+
+		limit, offset := -1, 0
+		for _, p := range []struct {
+			name  string
+			value *int
+		}{{"limit", &limit}, {"offset", &offset}} {
+			if !query.Has(p.name) {
+				continue
+			}
+			n, err := strconv.Atoi(query.Get(p.name))
+			if err != nil || n < 0 {
+				invalid(p.name)
+				return
+			}
+			*p.value = n
+		}
+		paged := query.Has("limit") || query.Has("offset")
+
+		summary := false
+		if query.Has("summary") {
+			var err error
+			if summary, err = strconv.ParseBool(query.Get("summary")); err != nil {
+				invalid("summary")
+				return
+			}
+		}
+
+		// Device handlers reject unknown query parameters
+		for _, p := range []string{"fields", "sort", "limit", "offset", "summary"} {
+			query.Del(p)
+		}
+		r.URL.RawQuery = query.Encode()
+
+		recorder := recorder{}
+		handler(&recorder, r)
+
+		response := common.Response{}
+		decoder := json.NewDecoder(bytes.NewReader(recorder.body.Bytes()))
+		decoder.UseNumber()
+		if (recorder.code != http.StatusOK && recorder.code != http.StatusMultiStatus) || decoder.Decode(&response) != nil || response.Data == nil {
+			copyResponse(w, &recorder)
+			return
+		}
+
+		trim := func(status any) any {
+			if len(includes) > 0 {
+				status = include(status, includes)
+			}
+			exclude(status, excludes)
+			return status
+		}
+
+		// Multi-device responses list their devices either as the data itself or under data.devices
+		list, isList := response.Data.([]any)
+		if devices, ok := resolve(response.Data, "devices"); ok {
+			list, isList = devices.([]any)
+		}
+		if !isList {
+			response.Data = trim(response.Data)
+		} else {
+			for _, entry := range list {
+				if object, ok := entry.(map[string]any); ok && object["status"] != nil {
+					object["status"] = trim(object["status"])
+				}
+			}
+			// Devices are listed in the order they answered, so pages need a stable order
+			if sortPath == "" && paged {
+				sortPath = "name"
+			}
+			if sortPath != "" {
+				sortDevices(list, sortPath)
+			}
+			if summary {
+				for i, entry := range list {
+					list[i] = summarise(entry)
+				}
+			}
+			if paged {
+				w.Header().Set("X-Total-Count", strconv.Itoa(len(list)))
+				// Each is clamped on its own, as adding them could overflow
+				offset = min(offset, len(list))
+				if limit == -1 {
+					limit = len(list)
+				}
+				limit = min(limit, len(list)-offset)
+				list = list[offset : offset+limit]
+			}
+			if object, ok := response.Data.(map[string]any); ok {
+				object["devices"] = list
+			} else {
+				response.Data = list
+			}
+		}
+
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			copyResponse(w, &recorder)
+			return
+		}
+		common.JSONResponse(w, recorder.code, jsonResponse)
+	}
+}
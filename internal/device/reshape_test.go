@@ -0,0 +1,152 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// devicesHandler answers every request with data, as a device handler would with the result of a multi-device request.
+func devicesHandler(data any) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", data)
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}
+}
+
+func TestReshapePaging(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	handler := reshape(devicesHandler([]map[string]any{
+		{"name": "plug", "status": map[string]any{"onoff": 1}},
+		{"name": "lamp", "status": map[string]any{"onoff": 0}},
+		{"name": "fan", "status": map[string]any{"onoff": 1}},
+	}))
+
+	testCases := []struct {
+		name         string
+		query        string
+		expectedBody string
+	}{
+		{
+			name:         "ordered_by_name",
+			query:        "limit=2",
+			expectedBody: `{"version":1,"message":"OK","data":[{"name":"fan","status":{"onoff":1}},{"name":"lamp","status":{"onoff":0}}]}`,
+		},
+		{
+			name:         "offset",
+			query:        "offset=2",
+			expectedBody: `{"version":1,"message":"OK","data":[{"name":"plug","status":{"onoff":1}}]}`,
+		},
+		{
+			name:         "offset_past_end",
+			query:        "offset=5&limit=1",
+			expectedBody: `{"version":1,"message":"OK","data":[]}`,
+		},
+		{
+			name:         "limit_overflows_with_offset",
+			query:        "offset=1&limit=9223372036854775807",
+			expectedBody: `{"version":1,"message":"OK","data":[{"name":"lamp","status":{"onoff":0}},{"name":"plug","status":{"onoff":1}}]}`,
+		},
+		{
+			name:         "summary",
+			query:        "summary=1&sort=-name&limit=1",
+			expectedBody: `{"version":1,"message":"OK","data":[{"name":"plug","onoff":1}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequest(http.MethodPost, "/meross?code=status&"+tc.query, nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, "3", recorder.Header().Get("X-Total-Count"))
+			assert.Equal(t, tc.expectedBody, recorder.Body.String())
+		})
+	}
+
+	// Negative and malformed paging parameters are rejected before the request is sent
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/meross?code=status&limit=-1", nil))
+	assert.Equal(t, `{"version":1,"message":"Invalid Parameter: limit"}`, recorder.Body.String())
+}
+
+func TestReshape(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	status := map[string]any{"onoff": 1, "light": map[string]any{"rgb": 255, "luminance": 50}, "info": map[string]any{"firmware": "2.1.4"}}
+	devices := []map[string]any{
+		{"name": "lamp", "status": map[string]any{"onoff": 1, "light": map[string]any{"luminance": 20}}},
+		{"name": "plug", "status": map[string]any{"onoff": 0}},
+		{"name": "desk", "status": map[string]any{"onoff": 1, "light": map[string]any{"luminance": 80}}},
+	}
+
+	testCases := []struct {
+		name         string
+		data         any
+		query        string
+		expectedBody string
+	}{
+		{
+			name:         "nested_fields",
+			data:         status,
+			query:        "fields=onoff,light.luminance",
+			expectedBody: `{"version":1,"message":"OK","data":{"light":{"luminance":50},"onoff":1}}`,
+		},
+		{
+			name:         "unknown_fields_left_out",
+			data:         status,
+			query:        "fields=onoff,light.rgb.red,missing",
+			expectedBody: `{"version":1,"message":"OK","data":{"onoff":1}}`,
+		},
+		{
+			name:         "excluded_fields",
+			data:         status,
+			query:        "fields=-info,-light.rgb",
+			expectedBody: `{"version":1,"message":"OK","data":{"light":{"luminance":50},"onoff":1}}`,
+		},
+		{
+			name:         "fields_of_each_device_in_list",
+			data:         devices[:2],
+			query:        "fields=onoff",
+			expectedBody: `{"version":1,"message":"OK","data":[{"name":"lamp","status":{"onoff":1}},{"name":"plug","status":{"onoff":0}}]}`,
+		},
+		{
+			name:         "sort_descending_by_status",
+			data:         devices,
+			query:        "sort=-light.luminance&fields=light",
+			expectedBody: `{"version":1,"message":"OK","data":[{"name":"desk","status":{"light":{"luminance":80}}},{"name":"lamp","status":{"light":{"luminance":20}}},{"name":"plug","status":{}}]}`,
+		},
+		{
+			name:         "missing_sort_key_last",
+			data:         devices,
+			query:        "sort=light.luminance&fields=-onoff",
+			expectedBody: `{"version":1,"message":"OK","data":[{"name":"lamp","status":{"light":{"luminance":20}}},{"name":"desk","status":{"light":{"luminance":80}}},{"name":"plug","status":{}}]}`,
+		},
+		{
+			name:         "devices_under_data",
+			data:         map[string]any{"devices": devices, "errors": []any{map[string]any{"name": "fan", "code": 504}}},
+			query:        "sort=name&summary=1",
+			expectedBody: `{"version":1,"message":"OK","data":{"devices":[{"name":"desk","onoff":1},{"name":"lamp","onoff":1},{"name":"plug","onoff":0}],"errors":[{"code":504,"name":"fan"}]}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			reshape(devicesHandler(tc.data))(recorder, httptest.NewRequest(http.MethodPost, "/meross?code=status&"+tc.query, nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.expectedBody, recorder.Body.String())
+		})
+	}
+
+	// Fields and sorts that name nothing are rejected
+	for _, query := range []string{"fields=-", "fields=light..rgb", "sort=-"} {
+		recorder := httptest.NewRecorder()
+		reshape(devicesHandler(status))(recorder, httptest.NewRequest(http.MethodPost, "/lamp?code=status&"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+}
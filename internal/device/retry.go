@@ -0,0 +1,238 @@
+package device
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+const (
+	// Operations can be retried for this long after they failed
+	retryTimeout = time.Hour
+	// Operations kept at most, the oldest are dropped to make room for new ones
+	maxOperations = 100
+)
+
+// operation is a multi-device request that failed on some of its hosts, kept so that it can be sent again to just those hosts.
+type operation struct {
+	path        string
+	contentType string
+	query       url.Values
+	body        []byte
+	hosts       []string
+	expires     time.Time
+}
+
+// retrier remembers multi-device requests that failed on some of their hosts. Their responses carry an operation token, and a request
+// to the same route with retryFailed=true and the token sends the original request again to only the hosts that failed.
+type retrier struct {
+	operations map[string]*operation
+	mutex      sync.Mutex
+}
+
+func newRetrier() *retrier {
+	return &retrier{
+		operations: map[string]*operation{},
+	}
+}
+
+// issue stores an operation and returns its token.
+func (rt *retrier) issue(op *operation, now time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	var oldest string
+	for t, o := range rt.operations {
+		if now.After(o.expires) {
+			delete(rt.operations, t)
+		} else if oldest == "" || o.expires.Before(rt.operations[oldest].expires) {
+			oldest = t
+		}
+	}
+	if len(rt.operations) >= maxOperations {
+		delete(rt.operations, oldest)
+	}
+	op.expires = now.Add(retryTimeout)
+	rt.operations[token] = op
+	return token, nil
+}
+
+// take consumes the operation of a token, returning nil if it is unknown, has expired or was issued for another route.
+func (rt *retrier) take(token string, path string, now time.Time) *operation {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	op, ok := rt.operations[token]
+	if !ok || op.path != path || now.After(op.expires) {
+		return nil
+	}
+	delete(rt.operations, token)
+	return op
+}
+
+// restore puts back an operation that was taken but not retried, e.g. because the retry must be confirmed first.
+func (rt *retrier) restore(token string, op *operation) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	rt.operations[token] = op
+}
+
+// request rebuilds the original request of an operation, addressed to the hosts that failed. A confirmation token sent with the retry
+// is passed on, as the original's was consumed when it was sent.
+func (op *operation) request(r *http.Request) (*http.Request, error) {
+	hosts := strings.Join(op.hosts, ",")
+	query := url.Values{}
+	for k, v := range op.query {
+		query[k] = v
+	}
+	if confirm := r.URL.Query().Get("confirm"); confirm != "" {
+		query.Set("confirm", confirm)
+	}
+
+	body := op.body
+	if op.contentType == "application/json" {
+		request := map[string]any{}
+		decoder := json.NewDecoder(bytes.NewReader(op.body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&request); err != nil {
+			return nil, err
+		}
+		request["hosts"] = hosts
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return nil, err
+		}
+	} else {
+		query.Set("hosts", hosts)
+	}
+
+	retry := r.Clone(r.Context())
+	retry.Method = http.MethodPost
+	retry.URL.RawQuery = query.Encode()
+	retry.Header.Set("Content-Type", op.contentType)
+	retry.Body = io.NopCloser(bytes.NewReader(body))
+	retry.ContentLength = int64(len(body))
+	return retry, nil
+}
+
+// failedHosts returns the names listed in the errors of the data of a multi-device response.
+func failedHosts(data map[string]json.RawMessage) []string {
+	failures := []common.Failure{}
+	if json.Unmarshal(data["errors"], &failures) != nil {
+		return nil
+	}
+	hosts := []string{}
+	for _, f := range failures {
+		hosts = append(hosts, f.Name)
+	}
+	return hosts
+}
+
+// wrap returns a handler that issues an operation token for multi-device requests that failed on some of their hosts, and retries
+// the operation of a token against only those hosts when sent with retryFailed=true. Both parameters are removed before the request
+// reaches the device handler.
+func (rt *retrier) wrap(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Dry runs and streamed responses act on nothing and report failures as they happen respectively
+		if r.Method != http.MethodPost || common.DryRunning(r.Context()) || common.Streaming(r) {
+			handler(w, r)
+			return
+		}
+
+		now := time.Now()
+		query := r.URL.Query()
+		var retried *operation
+		retriedToken := query.Get("operation")
+		if query.Has("retryFailed") || query.Has("operation") {
+			if retry, err := strconv.ParseBool(query.Get("retryFailed")); err != nil || !retry {
+				httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: retryFailed", nil)
+				common.JSONResponse(w, httpCode, jsonResponse)
+				return
+			}
+			op := rt.take(retriedToken, r.URL.Path, now)
+			if op == nil {
+				httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: operation", nil)
+				common.JSONResponse(w, httpCode, jsonResponse)
+				return
+			}
+			retried = op
+			var err error
+			if r, err = op.request(r); err != nil {
+				httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: operation", nil)
+				common.JSONResponse(w, httpCode, jsonResponse)
+				return
+			}
+			query = r.URL.Query()
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			body = nil
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		recorder := recorder{}
+		handler(&recorder, r)
+
+		// Retries of codes that need confirming are answered with a token first, the operation is kept for the confirmed retry
+		if retried != nil && recorder.code == http.StatusAccepted {
+			rt.restore(retriedToken, retried)
+		}
+
+		// The data is kept raw so that the response is passed on as it was written, with only the token added
+		response := struct {
+			Version int                        `json:"version"`
+			Message string                     `json:"message"`
+			Data    map[string]json.RawMessage `json:"data"`
+		}{}
+		if json.Unmarshal(recorder.body.Bytes(), &response) != nil {
+			copyResponse(w, &recorder)
+			return
+		}
+		hosts := failedHosts(response.Data)
+		if len(hosts) == 0 {
+			copyResponse(w, &recorder)
+			return
+		}
+
+		// Confirmation tokens are consumed when used, so a retry must be confirmed afresh
+		query.Del("hosts")
+		query.Del("confirm")
+		token, err := rt.issue(&operation{
+			path:        r.URL.Path,
+			contentType: r.Header.Get("Content-Type"),
+			query:       query,
+			body:        body,
+			hosts:       hosts,
+		}, now)
+		if err != nil {
+			copyResponse(w, &recorder)
+			return
+		}
+
+		response.Data["operation"], _ = json.Marshal(token)
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			copyResponse(w, &recorder)
+			return
+		}
+		for k, v := range recorder.Header() {
+			w.Header()[k] = v
+		}
+		common.JSONResponse(w, recorder.code, jsonResponse)
+	}
+}
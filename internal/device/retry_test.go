@@ -0,0 +1,193 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// operationResponse is the data of a response that failed on some of its hosts.
+type operationResponse struct {
+	Data struct {
+		Devices   []string         `json:"devices"`
+		Errors    []common.Failure `json:"errors"`
+		Operation string           `json:"operation"`
+	} `json:"data"`
+}
+
+func TestRetryFailed(t *testing.T) {
+	rt := newRetrier()
+
+	failing := map[string]bool{"b": true, "c": true}
+	requests := []string{}
+	handler := rt.wrap(func(w http.ResponseWriter, r *http.Request) {
+		request := common.Request{}
+		if err := common.DecodeRequest(r, &request); err != nil {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+		requests = append(requests, fmt.Sprintf("%s=%s@%s", request.Code, request.Value, request.Hosts))
+
+		devices := []string{}
+		failures := []common.Failure{}
+		for _, host := range strings.Split(request.Hosts, ",") {
+			if failing[host] {
+				failures = append(failures, common.Failure{Name: host, Code: http.StatusGatewayTimeout, Error: "Gateway Timeout"})
+				continue
+			}
+			devices = append(devices, host)
+		}
+
+		if len(failures) == 0 {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", map[string]any{"devices": devices})
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusMultiStatus, "Multi-Status", map[string]any{"devices": devices, "errors": failures})
+		common.JSONResponse(w, httpCode, jsonResponse)
+	})
+
+	send := func(url string, body string) (*httptest.ResponseRecorder, operationResponse) {
+		request := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if body != "" {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		response := operationResponse{}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder, response
+	}
+
+	// Requests that fail on some hosts are answered as written with an operation token added
+	recorder, response := send("/meross?code=toggle&value=1&hosts=a,b,c", "")
+	assert.Equal(t, http.StatusMultiStatus, recorder.Code)
+	assert.Equal(t, []string{"a"}, response.Data.Devices)
+	assert.Len(t, response.Data.Errors, 2)
+	assert.NotEmpty(t, response.Data.Operation)
+
+	// Retrying sends the original request to only the hosts that failed, issuing a new token for those that fail again
+	failing["b"] = false
+	token := response.Data.Operation
+	recorder, response = send("/meross?retryFailed=true&operation="+token, "")
+	assert.Equal(t, http.StatusMultiStatus, recorder.Code)
+	assert.Equal(t, []string{"b"}, response.Data.Devices)
+	assert.NotEmpty(t, response.Data.Operation)
+	assert.NotEqual(t, token, response.Data.Operation)
+	assert.Equal(t, []string{"toggle=1@a,b,c", "toggle=1@b,c"}, requests)
+
+	// Tokens cannot be replayed or used on another route
+	recorder, _ = send("/meross?retryFailed=true&operation="+token, "")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, `{"version":1,"message":"Invalid Parameter: operation"}`, recorder.Body.String())
+	recorder, _ = send("/meross_thermostat?retryFailed=true&operation="+response.Data.Operation, "")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder, _ = send("/meross?operation="+response.Data.Operation, "")
+	assert.Equal(t, `{"version":1,"message":"Invalid Parameter: retryFailed"}`, recorder.Body.String())
+	assert.Len(t, requests, 2)
+
+	// The token was not consumed by the rejected retries, once every host succeeds no token is issued
+	failing["c"] = false
+	recorder, response = send("/meross?retryFailed=true&operation="+response.Data.Operation, "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"c"}, response.Data.Devices)
+	assert.Empty(t, response.Data.Operation)
+
+	// Hosts are replaced in JSON bodies rather than the query
+	failing["b"] = true
+	_, response = send("/meross", `{"code":"luminance","value":50,"hosts":"a,b"}`)
+	_, _ = send("/meross?retryFailed=true&operation="+response.Data.Operation, "")
+	assert.Equal(t, []string{"luminance=50@a,b", "luminance=50@b"}, requests[len(requests)-2:])
+}
+
+func TestRetryConfirmed(t *testing.T) {
+	rt := newRetrier()
+	c := newConfirmer(map[string][]string{"b": {"toggle"}})
+
+	failing := map[string]bool{"b": true, "c": true}
+	requests := []string{}
+	handler := rt.wrap(c.wrap("meross", func(w http.ResponseWriter, r *http.Request) {
+		request := common.Request{}
+		if err := common.DecodeRequest(r, &request); err != nil {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+		requests = append(requests, request.Hosts)
+
+		devices := []string{}
+		failures := []common.Failure{}
+		for _, host := range strings.Split(request.Hosts, ",") {
+			if failing[host] {
+				failures = append(failures, common.Failure{Name: host, Code: http.StatusGatewayTimeout, Error: "Gateway Timeout"})
+				continue
+			}
+			devices = append(devices, host)
+		}
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusMultiStatus, "Multi-Status", map[string]any{"devices": devices, "errors": failures})
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}))
+
+	send := func(url string) (int, string, string) {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPost, url, nil))
+		response := struct {
+			Data struct {
+				Token     string `json:"token"`
+				Operation string `json:"operation"`
+			} `json:"data"`
+		}{}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Data.Token, response.Data.Operation
+	}
+
+	code, confirm, _ := send("/meross?code=toggle&hosts=a,b,c")
+	assert.Equal(t, http.StatusAccepted, code)
+	code, _, operation := send("/meross?code=toggle&hosts=a,b,c&confirm=" + confirm)
+	assert.Equal(t, http.StatusMultiStatus, code)
+
+	// The used confirmation token is not replayed, the retry asks for confirmation of its own and keeps the operation until it is given
+	failing["b"] = false
+	code, confirm, _ = send("/meross?retryFailed=true&operation=" + operation)
+	assert.Equal(t, http.StatusAccepted, code)
+	code, _, retried := send("/meross?retryFailed=true&operation=" + operation + "&confirm=" + confirm)
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.NotEmpty(t, retried)
+	assert.Equal(t, []string{"a,b,c", "b,c"}, requests)
+
+	// Codes that need no confirmation are retried straight away
+	code, _, _ = send("/meross?retryFailed=true&operation=" + retried)
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.Equal(t, []string{"a,b,c", "b,c", "c"}, requests)
+}
+
+func TestRetrierOperations(t *testing.T) {
+	rt := newRetrier()
+	now := time.Now()
+
+	// Operations expire
+	token, err := rt.issue(&operation{path: "/meross"}, now)
+	assert.NoError(t, err)
+	assert.Nil(t, rt.take(token, "/meross", now.Add(retryTimeout+time.Second)))
+	token, _ = rt.issue(&operation{path: "/meross"}, now)
+	assert.NotNil(t, rt.take(token, "/meross", now.Add(retryTimeout)))
+
+	// The oldest operation is dropped to make room for new ones
+	oldest, _ := rt.issue(&operation{path: "/meross"}, now)
+	for i := 1; i < maxOperations; i++ {
+		rt.issue(&operation{path: "/meross"}, now.Add(time.Duration(i)*time.Second))
+	}
+	newest, _ := rt.issue(&operation{path: "/meross"}, now.Add(time.Duration(maxOperations)*time.Second))
+	assert.Len(t, rt.operations, maxOperations)
+	assert.Nil(t, rt.take(oldest, "/meross", now))
+	assert.NotNil(t, rt.take(newest, "/meross", now))
+}
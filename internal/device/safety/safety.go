@@ -0,0 +1,516 @@
+// Package safety turns water leak and smoke detector alarms received over MQTT into emergency alerts, optionally running mitigation
+// actions such as closing a water valve or turning on lights, and sends periodic test alarms to prove the pipeline works.
+package safety
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/i18n"
+	"github.com/kennedn/restate-go/internal/common/inbox"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+// Pushover emergency priority, which bypasses quiet hours and repeats until acknowledged
+const emergencyPriority = 2
+
+// Field that detectors publish their alarm state in by kind, as named by zigbee2mqtt
+var kindPaths = map[string]string{
+	"leak":  "water_leak",
+	"smoke": "smoke",
+}
+
+// alertTarget is a single pushover compatible endpoint that alarms are fanned out to.
+type alertTarget struct {
+	URL   string        `yaml:"url"`
+	Token config.Secret `yaml:"token"`
+	User  string        `yaml:"user"`
+}
+
+// event is the representation of an alarm or test returned by the status code.
+type event struct {
+	Time      string `json:"time"`
+	Alerted   int    `json:"alerted"`
+	Mitigated *int   `json:"mitigated,omitempty"`
+}
+
+// status is the representation of a detector returned by the status code.
+type status struct {
+	Alarm     bool   `json:"alarm"`
+	LastAlarm *event `json:"lastAlarm,omitempty"`
+	LastTest  *event `json:"lastTest,omitempty"`
+}
+
+// safety represents a detector configuration with its MQTT topic, alert targets and mitigation actions.
+type safety struct {
+	Name       string          `yaml:"name"`
+	Timeout    uint            `yaml:"timeoutMs"`
+	Kind       string          `yaml:"kind"`
+	Message    string          `yaml:"message"`
+	Retry      int             `yaml:"retrySeconds"`
+	Expire     int             `yaml:"expireSeconds"`
+	TestHours  uint            `yaml:"testIntervalHours"`
+	Alerts     []*alertTarget  `yaml:"alerts"`
+	Mitigation []device.Action `yaml:"mitigation"`
+	MQTT       struct {
+		Host    string `yaml:"host"`
+		Port    int    `yaml:"port"`
+		Topic   string `yaml:"topic"`
+		Path    string `yaml:"path"`
+		Payload string `yaml:"payload"`
+	} `yaml:"mqtt"`
+	Base      base
+	alarm     bool
+	lastAlarm *event
+	lastTest  *event
+	mutex     sync.Mutex
+}
+
+// base represents a list of detectors
+type base struct {
+	Devices []*safety
+}
+
+type Device struct{}
+
+// DryRun lists the targets a test alarm would reach, the inbox and last test are left alone.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for detectors based on a provided configuration, subscribing to their topics and scheduling test alarms.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	base, routes, err := routes(config)
+	if err != nil {
+		return routes, err
+	}
+
+	for _, s := range base.Devices {
+		clientOpts := mqtt.NewClientOptions()
+		clientOpts.SetCleanSession(false)
+		clientOpts.AddBroker(fmt.Sprintf("tcp://%s:%d", s.MQTT.Host, s.MQTT.Port))
+		clientOpts.SetClientID("restate-go-safety-" + s.Name)
+		s.subscribe(mqtt.NewClient(clientOpts))
+
+		if s.TestHours > 0 {
+			go s.runTests()
+		}
+	}
+
+	return routes, err
+}
+
+// routes extracts smoke and leak detectors from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "safety" {
+			continue
+		}
+		safety := safety{
+			Retry:  60,
+			Expire: 3600,
+			Base:   base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &safety); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if safety.Name == "" || safety.Timeout == 0 || safety.Kind == "" || safety.MQTT.Host == "" || safety.MQTT.Topic == "" || len(safety.Alerts) == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if err := safety.validate(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", safety.Name, err)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + safety.Name,
+			Handler: safety.handler,
+		})
+
+		base.Devices = append(base.Devices, &safety)
+
+		logging.Log(logging.Info, "Found device \"%s\"", safety.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/safety" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/safety",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/safety/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// validate checks the kind of detector and its alert targets, filling in defaults.
+func (s *safety) validate() error {
+	path, ok := kindPaths[s.Kind]
+	if !ok {
+		return errors.New("kind must be either 'leak' or 'smoke'")
+	}
+	if s.MQTT.Path == "" {
+		s.MQTT.Path = path
+	}
+	if s.MQTT.Port == 0 {
+		s.MQTT.Port = 1883
+	}
+
+	// Pushover requires emergency alerts to be retried at least every 30 seconds for at most 3 hours
+	if s.Retry < 30 || s.Expire <= 0 || s.Expire > 10800 {
+		return errors.New("retrySeconds must be at least 30 and expireSeconds between 1 and 10800")
+	}
+
+	for _, a := range s.Alerts {
+		if a.Token == "" {
+			return errors.New("alerts must have a token")
+		}
+		if a.URL == "" {
+			a.URL = "https://api.pushover.net/1/messages.json"
+		}
+	}
+	for _, a := range s.Mitigation {
+		if a.URL == "" || a.Code == "" {
+			return errors.New("mitigation actions must have a url and code")
+		}
+	}
+	return nil
+}
+
+// alarmed reports whether a message from the detector signals an alarm, either matching the configured payload or with a true value
+// at the configured path of a JSON payload.
+func (s *safety) alarmed(payload []byte) (bool, error) {
+	if s.MQTT.Payload != "" {
+		return string(payload) == s.MQTT.Payload, nil
+	}
+
+	var data any
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return false, err
+	}
+	for _, key := range strings.Split(s.MQTT.Path, ".") {
+		object, ok := data.(map[string]any)
+		if !ok {
+			return false, fmt.Errorf("field \"%s\" not found", s.MQTT.Path)
+		}
+		if data, ok = object[key]; !ok {
+			return false, fmt.Errorf("field \"%s\" not found", s.MQTT.Path)
+		}
+	}
+
+	switch value := data.(type) {
+	case bool:
+		return value, nil
+	case string:
+		return strings.EqualFold(value, "on") || strings.EqualFold(value, "true"), nil
+	}
+	return false, fmt.Errorf("field \"%s\" is not a boolean", s.MQTT.Path)
+}
+
+// subscribe connects an MQTT client and handles each message published by the detector.
+func (s *safety) subscribe(client mqtt.Client) {
+	token := client.Connect()
+	if err := mqtt.WaitTokenTimeout(token, time.Duration(s.Timeout)*time.Millisecond); err != nil {
+		logging.Log(logging.Error, "Detector \"%s\" failed to connect to MQTT: %v", s.Name, err)
+		return
+	}
+
+	token = client.Subscribe(s.MQTT.Topic, 1, func(_ mqtt.Client, message mqtt.Message) {
+		alarm, err := s.alarmed(message.Payload())
+		if err != nil {
+			logging.Log(logging.Error, "Detector \"%s\" sent an invalid message: %v", s.Name, err)
+			return
+		}
+		s.update(alarm)
+	})
+	if err := mqtt.WaitTokenTimeout(token, time.Duration(s.Timeout)*time.Millisecond); err != nil {
+		logging.Log(logging.Error, "Detector \"%s\" failed to subscribe to MQTT topic: %v", s.Name, err)
+	}
+}
+
+// update records the alarm state of the detector. Raising an alarm sends emergency alerts and runs the mitigation actions, clearing
+// one sends a normal alert. Detectors repeat their state, so only changes are acted on.
+func (s *safety) update(alarm bool) {
+	s.mutex.Lock()
+	if alarm == s.alarm {
+		s.mutex.Unlock()
+		return
+	}
+	s.alarm = alarm
+	s.mutex.Unlock()
+
+	if !alarm {
+		logging.Log(logging.Info, "Detector \"%s\" cleared", s.Name)
+		s.fanOut(context.Background(), alert.Request{
+			Message: fmt.Sprintf(i18n.T("%s has cleared"), s.Name),
+			Title:   s.title(),
+		})
+		return
+	}
+
+	e := &event{Time: time.Now().Format(time.RFC3339Nano)}
+
+	// Alerts go out first and concurrently with mitigation, neither should wait on the other
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mitigated := s.mitigate()
+		e.Mitigated = &mitigated
+	}()
+	e.Alerted = s.fanOut(context.Background(), alert.Request{
+		Message:  s.message(),
+		Title:    s.title(),
+		Priority: json.Number(fmt.Sprint(emergencyPriority)),
+		Retry:    s.Retry,
+		Expire:   s.Expire,
+	})
+	wg.Wait()
+
+	s.mutex.Lock()
+	s.lastAlarm = e
+	s.mutex.Unlock()
+
+	logging.Log(logging.Info, "Detector \"%s\" raised an alarm, alerted %d of %d targets and ran %d of %d mitigation actions", s.Name, e.Alerted, len(s.Alerts), *e.Mitigated, len(s.Mitigation))
+}
+
+// title returns the title of alerts for the kind of detector.
+func (s *safety) title() string {
+	if s.Kind == "smoke" {
+		return i18n.T("Smoke alarm")
+	}
+	return i18n.T("Water leak alarm")
+}
+
+// message returns the message of alarm alerts, the configured message or one for the kind of detector.
+func (s *safety) message() string {
+	if s.Message != "" {
+		return s.Message
+	}
+	if s.Kind == "smoke" {
+		return fmt.Sprintf(i18n.T("Smoke detected by %s"), s.Name)
+	}
+	return fmt.Sprintf(i18n.T("Water leak detected by %s"), s.Name)
+}
+
+// mitigate runs each mitigation action in turn, returning the number that succeeded. A failed action does not stop the rest.
+func (s *safety) mitigate() int {
+	mitigated := 0
+	for _, a := range s.Mitigation {
+		_, code, err := a.Post(s.Timeout)
+		if err == nil && code != http.StatusOK {
+			err = fmt.Errorf("received status code %d from %s", code, a.URL)
+		}
+		if err != nil {
+			logging.Log(logging.Error, "Detector \"%s\" failed to run mitigation action \"%s\": %v", s.Name, a.Code, err)
+			continue
+		}
+		mitigated++
+	}
+	return mitigated
+}
+
+// sendAlert posts an alert request to a single target.
+func (s *safety) sendAlert(ctx context.Context, target *alertTarget, request alert.Request) error {
+	client := &http.Client{
+		Timeout: time.Duration(s.Timeout) * time.Millisecond,
+	}
+
+	request.Token = target.Token.Value()
+	request.User = target.User
+
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(requestBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received status code %d from %s", resp.StatusCode, target.URL)
+	}
+	return nil
+}
+
+// fanOut keeps an alert in the inbox and sends it to every target concurrently, returning the number of targets alerted. Dry runs
+// leave the inbox alone.
+func (s *safety) fanOut(ctx context.Context, request alert.Request) int {
+	if !device.DryRunning(ctx) {
+		priority, _ := request.Priority.Int64()
+		inbox.Record("safety/"+s.Name, request.Title, request.Message, int(priority))
+	}
+
+	var wg sync.WaitGroup
+	var alerted int
+	var alertedMutex sync.Mutex
+	for _, target := range s.Alerts {
+		wg.Add(1)
+		go func(target *alertTarget) {
+			defer wg.Done()
+			if err := s.sendAlert(ctx, target, request); err != nil {
+				logging.Log(logging.Error, "Detector \"%s\" failed to send alert: %v", s.Name, err)
+				return
+			}
+			alertedMutex.Lock()
+			alerted++
+			alertedMutex.Unlock()
+		}(target)
+	}
+	wg.Wait()
+	return alerted
+}
+
+// test sends a test alarm at normal priority to every target, proving that alerts get through without running mitigation. A dry run
+// only records the alerts and is not kept as the last test.
+func (s *safety) test(ctx context.Context) *event {
+	e := &event{Time: time.Now().Format(time.RFC3339Nano)}
+	e.Alerted = s.fanOut(ctx, alert.Request{
+		Message: fmt.Sprintf(i18n.T("Test alarm from %s"), s.Name),
+		Title:   s.title(),
+	})
+	if device.DryRunning(ctx) {
+		return e
+	}
+
+	s.mutex.Lock()
+	s.lastTest = e
+	s.mutex.Unlock()
+
+	logging.Log(logging.Info, "Detector \"%s\" sent a test alarm to %d of %d targets", s.Name, e.Alerted, len(s.Alerts))
+	return e
+}
+
+// runTests sends a test alarm at the configured interval.
+func (s *safety) runTests() {
+	ticker := time.NewTicker(time.Duration(s.TestHours) * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.test(context.Background())
+	}
+}
+
+// status returns the alarm state of the detector along with its last alarm and test.
+func (s *safety) status() *status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &status{
+		Alarm:     s.alarm,
+		LastAlarm: s.lastAlarm,
+		LastTest:  s.lastTest,
+	}
+}
+
+// getCodes returns a list of control codes for a detector.
+func getCodes() []string {
+	return []string{"status", "test"}
+}
+
+// Handler is the HTTP handler for detector control.
+func (s *safety) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "status":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", s.status())
+	case "test":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", s.test(r.Context()))
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+	}
+}
+
+// getDeviceNames returns the names of all detectors in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured detectors.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
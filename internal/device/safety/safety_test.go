@@ -0,0 +1,340 @@
+package safety
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	mockMqtt "github.com/kennedn/restate-go/internal/mqtt/frigate/mock"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read safety input")
+	}
+
+	safetyConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &safetyConfig); err != nil {
+		t.Fatalf("Could not read safety input")
+	}
+	return &safetyConfig
+}
+
+// recorder records the alerts and mitigation actions received by the emulated endpoints.
+type recorder struct {
+	mutex   sync.Mutex
+	alerts  []alert.Request
+	actions []string
+}
+
+func (r *recorder) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.alerts = nil
+	r.actions = nil
+}
+
+// setupHTTPServer emulates pushover compatible alert endpoints and the devices driven by mitigation actions, the valve being broken.
+func setupHTTPServer(t *testing.T, recorder *recorder) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/alert":
+			request := alert.Request{}
+			if err := json.Unmarshal(body, &request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			recorder.alerts = append(recorder.alerts, request)
+			w.Write([]byte(`{"status":1}`))
+		case "/v2/valve":
+			recorder.actions = append(recorder.actions, r.URL.Path+" "+string(body))
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"version":1,"message":"Internal Server Error"}`))
+		default:
+			recorder.actions = append(recorder.actions, r.URL.Path+" "+string(body))
+			w.Write([]byte(`{"version":1,"message":"OK"}`))
+		}
+	}))
+}
+
+// setupDetectors loads the normal config with alerts and mitigation actions pointed at the emulator.
+func setupDetectors(t *testing.T, server *httptest.Server) (*base, *mux.Router) {
+	base, routes, err := routes(loadConfig(t, "testdata/safetyConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		for _, a := range d.Alerts {
+			a.URL = server.URL + "/alert"
+		}
+		for i := range d.Mitigation {
+			d.Mitigation[i].URL = server.URL + regexp.MustCompile(`^https?://[^/]+`).ReplaceAllString(d.Mitigation[i].URL, "")
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+	return base, router
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/safetyConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/safetyConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/safetyConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/safetyConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/safetyConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name           string
+		method         string
+		url            string
+		expectedCode   int
+		expectedBody   string
+		expectedAlerts []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/safety/kitchen_leak",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","test"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/safety/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["kitchen_leak","hall_smoke"]}`,
+		},
+		{
+			name:         "status_before_alarm",
+			method:       "POST",
+			url:          "/safety/kitchen_leak?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"alarm":false}}`,
+		},
+		{
+			name:           "test",
+			method:         "POST",
+			url:            "/safety/kitchen_leak?code=test",
+			expectedCode:   200,
+			expectedBody:   `{"version":1,"message":"OK","data":{"time":"<time>","alerted":2}}`,
+			expectedAlerts: []string{"Water leak alarm: Test alarm from kitchen_leak", "Water leak alarm: Test alarm from kitchen_leak"},
+		},
+		{
+			name:         "status_after_test",
+			method:       "POST",
+			url:          "/safety/kitchen_leak?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"alarm":false,"lastTest":{"time":"<time>","alerted":2}}}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/safety/kitchen_leak?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/safety/kitchen_leak",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/safety/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	recorder := &recorder{}
+	server := setupHTTPServer(t, recorder)
+	defer server.Close()
+
+	base, router := setupDetectors(t, server)
+	times := regexp.MustCompile(`"time":"[^"]+"`)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder.reset()
+
+			response := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(response, request)
+
+			if response.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, response.Code)
+			}
+
+			body := times.ReplaceAllString(response.Body.String(), `"time":"<time>"`)
+			if body != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, body)
+			}
+
+			if tc.expectedAlerts != nil {
+				recorder.mutex.Lock()
+				defer recorder.mutex.Unlock()
+				alerts := []string{}
+				for _, a := range recorder.alerts {
+					assert.Empty(t, a.Priority)
+					alerts = append(alerts, a.Title+": "+a.Message)
+				}
+				assert.Equal(t, tc.expectedAlerts, alerts)
+			}
+		})
+	}
+
+	t.Run("dry_run_test", func(t *testing.T) {
+		recorder.reset()
+		ctx, dryRun := device.WithDryRun(context.Background())
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest("POST", "/safety/hall_smoke?code=test", nil).WithContext(ctx))
+		assert.Equal(t, 200, response.Code)
+
+		// Alerts are recorded with their tokens redacted, and the test is not kept
+		recorder.mutex.Lock()
+		assert.Empty(t, recorder.alerts)
+		recorder.mutex.Unlock()
+		calls := dryRun.Calls()
+		assert.Len(t, calls, len(base.Devices[1].Alerts))
+		for _, c := range calls {
+			assert.Equal(t, device.Redacted, c.Payload.(map[string]any)["token"])
+		}
+		assert.Nil(t, base.Devices[1].status().LastTest)
+	})
+}
+
+func TestAlarm(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	recorder := &recorder{}
+	server := setupHTTPServer(t, recorder)
+	defer server.Close()
+
+	base, _ := setupDetectors(t, server)
+	leak, smoke := base.Devices[0], base.Devices[1]
+
+	leak.subscribe(&mockMqtt.Client{
+		SubscribeFunc: func(client mqtt.Client, callback mqtt.MessageHandler) {
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"water_leak":false,"battery":100}`)})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"battery":100}`)})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"water_leak":true,"battery":100}`)})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"water_leak":true,"battery":99}`)})
+		},
+	})
+
+	// Alarms are raised once at emergency priority, mitigation carries on past the broken valve
+	assert.True(t, leak.status().Alarm)
+	assert.Equal(t, 2, leak.status().LastAlarm.Alerted)
+	assert.Equal(t, 1, *leak.status().LastAlarm.Mitigated)
+	assert.Equal(t, []string{`/v2/valve {"code":"close"}`, `/v2/meross {"code":"toggle","value":"1"}`}, recorder.actions)
+	assert.Len(t, recorder.alerts, 2)
+	for _, a := range recorder.alerts {
+		assert.Equal(t, "Water leak detected by kitchen_leak", a.Message)
+		assert.Equal(t, "2", a.Priority.String())
+		assert.Equal(t, 60, a.Retry)
+		assert.Equal(t, 3600, a.Expire)
+	}
+
+	recorder.reset()
+	leak.update(false)
+	assert.False(t, leak.status().Alarm)
+	assert.Len(t, recorder.alerts, 2)
+	assert.Equal(t, "kitchen_leak has cleared", recorder.alerts[0].Message)
+	assert.Empty(t, recorder.actions)
+
+	recorder.reset()
+	smoke.subscribe(&mockMqtt.Client{
+		SubscribeFunc: func(client mqtt.Client, callback mqtt.MessageHandler) {
+			callback(client, &mockMqtt.Message{PayloadVar: []byte("CLEAR")})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte("ALARM")})
+		},
+	})
+	assert.True(t, smoke.status().Alarm)
+	assert.Equal(t, []alert.Request{{
+		Message:  "Smoke in the hall, get out",
+		Title:    "Smoke alarm",
+		Priority: "2",
+		Token:    "token-one",
+		Retry:    60,
+		Expire:   3600,
+	}}, recorder.alerts)
+}
@@ -0,0 +1,125 @@
+package schedule
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// preheatInterval is how often the room temperature is read while waiting to preheat and while learning the warm-up rate
+var preheatInterval = time.Minute
+
+// defaultRate is the warm-up rate in degrees per hour assumed until a room has been seen to warm up
+const defaultRate = 1.0
+
+// preheat starts an event early so that a room reaches its target temperature by the time of the event (optimum start), going by the
+// rate the room warmed up at before. The room temperature is read from a numeric field of another restate endpoint, e.g. a radiator.
+type preheat struct {
+	device.Action `yaml:",inline"`
+	Field         string  `yaml:"field"`
+	Target        float64 `yaml:"target"`
+	MaxMinutes    uint    `yaml:"maxMinutes"`
+	RatePerHour   float64 `yaml:"ratePerHour"`
+}
+
+// read returns the current room temperature.
+func (p *preheat) read(timeout uint) (float64, error) {
+	response, code, err := p.Post(timeout)
+	if err != nil {
+		return 0, err
+	} else if code != http.StatusOK {
+		return 0, fmt.Errorf("received status code %d from %s", code, p.URL)
+	}
+	return lookup(response.Data, p.Field)
+}
+
+// window returns how long before the time of the event preheating may start.
+func (p *preheat) window() time.Duration {
+	return time.Duration(p.MaxMinutes) * time.Minute
+}
+
+// lead returns how long a room at current takes to warm up to the target at rate degrees per hour, at most the preheat window.
+func (p *preheat) lead(current float64, rate float64) time.Duration {
+	if current >= p.Target {
+		return 0
+	}
+	lead := time.Duration((p.Target - current) / rate * float64(time.Hour))
+	return min(lead, p.window())
+}
+
+// rate returns the warm-up rate learnt for an event, or the configured rate if none has been.
+func (s *schedule) rate(e *event) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return e.rate
+}
+
+// restoreRate loads the warm-up rate learnt for an event before a restart.
+func (s *schedule) restoreRate(e *event) {
+	e.rate = e.Preheat.RatePerHour
+	if e.rate <= 0 {
+		e.rate = defaultRate
+	}
+	saved := 0.0
+	if storage.Load(e.key, &saved) && saved > 0 {
+		e.rate = saved
+	}
+}
+
+// learn averages a measured warm-up rate into the rate of an event, so that a single cold or sunny morning does not skew it, and
+// persists it.
+func (s *schedule) learn(e *event, measured float64) {
+	s.mutex.Lock()
+	e.rate = (e.rate + measured) / 2
+	rate := e.rate
+	s.mutex.Unlock()
+
+	logging.Log(logging.Info, "Schedule \"%s\" learnt a warm-up rate of %.2f per hour", s.Name, rate)
+	if err := storage.Save(e.key, rate); err != nil {
+		logging.Log(logging.Error, "Unable to save warm-up rate of \"%s\": %v", s.Name, err)
+	}
+}
+
+// preheat sends an event's actions once the room is expected to take until the time of the event to reach its target, or at the time
+// of the event at the latest, then learns the rate the room warms up at from the temperatures read until it reaches the target.
+func (s *schedule) preheat(e *event, t time.Time) {
+	p := e.Preheat
+
+	var current float64
+	var err error
+	for {
+		current, err = p.read(s.Timeout)
+		if err != nil {
+			logging.Log(logging.Error, "Schedule \"%s\" failed to read room temperature: %v", s.Name, err)
+		}
+		now := time.Now()
+		if !now.Before(t) || (err == nil && !now.Add(p.lead(current, s.rate(e))).Before(t)) {
+			break
+		}
+		time.Sleep(min(preheatInterval, time.Until(t)))
+	}
+
+	if !s.enabled() || !s.execute(e) || err != nil || current >= p.Target {
+		return
+	}
+
+	// Rooms that never reach the target within twice the window still teach a rate, from how far they got
+	start, from, last := time.Now(), current, current
+	for deadline := start.Add(2 * p.window()); time.Now().Before(deadline); {
+		time.Sleep(preheatInterval)
+		if current, err = p.read(s.Timeout); err != nil {
+			continue
+		}
+		last = current
+		if current >= p.Target {
+			break
+		}
+	}
+	if last > from {
+		s.learn(e, (last-from)/time.Since(start).Hours())
+	}
+}
@@ -0,0 +1,519 @@
+// Package schedule provides time and sunrise/sunset triggered actions against other restate devices.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/astral"
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// event is a single trigger, either a fixed time of day or an offset from sunrise/sunset, and the actions it fires.
+type event struct {
+	At            string          `yaml:"at"`
+	Sun           string          `yaml:"sun"`
+	OffsetMinutes int             `yaml:"offsetMinutes"`
+	Days          []string        `yaml:"days"`
+	SkipHolidays  bool            `yaml:"skipHolidays"`
+	Conditions    []*condition    `yaml:"conditions"`
+	Preheat       *preheat        `yaml:"preheat"`
+	Actions       []device.Action `yaml:"actions"`
+	// Storage key and current warm-up rate of a preheated event
+	key  string
+	rate float64
+}
+
+// condition gates an event on a numeric field returned by another restate endpoint, e.g the current energy price.
+type condition struct {
+	device.Action `yaml:",inline"`
+	Field         string   `yaml:"field"`
+	Below         *float64 `yaml:"below"`
+	Above         *float64 `yaml:"above"`
+}
+
+// eventStatus is the representation of an event returned by the status code.
+type eventStatus struct {
+	At            string  `json:"at,omitempty"`
+	Sun           string  `json:"sun,omitempty"`
+	OffsetMinutes int     `json:"offsetMinutes,omitempty"`
+	Next          string  `json:"next,omitempty"`
+	RatePerHour   float64 `json:"ratePerHour,omitempty"`
+}
+
+type status struct {
+	Enabled bool           `json:"enabled"`
+	Events  []*eventStatus `json:"events"`
+}
+
+// schedule represents a schedule configuration with name, location and the events to trigger.
+type schedule struct {
+	Name      string   `yaml:"name"`
+	Timeout   uint     `yaml:"timeoutMs"`
+	Latitude  float64  `yaml:"latitude"`
+	Longitude float64  `yaml:"longitude"`
+	Holidays  []string `yaml:"holidays"`
+	Events    []*event `yaml:"events"`
+	Base      base
+	disabled  bool
+	mutex     sync.Mutex
+}
+
+// base represents a list of schedules
+type base struct {
+	Devices []*schedule
+}
+
+type Device struct{}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// holidayLayout is the format of the dates in a schedule's holidays
+const holidayLayout = "2006-01-02"
+
+// DryRun validates enabling or disabling a schedule without applying it, events only ever run on time.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for schedules based on a provided configuration and starts each schedule.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	base, routes, err := routes(config)
+	if err != nil {
+		return routes, err
+	}
+
+	for _, s := range base.Devices {
+		go s.run()
+	}
+
+	return routes, err
+}
+
+// validate checks that an event describes exactly one kind of trigger with known parameters.
+func (s *schedule) validate(e *event) error {
+	if (e.At == "") == (e.Sun == "") {
+		return errors.New("event must specify one of at or sun")
+	}
+
+	if e.At != "" {
+		if _, err := time.Parse("15:04", e.At); err != nil {
+			return fmt.Errorf("invalid at \"%s\"", e.At)
+		}
+	}
+
+	if e.Sun != "" {
+		if e.Sun != "sunrise" && e.Sun != "sunset" {
+			return fmt.Errorf("invalid sun \"%s\"", e.Sun)
+		}
+		if s.Latitude == 0 && s.Longitude == 0 {
+			return errors.New("sun events require latitude and longitude")
+		}
+	}
+
+	for _, d := range e.Days {
+		if !slices.Contains(weekdays, strings.ToLower(d)) {
+			return fmt.Errorf("invalid day \"%s\"", d)
+		}
+	}
+
+	if len(e.Actions) == 0 {
+		return errors.New("event has no actions")
+	}
+
+	for _, a := range e.Actions {
+		if a.URL == "" || a.Code == "" {
+			return errors.New("action is missing url or code")
+		}
+	}
+
+	for _, c := range e.Conditions {
+		if c.URL == "" || c.Code == "" || c.Field == "" {
+			return errors.New("condition is missing url, code or field")
+		}
+		if c.Below == nil && c.Above == nil {
+			return errors.New("condition must specify at least one of below or above")
+		}
+	}
+
+	if p := e.Preheat; p != nil {
+		if p.URL == "" || p.Code == "" || p.Field == "" || p.MaxMinutes == 0 {
+			return errors.New("preheat is missing url, code, field or maxMinutes")
+		}
+	}
+
+	return nil
+}
+
+// lookup walks a dot separated path through decoded JSON data, returning the numeric value found at the end.
+func lookup(data any, field string) (float64, error) {
+	for _, key := range strings.Split(field, ".") {
+		object, ok := data.(map[string]any)
+		if !ok {
+			return 0, fmt.Errorf("field \"%s\" not found", field)
+		}
+		if data, ok = object[key]; !ok {
+			return 0, fmt.Errorf("field \"%s\" not found", field)
+		}
+	}
+
+	value, ok := data.(float64)
+	if !ok {
+		return 0, fmt.Errorf("field \"%s\" is not a number", field)
+	}
+	return value, nil
+}
+
+// check queries a condition's endpoint and reports whether its field is within the configured bounds.
+func (c *condition) check(timeout uint) (bool, error) {
+	response, code, err := c.Post(timeout)
+	if err != nil {
+		return false, err
+	} else if code != http.StatusOK {
+		return false, fmt.Errorf("received status code %d from %s", code, c.URL)
+	}
+
+	value, err := lookup(response.Data, c.Field)
+	if err != nil {
+		return false, err
+	}
+
+	if c.Below != nil && value >= *c.Below {
+		return false, nil
+	}
+	if c.Above != nil && value <= *c.Above {
+		return false, nil
+	}
+	return true, nil
+}
+
+// routes extracts schedules from config, checking their holidays and entries, and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+DEVICE:
+	for _, d := range config.Devices {
+		if d.Type != "schedule" {
+			continue
+		}
+		schedule := schedule{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &schedule); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if schedule.Name == "" || len(schedule.Events) == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		for _, h := range schedule.Holidays {
+			if _, err := time.Parse(holidayLayout, h); err != nil {
+				logging.Log(logging.Info, "Unable to load device \"%s\": invalid holiday \"%s\"", schedule.Name, h)
+				continue DEVICE
+			}
+		}
+
+		for i, e := range schedule.Events {
+			if err := schedule.validate(e); err != nil {
+				logging.Log(logging.Info, "Unable to load device \"%s\": %v", schedule.Name, err)
+				continue DEVICE
+			}
+			if e.Preheat != nil {
+				e.key = fmt.Sprintf("schedule/%s/%d", schedule.Name, i)
+				schedule.restoreRate(e)
+			}
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + schedule.Name,
+			Handler: schedule.handler,
+		})
+
+		base.Devices = append(base.Devices, &schedule)
+
+		logging.Log(logging.Info, "Found device \"%s\"", schedule.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/schedule" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/schedule",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/schedule/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// eventTime returns the time that an event would fire on the calendar day of day, ok is false if it does not fire that day.
+func (s *schedule) eventTime(e *event, day time.Time) (time.Time, bool) {
+	if len(e.Days) > 0 && !slices.ContainsFunc(e.Days, func(d string) bool {
+		return strings.ToLower(d) == weekdays[day.Weekday()]
+	}) {
+		return time.Time{}, false
+	}
+
+	if e.SkipHolidays && slices.Contains(s.Holidays, day.Format(holidayLayout)) {
+		return time.Time{}, false
+	}
+
+	year, month, date := day.Date()
+
+	if e.At != "" {
+		at, _ := time.Parse("15:04", e.At)
+		return time.Date(year, month, date, at.Hour(), at.Minute(), 0, 0, day.Location()), true
+	}
+
+	var t time.Time
+	var err error
+	if e.Sun == "sunrise" {
+		t, err = astral.Sunrise(day, s.Latitude, s.Longitude)
+	} else {
+		t, err = astral.Sunset(day, s.Latitude, s.Longitude)
+	}
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t.Add(time.Duration(e.OffsetMinutes) * time.Minute).Truncate(time.Second), true
+}
+
+// nextTime returns the next time after now that an event will fire, the zero time is returned if it will not fire in the next week,
+// not counting any holidays it skips.
+func (s *schedule) nextTime(e *event, now time.Time) time.Time {
+	// Start from yesterday so that large negative offsets from tomorrow's sun events are still considered
+	for i := -1; i <= 7+len(s.Holidays); i++ {
+		t, ok := s.eventTime(e, now.AddDate(0, 0, i))
+		if ok && t.After(now) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// wake returns the time to start handling an event that fires at t, the start of its preheat window if it has one.
+func (s *schedule) wake(e *event, t time.Time) time.Time {
+	if e.Preheat == nil {
+		return t
+	}
+	return t.Add(-e.Preheat.window())
+}
+
+// nextEvent returns the upcoming event that is the earliest to wake after now and the time it will fire.
+func (s *schedule) nextEvent(now time.Time) (*event, time.Time) {
+	var next *event
+	var nextTime time.Time
+	for _, e := range s.Events {
+		// Events whose preheat window has already opened were handed off when it did
+		after := now
+		if e.Preheat != nil {
+			after = now.Add(e.Preheat.window())
+		}
+		t := s.nextTime(e, after)
+		if t.IsZero() {
+			continue
+		}
+		if next == nil || s.wake(e, t).Before(s.wake(next, nextTime)) {
+			next = e
+			nextTime = t
+		}
+	}
+	return next, nextTime
+}
+
+// run waits for each upcoming event and executes its actions, for the lifetime of the process. Preheated events are handed off when
+// their preheat window opens, so that other events are not held up while they wait.
+func (s *schedule) run() {
+	// Preheat windows that are already open, e.g. after a restart, are not otherwise woken for
+	now := time.Now()
+	for _, e := range s.Events {
+		if t := s.nextTime(e, now); e.Preheat != nil && !t.IsZero() && !s.wake(e, t).After(now) {
+			go s.preheat(e, t)
+		}
+	}
+
+	for {
+		e, t := s.nextEvent(time.Now())
+		if e == nil {
+			logging.Log(logging.Error, "Schedule \"%s\" has no upcoming events, stopping", s.Name)
+			return
+		}
+
+		time.Sleep(time.Until(s.wake(e, t)))
+
+		if !s.enabled() {
+			continue
+		}
+
+		if e.Preheat != nil {
+			go s.preheat(e, t)
+			continue
+		}
+		s.execute(e)
+	}
+}
+
+// execute posts each of an event's actions in order, provided that all of its conditions are met, reporting whether they were.
+func (s *schedule) execute(e *event) bool {
+	for _, c := range e.Conditions {
+		ok, err := c.check(s.Timeout)
+		if err != nil {
+			logging.Log(logging.Error, "Schedule \"%s\" failed to check condition: %v", s.Name, err)
+			return false
+		} else if !ok {
+			logging.Log(logging.Info, "Schedule \"%s\" skipped event, condition on \"%s\" not met", s.Name, c.Field)
+			return false
+		}
+	}
+
+	for _, a := range e.Actions {
+		_, code, err := a.Post(s.Timeout)
+		if err != nil {
+			logging.Log(logging.Error, "Schedule \"%s\" failed to post to %s: %v", s.Name, a.URL, err)
+			continue
+		} else if code != http.StatusOK {
+			logging.Log(logging.Error, "Schedule \"%s\" received status code %d from %s", s.Name, code, a.URL)
+			continue
+		}
+		logging.Log(logging.Info, "Schedule \"%s\" sent code \"%s\" to %s", s.Name, a.Code, a.URL)
+	}
+	return true
+}
+
+func (s *schedule) enabled() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.disabled
+}
+
+func (s *schedule) setEnabled(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.disabled = !enabled
+}
+
+// status returns the state of the schedule along with the next fire time of each event.
+func (s *schedule) status(now time.Time) *status {
+	status := status{
+		Enabled: s.enabled(),
+	}
+	for _, e := range s.Events {
+		eventStatus := eventStatus{
+			At:            e.At,
+			Sun:           e.Sun,
+			OffsetMinutes: e.OffsetMinutes,
+		}
+		if e.Preheat != nil {
+			eventStatus.RatePerHour = s.rate(e)
+		}
+		if t := s.nextTime(e, now); !t.IsZero() {
+			eventStatus.Next = t.Format(time.RFC3339)
+		}
+		status.Events = append(status.Events, &eventStatus)
+	}
+	return &status
+}
+
+// getCodes returns a list of control codes for a schedule.
+func getCodes() []string {
+	return []string{"status", "enable", "disable"}
+}
+
+// Handler is the HTTP handler for schedule control.
+func (s *schedule) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "status":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", s.status(time.Now()))
+		return
+	// Dry runs are validated without enabling or disabling the schedule
+	case "enable", "disable":
+		if !device.DryRunning(r.Context()) {
+			s.setEnabled(request.Code == "enable")
+		}
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+}
+
+// getDeviceNames returns the names of all schedules in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured schedules.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
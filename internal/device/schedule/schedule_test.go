@@ -0,0 +1,436 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read schedule input")
+	}
+
+	scheduleConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &scheduleConfig); err != nil {
+		t.Fatalf("Could not read schedule input")
+	}
+	return &scheduleConfig
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/scheduleConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/scheduleConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/scheduleConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/scheduleConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/scheduleConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestNextTime(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	s := &schedule{
+		Latitude:  51.5074,
+		Longitude: -0.1278,
+	}
+
+	testCases := []struct {
+		name         string
+		event        *event
+		now          time.Time
+		expectedTime time.Time
+	}{
+		{
+			name:         "at_later_today",
+			event:        &event{At: "23:00"},
+			now:          time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC),
+			expectedTime: time.Date(2024, 6, 21, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "at_tomorrow",
+			event:        &event{At: "07:30"},
+			now:          time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC),
+			expectedTime: time.Date(2024, 6, 22, 7, 30, 0, 0, time.UTC),
+		},
+		{
+			name:         "at_weekdays_over_weekend",
+			event:        &event{At: "07:30", Days: []string{"mon", "tue", "wed", "thu", "fri"}},
+			now:          time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC),
+			expectedTime: time.Date(2024, 6, 24, 7, 30, 0, 0, time.UTC),
+		},
+		{
+			name:         "sunset_offset",
+			event:        &event{Sun: "sunset", OffsetMinutes: -30},
+			now:          time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC),
+			expectedTime: time.Date(2024, 6, 21, 19, 51, 0, 0, time.UTC),
+		},
+		{
+			name:         "sunrise_tomorrow",
+			event:        &event{Sun: "sunrise"},
+			now:          time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC),
+			expectedTime: time.Date(2024, 6, 22, 3, 43, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next := s.nextTime(tc.event, tc.now)
+			// Sun events are only accurate to within a couple of minutes
+			assert.WithinDuration(t, tc.expectedTime, next, 2*time.Minute)
+		})
+	}
+}
+
+func TestHolidays(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	s := &schedule{
+		Holidays: []string{"2024-12-24", "2024-12-25", "2024-12-26", "2024-12-27", "2024-12-30", "2024-12-31", "2025-01-01", "2025-01-02", "2025-01-03"},
+	}
+
+	testCases := []struct {
+		name         string
+		event        *event
+		now          time.Time
+		expectedTime time.Time
+	}{
+		{
+			name:         "wake_skips_holidays",
+			event:        &event{At: "07:30", Days: []string{"mon", "tue", "wed", "thu", "fri"}, SkipHolidays: true},
+			now:          time.Date(2024, 12, 23, 12, 0, 0, 0, time.UTC),
+			expectedTime: time.Date(2025, 1, 6, 7, 30, 0, 0, time.UTC),
+		},
+		{
+			name:         "shutdown_runs_on_holidays",
+			event:        &event{At: "23:00"},
+			now:          time.Date(2024, 12, 24, 12, 0, 0, 0, time.UTC),
+			expectedTime: time.Date(2024, 12, 24, 23, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next := s.nextTime(tc.event, tc.now)
+			// Sun events are only accurate to within a couple of minutes
+			assert.WithinDuration(t, tc.expectedTime, next, 2*time.Minute)
+		})
+	}
+}
+
+func TestExecute(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	received := []device.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("Could not parse request body")
+		}
+		received = append(received, request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version":1,"message":"OK"}`))
+	}))
+	defer server.Close()
+
+	s := &schedule{
+		Name:    "test",
+		Timeout: 1000,
+	}
+	s.execute(&event{
+		Actions: []device.Action{
+			{URL: server.URL, Code: "toggle", Value: "1"},
+			{URL: server.URL, Code: "luminance", Value: "50"},
+		},
+	})
+
+	assert.Equal(t, []device.Request{
+		{Code: "toggle", Value: "1"},
+		{Code: "luminance", Value: "50"},
+	}, received)
+}
+
+func TestConditions(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version":1,"message":"OK","data":{"unit":"p/kWh","current":{"price":12.5}}}`))
+	}))
+	defer server.Close()
+
+	below := 15.0
+	above := 13.0
+
+	testCases := []struct {
+		name        string
+		condition   *condition
+		expected    bool
+		expectError bool
+	}{
+		{
+			name:      "below_met",
+			condition: &condition{Field: "current.price", Below: &below},
+			expected:  true,
+		},
+		{
+			name:      "above_not_met",
+			condition: &condition{Field: "current.price", Above: &above},
+			expected:  false,
+		},
+		{
+			name:        "missing_field",
+			condition:   &condition{Field: "current.cost", Below: &below},
+			expectError: true,
+		},
+		{
+			name:        "non_numeric_field",
+			condition:   &condition{Field: "unit", Below: &below},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.condition.URL = server.URL
+			tc.condition.Code = "status"
+
+			ok, err := tc.condition.check(1000)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ok)
+		})
+	}
+}
+
+func TestPreheat(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	preheatInterval = 10 * time.Millisecond
+
+	// The room warms by half a degree for every reading once the radiator has been turned up
+	mutex := sync.Mutex{}
+	room := 19.0
+	heating := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := device.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if request.Code == "target" {
+			heating = true
+			w.Write([]byte(`{"version":1,"message":"OK"}`))
+			return
+		}
+		if heating {
+			room += 0.5
+		}
+		w.Write([]byte(fmt.Sprintf(`{"version":1,"message":"OK","data":{"temperature":{"room":%v}}}`, room)))
+	}))
+	defer server.Close()
+
+	p := &preheat{
+		Action:     device.Action{URL: server.URL, Code: "status"},
+		Field:      "temperature.room",
+		Target:     21,
+		MaxMinutes: 120,
+	}
+	assert.Equal(t, time.Hour, p.lead(19, 2))
+	assert.Equal(t, 2*time.Hour, p.lead(15, 2))
+	assert.Equal(t, time.Duration(0), p.lead(22, 2))
+
+	e := &event{
+		At:      "07:00",
+		Preheat: p,
+		Actions: []device.Action{{URL: server.URL, Code: "target", Value: "21"}},
+		key:     "schedule/test/0",
+	}
+	s := &schedule{
+		Name:    "test",
+		Timeout: 1000,
+		Events:  []*event{e},
+	}
+	s.restoreRate(e)
+	assert.Equal(t, defaultRate, s.rate(e))
+
+	// Two degrees short at one degree an hour, the actions are sent straight away for an event in under two hours
+	s.preheat(e, time.Now().Add(90*time.Minute))
+
+	mutex.Lock()
+	assert.True(t, heating)
+	assert.Equal(t, 21.0, room)
+	mutex.Unlock()
+	assert.Greater(t, s.rate(e), defaultRate)
+	assert.Greater(t, s.status(time.Now()).Events[0].RatePerHour, defaultRate)
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/schedule/porch",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","enable","disable"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/schedule/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["porch","camera"]}`,
+		},
+		{
+			name:         "disable",
+			method:       "POST",
+			url:          "/schedule/porch?code=disable",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "enable",
+			method:       "POST",
+			url:          "/schedule/porch?code=enable",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/schedule/porch?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/schedule/porch",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/schedule/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	base, routes, err := routes(loadConfig(t, "testdata/scheduleConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+
+	t.Run("status_reflects_disable", func(t *testing.T) {
+		porch := base.Devices[0]
+		porch.setEnabled(false)
+		status := porch.status(time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC))
+		assert.False(t, status.Enabled)
+		assert.Len(t, status.Events, 2)
+		assert.Equal(t, "2024-06-21T23:00:00Z", status.Events[1].Next)
+	})
+
+	t.Run("dry_run_leaves_schedule_alone", func(t *testing.T) {
+		porch := base.Devices[0]
+		porch.setEnabled(true)
+		ctx, _ := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/schedule/porch?code=disable", nil).WithContext(ctx))
+		assert.Equal(t, `{"version":1,"message":"OK"}`, recorder.Body.String())
+		assert.True(t, porch.enabled())
+	})
+}
@@ -0,0 +1,120 @@
+package device
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/auth"
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Outcomes of probing a device during a self-test
+const (
+	selfTestPass = "pass"
+	selfTestFail = "fail"
+	selfTestSkip = "skip"
+)
+
+// selfTestResult is the outcome of requesting the status of a single device.
+type selfTestResult struct {
+	Name     string `json:"name"`
+	Result   string `json:"result"`
+	Code     int    `json:"code,omitempty"`
+	Duration int64  `json:"durationMs"`
+}
+
+// selfTestReport is the response of the self-test endpoint.
+type selfTestReport struct {
+	Passed  bool             `json:"passed"`
+	Devices []selfTestResult `json:"devices"`
+}
+
+// selfTest requests the status of every device concurrently. Devices that are disabled or have no status code are skipped.
+func (d *Devices) selfTest() selfTestReport {
+	report := selfTestReport{
+		Passed:  true,
+		Devices: make([]selfTestResult, 0, len(d.handlers)),
+	}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, handler := range d.handlers {
+		wg.Add(1)
+		go func(h *health) {
+			defer wg.Done()
+			result := selfTestResult{
+				Name:   h.Name,
+				Result: selfTestSkip,
+			}
+
+			if common.Enabled(h.Name) && slices.Contains(h.getCodes(), "status") {
+				start := time.Now()
+				result.Code, _ = h.call(http.MethodPost, "status")
+				result.Duration = time.Since(start).Milliseconds()
+				result.Result = selfTestFail
+				if result.Code == http.StatusOK {
+					result.Result = selfTestPass
+				}
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Devices = append(report.Devices, result)
+			if result.Result == selfTestFail {
+				report.Passed = false
+			}
+		}(&health{Name: name, handler: handler})
+	}
+
+	wg.Wait()
+	sort.Slice(report.Devices, func(i int, j int) bool {
+		return report.Devices[i].Name < report.Devices[j].Name
+	})
+	return report
+}
+
+// SelfTest requests the status of every device, writing a table of the results to w, and reports whether none failed.
+func (d *Devices) SelfTest(w io.Writer) bool {
+	report := d.selfTest()
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DEVICE\tRESULT\tCODE\tTIME")
+	for _, r := range report.Devices {
+		code := "-"
+		if r.Code != 0 {
+			code = fmt.Sprint(r.Code)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%dms\n", r.Name, r.Result, code, r.Duration)
+	}
+	table.Flush()
+
+	return report.Passed
+}
+
+// selfTestHandler runs a self-test on behalf of an admin, e.g. to verify a deployment.
+func (d *Devices) selfTestHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	if !auth.IsAdmin(r, d.adminTokens) {
+		httpCode, jsonResponse = common.SetJSONResponse(http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+
+	httpCode, jsonResponse = common.SetJSONResponse(http.StatusOK, "OK", d.selfTest())
+}
@@ -0,0 +1,71 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	d := &Devices{
+		adminTokens: []config.Secret{"admin-token"},
+		handlers: map[string]func(http.ResponseWriter, *http.Request){
+			"lamp":  (&fakeRoute{codes: []string{"status", "toggle"}, up: true}).handler,
+			"plug":  (&fakeRoute{codes: []string{"status", "toggle"}, up: false}).handler,
+			"doors": (&fakeRoute{codes: []string{"open"}, up: true}).handler,
+			"tv":    (&fakeRoute{codes: []string{"status", "power"}, up: true}).handler,
+		},
+	}
+	common.SetEnabled("tv", false)
+	t.Cleanup(func() { common.SetEnabled("tv", true) })
+
+	// Devices without a status code or out of rotation are skipped, a single failure fails the self-test
+	report := d.selfTest()
+	assert.False(t, report.Passed)
+	results := map[string]string{}
+	for _, r := range report.Devices {
+		results[r.Name] = r.Result
+	}
+	assert.Equal(t, map[string]string{"doors": selfTestSkip, "lamp": selfTestPass, "plug": selfTestFail, "tv": selfTestSkip}, results)
+	assert.Equal(t, "doors", report.Devices[0].Name)
+	assert.Equal(t, http.StatusInternalServerError, report.Devices[2].Code)
+
+	output := bytes.Buffer{}
+	assert.False(t, d.SelfTest(&output))
+	assert.Contains(t, output.String(), "DEVICE  RESULT  CODE  TIME")
+	assert.Contains(t, output.String(), "plug    fail    500")
+	assert.Contains(t, output.String(), "tv      skip    -")
+
+	delete(d.handlers, "plug")
+	assert.True(t, d.SelfTest(&bytes.Buffer{}))
+
+	// Only admins may run a self-test over HTTP
+	recorder := httptest.NewRecorder()
+	d.selfTestHandler(recorder, httptest.NewRequest(http.MethodPost, "/admin/selftest", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/admin/selftest", nil)
+	request.Header.Set("Authorization", "Bearer admin-token")
+	d.selfTestHandler(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	response := struct {
+		Data selfTestReport `json:"data"`
+	}{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.True(t, response.Data.Passed)
+	assert.Len(t, response.Data.Devices, 3)
+
+	recorder = httptest.NewRecorder()
+	d.selfTestHandler(recorder, httptest.NewRequest(http.MethodGet, "/admin/selftest", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
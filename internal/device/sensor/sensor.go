@@ -0,0 +1,545 @@
+// Package sensor provides read-only values from MQTT topics, HTTP JSON endpoints and SNMP OIDs, alerting when a value crosses one of
+// its thresholds, e.g. a freezer warming above -10°C or a tank dropping below 20%.
+package sensor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/i18n"
+	"github.com/kennedn/restate-go/internal/common/inbox"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+// poller is implemented by sources that are read on demand rather than pushing their values.
+type poller interface {
+	read(timeout uint) (float64, error)
+}
+
+// threshold is a bound a sensor is alerted on when its value moves outside of it.
+type threshold struct {
+	Above   *float64 `yaml:"above"`
+	Below   *float64 `yaml:"below"`
+	Message string   `yaml:"message"`
+	// Time the value must stay outside of the bound before the threshold is breached, e.g. for a TV to be counted as in standby
+	ForMinutes uint `yaml:"forMinutes"`
+	// Requests sent to other devices when the threshold is breached, e.g. to switch off a socket
+	Actions []device.Action `yaml:"actions"`
+	// Requests undoing the actions, sent when the value is back within the threshold or the actions have run for too long
+	ClearActions []device.Action `yaml:"clearActions"`
+	// Times of day during which actions are not sent
+	Exempt []*window `yaml:"exempt"`
+	// Protects devices such as fans from running too long or restarting too soon
+	MaxRuntimeMinutes uint `yaml:"maxRuntimeMinutes"`
+	MinOffMinutes     uint `yaml:"minOffMinutes"`
+	// Bound the value is outside of, e.g. "above -10°C", empty while within the threshold
+	breached string
+	// Time the value moved outside of the bound, zero while within it
+	outside time.Time
+	// Times the actions were last sent, zero while they are not in effect, and cleared
+	started time.Time
+	cleared time.Time
+}
+
+// change is a threshold that a value moved outside of or back within, with the alert to send and the actions to take, either of which
+// may be empty.
+type change struct {
+	alert   string
+	actions []device.Action
+}
+
+// alertTarget is a pushover compatible endpoint that threshold alerts are sent to.
+type alertTarget struct {
+	URL      string        `yaml:"url"`
+	Token    config.Secret `yaml:"token"`
+	User     string        `yaml:"user"`
+	Priority int           `yaml:"priority"`
+}
+
+// reading is a single value received from or read from a source.
+type reading struct {
+	Value float64 `json:"value"`
+	Time  string  `json:"time"`
+}
+
+// status is the representation of a sensor returned by the status code, the value is null until the sensor has been read.
+type status struct {
+	Value    *float64 `json:"value"`
+	Unit     string   `json:"unit,omitempty"`
+	Updated  string   `json:"updated,omitempty"`
+	Breached []string `json:"breached,omitempty"`
+}
+
+// sensor represents a sensor configuration with name, source, thresholds and the readings taken from it.
+type sensor struct {
+	Name        string       `yaml:"name"`
+	Timeout     uint         `yaml:"timeoutMs"`
+	Source      string       `yaml:"source"`
+	Unit        string       `yaml:"unit"`
+	Scale       float64      `yaml:"scale"`
+	Interval    uint         `yaml:"intervalSeconds"`
+	HistorySize int          `yaml:"historySize"`
+	MQTT        *mqttSource  `yaml:"mqtt"`
+	HTTP        *httpSource  `yaml:"http"`
+	SNMP        *snmpSource  `yaml:"snmp"`
+	Thresholds  []*threshold `yaml:"thresholds"`
+	Alert       alertTarget  `yaml:"alert"`
+	Base        base
+	poller      poller
+	history     []reading
+	mutex       sync.Mutex
+}
+
+// base represents a list of sensors
+type base struct {
+	Devices []*sensor
+}
+
+type Device struct{}
+
+// DryRun is always safe, sensors only report readings and alert as they arrive.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for sensors based on a provided configuration, subscribing to MQTT sources and polling the others.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	base, routes, err := routes(config)
+	if err != nil {
+		return routes, err
+	}
+
+	for _, s := range base.Devices {
+		if s.poller == nil {
+			clientOpts := mqtt.NewClientOptions()
+			clientOpts.SetCleanSession(false)
+			clientOpts.AddBroker(fmt.Sprintf("tcp://%s:%d", s.MQTT.Host, s.MQTT.Port))
+			clientOpts.SetClientID("restate-go-sensor-" + s.Name)
+			s.subscribe(mqtt.NewClient(clientOpts))
+			continue
+		}
+		go s.run()
+	}
+
+	return routes, err
+}
+
+// routes extracts MQTT, HTTP and SNMP sensors from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "sensor" {
+			continue
+		}
+		sensor := sensor{
+			Scale:       1,
+			Interval:    60,
+			HistorySize: 1440,
+			Base:        base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &sensor); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if sensor.Name == "" || sensor.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch sensor.Source {
+		case "mqtt":
+			if sensor.MQTT == nil || sensor.MQTT.Host == "" || sensor.MQTT.Topic == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if sensor.MQTT.Port == 0 {
+				sensor.MQTT.Port = 1883
+			}
+		case "http":
+			if sensor.HTTP == nil || sensor.HTTP.URL == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			sensor.poller = sensor.HTTP
+		case "snmp":
+			if sensor.SNMP == nil || sensor.SNMP.Host == "" || sensor.SNMP.OID == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if sensor.SNMP.Port == 0 {
+				sensor.SNMP.Port = 161
+			}
+			if sensor.SNMP.Community == "" {
+				sensor.SNMP.Community = "public"
+			}
+			sensor.poller = sensor.SNMP
+		default:
+			logging.Log(logging.Info, "Unable to load device: source must be one of 'mqtt', 'http' or 'snmp'")
+			continue
+		}
+
+		if err := sensor.validate(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", sensor.Name, err)
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + sensor.Name,
+			Handler: sensor.handler,
+		})
+
+		base.Devices = append(base.Devices, &sensor)
+
+		logging.Log(logging.Info, "Found device \"%s\"", sensor.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/sensor" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/sensor",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/sensor/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// validate checks the thresholds and alert target, filling in defaults.
+func (s *sensor) validate() error {
+	if s.Interval == 0 || s.HistorySize <= 0 {
+		return errors.New("intervalSeconds and historySize must be greater than 0")
+	}
+	for _, t := range s.Thresholds {
+		if t.Above == nil && t.Below == nil {
+			return errors.New("threshold must specify at least one of below or above")
+		}
+		if len(t.Actions) == 0 && s.Alert.Token == "" {
+			return errors.New("thresholds without actions need an alert token")
+		}
+		for _, a := range append(append([]device.Action{}, t.Actions...), t.ClearActions...) {
+			if a.URL == "" || a.Code == "" {
+				return errors.New("threshold actions need a url and code")
+			}
+		}
+		if t.MaxRuntimeMinutes > 0 && len(t.ClearActions) == 0 {
+			return errors.New("maxRuntimeMinutes needs clearActions")
+		}
+		for _, w := range t.Exempt {
+			if err := w.parse(); err != nil {
+				return err
+			}
+		}
+	}
+	if (s.MQTT != nil && s.MQTT.TemperaturePath != "" && s.MQTT.Path == "") ||
+		(s.HTTP != nil && s.HTTP.TemperaturePath != "" && s.HTTP.Path == "") {
+		return errors.New("temperaturePath needs a path to relative humidity")
+	}
+	if s.Alert.URL == "" {
+		s.Alert.URL = "https://api.pushover.net/1/messages.json"
+	}
+	return nil
+}
+
+// format formats a value with the unit of the sensor.
+func (s *sensor) format(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64) + s.Unit
+}
+
+// record scales and stores a raw value, returning the thresholds it moved outside of or back within.
+func (s *sensor) record(raw float64, now time.Time) []change {
+	value := raw * s.Scale
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.history = append(s.history, reading{Value: value, Time: now.Format(time.RFC3339)})
+	if len(s.history) > s.HistorySize {
+		s.history = s.history[len(s.history)-s.HistorySize:]
+	}
+
+	changes := []change{}
+	for _, t := range s.Thresholds {
+		breached := ""
+		if t.Above != nil && value > *t.Above {
+			breached = "above " + s.format(*t.Above)
+		} else if t.Below != nil && value < *t.Below {
+			breached = "below " + s.format(*t.Below)
+		}
+
+		// Values only breach a threshold once they have stayed outside of it for long enough
+		if breached == "" {
+			t.outside = time.Time{}
+		} else if t.outside.IsZero() {
+			t.outside = now
+		}
+		if breached != "" && now.Sub(t.outside) < time.Duration(t.ForMinutes)*time.Minute {
+			breached = ""
+		}
+
+		c := change{
+			actions: t.act(breached != "", now),
+		}
+		if breached != t.breached {
+			t.breached = breached
+			switch {
+			case breached == "":
+				c.alert = fmt.Sprintf(i18n.T("%s is back to %s"), s.Name, s.format(value))
+			case t.Message != "":
+				c.alert = t.Message
+			case t.Above != nil && value > *t.Above:
+				c.alert = fmt.Sprintf(i18n.T("%s is %s, above %s"), s.Name, s.format(value), s.format(*t.Above))
+			default:
+				c.alert = fmt.Sprintf(i18n.T("%s is %s, below %s"), s.Name, s.format(value), s.format(*t.Below))
+			}
+		}
+		if c.alert != "" || len(c.actions) > 0 {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// act returns the actions to send for a reading, starting those of the threshold while it is breached and clearing them once it is
+// not or they have run for maxRuntimeMinutes. Actions are not started during an exempt window or within minOffMinutes of being
+// cleared, but are once those pass if the threshold is still breached.
+func (t *threshold) act(breached bool, now time.Time) []device.Action {
+	if len(t.Actions) == 0 {
+		return nil
+	}
+	if !t.started.IsZero() {
+		if breached && (t.MaxRuntimeMinutes == 0 || now.Sub(t.started) < time.Duration(t.MaxRuntimeMinutes)*time.Minute) {
+			return nil
+		}
+		t.started = time.Time{}
+		t.cleared = now
+		return t.ClearActions
+	}
+	if !breached || t.exempt(now) || (!t.cleared.IsZero() && now.Sub(t.cleared) < time.Duration(t.MinOffMinutes)*time.Minute) {
+		return nil
+	}
+	t.started = now
+	return t.Actions
+}
+
+// exempt reports whether actions are not sent at a time.
+func (t *threshold) exempt(now time.Time) bool {
+	for _, w := range t.Exempt {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// notify sends the alert of each change to the alert target, if there is one, and sends its actions.
+func (s *sensor) notify(changes []change) {
+	for _, c := range changes {
+		if s.Alert.Token != "" && c.alert != "" {
+			if err := s.sendAlert(c.alert); err != nil {
+				logging.Log(logging.Error, "Sensor \"%s\" failed to send alert: %v", s.Name, err)
+			} else {
+				logging.Log(logging.Info, "Sensor \"%s\" sent alert \"%s\"", s.Name, c.alert)
+			}
+		}
+		for _, a := range c.actions {
+			_, code, err := a.Post(s.Timeout)
+			if err != nil {
+				logging.Log(logging.Error, "Sensor \"%s\" failed to post to %s: %v", s.Name, a.URL, err)
+				continue
+			}
+			if code != http.StatusOK {
+				logging.Log(logging.Error, "Sensor \"%s\" received status code %d from %s", s.Name, code, a.URL)
+				continue
+			}
+			logging.Log(logging.Info, "Sensor \"%s\" sent code \"%s\" to %s", s.Name, a.Code, a.URL)
+		}
+	}
+}
+
+// sendAlert posts an alert request to the alert target and keeps it in the inbox.
+func (s *sensor) sendAlert(message string) error {
+	inbox.Record("sensor/"+s.Name, i18n.T("Sensor alert"), message, s.Alert.Priority)
+
+	client := &http.Client{
+		Timeout: time.Duration(s.Timeout) * time.Millisecond,
+	}
+
+	requestBytes, err := json.Marshal(alert.Request{
+		Message:  message,
+		Title:    i18n.T("Sensor alert"),
+		Priority: json.Number(fmt.Sprint(s.Alert.Priority)),
+		Token:    s.Alert.Token.Value(),
+		User:     s.Alert.User,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(s.Alert.URL, "application/json", bytes.NewReader(requestBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received status code %d from %s", resp.StatusCode, s.Alert.URL)
+	}
+	return nil
+}
+
+// poll reads a polled source, recording its value and sending any alerts it caused.
+func (s *sensor) poll() error {
+	value, err := s.poller.read(s.Timeout)
+	if err != nil {
+		return err
+	}
+	s.notify(s.record(value, time.Now()))
+	return nil
+}
+
+// run polls the source at the configured interval.
+func (s *sensor) run() {
+	ticker := time.NewTicker(time.Duration(s.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		if err := s.poll(); err != nil {
+			logging.Log(logging.Error, "Sensor \"%s\" failed to read its source: %v", s.Name, err)
+		}
+	}
+}
+
+// status returns the latest reading of the sensor and the thresholds it is outside of.
+func (s *sensor) status() *status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := status{Unit: s.Unit}
+	if len(s.history) > 0 {
+		last := s.history[len(s.history)-1]
+		status.Value = &last.Value
+		status.Updated = last.Time
+	}
+	for _, t := range s.Thresholds {
+		if t.breached != "" {
+			status.Breached = append(status.Breached, t.breached)
+		}
+	}
+	return &status
+}
+
+// getHistory returns a copy of the readings held for the sensor, oldest first.
+func (s *sensor) getHistory() []reading {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]reading{}, s.history...)
+}
+
+// getCodes returns a list of control codes for a sensor.
+func getCodes() []string {
+	return []string{"status", "history"}
+}
+
+// Handler is the HTTP handler for reading a sensor.
+func (s *sensor) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	switch request.Code {
+	case "status":
+		// Polled sources are read again so that the status is current, pushed values are as last received
+		if s.poller != nil {
+			value, err := s.poller.read(s.Timeout)
+			if err != nil {
+				logging.Log(logging.Error, err.Error())
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				return
+			}
+			go s.notify(s.record(value, time.Now()))
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", s.status())
+	case "history":
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", s.getHistory())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+	}
+}
+
+// getDeviceNames returns the names of all sensors in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured sensors.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,517 @@
+package sensor
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	mockMqtt "github.com/kennedn/restate-go/internal/mqtt/frigate/mock"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/mux"
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read sensor input")
+	}
+
+	sensorConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &sensorConfig); err != nil {
+		t.Fatalf("Could not read sensor input")
+	}
+	return &sensorConfig
+}
+
+// alerts records the alerts sent to the emulated alert endpoint.
+type alerts struct {
+	mutex    sync.Mutex
+	requests []alert.Request
+}
+
+func (a *alerts) messages() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	messages := []string{}
+	for _, r := range a.requests {
+		messages = append(messages, r.Token+": "+r.Message)
+	}
+	return messages
+}
+
+// setupHTTPServer emulates an endpoint returning a freezer temperature and a pushover compatible alert endpoint.
+func setupHTTPServer(t *testing.T, alerts *alerts) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			w.Write([]byte(`{"sensors":[{"temperature":-18.5,"humidity":40}]}`))
+		case "/alert":
+			request := alert.Request{}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			alerts.mutex.Lock()
+			alerts.requests = append(alerts.requests, request)
+			alerts.mutex.Unlock()
+			w.Write([]byte(`{"status":1}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// setupSNMPAgent emulates a tank level gauge answering Get requests for the "public" community only.
+func setupSNMPAgent(t *testing.T) net.PacketConn {
+	mib := map[string]gosnmp.SnmpPDU{
+		".1.3.6.1.4.1.8072.1.3.2.3.1.1.4.116.97.110.107": {Type: gosnmp.Integer, Value: 650},
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not start snmp agent: %v", err)
+	}
+
+	go func() {
+		buffer := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			packet, err := gosnmp.Default.SnmpDecodePacket(buffer[:n])
+			if err != nil || packet.Community != "public" {
+				continue
+			}
+
+			variables := []gosnmp.SnmpPDU{}
+			for _, v := range packet.Variables {
+				pdu, ok := mib[v.Name]
+				if !ok {
+					variables = append(variables, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.NoSuchObject})
+					continue
+				}
+				pdu.Name = v.Name
+				variables = append(variables, pdu)
+			}
+
+			packet.PDUType = gosnmp.GetResponse
+			packet.Variables = variables
+			response, err := packet.MarshalMsg()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn
+}
+
+// setupSensors loads the normal config with sources and alerts pointed at the emulators, the SNMP agent is optional.
+func setupSensors(t *testing.T, server *httptest.Server, agent net.PacketConn) (*base, *mux.Router) {
+	base, routes, err := routes(loadConfig(t, "testdata/sensorConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, s := range base.Devices {
+		s.Alert.URL = server.URL + "/alert"
+		switch s.Source {
+		case "http":
+			s.HTTP.URL = server.URL + "/status"
+		case "snmp":
+			if agent == nil {
+				continue
+			}
+			s.SNMP.Port = uint16(agent.LocalAddr().(*net.UDPAddr).Port)
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+	return base, router
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/sensorConfig/normal_config.yaml",
+			routeCount:    5,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/sensorConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/sensorConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/sensorConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/sensorConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/sensor/freezer",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","history"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/sensor/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["freezer","tank","garage"]}`,
+		},
+		{
+			name:         "http_status",
+			method:       "POST",
+			url:          "/sensor/freezer?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"value":-18.5,"unit":"°C","updated":"<time>"}}`,
+		},
+		{
+			name:         "snmp_status",
+			method:       "POST",
+			url:          "/sensor/tank?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"value":65,"unit":"%","updated":"<time>"}}`,
+		},
+		{
+			name:         "mqtt_status_before_message",
+			method:       "POST",
+			url:          "/sensor/garage?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"value":null,"unit":"°C"}}`,
+		},
+		{
+			name:         "mqtt_history_before_message",
+			method:       "POST",
+			url:          "/sensor/garage?code=history",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":[]}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/sensor/freezer?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/sensor/freezer",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/sensor/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	server := setupHTTPServer(t, &alerts{})
+	defer server.Close()
+	agent := setupSNMPAgent(t)
+	defer agent.Close()
+
+	_, router := setupSensors(t, server, agent)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			// Readings are timestamped when taken
+			body := recorder.Body.String()
+			if i := strings.Index(body, `"updated":"`); i != -1 {
+				end := strings.Index(body[i+11:], `"`)
+				body = body[:i+11] + "<time>" + body[i+11+end:]
+			}
+			if body != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	alerts := &alerts{}
+	server := setupHTTPServer(t, alerts)
+	defer server.Close()
+
+	base, _ := setupSensors(t, server, nil)
+	freezer, tank := base.Devices[0], base.Devices[1]
+	now := time.Now()
+
+	for _, value := range []float64{-18, -5, -4, -12} {
+		freezer.notify(freezer.record(value, now))
+	}
+	for _, value := range []float64{300, 150, 100, 250} {
+		tank.notify(tank.record(value, now))
+	}
+
+	assert.Equal(t, []string{
+		"freezer-token: freezer is -5°C, above -10°C",
+		"freezer-token: freezer is back to -12°C",
+		"tank-token: Water tank is running low",
+		"tank-token: tank is back to 25%",
+	}, alerts.messages())
+
+	tank.record(190, now)
+	assert.Equal(t, []string{"below 20%"}, tank.status().Breached)
+	assert.Empty(t, freezer.status().Breached)
+	assert.Len(t, freezer.getHistory(), 4)
+}
+
+func TestStandby(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	mutex := sync.Mutex{}
+	codes := []string{}
+	plug := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Code  string `json:"code"`
+			Value string `json:"value"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		codes = append(codes, request.Code+"="+request.Value)
+		mutex.Unlock()
+		w.Write([]byte(`{"message":"OK"}`))
+	}))
+	defer plug.Close()
+
+	tv := sensor{}
+	if err := yaml.Unmarshal([]byte(`
+name: tv_power
+timeoutMs: 1000
+scale: 1
+intervalSeconds: 60
+historySize: 10
+thresholds:
+  - below: 5
+    forMinutes: 20
+    actions:
+      - url: `+plug.URL+`
+        code: toggle
+        value: "0"
+    exempt:
+      - from: "23:00"
+        to: "01:00"
+        days: [fri]
+`), &tv); err != nil {
+		t.Fatalf("Could not read sensor input")
+	}
+	assert.NoError(t, tv.validate())
+
+	// Thursday evening, standby draw for 25 minutes switches the plug off once
+	thursday := time.Date(2026, 10, 15, 20, 0, 0, 0, time.Local)
+	for _, minutes := range []int{0, 10, 19, 20, 25} {
+		tv.notify(tv.record(2, thursday.Add(time.Duration(minutes)*time.Minute)))
+	}
+	// Watching again resets the clock
+	tv.notify(tv.record(80, thursday.Add(30*time.Minute)))
+	tv.notify(tv.record(2, thursday.Add(40*time.Minute)))
+	tv.notify(tv.record(2, thursday.Add(55*time.Minute)))
+
+	// Friday night past midnight is exempt
+	friday := time.Date(2026, 10, 16, 23, 50, 0, 0, time.Local)
+	tv.notify(tv.record(80, friday))
+	for _, minutes := range []int{0, 20} {
+		tv.notify(tv.record(2, friday.Add(time.Duration(30+minutes)*time.Minute)))
+	}
+	assert.Equal(t, []string{"below 5"}, tv.status().Breached)
+
+	assert.Equal(t, []string{"toggle=0"}, codes)
+}
+
+func TestVentilation(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	mutex := sync.Mutex{}
+	codes := []string{}
+	fan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Code  string `json:"code"`
+			Value string `json:"value"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		codes = append(codes, request.Code+"="+request.Value)
+		mutex.Unlock()
+		w.Write([]byte(`{"message":"OK"}`))
+	}))
+	defer fan.Close()
+
+	bathroom := sensor{}
+	if err := yaml.Unmarshal([]byte(`
+name: bathroom_humidity
+timeoutMs: 1000
+scale: 1
+intervalSeconds: 60
+historySize: 10
+thresholds:
+  - above: 70
+    maxRuntimeMinutes: 30
+    minOffMinutes: 10
+    actions:
+      - url: `+fan.URL+`
+        code: toggle
+        value: "1"
+    clearActions:
+      - url: `+fan.URL+`
+        code: toggle
+        value: "0"
+`), &bathroom); err != nil {
+		t.Fatalf("Could not read sensor input")
+	}
+	assert.NoError(t, bathroom.validate())
+
+	// The fan is stopped after running for 30 minutes, rests for 10 and runs again until the humidity drops
+	now := time.Now()
+	for _, reading := range []struct {
+		minutes int
+		value   float64
+	}{{0, 80}, {10, 85}, {30, 85}, {35, 85}, {40, 85}, {50, 60}, {55, 65}} {
+		bathroom.notify(bathroom.record(reading.value, now.Add(time.Duration(reading.minutes)*time.Minute)))
+	}
+
+	assert.Equal(t, []string{"toggle=1", "toggle=0", "toggle=1", "toggle=0"}, codes)
+
+	bathroom.Thresholds[0].ClearActions = nil
+	assert.Error(t, bathroom.validate())
+}
+
+func TestSubscribe(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	server := setupHTTPServer(t, &alerts{})
+	defer server.Close()
+
+	base, _ := setupSensors(t, server, nil)
+	garage := base.Devices[2]
+
+	garage.subscribe(&mockMqtt.Client{
+		SubscribeFunc: func(client mqtt.Client, callback mqtt.MessageHandler) {
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"temperature":12.5,"linkquality":120}`)})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"linkquality":118}`)})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"temperature":"13.5"}`)})
+			callback(client, &mockMqtt.Message{PayloadVar: []byte(`{"temperature":14}`)})
+		},
+	})
+
+	// Invalid messages are ignored and only the last two readings are held
+	assert.Equal(t, 14.0, *garage.status().Value)
+	history := garage.getHistory()
+	assert.Len(t, history, 2)
+	assert.Equal(t, 13.5, history[0].Value)
+}
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name            string
+		payload         string
+		path            string
+		temperaturePath string
+		expectedValue   float64
+		expectError     bool
+	}{
+		{name: "bare_number", payload: " 21.5\n", expectedValue: 21.5},
+		{name: "nested_path", payload: `{"sensors":[{"level":42}]}`, path: "sensors.0.level", expectedValue: 42},
+		{name: "numeric_string", payload: `{"level":"42.5"}`, path: "level", expectedValue: 42.5},
+		{name: "missing_path", payload: `{"level":42}`, path: "depth", expectError: true},
+		{name: "not_a_number", payload: `{"level":true}`, path: "level", expectError: true},
+		{name: "invalid_bare_number", payload: "on", expectError: true},
+		{name: "dew_point", payload: `{"temperature":20,"humidity":50}`, path: "humidity", temperaturePath: "temperature", expectedValue: 9.3},
+		{name: "dew_point_saturated", payload: `{"temperature":15,"humidity":100}`, path: "humidity", temperaturePath: "temperature", expectedValue: 15},
+		{name: "dew_point_missing_temperature", payload: `{"humidity":50}`, path: "humidity", temperaturePath: "temperature", expectError: true},
+		{name: "dew_point_invalid_humidity", payload: `{"temperature":20,"humidity":0}`, path: "humidity", temperaturePath: "temperature", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := parseValue([]byte(tc.payload), tc.path, tc.temperaturePath)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedValue, value)
+		})
+	}
+}
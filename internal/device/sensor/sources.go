@@ -0,0 +1,204 @@
+package sensor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gosnmp/gosnmp"
+)
+
+// mqttSource is a topic publishing the value of a sensor, either as a bare number or within a JSON object.
+type mqttSource struct {
+	Host            string `yaml:"host"`
+	Port            int    `yaml:"port"`
+	Topic           string `yaml:"topic"`
+	Path            string `yaml:"path"`
+	TemperaturePath string `yaml:"temperaturePath"`
+}
+
+// httpSource is an endpoint returning the value of a sensor, either as a bare number or within a JSON object.
+type httpSource struct {
+	URL             string        `yaml:"url"`
+	Path            string        `yaml:"path"`
+	TemperaturePath string        `yaml:"temperaturePath"`
+	Username        string        `yaml:"username"`
+	Password        config.Secret `yaml:"password"`
+}
+
+// snmpSource is an OID holding the value of a sensor, read with SNMP v2c.
+type snmpSource struct {
+	Host      string `yaml:"host"`
+	Port      uint16 `yaml:"port"`
+	Community string `yaml:"community"`
+	OID       string `yaml:"oid"`
+}
+
+// lookup resolves a dot separated path through nested objects and arrays, e.g. "sensors.0.temperature".
+func lookup(data any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch value := data.(type) {
+		case map[string]any:
+			var ok bool
+			if data, ok = value[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil, false
+			}
+			data = value[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// parse returns the number in a payload, found at path within a JSON payload when set.
+func parse(payload []byte, path string) (float64, error) {
+	if path == "" {
+		return strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+	}
+
+	var data any
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return 0, err
+	}
+	value, ok := lookup(data, path)
+	if !ok {
+		return 0, fmt.Errorf("path \"%s\" not found", path)
+	}
+	switch value := value.(type) {
+	case float64:
+		return value, nil
+	case string:
+		return strconv.ParseFloat(value, 64)
+	}
+	return 0, fmt.Errorf("path \"%s\" is not a number", path)
+}
+
+// dewPoint returns the dew point in °C of air at a temperature in °C and a relative humidity in %, using the Magnus formula.
+func dewPoint(temperature float64, humidity float64) float64 {
+	const b, c = 17.62, 243.12
+	gamma := math.Log(humidity/100) + b*temperature/(c+temperature)
+	return math.Round(c*gamma/(b-gamma)*10) / 10
+}
+
+// parseValue returns the number in a payload like parse, or the dew point when temperaturePath is set, from the relative humidity at
+// path and the temperature at temperaturePath.
+func parseValue(payload []byte, path string, temperaturePath string) (float64, error) {
+	if temperaturePath == "" {
+		return parse(payload, path)
+	}
+	humidity, err := parse(payload, path)
+	if err != nil {
+		return 0, err
+	}
+	if humidity <= 0 || humidity > 100 {
+		return 0, fmt.Errorf("relative humidity %v is out of range", humidity)
+	}
+	temperature, err := parse(payload, temperaturePath)
+	if err != nil {
+		return 0, err
+	}
+	return dewPoint(temperature, humidity), nil
+}
+
+// subscribe connects an MQTT client and records each value published to the configured topic.
+func (s *sensor) subscribe(client mqtt.Client) {
+	token := client.Connect()
+	if err := mqtt.WaitTokenTimeout(token, time.Duration(s.Timeout)*time.Millisecond); err != nil {
+		logging.Log(logging.Error, "Sensor \"%s\" failed to connect to MQTT: %v", s.Name, err)
+		return
+	}
+
+	token = client.Subscribe(s.MQTT.Topic, 0, func(_ mqtt.Client, message mqtt.Message) {
+		value, err := parseValue(message.Payload(), s.MQTT.Path, s.MQTT.TemperaturePath)
+		if err != nil {
+			logging.Log(logging.Error, "Sensor \"%s\" received an invalid value: %v", s.Name, err)
+			return
+		}
+		s.notify(s.record(value, time.Now()))
+	})
+	if err := mqtt.WaitTokenTimeout(token, time.Duration(s.Timeout)*time.Millisecond); err != nil {
+		logging.Log(logging.Error, "Sensor \"%s\" failed to subscribe to MQTT topic: %v", s.Name, err)
+	}
+}
+
+// read retrieves the value from the endpoint.
+func (h *httpSource) read(timeout uint) (float64, error) {
+	client := &http.Client{
+		Timeout: time.Duration(timeout) * time.Millisecond,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, h.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password.Value())
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("received status code %d from %s", resp.StatusCode, h.URL)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return parseValue(body, h.Path, h.TemperaturePath)
+}
+
+// read retrieves the value of the OID, numeric strings such as those returned by some UPSes are parsed.
+func (s *snmpSource) read(timeout uint) (float64, error) {
+	client := &gosnmp.GoSNMP{
+		Target:    s.Host,
+		Port:      s.Port,
+		Community: s.Community,
+		Version:   gosnmp.Version2c,
+		Timeout:   time.Duration(timeout) * time.Millisecond,
+		Retries:   0,
+	}
+	if err := client.Connect(); err != nil {
+		return 0, err
+	}
+	defer client.Conn.Close()
+
+	result, err := client.Get([]string{s.OID})
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Variables) != 1 {
+		return 0, errors.New("no value returned for OID")
+	}
+
+	pdu := result.Variables[0]
+	switch pdu.Type {
+	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance:
+		return 0, fmt.Errorf("OID %s does not exist", s.OID)
+	case gosnmp.OctetString:
+		value, _ := pdu.Value.([]byte)
+		return strconv.ParseFloat(strings.TrimSpace(string(value)), 64)
+	}
+	value, _ := gosnmp.ToBigInt(pdu.Value).Float64()
+	return value, nil
+}
@@ -0,0 +1,64 @@
+package sensor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// window is a time of day range on some days of the week, e.g. 18:00 to 01:00 on Fridays. Windows ending before they start run past
+// midnight into the next day.
+type window struct {
+	From string   `yaml:"from"`
+	To   string   `yaml:"to"`
+	Days []string `yaml:"days"`
+	// From and To as offsets since midnight
+	from time.Duration
+	to   time.Duration
+}
+
+// parse checks the times and days of the window, leaving days empty meaning every day.
+func (w *window) parse() error {
+	for _, t := range []struct {
+		value  string
+		offset *time.Duration
+	}{{w.From, &w.from}, {w.To, &w.to}} {
+		parsed, err := time.Parse("15:04", t.value)
+		if err != nil {
+			return fmt.Errorf("invalid window time \"%s\"", t.value)
+		}
+		*t.offset = time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute
+	}
+	for _, d := range w.Days {
+		if !slices.Contains(weekdays, strings.ToLower(d)) {
+			return fmt.Errorf("invalid window day \"%s\"", d)
+		}
+	}
+	return nil
+}
+
+// on reports whether the window applies on the day of t.
+func (w *window) on(t time.Time) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if strings.ToLower(d) == weekdays[t.Weekday()] {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether t falls within the window, counting the early hours of a window running past midnight as part of the day
+// it started on.
+func (w *window) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.from <= w.to {
+		return w.on(t) && offset >= w.from && offset < w.to
+	}
+	return (offset >= w.from && w.on(t)) || (offset < w.to && w.on(t.AddDate(0, 0, -1)))
+}
@@ -0,0 +1,59 @@
+package device
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Longest delay a sequence may wait between devices
+const maxSequenceDelay = time.Minute
+
+// sequence wraps a route handler so that POSTs with sequential=true write to the devices of a multi-device request one at a time, in the
+// order of their hosts, waiting perDeviceDelayMs between them, e.g. so that amplifiers do not all draw their inrush current at once. Both
+// parameters are removed before the request reaches the handler. As devices are no longer written to at once, the time the request may
+// take is extended by d and the delay for every other device the route can target.
+func sequence(devices int, d time.Duration, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodPost || (!query.Has("sequential") && !query.Has("perDeviceDelayMs")) {
+			handler(w, r)
+			return
+		}
+
+		sequential, err := strconv.ParseBool(query.Get("sequential"))
+		if err != nil {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: sequential", nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+
+		delay := time.Duration(0)
+		if query.Has("perDeviceDelayMs") {
+			delayMs, err := strconv.ParseUint(query.Get("perDeviceDelayMs"), 10, 32)
+			delay = time.Duration(delayMs) * time.Millisecond
+			if err != nil || !sequential || delay > maxSequenceDelay {
+				httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: perDeviceDelayMs", nil)
+				common.JSONResponse(w, httpCode, jsonResponse)
+				return
+			}
+		}
+
+		// Device handlers reject unknown query parameters
+		query.Del("sequential")
+		query.Del("perDeviceDelayMs")
+		r.URL.RawQuery = query.Encode()
+
+		if !sequential {
+			handler(w, r)
+			return
+		}
+
+		ctx := common.WithSequence(r.Context(), delay)
+		ctx = context.WithValue(ctx, extensionKey{}, time.Duration(max(devices-1, 0))*(d+delay))
+		handler(w, r.WithContext(ctx))
+	}
+}
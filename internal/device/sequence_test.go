@@ -0,0 +1,102 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequence(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	// The handler writes to each of its hosts in turn, each write taking stepTime
+	const stepTime = 60 * time.Millisecond
+	var mutex sync.Mutex
+	steps := []string{}
+	queries := []string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		hosts := strings.Split(r.URL.Query().Get("hosts"), ",")
+		mutex.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mutex.Unlock()
+		common.Each(r.Context(), len(hosts), true, func(i int) {
+			select {
+			case <-time.After(stepTime):
+			case <-r.Context().Done():
+				return
+			}
+			mutex.Lock()
+			steps = append(steps, hosts[i])
+			mutex.Unlock()
+		})
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// A route for three devices that would time out if they were written to one at a time without extending its timeout
+	route := sequence(3, 100*time.Millisecond, timeout(100*time.Millisecond, false, handler))
+	send := func(query string) int {
+		mutex.Lock()
+		steps, queries = []string{}, []string{}
+		mutex.Unlock()
+		recorder := httptest.NewRecorder()
+		route(recorder, httptest.NewRequest(http.MethodPost, "/meross?code=toggle&hosts=c,a,b"+query, nil))
+		return recorder.Code
+	}
+
+	// Sequential writes follow the order of the hosts, given time for each device on top of the route's own timeout
+	assert.Equal(t, http.StatusOK, send("&sequential=true"))
+	assert.Equal(t, []string{"c", "a", "b"}, steps)
+	assert.Equal(t, []string{"code=toggle&hosts=c%2Ca%2Cb"}, queries)
+
+	// Delays between devices extend the timeout too, but one over a minute is rejected before anything is written
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, send("&sequential=true&perDeviceDelayMs=20"))
+	assert.GreaterOrEqual(t, time.Since(start), 3*stepTime+2*20*time.Millisecond)
+	assert.Equal(t, http.StatusBadRequest, send("&sequential=true&perDeviceDelayMs=60001"))
+	assert.Empty(t, queries)
+
+	// Writes without sequential are sent at once and need no more than the route's timeout
+	assert.Equal(t, http.StatusOK, send(""))
+	assert.ElementsMatch(t, []string{"c", "a", "b"}, steps)
+	assert.Equal(t, http.StatusOK, send("&sequential=false"))
+
+	// Delays only apply to sequential writes
+	assert.Equal(t, http.StatusBadRequest, send("&perDeviceDelayMs=20"))
+	assert.Equal(t, http.StatusBadRequest, send("&sequential=maybe"))
+}
+
+func TestSequenceTimeout(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	// Steps that take longer than the timeout of the route still time out, the extension only covers the time of each device
+	written := 0
+	var mutex sync.Mutex
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		common.Each(r.Context(), 3, true, func(i int) {
+			select {
+			case <-time.After(200 * time.Millisecond):
+				mutex.Lock()
+				written++
+				mutex.Unlock()
+			case <-r.Context().Done():
+			}
+		})
+		w.WriteHeader(http.StatusOK)
+	}
+
+	recorder := httptest.NewRecorder()
+	sequence(3, 50*time.Millisecond, timeout(50*time.Millisecond, false, handler))(recorder, httptest.NewRequest(http.MethodPost, "/meross?code=toggle&sequential=true", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+	time.Sleep(50 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Zero(t, written)
+}
@@ -0,0 +1,491 @@
+// Package snapcast provides control of Snapcast clients through the server's JSON-RPC API, setting their volume, muting them and
+// moving them between groups and streams.
+package snapcast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// request allows stream and client names as values, as well as volumes
+type request struct {
+	Code  string `json:"code"`
+	Value string `json:"value,omitempty"`
+}
+
+// rpcRequest is a JSON-RPC call of a server method.
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// rpcResponse carries either a result or a JSON-RPC error.
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// volume is a client's volume as reported and set by the server.
+type volume struct {
+	Muted   bool `json:"muted"`
+	Percent int  `json:"percent"`
+}
+
+// rawClient represents the fields of interest of a client from Server.GetStatus.
+type rawClient struct {
+	ID        string `json:"id"`
+	Connected bool   `json:"connected"`
+	Host      struct {
+		Name string `json:"name"`
+	} `json:"host"`
+	Config struct {
+		Name   string `json:"name"`
+		Volume volume `json:"volume"`
+	} `json:"config"`
+}
+
+// rawGroup represents the fields of interest of a group from Server.GetStatus.
+type rawGroup struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	StreamID string      `json:"stream_id"`
+	Muted    bool        `json:"muted"`
+	Clients  []rawClient `json:"clients"`
+}
+
+// rawStream represents the fields of interest of a stream from Server.GetStatus.
+type rawStream struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// rawServer represents the fields of interest from Server.GetStatus.
+type rawServer struct {
+	Server struct {
+		Groups  []rawGroup  `json:"groups"`
+		Streams []rawStream `json:"streams"`
+	} `json:"server"`
+}
+
+// status is the representation of a client returned by the status code.
+type status struct {
+	Connected bool     `json:"connected"`
+	Volume    int      `json:"volume"`
+	Muted     bool     `json:"muted"`
+	Group     string   `json:"group"`
+	Members   []string `json:"members"`
+	Stream    string   `json:"stream"`
+	Playing   bool     `json:"playing"`
+}
+
+// snapcast represents a Snapcast client configuration with name, server and the client to control.
+type snapcast struct {
+	Name    string `yaml:"name"`
+	Timeout uint   `yaml:"timeoutMs"`
+	URL     string `yaml:"url"`
+	Client  string `yaml:"client"`
+	Base    base
+}
+
+// base represents a list of Snapcast clients
+type base struct {
+	Devices []*snapcast
+}
+
+type Device struct{}
+
+// DryRun previews volume, stream and group changes, the server status is still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for Snapcast clients based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Snapcast clients from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "snapcast" {
+			continue
+		}
+		snapcast := snapcast{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &snapcast); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if snapcast.Name == "" || snapcast.Timeout == 0 || snapcast.URL == "" || snapcast.Client == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + snapcast.Name,
+			Handler: snapcast.handler,
+		})
+
+		base.Devices = append(base.Devices, &snapcast)
+
+		logging.Log(logging.Info, "Found device \"%s\"", snapcast.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/snapcast" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/snapcast",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/snapcast/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// getCodes returns a list of control codes for a Snapcast client.
+func getCodes() []string {
+	return []string{"status", "volume", "mute", "stream", "group"}
+}
+
+// call makes a JSON-RPC call to the server, decoding the result when provided. Calls are recorded rather than made when ctx belongs
+// to a dry run, so reads pass a context that does not.
+func (s *snapcast) call(ctx context.Context, method string, params any, result any) error {
+	client := &http.Client{
+		Timeout: time.Duration(s.Timeout) * time.Millisecond,
+	}
+
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("snapserver returned status code %d for %s", resp.StatusCode, method)
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	rpc := rpcResponse{}
+	if err := json.Unmarshal(responseBytes, &rpc); err != nil {
+		return err
+	}
+	if rpc.Error != nil {
+		return fmt.Errorf("snapserver returned \"%s\" for %s", rpc.Error.Message, method)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(rpc.Result, result)
+}
+
+// clientName returns the name a client is shown with, as in the Snapcast apps.
+func clientName(c *rawClient) string {
+	if c.Config.Name != "" {
+		return c.Config.Name
+	}
+	return c.Host.Name
+}
+
+// matches reports whether a client is identified by an ID, configured name or hostname.
+func matches(c *rawClient, client string) bool {
+	return c.ID == client || c.Config.Name == client || c.Host.Name == client
+}
+
+// find returns the server status along with the group and client identified by client.
+func (s *snapcast) find(client string) (*rawServer, *rawGroup, *rawClient, error) {
+	server := rawServer{}
+	if err := s.call(context.Background(), "Server.GetStatus", nil, &server); err != nil {
+		return nil, nil, nil, err
+	}
+
+	for i := range server.Server.Groups {
+		g := &server.Server.Groups[i]
+		for j := range g.Clients {
+			if matches(&g.Clients[j], client) {
+				return &server, g, &g.Clients[j], nil
+			}
+		}
+	}
+	return &server, nil, nil, nil
+}
+
+// errUnknownClient is returned when the configured client is not known to the server.
+var errUnknownClient = errors.New("client not found on snapserver")
+
+// status returns the state of the configured client and its group.
+func (s *snapcast) status() (*status, error) {
+	server, group, client, err := s.find(s.Client)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, errUnknownClient
+	}
+
+	status := status{
+		Connected: client.Connected,
+		Volume:    client.Config.Volume.Percent,
+		Muted:     client.Config.Volume.Muted || group.Muted,
+		Group:     group.ID,
+		Members:   []string{},
+		Stream:    group.StreamID,
+	}
+	for _, c := range group.Clients {
+		status.Members = append(status.Members, clientName(&c))
+	}
+	for _, stream := range server.Server.Streams {
+		if stream.ID == group.StreamID {
+			status.Playing = stream.Status == "playing"
+		}
+	}
+	return &status, nil
+}
+
+// setVolume sets the volume and mute state of the configured client, a nil percent or muted keeps the current value.
+func (s *snapcast) setVolume(ctx context.Context, percent *int, muted *bool) error {
+	_, _, client, err := s.find(s.Client)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return errUnknownClient
+	}
+
+	v := client.Config.Volume
+	if percent != nil {
+		v.Percent = *percent
+	}
+	if muted != nil {
+		v.Muted = *muted
+	} else if percent == nil {
+		v.Muted = !v.Muted
+	}
+
+	return s.call(ctx, "Client.SetVolume", map[string]any{"id": client.ID, "volume": v}, nil)
+}
+
+// setStream switches the group of the configured client to a stream.
+func (s *snapcast) setStream(ctx context.Context, stream string) (bool, error) {
+	server, group, client, err := s.find(s.Client)
+	if err != nil {
+		return false, err
+	}
+	if client == nil {
+		return false, errUnknownClient
+	}
+
+	if !slices.ContainsFunc(server.Server.Streams, func(s rawStream) bool { return s.ID == stream }) {
+		return false, nil
+	}
+
+	return true, s.call(ctx, "Group.SetStream", map[string]string{"id": group.ID, "stream_id": stream}, nil)
+}
+
+// setGroup moves the configured client into the group of another client, or into a group of its own when other is empty.
+func (s *snapcast) setGroup(ctx context.Context, other string) (bool, error) {
+	server, group, client, err := s.find(s.Client)
+	if err != nil {
+		return false, err
+	}
+	if client == nil {
+		return false, errUnknownClient
+	}
+
+	// Removing a client from its group leaves it in a new group of its own
+	if other == "" {
+		if len(group.Clients) == 1 {
+			return true, nil
+		}
+		clients := []string{}
+		for _, c := range group.Clients {
+			if c.ID != client.ID {
+				clients = append(clients, c.ID)
+			}
+		}
+		return true, s.call(ctx, "Group.SetClients", map[string]any{"id": group.ID, "clients": clients}, nil)
+	}
+
+	var target *rawGroup
+	for i := range server.Server.Groups {
+		g := &server.Server.Groups[i]
+		if slices.ContainsFunc(g.Clients, func(c rawClient) bool { return matches(&c, other) }) {
+			target = g
+		}
+	}
+	if target == nil {
+		return false, nil
+	}
+	if target.ID == group.ID {
+		return true, nil
+	}
+
+	clients := []string{client.ID}
+	for _, c := range target.Clients {
+		clients = append(clients, c.ID)
+	}
+	return true, s.call(ctx, "Group.SetClients", map[string]any{"id": target.ID, "clients": clients}, nil)
+}
+
+// Handler is the HTTP handler for Snapcast client control.
+func (s *snapcast) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+	found := true
+
+	switch request.Code {
+	case "status":
+		data, err = s.status()
+	case "volume":
+		percent, convErr := strconv.Atoi(request.Value)
+		if convErr != nil || percent < 0 || percent > 100 {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = s.setVolume(r.Context(), &percent, nil)
+	case "mute":
+		// Toggled when no value is given
+		var muted *bool
+		switch request.Value {
+		case "":
+		case "0", "1":
+			m := request.Value == "1"
+			muted = &m
+		default:
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = s.setVolume(r.Context(), nil, muted)
+	case "stream":
+		if request.Value == "" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		found, err = s.setStream(r.Context(), request.Value)
+	case "group":
+		found, err = s.setGroup(r.Context(), request.Value)
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	if !found {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all Snapcast clients in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured Snapcast clients.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,408 @@
+package snapcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read snapcast input")
+	}
+
+	snapcastConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &snapcastConfig); err != nil {
+		t.Fatalf("Could not read snapcast input")
+	}
+	return &snapcastConfig
+}
+
+// testClient returns a client as reported by the server.
+func testClient(id string, hostname string, name string, percent int) rawClient {
+	c := rawClient{ID: id, Connected: true}
+	c.Host.Name = hostname
+	c.Config.Name = name
+	c.Config.Volume.Percent = percent
+	return c
+}
+
+// setupSnapserver emulates the JSON-RPC API of a server with two groups of clients, recording the methods called.
+func setupSnapserver(t *testing.T, methods *[]string) *httptest.Server {
+	server := rawServer{}
+	server.Server.Streams = []rawStream{{ID: "default", Status: "playing"}, {ID: "announce", Status: "idle"}}
+	server.Server.Groups = []rawGroup{
+		{ID: "group1", StreamID: "default", Clients: []rawClient{testClient("00:11:22:33:44:55", "kitchen-pi", "Kitchen", 50), testClient("00:11:22:33:44:57", "lounge", "", 30)}},
+		{ID: "group2", StreamID: "announce", Clients: []rawClient{testClient("00:11:22:33:44:56", "garden", "", 80)}},
+	}
+
+	// take removes a client from whichever group it is in
+	take := func(id string) rawClient {
+		for i := range server.Server.Groups {
+			g := &server.Server.Groups[i]
+			if j := slices.IndexFunc(g.Clients, func(c rawClient) bool { return c.ID == id }); j != -1 {
+				c := g.Clients[j]
+				g.Clients = slices.Delete(g.Clients, j, j+1)
+				return c
+			}
+		}
+		t.Fatalf("Unknown client %s", id)
+		return rawClient{}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("Could not parse request body")
+		}
+		*methods = append(*methods, request.Method)
+
+		group := func() *rawGroup {
+			for i := range server.Server.Groups {
+				if server.Server.Groups[i].ID == request.Params["id"] {
+					return &server.Server.Groups[i]
+				}
+			}
+			return nil
+		}
+
+		var result any = map[string]any{}
+		switch request.Method {
+		case "Server.GetStatus":
+			result = server
+		case "Client.SetVolume":
+			for i := range server.Server.Groups {
+				for j := range server.Server.Groups[i].Clients {
+					c := &server.Server.Groups[i].Clients[j]
+					if c.ID == request.Params["id"] {
+						v := request.Params["volume"].(map[string]any)
+						c.Config.Volume = volume{Muted: v["muted"].(bool), Percent: int(v["percent"].(float64))}
+					}
+				}
+			}
+		case "Group.SetStream":
+			group().StreamID = request.Params["stream_id"].(string)
+		case "Group.SetClients":
+			g := group()
+			ids := []string{}
+			for _, id := range request.Params["clients"].([]any) {
+				ids = append(ids, id.(string))
+			}
+			// Clients removed from the group are moved into a group of their own
+			for _, c := range slices.Clone(g.Clients) {
+				if !slices.Contains(ids, c.ID) {
+					server.Server.Groups = append(server.Server.Groups, rawGroup{ID: "group-" + c.ID, StreamID: "default", Clients: []rawClient{take(c.ID)}})
+					g = group()
+				}
+			}
+			for _, id := range ids {
+				if !slices.ContainsFunc(g.Clients, func(c rawClient) bool { return c.ID == id }) {
+					c := take(id)
+					g = group()
+					g.Clients = append(g.Clients, c)
+				}
+			}
+			server.Server.Groups = slices.DeleteFunc(server.Server.Groups, func(g rawGroup) bool { return len(g.Clients) == 0 })
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "error": map[string]any{"code": -32601, "message": "Method not found"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/snapcastConfig/normal_config.yaml",
+			routeCount:    5,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/snapcastConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/snapcastConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/snapcastConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/snapcastConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name            string
+		method          string
+		url             string
+		data            string
+		expectedCode    int
+		expectedBody    string
+		expectedMethods []string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/snapcast/kitchen",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","volume","mute","stream","group"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/snapcast/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["kitchen","garden","missing"]}`,
+		},
+		{
+			name:         "status",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"connected":true,"volume":50,"muted":false,"group":"group1","members":["Kitchen","lounge"],"stream":"default","playing":true}}`,
+		},
+		{
+			name:            "volume",
+			method:          "POST",
+			url:             "/snapcast/kitchen",
+			data:            `{"code":"volume","value":"25"}`,
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedMethods: []string{"Server.GetStatus", "Client.SetVolume"},
+		},
+		{
+			name:         "mute_toggle",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=mute",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "status_after_volume_and_mute",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"connected":true,"volume":25,"muted":true,"group":"group1","members":["Kitchen","lounge"],"stream":"default","playing":true}}`,
+		},
+		{
+			name:         "unmute",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=mute&value=0",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:            "stream",
+			method:          "POST",
+			url:             "/snapcast/garden?code=stream&value=default",
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedMethods: []string{"Server.GetStatus", "Group.SetStream"},
+		},
+		{
+			name:            "group_join",
+			method:          "POST",
+			url:             "/snapcast/garden?code=group&value=Kitchen",
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedMethods: []string{"Server.GetStatus", "Group.SetClients"},
+		},
+		{
+			name:         "status_after_group_join",
+			method:       "POST",
+			url:          "/snapcast/garden?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"connected":true,"volume":80,"muted":false,"group":"group1","members":["Kitchen","lounge","garden"],"stream":"default","playing":true}}`,
+		},
+		{
+			name:            "group_leave",
+			method:          "POST",
+			url:             "/snapcast/kitchen?code=group",
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedMethods: []string{"Server.GetStatus", "Group.SetClients"},
+		},
+		{
+			name:         "status_after_group_leave",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"connected":true,"volume":25,"muted":false,"group":"group-00:11:22:33:44:55","members":["Kitchen"],"stream":"default","playing":true}}`,
+		},
+		{
+			name:            "group_leave_alone",
+			method:          "POST",
+			url:             "/snapcast/kitchen?code=group",
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedMethods: []string{"Server.GetStatus"},
+		},
+		{
+			name:         "unknown_stream",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=stream&value=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unknown_group_client",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=group&value=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "volume_out_of_range",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=volume&value=101",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "mute_invalid_value",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=mute&value=2",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unknown_client",
+			method:       "POST",
+			url:          "/snapcast/missing?code=status",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/snapcast/kitchen?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/snapcast/kitchen",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/snapcast/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	methods := []string{}
+	server := setupSnapserver(t, &methods)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/snapcastConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		d.URL = server.URL
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			methods = methods[:0]
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedMethods != nil {
+				assert.Equal(t, tc.expectedMethods, methods)
+			}
+		})
+	}
+
+	t.Run("dry_run_mute", func(t *testing.T) {
+		methods = methods[:0]
+		ctx, dryRun := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/snapcast/kitchen?code=mute&value=1", nil).WithContext(ctx))
+		assert.Equal(t, 200, recorder.Code)
+
+		// The server status is read to find the client, setting the volume is only recorded
+		assert.Equal(t, []string{"Server.GetStatus"}, methods)
+		calls := dryRun.Calls()
+		if assert.Len(t, calls, 1) {
+			assert.Equal(t, "Client.SetVolume", calls[0].Payload.(map[string]any)["method"])
+		}
+	})
+}
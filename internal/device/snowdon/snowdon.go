@@ -1,6 +1,7 @@
 package snowdon
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,7 +14,6 @@ import (
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"gopkg.in/yaml.v3"
@@ -40,6 +40,11 @@ type base struct {
 
 type Device struct{}
 
+// DryRun previews the code a request would send to the snowdon, status reads are still sent.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config)
 	return routes, err
@@ -63,7 +68,7 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &snowdon); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &snowdon); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -85,7 +90,7 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 
 	if len(routes) == 0 {
 		return nil, []router.Route{}, errors.New("no routes generated from config")
-	} else if len(routes) == 1 {
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
 		return &base, routes, nil
 	}
 
@@ -105,20 +110,20 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 	return &base, routes, nil
 }
 
-func (s *snowdon) call(method string, code string) (*rawResponse, int, error) {
+func (s *snowdon) call(ctx context.Context, method string, code string) (*rawResponse, int, error) {
 	client := &http.Client{
 		Timeout: time.Duration(s.Timeout) * time.Millisecond,
 	}
 
 	queryUrl := fmt.Sprintf("http://%s/?code=%s", s.Host, code)
 
-	req, err := http.NewRequest(method, queryUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, method, queryUrl, nil)
 
 	if err != nil {
 		return nil, 0, err
 	}
 	// Send the request and get the response
-	resp, err := client.Do(req)
+	resp, err := device.Do(client, req)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -152,7 +157,7 @@ func (s *snowdon) handler(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	if r.Method == http.MethodGet {
-		response, responseCode, err := s.call("GET", "")
+		response, responseCode, err := s.call(r.Context(), "GET", "")
 		if err != nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
@@ -171,19 +176,17 @@ func (s *snowdon) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
-	response, responseCode, err := s.call("PUT", request.Code)
+	// Status is read with a PUT too, mark it so that it is still sent during a dry run
+	ctx := r.Context()
+	if request.Code == "status" {
+		ctx = device.Read(ctx)
+	}
+	response, responseCode, err := s.call(ctx, "PUT", request.Code)
 	if err != nil || responseCode == 500 {
 		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 		return
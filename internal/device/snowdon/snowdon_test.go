@@ -2,6 +2,7 @@ package snowdon
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -145,7 +146,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  200,
-			expectedBody:  `{"message":"OK","data":{"onoff":"on","input":"aux"}}`,
+			expectedBody:  `{"version":1,"message":"OK","data":{"onoff":"on","input":"aux"}}`,
 		},
 		{
 			name:          "power_no_error",
@@ -155,7 +156,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  200,
-			expectedBody:  `{"message":"OK"}`,
+			expectedBody:  `{"version":1,"message":"OK"}`,
 		},
 		{
 			name:          "get_device_request",
@@ -165,7 +166,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  200,
-			expectedBody:  `{"message":"OK","data":["status","power","mute","volume_up","volume_down","previous","next","play_pause","input","treble_up","treble_down","bass_up","bass_down","pair","flat","music","dialog","movie"]}`,
+			expectedBody:  `{"version":1,"message":"OK","data":["status","power","mute","volume_up","volume_down","previous","next","play_pause","input","treble_up","treble_down","bass_up","bass_down","pair","flat","music","dialog","movie"]}`,
 		},
 		{
 			name:          "get_base_request",
@@ -175,7 +176,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  200,
-			expectedBody:  `{"message":"OK","data":["test1","test2"]}`,
+			expectedBody:  `{"version":1,"message":"OK","data":["test1","test2"]}`,
 		},
 		{
 			name:          "get_base_request_single_device",
@@ -195,7 +196,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  405,
-			expectedBody:  `{"message":"Method Not Allowed"}`,
+			expectedBody:  `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:          "unsupported_base_method",
@@ -205,7 +206,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  405,
-			expectedBody:  `{"message":"Method Not Allowed"}`,
+			expectedBody:  `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:          "malformed_json_body",
@@ -215,7 +216,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  400,
-			expectedBody:  `{"message":"Malformed Or Empty JSON Body"}`,
+			expectedBody:  `{"version":1,"message":"Malformed Or Empty JSON Body"}`,
 		},
 		{
 			name:          "malformed_query_string",
@@ -225,7 +226,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  400,
-			expectedBody:  `{"message":"Malformed or empty query string"}`,
+			expectedBody:  `{"version":1,"message":"Malformed or empty query string"}`,
 		},
 		{
 			name:          "unsupported_code_variable",
@@ -235,7 +236,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  400,
-			expectedBody:  `{"message":"Code Not Recognised"}`,
+			expectedBody:  `{"version":1,"message":"Code Not Recognised"}`,
 		},
 		{
 			name:          "snowdon_internal_500_error",
@@ -245,7 +246,7 @@ func TestHandlers(t *testing.T) {
 			serverConfig:  "testdata/serverConfig/normal_responses.yaml",
 			snowdonConfig: "testdata/snowdonConfig/normal_config.yaml",
 			expectedCode:  500,
-			expectedBody:  `{"message":"Internal Server Error"}`,
+			expectedBody:  `{"version":1,"message":"Internal Server Error"}`,
 		},
 	}
 
@@ -295,3 +296,36 @@ func TestHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	base, routes, err := routes(&config.Config{Devices: []config.Devices{
+		{Type: "snowdon", Config: map[string]any{"name": "soundbar", "host": "127.0.0.1:1", "timeoutMs": 500}},
+	}})
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+	post := func(url string) (*httptest.ResponseRecorder, []device.Call) {
+		ctx, run := device.WithDryRun(context.Background())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil).WithContext(ctx))
+		return recorder, run.Calls()
+	}
+
+	// Codes are recorded without contacting the device
+	recorder, calls := post("/soundbar?code=power")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, []device.Call{{Method: "PUT", URL: "http://127.0.0.1:1/?code=power"}}, calls)
+
+	// Status is still read
+	server := setupHTTPServer(t, "testdata/serverConfig/normal_responses.yaml")
+	defer server.Close()
+	base.Devices[0].Host = strings.TrimPrefix(server.URL, "http://")
+	recorder, calls = post("/soundbar?code=status")
+	assert.Equal(t, `{"version":1,"message":"OK","data":{"onoff":"on","input":"aux"}}`, recorder.Body.String())
+	assert.Empty(t, calls)
+}
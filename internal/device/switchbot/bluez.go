@@ -0,0 +1,61 @@
+package switchbot
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// bluez drives a device directly over Bluetooth LE with gatttool, which must be installed alongside restate with access to the
+// adapter. Commands are written without waiting for the device to report back, so state cannot be read.
+type bluez struct {
+	MAC      string `yaml:"mac"`
+	Adapter  string `yaml:"adapter"`
+	GattTool string `yaml:"gatttool"`
+	timeout  uint
+}
+
+// Characteristic handles commands are written to
+var bluezHandles = map[string]string{
+	"bot":     "0x0016",
+	"curtain": "0x000d",
+}
+
+// Commands written for each model's control codes, curtain positions are appended as percentages closed
+var bluezCommands = map[string]map[string]string{
+	"bot":     {"press": "570100", "on": "570101", "off": "570102"},
+	"curtain": {"open": "570f450105ff00", "close": "570f450105ff64", "stop": "570f450001", "position": "570f450105ff"},
+}
+
+// command writes the command for a control code to the device.
+func (b *bluez) command(ctx context.Context, model string, action string, position int) error {
+	command, ok := bluezCommands[model][action]
+	if !ok {
+		return fmt.Errorf("unsupported action \"%s\" for %s", action, model)
+	}
+	if action == "position" {
+		command += fmt.Sprintf("%02x", 100-position)
+	}
+
+	if device.Record(ctx, device.Call{Method: "BLE", URL: "ble://" + b.MAC, Payload: map[string]string{"handle": bluezHandles[model], "command": command}}) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(b.timeout)*time.Millisecond)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, b.GattTool, "-i", b.Adapter, "-b", b.MAC, "-t", "random",
+		"--char-write-req", "-a", bluezHandles[model], "-n", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gatttool write to %s failed: %w: %s", b.MAC, err, strings.TrimSpace(string(out)))
+	}
+	// gatttool exits successfully even when it could not connect
+	if !strings.Contains(string(out), "written successfully") {
+		return fmt.Errorf("gatttool write to %s failed: %s", b.MAC, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
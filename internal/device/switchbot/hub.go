@@ -0,0 +1,161 @@
+package switchbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// hub drives a device through a Switchbot hub with the Switchbot cloud API, authenticating with the token and secret from the app.
+type hub struct {
+	URL      string        `yaml:"url"`
+	Token    config.Secret `yaml:"token"`
+	Secret   config.Secret `yaml:"secret"`
+	DeviceID string        `yaml:"deviceId"`
+	timeout  uint
+}
+
+// hubResponse wraps every API response, a statusCode of 100 is success.
+type hubResponse struct {
+	StatusCode int             `json:"statusCode"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// hubStatus represents the fields of interest from the status of bots, curtains and meters.
+type hubStatus struct {
+	Power         string   `json:"power"`
+	SlidePosition *int     `json:"slidePosition"`
+	Moving        *bool    `json:"moving"`
+	Temperature   *float64 `json:"temperature"`
+	Humidity      *int     `json:"humidity"`
+	Battery       *int     `json:"battery"`
+}
+
+// Commands sent for each model's control codes
+var hubCommands = map[string]map[string]string{
+	"bot":     {"press": "press", "on": "turnOn", "off": "turnOff"},
+	"curtain": {"open": "turnOn", "close": "turnOff", "stop": "pause", "position": "setPosition"},
+}
+
+// send sends a signed request to a device endpoint, decoding the response body when provided.
+func (h *hub) send(method string, endpoint string, body any, response any) error {
+	client := egress.Client("switchbot", time.Duration(h.timeout)*time.Millisecond)
+
+	var reader io.Reader
+	if body != nil {
+		requestBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestBytes)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(h.URL, "/")+"/v1.1/devices/"+h.DeviceID+"/"+endpoint, reader)
+	if err != nil {
+		return err
+	}
+
+	// Requests are signed with the secret over the token, a millisecond timestamp and a nonce
+	nonceBytes := make([]byte, 8)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	t := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(h.Secret.Value()))
+	mac.Write([]byte(h.Token.Value() + t + nonce))
+
+	req.Header.Set("Authorization", h.Token.Value())
+	req.Header.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("t", t)
+	req.Header.Set("nonce", nonce)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("switchbot returned %d", resp.StatusCode)
+	}
+
+	hubResponse := hubResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&hubResponse); err != nil {
+		return err
+	}
+	if hubResponse.StatusCode != 100 {
+		return fmt.Errorf("switchbot returned %d: %s", hubResponse.StatusCode, hubResponse.Message)
+	}
+	if response != nil {
+		return json.Unmarshal(hubResponse.Body, response)
+	}
+	return nil
+}
+
+// command sends the command for a control code. Curtain positions are sent as percentages closed.
+func (h *hub) command(ctx context.Context, model string, action string, position int) error {
+	command, ok := hubCommands[model][action]
+	if !ok {
+		return fmt.Errorf("unsupported action \"%s\" for %s", action, model)
+	}
+
+	parameter := "default"
+	if action == "position" {
+		parameter = fmt.Sprintf("0,ff,%d", 100-position)
+	}
+
+	body := map[string]string{
+		"command":     command,
+		"parameter":   parameter,
+		"commandType": "command",
+	}
+	// Replies are checked for the hub's own status code, so commands are recorded here rather than sent
+	if device.Record(ctx, device.Call{Method: http.MethodPost, URL: strings.TrimRight(h.URL, "/") + "/v1.1/devices/" + h.DeviceID + "/commands", Payload: body}) {
+		return nil
+	}
+	return h.send(http.MethodPost, "commands", body, nil)
+}
+
+// status returns the state reported by the device to the hub.
+func (h *hub) status(model string) (*status, error) {
+	raw := hubStatus{}
+	if err := h.send(http.MethodGet, "status", nil, &raw); err != nil {
+		return nil, err
+	}
+
+	status := status{Battery: raw.Battery}
+	switch model {
+	case "bot":
+		status.Power = raw.Power
+	case "curtain":
+		if raw.SlidePosition != nil {
+			position := 100 - *raw.SlidePosition
+			status.Position = &position
+		}
+		status.Moving = raw.Moving
+	case "meter":
+		status.Temperature = raw.Temperature
+		status.Humidity = raw.Humidity
+	}
+	return &status, nil
+}
@@ -0,0 +1,274 @@
+// Package switchbot provides control of Switchbot bots and curtains and readings from meters, through a Switchbot hub or a local
+// Bluetooth adapter.
+package switchbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driver is implemented by each way of reaching a device. Positions are percentages open.
+type driver interface {
+	command(ctx context.Context, model string, action string, position int) error
+}
+
+// statuser is implemented by drivers that can read the state of a device.
+type statuser interface {
+	status(model string) (*status, error)
+}
+
+// status is the representation of a device returned by the status code, only the fields reported by the model are set.
+type status struct {
+	Power       string   `json:"power,omitempty"`
+	Position    *int     `json:"position,omitempty"`
+	Moving      *bool    `json:"moving,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Humidity    *int     `json:"humidity,omitempty"`
+	Battery     *int     `json:"battery,omitempty"`
+}
+
+// Control codes offered by each model, before status is added for drivers that support it
+var modelCodes = map[string][]string{
+	"bot":     {"press", "on", "off"},
+	"curtain": {"open", "close", "stop", "position"},
+	"meter":   {},
+}
+
+// switchbot represents a Switchbot device configuration with name, model, driver and driver specific parameters.
+type switchbot struct {
+	Name    string `yaml:"name"`
+	Timeout uint   `yaml:"timeoutMs"`
+	Model   string `yaml:"model"`
+	Driver  string `yaml:"driver"`
+	Hub     *hub   `yaml:"hub"`
+	BlueZ   *bluez `yaml:"bluez"`
+	Base    base
+	driver  driver
+}
+
+// base represents a list of Switchbot devices
+type base struct {
+	Devices []*switchbot
+}
+
+type Device struct{}
+
+// DryRun previews hub and Bluetooth commands, status is still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for Switchbot devices based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts SwitchBot bots, curtains and meters from config, driven through a hub or BlueZ, and returns their routes.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "switchbot" {
+			continue
+		}
+		switchbot := switchbot{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &switchbot); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if switchbot.Name == "" || switchbot.Timeout == 0 || switchbot.Model == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		if _, ok := modelCodes[switchbot.Model]; !ok {
+			logging.Log(logging.Info, "Unable to load device \"%s\": model must be one of 'bot', 'curtain' or 'meter'", switchbot.Name)
+			continue
+		}
+
+		switch switchbot.Driver {
+		case "hub":
+			if switchbot.Hub == nil || switchbot.Hub.Token == "" || switchbot.Hub.Secret == "" || switchbot.Hub.DeviceID == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if switchbot.Hub.URL == "" {
+				switchbot.Hub.URL = "https://api.switch-bot.com"
+			}
+			switchbot.Hub.timeout = switchbot.Timeout
+			switchbot.driver = switchbot.Hub
+		case "bluez":
+			if switchbot.BlueZ == nil || switchbot.BlueZ.MAC == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			// Meters only advertise their readings, which gatttool cannot receive
+			if switchbot.Model == "meter" {
+				logging.Log(logging.Info, "Unable to load device \"%s\": meters are only supported through a hub", switchbot.Name)
+				continue
+			}
+			if switchbot.BlueZ.Adapter == "" {
+				switchbot.BlueZ.Adapter = "hci0"
+			}
+			if switchbot.BlueZ.GattTool == "" {
+				switchbot.BlueZ.GattTool = "gatttool"
+			}
+			switchbot.BlueZ.timeout = switchbot.Timeout
+			switchbot.driver = switchbot.BlueZ
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'hub' or 'bluez'")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + switchbot.Name,
+			Handler: switchbot.handler,
+		})
+
+		base.Devices = append(base.Devices, &switchbot)
+
+		logging.Log(logging.Info, "Found device \"%s\"", switchbot.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/switchbot" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/switchbot",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/switchbot/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// getCodes returns a list of control codes for a device, status is only offered by drivers that can read state.
+func (s *switchbot) getCodes() []string {
+	codes := []string{}
+	if _, ok := s.driver.(statuser); ok {
+		codes = append(codes, "status")
+	}
+	return append(codes, modelCodes[s.Model]...)
+}
+
+// supports reports whether code is a control code for the device.
+func (s *switchbot) supports(code string) bool {
+	for _, c := range s.getCodes() {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler is the HTTP handler for Switchbot device control.
+func (s *switchbot) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", s.getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !s.supports(request.Code) {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = s.driver.(statuser).status(s.Model)
+	case "position":
+		position, convErr := strconv.Atoi(request.Value.String())
+		if convErr != nil || position < 0 || position > 100 {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		err = s.driver.command(r.Context(), s.Model, request.Code, position)
+	default:
+		err = s.driver.command(r.Context(), s.Model, request.Code, 0)
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all Switchbot devices in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured Switchbot devices.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
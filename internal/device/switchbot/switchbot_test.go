@@ -0,0 +1,364 @@
+package switchbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read switchbot input")
+	}
+
+	switchbotConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &switchbotConfig); err != nil {
+		t.Fatalf("Could not read switchbot input")
+	}
+	return &switchbotConfig
+}
+
+// setupHubServer emulates the Switchbot cloud API for a bot, curtain and meter, checking request signatures and recording the
+// commands sent to it.
+func setupHubServer(t *testing.T, mutex *sync.Mutex, requests *[]string) *httptest.Server {
+	statuses := map[string]string{
+		"C271111EC0AB": `{"deviceId":"C271111EC0AB","deviceType":"Bot","power":"off","battery":87}`,
+		"E2F6032048AB": `{"deviceId":"E2F6032048AB","deviceType":"Curtain","slidePosition":75,"moving":false,"battery":64,"calibrate":true}`,
+		"F7538E1ECE73": `{"deviceId":"F7538E1ECE73","deviceType":"Meter","temperature":21.4,"humidity":48,"battery":100}`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mac := hmac.New(sha256.New, []byte("switchbot-secret"))
+		mac.Write([]byte("switchbot-token" + r.Header.Get("t") + r.Header.Get("nonce")))
+		if r.Header.Get("Authorization") != "switchbot-token" || r.Header.Get("sign") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Unauthorized"}`))
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1.1/devices/"), "/")
+		if len(parts) != 2 || statuses[parts[0]] == "" {
+			w.Write([]byte(`{"statusCode":152,"body":{},"message":"error:device not found"}`))
+			return
+		}
+
+		switch parts[1] {
+		case "status":
+			w.Write([]byte(`{"statusCode":100,"body":` + statuses[parts[0]] + `,"message":"success"}`))
+		case "commands":
+			body, _ := io.ReadAll(r.Body)
+			mutex.Lock()
+			*requests = append(*requests, parts[0]+" "+string(body))
+			mutex.Unlock()
+			w.Write([]byte(`{"statusCode":100,"body":{},"message":"success"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/switchbotConfig/normal_config.yaml",
+			routeCount:    7,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/switchbotConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/switchbotConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/switchbotConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/switchbotConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		expectedCode     int
+		expectedBody     string
+		expectedRequests []string
+		expectedWrites   string
+	}{
+		{
+			name:         "get_bot_request",
+			method:       "GET",
+			url:          "/switchbot/kettle",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","press","on","off"]}`,
+		},
+		{
+			name:         "get_meter_request",
+			method:       "GET",
+			url:          "/switchbot/bedroom_meter",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status"]}`,
+		},
+		{
+			name:         "get_bluez_curtain_request",
+			method:       "GET",
+			url:          "/switchbot/bedroom_curtain",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["open","close","stop","position"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/switchbot/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["kettle","lounge_curtain","bedroom_meter","bedroom_curtain","office_bot"]}`,
+		},
+		{
+			name:         "bot_status",
+			method:       "POST",
+			url:          "/switchbot/kettle?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"power":"off","battery":87}}`,
+		},
+		{
+			name:         "curtain_status",
+			method:       "POST",
+			url:          "/switchbot/lounge_curtain?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"position":25,"moving":false,"battery":64}}`,
+		},
+		{
+			name:         "meter_status",
+			method:       "POST",
+			url:          "/switchbot/bedroom_meter?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"temperature":21.4,"humidity":48,"battery":100}}`,
+		},
+		{
+			name:             "bot_press",
+			method:           "POST",
+			url:              "/switchbot/kettle?code=press",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`C271111EC0AB {"command":"press","commandType":"command","parameter":"default"}`},
+		},
+		{
+			name:             "curtain_open",
+			method:           "POST",
+			url:              "/switchbot/lounge_curtain?code=open",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`E2F6032048AB {"command":"turnOn","commandType":"command","parameter":"default"}`},
+		},
+		{
+			name:             "curtain_position",
+			method:           "POST",
+			url:              "/switchbot/lounge_curtain?code=position&value=30",
+			expectedCode:     200,
+			expectedBody:     `{"version":1,"message":"OK"}`,
+			expectedRequests: []string{`E2F6032048AB {"command":"setPosition","commandType":"command","parameter":"0,ff,70"}`},
+		},
+		{
+			name:           "bluez_curtain_position",
+			method:         "POST",
+			url:            "/switchbot/bedroom_curtain?code=position&value=30",
+			expectedCode:   200,
+			expectedBody:   `{"version":1,"message":"OK"}`,
+			expectedWrites: "hci0 0x000d 570f450105ff46\n",
+		},
+		{
+			name:           "bluez_curtain_stop",
+			method:         "POST",
+			url:            "/switchbot/bedroom_curtain?code=stop",
+			expectedCode:   200,
+			expectedBody:   `{"version":1,"message":"OK"}`,
+			expectedWrites: "hci0 0x000d 570f450001\n",
+		},
+		{
+			name:         "bluez_unreachable",
+			method:       "POST",
+			url:          "/switchbot/office_bot?code=press",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "bluez_status",
+			method:       "POST",
+			url:          "/switchbot/bedroom_curtain?code=status",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "position_out_of_range",
+			method:       "POST",
+			url:          "/switchbot/lounge_curtain?code=position&value=101",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "position_without_value",
+			method:       "POST",
+			url:          "/switchbot/lounge_curtain?code=position",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "curtain_code_on_bot",
+			method:       "POST",
+			url:          "/switchbot/kettle?code=open",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/switchbot/kettle",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/switchbot/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	mutex := sync.Mutex{}
+	requests := []string{}
+	server := setupHubServer(t, &mutex, &requests)
+	defer server.Close()
+
+	writes := filepath.Join(t.TempDir(), "writes")
+	t.Setenv("GATTTOOL_LOG", writes)
+
+	base, routes, err := routes(loadConfig(t, "testdata/switchbotConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		if d.Hub != nil {
+			d.Hub.URL = server.URL
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mutex.Lock()
+			requests = requests[:0]
+			mutex.Unlock()
+			os.Remove(writes)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, nil)
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if tc.expectedRequests != nil {
+				assert.Equal(t, tc.expectedRequests, requests)
+			}
+			if tc.expectedWrites != "" {
+				b, _ := os.ReadFile(writes)
+				assert.Equal(t, tc.expectedWrites, string(b))
+			}
+		})
+	}
+	t.Run("dry_run_commands", func(t *testing.T) {
+		mutex.Lock()
+		requests = requests[:0]
+		mutex.Unlock()
+		os.Remove(writes)
+
+		ctx, dryRun := device.WithDryRun(context.Background())
+		for _, url := range []string{"/switchbot/kettle?code=press", "/switchbot/bedroom_curtain?code=position&value=30"} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil).WithContext(ctx))
+			assert.Equal(t, 200, recorder.Code, url)
+		}
+
+		// Neither the hub nor gatttool is reached, both commands are recorded instead
+		mutex.Lock()
+		assert.Empty(t, requests)
+		mutex.Unlock()
+		_, err := os.Stat(writes)
+		assert.True(t, os.IsNotExist(err))
+		calls := dryRun.Calls()
+		if assert.Len(t, calls, 2) {
+			assert.Equal(t, "POST", calls[0].Method)
+			assert.Equal(t, map[string]any{"command": "press", "parameter": "default", "commandType": "command"}, calls[0].Payload)
+			assert.Equal(t, "BLE", calls[1].Method)
+		}
+	})
+}
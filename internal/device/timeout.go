@@ -0,0 +1,104 @@
+package device
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Default time a device request may take before it is answered with 504, overridden by requestTimeoutMs
+const defaultRequestTimeout = 30 * time.Second
+
+// Upstream calls a single request may make in sequence, e.g. reading a device to toggle it, writing it and reading it back to verify it
+const timeoutCalls = 3
+
+// extensionKey holds extra time a request may take on top of the timeout of its route, e.g. to write to devices in sequence
+type extensionKey struct{}
+
+// timeoutMs returns the timeoutMs in a device's config, or 0 when it has none or it is not a number.
+func timeoutMs(c map[string]any) int64 {
+	switch v := c["timeoutMs"].(type) {
+	case int:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// deviceTimeout derives the time a request to a device may take from the timeoutMs in its config, returning 0 when it has none.
+func deviceTimeout(c map[string]any) time.Duration {
+	timeoutMs := timeoutMs(c)
+	if timeoutMs <= 0 {
+		return 0
+	}
+	return timeoutCalls*time.Duration(timeoutMs)*time.Millisecond + time.Second
+}
+
+// timeoutFor returns the time a request to a route may take, the timeout of its device or, for routes that may target any device of a
+// type, the longest of the type. Routes with neither fall back to the request timeout.
+func timeoutFor(name string, timeouts map[string]time.Duration, typeTimeout time.Duration, fallback time.Duration) time.Duration {
+	t, ok := timeouts[name]
+	if !ok {
+		t = typeTimeout
+	}
+	if t == 0 {
+		t = fallback
+	}
+	return t
+}
+
+// timeout wraps a device handler so that it is answered with 504 if it has not responded within d. The handler's request context is
+// cancelled at the same time, aborting any upstream calls made with it. Panics in the handler are passed on to the caller.
+// Responses of routes that stream are not buffered when a stream is asked for, their request context is cancelled and the handler ends
+// the stream, as no 504 can be written. Routes that do not stream are answered with 504 whatever they accept.
+func timeout(d time.Duration, streams bool, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := d
+		if extension, ok := r.Context().Value(extensionKey{}).(time.Duration); ok {
+			limit += extension
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), limit)
+		defer cancel()
+
+		// Streamed responses are written as they happen, so only their upstream calls can be cut short
+		if streams && common.Streaming(r) {
+			handler(w, r.WithContext(ctx))
+			return
+		}
+
+		response := recorder{}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					panicked <- err
+					return
+				}
+				close(done)
+			}()
+			handler(&response, r.WithContext(ctx))
+		}()
+
+		select {
+		case err := <-panicked:
+			panic(err)
+		case <-done:
+			copyResponse(w, &response)
+		case <-ctx.Done():
+			// Nothing to answer when the client has gone away
+			if r.Context().Err() != nil {
+				return
+			}
+			logging.Log(logging.Error, "Request to \"%s\" timed out after %s", r.URL.Path, limit)
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusGatewayTimeout, "Gateway Timeout", nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package device
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	cancelled := make(chan error, 1)
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			cancelled <- r.Context().Err()
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	fast := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	// Handlers that respond in time are passed on as written
+	recorder := httptest.NewRecorder()
+	timeout(50*time.Millisecond, false, fast)(recorder, httptest.NewRequest(http.MethodPost, "/lamp", nil))
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+
+	// Slow handlers are answered with 504 and their context is cancelled
+	recorder = httptest.NewRecorder()
+	start := time.Now()
+	timeout(50*time.Millisecond, false, slow)(recorder, httptest.NewRequest(http.MethodPost, "/lamp", nil))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+	assert.Equal(t, `{"version":1,"message":"Gateway Timeout"}`, recorder.Body.String())
+	assert.ErrorIs(t, <-cancelled, context.DeadlineExceeded)
+
+	// Requests to several devices in sequence are given longer
+	recorder = httptest.NewRecorder()
+	ctx := context.WithValue(context.Background(), extensionKey{}, 2*time.Second)
+	timeout(50*time.Millisecond, false, slow)(recorder, httptest.NewRequest(http.MethodPost, "/meross", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// Asking for a stream from a route that does not stream is still answered with 504
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/lamp", nil)
+	request.Header.Set("Accept", common.NDJSONContentType)
+	timeout(50*time.Millisecond, false, slow)(recorder, request)
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+	assert.ErrorIs(t, <-cancelled, context.DeadlineExceeded)
+
+	// Routes that stream end the stream themselves once their context is cancelled
+	streamed := func(w http.ResponseWriter, r *http.Request) {
+		writer := common.NewNDJSONWriter(w)
+		writer.Write(map[string]string{"name": "lamp"})
+		<-r.Context().Done()
+		writer.Write(map[string]string{"name": "plug", "error": r.Context().Err().Error()})
+	}
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPost, "/meross", nil)
+	request.Header.Set("Accept", common.NDJSONContentType)
+	start = time.Now()
+	timeout(50*time.Millisecond, true, streamed)(recorder, request)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "{\"name\":\"lamp\"}\n{\"error\":\"context deadline exceeded\",\"name\":\"plug\"}\n", recorder.Body.String())
+
+	// Panics are passed on to the caller
+	assert.Panics(t, func() {
+		timeout(time.Second, false, func(w http.ResponseWriter, r *http.Request) { panic("boom") })(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/lamp", nil))
+	})
+}
+
+func TestTimeoutFor(t *testing.T) {
+	timeouts := map[string]time.Duration{
+		"lamp": deviceTimeout(map[string]any{"timeoutMs": 500}),
+		"plug": deviceTimeout(map[string]any{"timeoutMs": 2000.0}),
+	}
+	assert.Equal(t, 2500*time.Millisecond, timeouts["lamp"])
+	assert.Zero(t, deviceTimeout(map[string]any{"timeoutMs": "500"}))
+
+	// A device's own timeout overrides the default, routes for any device of a type take the longest of the type
+	assert.Equal(t, 2500*time.Millisecond, timeoutFor("lamp", timeouts, 7*time.Second, defaultRequestTimeout))
+	assert.Equal(t, 7*time.Second, timeoutFor("meross", timeouts, 7*time.Second, defaultRequestTimeout))
+	assert.Equal(t, defaultRequestTimeout, timeoutFor("tv", timeouts, 0, defaultRequestTimeout))
+}
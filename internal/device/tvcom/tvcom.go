@@ -1,10 +1,11 @@
 package tvcom
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"net/http"
 	"os"
+	"regexp"
 	"sort"
 	"time"
 
@@ -13,7 +14,6 @@ import (
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
 	"github.com/gorilla/websocket"
 	"gopkg.in/yaml.v3"
 )
@@ -46,6 +46,12 @@ type base struct {
 
 type Device struct{}
 
+// Commands are two lower case letters followed by two hex digits of data, anything else would be sent as part of the command
+var (
+	validCommand = regexp.MustCompile(`^[a-z]{2}$`)
+	validData    = regexp.MustCompile(`^[0-9a-f]{2}$`)
+)
+
 func (t *tvcom) getNames() []string {
 	return t.OpcodeNames
 }
@@ -75,18 +81,27 @@ func (o *opcode) getDataCode(name string) string {
 
 // websocketWriteWithResponse sends a message over a WebSocket connection and waits for a response.
 // It returns the response or an error if the response is not received within the specified timeout.
-func (o *opcode) websocketWriteWithResponse(data string) ([]byte, error) {
-	conn, _, err := websocket.DefaultDialer.Dial("ws://"+o.Tvcom.Host, nil)
-	if err != nil {
-		return nil, err
+// During a dry run the message is recorded rather than sent and no response is returned.
+func (o *opcode) websocketWriteWithResponse(ctx context.Context, data string) ([]byte, error) {
+	if !validCommand.MatchString(o.Code) || !validData.MatchString(data) {
+		return nil, errors.New("invalid command or data")
 	}
-	defer conn.Close()
 
 	message := []byte(o.Code + " 00 " + data + "\r")
 	if len(message) != 9 {
 		return nil, errors.New("constructed message did not have the expected size")
 	}
 
+	if device.Record(ctx, device.Call{Method: "WS", URL: "ws://" + o.Tvcom.Host, Payload: string(message)}) {
+		return nil, nil
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+o.Tvcom.Host, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
 	err = conn.WriteMessage(websocket.TextMessage, message)
 	if err != nil {
 		return nil, err
@@ -106,6 +121,11 @@ func (o *opcode) websocketWriteWithResponse(data string) ([]byte, error) {
 	}
 }
 
+// DryRun previews the command a request would write to the TV, status reads are still sent.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config, "")
 	return routes, err
@@ -175,7 +195,7 @@ func routes(config *config.Config, internalConfigPath string) (*base, []router.R
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &tvcom); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &tvcom); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -290,16 +310,9 @@ func (o *opcode) handler(w http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	data := o.getDataCode(request.Code)
@@ -308,7 +321,12 @@ func (o *opcode) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := o.websocketWriteWithResponse(data)
+	// Status reads are still sent during a dry run
+	ctx := r.Context()
+	if request.Code == "status" {
+		ctx = device.Read(ctx)
+	}
+	response, err := o.websocketWriteWithResponse(ctx, data)
 	if err != nil {
 		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 		return
@@ -2,6 +2,7 @@ package tvcom
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io/fs"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/kennedn/restate-go/internal/common/config"
 	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -112,6 +114,14 @@ func TestWebsocketWriteWithResponse(t *testing.T) {
 			timeout:          0,
 			shouldPass:       false,
 		},
+		{
+			name:             "data_not_hex",
+			testCode:         "ka",
+			testData:         "0\r",
+			expectedResponse: []byte(""),
+			timeout:          500,
+			shouldPass:       false,
+		},
 		{
 			name:             "malformed_opcode",
 			testCode:         "malformed",
@@ -159,7 +169,7 @@ func TestWebsocketWriteWithResponse(t *testing.T) {
 				t.Fatalf("Could not locate opcode using testCode %s", tc.testCode)
 			}
 
-			response, err := o.websocketWriteWithResponse(tc.testData)
+			response, err := o.websocketWriteWithResponse(context.Background(), tc.testData)
 			if err != nil && tc.shouldPass {
 				t.Fatalf("websocketWriteWithResponse returned an error: %v", err)
 			}
@@ -285,7 +295,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK"}`,
+			expectedBody: `{"version":1,"message":"OK"}`,
 		},
 		{
 			name:         "no_error_json",
@@ -294,7 +304,7 @@ func TestHandlers(t *testing.T) {
 			data:         []byte(`{"code": "status"}`),
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":"status"}`,
+			expectedBody: `{"version":1,"message":"OK","data":"status"}`,
 		},
 		{
 			name:         "get_device_request",
@@ -303,7 +313,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":["abnormal_state","add_skip","aspect_ratio","auto_configure_vga","backlight_lcd","balance","brightness","colour","colour_temp","contrast","input_select","ir_key","ism_method_plasma","osd_select","power","power_saving_plasma","remote_lock","screen_mute","sharpness","tint","volume","volume_mute"]}`,
+			expectedBody: `{"version":1,"message":"OK","data":["abnormal_state","add_skip","aspect_ratio","auto_configure_vga","backlight_lcd","balance","brightness","colour","colour_temp","contrast","input_select","ir_key","ism_method_plasma","osd_select","power","power_saving_plasma","remote_lock","screen_mute","sharpness","tint","volume","volume_mute"]}`,
 		},
 		{
 			name:         "unsupported_device_method",
@@ -312,7 +322,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 405,
-			expectedBody: `{"message":"Method Not Allowed"}`,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:         "unsupported_opcode_method",
@@ -321,7 +331,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 405,
-			expectedBody: `{"message":"Method Not Allowed"}`,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:         "get_opcode_request",
@@ -330,7 +340,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":["off","on","status"]}`,
+			expectedBody: `{"version":1,"message":"OK","data":["off","on","status"]}`,
 		},
 		{
 			name:         "get_base_request",
@@ -339,7 +349,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":["test1","test2"]}`,
+			expectedBody: `{"version":1,"message":"OK","data":["test1","test2"]}`,
 		},
 		{
 			name:         "get_base_request_single_device",
@@ -357,7 +367,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 405,
-			expectedBody: `{"message":"Method Not Allowed"}`,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:         "malformed_json_body",
@@ -366,7 +376,7 @@ func TestHandlers(t *testing.T) {
 			data:         []byte(`not_json`),
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"Malformed Or Empty JSON Body"}`,
+			expectedBody: `{"version":1,"message":"Malformed Or Empty JSON Body"}`,
 		},
 		{
 			name:         "malformed_query_string",
@@ -375,7 +385,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"Malformed or empty query string"}`,
+			expectedBody: `{"version":1,"message":"Malformed or empty query string"}`,
 		},
 		{
 			name:         "missing_code_variable",
@@ -384,7 +394,7 @@ func TestHandlers(t *testing.T) {
 			data:         nil,
 			tvcomConfig:  "testdata/tvcomConfig/normal_config.yaml",
 			expectedCode: 400,
-			expectedBody: `{"message":"Invalid Parameter: code"}`,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
 		},
 	}
 
@@ -437,3 +447,41 @@ func TestHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	tvcomConfigFile, err := os.ReadFile("testdata/tvcomConfig/normal_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read tvcom input")
+	}
+	tvcomConfig := config.Config{}
+	if err := yaml.Unmarshal(tvcomConfigFile, &tvcomConfig); err != nil {
+		t.Fatalf("Could not read tvcom input")
+	}
+	base, routes, err := routes(&tvcomConfig, "device.yaml")
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	// Commands are recorded without connecting to the TV
+	base.Devices[0].Host = "127.0.0.1:1"
+	ctx, run := device.WithDryRun(context.Background())
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/tvcom/test1/power?code=on", nil).WithContext(ctx))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, []device.Call{{Method: "WS", URL: "ws://127.0.0.1:1", Payload: "ka 00 01\r"}}, run.Calls())
+
+	// Status reads are still sent
+	server := setupWebsocketServer(t, base.Devices[0], 500)
+	defer server.Close()
+	base.Devices[0].Host = strings.TrimPrefix(server.URL, "http://")
+	ctx, run = device.WithDryRun(context.Background())
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/tvcom/test1/power?code=status", nil).WithContext(ctx))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Empty(t, run.Calls())
+}
@@ -0,0 +1,361 @@
+// Package valetudo provides control of vacuum robots running Valetudo via its REST API.
+package valetudo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// request is the valetudo equivalent of device.Request, values are room names rather than numbers.
+type request struct {
+	Code  string `json:"code"`
+	Value string `json:"value,omitempty"`
+}
+
+// attribute represents a single entry from the robot state attributes endpoint.
+type attribute struct {
+	Class string `json:"__class"`
+	Value string `json:"value"`
+	Flag  string `json:"flag"`
+	Level *int   `json:"level"`
+}
+
+// segment represents a single room from the map segmentation capability.
+type segment struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// status is the representation of the robot returned by the status code.
+type status struct {
+	State       string `json:"state"`
+	Battery     *int   `json:"battery,omitempty"`
+	BatteryFlag string `json:"batteryFlag,omitempty"`
+}
+
+// valetudo represents a robot configuration with name, host and optional basic auth credentials.
+type valetudo struct {
+	Name     string        `yaml:"name"`
+	Host     string        `yaml:"host"`
+	Timeout  uint          `yaml:"timeoutMs"`
+	Username string        `yaml:"username"`
+	Password config.Secret `yaml:"password"`
+	Base     base
+}
+
+// base represents a list of robots
+type base struct {
+	Devices []*valetudo
+}
+
+type Device struct{}
+
+// DryRun previews the robot commands a request would send, state and map segments are still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for robots based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Valetudo robot vacuums from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "valetudo" {
+			continue
+		}
+		valetudo := valetudo{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &valetudo); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if valetudo.Name == "" || valetudo.Host == "" {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + valetudo.Name,
+			Handler: valetudo.handler,
+		})
+
+		base.Devices = append(base.Devices, &valetudo)
+
+		logging.Log(logging.Info, "Found device \"%s\"", valetudo.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/valetudo" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/valetudo",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/valetudo/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// call sends a request to a Valetudo API endpoint, encoding body as JSON and decoding the response into v when provided.
+func (v *valetudo) call(ctx context.Context, method string, endpoint string, body any, response any) error {
+	client := &http.Client{
+		Timeout: time.Duration(v.Timeout) * time.Millisecond,
+	}
+
+	var reader io.Reader
+	if body != nil {
+		requestBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s/api/v2/robot/%s", v.Host, endpoint), reader)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if v.Username != "" {
+		req.SetBasicAuth(v.Username, v.Password.Value())
+	}
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("valetudo returned status code %d for %s", resp.StatusCode, endpoint)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(responseBytes, response)
+}
+
+// basicControl sends a start, stop, pause or home action to the robot.
+func (v *valetudo) basicControl(ctx context.Context, action string) error {
+	return v.call(ctx, "PUT", "capabilities/BasicControlCapability", map[string]string{"action": action}, nil)
+}
+
+// segments retrieves the rooms known to the robot's current map.
+func (v *valetudo) segments(ctx context.Context) ([]segment, error) {
+	segments := []segment{}
+	if err := v.call(ctx, "GET", "capabilities/MapSegmentationCapability", nil, &segments); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+// rooms returns the sorted names of all rooms on the robot's current map.
+func (v *valetudo) rooms(ctx context.Context) ([]string, error) {
+	segments, err := v.segments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, s := range segments {
+		if s.Name != "" {
+			names = append(names, s.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// clean starts a segment clean of a comma separated list of room names, matched case insensitively.
+func (v *valetudo) clean(ctx context.Context, rooms string) (bool, error) {
+	segments, err := v.segments(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	ids := []string{}
+	for _, room := range strings.Split(rooms, ",") {
+		room = strings.TrimSpace(room)
+		found := false
+		for _, s := range segments {
+			if strings.EqualFold(s.Name, room) {
+				ids = append(ids, s.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	return true, v.call(ctx, "PUT", "capabilities/MapSegmentationCapability", map[string]any{
+		"action":      "start_segment_action",
+		"segment_ids": ids,
+		"iterations":  1,
+		"customOrder": true,
+	}, nil)
+}
+
+// status retrieves the robot state and battery level.
+func (v *valetudo) status(ctx context.Context) (*status, error) {
+	attributes := []attribute{}
+	if err := v.call(ctx, "GET", "state/attributes", nil, &attributes); err != nil {
+		return nil, err
+	}
+
+	status := status{}
+	for _, a := range attributes {
+		switch a.Class {
+		case "StatusStateAttribute":
+			status.State = a.Value
+		case "BatteryStateAttribute":
+			status.Battery = a.Level
+			status.BatteryFlag = a.Flag
+		}
+	}
+	return &status, nil
+}
+
+// getCodes returns a list of control codes for a robot.
+func getCodes() []string {
+	return []string{"start", "pause", "stop", "dock", "clean", "rooms", "status"}
+}
+
+// Handler is the HTTP handler for robot control.
+func (v *valetudo) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "start", "pause", "stop":
+		err = v.basicControl(r.Context(), request.Code)
+	case "dock":
+		err = v.basicControl(r.Context(), "home")
+	case "clean":
+		if request.Value == "" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+		var found bool
+		found, err = v.clean(r.Context(), request.Value)
+		if err == nil && !found {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+			return
+		}
+	case "rooms":
+		data, err = v.rooms(r.Context())
+	case "status":
+		data, err = v.status(r.Context())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all robots in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured robots.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,297 @@
+package valetudo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read valetudo input")
+	}
+
+	valetudoConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &valetudoConfig); err != nil {
+		t.Fatalf("Could not read valetudo input")
+	}
+	return &valetudoConfig
+}
+
+// setupHTTPServer emulates the Valetudo v2 robot API, recording the last capability request body.
+func setupHTTPServer(t *testing.T, lastRequest *map[string]any) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "valetudo" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v2/robot/state/attributes":
+			w.Write([]byte(`[{"__class":"StatusStateAttribute","metaData":{},"value":"docked","flag":"none"},{"__class":"BatteryStateAttribute","metaData":{},"level":87,"flag":"charging"},{"__class":"AttachmentStateAttribute","metaData":{},"type":"dustbin","attached":true}]`))
+		case r.Method == "GET" && r.URL.Path == "/api/v2/robot/capabilities/MapSegmentationCapability":
+			w.Write([]byte(`[{"__class":"ValetudoMapSegment","metaData":{},"id":"16","name":"Kitchen"},{"__class":"ValetudoMapSegment","metaData":{},"id":"17","name":"Living Room"},{"__class":"ValetudoMapSegment","metaData":{},"id":"18"}]`))
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/api/v2/robot/capabilities/"):
+			*lastRequest = map[string]any{}
+			json.NewDecoder(r.Body).Decode(lastRequest)
+			w.Write([]byte(`"OK"`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/valetudoConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/valetudoConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/valetudoConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/valetudoConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/valetudoConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name            string
+		method          string
+		url             string
+		data            string
+		expectedCode    int
+		expectedBody    string
+		expectedRequest map[string]any
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/valetudo/downstairs",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["start","pause","stop","dock","clean","rooms","status"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/valetudo/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["downstairs","upstairs"]}`,
+		},
+		{
+			name:         "status",
+			method:       "POST",
+			url:          "/valetudo/downstairs?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"docked","battery":87,"batteryFlag":"charging"}}`,
+		},
+		{
+			name:         "rooms",
+			method:       "POST",
+			url:          "/valetudo/downstairs?code=rooms",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["Kitchen","Living Room"]}`,
+		},
+		{
+			name:            "dock",
+			method:          "POST",
+			url:             "/valetudo/downstairs?code=dock",
+			expectedCode:    200,
+			expectedBody:    `{"version":1,"message":"OK"}`,
+			expectedRequest: map[string]any{"action": "home"},
+		},
+		{
+			name:         "clean_rooms",
+			method:       "POST",
+			url:          "/valetudo/downstairs",
+			data:         `{"code":"clean","value":"kitchen, living room"}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+			expectedRequest: map[string]any{
+				"action":      "start_segment_action",
+				"segment_ids": []any{"16", "17"},
+				"iterations":  float64(1),
+				"customOrder": true,
+			},
+		},
+		{
+			name:         "clean_unknown_room",
+			method:       "POST",
+			url:          "/valetudo/downstairs?code=clean&value=garage",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "clean_without_room",
+			method:       "POST",
+			url:          "/valetudo/downstairs?code=clean",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: value"}`,
+		},
+		{
+			name:         "unauthorized_robot",
+			method:       "POST",
+			url:          "/valetudo/upstairs?code=start",
+			expectedCode: 500,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/valetudo/downstairs?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/valetudo/downstairs",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/valetudo/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	var lastRequest map[string]any
+	server := setupHTTPServer(t, &lastRequest)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/valetudoConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		d.Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lastRequest = nil
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedRequest != nil {
+				assert.Equal(t, tc.expectedRequest, lastRequest)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	var lastRequest map[string]any
+	server := setupHTTPServer(t, &lastRequest)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/valetudoConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		d.Host = strings.TrimPrefix(server.URL, "http://")
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	// Rooms are still looked up so that unknown rooms are rejected, but the clean is only recorded
+	ctx, dryRun := device.WithDryRun(context.Background())
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/valetudo/downstairs?code=clean&value=kitchen", nil)
+	router.ServeHTTP(recorder, request.WithContext(ctx))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, lastRequest)
+
+	calls := dryRun.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 recorded call, got %d", len(calls))
+	}
+	assert.Equal(t, "PUT", calls[0].Method)
+	assert.Equal(t, server.URL+"/api/v2/robot/capabilities/MapSegmentationCapability", calls[0].URL)
+	assert.Equal(t, []any{"16"}, calls[0].Payload.(map[string]any)["segment_ids"])
+}
@@ -0,0 +1,101 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kennedn/restate-go/internal/device/common"
+)
+
+// verifier re-reads the status of a device after a successful write, for devices configured with returnState or requests with a verify query parameter.
+type verifier struct {
+	names []string
+}
+
+// returnState reports whether writes to the named route, or to any of the hosts of a base route, always return the resulting state.
+func (v *verifier) returnState(name string, hosts string) bool {
+	targets := []string{name}
+	if !slices.Contains(v.names, name) && hosts != "" {
+		targets = strings.Split(strings.ReplaceAll(hosts, " ", ""), ",")
+	}
+	for _, t := range targets {
+		if slices.Contains(v.names, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap returns a handler that follows successful POSTs, other than for the status code itself, with a status request and returns its data.
+// If the status cannot be read the response of the write is returned unchanged. Streamed responses already report each device's result.
+func (v *verifier) wrap(name string, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			handler(w, r)
+			return
+		}
+
+		verify := false
+		if query := r.URL.Query(); query.Has("verify") {
+			var err error
+			if verify, err = strconv.ParseBool(query.Get("verify")); err != nil {
+				httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: verify", nil)
+				common.JSONResponse(w, httpCode, jsonResponse)
+				return
+			}
+			// Device handlers reject unknown query parameters
+			query.Del("verify")
+			r.URL.RawQuery = query.Encode()
+		}
+
+		request, err := peek(r)
+		if err != nil || request.reads() || common.DryRunning(r.Context()) || common.Streaming(r) || !(verify || v.returnState(name, request.Hosts)) {
+			handler(w, r)
+			return
+		}
+
+		write := recorder{}
+		handler(&write, r)
+		if write.code != http.StatusOK {
+			copyResponse(w, &write)
+			return
+		}
+
+		query := url.Values{"code": {"status"}}
+		if request.Hosts != "" {
+			query.Set("hosts", request.Hosts)
+		}
+		statusRequest := r.Clone(r.Context())
+		statusRequest.URL.RawQuery = query.Encode()
+		statusRequest.Header.Del("Content-Type")
+		statusRequest.Body = http.NoBody
+		statusRequest.ContentLength = 0
+
+		status := recorder{}
+		handler(&status, statusRequest)
+		response := common.Response{}
+		if status.code != http.StatusOK || json.Unmarshal(status.body.Bytes(), &response) != nil {
+			copyResponse(w, &write)
+			return
+		}
+
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", response.Data)
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}
+}
+
+// copyResponse writes a recorded response to w.
+func copyResponse(w http.ResponseWriter, r *recorder) {
+	for k, v := range r.Header() {
+		w.Header()[k] = v
+	}
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	w.WriteHeader(r.code)
+	w.Write(r.body.Bytes())
+}
@@ -0,0 +1,89 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	// The device ignores writes while stuck and cannot be read while unreadable
+	onoff, stuck, unreadable := 0, false, false
+	codes := []string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		request := common.Request{}
+		if err := common.DecodeRequest(r, &request); err != nil {
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+		codes = append(codes, request.Code)
+
+		if request.Code == "status" {
+			if unreadable {
+				httpCode, jsonResponse := common.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				common.JSONResponse(w, httpCode, jsonResponse)
+				return
+			}
+			httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", map[string]int{"onoff": onoff})
+			common.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+		if !stuck {
+			value, _ := request.Value.Int64()
+			onoff = int(value)
+		}
+		httpCode, jsonResponse := common.SetJSONResponse(http.StatusOK, "OK", nil)
+		common.JSONResponse(w, httpCode, jsonResponse)
+	}
+
+	v := &verifier{names: []string{"plug"}}
+	send := func(name string, url string) (int, string) {
+		codes = codes[:0]
+		recorder := httptest.NewRecorder()
+		v.wrap(name, handler)(recorder, httptest.NewRequest(http.MethodPost, url, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// A write that took is read back and the resulting state returned
+	code, body := send("lamp", "/lamp?code=toggle&value=1&verify=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"version":1,"message":"OK","data":{"onoff":1}}`, body)
+	assert.Equal(t, []string{"toggle", "status"}, codes)
+
+	// A write the device did not act on returns the state it is actually in
+	stuck = true
+	code, body = send("lamp", "/lamp?code=toggle&value=0&verify=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"version":1,"message":"OK","data":{"onoff":1}}`, body)
+
+	// A failed read returns the response of the write unchanged
+	stuck, unreadable = false, true
+	code, body = send("lamp", "/lamp?code=toggle&value=0&verify=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"version":1,"message":"OK"}`, body)
+	assert.Equal(t, []string{"toggle", "status"}, codes)
+	unreadable = false
+
+	// Devices configured with returnState are read back without asking, others only when asked
+	_, body = send("plug", "/plug?code=toggle&value=1")
+	assert.Equal(t, `{"version":1,"message":"OK","data":{"onoff":1}}`, body)
+	_, body = send("lamp", "/lamp?code=toggle&value=1")
+	assert.Equal(t, `{"version":1,"message":"OK"}`, body)
+	assert.Equal(t, []string{"toggle"}, codes)
+
+	code, body = send("lamp", "/lamp?code=toggle&verify=maybe")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, `{"version":1,"message":"Invalid Parameter: verify"}`, body)
+
+	// Reads are not read again
+	send("lamp", "/lamp?code=status&verify=true")
+	assert.Equal(t, []string{"status"}, codes)
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// libvirt drives a domain through virsh, which must be installed alongside restate with access to the libvirt URI.
+type libvirt struct {
+	URI     string `yaml:"uri"`
+	Domain  string `yaml:"domain"`
+	Virsh   string `yaml:"virsh"`
+	timeout uint
+}
+
+// Domain states reported by virsh domstate, mapped onto the states reported by Proxmox
+var libvirtStates = map[string]string{
+	"running":  "running",
+	"paused":   "paused",
+	"shut off": "stopped",
+	"shutdown": "stopped",
+	"crashed":  "stopped",
+}
+
+// virsh runs a virsh command against the domain, returning its trimmed output.
+func (l *libvirt) virsh(ctx context.Context, command string) (string, error) {
+	if device.Record(ctx, device.Call{Method: "VIRSH", URL: l.URI, Payload: command + " " + l.Domain}) {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(l.timeout)*time.Millisecond)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, l.Virsh, "-c", l.URI, command, l.Domain).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("virsh %s %s failed: %w: %s", command, l.Domain, err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (l *libvirt) start(ctx context.Context) error {
+	_, err := l.virsh(ctx, "start")
+	return err
+}
+
+func (l *libvirt) shutdown(ctx context.Context) error {
+	_, err := l.virsh(ctx, "shutdown")
+	return err
+}
+
+func (l *libvirt) stop(ctx context.Context) error {
+	_, err := l.virsh(ctx, "destroy")
+	return err
+}
+
+func (l *libvirt) status() (*status, error) {
+	out, err := l.virsh(context.Background(), "domstate")
+	if err != nil {
+		return nil, err
+	}
+
+	state, ok := libvirtStates[out]
+	if !ok {
+		state = out
+	}
+	return &status{State: state}, nil
+}
@@ -0,0 +1,105 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// proxmox drives a virtual machine or container through the Proxmox VE API, authenticating with an API token.
+type proxmox struct {
+	URL     string        `yaml:"url"`
+	TokenID string        `yaml:"tokenId"`
+	Secret  config.Secret `yaml:"secret"`
+	Node    string        `yaml:"node"`
+	ID      uint          `yaml:"id"`
+	Type    string        `yaml:"type"`
+	timeout uint
+}
+
+// proxmoxStatus represents the fields of interest from the status/current endpoint.
+type proxmoxStatus struct {
+	Data *struct {
+		Status string  `json:"status"`
+		CPU    float64 `json:"cpu"`
+		Mem    float64 `json:"mem"`
+		MaxMem float64 `json:"maxmem"`
+		Uptime uint64  `json:"uptime"`
+	} `json:"data"`
+}
+
+// call sends a request to a status endpoint of the machine, decoding the response into v when provided.
+func (p *proxmox) call(ctx context.Context, method string, endpoint string, response any) error {
+	client := &http.Client{
+		Timeout: time.Duration(p.timeout) * time.Millisecond,
+	}
+
+	url := fmt.Sprintf("%s/api2/json/nodes/%s/%s/%d/status/%s", strings.TrimRight(p.URL, "/"), p.Node, p.Type, p.ID, endpoint)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s=%s", p.TokenID, p.Secret.Value()))
+
+	resp, err := device.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxmox returned status code %d for %s", resp.StatusCode, endpoint)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, response)
+}
+
+func (p *proxmox) start(ctx context.Context) error {
+	return p.call(ctx, "POST", "start", nil)
+}
+
+func (p *proxmox) shutdown(ctx context.Context) error {
+	return p.call(ctx, "POST", "shutdown", nil)
+}
+
+func (p *proxmox) stop(ctx context.Context) error {
+	return p.call(ctx, "POST", "stop", nil)
+}
+
+func (p *proxmox) status() (*status, error) {
+	response := proxmoxStatus{}
+	if err := p.call(context.Background(), "GET", "current", &response); err != nil {
+		return nil, err
+	}
+	if response.Data == nil {
+		return nil, fmt.Errorf("proxmox returned no status for %d", p.ID)
+	}
+
+	status := status{State: response.Data.Status}
+	if status.State == "running" {
+		cpu := response.Data.CPU * 100
+		status.CPU = &cpu
+		if response.Data.MaxMem > 0 {
+			memory := response.Data.Mem * 100 / response.Data.MaxMem
+			status.Memory = &memory
+		}
+		status.Uptime = &response.Data.Uptime
+	}
+	return &status, nil
+}
@@ -0,0 +1,235 @@
+// Package vm provides control of virtual machines and containers running on Proxmox VE or libvirt hosts.
+package vm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driver is implemented by each supported hypervisor.
+type driver interface {
+	start(ctx context.Context) error
+	shutdown(ctx context.Context) error
+	stop(ctx context.Context) error
+	status() (*status, error)
+}
+
+// status is the representation of a machine returned by the status code.
+type status struct {
+	State  string   `json:"state"`
+	CPU    *float64 `json:"cpu,omitempty"`
+	Memory *float64 `json:"memory,omitempty"`
+	Uptime *uint64  `json:"uptimeSeconds,omitempty"`
+}
+
+// vm represents a machine configuration with name, driver and driver specific parameters.
+type vm struct {
+	Name    string   `yaml:"name"`
+	Timeout uint     `yaml:"timeoutMs"`
+	Driver  string   `yaml:"driver"`
+	Proxmox *proxmox `yaml:"proxmox"`
+	Libvirt *libvirt `yaml:"libvirt"`
+	Base    base
+	driver  driver
+}
+
+// base represents a list of machines
+type base struct {
+	Devices []*vm
+}
+
+type Device struct{}
+
+// DryRun previews start, shutdown and stop requests, status is still read.
+func (d *Device) DryRun() bool {
+	return true
+}
+
+// Routes generates routes for machines based on a provided configuration.
+func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
+	_, routes, err := routes(config)
+	return routes, err
+}
+
+// routes extracts Proxmox and libvirt virtual machines from config and returns their routes and base configuration.
+func routes(config *config.Config) (*base, []router.Route, error) {
+	routes := []router.Route{}
+	base := base{}
+
+	for _, d := range config.Devices {
+		if d.Type != "vm" {
+			continue
+		}
+		vm := vm{
+			Base: base,
+		}
+
+		yamlConfig, err := yaml.Marshal(d.Config)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to marshal device config")
+			continue
+		}
+
+		if err := device.UnmarshalConfig(yamlConfig, &vm); err != nil {
+			logging.Log(logging.Info, "Unable to unmarshal device config")
+			continue
+		}
+
+		if vm.Name == "" || vm.Timeout == 0 {
+			logging.Log(logging.Info, "Unable to load device due to missing parameters")
+			continue
+		}
+
+		switch vm.Driver {
+		case "proxmox":
+			if vm.Proxmox == nil || vm.Proxmox.URL == "" || vm.Proxmox.TokenID == "" || vm.Proxmox.Secret == "" || vm.Proxmox.Node == "" || vm.Proxmox.ID == 0 {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if vm.Proxmox.Type == "" {
+				vm.Proxmox.Type = "qemu"
+			}
+			if vm.Proxmox.Type != "qemu" && vm.Proxmox.Type != "lxc" {
+				logging.Log(logging.Info, "Unable to load device: proxmox type must be either 'qemu' or 'lxc'")
+				continue
+			}
+			vm.Proxmox.timeout = vm.Timeout
+			vm.driver = vm.Proxmox
+		case "libvirt":
+			if vm.Libvirt == nil || vm.Libvirt.Domain == "" {
+				logging.Log(logging.Info, "Unable to load device due to missing parameters")
+				continue
+			}
+			if vm.Libvirt.URI == "" {
+				vm.Libvirt.URI = "qemu:///system"
+			}
+			if vm.Libvirt.Virsh == "" {
+				vm.Libvirt.Virsh = "virsh"
+			}
+			vm.Libvirt.timeout = vm.Timeout
+			vm.driver = vm.Libvirt
+		default:
+			logging.Log(logging.Info, "Unable to load device: driver must be either 'proxmox' or 'libvirt'")
+			continue
+		}
+
+		routes = append(routes, router.Route{
+			Path:    "/" + vm.Name,
+			Handler: vm.handler,
+		})
+
+		base.Devices = append(base.Devices, &vm)
+
+		logging.Log(logging.Info, "Found device \"%s\"", vm.Name)
+	}
+
+	if len(routes) == 0 {
+		return nil, []router.Route{}, errors.New("no routes found in config")
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
+		return &base, routes, nil
+	}
+
+	for i, r := range routes {
+		routes[i].Path = "/vm" + r.Path
+	}
+
+	routes = append(routes, router.Route{
+		Path:    "/vm",
+		Handler: base.handler,
+	})
+
+	routes = append(routes, router.Route{
+		Path:    "/vm/",
+		Handler: base.handler,
+	})
+	return &base, routes, nil
+}
+
+// getCodes returns a list of control codes for a machine.
+func getCodes() []string {
+	return []string{"status", "start", "shutdown", "stop"}
+}
+
+// Handler is the HTTP handler for machine control.
+func (v *vm) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", getCodes())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := device.Request{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var err error
+	var data any
+
+	switch request.Code {
+	case "status":
+		data, err = v.driver.status()
+	case "start":
+		err = v.driver.start(r.Context())
+	case "shutdown":
+		err = v.driver.shutdown(r.Context())
+	case "stop":
+		err = v.driver.stop(r.Context())
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+		return
+	}
+
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", data)
+}
+
+// getDeviceNames returns the names of all machines in the base configuration.
+func (b *base) getDeviceNames() []string {
+	var names []string
+	for _, d := range b.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// Handler is the HTTP handler for listing configured machines.
+func (b *base) handler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() { device.JSONResponse(w, httpCode, jsonResponse) }()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", b.getDeviceNames())
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+}
@@ -0,0 +1,291 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func loadConfig(t *testing.T, configPath string) *config.Config {
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Could not read vm input")
+	}
+
+	vmConfig := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &vmConfig); err != nil {
+		t.Fatalf("Could not read vm input")
+	}
+	return &vmConfig
+}
+
+// setupHTTPServer emulates the Proxmox VE API for a single qemu machine, tracking whether it is running.
+func setupHTTPServer(t *testing.T) *httptest.Server {
+	running := false
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "PVEAPIToken=root@pam!restate=proxmox-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api2/json/nodes/pve/qemu/100/status/current":
+			if running {
+				w.Write([]byte(`{"data":{"status":"running","cpu":0.125,"mem":1073741824,"maxmem":4294967296,"uptime":3600}}`))
+			} else {
+				w.Write([]byte(`{"data":{"status":"stopped","cpu":0,"mem":0,"maxmem":4294967296,"uptime":0}}`))
+			}
+		case "POST /api2/json/nodes/pve/qemu/100/status/start":
+			running = true
+			w.Write([]byte(`{"data":"UPID:pve:00001234:00005678:65000000:qmstart:100:root@pam!restate:"}`))
+		case "POST /api2/json/nodes/pve/qemu/100/status/shutdown", "POST /api2/json/nodes/pve/qemu/100/status/stop":
+			running = false
+			w.Write([]byte(`{"data":"UPID:pve:00001234:00005678:65000000:qmstop:100:root@pam!restate:"}`))
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+}
+
+func TestRoutes(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	testCases := []struct {
+		name          string
+		configPath    string
+		routeCount    int
+		expectedError error
+	}{
+		{
+			name:          "default_config",
+			configPath:    "testdata/vmConfig/normal_config.yaml",
+			routeCount:    4,
+			expectedError: nil,
+		},
+		{
+			name:          "empty_yaml_config",
+			configPath:    "testdata/vmConfig/empty_yaml_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config",
+			configPath:    "testdata/vmConfig/missing_config.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "missing_config_parameter",
+			configPath:    "testdata/vmConfig/missing_config_parameter.yaml",
+			routeCount:    0,
+			expectedError: errors.New(""),
+		},
+		{
+			name:          "single_device_config",
+			configPath:    "testdata/vmConfig/single_device_config.yaml",
+			routeCount:    1,
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, r, err := routes(loadConfig(t, tc.configPath))
+
+			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
+
+			if len(r) != tc.routeCount {
+				t.Fatalf("Wrong number of routes returned, Expected: %d, Got: %d", tc.routeCount, len(r))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	t.Setenv("VIRSH_STATE", filepath.Join(t.TempDir(), "state"))
+
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		data         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get_device_request",
+			method:       "GET",
+			url:          "/vm/homeassistant",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["status","start","shutdown","stop"]}`,
+		},
+		{
+			name:         "get_base_request",
+			method:       "GET",
+			url:          "/vm/",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":["homeassistant","ubuntu"]}`,
+		},
+		{
+			name:         "proxmox_status_stopped",
+			method:       "POST",
+			url:          "/vm/homeassistant?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"stopped"}}`,
+		},
+		{
+			name:         "proxmox_start",
+			method:       "POST",
+			url:          "/vm/homeassistant",
+			data:         `{"code":"start"}`,
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "proxmox_status_running",
+			method:       "POST",
+			url:          "/vm/homeassistant?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"running","cpu":12.5,"memory":25,"uptimeSeconds":3600}}`,
+		},
+		{
+			name:         "proxmox_shutdown",
+			method:       "POST",
+			url:          "/vm/homeassistant?code=shutdown",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "libvirt_status_stopped",
+			method:       "POST",
+			url:          "/vm/ubuntu?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"stopped"}}`,
+		},
+		{
+			name:         "libvirt_start",
+			method:       "POST",
+			url:          "/vm/ubuntu?code=start",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "libvirt_status_running",
+			method:       "POST",
+			url:          "/vm/ubuntu?code=status",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK","data":{"state":"running"}}`,
+		},
+		{
+			name:         "libvirt_stop",
+			method:       "POST",
+			url:          "/vm/ubuntu?code=stop",
+			expectedCode: 200,
+			expectedBody: `{"version":1,"message":"OK"}`,
+		},
+		{
+			name:         "unsupported_code_variable",
+			method:       "POST",
+			url:          "/vm/ubuntu?code=monkey",
+			expectedCode: 400,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
+		},
+		{
+			name:         "unsupported_device_method",
+			method:       "DELETE",
+			url:          "/vm/ubuntu",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+		{
+			name:         "unsupported_base_method",
+			method:       "POST",
+			url:          "/vm/",
+			expectedCode: 405,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
+		},
+	}
+
+	server := setupHTTPServer(t)
+	defer server.Close()
+
+	base, routes, err := routes(loadConfig(t, "testdata/vmConfig/normal_config.yaml"))
+	if err != nil {
+		t.Fatalf("routes returned an error: %v", err)
+	}
+	for _, d := range base.Devices {
+		if d.Proxmox != nil {
+			d.Proxmox.URL = server.URL
+		}
+	}
+
+	router := mux.NewRouter()
+	for _, r := range routes {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.data))
+			if tc.data != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.expectedCode {
+				t.Errorf("Unexpected HTTP status code. Expected: %d, Got: %d", tc.expectedCode, recorder.Code)
+			}
+
+			if recorder.Body.String() != tc.expectedBody {
+				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+
+	t.Run("dry_run_start", func(t *testing.T) {
+		status := func(url string) string {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", url+"?code=status", nil))
+			return recorder.Body.String()
+		}
+		before := []string{status("/vm/homeassistant"), status("/vm/ubuntu")}
+
+		ctx, dryRun := device.WithDryRun(context.Background())
+		for _, url := range []string{"/vm/homeassistant?code=start", "/vm/ubuntu?code=start"} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", url, nil).WithContext(ctx))
+			assert.Equal(t, 200, recorder.Code, url)
+		}
+
+		// Neither machine is started, the Proxmox request and virsh command are recorded instead
+		assert.Equal(t, before, []string{status("/vm/homeassistant"), status("/vm/ubuntu")})
+		assert.Equal(t, []device.Call{
+			{Method: "POST", URL: server.URL + "/api2/json/nodes/pve/qemu/100/status/start"},
+			{Method: "VIRSH", URL: "qemu:///system", Payload: "start ubuntu"},
+		}, dryRun.Calls())
+	})
+
+	t.Run("libvirt_unknown_domain", func(t *testing.T) {
+		l := &libvirt{URI: "qemu:///system", Domain: "windows", Virsh: "testdata/virsh", timeout: 1000}
+		_, err := l.status()
+		assert.ErrorContains(t, err, "failed to get domain 'windows'")
+	})
+}
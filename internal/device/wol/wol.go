@@ -1,11 +1,12 @@
 package wol
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/kennedn/restate-go/internal/common/config"
@@ -13,19 +14,20 @@ import (
 	device "github.com/kennedn/restate-go/internal/device/common"
 	router "github.com/kennedn/restate-go/internal/router/common"
 
-	"github.com/gorilla/schema"
-	"golang.org/x/net/icmp"
-	"golang.org/x/net/ipv4"
 	"gopkg.in/yaml.v3"
 )
 
 type wol struct {
-	Name       string `yaml:"name"`
-	Timeout    uint   `yaml:"timeoutMs"`
-	Host       string `yaml:"host"`
-	MacAddress string `yaml:"macAddress"`
-	base       base
-	conn       net.PacketConn
+	Name         string   `yaml:"name"`
+	Timeout      uint     `yaml:"timeoutMs"`
+	Host         string   `yaml:"host"`
+	MacAddress   string   `yaml:"macAddress"`
+	MacAddresses []string `yaml:"macAddresses"`
+	Broadcast    string   `yaml:"broadcast"`
+	Interface    string   `yaml:"interface"`
+	base         base
+	udpAddr      *net.UDPAddr
+	conn         net.PacketConn
 }
 
 type base struct {
@@ -35,6 +37,11 @@ type base struct {
 
 type Device struct{}
 
+// DryRun previews the magic packets a request would send, pings are still sent to read whether devices are on.
+func (d *Device) DryRun() bool {
+	return true
+}
+
 func (d *Device) Routes(config *config.Config) ([]router.Route, error) {
 	_, routes, err := routes(config)
 	return routes, err
@@ -64,16 +71,21 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 			continue
 		}
 
-		if err := yaml.Unmarshal(yamlConfig, &wol); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &wol); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
 
-		if wol.Name == "" || wol.Host == "" || wol.MacAddress == "" {
+		if wol.Name == "" || wol.Host == "" || len(wol.macAddresses()) == 0 {
 			logging.Log(logging.Info, "Unable to load device due to missing parameters")
 			continue
 		}
 
+		if wol.udpAddr, err = wol.broadcastAddr(); err != nil {
+			logging.Log(logging.Info, "Unable to load device \"%s\": %v", wol.Name, err)
+			continue
+		}
+
 		routes = append(routes, router.Route{
 			Path:    "/wol/" + wol.Name,
 			Handler: wol.handler,
@@ -86,7 +98,7 @@ func routes(config *config.Config) (*base, []router.Route, error) {
 
 	if len(routes) == 0 {
 		return nil, []router.Route{}, errors.New("no routes generated from config")
-	} else if len(routes) == 1 {
+	} else if len(routes) == 1 && !config.AlwaysBaseRoute {
 		return &base, routes, nil
 	}
 
@@ -128,94 +140,125 @@ func (b *base) handler(writer http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (w *wol) wakeOnLan() error {
-	var conn net.PacketConn
-	var err error
+// macAddresses returns every MAC address of the device, e.g. of both its wired and wireless NICs.
+func (w *wol) macAddresses() []string {
+	if w.MacAddress == "" {
+		return w.MacAddresses
+	}
+	return append([]string{w.MacAddress}, w.MacAddresses...)
+}
 
-	if w.conn != nil {
-		conn = w.conn
-	} else {
-		conn, err = net.ListenPacket("udp", ":0")
-		if err != nil {
-			return err
+// broadcastAddr returns the address magic packets are sent to, preferring the configured broadcast address, then the broadcast
+// address of the configured interface's IPv4 network. It returns nil when neither is configured, so that the default is used.
+func (w *wol) broadcastAddr() (*net.UDPAddr, error) {
+	if w.Broadcast != "" {
+		host, port := w.Broadcast, 9
+		if h, p, err := net.SplitHostPort(w.Broadcast); err == nil {
+			if port, err = strconv.Atoi(p); err != nil {
+				return nil, fmt.Errorf("invalid broadcast port \"%s\"", p)
+			}
+			host = h
+		}
+		ip := net.ParseIP(host).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid broadcast address \"%s\"", w.Broadcast)
 		}
+		return &net.UDPAddr{IP: ip, Port: port}, nil
 	}
 
-	macAddress, err := net.ParseMAC(w.MacAddress)
-	if err != nil {
-		return err
+	if w.Interface == "" {
+		return nil, nil
 	}
 
-	if len(macAddress) != 6 {
-		return errors.New("Invalid hardware address")
+	iface, err := net.InterfaceByName(w.Interface)
+	if err != nil {
+		return nil, err
 	}
-
-	// 6 * 0xff (6 bytes) + 6 * macAddress (96 bytes) = 102
-	payload := make([]byte, 102)
-
-	// Set first 6 bytes to 0xFF
-	for i := 0; i < 6; i++ {
-		payload[i] = 0xFF
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
 	}
+	for _, addr := range addrs {
+		network, ok := addr.(*net.IPNet)
+		if !ok || network.IP.To4() == nil || len(network.Mask) != net.IPv4len {
+			continue
+		}
+		ip := make(net.IP, net.IPv4len)
+		for i := range ip {
+			ip[i] = network.IP.To4()[i] | ^network.Mask[i]
+		}
+		return &net.UDPAddr{IP: ip, Port: 9}, nil
+	}
+	return nil, fmt.Errorf("no IPv4 network on interface \"%s\"", w.Interface)
+}
 
-	// Place 16 copies of macAddress (6 bytes) at offset i*6+6
-	for i := 0; i < 16; i++ {
-		copy(payload[i*6+6:i*6+12], macAddress)
+// wakeOnLan sends a magic packet to each of the device's MAC addresses, recording them instead during a dry run.
+func (w *wol) wakeOnLan(ctx context.Context) error {
+	addr := w.udpAddr
+	if addr == nil {
+		addr = w.base.udpAddr
 	}
+	timeout := time.Duration(w.Timeout) * time.Millisecond
 
-	conn.SetDeadline(time.Now().Add(time.Duration(w.Timeout) * time.Millisecond))
-	_, err = conn.WriteTo(payload, w.base.udpAddr)
-	return err
-}
+	for _, macAddress := range w.macAddresses() {
+		payload, err := device.MagicPacket(macAddress)
+		if err != nil {
+			return err
+		}
 
-func (w *wol) ping() error {
-	var conn net.PacketConn
-	var err error
+		if device.Record(ctx, device.Call{Method: "UDP", URL: "udp://" + addr.String(), Payload: map[string]string{"magicPacket": macAddress}}) {
+			continue
+		}
 
-	if w.conn != nil {
-		conn = w.conn
-	} else {
-		conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		if w.conn != nil {
+			w.conn.SetDeadline(time.Now().Add(timeout))
+			_, err = w.conn.WriteTo(payload, addr)
+		} else {
+			err = device.SendPacket(payload, addr, timeout)
+		}
 		if err != nil {
 			return err
 		}
 	}
-	defer func() {
-		conn.Close()
-	}()
+	return nil
+}
 
+func (w *wol) ping() error {
 	ipAddr, err := net.ResolveIPAddr("ip4", w.Host)
 	if err != nil {
 		return err
 	}
 
-	msg := icmp.Message{
-		Type: ipv4.ICMPTypeEcho,
-		Code: 0,
-		Body: &icmp.Echo{
-			ID:  os.Getpid() & 0xffff,
-			Seq: 1,
-		},
+	timeout := time.Duration(w.Timeout) * time.Millisecond
+	if w.conn == nil {
+		return device.Ping(ipAddr, timeout)
 	}
 
-	msgBytes, err := msg.Marshal(nil)
+	msgBytes, err := device.EchoRequest()
 	if err != nil {
 		return err
 	}
 
-	conn.SetDeadline(time.Now().Add(time.Duration(w.Timeout) * time.Millisecond))
-	_, err = conn.WriteTo(msgBytes, ipAddr)
+	w.conn.SetDeadline(time.Now().Add(timeout))
+	_, err = w.conn.WriteTo(msgBytes, ipAddr)
 	if err != nil {
 		return err
 	}
 
 	response := make([]byte, 1500)
-	_, _, err = conn.ReadFrom(response)
-	if err != nil {
-		return err
-	}
+	_, _, err = w.conn.ReadFrom(response)
+	return err
+}
 
-	return nil
+// poweredOn reports whether the device answers pings.
+func (w *wol) poweredOn() (bool, error) {
+	err := w.ping()
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func (w *wol) handler(writer http.ResponseWriter, r *http.Request) {
@@ -227,7 +270,7 @@ func (w *wol) handler(writer http.ResponseWriter, r *http.Request) {
 	}()
 
 	if r.Method == http.MethodGet {
-		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", []string{"power", "status"})
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", []string{"power", "status", "on", "off"})
 		return
 	}
 
@@ -238,34 +281,44 @@ func (w *wol) handler(writer http.ResponseWriter, r *http.Request) {
 
 	request := device.Request{}
 
-	if r.Header.Get("Content-Type") == "application/json" {
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed Or Empty JSON Body", nil)
-			return
-		}
-	} else {
-		if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Malformed or empty query string", nil)
-			return
-		}
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
 	switch request.Code {
 	case "status":
-		err := w.ping()
+		on, err := w.poweredOn()
+		if err != nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+		} else if on {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", "on")
+		} else {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", "off")
+		}
+		return
+
+	// Unlike power, which toggles devices utilising Action-On-LAN, on and off only send a magic packet when the device is not already
+	// in that state, so that they are safe to schedule
+	case "on", "off":
+		on, err := w.poweredOn()
 		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", "off")
-			} else {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+			return
+		}
+
+		if on != (request.Code == "on") {
+			if err := w.wakeOnLan(r.Context()); err != nil {
 				httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				return
 			}
-		} else {
-			httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", "on")
 		}
+
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
 		return
 
 	case "power":
-		err := w.wakeOnLan()
+		err := w.wakeOnLan(r.Context())
 		if err != nil {
 			httpCode, jsonResponse = device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
 			return
@@ -2,6 +2,7 @@ package wol
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"net"
 	"net/http/httptest"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv4"
@@ -140,7 +142,7 @@ func TestWakeOnLan(t *testing.T) {
 				conn: mockConn,
 			}
 
-			err := w.wakeOnLan()
+			err := w.wakeOnLan(context.Background())
 
 			assert.IsType(t, tc.expectedError, err, "Error should be of type \"%T\", got \"%T (%v)\"", tc.expectedError, err, err)
 
@@ -151,6 +153,111 @@ func TestWakeOnLan(t *testing.T) {
 	}
 }
 
+func TestWakeOnLanMacAddresses(t *testing.T) {
+	var writes []net.Addr
+
+	mockConn := &mockPacketConn{
+		writeToFunc: func(b []byte, addr net.Addr) (int, error) {
+			writes = append(writes, addr)
+			return 0, nil
+		},
+	}
+
+	w := &wol{
+		Name:         "multiple_mac_addresses",
+		Timeout:      100,
+		MacAddress:   "00:11:22:33:44:55",
+		MacAddresses: []string{"00:11:22:33:44:56"},
+		Broadcast:    "10.0.0.255:7",
+		conn:         mockConn,
+	}
+
+	var err error
+	w.udpAddr, err = w.broadcastAddr()
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.wakeOnLan(context.Background()))
+	assert.Equal(t, []net.Addr{w.udpAddr, w.udpAddr}, writes)
+	assert.Equal(t, "10.0.0.255:7", w.udpAddr.String())
+}
+
+func TestWakeOnLanDryRun(t *testing.T) {
+	writes := 0
+	w := &wol{
+		Name:       "dry_run",
+		Timeout:    100,
+		MacAddress: "00:11:22:33:44:55",
+		udpAddr:    &net.UDPAddr{IP: net.ParseIP("10.0.0.255"), Port: 9},
+		conn: &mockPacketConn{
+			writeToFunc: func(b []byte, addr net.Addr) (int, error) {
+				writes++
+				return 0, nil
+			},
+		},
+	}
+
+	// Magic packets are recorded rather than sent
+	ctx, run := device.WithDryRun(context.Background())
+	assert.NoError(t, w.wakeOnLan(ctx))
+	assert.Zero(t, writes)
+	assert.Equal(t, []device.Call{{Method: "UDP", URL: "udp://10.0.0.255:9", Payload: map[string]any{"magicPacket": "00:11:22:33:44:55"}}}, run.Calls())
+}
+
+func TestBroadcastAddr(t *testing.T) {
+	testCases := []struct {
+		name          string
+		broadcast     string
+		iface         string
+		expectedAddr  string
+		expectedError bool
+	}{
+		{
+			name:         "default",
+			expectedAddr: "<nil>",
+		},
+		{
+			name:         "address",
+			broadcast:    "192.168.2.255",
+			expectedAddr: "192.168.2.255:9",
+		},
+		{
+			name:         "address_and_port",
+			broadcast:    "192.168.2.255:7",
+			expectedAddr: "192.168.2.255:7",
+		},
+		{
+			name:          "invalid_address",
+			broadcast:     "monkey",
+			expectedError: true,
+		},
+		{
+			name:          "invalid_port",
+			broadcast:     "192.168.2.255:monkey",
+			expectedError: true,
+		},
+		{
+			name:          "unknown_interface",
+			iface:         "monkey0",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &wol{Broadcast: tc.broadcast, Interface: tc.iface}
+
+			addr, err := w.broadcastAddr()
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAddr, addr.String())
+		})
+	}
+}
+
 func TestPing(t *testing.T) {
 
 	testCases := []struct {
@@ -293,6 +400,12 @@ func TestRoutes(t *testing.T) {
 			routeCount:    4,
 			expectedError: nil,
 		},
+		{
+			name:          "wol_single_device_always_base_route",
+			configPath:    "testdata/config/single_device_always_base_route.yaml",
+			routeCount:    3,
+			expectedError: nil,
+		},
 		{
 			name:          "wol_empty_yaml_config",
 			configPath:    "testdata/config/empty_yaml_config.yaml",
@@ -350,6 +463,8 @@ func TestWolHandler(t *testing.T) {
 		readError    error
 		expectedCode int
 		expectedBody string
+		// expectedWrites is only checked when set
+		expectedWrites int
 	}{
 		{
 			name:         "status_no_error",
@@ -359,7 +474,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":"on"}`,
+			expectedBody: `{"version":1,"message":"OK","data":"on"}`,
 		},
 		{
 			name:         "status_read_timeout_error",
@@ -369,7 +484,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    &TimeoutError{},
 			writeError:   nil,
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":"off"}`,
+			expectedBody: `{"version":1,"message":"OK","data":"off"}`,
 		},
 		{
 			name:         "status_write_timeout_error",
@@ -379,7 +494,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   &TimeoutError{},
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":"off"}`,
+			expectedBody: `{"version":1,"message":"OK","data":"off"}`,
 		},
 		{
 			name:         "status_read_unknown_error",
@@ -389,7 +504,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    errors.New(""),
 			writeError:   nil,
 			expectedCode: 500,
-			expectedBody: `{"message":"Internal Server Error"}`,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
 		},
 		{
 			name:         "power_no_error",
@@ -399,7 +514,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 200,
-			expectedBody: `{"message":"OK"}`,
+			expectedBody: `{"version":1,"message":"OK"}`,
 		},
 		{
 			name:         "power_timeout_write_error",
@@ -409,7 +524,51 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   &TimeoutError{},
 			expectedCode: 500,
-			expectedBody: `{"message":"Internal Server Error"}`,
+			expectedBody: `{"version":1,"message":"Internal Server Error"}`,
+		},
+		{
+			name:           "on_when_off",
+			method:         "POST",
+			url:            "/wol/test1?code=on",
+			data:           nil,
+			readError:      &TimeoutError{},
+			writeError:     nil,
+			expectedCode:   200,
+			expectedBody:   `{"version":1,"message":"OK"}`,
+			expectedWrites: 2,
+		},
+		{
+			name:           "on_when_on",
+			method:         "POST",
+			url:            "/wol/test1?code=on",
+			data:           nil,
+			readError:      nil,
+			writeError:     nil,
+			expectedCode:   200,
+			expectedBody:   `{"version":1,"message":"OK"}`,
+			expectedWrites: 1,
+		},
+		{
+			name:           "off_when_off",
+			method:         "POST",
+			url:            "/wol/test1?code=off",
+			data:           nil,
+			readError:      &TimeoutError{},
+			writeError:     nil,
+			expectedCode:   200,
+			expectedBody:   `{"version":1,"message":"OK"}`,
+			expectedWrites: 1,
+		},
+		{
+			name:           "off_read_unknown_error",
+			method:         "POST",
+			url:            "/wol/test1?code=off",
+			data:           nil,
+			readError:      errors.New(""),
+			writeError:     nil,
+			expectedCode:   500,
+			expectedBody:   `{"version":1,"message":"Internal Server Error"}`,
+			expectedWrites: 1,
 		},
 		{
 			name:         "get_device_request",
@@ -419,7 +578,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":["power","status"]}`,
+			expectedBody: `{"version":1,"message":"OK","data":["power","status","on","off"]}`,
 		},
 		{
 			name:         "get_base_request",
@@ -429,7 +588,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 200,
-			expectedBody: `{"message":"OK","data":["test1","test2"]}`,
+			expectedBody: `{"version":1,"message":"OK","data":["test1","test2"]}`,
 		},
 		{
 			name:         "unsupported_device_method",
@@ -439,7 +598,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 405,
-			expectedBody: `{"message":"Method Not Allowed"}`,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:         "unsupported_base_method",
@@ -449,7 +608,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 405,
-			expectedBody: `{"message":"Method Not Allowed"}`,
+			expectedBody: `{"version":1,"message":"Method Not Allowed"}`,
 		},
 		{
 			name:         "malformed_json_body",
@@ -459,7 +618,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 400,
-			expectedBody: `{"message":"Malformed Or Empty JSON Body"}`,
+			expectedBody: `{"version":1,"message":"Malformed Or Empty JSON Body"}`,
 		},
 		{
 			name:         "malformed_query_string",
@@ -469,7 +628,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 400,
-			expectedBody: `{"message":"Malformed or empty query string"}`,
+			expectedBody: `{"version":1,"message":"Malformed or empty query string"}`,
 		},
 		{
 			name:         "unsupported_code_variable",
@@ -479,7 +638,7 @@ func TestWolHandler(t *testing.T) {
 			readError:    nil,
 			writeError:   nil,
 			expectedCode: 400,
-			expectedBody: `{"message":"Invalid Parameter: code"}`,
+			expectedBody: `{"version":1,"message":"Invalid Parameter: code"}`,
 		},
 	}
 
@@ -506,8 +665,10 @@ func TestWolHandler(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			writes := 0
 			mockConn := &mockPacketConn{
 				writeToFunc: func(b []byte, addr net.Addr) (int, error) {
+					writes++
 					return 0, tc.writeError
 				},
 				readFunc: func(b []byte) (int, net.Addr, error) {
@@ -533,6 +694,10 @@ func TestWolHandler(t *testing.T) {
 			if recorder.Body.String() != tc.expectedBody {
 				t.Errorf("Unexpected response body. Expected: %s, Got: %s", tc.expectedBody, recorder.Body.String())
 			}
+
+			if tc.expectedWrites != 0 && writes != tc.expectedWrites {
+				t.Errorf("Unexpected number of writes. Expected: %d, Got: %d", tc.expectedWrites, writes)
+			}
 		})
 	}
 }
@@ -0,0 +1,20 @@
+package common
+
+import (
+	"context"
+
+	router "github.com/kennedn/restate-go/internal/router/common"
+)
+
+// Listener is an MQTT listener that is started in the background once the HTTP server is serving, and stopped on shutdown.
+type Listener interface {
+	Name() string
+	Ready() bool
+	Start(ctx context.Context)
+	Stop()
+}
+
+// Router is implemented by listeners that expose HTTP endpoints, paths are prefixed with the api version when registered.
+type Router interface {
+	Routes() []router.Route
+}
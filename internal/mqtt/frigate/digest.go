@@ -0,0 +1,188 @@
+package frigate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/egress"
+	"github.com/kennedn/restate-go/internal/common/i18n"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+)
+
+// Number of highest scoring events listed in a digest
+const notableEvents = 3
+
+// digestCount is the number of events seen by a camera, broken down by label.
+type digestCount struct {
+	camera string
+	total  int
+	labels map[string]int
+}
+
+// nextDigest returns the first time after now that a digest is due, digests are sent at the configured time of day and every interval after it.
+func nextDigest(now time.Time, at time.Duration, interval time.Duration) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(at)
+	for next.After(now) {
+		next = next.Add(-interval)
+	}
+	for !next.After(now) {
+		next = next.Add(interval)
+	}
+	return next
+}
+
+// runDigest sends a digest of frigate events at each interval until ctx is cancelled.
+func (l *listener) runDigest(ctx context.Context) {
+	interval := time.Duration(l.Config.Digest.IntervalHours) * time.Hour
+	for {
+		next := nextDigest(time.Now(), l.digestAt, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		if err := l.sendDigest(next.Add(-interval), next); err != nil {
+			logging.Log(logging.Error, "Failed to send digest for \"%s\": %v", l.Config.Name, err)
+		}
+	}
+}
+
+// getEvents retrieves the frigate events that started between after and before.
+func (l *listener) getEvents(after time.Time, before time.Time) ([]event, error) {
+	url := fmt.Sprintf("%s/api/events?after=%d&before=%d&limit=-1", l.Config.Frigate.URL, after.Unix(), before.Unix())
+	client := egress.Client("frigate", time.Duration(l.Config.Timeout)*time.Millisecond)
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get events: received status code %d", resp.StatusCode)
+	}
+
+	var events []event
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal events: %w", err)
+	}
+	return events, nil
+}
+
+// score returns the top score of an event, newer versions of frigate report it under data.
+func (e *event) score() float64 {
+	if e.Data.TopScore != 0 || e.TopScore == nil {
+		return e.Data.TopScore
+	}
+	return *e.TopScore
+}
+
+// createDigestRequest summarises events into counts per camera and label followed by the highest scoring clips.
+func (l *listener) createDigestRequest(events []event, interval time.Duration) alert.Request {
+	counts := map[string]*digestCount{}
+	for _, e := range events {
+		c, ok := counts[e.Camera]
+		if !ok {
+			c = &digestCount{camera: e.Camera, labels: map[string]int{}}
+			counts[e.Camera] = c
+		}
+		c.total++
+		c.labels[e.Label]++
+	}
+
+	cameras := []*digestCount{}
+	for _, c := range counts {
+		cameras = append(cameras, c)
+	}
+	sort.Slice(cameras, func(i int, j int) bool {
+		if cameras[i].total != cameras[j].total {
+			return cameras[i].total > cameras[j].total
+		}
+		return cameras[i].camera < cameras[j].camera
+	})
+
+	lines := []string{fmt.Sprintf(i18n.T("%d events in the last %d hours"), len(events), int(interval.Hours()))}
+	for _, c := range cameras {
+		labels := []string{}
+		for label := range c.labels {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for i, label := range labels {
+			labels[i] = fmt.Sprintf("%s %d", humanizeString(label), c.labels[label])
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d (%s)", humanizeString(c.camera), c.total, strings.Join(labels, ", ")))
+	}
+
+	notable := []event{}
+	for _, e := range events {
+		if e.HasClip {
+			notable = append(notable, e)
+		}
+	}
+	sort.SliceStable(notable, func(i int, j int) bool {
+		return notable[i].score() > notable[j].score()
+	})
+	if len(notable) > notableEvents {
+		notable = notable[:notableEvents]
+	}
+
+	if len(notable) > 0 {
+		lines = append(lines, "", i18n.T("Notable clips:"))
+	}
+	for _, e := range notable {
+		lines = append(lines, fmt.Sprintf("%s %s %s (%.0f%%) %s/api/events/%s/clip.mp4",
+			time.Unix(int64(e.StartTime), 0).Format("15:04"),
+			humanizeString(e.Label),
+			humanizeString(e.Camera),
+			e.score()*100,
+			l.Config.Frigate.ExternalUrl,
+			e.ID))
+	}
+
+	request := alert.Request{
+		Message:  strings.Join(lines, "\n"),
+		Title:    i18n.T("Frigate digest"),
+		Priority: toJsonNumber(l.Config.Alert.Priority),
+		Token:    l.Config.Alert.Token.Value(),
+		User:     l.Config.Alert.User,
+		URL:      l.Config.Frigate.ExternalUrl,
+		URLTitle: "Open Frigate",
+	}
+
+	// Attach the thumbnail of the highest scoring event
+	if len(notable) > 0 {
+		if attachmentBase64, err := l.attachmentBase64(notable[0].ID); err == nil {
+			request.AttachmentBase64 = attachmentBase64
+			request.AttachmentType = "image/jpeg"
+		}
+	}
+	return request
+}
+
+// sendDigest sends a digest of the events that started between after and before, nothing is sent if there were none.
+func (l *listener) sendDigest(after time.Time, before time.Time) error {
+	events, err := l.getEvents(after, before)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		logging.Log(logging.Info, "No events to digest for \"%s\"", l.Config.Name)
+		return nil
+	}
+
+	_, code, err := l.sendAlert(l.createDigestRequest(events, before.Sub(after)))
+	if err != nil {
+		return err
+	}
+	if code != http.StatusOK {
+		return fmt.Errorf("received status code %d", code)
+	}
+	return nil
+}
@@ -2,25 +2,33 @@ package frigate
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+	"github.com/kennedn/restate-go/internal/common/i18n"
+	"github.com/kennedn/restate-go/internal/common/inbox"
 	"github.com/kennedn/restate-go/internal/common/logging"
 	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	"github.com/kennedn/restate-go/internal/mqtt/common"
 	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 	"gopkg.in/yaml.v3"
 )
 
@@ -90,8 +98,20 @@ type rawResponse struct {
 
 // Device represents an MQTT device that listens to messages and triggers alerts.
 type listener struct {
-	Base   base
-	Config *listenerConfig
+	Base       base
+	Config     *listenerConfig
+	connection *connection
+	templates  templates
+	snooze     *snooze
+	digestAt   time.Duration
+	downloads  chan struct{}
+}
+
+// connection tracks whether a listener has subscribed, it is shared between copies of a listener.
+type connection struct {
+	mutex   sync.Mutex
+	ready   bool
+	stopped bool
 }
 
 // Config represents the configuration for the MQTT alert device.
@@ -100,42 +120,120 @@ type listenerConfig struct {
 	Client  mqtt.Client
 	Timeout uint `yaml:"timeoutMs"`
 	MQTT    struct {
-		Host string `yaml:"host"`
-		Port int    `yaml:"port"`
+		Host              string `yaml:"host"`
+		Port              int    `yaml:"port"`
+		AvailabilityTopic string `yaml:"availabilityTopic"`
 	} `yaml:"mqtt"`
 	Alert struct {
-		URL      string `yaml:"url"`
-		Token    string `yaml:"token"`
-		User     string `yaml:"user"`
-		Priority int    `yaml:"priority"`
+		URL      string        `yaml:"url"`
+		Token    config.Secret `yaml:"token"`
+		User     string        `yaml:"user"`
+		Priority int           `yaml:"priority"`
+		Title    string        `yaml:"title"`
+		Message  string        `yaml:"message"`
+		Realtime *bool         `yaml:"realtime"`
 	} `yaml:"alert"`
+	SubLabels subLabelConfig `yaml:"subLabels"`
+	Digest    struct {
+		Enabled       bool   `yaml:"enabled"`
+		Time          string `yaml:"time"`
+		IntervalHours uint   `yaml:"intervalHours"`
+	} `yaml:"digest"`
 	Frigate struct {
-		URL         string `yaml:"url"`
-		ExternalUrl string `yaml:"externalUrl"`
-		CacheEvents bool   `yaml:"cacheEvents"`
-		CachePath   string `yaml:"cachePath"`
+		URL         string     `yaml:"url"`
+		ExternalUrl string     `yaml:"externalUrl"`
+		CacheEvents bool       `yaml:"cacheEvents"`
+		CachePath   string     `yaml:"cachePath"`
+		CacheSink   sinkConfig `yaml:"cacheSink"`
+		Checksums   bool       `yaml:"checksums"`
+		Downloads   int        `yaml:"maxDownloads"`
 	} `yaml:"frigate"`
 }
 
+// templates are the parsed alert title and message templates of a listener, nil when not configured.
+type templates struct {
+	title   *template.Template
+	message *template.Template
+}
+
+// alertData is the event information available to alert templates.
+type alertData struct {
+	ID        string
+	Camera    string
+	Severity  string
+	Object    string
+	Objects   []string
+	Zone      string
+	Zones     []string
+	SubLabels []string
+	Score     float64
+}
+
 type base struct {
 	Listeners []*listener
 }
 
 type Device struct{}
 
+// Emoji used by the emoji template function for common frigate labels
+var emojis = map[string]string{
+	"person":     "🚶",
+	"car":        "🚗",
+	"motorcycle": "🏍️",
+	"bicycle":    "🚲",
+	"dog":        "🐕",
+	"cat":        "🐈",
+	"bird":       "🐦",
+	"package":    "📦",
+}
+
+// Functions available to alert templates
+var templateFuncs = template.FuncMap{
+	"humanize": func(value any) string {
+		switch v := value.(type) {
+		case []string:
+			return joinStringSlice(v, conjunction(), true)
+		case string:
+			return humanizeString(v)
+		}
+		return fmt.Sprint(value)
+	},
+	"percent": func(score float64) string {
+		return fmt.Sprintf("%.0f%%", score*100)
+	},
+	"emoji": func(label string) string {
+		return emojis[label]
+	},
+}
+
+// Bounds of the jittered backoff between attempts to start a listener
+var (
+	minRetryBackoff = time.Second
+	maxRetryBackoff = time.Minute
+)
+
 // toJsonNumber converts a numeric value to a JSON number.
 func toJsonNumber(value any) json.Number {
 	return json.Number(fmt.Sprintf("%d", value))
 }
 
+// humanizeString returns the translation of a label if there is one, otherwise title casing each of its words.
 func humanizeString(str string) string {
+	if translated, ok := i18n.Lookup(str); ok {
+		return translated
+	}
 	strArr := []string{}
 	for _, word := range strings.Split(str, "_") {
-		strArr = append(strArr, cases.Title(language.English).String(word))
+		strArr = append(strArr, cases.Title(i18n.Tag()).String(word))
 	}
 	return strings.Join(strArr, " ")
 }
 
+// conjunction returns the separator used to join humanized labels in the current locale.
+func conjunction() string {
+	return " " + i18n.T("and") + " "
+}
+
 func joinStringSlice(str []string, seperator string, humanize bool) string {
 	strArr := []string{}
 	for _, s := range str {
@@ -148,10 +246,45 @@ func joinStringSlice(str []string, seperator string, humanize bool) string {
 	return strings.Join(strArr, seperator)
 }
 
+// parseTemplates parses the optional alert title and message templates.
+func parseTemplates(title string, message string) (templates, error) {
+	t := templates{}
+	var err error
+	if title != "" {
+		if t.title, err = template.New("title").Funcs(templateFuncs).Parse(title); err != nil {
+			return templates{}, err
+		}
+	}
+	if message != "" {
+		if t.message, err = template.New("message").Funcs(templateFuncs).Parse(message); err != nil {
+			return templates{}, err
+		}
+	}
+	return t, nil
+}
+
+// render executes an alert template, returning the fallback if the template is not set or fails.
+func render(t *template.Template, data *alertData, fallback string) string {
+	if t == nil {
+		return fallback
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		logging.Log(logging.Error, "Failed to render alert %s: %v", t.Name(), err)
+		return fallback
+	}
+	return b.String()
+}
+
 // Create mqtt Listeners from a config
-func (d *Device) Listeners(config *config.Config) ([]listener, error) {
+func (d *Device) Listeners(config *config.Config) ([]common.Listener, error) {
 	_, listeners, err := listeners(config, nil)
-	return listeners, err
+
+	commonListeners := []common.Listener{}
+	for i := range listeners {
+		commonListeners = append(commonListeners, &listeners[i])
+	}
+	return commonListeners, err
 }
 
 // listeners is a function that creates one or more MQTT listeners
@@ -179,7 +312,7 @@ func listeners(config *config.Config, client mqtt.Client) (*base, []listener, er
 		}
 
 		// Unmarshal the YAML config into the listenerConfig struct
-		if err := yaml.Unmarshal(yamlConfig, &listenerConfig); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &listenerConfig); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -190,6 +323,14 @@ func listeners(config *config.Config, client mqtt.Client) (*base, []listener, er
 			continue
 		}
 
+		// Parse alert templates so that mistakes are reported at startup rather than on the first event
+		templates, err := parseTemplates(listenerConfig.Alert.Title, listenerConfig.Alert.Message)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to load device due to invalid alert template: %v", err)
+			continue
+		}
+		listener.templates = templates
+
 		// Set default values for optional parameters
 		if listenerConfig.MQTT.Port == 0 {
 			listenerConfig.MQTT.Port = 1883
@@ -200,6 +341,37 @@ func listeners(config *config.Config, client mqtt.Client) (*base, []listener, er
 		if listenerConfig.Frigate.CacheEvents && listenerConfig.Frigate.CachePath == "" {
 			listenerConfig.Frigate.CachePath = "/tmp/cache"
 		}
+		if listenerConfig.Frigate.CacheSink.Type == "" {
+			listenerConfig.Frigate.CacheSink.Type = localSink
+		}
+		if !validSink(&listenerConfig.Frigate.CacheSink) {
+			logging.Log(logging.Info, "Unable to load device due to invalid cache sink \"%s\"", listenerConfig.Frigate.CacheSink.Type)
+			continue
+		}
+		if !listenerConfig.SubLabels.valid() {
+			logging.Log(logging.Info, "Unable to load device due to invalid sub label rules, each needs subLabels and actions a url and code")
+			continue
+		}
+		if len(listenerConfig.SubLabels.Unrecognised.Objects) == 0 {
+			listenerConfig.SubLabels.Unrecognised.Objects = []string{"person"}
+		}
+		if listenerConfig.Alert.Realtime == nil {
+			realtime := true
+			listenerConfig.Alert.Realtime = &realtime
+		}
+		if listenerConfig.Digest.Time == "" {
+			listenerConfig.Digest.Time = "08:00"
+		}
+		if listenerConfig.Digest.IntervalHours == 0 {
+			listenerConfig.Digest.IntervalHours = 24
+		}
+
+		digestAt, err := time.Parse("15:04", listenerConfig.Digest.Time)
+		if err != nil {
+			logging.Log(logging.Info, "Unable to load device due to invalid digest time \"%s\"", listenerConfig.Digest.Time)
+			continue
+		}
+		listener.digestAt = time.Duration(digestAt.Hour())*time.Hour + time.Duration(digestAt.Minute())*time.Minute
 
 		// Create MQTT client if not provided
 		if client == nil {
@@ -208,21 +380,28 @@ func listeners(config *config.Config, client mqtt.Client) (*base, []listener, er
 			clientOpts.SetCleanSession(false)
 			clientOpts.AddBroker(fmt.Sprintf("tcp://%s:%d", listenerConfig.MQTT.Host, listenerConfig.MQTT.Port))
 			clientOpts.SetClientID("restate-go")
+			// Let the broker announce that the service has gone away if the connection drops without a clean shutdown
+			if topic := listenerConfig.MQTT.AvailabilityTopic; topic != "" {
+				clientOpts.SetWill(topic, "offline", 1, true)
+				clientOpts.SetOnConnectHandler(func(c mqtt.Client) {
+					publishAvailability(c, topic, "online", listenerConfig.Timeout)
+				})
+			}
 			client = mqtt.NewClient(clientOpts)
 		}
 
-		// Attempt to connect to the MQTT broker with a timeout
-		token := client.Connect()
-		if err = mqtt.WaitTokenTimeout(token, time.Duration(listenerConfig.Timeout)*time.Millisecond); err != nil {
-			logging.Log(logging.Info, err.Error())
-			continue
-		}
-
-		// Set the MQTT client in the listenerConfig
+		// Set the MQTT client in the listenerConfig, connecting is deferred to Start so that an unavailable broker can be retried
 		listenerConfig.Client = client
 
 		// Set the listenerConfig in the listener
 		listener.Config = &listenerConfig
+		listener.connection = &connection{}
+		listener.snooze = &snooze{
+			cameras: map[string]time.Time{},
+		}
+		if listenerConfig.Frigate.Downloads > 0 {
+			listener.downloads = make(chan struct{}, listenerConfig.Frigate.Downloads)
+		}
 
 		// Append the listener to the base object and the listeners slice
 		base.Listeners = append(base.Listeners, &listener)
@@ -256,6 +435,11 @@ func (l *listener) subscriptionCallback(_ mqtt.Client, message mqtt.Message) {
 			wg.Add(1)
 			go func(eventId string) {
 				defer wg.Done()
+				// Limit concurrent downloads so that spinning disks are not saturated
+				if l.downloads != nil {
+					l.downloads <- struct{}{}
+					defer func() { <-l.downloads }()
+				}
 				err := l.downloadEvent(eventId, review.After.Severity, timeout)
 				if err != nil {
 					logging.Log(logging.Error, "Failed to cache event %s: %v", eventId, err)
@@ -274,41 +458,150 @@ func (l *listener) subscriptionCallback(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 
+	// Recognised faces and plates can act, e.g. opening a gate, as soon as frigate sees them, whatever the severity of the review
+	l.sendSubLabelActions(&review)
+
 	// Return if this is not a new alert or an upgrade from detection to alert
 	if !((review.Type == "new" && review.After.Severity == "alert") ||
 		(review.Type == "update" && review.Before.Severity == "detection" && review.After.Severity == "alert")) {
 		return
 	}
 
+	// Listeners relying on the digest only cache events
+	if !*l.Config.Alert.Realtime {
+		return
+	}
+
+	// Events are still cached while snoozed, only the alert is suppressed
+	if l.snoozed(review.After.Camera, time.Now()) {
+		logging.Log(logging.Info, "Suppressed alert for %s while snoozed", review.After.Camera)
+		return
+	}
+
+	// Known faces and plates can suppress an alert or change its priority, as can objects frigate has not recognised
+	suppress, priority := l.route(&review.After)
+	if suppress {
+		logging.Log(logging.Info, "Suppressed alert for %s, recognised %s", review.After.Camera, strings.Join(review.After.Data.SubLabels, ", "))
+		return
+	}
+
 	// Process the event and create alert request
-	alertRequest := l.createAlertRequest(&review)
+	alertRequest := l.createAlertRequest(&review, priority)
 
 	_, _, _ = l.sendAlert(alertRequest)
 }
 
-// Subscribe to frigate reviews topic and process review messages.
-func (l *listener) Listen() {
-	if l.Config.Client == nil {
-		logging.Log(logging.Error, "MQTT client is not initialized")
-		return
+// publishAvailability publishes a retained online / offline state to an availability topic.
+func publishAvailability(client mqtt.Client, topic string, state string, timeout uint) {
+	token := client.Publish(topic, 1, true, state)
+	if err := mqtt.WaitTokenTimeout(token, time.Duration(timeout)*time.Millisecond); err != nil {
+		logging.Log(logging.Error, "Failed to publish availability to %s: %v", topic, err)
+	}
+}
+
+// jitter returns a random duration between half and all of backoff, so that retries from several listeners are spread out.
+func jitter(backoff time.Duration) time.Duration {
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// start connects to the broker if the client is not already connected, then subscribes to frigate reviews.
+func (l *listener) start() error {
+	timeout := time.Duration(l.Config.Timeout) * time.Millisecond
+
+	if !l.Config.Client.IsConnected() {
+		if err := mqtt.WaitTokenTimeout(l.Config.Client.Connect(), timeout); err != nil {
+			return err
+		}
+	}
+
+	if l.Config.MQTT.AvailabilityTopic != "" {
+		publishAvailability(l.Config.Client, l.Config.MQTT.AvailabilityTopic, "online", l.Config.Timeout)
 	}
 
 	// Configure callback for frigate reviews topic
 	token := l.Config.Client.Subscribe("frigate/reviews", 0, l.subscriptionCallback)
 
 	// Check that subscription to topic occured
-	if err := mqtt.WaitTokenTimeout(token, time.Duration(l.Config.Timeout)*time.Millisecond); err != nil {
-		logging.Log(logging.Error, "Failed to subscribe to MQTT topic: %v", token.Error())
+	if err := mqtt.WaitTokenTimeout(token, timeout); err != nil {
+		return fmt.Errorf("failed to subscribe to MQTT topic: %w", err)
+	}
+	return nil
+}
+
+// Start subscribes to the frigate reviews topic and processes review messages. A broker that is unavailable is
+// retried with a jittered backoff, Start returns once subscribed or when ctx is cancelled.
+func (l *listener) Start(ctx context.Context) {
+	if l.Config.Client == nil {
+		logging.Log(logging.Error, "MQTT client is not initialized")
+		return
+	}
+
+	if l.Config.Digest.Enabled {
+		go l.runDigest(ctx)
+	}
+
+	backoff := minRetryBackoff
+	for {
+		err := l.start()
+		if err == nil {
+			break
+		}
+
+		delay := jitter(backoff)
+		logging.Log(logging.Error, "Listener \"%s\" failed to start, retrying in %s: %v", l.Config.Name, delay.Round(time.Millisecond), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+
+	l.connection.mutex.Lock()
+	l.connection.ready = true
+	l.connection.mutex.Unlock()
+
+	logging.Log(logging.Info, "Listener \"%s\" subscribed", l.Config.Name)
+}
+
+// Name returns the name of the listener.
+func (l *listener) Name() string {
+	return l.Config.Name
+}
+
+// Ready reports whether the listener has subscribed and its client is still connected.
+func (l *listener) Ready() bool {
+	l.connection.mutex.Lock()
+	defer l.connection.mutex.Unlock()
+	return l.connection.ready && !l.connection.stopped && l.Config.Client.IsConnected()
+}
+
+// Stop publishes an offline state and disconnects, the broker does not send the last will on a clean disconnect.
+func (l *listener) Stop() {
+	if l.Config.Client == nil {
+		return
+	}
+
+	l.connection.mutex.Lock()
+	l.connection.stopped = true
+	l.connection.mutex.Unlock()
+
+	if !l.Config.Client.IsConnected() {
+		return
+	}
+
+	if l.Config.MQTT.AvailabilityTopic != "" {
+		publishAvailability(l.Config.Client, l.Config.MQTT.AvailabilityTopic, "offline", l.Config.Timeout)
 	}
+	l.Config.Client.Disconnect(250)
 }
 
 // Remove old clips that no longer have an associated event in frigate
 func (l *listener) removeOldClips() error {
 	// Retrieve all events currently in frigate database
 	url := fmt.Sprintf("%s/api/events?limit=-1", l.Config.Frigate.URL)
-	client := &http.Client{
-		Timeout: time.Duration(l.Config.Timeout) * time.Millisecond,
-	}
+	client := egress.Client("frigate", time.Duration(l.Config.Timeout)*time.Millisecond)
 
 	resp, err := client.Get(url)
 	if err != nil {
@@ -336,28 +629,24 @@ func (l *listener) removeOldClips() error {
 		eventIdMap[evt.ID] = struct{}{}
 	}
 
-	// List all files in the cache directory
-	files, err := os.ReadDir(l.Config.Frigate.CachePath)
+	// List all clips in the cache sink
+	sink := l.sink(time.Duration(l.Config.Timeout) * time.Millisecond)
+	filenames, err := sink.List()
 	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
+		return err
 	}
 
 	// Extract event IDs from filenames and compare with the event IDs from the endpoint
-	for _, file := range files {
-
-		if file.IsDir() {
-			continue
-		}
-
-		filename := file.Name()
+	for _, filename := range filenames {
 
-		// Check for .mp4 suffix
-		if !strings.HasSuffix(filename, ".mp4") {
+		// Check for .mp4 suffix, checksum sidecars are removed along with their clip
+		clip := strings.TrimSuffix(filename, checksumSuffix)
+		if !strings.HasSuffix(clip, ".mp4") {
 			continue
 		}
 
 		// Event ID should be part of the filename and separated by underscores
-		splitFilename := strings.Split(filename, "_")
+		splitFilename := strings.Split(clip, "_")
 		if len(splitFilename) == 0 {
 			continue
 		}
@@ -369,41 +658,74 @@ func (l *listener) removeOldClips() error {
 		}
 
 		// Remove the file if the event ID no longer exists
-		filePath := fmt.Sprintf("%s/%s", l.Config.Frigate.CachePath, filename)
-		if err := os.Remove(filePath); err != nil {
-			logging.Log(logging.Error, "Failed to remove file %s: %v", filePath, err)
+		if err := sink.Remove(filename); err != nil {
+			logging.Log(logging.Error, "Failed to remove file %s: %v", filename, err)
 		} else {
-			logging.Log(logging.Info, "Removed file %s", filePath)
+			logging.Log(logging.Info, "Removed file %s", filename)
 		}
 	}
 
 	return nil
 }
 
-// Generate a unique filename from a frigate event and download the associated clip
-func (l *listener) downloadEvent(eventId string, severity string, timeout time.Duration) error {
-	// Obtain metadata of event to build filename
+// getEvent retrieves the metadata of a frigate event.
+func (l *listener) getEvent(client *http.Client, eventId string) (*event, error) {
 	url := fmt.Sprintf("%s/api/events/%s", l.Config.Frigate.URL, eventId)
-	client := &http.Client{
-		Timeout: timeout,
-	}
 
 	resp, err := client.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to get event: %w", err)
+		return nil, fmt.Errorf("failed to get event: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to get event: received status code %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to get event: received status code %d", resp.StatusCode)
 	}
 
 	var evt event
 	if err := json.NewDecoder(resp.Body).Decode(&evt); err != nil {
-		return fmt.Errorf("failed to unmarshal event: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
 	}
+	return &evt, nil
+}
 
-	// Must immediatly close the body here as we will be reusing the client
-	resp.Body.Close()
+// templateData builds the data available to alert templates from a review, looking up the score of its latest event.
+func (l *listener) templateData(review *review, eventId string) *alertData {
+	data := review.After.Data
+	d := alertData{
+		ID:        review.After.ID,
+		Camera:    review.After.Camera,
+		Severity:  review.After.Severity,
+		Objects:   data.Objects,
+		Zones:     data.Zones,
+		SubLabels: data.SubLabels,
+	}
+	if len(data.Objects) > 0 {
+		d.Object = data.Objects[0]
+	}
+	if len(data.Zones) > 0 {
+		d.Zone = data.Zones[0]
+	}
+
+	client := egress.Client("frigate", time.Duration(l.Config.Timeout)*time.Millisecond)
+	evt, err := l.getEvent(client, eventId)
+	if err != nil {
+		logging.Log(logging.Error, "Failed to get score of event %s: %v", eventId, err)
+		return &d
+	}
+	d.Score = evt.score()
+	return &d
+}
+
+// Generate a unique filename from a frigate event and download the associated clip
+func (l *listener) downloadEvent(eventId string, severity string, timeout time.Duration) error {
+	client := egress.Client("frigate", timeout)
+
+	// Obtain metadata of event to build filename
+	evt, err := l.getEvent(client, eventId)
+	if err != nil {
+		return err
+	}
 
 	// Generate unique human readable filename using event metadata
 	filename := fmt.Sprintf("%s_%s_%s_%s_%s.mp4",
@@ -414,9 +736,9 @@ func (l *listener) downloadEvent(eventId string, severity string, timeout time.D
 		eventId,
 	)
 
-	url = fmt.Sprintf("%s/api/events/%s/clip.mp4", l.Config.Frigate.URL, eventId)
+	url := fmt.Sprintf("%s/api/events/%s/clip.mp4", l.Config.Frigate.URL, eventId)
 
-	resp, err = client.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return fmt.Errorf("failed to download event: %w", err)
 	}
@@ -426,18 +748,31 @@ func (l *listener) downloadEvent(eventId string, severity string, timeout time.D
 		return fmt.Errorf("failed to download event: received status code %d", resp.StatusCode)
 	}
 
-	// Create the file and write the response body to it
-	file, err := os.Create(fmt.Sprintf("%s/%s", l.Config.Frigate.CachePath, filename))
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+	// Write the response body to the cache sink, counting and hashing it as it streams
+	sink := l.sink(timeout)
+	hash := sha256.New()
+	counter := &countingReader{reader: io.TeeReader(resp.Body, hash)}
+	if err := sink.Write(filename, counter, resp.ContentLength); err != nil {
+		sink.Remove(filename)
+		return err
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to write to file: %w", err)
+	// Remove partial downloads rather than backing up a truncated clip
+	if resp.ContentLength >= 0 && counter.n != resp.ContentLength {
+		sink.Remove(filename)
+		return fmt.Errorf("failed to download event: received %d of %d bytes", counter.n, resp.ContentLength)
+	}
+
+	if !l.Config.Frigate.Checksums {
+		return nil
 	}
 
+	// Sidecars use the sha256sum format so that clips can be verified with sha256sum -c
+	checksum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(hash.Sum(nil)), filename)
+	if err := sink.Write(filename+checksumSuffix, strings.NewReader(checksum), int64(len(checksum))); err != nil {
+		sink.Remove(filename)
+		return fmt.Errorf("failed to write checksum: %w", err)
+	}
 	return nil
 }
 
@@ -445,9 +780,7 @@ func (l *listener) downloadEvent(eventId string, severity string, timeout time.D
 func (l *listener) attachmentBase64(eventId string) (string, error) {
 	method := "GET"
 	url := fmt.Sprintf("%s/api/events/%s/thumbnail.jpg", l.Config.Frigate.URL, eventId)
-	client := &http.Client{
-		Timeout: time.Duration(l.Config.Timeout) * time.Millisecond,
-	}
+	client := egress.Client("frigate", time.Duration(l.Config.Timeout)*time.Millisecond)
 
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
@@ -478,11 +811,11 @@ func (l *listener) attachmentBase64(eventId string) (string, error) {
 }
 
 // Generates a pushover alert request from a MQTT review message.
-func (l *listener) createAlertRequest(review *review) alert.Request {
+func (l *listener) createAlertRequest(review *review, priority int) alert.Request {
 	// Create a message based on event details
-	message := fmt.Sprintf("%s detected at %s",
-		joinStringSlice(review.After.Data.Objects, " and ", true),
-		joinStringSlice(review.After.Data.Zones, " and ", true))
+	message := fmt.Sprintf(i18n.T("%s detected at %s"),
+		joinStringSlice(review.After.Data.Objects, conjunction(), true),
+		joinStringSlice(review.After.Data.Zones, conjunction(), true))
 	// Obtain the event ID with the latest timestamp in the review
 	eventIds := review.After.Data.Detections
 	sort.Sort(sort.Reverse(sort.StringSlice(eventIds)))
@@ -492,11 +825,17 @@ func (l *listener) createAlertRequest(review *review) alert.Request {
 	if attachmentBase64 != "" {
 		attachmentType = "image/jpeg"
 	}
+	title := "Frigate"
+	if l.templates.title != nil || l.templates.message != nil {
+		data := l.templateData(review, eventIds[0])
+		title = render(l.templates.title, data, title)
+		message = render(l.templates.message, data, message)
+	}
 	return alert.Request{
 		Message:          message,
-		Title:            "Frigate",
-		Priority:         toJsonNumber(l.Config.Alert.Priority),
-		Token:            l.Config.Alert.Token,
+		Title:            title,
+		Priority:         toJsonNumber(priority),
+		Token:            l.Config.Alert.Token.Value(),
 		User:             l.Config.Alert.User,
 		URL:              l.Config.Frigate.ExternalUrl,
 		URLTitle:         "Open Frigate",
@@ -505,12 +844,13 @@ func (l *listener) createAlertRequest(review *review) alert.Request {
 	}
 }
 
-// sendAlert sends a pushover alert based on the provided request.
+// sendAlert sends a pushover alert based on the provided request and keeps it in the inbox.
 func (l *listener) sendAlert(request alert.Request) (*rawResponse, int, error) {
+	priority, _ := request.Priority.Int64()
+	inbox.Record("frigate/"+l.Config.Name, request.Title, request.Message, int(priority))
+
 	method := "POST"
-	client := &http.Client{
-		Timeout: time.Duration(l.Config.Timeout) * time.Millisecond,
-	}
+	client := egress.Client("frigate", time.Duration(l.Config.Timeout)*time.Millisecond)
 
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
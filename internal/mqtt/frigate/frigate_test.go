@@ -1,18 +1,23 @@
 package frigate
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/mux"
 	"github.com/kennedn/restate-go/internal/common/config"
 	"github.com/kennedn/restate-go/internal/common/logging"
 	alert "github.com/kennedn/restate-go/internal/device/alert/common"
@@ -74,6 +79,9 @@ func mockFrigateServer(w http.ResponseWriter, r *http.Request, tc *ListenTestCas
 			"endTime":   1234567890,
 			"camera":    "test_camera",
 			"zones":     []string{"zone1", "zone2"},
+			"data": map[string]interface{}{
+				"top_score": 0.92,
+			},
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(dummyEvent)
@@ -142,6 +150,12 @@ func TestListeners(t *testing.T) {
 			listenerCount: 1,
 			expectedError: nil,
 		},
+		{
+			name:          "invalid_template_config",
+			configPath:    "testdata/frigateConfig/invalid_template_config.yaml",
+			listenerCount: 0,
+			expectedError: errors.New(""),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -169,7 +183,7 @@ func TestListeners(t *testing.T) {
 	}
 }
 
-func TestListen(t *testing.T) {
+func TestStart(t *testing.T) {
 	logging.SetLogLevel(logging.Error)
 	testCases := []ListenTestCase{
 		{
@@ -194,6 +208,28 @@ func TestListen(t *testing.T) {
 			expectedAlertHit:     1,
 			expectedThumbnailHit: 1,
 		},
+		{
+			name:            "template",
+			configPath:      "testdata/frigateConfig/template_config.yaml",
+			thumbnailPath:   "testdata/frigateConfig/thumbnail.jpg",
+			clipPath:        "testdata/frigateConfig/clip.mp4",
+			mqttPayload:     []byte(`{"type":"new","before":{"camera":"front_garden","data":{"audio":[],"detections":["1723938588.335444-ctmuov"],"objects":["person"],"sub_labels":[],"zones":["front_enterance"]},"end_time":1723938593.734983,"id":"1723938590.336533-y0wa6z","severity":"alert","start_time":1723938590.336533,"thumb_path":"/media/frigate/clips/review/thumb-front_garden-1723938590.336533-y0wa6z.webp"},"after":{"camera":"front_garden","data":{"audio":[],"detections":["1723938588.335444-ctmuov"],"objects":["person"],"sub_labels":[],"zones":["front_enterance"]},"end_time":1723938593.734983,"id":"1723938590.336533-y0wa6z","severity":"alert","start_time":1723938590.336533,"thumb_path":"/media/frigate/clips/review/thumb-front_garden-1723938590.336533-y0wa6z.webp"}}`),
+			expectedBaseUrl: "/api/events/1723938588.335444-ctmuov",
+			expectedRequest: alert.Request{
+				Message:          "🚶 Person at Front Enterance (92%)",
+				Title:            "Front Garden",
+				Priority:         "0",
+				Token:            "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
+				User:             "",
+				URL:              "http://test.url",
+				URLTitle:         "Open Frigate",
+				AttachmentBase64: "/9j/2wBDAAMCAgICAgMCAgIDAwMDBAYEBAQEBAgGBgUGCQgKCgkICQkKDA8MCgsOCwkJDRENDg8QEBEQCgwSExIQEw8QEBD/yQALCAABAAEBAREA/8wABgAQEAX/2gAIAQEAAD8A0s8g/9k=",
+				AttachmentType:   "image/jpeg",
+			},
+			expectedError:        nil,
+			expectedAlertHit:     1,
+			expectedThumbnailHit: 2,
+		},
 		{
 			name:                 "no_device_in_config",
 			configPath:           "testdata/frigateConfig/no_device_config.yaml",
@@ -376,7 +412,7 @@ func TestListen(t *testing.T) {
 				l.Config.Frigate.URL = frigateServer.URL
 				l.Config.Alert.URL = alertServer.URL
 				l.Config.Frigate.CachePath = cacheDir
-				go l.Listen()
+				go l.Start(context.Background())
 
 				// Await the mqtt callback firing
 				wg.Wait()
@@ -404,3 +440,599 @@ func TestListen(t *testing.T) {
 		})
 	}
 }
+
+func TestAvailability(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	configFile, err := os.ReadFile("testdata/frigateConfig/availability_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	configMap := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &configMap); err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	published := []string{}
+	mockClient := &mockMqtt.Client{
+		SubscribeFunc: func(client mqtt.Client, callback mqtt.MessageHandler) {},
+		PublishFunc: func(topic string, qos byte, retained bool, payload interface{}) {
+			published = append(published, fmt.Sprintf("%s %v %v", topic, retained, payload))
+		},
+	}
+
+	_, ls, err := listeners(&configMap, mockClient)
+	if err != nil {
+		t.Fatalf("listeners returned an error: %v", err)
+	}
+
+	ls[0].Start(context.Background())
+	ls[0].Stop()
+
+	assert.Equal(t, []string{"restate-go/status true online", "restate-go/status true offline"}, published)
+}
+
+func TestStartRetry(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	minRetryBackoff, maxRetryBackoff = time.Millisecond, 4*time.Millisecond
+
+	configFile, err := os.ReadFile("testdata/frigateConfig/single_device_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	configMap := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &configMap); err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	attempts := 0
+	subscribed := 0
+	mockClient := &mockMqtt.Client{
+		SubscribeFunc: func(client mqtt.Client, callback mqtt.MessageHandler) {
+			subscribed++
+		},
+		ConnectFunc: func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	}
+
+	_, ls, err := listeners(&configMap, mockClient)
+	if err != nil {
+		t.Fatalf("listeners returned an error: %v", err)
+	}
+
+	assert.False(t, ls[0].Ready())
+	ls[0].Start(context.Background())
+
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 1, subscribed)
+	assert.True(t, ls[0].Ready())
+
+	ls[0].Stop()
+	assert.False(t, ls[0].Ready())
+
+	// A listener that never connects gives up once its context is cancelled
+	mockClient.ConnectFunc = func() error {
+		return errors.New("connection refused")
+	}
+	_, ls, _ = listeners(&configMap, mockClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ls[0].Start(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Start did not return after its context was cancelled")
+	}
+	assert.False(t, ls[0].Ready())
+}
+
+func TestSnooze(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	testCases := []struct {
+		name            string
+		method          string
+		url             string
+		data            []byte
+		expectedCode    int
+		expectedSnoozed map[string]bool
+	}{
+		{
+			name:            "get",
+			method:          "GET",
+			url:             "/frigate/frigate/snooze",
+			expectedCode:    200,
+			expectedSnoozed: map[string]bool{"front_garden": false, "back_garden": false},
+		},
+		{
+			name:            "snooze_all",
+			method:          "POST",
+			url:             "/frigate/frigate/snooze?minutes=30",
+			expectedCode:    200,
+			expectedSnoozed: map[string]bool{"front_garden": true, "back_garden": true},
+		},
+		{
+			name:            "snooze_camera",
+			method:          "POST",
+			url:             "/frigate/frigate/snooze/front_garden",
+			data:            []byte(`{"minutes":30}`),
+			expectedCode:    200,
+			expectedSnoozed: map[string]bool{"front_garden": true, "back_garden": false},
+		},
+		{
+			name:            "resume",
+			method:          "POST",
+			url:             "/frigate/frigate/snooze?minutes=0",
+			expectedCode:    200,
+			expectedSnoozed: map[string]bool{"front_garden": false, "back_garden": false},
+		},
+		{
+			name:            "missing_minutes",
+			method:          "POST",
+			url:             "/frigate/frigate/snooze",
+			expectedCode:    400,
+			expectedSnoozed: map[string]bool{"front_garden": false, "back_garden": false},
+		},
+		{
+			name:            "invalid_minutes",
+			method:          "POST",
+			url:             "/frigate/frigate/snooze?minutes=1441",
+			expectedCode:    400,
+			expectedSnoozed: map[string]bool{"front_garden": false, "back_garden": false},
+		},
+		{
+			name:            "invalid_method",
+			method:          "PUT",
+			url:             "/frigate/frigate/snooze?minutes=30",
+			expectedCode:    405,
+			expectedSnoozed: map[string]bool{"front_garden": false, "back_garden": false},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configFile, err := os.ReadFile("testdata/frigateConfig/single_device_config.yaml")
+			if err != nil {
+				t.Fatalf("Could not read config file")
+			}
+
+			configMap := config.Config{}
+
+			if err := yaml.Unmarshal(configFile, &configMap); err != nil {
+				t.Fatalf("Could not read config file")
+			}
+
+			_, ls, err := listeners(&configMap, &mockMqtt.Client{})
+			if err != nil {
+				t.Fatalf("listeners returned an error: %v", err)
+			}
+
+			router := mux.NewRouter()
+			for _, route := range ls[0].Routes() {
+				router.HandleFunc(route.Path, route.Handler)
+			}
+
+			request, _ := http.NewRequest(tc.method, tc.url, bytes.NewReader(tc.data))
+			if tc.data != nil {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+			for camera, snoozed := range tc.expectedSnoozed {
+				assert.Equal(t, snoozed, ls[0].snoozed(camera, time.Now()), camera)
+			}
+		})
+	}
+}
+
+func TestSubLabels(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	testCases := []struct {
+		name             string
+		reviewType       string
+		before           []string
+		after            []string
+		objects          []string
+		expectedPriority []string
+		expectedGate     int
+	}{
+		{
+			name:             "unrecognised_person",
+			reviewType:       "new",
+			objects:          []string{"person"},
+			expectedPriority: []string{"1"},
+		},
+		{
+			name:       "known_person",
+			reviewType: "new",
+			after:      []string{"alice"},
+			objects:    []string{"person"},
+		},
+		{
+			name:             "lowered_priority",
+			reviewType:       "new",
+			after:            []string{"postman"},
+			objects:          []string{"person"},
+			expectedPriority: []string{"-1"},
+		},
+		{
+			name:             "known_person_and_plate",
+			reviewType:       "new",
+			after:            []string{"bob", "ab12cde"},
+			objects:          []string{"person", "car"},
+			expectedPriority: []string{"0"},
+			expectedGate:     1,
+		},
+		{
+			name:             "unrecognised_car",
+			reviewType:       "new",
+			objects:          []string{"car"},
+			expectedPriority: []string{"0"},
+		},
+		{
+			name:         "plate_recognised_in_update",
+			reviewType:   "update",
+			after:        []string{"AB12CDE"},
+			objects:      []string{"car"},
+			expectedGate: 1,
+		},
+		{
+			name:       "plate_already_recognised",
+			reviewType: "update",
+			before:     []string{"AB12CDE"},
+			after:      []string{"AB12CDE"},
+			objects:    []string{"car"},
+		},
+	}
+
+	configFile, err := os.ReadFile("testdata/frigateConfig/sub_label_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	configMap := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &configMap); err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	_, ls, err := listeners(&configMap, &mockMqtt.Client{})
+	if err != nil {
+		t.Fatalf("listeners returned an error: %v", err)
+	}
+	l := ls[0]
+
+	priorities := []string{}
+	gate := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/alert":
+			request := alert.Request{}
+			json.NewDecoder(r.Body).Decode(&request)
+			priorities = append(priorities, request.Priority.String())
+			w.Write([]byte(`{"status":1,"request":"xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"}`))
+		case "/gate":
+			gate++
+			w.Write([]byte(`{"version":1,"message":"OK"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	l.Config.Frigate.URL = server.URL
+	l.Config.Alert.URL = server.URL + "/alert"
+	l.Config.SubLabels.Rules[2].Actions[0].URL = server.URL + "/gate"
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			priorities = []string{}
+			gate = 0
+
+			severity := "alert"
+			if tc.reviewType == "update" {
+				severity = "detection"
+			}
+			payload, _ := json.Marshal(map[string]any{
+				"type": tc.reviewType,
+				"before": map[string]any{"camera": "driveway", "severity": severity,
+					"data": map[string]any{"detections": []string{"event1"}, "objects": tc.objects, "sub_labels": tc.before}},
+				"after": map[string]any{"camera": "driveway", "severity": severity,
+					"data": map[string]any{"detections": []string{"event1"}, "objects": tc.objects, "sub_labels": tc.after}},
+			})
+			l.subscriptionCallback(nil, &mockMqtt.Message{PayloadVar: payload})
+
+			if tc.expectedPriority == nil {
+				tc.expectedPriority = []string{}
+			}
+			assert.Equal(t, tc.expectedPriority, priorities)
+			assert.Equal(t, tc.expectedGate, gate)
+		})
+	}
+
+	// Rules without sub labels fail to load
+	configMap.Devices[0].Config["subLabels"] = map[string]any{"rules": []any{map[string]any{"suppress": true}}}
+	_, _, err = listeners(&configMap, &mockMqtt.Client{})
+	assert.Error(t, err)
+}
+
+func TestDigest(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	configFile, err := os.ReadFile("testdata/frigateConfig/single_device_config.yaml")
+	if err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	configMap := config.Config{}
+
+	if err := yaml.Unmarshal(configFile, &configMap); err != nil {
+		t.Fatalf("Could not read config file")
+	}
+
+	_, ls, err := listeners(&configMap, &mockMqtt.Client{})
+	if err != nil {
+		t.Fatalf("listeners returned an error: %v", err)
+	}
+	l := ls[0]
+
+	after := time.Date(2024, 8, 17, 8, 0, 0, 0, time.Local)
+	before := after.Add(24 * time.Hour)
+	start := float64(after.Add(6*time.Hour + 32*time.Minute).Unix())
+
+	frigateServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/events":
+			assert.Equal(t, fmt.Sprintf("after=%d&before=%d&limit=-1", after.Unix(), before.Unix()), r.URL.RawQuery)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": "event1", "camera": "front_garden", "label": "person", "has_clip": true, "start_time": start, "data": map[string]interface{}{"top_score": 0.92}},
+				{"id": "event2", "camera": "front_garden", "label": "person", "has_clip": true, "start_time": start, "data": map[string]interface{}{"top_score": 0.81}},
+				{"id": "event3", "camera": "front_garden", "label": "car", "has_clip": false, "start_time": start, "data": map[string]interface{}{"top_score": 0.99}},
+				{"id": "event4", "camera": "back_garden", "label": "cat", "has_clip": true, "start_time": start, "top_score": 0.75},
+			})
+		case r.URL.Path == "/api/events/event1/thumbnail.jpg":
+			http.ServeFile(w, r, "testdata/frigateConfig/thumbnail.jpg")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer frigateServer.Close()
+
+	received := []alert.Request{}
+	alertServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := alert.Request{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("Could not parse request body")
+		}
+		received = append(received, request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":1,"request":"xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"}`))
+	}))
+	defer alertServer.Close()
+
+	l.Config.Frigate.URL = frigateServer.URL
+	l.Config.Alert.URL = alertServer.URL
+
+	if err := l.sendDigest(after, before); err != nil {
+		t.Fatalf("sendDigest returned an error: %v", err)
+	}
+
+	assert.Len(t, received, 1)
+	assert.Equal(t, "Frigate digest", received[0].Title)
+	assert.Equal(t, "4 events in the last 24 hours\n"+
+		"Front Garden: 3 (Car 1, Person 2)\n"+
+		"Back Garden: 1 (Cat 1)\n"+
+		"\n"+
+		"Notable clips:\n"+
+		"14:32 Person Front Garden (92%) http://test.url/api/events/event1/clip.mp4\n"+
+		"14:32 Person Front Garden (81%) http://test.url/api/events/event2/clip.mp4\n"+
+		"14:32 Cat Back Garden (75%) http://test.url/api/events/event4/clip.mp4", received[0].Message)
+	assert.Equal(t, "image/jpeg", received[0].AttachmentType)
+
+	assert.Equal(t, time.Date(2024, 8, 18, 8, 0, 0, 0, time.Local), nextDigest(time.Date(2024, 8, 17, 9, 0, 0, 0, time.Local), 8*time.Hour, 24*time.Hour))
+	assert.Equal(t, time.Date(2024, 8, 17, 14, 0, 0, 0, time.Local), nextDigest(time.Date(2024, 8, 17, 9, 0, 0, 0, time.Local), 8*time.Hour, 6*time.Hour))
+	assert.Equal(t, time.Date(2024, 8, 17, 2, 0, 0, 0, time.Local), nextDigest(time.Date(2024, 8, 17, 1, 0, 0, 0, time.Local), 8*time.Hour, 6*time.Hour))
+}
+
+func TestSinks(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	cacheDir, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	// Mock storage server implementing the subset of S3 and WebDAV used by the sinks
+	objects := map[string]string{}
+	var mutex sync.Mutex
+	storageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if strings.HasPrefix(r.URL.Path, "/bucket") && !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+			if strings.HasPrefix(r.URL.Path, "/bucket") {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			prefix := "/bucket/" + r.URL.Query().Get("prefix")
+			response := "<ListBucketResult>"
+			for k := range objects {
+				if strings.HasPrefix(k, prefix) {
+					response += fmt.Sprintf("<Contents><Key>%s</Key></Contents>", strings.TrimPrefix(k, "/bucket/"))
+				}
+			}
+			w.Write([]byte(response + "<IsTruncated>false</IsTruncated></ListBucketResult>"))
+		case "PROPFIND":
+			response := `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:"><d:response><d:href>/dav/</d:href></d:response>`
+			for k := range objects {
+				if strings.HasPrefix(k, "/dav/") {
+					response += fmt.Sprintf("<d:response><d:href>%s</d:href></d:response>", url.PathEscape(strings.TrimPrefix(k, "/dav/")))
+				}
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write([]byte(response + "</d:multistatus>"))
+		}
+	}))
+	defer storageServer.Close()
+
+	testCases := []struct {
+		name   string
+		config sinkConfig
+		stored string
+	}{
+		{
+			name:   "local",
+			config: sinkConfig{Type: "local"},
+		},
+		{
+			name:   "s3",
+			config: sinkConfig{Type: "s3", URL: storageServer.URL, Bucket: "bucket", Prefix: "frigate/", AccessKey: "access", SecretKey: "secret"},
+			stored: "/bucket/frigate/",
+		},
+		{
+			name:   "webdav",
+			config: sinkConfig{Type: "webdav", URL: storageServer.URL + "/dav", Username: "user", Password: "password"},
+			stored: "/dav/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.True(t, validSink(&tc.config))
+
+			l := listener{Config: &listenerConfig{}}
+			l.Config.Frigate.CachePath = cacheDir
+			l.Config.Frigate.CacheSink = tc.config
+			s := l.sink(time.Second)
+
+			filename := "2024-08-17T23:49:48+01:00_alert_person_front_enterance_1723938588.335444-ctmuov.mp4"
+			assert.NoError(t, s.Write(filename, strings.NewReader("clip"), 4))
+			assert.NoError(t, s.Write("other.mp4", strings.NewReader("other"), -1))
+
+			names, err := s.List()
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{filename, "other.mp4"}, names)
+
+			if tc.stored != "" {
+				assert.Equal(t, "clip", objects[tc.stored+filename])
+			}
+
+			assert.NoError(t, s.Remove("other.mp4"))
+			names, err = s.List()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{filename}, names)
+		})
+	}
+
+	assert.False(t, validSink(&sinkConfig{Type: "s3", URL: storageServer.URL}))
+	assert.False(t, validSink(&sinkConfig{Type: "ftp"}))
+}
+
+func TestDownloadEvent(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+
+	filename := time.Unix(1234567890, 0).Format(time.RFC3339) + "_alert_person_zone1_event1.mp4"
+
+	testCases := []struct {
+		name          string
+		checksums     bool
+		truncate      bool
+		expectedFiles []string
+		expectedError bool
+	}{
+		{
+			name:          "no_checksum",
+			expectedFiles: []string{filename},
+		},
+		{
+			name:          "checksum",
+			checksums:     true,
+			expectedFiles: []string{filename, filename + ".sha256"},
+		},
+		{
+			name:          "truncated",
+			checksums:     true,
+			truncate:      true,
+			expectedFiles: []string{},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir, err := os.MkdirTemp("", "cache")
+			if err != nil {
+				t.Fatalf("Failed to create temporary directory: %v", err)
+			}
+			defer os.RemoveAll(cacheDir)
+
+			frigateServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/events/event1":
+					w.Write([]byte(`{"id":"event1","label":"person","zones":["zone1"],"start_time":1234567890}`))
+				case "/api/events/event1/clip.mp4":
+					// Declare more bytes than are sent to simulate a dropped connection
+					if tc.truncate {
+						w.Header().Set("Content-Length", "100")
+					}
+					w.Write([]byte("clip"))
+				}
+			}))
+			defer frigateServer.Close()
+
+			l := listener{Config: &listenerConfig{}}
+			l.Config.Frigate.URL = frigateServer.URL
+			l.Config.Frigate.CachePath = cacheDir
+			l.Config.Frigate.Checksums = tc.checksums
+
+			err = l.downloadEvent("event1", "alert", time.Second)
+			assert.Equal(t, tc.expectedError, err != nil, err)
+
+			files, _ := os.ReadDir(cacheDir)
+			names := []string{}
+			for _, f := range files {
+				names = append(names, f.Name())
+			}
+			assert.Equal(t, tc.expectedFiles, names)
+
+			if tc.checksums && !tc.truncate {
+				checksum, _ := os.ReadFile(cacheDir + "/" + tc.expectedFiles[1])
+				assert.Equal(t, "67905ad3cc2dd52b1f5f6a6d2814de0396618b29b4238b9af5207aeb69936e6d  "+tc.expectedFiles[0]+"\n", string(checksum))
+			}
+		})
+	}
+}
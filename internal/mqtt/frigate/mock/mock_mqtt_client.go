@@ -9,11 +9,14 @@ import (
 
 type Client struct {
 	SubscribeFunc func(client mqtt.Client, callback mqtt.MessageHandler)
+	PublishFunc   func(topic string, qos byte, retained bool, payload interface{})
+	ConnectFunc   func() error
+	connected     bool
 }
 
-// IsConnected returns a hardcoded true value indicating the client is always connected
+// IsConnected returns true unless a ConnectFunc is provided, in which case it reports whether the last connect succeeded
 func (mc *Client) IsConnected() bool {
-	return true
+	return mc.ConnectFunc == nil || mc.connected
 }
 
 // IsConnectionOpen returns a hardcoded true value indicating the connection is always open
@@ -21,16 +24,26 @@ func (mc *Client) IsConnectionOpen() bool {
 	return true
 }
 
-// Connect simulates a connection and returns a mock Token
+// Connect simulates a connection and returns a mock Token, carrying the error returned by ConnectFunc if provided
 func (mc *Client) Connect() mqtt.Token {
-	return &Token{}
+	if mc.ConnectFunc == nil {
+		return &Token{}
+	}
+	err := mc.ConnectFunc()
+	mc.connected = err == nil
+	return &Token{Err: err}
 }
 
-// Disconnect simulates a disconnect operation with no real effect
-func (mc *Client) Disconnect(quiesce uint) {}
+// Disconnect simulates a disconnect operation, clearing the state left by a successful connect
+func (mc *Client) Disconnect(quiesce uint) {
+	mc.connected = false
+}
 
 // Publish simulates publishing a message and returns a mock Token
 func (mc *Client) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	if mc.PublishFunc != nil {
+		mc.PublishFunc(topic, qos, retained, payload)
+	}
 	return &Token{}
 }
 
@@ -107,6 +120,7 @@ func (m *Message) Ack() {
 
 // Token is a mock implementation of the Token interface
 type Token struct {
+	Err error
 }
 
 // Wait mocks the Wait method
@@ -128,5 +142,5 @@ func (m *Token) Done() <-chan struct{} {
 
 // Error mocks the Error method
 func (m *Token) Error() error {
-	return nil
+	return m.Err
 }
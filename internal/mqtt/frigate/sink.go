@@ -0,0 +1,424 @@
+package frigate
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+)
+
+// Cache sink types
+const (
+	localSink  = "local"
+	s3Sink     = "s3"
+	webdavSink = "webdav"
+)
+
+// Suffix of the sha256sum sidecar written alongside a clip
+const checksumSuffix = ".sha256"
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// sink stores cached clips, names follow the same scheme regardless of where they are written.
+type sink interface {
+	Write(name string, body io.Reader, size int64) error
+	List() ([]string, error)
+	Remove(name string) error
+}
+
+// sinkConfig configures where cached clips are written, clips are written to cachePath when type is local.
+type sinkConfig struct {
+	Type      string        `yaml:"type"`
+	URL       string        `yaml:"url"`
+	Bucket    string        `yaml:"bucket"`
+	Region    string        `yaml:"region"`
+	Prefix    string        `yaml:"prefix"`
+	AccessKey string        `yaml:"accessKey"`
+	SecretKey config.Secret `yaml:"secretKey"`
+	Username  string        `yaml:"username"`
+	Password  config.Secret `yaml:"password"`
+}
+
+// validSink reports whether a sink config has the parameters its type requires.
+func validSink(c *sinkConfig) bool {
+	switch c.Type {
+	case localSink:
+		return true
+	case s3Sink:
+		return c.URL != "" && c.Bucket != "" && c.AccessKey != "" && c.SecretKey != ""
+	case webdavSink:
+		return c.URL != ""
+	}
+	return false
+}
+
+// sink returns the configured cache sink of the listener.
+func (l *listener) sink(timeout time.Duration) sink {
+	c := l.Config.Frigate.CacheSink
+	client := egress.Client("frigate", timeout)
+
+	switch c.Type {
+	case s3Sink:
+		return &s3{config: c, client: client}
+	case webdavSink:
+		return &webdav{config: c, client: client}
+	}
+	return &local{path: l.Config.Frigate.CachePath}
+}
+
+// local writes clips to a directory.
+type local struct {
+	path string
+}
+
+// Write writes a clip to a temporary file that is renamed once complete, so that an interrupted download never leaves a partial clip.
+func (s *local) Write(name string, body io.Reader, _ int64) error {
+	partial := filepath.Join(s.path, name+".part")
+	file, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+
+	return os.Rename(partial, filepath.Join(s.path, name))
+}
+
+func (s *local) List() ([]string, error) {
+	files, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *local) Remove(name string) error {
+	return os.Remove(filepath.Join(s.path, name))
+}
+
+// s3 writes clips to an S3 compatible bucket, e.g. MinIO, using path style requests.
+type s3 struct {
+	config sinkConfig
+	client *http.Client
+}
+
+// listBucketResult is the part of a ListObjectsV2 response used to list clips.
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Hash of an empty payload, sent with requests that have no body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// awsEscape percent encodes a string as required by AWS signature version 4, leaving slashes as is unless escaping a query value.
+func awsEscape(s string, slash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !slash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// request creates a request for an object key signed with AWS signature version 4.
+func (s *s3) request(method string, key string, query url.Values, body io.Reader, size int64) (*http.Request, error) {
+	endpoint, err := url.Parse(s.config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	region := s.config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	canonicalURI := awsEscape(path.Join("/", endpoint.Path, s.config.Bucket, key), false)
+	if key == "" {
+		canonicalURI += "/"
+	}
+
+	keys := []string{}
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		params = append(params, awsEscape(k, true)+"="+awsEscape(query.Get(k), true))
+	}
+	canonicalQuery := strings.Join(params, "&")
+
+	requestURL := fmt.Sprintf("%s://%s%s", endpoint.Scheme, endpoint.Host, canonicalURI)
+	if canonicalQuery != "" {
+		requestURL += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		payloadHash = "UNSIGNED-PAYLOAD"
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), region)
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		canonicalQuery,
+		"host:" + endpoint.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.config.SecretKey.Value()), now.Format("20060102"))
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, stringToSign))))
+
+	return req, nil
+}
+
+// do sends a signed request, returning an error unless the response code is expected.
+func (s *s3) do(req *http.Request, expected int) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expected {
+		resp.Body.Close()
+		return nil, fmt.Errorf("received status code %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return resp, nil
+}
+
+func (s *s3) Write(name string, body io.Reader, size int64) error {
+	// S3 requires the length of an object up front
+	if size < 0 {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return fmt.Errorf("failed to read clip: %w", err)
+		}
+		body, size = bytes.NewReader(b), int64(len(b))
+	}
+
+	req, err := s.request(http.MethodPut, s.config.Prefix+name, nil, body, size)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("failed to upload clip: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3) List() ([]string, error) {
+	names := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.request(http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, http.StatusOK)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list clips: %w", err)
+		}
+
+		result := listBucketResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal clips: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.config.Prefix)
+			if name != "" && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *s3) Remove(name string) error {
+	req, err := s.request(http.MethodDelete, s.config.Prefix+name, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// webdav writes clips to a WebDAV collection.
+type webdav struct {
+	config sinkConfig
+	client *http.Client
+}
+
+// multistatus is the part of a PROPFIND response used to list clips.
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+	} `xml:"response"`
+}
+
+// do sends a request for a clip, or the collection when name is empty, returning an error for any unsuccessful response.
+func (s *webdav) do(method string, name string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(s.config.URL, "/")+"/"+url.PathEscape(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && size >= 0 {
+		req.ContentLength = size
+	}
+	if method == "PROPFIND" {
+		req.Header.Set("Depth", "1")
+	}
+	if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password.Value())
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("received status code %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return resp, nil
+}
+
+func (s *webdav) Write(name string, body io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, name, body, size)
+	if err != nil {
+		return fmt.Errorf("failed to upload clip: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *webdav) List() ([]string, error) {
+	resp, err := s.do("PROPFIND", "", nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clips: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result := multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal clips: %w", err)
+	}
+
+	names := []string{}
+	for _, r := range result.Responses {
+		// The collection itself is listed with a trailing slash
+		if strings.HasSuffix(r.Href, "/") {
+			continue
+		}
+		name, err := url.PathUnescape(path.Base(r.Href))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s *webdav) Remove(name string) error {
+	resp, err := s.do(http.MethodDelete, name, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,123 @@
+package frigate
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+)
+
+// Longest period alerts can be snoozed for in a single request
+const maxSnoozeMinutes = 1440
+
+// snooze tracks when suppressed alerts resume, for the whole listener and for individual cameras.
+type snooze struct {
+	mutex   sync.Mutex
+	until   time.Time
+	cameras map[string]time.Time
+}
+
+type snoozeRequest struct {
+	Minutes *int `json:"minutes" schema:"minutes"`
+}
+
+// snoozeState is the response of a snooze endpoint, times are omitted once they have passed.
+type snoozeState struct {
+	Until   *time.Time           `json:"until,omitempty"`
+	Cameras map[string]time.Time `json:"cameras,omitempty"`
+}
+
+// snoozed reports whether alerts for a camera are currently suppressed.
+func (l *listener) snoozed(camera string, now time.Time) bool {
+	l.snooze.mutex.Lock()
+	defer l.snooze.mutex.Unlock()
+	return now.Before(l.snooze.until) || now.Before(l.snooze.cameras[camera])
+}
+
+// state returns the snoozes that are still active.
+func (s *snooze) state(now time.Time) snoozeState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := snoozeState{
+		Cameras: map[string]time.Time{},
+	}
+	if now.Before(s.until) {
+		until := s.until
+		state.Until = &until
+	}
+	for camera, until := range s.cameras {
+		if now.Before(until) {
+			state.Cameras[camera] = until
+			continue
+		}
+		delete(s.cameras, camera)
+	}
+	return state
+}
+
+// set snoozes a camera, or the whole listener when camera is empty, until a given time. A time that has passed resumes alerts.
+func (s *snooze) set(camera string, until time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if camera == "" {
+		s.until = until
+		return
+	}
+	s.cameras[camera] = until
+}
+
+// Routes returns the snooze endpoints of the listener.
+func (l *listener) Routes() []router.Route {
+	return []router.Route{
+		{
+			Path:    "/frigate/" + l.Config.Name + "/snooze",
+			Handler: l.snoozeHandler,
+		},
+		{
+			Path:    "/frigate/" + l.Config.Name + "/snooze/{camera}",
+			Handler: l.snoozeHandler,
+		},
+	}
+}
+
+// snoozeHandler suppresses alerts for a number of minutes while events continue to be cached, GET returns the active snoozes.
+func (l *listener) snoozeHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method == http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", l.snooze.state(time.Now()))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	request := snoozeRequest{}
+
+	if err := device.DecodeRequest(r, &request); err != nil {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if request.Minutes == nil || *request.Minutes < 0 || *request.Minutes > maxSnoozeMinutes {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: minutes (Min: 0, Max: 1440)", nil)
+		return
+	}
+
+	now := time.Now()
+	l.snooze.set(mux.Vars(r)["camera"], now.Add(time.Duration(*request.Minutes)*time.Minute))
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", l.snooze.state(now))
+}
@@ -0,0 +1,112 @@
+package frigate
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kennedn/restate-go/internal/common/logging"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// subLabelRule matches the sub labels frigate gives the objects it recognises, i.e. the names of known faces and license plates.
+type subLabelRule struct {
+	SubLabels []string `yaml:"subLabels"`
+	// Suppress alerts whose sub labels are all matched by suppressing rules, e.g. for household members
+	Suppress bool `yaml:"suppress"`
+	// Priority of alerts with a matching sub label, the highest is used when several rules match
+	Priority *int `yaml:"priority"`
+	// Requests sent when a sub label first appears in a review, whether or not it is an alert, e.g. to open a gate for a known plate
+	Actions []device.Action `yaml:"actions"`
+}
+
+// subLabelConfig routes alerts by the sub labels of a review.
+type subLabelConfig struct {
+	Rules []*subLabelRule `yaml:"rules"`
+	// Priority of alerts for objects frigate has not recognised, i.e. reviews of one of the objects without any sub label
+	Unrecognised struct {
+		Objects  []string `yaml:"objects"`
+		Priority *int     `yaml:"priority"`
+	} `yaml:"unrecognised"`
+}
+
+// valid reports whether each rule has sub labels to match and each action a url and code.
+func (c *subLabelConfig) valid() bool {
+	for _, r := range c.Rules {
+		if len(r.SubLabels) == 0 {
+			return false
+		}
+		for _, a := range r.Actions {
+			if a.URL == "" || a.Code == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches reports whether the rule matches a sub label, ignoring case so that plates match however they are read.
+func (r *subLabelRule) matches(subLabel string) bool {
+	return slices.ContainsFunc(r.SubLabels, func(s string) bool {
+		return strings.EqualFold(s, subLabel)
+	})
+}
+
+// route reports whether the alert for a review is suppressed by its sub labels and the priority to send it with otherwise.
+func (l *listener) route(d *detail) (bool, int) {
+	c := &l.Config.SubLabels
+	priority := l.Config.Alert.Priority
+
+	if len(d.Data.SubLabels) == 0 {
+		if c.Unrecognised.Priority != nil && slices.ContainsFunc(d.Data.Objects, func(o string) bool {
+			return slices.Contains(c.Unrecognised.Objects, o)
+		}) {
+			priority = *c.Unrecognised.Priority
+		}
+		return false, priority
+	}
+
+	suppress := true
+	var matched *int
+	for _, s := range d.Data.SubLabels {
+		known := false
+		for _, r := range c.Rules {
+			if !r.matches(s) {
+				continue
+			}
+			known = known || r.Suppress
+			if r.Priority != nil && (matched == nil || *r.Priority > *matched) {
+				matched = r.Priority
+			}
+		}
+		suppress = suppress && known
+	}
+	if matched != nil {
+		priority = *matched
+	}
+	return suppress, priority
+}
+
+// sendSubLabelActions sends the actions of rules matching the sub labels a review has gained since its last message.
+func (l *listener) sendSubLabelActions(review *review) {
+	for _, s := range review.After.Data.SubLabels {
+		if review.Type != "new" && slices.Contains(review.Before.Data.SubLabels, s) {
+			continue
+		}
+		for _, r := range l.Config.SubLabels.Rules {
+			if !r.matches(s) {
+				continue
+			}
+			for _, a := range r.Actions {
+				_, code, err := a.Post(l.Config.Timeout)
+				if err != nil {
+					logging.Log(logging.Error, "Unable to send code \"%s\" to %s for %s: %v", a.Code, a.URL, s, err)
+				} else if code != http.StatusOK {
+					logging.Log(logging.Error, "Received status code %d from %s for %s", code, a.URL, s)
+				} else {
+					logging.Log(logging.Info, "Sent code \"%s\" to %s for %s", a.Code, a.URL, s)
+				}
+			}
+		}
+	}
+}
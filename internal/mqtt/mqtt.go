@@ -0,0 +1,79 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/mqtt/common"
+	"github.com/kennedn/restate-go/internal/mqtt/frigate"
+	router "github.com/kennedn/restate-go/internal/router/common"
+)
+
+type Device interface {
+	Listeners(config *config.Config) ([]common.Listener, error)
+}
+
+type Listeners struct {
+	listeners []common.Listener
+	wg        sync.WaitGroup
+}
+
+var (
+	// The thermostat listener is not registered until it has its own device type, it currently shares frigate's
+	devices = []Device{
+		&frigate.Device{},
+	}
+)
+
+// Listeners creates the listeners of every MQTT device type from a provided configuration.
+func (l *Listeners) Listeners(config *config.Config) ([]common.Listener, error) {
+	for _, device := range devices {
+		listeners, _ := device.Listeners(config)
+		l.listeners = append(l.listeners, listeners...)
+	}
+
+	if len(l.listeners) == 0 {
+		return []common.Listener{}, errors.New("no listeners returned from parsed config")
+	}
+
+	return l.listeners, nil
+}
+
+// Routes returns the HTTP endpoints of listeners that expose them, prefixed with the api version.
+func (l *Listeners) Routes(config *config.Config) []router.Route {
+	routes := []router.Route{}
+	for _, listener := range l.listeners {
+		r, ok := listener.(common.Router)
+		if !ok {
+			continue
+		}
+		for _, route := range r.Routes() {
+			route.Path = "/" + config.ApiVersion + route.Path
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// Start starts each listener in the background, listeners give up retrying once ctx is cancelled.
+func (l *Listeners) Start(ctx context.Context) {
+	for _, listener := range l.listeners {
+		l.wg.Add(1)
+		go func(listener common.Listener) {
+			defer l.wg.Done()
+			listener.Start(ctx)
+		}(listener)
+	}
+}
+
+// Stop waits for listeners that are still starting to return, then stops every listener. ctx passed to Start should be cancelled first.
+func (l *Listeners) Stop() {
+	l.wg.Wait()
+	for _, listener := range l.listeners {
+		listener.Stop()
+		logging.Log(logging.Info, "Stopped listener \"%s\"", listener.Name())
+	}
+}
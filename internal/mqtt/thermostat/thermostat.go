@@ -2,6 +2,7 @@ package thermostat
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
@@ -19,8 +20,11 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
 	"github.com/kennedn/restate-go/internal/common/logging"
 	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	"github.com/kennedn/restate-go/internal/mqtt/common"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"gopkg.in/yaml.v3"
@@ -106,10 +110,10 @@ type listenerConfig struct {
 		Port int    `yaml:"port"`
 	} `yaml:"mqtt"`
 	Alert struct {
-		URL      string `yaml:"url"`
-		Token    string `yaml:"token"`
-		User     string `yaml:"user"`
-		Priority int    `yaml:"priority"`
+		URL      string        `yaml:"url"`
+		Token    config.Secret `yaml:"token"`
+		User     string        `yaml:"user"`
+		Priority int           `yaml:"priority"`
 	} `yaml:"alert"`
 	Frigate struct {
 		URL         string `yaml:"url"`
@@ -159,9 +163,13 @@ func randomHex(n int) string {
 }
 
 // Create mqtt Listeners from a config
-func (d *Device) Listeners(config *config.Config) ([]listener, error) {
+func (d *Device) Listeners(config *config.Config) ([]common.Listener, error) {
 	_, listeners, err := listeners(config, nil)
-	return listeners, err
+	commonListeners := []common.Listener{}
+	for i := range listeners {
+		commonListeners = append(commonListeners, &listeners[i])
+	}
+	return commonListeners, err
 }
 
 // listeners is a function that creates one or more MQTT listeners
@@ -189,7 +197,7 @@ func listeners(config *config.Config, client mqtt.Client) (*base, []listener, er
 		}
 
 		// Unmarshal the YAML config into the listenerConfig struct
-		if err := yaml.Unmarshal(yamlConfig, &listenerConfig); err != nil {
+		if err := device.UnmarshalConfig(yamlConfig, &listenerConfig); err != nil {
 			logging.Log(logging.Info, "Unable to unmarshal device config")
 			continue
 		}
@@ -296,8 +304,25 @@ func (l *listener) subscriptionCallback(_ mqtt.Client, message mqtt.Message) {
 	_, _, _ = l.sendAlert(alertRequest)
 }
 
-// Subscribe to frigate reviews topic and process review messages.
-func (l *listener) Listen() {
+// Name returns the configured name of the listener.
+func (l *listener) Name() string {
+	return l.Config.Name
+}
+
+// Ready reports whether the listener is connected to its MQTT broker.
+func (l *listener) Ready() bool {
+	return l.Config.Client != nil && l.Config.Client.IsConnected()
+}
+
+// Stop disconnects the listener from its MQTT broker.
+func (l *listener) Stop() {
+	if l.Config.Client != nil {
+		l.Config.Client.Disconnect(250)
+	}
+}
+
+// Start subscribes to the frigate reviews topic and processes review messages.
+func (l *listener) Start(_ context.Context) {
 	if l.Config.Client == nil {
 		logging.Log(logging.Error, "MQTT client is not initialized")
 		return
@@ -316,9 +341,7 @@ func (l *listener) Listen() {
 func (l *listener) removeOldClips() error {
 	// Retrieve all events currently in frigate database
 	url := fmt.Sprintf("%s/api/events?limit=-1", l.Config.Frigate.URL)
-	client := &http.Client{
-		Timeout: time.Duration(l.Config.Timeout) * time.Millisecond,
-	}
+	client := egress.Client("thermostat", time.Duration(l.Config.Timeout)*time.Millisecond)
 
 	resp, err := client.Get(url)
 	if err != nil {
@@ -394,9 +417,7 @@ func (l *listener) removeOldClips() error {
 func (l *listener) downloadEvent(eventId string, severity string, timeout time.Duration) error {
 	// Obtain metadata of event to build filename
 	url := fmt.Sprintf("%s/api/events/%s", l.Config.Frigate.URL, eventId)
-	client := &http.Client{
-		Timeout: timeout,
-	}
+	client := egress.Client("thermostat", timeout)
 
 	resp, err := client.Get(url)
 	if err != nil {
@@ -455,9 +476,7 @@ func (l *listener) downloadEvent(eventId string, severity string, timeout time.D
 func (l *listener) attachmentBase64(eventId string) (string, error) {
 	method := "GET"
 	url := fmt.Sprintf("%s/api/events/%s/thumbnail.jpg", l.Config.Frigate.URL, eventId)
-	client := &http.Client{
-		Timeout: time.Duration(l.Config.Timeout) * time.Millisecond,
-	}
+	client := egress.Client("thermostat", time.Duration(l.Config.Timeout)*time.Millisecond)
 
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
@@ -506,7 +525,7 @@ func (l *listener) createAlertRequest(review *review) alert.Request {
 		Message:          message,
 		Title:            "Frigate",
 		Priority:         toJsonNumber(l.Config.Alert.Priority),
-		Token:            l.Config.Alert.Token,
+		Token:            l.Config.Alert.Token.Value(),
 		User:             l.Config.Alert.User,
 		URL:              l.Config.Frigate.ExternalUrl,
 		URLTitle:         "Open Frigate",
@@ -518,9 +537,7 @@ func (l *listener) createAlertRequest(review *review) alert.Request {
 // sendAlert sends a pushover alert based on the provided request.
 func (l *listener) sendAlert(request alert.Request) (*rawResponse, int, error) {
 	method := "POST"
-	client := &http.Client{
-		Timeout: time.Duration(l.Config.Timeout) * time.Millisecond,
-	}
+	client := egress.Client("thermostat", time.Duration(l.Config.Timeout)*time.Millisecond)
 
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
@@ -0,0 +1,97 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/inbox"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// alerts is the response of the alerts endpoint.
+type alerts struct {
+	Unread int           `json:"unread"`
+	Alerts []inbox.Entry `json:"alerts"`
+}
+
+// AlertsHandler serves the alerts kept in the inbox. GET returns them newest first along with the number of unread alerts, filtered by
+// the source, unread, since (RFC3339), priority (minimum) and limit parameters. POST with the read or unread code marks the alert whose
+// id is the value, or every alert when there is no value.
+func AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		filter := inbox.Filter{
+			Source: query.Get("source"),
+		}
+		if v := query.Get("unread"); v != "" {
+			unread, err := strconv.ParseBool(v)
+			if err != nil {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: unread", nil)
+				return
+			}
+			filter.Unread = unread
+		}
+		if v := query.Get("since"); v != "" {
+			since, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: since", nil)
+				return
+			}
+			filter.Since = since
+		}
+		if v := query.Get("priority"); v != "" {
+			priority, err := strconv.Atoi(v)
+			if err != nil {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: priority", nil)
+				return
+			}
+			filter.MinPriority = &priority
+		}
+		if v := query.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: limit", nil)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, unread := inbox.List(filter)
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", alerts{Unread: unread, Alerts: entries})
+	case http.MethodPost:
+		request := device.Request{}
+		if err := device.DecodeRequest(r, &request); err != nil {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if request.Code != "read" && request.Code != "unread" {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: code", nil)
+			return
+		}
+
+		id := uint64(0)
+		if request.Value != "" {
+			var err error
+			if id, err = strconv.ParseUint(request.Value.String(), 10, 64); err != nil || id == 0 {
+				httpCode, jsonResponse = device.SetJSONResponse(http.StatusBadRequest, "Invalid Parameter: value", nil)
+				return
+			}
+		}
+		if !inbox.MarkRead(id, request.Code == "read") {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusNotFound, "Not Found", nil)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", nil)
+	default:
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+	}
+}
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/gorilla/mux"
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+)
+
+// cacheRule is a Cache-Control value for the GET endpoints matching a path pattern.
+type cacheRule struct {
+	pattern string
+	value   string
+}
+
+// cacheWriter adds a Cache-Control header to successful responses.
+type cacheWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (c *cacheWriter) WriteHeader(code int) {
+	if !c.wroteHeader && code == http.StatusOK && c.Header().Get("Cache-Control") == "" {
+		c.Header().Set("Cache-Control", c.value)
+	}
+	c.wroteHeader = true
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *cacheWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, allowing responses to be flushed through the writer.
+func (c *cacheWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// CacheControl returns middleware that adds a Cache-Control header to successful GET and HEAD responses for paths matching a configured
+// pattern, e.g. /v2/meross/*, so that proxies and browsers can cache metadata that rarely changes. The first matching pattern applies,
+// and invalid patterns or entries without a max age or Cache-Control value are logged and ignored.
+func CacheControl(c []config.Cache) mux.MiddlewareFunc {
+	rules := []cacheRule{}
+	for _, cache := range c {
+		value := cache.CacheControl
+		if value == "" && cache.MaxAgeSeconds > 0 {
+			value = fmt.Sprintf("max-age=%d", cache.MaxAgeSeconds)
+		}
+		if _, err := path.Match(cache.Path, ""); err != nil || cache.Path == "" || value == "" {
+			logging.Log(logging.Error, "Ignoring cache entry for path \"%s\", a valid path and either maxAgeSeconds or cacheControl are required", cache.Path)
+			continue
+		}
+		rules = append(rules, cacheRule{pattern: cache.Path, value: value})
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(rules) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				for _, rule := range rules {
+					if matched, _ := path.Match(rule.pattern, r.URL.Path); matched {
+						w = &cacheWriter{ResponseWriter: w, value: rule.value}
+						break
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
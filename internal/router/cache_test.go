@@ -0,0 +1,60 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheControl(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	r := mux.NewRouter()
+	r.Use(CacheControl([]config.Cache{
+		{Path: "/v2/meross/*", MaxAgeSeconds: 60},
+		{Path: "/v2/*/*", CacheControl: "no-store"},
+		{Path: "/v2/tvcom/[", MaxAgeSeconds: 60},
+		{Path: "/v2/alert/*"},
+	}))
+	r.HandleFunc("/v2/meross/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.HandleFunc("/v2/meross/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	r.HandleFunc("/v2/tvcom/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private")
+		w.Write([]byte("OK"))
+	})
+	r.HandleFunc("/v2/alert/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	// Invalid entries are ignored, so tvcom falls through to the later pattern, and only successful GET and HEAD responses are cached
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		expected string
+	}{
+		{name: "first_match", method: http.MethodGet, path: "/v2/meross/lamp", expected: "max-age=60"},
+		{name: "head", method: http.MethodHead, path: "/v2/meross/lamp", expected: "max-age=60"},
+		{name: "later_match", method: http.MethodGet, path: "/v2/alert/door", expected: "no-store"},
+		{name: "post_not_cached", method: http.MethodPost, path: "/v2/meross/lamp", expected: ""},
+		{name: "error_not_cached", method: http.MethodGet, path: "/v2/meross/missing", expected: ""},
+		{name: "handler_value_kept", method: http.MethodGet, path: "/v2/tvcom/lounge", expected: "private"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.expected, recorder.Header().Get("Cache-Control"))
+		})
+	}
+}
@@ -5,4 +5,6 @@ import "net/http"
 type Route struct {
 	Path    string
 	Handler func(http.ResponseWriter, *http.Request)
+	// Streams is set on routes whose handler streams newline delimited JSON when asked, ending the stream itself once its request is cancelled
+	Streams bool
 }
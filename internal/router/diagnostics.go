@@ -0,0 +1,90 @@
+package router
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/kennedn/restate-go/internal/common/auth"
+	"github.com/kennedn/restate-go/internal/common/config"
+	device "github.com/kennedn/restate-go/internal/device/common"
+	router "github.com/kennedn/restate-go/internal/router/common"
+)
+
+// diagnostics is the response of the diagnostics endpoint.
+type diagnostics struct {
+	Goroutines     int               `json:"goroutines"`
+	HeapAllocBytes uint64            `json:"heapAllocBytes"`
+	HeapObjects    uint64            `json:"heapObjects"`
+	NumGC          uint32            `json:"numGC"`
+	Panics         int64             `json:"panics"`
+	Listeners      map[string]string `json:"listeners"`
+	Devices        any               `json:"devices,omitempty"`
+}
+
+// admin wraps a handler so that it is only served to requests presenting an admin token.
+func admin(tokens []config.Secret, handler http.HandlerFunc) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r, tokens) {
+			httpCode, jsonResponse := device.SetJSONResponse(http.StatusForbidden, "Forbidden", nil)
+			device.JSONResponse(w, httpCode, jsonResponse)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// DiagnosticsHandler returns a handler that reports goroutine and heap counts, recovered panics, the state of each component and the summary returned by devices.
+func DiagnosticsHandler(components []Readiness, devices func() any) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var jsonResponse []byte
+		var httpCode int
+
+		defer func() {
+			device.JSONResponse(w, httpCode, jsonResponse)
+		}()
+
+		if r.Method != http.MethodGet {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+			return
+		}
+
+		memStats := runtime.MemStats{}
+		runtime.ReadMemStats(&memStats)
+
+		response := diagnostics{
+			Goroutines:     runtime.NumGoroutine(),
+			HeapAllocBytes: memStats.HeapAlloc,
+			HeapObjects:    memStats.HeapObjects,
+			NumGC:          memStats.NumGC,
+			Panics:         Panics(),
+			Listeners:      map[string]string{},
+		}
+		for _, c := range components {
+			response.Listeners[c.Name()] = "starting"
+			if c.Ready() {
+				response.Listeners[c.Name()] = "ready"
+			}
+		}
+		if devices != nil {
+			response.Devices = devices()
+		}
+
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", response)
+	}
+}
+
+// DiagnosticsRoutes returns the net/http/pprof endpoints under /debug/pprof/ and the diagnostics endpoint under /<apiVersion>/admin/diagnostics,
+// all restricted to admins.
+func DiagnosticsRoutes(apiVersion string, adminTokens []config.Secret, components []Readiness, devices func() any) []router.Route {
+	return []router.Route{
+		{Path: "/" + apiVersion + "/admin/diagnostics", Handler: admin(adminTokens, DiagnosticsHandler(components, devices))},
+		{Path: "/debug/pprof/", Handler: admin(adminTokens, pprof.Index)},
+		{Path: "/debug/pprof/cmdline", Handler: admin(adminTokens, pprof.Cmdline)},
+		{Path: "/debug/pprof/profile", Handler: admin(adminTokens, pprof.Profile)},
+		{Path: "/debug/pprof/symbol", Handler: admin(adminTokens, pprof.Symbol)},
+		{Path: "/debug/pprof/trace", Handler: admin(adminTokens, pprof.Trace)},
+		// Named profiles, e.g. goroutine or heap, are served by the index
+		{Path: "/debug/pprof/{profile}", Handler: admin(adminTokens, pprof.Index)},
+	}
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// component is a background component whose readiness is fixed.
+type component struct {
+	name  string
+	ready bool
+}
+
+func (c *component) Name() string { return c.name }
+func (c *component) Ready() bool  { return c.ready }
+
+func TestDiagnostics(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	components := []Readiness{&component{name: "frigate", ready: true}, &component{name: "bthome"}}
+	devices := func() any { return map[string]int{"meross": 2} }
+
+	r := mux.NewRouter()
+	for _, route := range DiagnosticsRoutes("v2", []config.Secret{"", "s3cret"}, components, devices) {
+		r.HandleFunc(route.Path, route.Handler)
+	}
+	request := func(method string, path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// Every endpoint is restricted to admins, an empty configured token never matches
+	for _, path := range []string{"/v2/admin/diagnostics", "/debug/pprof/", "/debug/pprof/heap"} {
+		assert.Equal(t, http.StatusForbidden, request(http.MethodGet, path, "").Code, path)
+		assert.Equal(t, http.StatusForbidden, request(http.MethodGet, path, "wrong").Code, path)
+	}
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/debug/pprof/heap", "s3cret").Code)
+
+	recorder := request(http.MethodGet, "/v2/admin/diagnostics", "s3cret")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	response := struct {
+		Data diagnostics `json:"data"`
+	}{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Positive(t, response.Data.Goroutines)
+	assert.Positive(t, response.Data.HeapAllocBytes)
+	assert.Equal(t, map[string]string{"frigate": "ready", "bthome": "starting"}, response.Data.Listeners)
+	assert.Equal(t, map[string]any{"meross": float64(2)}, response.Data.Devices)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "/v2/admin/diagnostics", "s3cret").Code)
+}
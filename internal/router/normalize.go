@@ -0,0 +1,61 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	router "github.com/kennedn/restate-go/internal/router/common"
+)
+
+// normalized is the route a case and trailing slash insensitive path is served by.
+type normalized struct {
+	path string
+	// Set when routes differ only by case, so that the path cannot be resolved
+	ambiguous bool
+}
+
+// Normalize returns a handler that serves requests whose path only differs from a route's by case, a trailing slash or repeated slashes,
+// e.g. /Meross or //meross/lamp/, as if they were for that route. Paths that already match a route are left alone, as are those that
+// could match more than one but for their repeated slashes.
+func Normalize(routes []router.Route, next http.Handler) http.Handler {
+	exact := map[string]bool{}
+	folded := map[string]*normalized{}
+	for _, r := range routes {
+		// Routes with variables are matched by the router itself
+		if strings.Contains(r.Path, "{") {
+			continue
+		}
+		exact[r.Path] = true
+
+		trimmed := strings.TrimSuffix(r.Path, "/")
+		key := strings.ToLower(trimmed)
+		n, ok := folded[key]
+		switch {
+		case !ok:
+			folded[key] = &normalized{path: r.Path}
+		case strings.TrimSuffix(n.path, "/") != trimmed:
+			n.ambiguous = true
+		case !strings.HasSuffix(r.Path, "/"):
+			// Prefer the form without a trailing slash when both are registered
+			n.path = r.Path
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !exact[r.URL.Path] {
+			// The router would otherwise redirect repeated slashes, which clients follow as a GET
+			p := r.URL.Path
+			for strings.Contains(p, "//") {
+				p = strings.ReplaceAll(p, "//", "/")
+			}
+			if n, ok := folded[strings.ToLower(strings.TrimSuffix(p, "/"))]; !exact[p] && ok && !n.ambiguous {
+				p = n.path
+			}
+			if p != r.URL.Path {
+				r.URL.Path = p
+				r.URL.RawPath = ""
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,122 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	router "github.com/kennedn/restate-go/internal/router/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	served := ""
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		served = r.URL.Path
+	}
+	routes := []router.Route{
+		{Path: "/v2/meross", Handler: handler},
+		{Path: "/v2/meross/", Handler: handler},
+		{Path: "/v2/meross/lamp", Handler: handler},
+		{Path: "/v2/tvcom/", Handler: handler},
+		{Path: "/v2/alert/Door", Handler: handler},
+		{Path: "/v2/alert/door", Handler: handler},
+		{Path: "/v2/admin/devices/{name}/enabled", Handler: handler},
+	}
+	r := mux.NewRouter()
+	for _, route := range routes {
+		r.HandleFunc(route.Path, route.Handler)
+	}
+	normalize := Normalize(routes, r)
+
+	testCases := []struct {
+		name         string
+		path         string
+		expectedCode int
+		expectedPath string
+	}{
+		{
+			name:         "exact",
+			path:         "/v2/meross/",
+			expectedCode: 200,
+			expectedPath: "/v2/meross/",
+		},
+		{
+			name:         "trailing_slash_added",
+			path:         "/v2/meross/lamp/",
+			expectedCode: 200,
+			expectedPath: "/v2/meross/lamp",
+		},
+		{
+			name:         "trailing_slash_missing",
+			path:         "/v2/tvcom",
+			expectedCode: 200,
+			expectedPath: "/v2/tvcom/",
+		},
+		{
+			name:         "case",
+			path:         "/V2/Meross/LAMP",
+			expectedCode: 200,
+			expectedPath: "/v2/meross/lamp",
+		},
+		{
+			name:         "case_prefers_no_trailing_slash",
+			path:         "/v2/MEROSS/",
+			expectedCode: 200,
+			expectedPath: "/v2/meross",
+		},
+		{
+			name:         "duplicate_slashes",
+			path:         "/v2//meross///lamp",
+			expectedCode: 200,
+			expectedPath: "/v2/meross/lamp",
+		},
+		{
+			name:         "duplicate_slashes_case_and_trailing_slash",
+			path:         "//V2/Meross/Lamp//",
+			expectedCode: 200,
+			expectedPath: "/v2/meross/lamp",
+		},
+		{
+			name:         "routes_differing_by_case_matched_exactly",
+			path:         "/v2/alert/Door",
+			expectedCode: 200,
+			expectedPath: "/v2/alert/Door",
+		},
+		{
+			name:         "routes_differing_by_case_ambiguous",
+			path:         "/v2/alert/DOOR",
+			expectedCode: 404,
+		},
+		{
+			name:         "routes_differing_by_case_duplicate_slashes",
+			path:         "/v2//alert/door",
+			expectedCode: 200,
+			expectedPath: "/v2/alert/door",
+		},
+		{
+			name:         "variables_left_to_router",
+			path:         "/v2/admin/devices/lamp/enabled",
+			expectedCode: 200,
+			expectedPath: "/v2/admin/devices/lamp/enabled",
+		},
+		{
+			name:         "unknown",
+			path:         "/v2/Unknown/",
+			expectedCode: 404,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			served = ""
+			recorder := httptest.NewRecorder()
+			normalize.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, tc.path, nil))
+
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+			assert.Equal(t, tc.expectedPath, served)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/kennedn/restate-go/internal/common/version"
+)
+
+// Built once so that pings do not allocate header values
+var versionHeader = []string{version.Version}
+
+// Ping answers GET and HEAD requests for /ping with 204 and the build version in an X-Restate-Version header. It is served ahead of routing
+// and request logging, and performs no authentication or health evaluation, so that frequent container healthchecks stay cheap.
+func Ping(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ping" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header()["X-Restate-Version"] = versionHeader
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"net/http"
+
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Readiness is implemented by background components, e.g. MQTT listeners, that start after the HTTP server.
+type Readiness interface {
+	Name() string
+	Ready() bool
+}
+
+// ReadyHandler returns a handler that reports the state of each component, responding with 503 until all are ready.
+func ReadyHandler(components []Readiness) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var jsonResponse []byte
+		var httpCode int
+
+		defer func() {
+			device.JSONResponse(w, httpCode, jsonResponse)
+		}()
+
+		if r.Method != http.MethodGet {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+			return
+		}
+
+		ready := true
+		states := map[string]string{}
+		for _, c := range components {
+			if c.Ready() {
+				states[c.Name()] = "ready"
+				continue
+			}
+			states[c.Name()] = "starting"
+			ready = false
+		}
+
+		if !ready {
+			httpCode, jsonResponse = device.SetJSONResponse(http.StatusServiceUnavailable, "Service Unavailable", states)
+			return
+		}
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", states)
+	}
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+	"github.com/kennedn/restate-go/internal/common/i18n"
+	"github.com/kennedn/restate-go/internal/common/inbox"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// Panics alerted on within this window of the last alert are only logged
+const panicAlertInterval = time.Minute
+
+// Number of handler panics recovered since startup, reported by diagnostics
+var panics atomic.Int64
+
+// Panics returns the number of handler panics recovered since startup.
+func Panics() int64 {
+	return panics.Load()
+}
+
+// recoverer alerts on recovered panics, at most once per panicAlertInterval.
+type recoverer struct {
+	config    config.PanicAlert
+	lastAlert time.Time
+	mutex     sync.Mutex
+}
+
+// Recover returns middleware that recovers from panics in handlers, logging the stack and responding with a 500 in place of a dropped
+// connection. When an alert URL is configured, an alert naming the request and panic is also sent.
+func Recover(c config.PanicAlert) mux.MiddlewareFunc {
+	if c.Timeout == 0 {
+		c.Timeout = 5000
+	}
+	recoverer := &recoverer{config: c}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				// ErrAbortHandler is the net/http way of aborting a response, and is already handled by the server
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				panics.Add(1)
+				logging.Log(logging.Error, "Recovered from panic handling %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+
+				if recoverer.config.URL != "" {
+					go recoverer.alert(fmt.Sprintf("%s %s: %v", r.Method, r.URL.Path, err), time.Now())
+				}
+
+				httpCode, jsonResponse := device.SetJSONResponse(http.StatusInternalServerError, "Internal Server Error", nil)
+				device.JSONResponse(w, httpCode, jsonResponse)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// alert posts an alert request for a recovered panic to the configured alert URL.
+func (p *recoverer) alert(message string, now time.Time) {
+	p.mutex.Lock()
+	if now.Sub(p.lastAlert) < panicAlertInterval {
+		p.mutex.Unlock()
+		return
+	}
+	p.lastAlert = now
+	p.mutex.Unlock()
+
+	inbox.Record("panic", i18n.T("Recovered from a panic"), message, p.config.Priority)
+
+	client := egress.Client("panicAlert", time.Duration(p.config.Timeout)*time.Millisecond)
+
+	requestBytes, err := json.Marshal(alert.Request{
+		Message:  message,
+		Title:    i18n.T("Recovered from a panic"),
+		Priority: json.Number(fmt.Sprint(p.config.Priority)),
+		Token:    p.config.Token.Value(),
+		User:     p.config.User,
+	})
+	if err != nil {
+		logging.Log(logging.Error, "Failed to send panic alert: %v", err)
+		return
+	}
+
+	resp, err := client.Post(p.config.URL, "application/json", bytes.NewReader(requestBytes))
+	if err != nil {
+		logging.Log(logging.Error, "Failed to send panic alert: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logging.Log(logging.Error, "Failed to send panic alert: received status code %d from %s", resp.StatusCode, p.config.URL)
+	}
+}
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/logging"
+	alert "github.com/kennedn/restate-go/internal/device/alert/common"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecover(t *testing.T) {
+	logging.SetLogLevel(logging.Error)
+	alerts := make(chan alert.Request, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := alert.Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		alerts <- request
+	}))
+	defer server.Close()
+
+	r := mux.NewRouter()
+	r.Use(Recover(config.PanicAlert{URL: server.URL}))
+	r.HandleFunc("/v2/meross/lamp", func(w http.ResponseWriter, r *http.Request) {
+		var devices map[string]string
+		devices["lamp"] = "on"
+	})
+	r.HandleFunc("/v2/meross/plug", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	// A panicking handler is answered with the usual error envelope rather than a dropped connection
+	before := Panics()
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v2/meross/lamp", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `{"version":1,"message":"Internal Server Error"}`, recorder.Body.String())
+	assert.Equal(t, before+1, Panics())
+
+	select {
+	case a := <-alerts:
+		assert.Equal(t, "Recovered from a panic", a.Title)
+		assert.Equal(t, "POST /v2/meross/lamp: assignment to entry in nil map", a.Message)
+	case <-time.After(time.Second):
+		t.Error("No panic alert was sent")
+	}
+
+	// Later panics within the alert interval are only counted
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v2/meross/lamp", nil))
+	assert.Equal(t, before+2, Panics())
+	select {
+	case <-alerts:
+		t.Error("A second panic alert was sent within the interval")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Aborted responses are left to the server
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v2/meross/plug", nil))
+	})
+	assert.Equal(t, before+2, Panics())
+}
@@ -0,0 +1,25 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/kennedn/restate-go/internal/common/version"
+	device "github.com/kennedn/restate-go/internal/device/common"
+)
+
+// VersionHandler returns the version, commit, build date, Go version and config schema version of the running build.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	var jsonResponse []byte
+	var httpCode int
+
+	defer func() {
+		device.JSONResponse(w, httpCode, jsonResponse)
+	}()
+
+	if r.Method != http.MethodGet {
+		httpCode, jsonResponse = device.SetJSONResponse(http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+
+	httpCode, jsonResponse = device.SetJSONResponse(http.StatusOK, "OK", version.Get())
+}
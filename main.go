@@ -1,19 +1,37 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/gorilla/mux"
 	config "github.com/kennedn/restate-go/internal/common/config"
+	"github.com/kennedn/restate-go/internal/common/egress"
+	"github.com/kennedn/restate-go/internal/common/i18n"
 	"github.com/kennedn/restate-go/internal/common/logging"
+	"github.com/kennedn/restate-go/internal/common/storage"
+	"github.com/kennedn/restate-go/internal/common/version"
 	"github.com/kennedn/restate-go/internal/device"
-	"github.com/kennedn/restate-go/internal/mqtt/frigate"
+	"github.com/kennedn/restate-go/internal/mqtt"
 	"github.com/kennedn/restate-go/internal/router"
+	routerCommon "github.com/kennedn/restate-go/internal/router/common"
 	"gopkg.in/yaml.v3"
 )
 
 func main() {
+	selfTest := flag.Bool("selftest", false, "request the status of every device, print the results and exit, non-zero if any failed")
+	validate := flag.Bool("validate", false, "check the config for unknown keys, print any found and exit, non-zero if any were found")
+	flag.Parse()
+
+	build := version.Get()
+	logging.Log(logging.Info, "restate-go %s (commit %s, built %s, %s, config schema %d)", build.Version, build.Commit, build.BuildDate, build.GoVersion, build.SchemaVersion)
+
 	envConfigPath := os.Getenv("RESTATECONFIG")
 
 	configBytes, err := os.ReadFile(envConfigPath)
@@ -29,35 +47,137 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := i18n.SetLocale(configMap.Locale, configMap.Translations); err != nil {
+		logging.Log(logging.Error, "Could not set locale: %v", err)
+		os.Exit(1)
+	}
+
+	if err := storage.SetPath(configMap.Storage.Path); err != nil {
+		logging.Log(logging.Error, "Could not load storage: %v", err)
+		os.Exit(1)
+	}
+
+	if err := configMap.Defaults.Validate(); err != nil {
+		logging.Log(logging.Error, "Could not set defaults: %v", err)
+		os.Exit(1)
+	}
+	egress.SetDefaults(configMap.Defaults.UserAgent, configMap.Defaults.Retries)
+
+	if err := egress.SetOutbound(configMap.Proxy, configMap.CABundle); err != nil {
+		logging.Log(logging.Error, "Could not configure outbound requests: %v", err)
+		os.Exit(1)
+	}
+
+	if err := egress.SetDNS(time.Duration(configMap.DNS.TTLSeconds)*time.Second, configMap.DNS.Hosts); err != nil {
+		logging.Log(logging.Error, "Could not configure DNS: %v", err)
+		os.Exit(1)
+	}
+
+	if err := egress.SetPolicies(configMap.Egress); err != nil {
+		logging.Log(logging.Error, "Could not set egress policies: %v", err)
+		os.Exit(1)
+	}
+
 	devices := &device.Devices{}
 
 	routes, err := devices.Routes(&configMap)
-	var r *mux.Router
 	if err != nil {
 		logging.Log(logging.Info, err.Error())
-	} else {
-		r = router.NewRouter(routes)
-		if r == nil {
-			logging.Log(logging.Error, "Failed to create router")
+	}
+
+	// Check a config for typos without starting the server, listeners are loaded but not started so that their configs are checked too
+	if *validate {
+		(&mqtt.Listeners{}).Listeners(&configMap)
+		problems := device.Lint(configBytes)
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
 			os.Exit(1)
 		}
+		os.Exit(0)
 	}
 
-	frigate := &frigate.Device{}
-	listeners, err := frigate.Listeners(&configMap)
+	// Verify a deployment without starting the server, e.g. from a CI/CD pipeline
+	if *selfTest {
+		if len(routes) == 0 || !devices.SelfTest(os.Stdout) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	listeners := &mqtt.Listeners{}
+	mqttListeners, err := listeners.Listeners(&configMap)
 	if err != nil {
 		logging.Log(logging.Info, err.Error())
-	} else {
-		for _, listener := range listeners {
-			listener.Listen()
-		}
 	}
 
-	if len(routes) == 0 && len(listeners) == 0 {
+	for _, problem := range device.Lint(configBytes) {
+		logging.Log(logging.Error, problem)
+	}
+
+	if len(routes) == 0 && len(mqttListeners) == 0 {
 		logging.Log(logging.Error, "No devices or listeners provided, nothing left to do")
 		os.Exit(1)
 	}
 
+	// Listeners may expose endpoints of their own, e.g. to snooze alerts
+	routes = append(routes, listeners.Routes(&configMap)...)
+
+	readiness := []router.Readiness{}
+	for _, listener := range mqttListeners {
+		readiness = append(readiness, listener)
+	}
+
+	routes = append(routes, routerCommon.Route{
+		Path:    "/readyz",
+		Handler: router.ReadyHandler(readiness),
+	})
+
+	routes = append(routes, routerCommon.Route{
+		Path:    "/version",
+		Handler: router.VersionHandler,
+	})
+
+	// Recent alerts from every device and listener, for clients that missed the push notification
+	routes = append(routes, routerCommon.Route{
+		Path:    "/" + configMap.ApiVersion + "/alerts",
+		Handler: router.AlertsHandler,
+	})
+
+	// Profiling and runtime state, e.g. to track down goroutine leaks
+	if configMap.Diagnostics {
+		routes = append(routes, router.DiagnosticsRoutes(configMap.ApiVersion, configMap.AdminTokens, readiness, devices.Diagnostics)...)
+	}
+
+	r := router.NewRouter(routes)
+	if r == nil {
+		logging.Log(logging.Error, "Failed to create router")
+		os.Exit(1)
+	}
+	r.Use(router.Recover(configMap.PanicAlert))
+	r.Use(router.CacheControl(configMap.Cache))
+
+	ln, err := net.Listen("tcp", ":8080")
+	if err != nil {
+		logging.Log(logging.Error, err.Error())
+		os.Exit(1)
+	}
+
+	// Listeners are started once the server is accepting connections, retrying in the background if the broker is unavailable
+	ctx, cancel := context.WithCancel(context.Background())
+	listeners.Start(ctx)
+
+	// Publish offline states before exiting, the mqtt last will only covers unclean disconnects
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+		listeners.Stop()
+		os.Exit(0)
+	}()
+
 	logging.Log(logging.Info, "Server listening on :8080")
-	logging.Log(logging.Error, http.ListenAndServe(":8080", r).Error())
+	logging.Log(logging.Error, http.Serve(ln, router.Ping(router.Normalize(routes, r))).Error())
 }